@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+const (
+	// unpinnedActionRuleID flags a workflow or action step that uses an
+	// action by a movable tag or branch instead of a full commit SHA.
+	unpinnedActionRuleID = "PROV-027"
+	// deprecatedRuntimeRuleID flags a JavaScript action that runs on a
+	// Node.js version GitHub no longer supports.
+	deprecatedRuntimeRuleID = "PROV-028"
+	// disallowedActionRuleID flags actions on the action_denylist, and
+	// actions missing from the action_allowlist in jobs that mint
+	// provenance.
+	disallowedActionRuleID = "PROV-031"
+)
+
+// deprecatedActionRuntimes are runs.using values GitHub has deprecated.
+var deprecatedActionRuntimes = map[string]bool{"node12": true, "node16": true}
+
+var (
+	// usesKey matches a step's uses: key and captures the action reference.
+	usesKey = regexp.MustCompile(`^(?:-\s+)?uses:\s*["']?([^\s"'#]+)`)
+	// fullCommitSHA matches a full-length git commit SHA.
+	fullCommitSHA = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+	// releaseTag matches a full vX.Y.Z release tag.
+	releaseTag = regexp.MustCompile(`^v\d+\.\d+\.\d+$`)
+)
+
+// tagRefWorkflowPrefixes are reusable workflows that must be referenced by
+// a release tag: the SLSA generators verify their own ref against the tag
+// they were released under, and fail when pinned to a commit SHA.
+var tagRefWorkflowPrefixes = []string{"slsa-framework/slsa-github-generator/.github/workflows/"}
+
+// requiresTagRef reports whether a uses: reference names a reusable
+// workflow that must be referenced by a release tag, and is.
+func requiresTagRef(ref string) bool {
+	name := actionName(ref)
+	_, pin, _ := strings.Cut(ref, "@")
+	for _, prefix := range tagRefWorkflowPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return releaseTag.MatchString(pin)
+		}
+	}
+	return false
+}
+
+// isActionDefinition reports whether a base name is a GitHub action
+// definition, which may sit anywhere in the tree.
+func isActionDefinition(name string) bool {
+	return name == "action.yml" || name == "action.yaml"
+}
+
+// actionPin returns the ref an action reference is pinned to and whether it
+// is immutable: a full commit SHA, or a sha256 digest for docker:// images.
+// Local actions (./path) live in the repository and are not pinned; ok is
+// false for them.
+func actionPin(ref string) (pin string, immutable, ok bool) {
+	switch {
+	case strings.HasPrefix(ref, "./") || strings.HasPrefix(ref, "../"):
+		return "", false, false
+	case strings.HasPrefix(ref, "docker://"):
+		_, digest, found := strings.Cut(ref, "@")
+		return digest, found && strings.HasPrefix(digest, "sha256:"), true
+	case strings.Contains(ref, "${{"):
+		return "", false, false
+	}
+	_, pin, _ = strings.Cut(ref, "@")
+	return pin, fullCommitSHA.MatchString(pin), true
+}
+
+// actionTracker follows the structure of an action definition line by line:
+// its runs.using runtime, runs.image for Docker actions, and the index of
+// the runs.steps entry each line of a composite action belongs to.
+type actionTracker struct {
+	// rel is the workspace-relative path of the action definition.
+	rel string
+
+	inRuns      bool
+	inSteps     bool
+	stepsIndent int
+	itemIndent  int
+	// step is the zero-based index of the current runs.steps entry, or -1
+	// outside the steps.
+	step int
+
+	using, image         string
+	usingLine, imageLine int
+}
+
+// newActionTracker returns a tracker for the action definition at rel.
+func newActionTracker(rel string) *actionTracker {
+	return &actionTracker{rel: rel, step: -1}
+}
+
+// track reads the next line of the action definition.
+func (a *actionTracker) track(line string, lineNum int) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return
+	}
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	if indent == 0 {
+		a.inRuns, a.inSteps, a.step = strings.HasPrefix(trimmed, "runs:"), false, -1
+		return
+	}
+	if !a.inRuns {
+		return
+	}
+
+	item := strings.HasPrefix(trimmed, "- ") || trimmed == "-"
+	if a.inSteps && (indent < a.stepsIndent || indent == a.stepsIndent && !item) {
+		a.inSteps, a.step = false, -1
+	}
+	if a.inSteps {
+		if item && a.itemIndent < 0 {
+			a.itemIndent = indent
+		}
+		if item && indent == a.itemIndent {
+			a.step++
+		}
+		return
+	}
+
+	m := yamlKey.FindStringSubmatch(trimmed)
+	if m == nil {
+		return
+	}
+	value := yamlScalar(strings.TrimSpace(trimmed[len(m[0]):]))
+	switch m[1] {
+	case "using":
+		a.using, a.usingLine = strings.ToLower(value), lineNum
+	case "image":
+		a.image, a.imageLine = value, lineNum
+	case "steps":
+		a.inSteps, a.stepsIndent, a.itemIndent, a.step = true, indent, -1, -1
+	}
+}
+
+// yamlScalar strips quotes and a trailing comment from an inline YAML value.
+func yamlScalar(value string) string {
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return strings.Trim(value, `"'`)
+}
+
+// annotate adds the action path and current step index to a finding about
+// a line of a composite action. It does nothing for other files.
+func (a *actionTracker) annotate(fb *findingBuilder) *findingBuilder {
+	if a == nil {
+		return fb
+	}
+	fb.WithMetadata("action", a.rel)
+	if a.step >= 0 {
+		fb.WithMetadata("step_index", strconv.Itoa(a.step))
+	}
+	return fb
+}
+
+// finish reports a deprecated runtime and links the Dockerfile of a Docker
+// action into the Dockerfile checks, as a reference followed like a script.
+func (a *actionTracker) finish(findings *findingSet, filePath string, summary *scanSummary) {
+	if deprecatedActionRuntimes[a.using] {
+		findings.Finding(
+			deprecatedRuntimeRuleID,
+			sdk.SeverityLow,
+			sdk.ConfidenceHigh,
+			fmt.Sprintf("Action runs on deprecated runtime %s; move it to node20 or later", a.using),
+		).
+			At(filePath, a.usingLine, a.usingLine).
+			WithMetadata("type", "deprecated_action_runtime").
+			WithMetadata("runtime", a.using).
+			WithMetadata("action", a.rel).
+			Done()
+	}
+	if a.using == "docker" && a.image != "" && !strings.HasPrefix(a.image, "docker://") && resolvable(a.image) {
+		summary.scriptRefs = append(summary.scriptRefs, scriptRef{
+			from:      filePath,
+			line:      a.imageLine,
+			invokedBy: a.rel,
+			script:    path.Clean(a.image),
+			dir:       filepath.Dir(filePath),
+			explicit:  true,
+			format:    formatDockerfile,
+		})
+	}
+}
+
+// reportUnpinnedAction flags a uses: reference that is not pinned to an
+// immutable commit SHA or image digest, since the tag or branch it names
+// can be moved to different code after review. Reusable workflows that
+// must be referenced by a release tag are left alone.
+func reportUnpinnedAction(findings *findingSet, filePath string, lineNum int, ref string, action *actionTracker, origin commandOrigin) {
+	pin, immutable, ok := actionPin(ref)
+	if !ok || immutable || requiresTagRef(ref) {
+		return
+	}
+	message := fmt.Sprintf("Action %s is referenced by mutable ref %q rather than a full commit SHA", ref, pin)
+	if pin == "" {
+		message = fmt.Sprintf("Action %s is referenced without a pinned version", ref)
+	}
+	fb := findings.Finding(unpinnedActionRuleID, sdk.SeverityMedium, sdk.ConfidenceHigh, message).
+		At(filePath, lineNum, lineNum).
+		WithMetadata("type", "unpinned_action").
+		WithMetadata("action_ref", ref).
+		WithMetadata("pinned_ref", pin)
+	action.annotate(origin.annotate(fb)).Done()
+}
+
+// matchActionPattern returns the first pattern matching the owner/repo of an
+// action reference, or its full path for actions in a subdirectory, empty if
+// none does. Local actions, docker:// images, and references built from
+// expressions never match.
+func matchActionPattern(patterns []string, ref string) string {
+	if len(patterns) == 0 || strings.HasPrefix(ref, "docker://") {
+		return ""
+	}
+	if _, _, ok := actionPin(ref); !ok {
+		return ""
+	}
+	name := actionName(ref)
+	repo := name
+	if parts := strings.SplitN(name, "/", 3); len(parts) == 3 {
+		repo = parts[0] + "/" + parts[1]
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, repo); ok {
+			return pattern
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// reportDeniedAction flags a uses: reference matching the action_denylist.
+func reportDeniedAction(findings *findingSet, filePath string, lineNum int, ref, pattern, job string, action *actionTracker) {
+	fb := findings.Finding(
+		disallowedActionRuleID,
+		sdk.SeverityHigh,
+		sdk.ConfidenceHigh,
+		fmt.Sprintf("Action %s is denied by action_denylist pattern %q", ref, pattern),
+	).
+		At(filePath, lineNum, lineNum).
+		WithMetadata("type", "denied_action").
+		WithMetadata("action_ref", ref).
+		WithMetadata("matched_pattern", pattern)
+	if job != "" {
+		fb.WithMetadata("job", job)
+	}
+	action.annotate(fb).Done()
+}
+
+// reportAllowlist flags the actions of provenance-minting jobs, those with
+// an attestation or signing step, that match no action_allowlist pattern.
+// It does nothing without an allowlist.
+func (w *workflowTracker) reportAllowlist(findings *findingSet, filePath string, allow []string) {
+	if len(allow) == 0 {
+		return
+	}
+	for _, j := range w.jobs {
+		if j.attestLine == 0 {
+			continue
+		}
+		for _, use := range j.uses {
+			if _, _, ok := actionPin(use.ref); !ok || matchActionPattern(allow, use.ref) != "" {
+				continue
+			}
+			findings.Finding(
+				disallowedActionRuleID,
+				sdk.SeverityHigh,
+				sdk.ConfidenceHigh,
+				fmt.Sprintf("Job %s mints provenance but uses %s, which is not on the action_allowlist", j.name, use.ref),
+			).
+				At(filePath, use.line, use.line).
+				WithMetadata("type", "action_not_allowlisted").
+				WithMetadata("action_ref", use.ref).
+				WithMetadata("job", j.name).
+				WithMetadata("attestation_step", j.attestStep).
+				Done()
+		}
+	}
+}
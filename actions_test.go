@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestActionPin(t *testing.T) {
+	tests := []struct {
+		ref       string
+		pin       string
+		immutable bool
+		ok        bool
+	}{
+		{"actions/checkout@8e5e7e5ab8b370d6c329ec480221332ada57f0ab", "8e5e7e5ab8b370d6c329ec480221332ada57f0ab", true, true},
+		{"actions/checkout@v4", "v4", false, true},
+		{"github/codeql-action/init@main", "main", false, true},
+		{"actions/checkout", "", false, true},
+		{"docker://alpine:3.20", "", false, true},
+		{"docker://alpine@sha256:0123abcd", "sha256:0123abcd", true, true},
+		{"./.github/actions/setup", "", false, false},
+		{"${{ matrix.action }}", "", false, false},
+	}
+	for _, tt := range tests {
+		pin, immutable, ok := actionPin(tt.ref)
+		if pin != tt.pin || immutable != tt.immutable || ok != tt.ok {
+			t.Errorf("%s: got (%q, %v, %v), want (%q, %v, %v)", tt.ref, pin, immutable, ok, tt.pin, tt.immutable, tt.ok)
+		}
+	}
+}
+
+func TestRequiresTagRef(t *testing.T) {
+	for ref, want := range map[string]bool{
+		"slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@v2.0.0": true,
+		"slsa-framework/slsa-github-generator/.github/workflows/builder_go_slsa3.yml@v1.10.0":       true,
+		"slsa-framework/slsa-github-generator/.github/workflows/builder_go_slsa3.yml@v1":            false,
+		"slsa-framework/slsa-github-generator/.github/workflows/builder_go_slsa3.yml@main":          false,
+		"slsa-framework/slsa-github-generator/actions/delegator/setup-generic@v2.0.0":               false,
+		"actions/checkout@v4.1.0": false,
+	} {
+		if got := requiresTagRef(ref); got != want {
+			t.Errorf("requiresTagRef(%q) = %v, want %v", ref, got, want)
+		}
+	}
+}
+
+func TestScanSLSAGeneratorTagRef(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), strings.Join([]string{
+		"on: push",
+		"jobs:",
+		"  build:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - uses: actions/checkout@8e5e7e5ab8b370d6c329ec480221332ada57f0ab",
+		"  provenance:",
+		"    needs: build",
+		"    uses: slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@v2.0.0",
+		"  provenance-main:",
+		"    needs: build",
+		"    uses: slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@main",
+	}, "\n")+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+	found := findByRule(resp.GetFindings(), unpinnedActionRuleID)
+	if len(found) != 1 || found[0].GetMetadata()["pinned_ref"] != "main" {
+		t.Fatalf("expected only the branch reference to be flagged, got %v", found)
+	}
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["ci_references"] != "2" || meta["ci_references_sha_pinned"] != "1" || meta["ci_references_branch_pinned"] != "1" {
+		t.Errorf("unexpected summary pin counts: %v", meta)
+	}
+}
+
+func TestActionTrackerSteps(t *testing.T) {
+	lines := []string{
+		"name: setup",
+		"runs:",
+		"  using: composite",
+		"  steps:",
+		"    - uses: actions/checkout@v4",
+		"      with:",
+		"        fetch-depth: 0",
+		"    - run: |",
+		"        make",
+		"      shell: bash",
+		"branding:",
+	}
+	want := []int{-1, -1, -1, -1, 0, 0, 0, 1, 1, 1, -1}
+	a := newActionTracker("action.yml")
+	for i, line := range lines {
+		a.track(line, i+1)
+		if a.step != want[i] {
+			t.Errorf("line %d %q: step %d, want %d", i+1, line, a.step, want[i])
+		}
+	}
+	if a.using != "composite" || a.usingLine != 3 {
+		t.Errorf("using = %q at line %d, want composite at 3", a.using, a.usingLine)
+	}
+}
+
+func TestScanCompositeAction(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "actions", "setup", "action.yml"), strings.Join([]string{
+		"name: setup",
+		"runs:",
+		"  using: composite",
+		"  steps:",
+		"    - uses: actions/setup-go@v5",
+		"    - uses: actions/checkout@8e5e7e5ab8b370d6c329ec480221332ada57f0ab",
+		"    - uses: ./.github/actions/cache",
+		"    - run: curl -sSL https://example.com/install | sh",
+		"      shell: bash",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "ci.yml"), strings.Join([]string{
+		"on: push",
+		"jobs:",
+		"  build:",
+		"    steps:",
+		"      - uses: docker://alpine:3.20",
+	}, "\n")+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	unpinned := findByRule(resp.GetFindings(), unpinnedActionRuleID)
+	got := make(map[string]map[string]string)
+	for _, f := range unpinned {
+		got[f.GetMetadata()["action_ref"]] = f.GetMetadata()
+	}
+	if len(unpinned) != 2 {
+		t.Fatalf("expected two %s findings, got %d: %v", unpinnedActionRuleID, len(unpinned), got)
+	}
+	if meta := got["actions/setup-go@v5"]; meta["action"] != ".github/actions/setup/action.yml" || meta["step_index"] != "0" || meta["pinned_ref"] != "v5" {
+		t.Errorf("unexpected composite step finding: %v", meta)
+	}
+	if meta := got["docker://alpine:3.20"]; meta == nil || meta["action"] != "" {
+		t.Errorf("unexpected workflow finding: %v", meta)
+	}
+
+	var risk map[string]string
+	for _, f := range findByRule(resp.GetFindings(), "PROV-003") {
+		if f.GetLocation().GetFilePath() == ".github/actions/setup/action.yml" {
+			risk = f.GetMetadata()
+		}
+	}
+	if risk == nil || risk["step_index"] != "3" || risk["context"] != string(contextRunCommand) {
+		t.Errorf("expected a run-command PROV-003 in step 3 of the action, got %v", risk)
+	}
+
+	summary := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if summary["action_files_scanned"] != "1" {
+		t.Errorf("action_files_scanned = %q, want 1", summary["action_files_scanned"])
+	}
+}
+
+func TestScanDeprecatedActionRuntime(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "action.yaml"), "name: greet\nruns:\n  using: 'node16'\n  main: dist/index.js\n")
+	writeFile(t, filepath.Join(workspace, "modern", "action.yml"), "runs:\n  using: node20\n  main: index.js\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	deprecated := findByRule(resp.GetFindings(), deprecatedRuntimeRuleID)
+	if len(deprecated) != 1 {
+		t.Fatalf("expected one %s finding, got %d", deprecatedRuntimeRuleID, len(deprecated))
+	}
+	f := deprecated[0]
+	if f.GetLocation().GetFilePath() != "action.yaml" || f.GetLocation().GetStartLine() != 3 || f.GetMetadata()["runtime"] != "node16" {
+		t.Errorf("unexpected finding at %s:%d: %v", f.GetLocation().GetFilePath(), f.GetLocation().GetStartLine(), f.GetMetadata())
+	}
+	if got := severityNames[f.GetSeverity()]; got != "low" {
+		t.Errorf("severity %s, want low", got)
+	}
+}
+
+func TestScanDockerActionDockerfile(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "lint", "action.yml"), "runs:\n  using: docker\n  image: build/lint.image\n")
+	writeFile(t, filepath.Join(workspace, "lint", "build", "lint.image"), "FROM alpine:3.20\nCOPY id_rsa /root/.ssh/id_rsa\n")
+	writeFile(t, filepath.Join(workspace, "missing", "action.yml"), "runs:\n  using: docker\n  image: Dockerfile\n")
+	writeFile(t, filepath.Join(workspace, "remote", "action.yml"), "runs:\n  using: docker\n  image: docker://alpine:3.20\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	var copied int
+	for _, f := range findByRule(resp.GetFindings(), secretRuleID) {
+		if f.GetLocation().GetFilePath() == "lint/build/lint.image" && f.GetMetadata()["type"] == "secret_copied_into_image" {
+			copied++
+		}
+	}
+	if copied != 1 {
+		t.Errorf("expected the Docker action's Dockerfile to be scanned, got %d COPY findings", copied)
+	}
+
+	missing := findByRule(resp.GetFindings(), missingScriptRuleID)
+	if len(missing) != 1 || missing[0].GetMetadata()["invoked_by"] != "missing/action.yml" {
+		t.Errorf("expected one %s finding for missing/action.yml, got %d", missingScriptRuleID, len(missing))
+	}
+}
+
+func TestMatchActionPattern(t *testing.T) {
+	patterns := []string{"tj-actions/changed-files", "evilorg/*", "github/codeql-action/upload-*"}
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"tj-actions/changed-files@v35", "tj-actions/changed-files"},
+		{"EvilOrg/Tool@main", "evilorg/*"},
+		{"evilorg/tool/sub@v1", "evilorg/*"},
+		{"github/codeql-action/upload-sarif@v3", "github/codeql-action/upload-*"},
+		{"github/codeql-action/init@v3", ""},
+		{"./evilorg/local", ""},
+		{"docker://evilorg/image:1", ""},
+	}
+	for _, tt := range tests {
+		if got := matchActionPattern(patterns, tt.ref); got != tt.want {
+			t.Errorf("matchActionPattern(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestScanActionPolicy(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), strings.Join([]string{
+		"on: release",
+		"jobs:",
+		"  test:",
+		"    steps:",
+		"      - uses: tj-actions/changed-files@v35",
+		"      - uses: someone/lint@v1",
+		"  provenance:",
+		"    steps:",
+		"      - uses: actions/checkout@v4",
+		"      - uses: someone/setup@v1",
+		"      - uses: actions/attest-build-provenance@v2",
+	}, "\n")+"\n")
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root":   workspace,
+		"action_denylist":  "tj-actions/*",
+		"action_allowlist": []any{"actions/*"},
+	})
+
+	got := make(map[string]map[string]string)
+	for _, f := range findByRule(resp.GetFindings(), disallowedActionRuleID) {
+		if severityNames[f.GetSeverity()] != "high" {
+			t.Errorf("line %d: severity %s, want high", f.GetLocation().GetStartLine(), severityNames[f.GetSeverity()])
+		}
+		got[f.GetMetadata()["action_ref"]] = f.GetMetadata()
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected two %s findings, got %v", disallowedActionRuleID, got)
+	}
+	if meta := got["tj-actions/changed-files@v35"]; meta["type"] != "denied_action" || meta["matched_pattern"] != "tj-actions/*" || meta["job"] != "test" {
+		t.Errorf("unexpected denied action finding: %v", meta)
+	}
+	if meta := got["someone/setup@v1"]; meta["type"] != "action_not_allowlisted" || meta["job"] != "provenance" || meta["attestation_step"] != "actions/attest-build-provenance" {
+		t.Errorf("unexpected allowlist finding: %v", meta)
+	}
+}
+
+func TestScanActionPolicyInvalidPattern(t *testing.T) {
+	input, err := structpb.NewStruct(map[string]any{
+		"workspace_root":  t.TempDir(),
+		"action_denylist": "evil[org/*",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = testClient(t).InvokeTool(context.Background(), &pluginv1.InvokeToolRequest{
+		ToolName: "scan",
+		Input:    input,
+	})
+	if err == nil {
+		t.Fatal("expected an error for an invalid action_denylist pattern")
+	}
+}
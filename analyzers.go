@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// fileKind is a set of categories a walked file was classified into. A file
+// may belong to several, but each analyzer runs on it at most once.
+type fileKind uint32
+
+const (
+	kindProvenance fileKind = 1 << iota
+	kindBuildConfig
+	kindCIConfig
+	kindImageSource
+	kindLockfile
+	kindVerification
+	kindArchive
+	kindPinningConfig
+	kindAction
+	kindDevcontainer
+	kindSBOM
+	kindCargo
+	kindWrapper
+	kindRegistry
+	kindBinary
+	kindBuildpack
+)
+
+// has reports whether k includes any of the given kinds.
+func (k fileKind) has(kinds fileKind) bool {
+	return k&kinds != 0
+}
+
+// fileAnalyzer is a per-file check. The walk asks every registered analyzer
+// whether a file matches, and the pool runs the analyzers whose kinds the
+// file was classified into. Analyzers read the file themselves, since some
+// stream it and others only need its modification time.
+type fileAnalyzer interface {
+	// name identifies the analyzer in failure diagnostics.
+	name() string
+	// kinds returns the categories the analyzer handles.
+	kinds() fileKind
+	// matches returns the categories among kinds that the file at the
+	// workspace-relative slash path rel, with base name name, belongs to.
+	matches(rel, name string, provenance *provenanceMatcher) fileKind
+	// analyze checks a file classified into any of kinds, reporting
+	// findings and recording what later workspace checks need.
+	analyze(ctx context.Context, job scanJob, r *fileReporter) error
+}
+
+// fileReporter is what an analyzer reports into: the shared findings, and
+// the worker's own summary, which the pool merges once the file is done.
+type fileReporter struct {
+	findings   *findingSet
+	summary    *scanSummary
+	policy     provenancePolicy
+	provenance *provenanceMatcher
+	// budget bounds the time spent analyzing the file; zero disables it.
+	budget time.Duration
+}
+
+// fileAnalyzers lists the registered analyzers in the order they run on a
+// file matching several.
+var fileAnalyzers = []fileAnalyzer{
+	provenanceAnalyzer{},
+	buildConfigAnalyzer{},
+	ciAnalyzer{},
+	imageAnalyzer{},
+	lockfileAnalyzer{},
+	verificationAnalyzer{},
+	pinningAnalyzer{},
+	devcontainerAnalyzer{},
+	archiveAnalyzer{},
+	sbomAnalyzer{},
+	cargoAnalyzer{},
+	wrapperAnalyzer{},
+	registryAnalyzer{},
+	binaryAnalyzer{},
+	buildpackAnalyzer{},
+}
+
+// classifyFile returns every category the file matches, given its
+// workspace-relative slash path and base name.
+func classifyFile(rel, name string, provenance *provenanceMatcher) fileKind {
+	var kind fileKind
+	for _, a := range fileAnalyzers {
+		kind |= a.matches(rel, name, provenance) & a.kinds()
+	}
+	return kind
+}
+
+// analyzeFile runs each analyzer the job's categories call for, once. An
+// analyzer that fails or panics is reported as a diagnostic and the file's
+// remaining analyzers still run, so one bad file degrades coverage rather
+// than failing the scan. Once the file's time budget runs out its analysis
+// is abandoned, keeping the findings reported so far. Only cancellation is
+// returned.
+func analyzeFile(ctx context.Context, job scanJob, r *fileReporter) error {
+	r.summary.bytesRead += job.size
+	fileCtx := ctx
+	if r.budget > 0 {
+		var cancel context.CancelFunc
+		fileCtx, cancel = context.WithTimeout(ctx, r.budget)
+		defer cancel()
+	}
+	for _, a := range fileAnalyzers {
+		if !job.kind.has(a.kinds()) {
+			continue
+		}
+		err := fileCtx.Err()
+		if err == nil {
+			err = runAnalyzer(fileCtx, a, job, r)
+		}
+		switch {
+		case err == nil:
+		case isContextError(err) && ctx.Err() != nil:
+			return err
+		case isContextError(err) && fileCtx.Err() != nil:
+			reportTimeBudgetExceeded(r.findings, job.path, a.name(), r.budget)
+			r.summary.filesOverBudget++
+			r.summary.kindsLimited |= job.kind
+			return nil
+		default:
+			reportAnalyzerFailure(r.findings, job.path, a.name(), err)
+			r.summary.analyzerFailures++
+		}
+	}
+	return nil
+}
+
+// runAnalyzer runs one analyzer on a file, turning a panic into an error.
+func runAnalyzer(ctx context.Context, a fileAnalyzer, job scanJob, r *fileReporter) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return a.analyze(ctx, job, r)
+}
+
+// provenanceAnalyzer validates attestations and provenance.
+type provenanceAnalyzer struct{}
+
+func (provenanceAnalyzer) kinds() fileKind { return kindProvenance }
+
+func (provenanceAnalyzer) name() string { return "provenance" }
+
+func (provenanceAnalyzer) matches(rel, _ string, provenance *provenanceMatcher) fileKind {
+	if provenance.match(rel) {
+		return kindProvenance
+	}
+	return 0
+}
+
+func (provenanceAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	start := time.Now()
+	err := scanProvenanceFile(ctx, r.findings, job.path, r.policy, r.summary)
+	r.summary.timePhase(phaseProvenance, start)
+	return err
+}
+
+// buildConfigAnalyzer checks build configs for reproducibility. A build
+// config that is also a CI config or action definition is left to
+// ciAnalyzer, so that it is scanned once.
+type buildConfigAnalyzer struct{}
+
+func (buildConfigAnalyzer) kinds() fileKind { return kindBuildConfig }
+
+func (buildConfigAnalyzer) name() string { return "build_config" }
+
+func (buildConfigAnalyzer) matches(_, name string, _ *provenanceMatcher) fileKind {
+	if buildConfigFiles[name] {
+		return kindBuildConfig
+	}
+	return 0
+}
+
+func (buildConfigAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	r.summary.recordBuildConfigTime(r.findings.files(), job.path)
+	if job.kind.has(kindCIConfig | kindAction) {
+		return nil
+	}
+	start := time.Now()
+	err := scanBuildFileForReproducibility(ctx, r.findings, job.path, configOrigin(r.findings.root, job.path, false), r.policy, r.summary)
+	r.summary.timePhase(phaseBuildScan, start)
+	return err
+}
+
+// ciAnalyzer checks CI configs and action definitions with the
+// reproducibility analyzer. Action steps run in the workspace of the
+// calling workflow.
+type ciAnalyzer struct{}
+
+func (ciAnalyzer) kinds() fileKind { return kindCIConfig | kindAction }
+
+func (ciAnalyzer) name() string { return "ci" }
+
+func (ciAnalyzer) matches(rel, name string, _ *provenanceMatcher) fileKind {
+	var kind fileKind
+	if isCIConfig(rel) {
+		kind |= kindCIConfig
+	}
+	if isActionDefinition(name) {
+		kind |= kindAction
+	}
+	return kind
+}
+
+func (ciAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	start := time.Now()
+	err := scanBuildFileForReproducibility(ctx, r.findings, job.path, configOrigin(r.findings.root, job.path, true), r.policy, r.summary)
+	r.summary.timePhase(phaseCIAnalysis, start)
+	return err
+}
+
+// imageAnalyzer extracts image references. CI configs are not image
+// sources: the images they name run jobs rather than being deployed.
+type imageAnalyzer struct{}
+
+func (imageAnalyzer) kinds() fileKind { return kindImageSource }
+
+func (imageAnalyzer) name() string { return "images" }
+
+func (imageAnalyzer) matches(rel, name string, _ *provenanceMatcher) fileKind {
+	if !isCIConfig(rel) && isImageSource(name) {
+		return kindImageSource
+	}
+	return 0
+}
+
+func (imageAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	return scanImageReferences(ctx, r.findings.files(), job.path, r.summary)
+}
+
+// lockfileAnalyzer records the dependencies lockfiles pin.
+type lockfileAnalyzer struct{}
+
+func (lockfileAnalyzer) kinds() fileKind { return kindLockfile }
+
+func (lockfileAnalyzer) name() string { return "lockfile" }
+
+func (lockfileAnalyzer) matches(_, name string, _ *provenanceMatcher) fileKind {
+	if lockfileNames[name] != "" {
+		return kindLockfile
+	}
+	return 0
+}
+
+func (lockfileAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	return scanLockfile(ctx, r.findings.files(), job.path, r.summary)
+}
+
+// verificationAnalyzer looks for signing keys, admission policies, and
+// documented verification steps.
+type verificationAnalyzer struct{}
+
+func (verificationAnalyzer) kinds() fileKind { return kindVerification }
+
+func (verificationAnalyzer) name() string { return "verification" }
+
+func (verificationAnalyzer) matches(rel, name string, _ *provenanceMatcher) fileKind {
+	if isKeyFileName(name) || isDocumentation(name) || (isYAMLName(strings.ToLower(name)) && !isCIConfig(rel)) {
+		return kindVerification
+	}
+	return 0
+}
+
+func (verificationAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	return scanVerificationFile(ctx, r.findings, job.path, r.policy, r.summary)
+}
+
+// pinningAnalyzer reads dependency update bot configs.
+type pinningAnalyzer struct{}
+
+func (pinningAnalyzer) kinds() fileKind { return kindPinningConfig }
+
+func (pinningAnalyzer) name() string { return "pinning" }
+
+func (pinningAnalyzer) matches(rel, _ string, _ *provenanceMatcher) fileKind {
+	if pinningBot(rel) != "" {
+		return kindPinningConfig
+	}
+	return 0
+}
+
+func (pinningAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	return scanPinningConfig(ctx, r.findings.files(), job.path, r.summary)
+}
+
+// devcontainerAnalyzer checks the images dev containers build in.
+type devcontainerAnalyzer struct{}
+
+func (devcontainerAnalyzer) kinds() fileKind { return kindDevcontainer }
+
+func (devcontainerAnalyzer) name() string { return "devcontainer" }
+
+func (devcontainerAnalyzer) matches(_, name string, _ *provenanceMatcher) fileKind {
+	if isDevcontainerConfig(name) {
+		return kindDevcontainer
+	}
+	return 0
+}
+
+func (devcontainerAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	return scanDevcontainer(ctx, r.findings, job.path, r.summary)
+}
+
+// archiveAnalyzer hashes release archives and validates the provenance
+// inside them.
+type archiveAnalyzer struct{}
+
+func (archiveAnalyzer) kinds() fileKind { return kindArchive }
+
+func (archiveAnalyzer) name() string { return "archive" }
+
+func (archiveAnalyzer) matches(_, name string, _ *provenanceMatcher) fileKind {
+	if isArchiveName(name) {
+		return kindArchive
+	}
+	return 0
+}
+
+func (archiveAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	return scanArchive(ctx, r.findings, job.path, r.policy, r.provenance, r.summary)
+}
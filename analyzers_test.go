@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+func TestFileAnalyzersCoverEveryKind(t *testing.T) {
+	var seen fileKind
+	for _, a := range fileAnalyzers {
+		if seen.has(a.kinds()) {
+			t.Errorf("%T handles kinds %b that another analyzer handles", a, seen&a.kinds())
+		}
+		seen |= a.kinds()
+	}
+	if want := kindBuildpack<<1 - 1; seen != want {
+		t.Errorf("analyzers handle kinds %b, want %b", seen, want)
+	}
+}
+
+func TestRunWorkspaceChecksStopsWhenInterrupted(t *testing.T) {
+	root := t.TempDir()
+	ws := &workspaceScan{
+		root:           root,
+		opts:           scanOptions{checkCI: true},
+		findings:       &findingSet{root: root},
+		summary:        &scanSummary{interrupted: context.Canceled},
+		hasBuildConfig: true,
+		buildConfigs:   []buildConfigRef{{path: "Makefile", rel: "Makefile"}},
+	}
+	runWorkspaceChecks(context.Background(), ws)
+	if n := len(ws.findings.items); n != 0 {
+		t.Errorf("expected no workspace findings after an interruption, got %d", n)
+	}
+
+	ws.summary.interrupted = nil
+	runWorkspaceChecks(context.Background(), ws)
+	if n := len(ws.findings.items); n == 0 {
+		t.Error("expected PROV-001 and PROV-020 once the scan completed")
+	}
+}
+
+// failingAnalyzer handles build configs and fails on every one, by
+// panicking or by returning an error naming the file.
+type failingAnalyzer struct {
+	panics bool
+}
+
+func (a failingAnalyzer) name() string {
+	if a.panics {
+		return "test_panic"
+	}
+	return "test_error"
+}
+
+func (failingAnalyzer) kinds() fileKind { return kindBuildConfig }
+
+func (failingAnalyzer) matches(_, _ string, _ *provenanceMatcher) fileKind { return 0 }
+
+func (a failingAnalyzer) analyze(_ context.Context, job scanJob, _ *fileReporter) error {
+	if a.panics {
+		panic("index out of range")
+	}
+	return fmt.Errorf("reading %s:\nunexpected EOF", job.path)
+}
+
+func TestScanReportsAnalyzerFailures(t *testing.T) {
+	workspace := filepath.Join(testdataDir(t), "without-provenance")
+	client := testClient(t)
+	keys := func(findings map[string]bool, skip ...string) []string {
+		var out []string
+		for k := range findings {
+			if !hasAnyPrefix(k, skip) {
+				out = append(out, k)
+			}
+		}
+		sort.Strings(out)
+		return out
+	}
+	collect := func() (map[string]bool, map[string]string) {
+		resp := invokeScan(t, client, workspace)
+		seen := make(map[string]bool)
+		for _, f := range resp.GetFindings() {
+			seen[fmt.Sprintf("%s %s:%d", f.GetRuleId(), f.GetLocation().GetFilePath(), f.GetLocation().GetStartLine())] = true
+		}
+		return seen, findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	}
+	baseline, _ := collect()
+
+	saved := fileAnalyzers
+	defer func() { fileAnalyzers = saved }()
+	fileAnalyzers = append([]fileAnalyzer{failingAnalyzer{panics: true}}, saved...)
+	fileAnalyzers = append(fileAnalyzers, failingAnalyzer{})
+
+	degraded, summary := collect()
+	if got, want := keys(degraded, analyzerFailureRuleID, summaryRuleID), keys(baseline, summaryRuleID); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("findings with failing analyzers = %q, want %q", got, want)
+	}
+	if got := summary["analyzer_failures"]; got != "4" {
+		t.Errorf("analyzer_failures = %q, want 4", got)
+	}
+
+	resp := invokeScan(t, client, workspace)
+	failures := findByRule(resp.GetFindings(), analyzerFailureRuleID)
+	if len(failures) != 4 {
+		t.Fatalf("expected 4 %s findings, got %d", analyzerFailureRuleID, len(failures))
+	}
+	for _, f := range failures {
+		meta := f.GetMetadata()
+		switch meta["analyzer"] {
+		case "test_panic":
+			if meta["panic"] != "true" || meta["error"] != "panic: index out of range" {
+				t.Errorf("panic finding metadata = %v", meta)
+			}
+		case "test_error":
+			want := "reading " + f.GetLocation().GetFilePath() + ": unexpected EOF"
+			if meta["panic"] != "false" || meta["error"] != want {
+				t.Errorf("error = %q, want %q", meta["error"], want)
+			}
+		default:
+			t.Errorf("unexpected analyzer %q", meta["analyzer"])
+		}
+	}
+}
+
+func TestSanitizeAnalyzerError(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "work", "repo")
+	err := errors.New("open " + filepath.Join(root, "a", "Dockerfile") + ": permission denied\n\tat " + root)
+	if got, want := sanitizeAnalyzerError(err, root), "open "+filepath.Join("a", "Dockerfile")+": permission denied at ."; got != want {
+		t.Errorf("sanitizeAnalyzerError = %q, want %q", got, want)
+	}
+	long := sanitizeAnalyzerError(errors.New(strings.Repeat("x", 1000)), root)
+	if len(long) != maxAnalyzerErrorLen+len("...") {
+		t.Errorf("long error kept %d bytes", len(long))
+	}
+}
+
+func TestScanAbandonsFileAtTimeBudget(t *testing.T) {
+	workspace := t.TempDir()
+
+	// Long run lines full of substitutions and quotes are slow to match
+	// against every command pattern: unbounded, this workflow takes seconds.
+	step := strings.Repeat(`curl -fsSL "$(echo `+"`date`"+` ${{ inputs.tag }})" && echo "a\"b" `, 1000)
+	var large strings.Builder
+	large.WriteString("on: push\njobs:\n  build:\n    steps:\n      - run: |\n")
+	for large.Len() < 8<<20 {
+		large.WriteString("          " + step + "\n")
+	}
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "build.yml"), large.String())
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), "FROM debian:latest\nRUN apt-get update\n")
+
+	start := time.Now()
+	resp, err := handleScan(context.Background(), sdk.ToolRequest{Input: map[string]any{
+		"workspace_root":      workspace,
+		"file_time_budget_ms": float64(50),
+	}})
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("scan took %v, expected the slow file to be abandoned at its budget", elapsed)
+	}
+
+	var over []*pluginv1.Finding
+	for _, f := range findByRule(resp.GetFindings(), analyzerFailureRuleID) {
+		if f.GetMetadata()["type"] == "time_budget_exceeded" {
+			over = append(over, f)
+		}
+	}
+	if len(over) != 1 || over[0].GetLocation().GetFilePath() != ".github/workflows/build.yml" {
+		t.Fatalf("expected one time_budget_exceeded finding for the workflow, got %v", over)
+	}
+	if got := over[0].GetMetadata()["budget_ms"]; got != "50" {
+		t.Errorf("budget_ms = %q, want 50", got)
+	}
+	if got := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()["files_over_time_budget"]; got != "1" {
+		t.Errorf("files_over_time_budget = %q, want 1", got)
+	}
+	found := false
+	for _, f := range findByRule(resp.GetFindings(), "PROV-003") {
+		found = found || f.GetLocation().GetFilePath() == "Dockerfile"
+	}
+	if !found {
+		t.Error("expected the Dockerfile to be analyzed despite the slow workflow")
+	}
+}
+
+func TestFileTimeBudgetInput(t *testing.T) {
+	opts, err := parseScanOptions(map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.fileTimeBudget != defaultFileTimeBudgetMS*time.Millisecond {
+		t.Errorf("default budget = %v", opts.fileTimeBudget)
+	}
+	if opts, err = parseScanOptions(map[string]any{"file_time_budget_ms": "0"}); err != nil || opts.fileTimeBudget != 0 {
+		t.Errorf("file_time_budget_ms 0 = %v, %v; want disabled", opts.fileTimeBudget, err)
+	}
+	if _, err := parseScanOptions(map[string]any{"file_time_budget_ms": float64(-1)}); err == nil {
+		t.Error("expected an error for a negative file_time_budget_ms")
+	}
+}
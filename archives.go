@@ -0,0 +1,427 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// subjectDigestMismatchRuleID flags an attestation subject whose sha256
+// digest does not match the artifact it names.
+const subjectDigestMismatchRuleID = "PROV-016"
+
+// Hard caps on archive inspection, guarding against decompression bombs.
+// Entries are streamed and never written to disk.
+const (
+	// maxArchiveEntries is the most entries read from one archive.
+	maxArchiveEntries = 10000
+	// maxArchiveBytes is the most decompressed bytes read from one archive.
+	maxArchiveBytes = 512 << 20
+	// maxArchiveProvenanceSize is the largest embedded provenance entry that
+	// is validated.
+	maxArchiveProvenanceSize = defaultMaxFileSize
+)
+
+// errArchiveLimit is returned when an archive exceeds an inspection cap.
+var errArchiveLimit = errors.New("archive exceeds inspection limits")
+
+// archiveExtensions are the file extensions of the archives inspected.
+var archiveExtensions = []string{".tar", ".tar.gz", ".tgz", ".zip"}
+
+// isArchiveName reports whether a file is a tar, gzipped tar, or zip archive.
+func isArchiveName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveRecord is an inspected archive and the sha256 digests of its
+// regular entries, keyed by cleaned entry path.
+type archiveRecord struct {
+	path    string
+	entries map[string]string
+}
+
+// subjectRecord is an attestation subject with a sha256 digest, kept for
+// checking against the artifact it names.
+type subjectRecord struct {
+	location string
+	line     int
+	// index is the statement's position, or -1 when its document holds a
+	// single statement.
+	index   int
+	name    string
+	sha256  string
+	builder string
+	// archive is the archive the attestation was embedded in, if any.
+	archive string
+	// paired is set once the subject was checked against the artifact its
+	// attestation is named for.
+	paired bool
+}
+
+// recordSubjects keeps a statement's sha256 subjects for artifact digest
+// verification.
+func (s *scanSummary) recordSubjects(location string, ps *parsedStatement, single bool) {
+	index := ps.Index
+	if single {
+		index = -1
+	}
+	for _, subj := range ps.Statement.Subject {
+		digest := strings.ToLower(subj.Digest["sha256"])
+		if subj.Name == "" || digest == "" {
+			continue
+		}
+		s.subjectRecords = append(s.subjectRecords, subjectRecord{
+			location: location,
+			line:     ps.Line,
+			index:    index,
+			name:     subj.Name,
+			sha256:   digest,
+			builder:  ps.Predicate.builderID(),
+		})
+	}
+}
+
+// archiveEntryReader reads one archive entry at a time. next returns
+// io.EOF after the last entry.
+type archiveEntryReader interface {
+	next() (name string, body io.Reader, err error)
+	close() error
+}
+
+// scanArchive streams the entries of an archive, validates embedded
+// provenance entries, and records the digest of every regular entry. Docker
+// save tarballs and OCI image layouts are also checked for attestation
+// manifests.
+// Archives that cannot be opened are counted as unreadable; those that hit
+// an inspection cap keep what was read before it.
+func scanArchive(ctx context.Context, findings *findingSet, archivePath string, policy provenancePolicy, provenanceFiles *provenanceMatcher, summary *scanSummary) error {
+	r, err := openArchive(findings.files(), archivePath)
+	if err != nil {
+		summary.filesUnreadable++
+		return nil
+	}
+	defer func() { _ = r.close() }()
+
+	summary.archivesScanned++
+	record := archiveRecord{path: archivePath, entries: make(map[string]string)}
+	budget := int64(maxArchiveBytes)
+	firstSubject := len(summary.subjectRecords)
+	// image holds the small JSON entries of a docker save or OCI image
+	// layout, retained until the archive has been read.
+	image := &imageArchive{path: archivePath, blobs: make(map[string][]byte)}
+
+	err = func() error {
+		for count := 0; ; count++ {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			name, body, err := r.next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if body == nil {
+				continue
+			}
+			if count >= maxArchiveEntries {
+				return errArchiveLimit
+			}
+
+			name = path.Clean(strings.TrimPrefix(slashName(name), "./"))
+			limited := &io.LimitedReader{R: body, N: budget + 1}
+			hash := sha256.New()
+			var data []byte
+			provenance := provenanceFiles.match(name)
+			switch {
+			case provenance:
+				data, err = io.ReadAll(io.TeeReader(io.LimitReader(limited, maxArchiveProvenanceSize+1), hash))
+			case isImageLayoutEntry(name):
+				data, err = io.ReadAll(io.TeeReader(io.LimitReader(limited, maxImageBlobSize+1), hash))
+			}
+			if err == nil {
+				_, err = io.Copy(hash, limited)
+			}
+			budget = limited.N - 1
+			if budget < 0 {
+				return errArchiveLimit
+			}
+			if err != nil {
+				return err
+			}
+			record.entries[name] = hex.EncodeToString(hash.Sum(nil))
+
+			if !provenance {
+				image.retain(name, data)
+				continue
+			}
+			if len(data) == 0 || len(data) > maxArchiveProvenanceSize || !looksLikeAttestation(data) {
+				continue
+			}
+			summary.archiveAttestations++
+			summary.attestationFiles++
+			if err := checkProvenance(ctx, findings, archivePath+"!/"+name, data, policy, summary); err != nil {
+				return err
+			}
+		}
+	}()
+	// An image read only in part could misreport which images carry
+	// attestations.
+	if err == nil && image.isImageLayout() {
+		err = scanImageArchive(ctx, findings, image, policy, summary)
+	}
+
+	for i := firstSubject; i < len(summary.subjectRecords); i++ {
+		summary.subjectRecords[i].archive = archivePath
+	}
+	summary.archives = append(summary.archives, record)
+
+	switch {
+	case errors.Is(err, errArchiveLimit):
+		summary.archivesTruncated++
+		return nil
+	case err != nil && ctx.Err() == nil:
+		// A corrupt archive keeps the entries read before the damage.
+		summary.filesUnreadable++
+		return nil
+	}
+	return err
+}
+
+// openArchive opens a tar, gzipped tar, or zip archive for streaming.
+func openArchive(fsys workspaceFS, archivePath string) (archiveEntryReader, error) {
+	f, err := fsys.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	lower := strings.ToLower(archivePath)
+	if strings.HasSuffix(lower, ".zip") {
+		zr, err := openZip(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return &zipEntries{f: f, r: zr}, nil
+	}
+
+	var src io.Reader = f
+	if !strings.HasSuffix(lower, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		src = gz
+	}
+	return &tarEntries{f: f, r: tar.NewReader(src)}, nil
+}
+
+// openZip reads the central directory of an open zip archive.
+func openZip(f fs.File) (*zip.Reader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		return nil, errors.New("zip archive does not support random access")
+	}
+	return zip.NewReader(ra, info.Size())
+}
+
+// tarEntries streams the regular files of a tar archive.
+type tarEntries struct {
+	f fs.File
+	r *tar.Reader
+}
+
+func (t *tarEntries) next() (string, io.Reader, error) {
+	hdr, err := t.r.Next()
+	if err != nil {
+		return "", nil, err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return hdr.Name, nil, nil
+	}
+	return hdr.Name, t.r, nil
+}
+
+func (t *tarEntries) close() error { return t.f.Close() }
+
+// zipEntries streams the regular files of a zip archive.
+type zipEntries struct {
+	f    fs.File
+	r    *zip.Reader
+	i    int
+	open io.ReadCloser
+}
+
+func (z *zipEntries) next() (string, io.Reader, error) {
+	if z.open != nil {
+		_ = z.open.Close()
+		z.open = nil
+	}
+	if z.i >= len(z.r.File) {
+		return "", nil, io.EOF
+	}
+	f := z.r.File[z.i]
+	z.i++
+	if !f.Mode().IsRegular() {
+		return f.Name, nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", nil, err
+	}
+	z.open = rc
+	return f.Name, rc, nil
+}
+
+func (z *zipEntries) close() error {
+	if z.open != nil {
+		_ = z.open.Close()
+	}
+	return z.f.Close()
+}
+
+// mergeArchives folds the archives, subjects, and attestation files recorded
+// in other into s.
+func (s *scanSummary) mergeArchives(other *scanSummary) {
+	s.archives = append(s.archives, other.archives...)
+	s.subjectRecords = append(s.subjectRecords, other.subjectRecords...)
+	s.attestationPaths = append(s.attestationPaths, other.attestationPaths...)
+	s.archivesScanned += other.archivesScanned
+	s.archivesTruncated += other.archivesTruncated
+	s.archiveAttestations += other.archiveAttestations
+	s.archiveImages += other.archiveImages
+}
+
+// verifyArchiveSubjects checks attestation subjects against the artifacts
+// they name. Subjects of attestations embedded in an archive are looked up
+// among the archive's entries and then beside the archive; subjects of
+// attestations stored next to an archive are looked up in that directory.
+// Artifacts are matched by base name, and sibling files are hashed only if
+// they are regular files no larger than maxFileSize. Subjects whose artifact
+// is not found are not reported, and those already checked against the
+// artifact their attestation is named for are skipped.
+func verifyArchiveSubjects(ctx context.Context, findings *findingSet, summary *scanSummary, maxFileSize int64) error {
+	archives := make(map[string]archiveRecord, len(summary.archives))
+	archiveDirs := make(map[string]bool)
+	for _, a := range summary.archives {
+		archives[a.path] = a
+		archiveDirs[filepath.Dir(a.path)] = true
+	}
+	siblingDigests := make(map[string]string)
+
+	for _, subj := range summary.subjectRecords {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if subj.paired {
+			continue
+		}
+		base := path.Base(slashName(subj.name))
+		dir := filepath.Dir(subj.location)
+		var artifact, digest string
+		if a, ok := archives[subj.archive]; ok {
+			dir = filepath.Dir(a.path)
+			artifact, digest = archiveEntryDigest(a, subj.name, base)
+		}
+		if artifact == "" && archiveDirs[dir] {
+			candidate := filepath.Join(dir, base)
+			if candidate == subj.archive {
+				continue
+			}
+			d, ok := siblingDigests[candidate]
+			if !ok {
+				d = fileDigest(findings.files(), candidate, maxFileSize)
+				siblingDigests[candidate] = d
+			}
+			if d != "" {
+				artifact, digest = candidate, d
+			}
+		}
+		if artifact == "" {
+			continue
+		}
+		if digest == subj.sha256 {
+			summary.subjectsVerified++
+			continue
+		}
+
+		fb := findings.Finding(
+			subjectDigestMismatchRuleID,
+			sdk.SeverityHigh,
+			sdk.ConfidenceHigh,
+			fmt.Sprintf("Attestation subject %s does not match the sha256 digest of its artifact", subj.name),
+		).
+			At(subj.location, subj.line, subj.line).
+			WithMetadata("type", "subject_digest_mismatch").
+			WithMetadata("subject", subj.name).
+			WithMetadata("subject_digest", "sha256:"+subj.sha256).
+			WithMetadata("artifact", workspacePath(findings.root, artifact)).
+			WithMetadata("artifact_digest", "sha256:"+digest)
+		if subj.index >= 0 {
+			fb.WithMetadata("statement_index", strconv.Itoa(subj.index))
+		}
+		if subj.builder != "" {
+			fb.WithMetadata("builder_id", subj.builder)
+		}
+		fb.Done()
+	}
+	return nil
+}
+
+// archiveEntryDigest finds the entry a subject names inside an archive, by
+// path and then by base name, and returns its display path and digest.
+func archiveEntryDigest(a archiveRecord, name, base string) (string, string) {
+	clean := path.Clean(strings.TrimPrefix(slashName(name), "./"))
+	if digest, ok := a.entries[clean]; ok {
+		return a.path + "!/" + clean, digest
+	}
+	for _, entry := range sortedKeys(a.entries) {
+		if path.Base(entry) == base {
+			return a.path + "!/" + entry, a.entries[entry]
+		}
+	}
+	return "", ""
+}
+
+// fileDigest returns the hex sha256 digest of a regular file no larger than
+// limit, or "" if it cannot be hashed.
+func fileDigest(fsys workspaceFS, filePath string, limit int64) string {
+	info, err := fsys.Stat(filePath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > limit {
+		return ""
+	}
+	f, err := fsys.Open(filePath)
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = f.Close() }()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
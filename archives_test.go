@@ -0,0 +1,184 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// archiveEntry is a file to write into a test archive.
+type archiveEntry struct {
+	name    string
+	content string
+}
+
+// writeTar writes a tar archive holding entries, gzipped unless path ends
+// in .tar.
+func writeTar(t *testing.T, path string, entries ...archiveEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	gz := gzip.NewWriter(&buf)
+	if !strings.HasSuffix(path, ".tar") {
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w == gz {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, path, buf.String())
+}
+
+// writeZip writes a zip archive holding entries.
+func writeZip(t *testing.T, path string, entries ...archiveEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, buf.String())
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// subjectStatement builds a statement attesting the given name/digest pairs.
+func subjectStatement(subjects ...string) string {
+	list := ""
+	for i := 0; i+1 < len(subjects); i += 2 {
+		if list != "" {
+			list += ","
+		}
+		list += `{"name":"` + subjects[i] + `","digest":{"sha256":"` + subjects[i+1] + `"}}`
+	}
+	return levelStatement("https://github.com/actions/runner", "https://github.com/actions/workflow", "["+list+"]", `[]`)
+}
+
+func TestScanArchivesVerifiesSubjectDigests(t *testing.T) {
+	const wrong = "0000000000000000000000000000000000000000000000000000000000000000"
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n")
+
+	binary := "\x7fELF app binary"
+	writeTar(t, filepath.Join(workspace, "dist", "app.tar.gz"),
+		archiveEntry{"./app", binary},
+		archiveEntry{"./README.md", "app"},
+		archiveEntry{"./app.intoto.jsonl", subjectStatement("app", sha256Hex([]byte(binary)), "README.md", wrong) + "\n"},
+	)
+	writeZip(t, filepath.Join(workspace, "dist", "app.zip"), archiveEntry{"app.exe", "MZ"})
+	tarball, err := os.ReadFile(filepath.Join(workspace, "dist", "app.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(workspace, "dist", "release.intoto.jsonl"),
+		subjectStatement("dist/app.tar.gz", sha256Hex(tarball), "app.zip", wrong, "missing.tar.gz", wrong)+"\n")
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{"workspace_root": workspace, "scan_archives": true})
+
+	if found := findByRule(resp.GetFindings(), "PROV-001"); len(found) != 0 {
+		t.Errorf("expected embedded provenance to count as an attestation, got %d PROV-001 findings", len(found))
+	}
+	mismatches := make(map[string]string)
+	for _, f := range findByRule(resp.GetFindings(), subjectDigestMismatchRuleID) {
+		mismatches[f.GetMetadata()["artifact"]] = f.GetLocation().GetFilePath()
+	}
+	want := map[string]string{
+		"dist/app.tar.gz!/README.md": "dist/app.tar.gz!/app.intoto.jsonl",
+		"dist/app.zip":               "dist/release.intoto.jsonl",
+	}
+	if len(mismatches) != len(want) {
+		t.Fatalf("expected %s findings for %v, got %v", subjectDigestMismatchRuleID, want, mismatches)
+	}
+	for artifact, location := range want {
+		if mismatches[artifact] != location {
+			t.Errorf("expected a %s finding at %s for %s, got %v", subjectDigestMismatchRuleID, location, artifact, mismatches)
+		}
+	}
+
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	for key, value := range map[string]string{"archives_scanned": "2", "archive_attestations": "1", "subjects_verified": "2"} {
+		if meta[key] != value {
+			t.Errorf("%s = %q, want %q", key, meta[key], value)
+		}
+	}
+}
+
+func TestScanArchivesDisabledByDefault(t *testing.T) {
+	workspace := t.TempDir()
+	writeTar(t, filepath.Join(workspace, "dist", "app.tar.gz"),
+		archiveEntry{"app.intoto.jsonl", subjectStatement("app", "abc") + "\n"})
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["archives_scanned"] != "0" || meta["statements_parsed"] != "0" {
+		t.Errorf("expected archives to be skipped by default, got archives_scanned=%q statements_parsed=%q",
+			meta["archives_scanned"], meta["statements_parsed"])
+	}
+}
+
+func TestScanArchivesCapsEntries(t *testing.T) {
+	workspace := t.TempDir()
+	entries := make([]archiveEntry, maxArchiveEntries+1)
+	for i := range entries {
+		entries[i] = archiveEntry{name: "f" + strconv.Itoa(i)}
+	}
+	entries[len(entries)-1] = archiveEntry{"app.intoto.jsonl", subjectStatement("app", "abc") + "\n"}
+	writeTar(t, filepath.Join(workspace, "bomb.tar.gz"), entries...)
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{"workspace_root": workspace, "scan_archives": true})
+
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["archives_truncated"] != "1" || meta["archive_attestations"] != "0" {
+		t.Errorf("expected the archive to be truncated before its last entry, got archives_truncated=%q archive_attestations=%q",
+			meta["archives_truncated"], meta["archive_attestations"])
+	}
+}
+
+func TestScanArchivesCorrupt(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "broken.tar.gz"), "not gzip")
+	writeFile(t, filepath.Join(workspace, "broken.zip"), "not zip")
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{"workspace_root": workspace, "scan_archives": true})
+
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["unreadable_files"] != "2" || meta["archives_scanned"] != "0" {
+		t.Errorf("expected corrupt archives to be counted as unreadable, got unreadable_files=%q archives_scanned=%q",
+			meta["unreadable_files"], meta["archives_scanned"])
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// vendoredBinaryRuleID flags pre-compiled binaries committed to the
+// workspace that the build references or ships: opaque inputs with no
+// provenance of their own.
+const vendoredBinaryRuleID = "PROV-061"
+
+// maxBinaryFindingsPerDir is the most used binaries of one directory
+// reported one by one; a directory with more is reported once.
+const maxBinaryFindingsPerDir = 5
+
+// Formats of the binaries recognized by their magic bytes.
+const (
+	binaryELF           = "elf"
+	binaryPE            = "pe"
+	binaryMachO         = "mach-o"
+	binaryJavaClass     = "java_class"
+	binaryJar           = "jar"
+	binaryStaticLibrary = "static_library"
+	binaryWasm          = "wasm"
+)
+
+// How a vendored binary is used.
+const (
+	binaryReferenced = "referenced"
+	binaryShipped    = "shipped_path"
+)
+
+var (
+	// binaryExtensions are the names of compiled files sniffed wherever
+	// they are.
+	binaryExtensions = map[string]bool{
+		".jar": true, ".war": true, ".ear": true, ".aar": true, ".class": true,
+		".so": true, ".dylib": true, ".dll": true, ".exe": true, ".a": true,
+		".lib": true, ".node": true, ".wasm": true, ".bin": true,
+	}
+	// binaryDirs are the directories every file of which is sniffed, as
+	// executables there rarely carry an extension.
+	binaryDirs = map[string]bool{"bin": true, "tools": true}
+	// shippedBinaryDirs are the directories whose binaries builds
+	// conventionally package or link.
+	shippedBinaryDirs = map[string]bool{"bin": true, "lib": true, "libs": true, "dist": true, "jniLibs": true, "native": true}
+	// jarExtensions are the zip archives that are Java binaries.
+	jarExtensions = map[string]bool{".jar": true, ".war": true, ".ear": true, ".aar": true}
+)
+
+// vendoredBinary is a committed file recognized as compiled code.
+type vendoredBinary struct {
+	path   string
+	rel    string
+	size   int64
+	format string
+}
+
+// isBinaryCandidate reports whether a workspace-relative slash path names
+// a file worth sniffing: one with a compiled extension, a versioned shared
+// library, or any file under a bin or tools directory. Build wrapper jars
+// have their own check.
+func isBinaryCandidate(rel string) bool {
+	for _, w := range buildWrappers {
+		if hasWrapperFile(rel, w.jar) {
+			return false
+		}
+	}
+	name := strings.ToLower(path.Base(rel))
+	if binaryExtensions[path.Ext(name)] || strings.Contains(name, ".so.") {
+		return true
+	}
+	dirs := strings.Split(path.Dir(rel), "/")
+	for _, d := range dirs {
+		if binaryDirs[d] {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffBinary returns the format of compiled code the first bytes of a
+// file announce, or "" for anything else. Zip archives count only under a
+// jar extension, and 0xCAFEBABE is a Java class unless the count that
+// follows is small enough for a Mach-O universal binary.
+func sniffBinary(head []byte, name string) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\x7fELF")):
+		return binaryELF
+	case bytes.HasPrefix(head, []byte("MZ")):
+		return binaryPE
+	case bytes.HasPrefix(head, []byte{0xfe, 0xed, 0xfa, 0xce}), bytes.HasPrefix(head, []byte{0xfe, 0xed, 0xfa, 0xcf}),
+		bytes.HasPrefix(head, []byte{0xce, 0xfa, 0xed, 0xfe}), bytes.HasPrefix(head, []byte{0xcf, 0xfa, 0xed, 0xfe}):
+		return binaryMachO
+	case bytes.HasPrefix(head, []byte{0xca, 0xfe, 0xba, 0xbe}):
+		if len(head) >= 8 && binary.BigEndian.Uint32(head[4:8]) < 45 {
+			return binaryMachO
+		}
+		return binaryJavaClass
+	case bytes.HasPrefix(head, []byte("!<arch>\n")):
+		return binaryStaticLibrary
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")) && jarExtensions[strings.ToLower(path.Ext(name))]:
+		return binaryJar
+	case bytes.HasPrefix(head, []byte("\x00asm")):
+		return binaryWasm
+	}
+	return ""
+}
+
+// binaryAnalyzer sniffs candidate files for compiled code, recording the
+// binaries found for the usage check once the walk is over.
+type binaryAnalyzer struct{}
+
+func (binaryAnalyzer) kinds() fileKind { return kindBinary }
+
+func (binaryAnalyzer) name() string { return "binary" }
+
+func (binaryAnalyzer) matches(rel, _ string, _ *provenanceMatcher) fileKind {
+	if isBinaryCandidate(rel) {
+		return kindBinary
+	}
+	return 0
+}
+
+func (binaryAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rel := workspacePath(r.findings.root, job.path)
+	if globAllowed(r.policy.binaryAllowlist, rel) {
+		return nil
+	}
+	f, err := r.findings.files().Open(job.path)
+	if err != nil {
+		r.summary.filesUnreadable++
+		return nil
+	}
+	defer f.Close()
+	head := make([]byte, 8)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		r.summary.filesUnreadable++
+		return nil
+	}
+	if format := sniffBinary(head[:n], rel); format != "" {
+		r.summary.vendoredBinaries = append(r.summary.vendoredBinaries, vendoredBinary{path: job.path, rel: rel, size: job.size, format: format})
+	}
+	return nil
+}
+
+// mentionsFile reports whether text names a file by name or path, not as
+// part of a longer name.
+func mentionsFile(text, name string) bool {
+	isNameByte := func(c byte) bool {
+		return c == '_' || c == '-' || c == '.' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+	}
+	for off := 0; ; {
+		i := strings.Index(text[off:], name)
+		if i < 0 {
+			return false
+		}
+		start, end := off+i, off+i+len(name)
+		if (start == 0 || !isNameByte(text[start-1])) && (end == len(text) || !isNameByte(text[end])) {
+			return true
+		}
+		off = start + 1
+	}
+}
+
+// usedBinary is a vendored binary the build references or ships.
+type usedBinary struct {
+	vendoredBinary
+	usage        []string
+	referencedBy []string
+}
+
+// checkVendoredBinaries flags the recorded binaries that the build and CI
+// configs name, by path or base name, or that sit in a directory builds
+// conventionally ship. A directory with more than maxBinaryFindingsPerDir
+// of them is reported once, listing them all.
+func checkVendoredBinaries(_ context.Context, ws *workspaceScan) error {
+	if len(ws.summary.vendoredBinaries) == 0 {
+		return nil
+	}
+	configs := make([]string, 0, len(ws.configPaths))
+	for p := range ws.configPaths {
+		configs = append(configs, p)
+	}
+	sort.Strings(configs)
+	texts := make(map[string]string, len(configs))
+	for _, p := range configs {
+		if info, err := ws.findings.files().Stat(p); err != nil || info.Size() > ws.opts.maxFileSize {
+			continue
+		}
+		if data, err := ws.findings.files().ReadFile(p); err == nil {
+			texts[p] = string(data)
+		}
+	}
+
+	binaries := append([]vendoredBinary(nil), ws.summary.vendoredBinaries...)
+	sort.Slice(binaries, func(i, j int) bool { return binaries[i].rel < binaries[j].rel })
+	byDir := make(map[string][]usedBinary)
+	var dirs []string
+	for _, b := range binaries {
+		u := usedBinary{vendoredBinary: b}
+		for _, p := range configs {
+			if text, ok := texts[p]; ok && (mentionsFile(text, b.rel) || mentionsFile(text, path.Base(b.rel))) {
+				u.referencedBy = append(u.referencedBy, workspacePath(ws.root, p))
+			}
+		}
+		if len(u.referencedBy) > 0 {
+			u.usage = append(u.usage, binaryReferenced)
+		}
+		for _, d := range strings.Split(path.Dir(b.rel), "/") {
+			if shippedBinaryDirs[d] {
+				u.usage = append(u.usage, binaryShipped)
+				break
+			}
+		}
+		if len(u.usage) == 0 {
+			continue
+		}
+		dir := path.Dir(b.rel)
+		if byDir[dir] == nil {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], u)
+	}
+
+	for _, dir := range dirs {
+		used := byDir[dir]
+		if len(used) > maxBinaryFindingsPerDir {
+			reportVendoredBinaryDir(ws.findings, dir, used)
+			continue
+		}
+		for _, u := range used {
+			reportVendoredBinary(ws.findings, u)
+		}
+	}
+	return nil
+}
+
+// reportVendoredBinary flags one used vendored binary. Confidence is High
+// when a config names it and Medium when only its directory suggests it is
+// shipped.
+func reportVendoredBinary(findings *findingSet, u usedBinary) {
+	confidence := sdk.ConfidenceMedium
+	if len(u.referencedBy) > 0 {
+		confidence = sdk.ConfidenceHigh
+	}
+	fb := findings.Finding(vendoredBinaryRuleID, sdk.SeverityMedium, confidence,
+		fmt.Sprintf("Pre-compiled %s binary %s is used by the build but has no provenance", u.format, u.rel)).
+		At(u.path, 0, 0).
+		WithMetadata("type", "vendored_binary").
+		WithMetadata("binary", u.rel).
+		WithMetadata("format", u.format).
+		WithMetadata("size", strconv.FormatInt(u.size, 10)).
+		WithMetadata("usage", strings.Join(u.usage, ","))
+	if len(u.referencedBy) > 0 {
+		fb.WithMetadata("referenced_by", strings.Join(u.referencedBy, ","))
+	}
+	fb.Done()
+}
+
+// reportVendoredBinaryDir flags a directory of used vendored binaries once,
+// at its first binary, listing each with its size.
+func reportVendoredBinaryDir(findings *findingSet, dir string, used []usedBinary) {
+	listed := make([]string, len(used))
+	var total int64
+	confidence := sdk.ConfidenceMedium
+	for i, u := range used {
+		listed[i] = u.rel + ":" + strconv.FormatInt(u.size, 10)
+		total += u.size
+		if len(u.referencedBy) > 0 {
+			confidence = sdk.ConfidenceHigh
+		}
+	}
+	findings.Finding(vendoredBinaryRuleID, sdk.SeverityMedium, confidence,
+		fmt.Sprintf("Directory %s holds %d pre-compiled binaries used by the build without provenance", dir, len(used))).
+		At(used[0].path, 0, 0).
+		WithMetadata("type", "vendored_binaries").
+		WithMetadata("directory", dir).
+		WithMetadata("count", strconv.Itoa(len(used))).
+		WithMetadata("total_size", strconv.FormatInt(total, 10)).
+		WithMetadata("binaries", strings.Join(listed, ",")).
+		Done()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testELF returns the start of a 64-bit little-endian ELF executable,
+// padded to size bytes.
+func testELF(size int) string {
+	header := "\x7fELF\x02\x01\x01\x00"
+	return header + strings.Repeat("\x00", size-len(header))
+}
+
+// testJar returns a jar holding one class file.
+func testJar(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("com/example/Lib.class")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte{0xca, 0xfe, 0xba, 0xbe, 0x00, 0x00, 0x00, 0x41}); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestSniffBinary(t *testing.T) {
+	for _, tt := range []struct {
+		head, name, want string
+	}{
+		{head: "\x7fELF\x02\x01", name: "protoc", want: binaryELF},
+		{head: "MZ\x90\x00", name: "tool.exe", want: binaryPE},
+		{head: "\xcf\xfa\xed\xfe", name: "libfoo.dylib", want: binaryMachO},
+		{head: "\xca\xfe\xba\xbe\x00\x00\x00\x02", name: "fat", want: binaryMachO},
+		{head: "\xca\xfe\xba\xbe\x00\x00\x00\x41", name: "Lib.class", want: binaryJavaClass},
+		{head: "!<arch>\n", name: "libfoo.a", want: binaryStaticLibrary},
+		{head: "PK\x03\x04", name: "lib.JAR", want: binaryJar},
+		{head: "PK\x03\x04", name: "docs.zip"},
+		{head: "\x00asm\x01", name: "mod.wasm", want: binaryWasm},
+		{head: "#!/bin/sh\n", name: "run"},
+		{head: "", name: "empty.so"},
+	} {
+		if got := sniffBinary([]byte(tt.head), tt.name); got != tt.want {
+			t.Errorf("sniffBinary(%q, %q) = %q, want %q", tt.head, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScanVendoredBinaries(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), "gen:\n\t./tools/protoc --go_out=. api.proto\n")
+	writeFile(t, filepath.Join(workspace, "tools", "protoc"), testELF(64))
+	writeFile(t, filepath.Join(workspace, "tools", "protoc-gen-go"), testELF(64))
+	writeFile(t, filepath.Join(workspace, "tools", "lint.sh"), "#!/bin/sh\n")
+	writeFile(t, filepath.Join(workspace, "libs", "vendor-lib.jar"), testJar(t))
+	writeFile(t, filepath.Join(workspace, "libs", "fake.jar"), "not a jar")
+	writeFile(t, filepath.Join(workspace, "gradle", "wrapper", "gradle-wrapper.jar"), testJar(t))
+
+	found := findByRule(invokeScan(t, testClient(t), workspace).GetFindings(), vendoredBinaryRuleID)
+	got := make(map[string]map[string]string)
+	for _, f := range found {
+		meta := f.GetMetadata()
+		got[meta["binary"]] = meta
+	}
+	if len(found) != 2 || len(got) != 2 {
+		t.Fatalf("expected findings for tools/protoc and libs/vendor-lib.jar, got %v", got)
+	}
+	if meta := got["tools/protoc"]; meta["format"] != binaryELF || meta["usage"] != binaryReferenced || meta["referenced_by"] != "Makefile" || meta["size"] != "64" {
+		t.Errorf("unexpected metadata for tools/protoc: %v", meta)
+	}
+	if meta := got["libs/vendor-lib.jar"]; meta["format"] != binaryJar || meta["usage"] != binaryShipped {
+		t.Errorf("unexpected metadata for libs/vendor-lib.jar: %v", meta)
+	}
+}
+
+func TestScanVendoredBinaryDirectory(t *testing.T) {
+	workspace := t.TempDir()
+	for i := 0; i <= maxBinaryFindingsPerDir; i++ {
+		writeFile(t, filepath.Join(workspace, "lib", fmt.Sprintf("libdep%d.so", i)), testELF(32))
+	}
+
+	found := findByRule(invokeScan(t, testClient(t), workspace).GetFindings(), vendoredBinaryRuleID)
+	if len(found) != 1 {
+		t.Fatalf("expected one finding for the directory, got %d", len(found))
+	}
+	meta := found[0].GetMetadata()
+	if meta["type"] != "vendored_binaries" || meta["directory"] != "lib" || meta["count"] != fmt.Sprint(maxBinaryFindingsPerDir+1) {
+		t.Errorf("unexpected metadata %v", meta)
+	}
+	if !strings.Contains(meta["binaries"], "lib/libdep0.so:32") || meta["total_size"] != fmt.Sprint(32*(maxBinaryFindingsPerDir+1)) {
+		t.Errorf("binaries %q, total size %q", meta["binaries"], meta["total_size"])
+	}
+}
+
+func TestScanVendoredBinaryPolicy(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "bin", "helper"), testELF(2048))
+	writeFile(t, filepath.Join(workspace, "lib", "approved.so"), testELF(64))
+
+	// The helper exceeds max_file_size but is still sniffed.
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root":            workspace,
+		"max_file_size":             1024,
+		"vendored_binary_allowlist": "lib/approved.*",
+	})
+	found := findByRule(resp.GetFindings(), vendoredBinaryRuleID)
+	if len(found) != 1 || found[0].GetMetadata()["binary"] != "bin/helper" {
+		t.Fatalf("expected one finding for bin/helper, got %v", found)
+	}
+}
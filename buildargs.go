@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// secretBuildArgRuleID flags secrets passed to image builds as build
+// arguments, which end up in the image history and in the
+// externalParameters of BuildKit provenance, unlike secret mounts.
+const secretBuildArgRuleID = "PROV-050"
+
+// Why a build argument looks like it carries a secret.
+const (
+	buildArgSecretsContext = "secrets_context"
+	buildArgSecretVariable = "secret_variable"
+	buildArgSecretName     = "secret_name"
+)
+
+// secretBuildArgRemediation is the advice attached to build argument
+// findings.
+const secretBuildArgRemediation = "Pass the value as a BuildKit secret (--secret id=name,env=VAR or the build-push-action secrets input) and read it with RUN --mount=type=secret"
+
+var (
+	// imageBuildCommand matches commands building an image from a
+	// Dockerfile.
+	imageBuildCommand = regexp.MustCompile(`\b(?:docker|podman)\s+(?:buildx\s+|image\s+)?build\b|\bdocker\s+compose\s+build\b|\bbuildah\s+(?:bud|build)\b`)
+	// buildArgFlag matches a --build-arg flag and captures its operand,
+	// which may hold a ${{ }} expression with spaces.
+	buildArgFlag = regexp.MustCompile(`--build-arg(?:=|\s+)("[^"]*"|'[^']*'|(?:\$\{\{[^}]*\}\}|\S)+)`)
+	// dockerArg matches a Dockerfile ARG instruction and captures its
+	// declarations.
+	dockerArg = regexp.MustCompile(`^(?i)ARG\s+(.+)$`)
+	// secretsContext matches an expression reading a repository secret or
+	// the job's token.
+	secretsContext = regexp.MustCompile(`\$\{\{[^}]*\b(?:secrets\.|github\.token\b)`)
+	// valueVariable matches a variable a value reads: $NAME, ${NAME}, or
+	// ${{ env.NAME }}.
+	valueVariable = regexp.MustCompile(`\$\{\{\s*env\.([A-Za-z_][A-Za-z0-9_]*)|\$\{?([A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+var (
+	// secretNameWords are name words that mark a secret on their own.
+	secretNameWords = map[string]bool{
+		"TOKEN": true, "SECRET": true, "PASSWORD": true, "PASSWD": true, "PASSPHRASE": true,
+		"APIKEY": true, "CREDENTIAL": true, "CREDENTIALS": true, "CREDS": true, "KEY": true,
+	}
+	// secretNameSuffixes are run-together words ending in a secret word,
+	// such as NPMTOKEN or DBPASSWORD.
+	secretNameSuffixes = []string{"TOKEN", "SECRET", "PASSWORD", "PASSWD", "APIKEY"}
+	// nonSecretNextWords follow a secret word in names of values that are
+	// not secret themselves, such as TOKEN_URL, KEY_ID, or SECRET_FILE.
+	nonSecretNextWords = map[string]bool{
+		"ID": true, "IDS": true, "NAME": true, "URL": true, "URI": true, "FILE": true, "PATH": true,
+		"DIR": true, "TYPE": true, "FINGERPRINT": true, "SERVER": true, "ENDPOINT": true, "LENGTH": true,
+	}
+	// nonSecretWords mark names of values that are not secret, such as
+	// PUBLIC_KEY or CACHE_KEY.
+	nonSecretWords = map[string]bool{"PUBLIC": true, "PUB": true, "CACHE": true, "SORT": true, "PRIMARY": true, "FOREIGN": true}
+)
+
+// nameWords splits a variable name into upper-case words at underscores,
+// hyphens, dots, and lower-to-upper case changes, so npmToken and
+// NPM_TOKEN both give NPM and TOKEN.
+func nameWords(name string) []string {
+	var words []string
+	var word []rune
+	var prev rune
+	for _, r := range name {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			r = 0
+		case unicode.IsUpper(r) && unicode.IsLower(prev) && len(word) > 0:
+			words = append(words, string(word))
+			word = nil
+		}
+		if r == 0 {
+			if len(word) > 0 {
+				words = append(words, string(word))
+			}
+			word, prev = nil, 0
+			continue
+		}
+		word = append(word, unicode.ToUpper(r))
+		prev = r
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// secretLookingName reports whether a variable name looks like it holds a
+// secret: it has a secret word, such as TOKEN or PASSWORD, that is not
+// qualified as naming something else, as in TOKEN_URL or PUBLIC_KEY.
+// VERSION, COMMIT_SHA, and other names without such a word are not.
+func secretLookingName(name string) bool {
+	words := nameWords(name)
+	for _, w := range words {
+		if nonSecretWords[w] {
+			return false
+		}
+	}
+	for i, w := range words {
+		secret := secretNameWords[w]
+		for _, suffix := range secretNameSuffixes {
+			secret = secret || strings.HasSuffix(w, suffix)
+		}
+		if !secret {
+			continue
+		}
+		if i+1 < len(words) && nonSecretNextWords[words[i+1]] {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// secretBuildArg returns why a build argument, NAME=value or a bare NAME
+// taken from the environment, looks like it carries a secret, and the
+// argument's name; reason is empty for arguments that do not.
+func secretBuildArg(arg string) (name, reason string) {
+	arg = strings.Trim(strings.TrimSpace(arg), `"'`)
+	name, value, _ := strings.Cut(arg, "=")
+	name = strings.TrimSpace(name)
+	switch {
+	case secretsContext.MatchString(value):
+		return name, buildArgSecretsContext
+	case secretLookingName(name):
+		return name, buildArgSecretName
+	}
+	for _, m := range valueVariable.FindAllStringSubmatch(value, -1) {
+		if secretLookingName(m[1] + m[2]) {
+			return name, buildArgSecretVariable
+		}
+	}
+	return name, ""
+}
+
+// buildArgConfidence is the confidence of a build argument finding: High
+// when the value reads a secret, Medium when only a name suggests one.
+func buildArgConfidence(reason string) pluginv1.Confidence {
+	if reason == buildArgSecretsContext {
+		return sdk.ConfidenceHigh
+	}
+	return sdk.ConfidenceMedium
+}
+
+// reportSecretBuildArgs flags the --build-arg flags of an image build
+// command that pass secrets.
+func reportSecretBuildArgs(findings *findingSet, filePath string, cmd logicalCommand, origin commandOrigin, action *actionTracker) {
+	if cmd.context != contextRunCommand && cmd.context != contextRecipe || !imageBuildCommand.MatchString(cmd.text) {
+		return
+	}
+	for _, m := range buildArgFlag.FindAllStringSubmatch(cmd.text, -1) {
+		name, reason := secretBuildArg(m[1])
+		if reason == "" {
+			continue
+		}
+		fb := newSecretBuildArgFinding(findings, filePath, cmd.line, name, reason, "command")
+		if cmd.section != "" {
+			fb.WithMetadata("section", cmd.section)
+		}
+		action.annotate(origin.annotate(fb)).Done()
+	}
+}
+
+// buildArgStep is a docker/build-push-action step of a workflow job, with
+// its build-args entries.
+type buildArgStep struct {
+	line int
+	args []string
+}
+
+// reportBuildArgs flags the build-args entries of build-push-action steps
+// that pass secrets.
+func (w *workflowTracker) reportBuildArgs(findings *findingSet, filePath string) {
+	for _, j := range w.jobs {
+		for _, s := range j.buildArgs {
+			for _, arg := range s.args {
+				if name, reason := secretBuildArg(arg); reason != "" {
+					newSecretBuildArgFinding(findings, filePath, s.line, name, reason, "build-push-action").
+						WithMetadata("job", j.name).
+						Done()
+				}
+			}
+		}
+	}
+}
+
+// newSecretBuildArgFinding starts a High finding for a build argument
+// passing a secret.
+func newSecretBuildArgFinding(findings *findingSet, filePath string, lineNum int, name, reason, source string) *findingBuilder {
+	return findings.Finding(
+		secretBuildArgRuleID,
+		sdk.SeverityHigh,
+		buildArgConfidence(reason),
+		fmt.Sprintf("Build argument %s passes a secret to the image build, recording it in the image history and build provenance", name),
+	).
+		At(filePath, lineNum, lineNum).
+		WithMetadata("type", "secret_build_arg").
+		WithMetadata("build_arg", name).
+		WithMetadata("reason", reason).
+		WithMetadata("source", source).
+		WithMetadata("remediation", secretBuildArgRemediation)
+}
+
+// reportSecretArgDeclarations flags the ARG declarations of a Dockerfile
+// line whose names look like they hold secrets, whether or not any build
+// passes them.
+func reportSecretArgDeclarations(findings *findingSet, filePath string, lineNum int, line string) {
+	m := dockerArg.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return
+	}
+	for _, decl := range strings.Fields(m[1]) {
+		name, _, _ := strings.Cut(decl, "=")
+		if !secretLookingName(name) {
+			continue
+		}
+		findings.Finding(
+			secretBuildArgRuleID,
+			sdk.SeverityLow,
+			sdk.ConfidenceMedium,
+			fmt.Sprintf("Dockerfile declares build argument %s, whose name suggests a secret; build arguments are recorded in the image history and build provenance", name),
+		).
+			At(filePath, lineNum, lineNum).
+			WithMetadata("type", "secret_build_arg_declared").
+			WithMetadata("build_arg", name).
+			WithMetadata("remediation", secretBuildArgRemediation).
+			Done()
+	}
+}
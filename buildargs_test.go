@@ -0,0 +1,99 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+func TestSecretLookingName(t *testing.T) {
+	secret := []string{"NPM_TOKEN", "GITHUB_TOKEN", "npmToken", "DB_PASSWORD", "DBPASSWORD", "API_KEY", "apiKey", "SSH_KEY", "AWS_SECRET_ACCESS_KEY", "REGISTRY_CREDENTIALS", "GPG_PASSPHRASE"}
+	for _, name := range secret {
+		if !secretLookingName(name) {
+			t.Errorf("secretLookingName(%q) = false, want true", name)
+		}
+	}
+	benign := []string{"VERSION", "COMMIT_SHA", "BUILD_DATE", "GO_VERSION", "TARGETPLATFORM", "TOKEN_URL", "GPG_KEY_ID", "PUBLIC_KEY", "CACHE_KEY", "SECRET_FILE", "MONKEY_PATCH", "KEYBOARD_LAYOUT", "PASSTHROUGH"}
+	for _, name := range benign {
+		if secretLookingName(name) {
+			t.Errorf("secretLookingName(%q) = true, want false", name)
+		}
+	}
+}
+
+func TestSecretBuildArg(t *testing.T) {
+	tests := []struct {
+		arg, name, reason string
+	}{
+		{"NPM_TOKEN=${{ secrets.NPM_TOKEN }}", "NPM_TOKEN", buildArgSecretsContext},
+		{"AUTH=${{ secrets.REGISTRY_AUTH }}", "AUTH", buildArgSecretsContext},
+		{`"GH=${{ github.token }}"`, "GH", buildArgSecretsContext},
+		{"NPM_TOKEN", "NPM_TOKEN", buildArgSecretName},
+		{"NPM_TOKEN=$NPM_TOKEN", "NPM_TOKEN", buildArgSecretName},
+		{"AUTH=${REGISTRY_PASSWORD}", "AUTH", buildArgSecretVariable},
+		{"AUTH=${{ env.DEPLOY_TOKEN }}", "AUTH", buildArgSecretVariable},
+		{"VERSION=${{ github.ref_name }}", "VERSION", ""},
+		{"COMMIT_SHA=$GITHUB_SHA", "COMMIT_SHA", ""},
+		{"TOKEN_URL=https://auth.example.com", "TOKEN_URL", ""},
+	}
+	for _, tt := range tests {
+		if name, reason := secretBuildArg(tt.arg); name != tt.name || reason != tt.reason {
+			t.Errorf("secretBuildArg(%q) = %q, %q, want %q, %q", tt.arg, name, reason, tt.name, tt.reason)
+		}
+	}
+}
+
+func TestScanSecretBuildArgs(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "image.yml"), strings.Join([]string{
+		"on: push",
+		"jobs:",
+		"  image:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - run: |",
+		"          docker build \\",
+		"            --build-arg VERSION=${{ github.ref_name }} \\",
+		"            --build-arg NPM_TOKEN=${{ secrets.NPM_TOKEN }} \\",
+		"            -t app .",
+		"      - uses: docker/build-push-action@v6",
+		"        with:",
+		"          push: true",
+		"          build-args: |",
+		"            COMMIT_SHA=${{ github.sha }}",
+		"            GH_TOKEN=${{ secrets.GITHUB_TOKEN }}",
+		"          secrets: |",
+		"            npm=${{ secrets.NPM_TOKEN }}",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), strings.Join([]string{
+		"FROM node:20",
+		"ARG VERSION",
+		"ARG NPM_TOKEN",
+		"RUN --mount=type=secret,id=npm npm ci",
+	}, "\n")+"\n")
+
+	found := findByRule(invokeScan(t, testClient(t), workspace).GetFindings(), secretBuildArgRuleID)
+	type key struct {
+		path string
+		line int32
+		arg  string
+	}
+	got := make(map[key]string)
+	for _, f := range found {
+		got[key{f.GetLocation().GetFilePath(), f.GetLocation().GetStartLine(), f.GetMetadata()["build_arg"]}] = f.GetMetadata()["type"]
+		if f.GetMetadata()["type"] == "secret_build_arg" && (f.GetSeverity() != sdk.SeverityHigh || f.GetConfidence() != sdk.ConfidenceHigh) {
+			t.Errorf("build arg %s: severity %v, confidence %v", f.GetMetadata()["build_arg"], f.GetSeverity(), f.GetConfidence())
+		}
+	}
+	want := map[key]string{
+		{".github/workflows/image.yml", 7, "NPM_TOKEN"}: "secret_build_arg",
+		{".github/workflows/image.yml", 11, "GH_TOKEN"}: "secret_build_arg",
+		{"Dockerfile", 3, "NPM_TOKEN"}:                  "secret_build_arg_declared",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findings = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// normalizeBuilderID reduces a builder ID to its scheme, host, and path, so
+// that builds by different releases of one builder are counted together. The
+// query, fragment, and an "@ref" suffix on the path are dropped. IDs that are
+// not absolute URLs are only trimmed.
+func normalizeBuilderID(id string) string {
+	id = strings.TrimSpace(id)
+	u, err := url.Parse(id)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return id
+	}
+	p := u.Path
+	if i := strings.Index(p, "@"); i >= 0 {
+		p = p[:i]
+	}
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host) + strings.TrimSuffix(p, "/")
+}
+
+// recordBuilder counts a statement under its normalized builder ID.
+// Statements without a builder ID are not counted.
+func (s *scanSummary) recordBuilder(ps *parsedStatement) {
+	id := ps.Predicate.builderID()
+	if id == "" {
+		return
+	}
+	if s.builders == nil {
+		s.builders = make(map[string]int)
+	}
+	s.builders[normalizeBuilderID(id)]++
+}
+
+// mergeBuilders folds the builder counts recorded in other into s.
+func (s *scanSummary) mergeBuilders(other *scanSummary) {
+	for id, n := range other.builders {
+		if s.builders == nil {
+			s.builders = make(map[string]int)
+		}
+		s.builders[id] += n
+	}
+}
+
+// observedBuilders renders the builder counts as sorted "id=count" pairs.
+func (s *scanSummary) observedBuilders() string {
+	pairs := make([]string, 0, len(s.builders))
+	for _, id := range sortedKeys(s.builders) {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", id, s.builders[id]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// untrustedBuilders lists the observed builders that match none of the
+// trusted prefixes, sorted.
+func (s *scanSummary) untrustedBuilders(trusted []string) []string {
+	var untrusted []string
+	for _, id := range sortedKeys(s.builders) {
+		if !builderTrusted(id, trusted) {
+			untrusted = append(untrusted, id)
+		}
+	}
+	return untrusted
+}
+
+// builderTrusted reports whether a normalized builder ID equals one of the
+// trusted prefixes or lies below one of them in the path hierarchy.
+func builderTrusted(id string, trusted []string) bool {
+	for _, prefix := range trusted {
+		if id == prefix || strings.HasPrefix(id, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
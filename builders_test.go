@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeBuilderID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"https://github.com/actions/runner", "https://github.com/actions/runner"},
+		{"https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@refs/tags/v1.9.0",
+			"https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml"},
+		{"HTTPS://CloudBuild.GoogleAPIs.com/GoogleHostedWorker/", "https://cloudbuild.googleapis.com/GoogleHostedWorker"},
+		{"https://tekton.dev/chains/v2?run=1#frag", "https://tekton.dev/chains/v2"},
+		{"  local-builder ", "local-builder"},
+	}
+	for _, tt := range tests {
+		if got := normalizeBuilderID(tt.id); got != tt.want {
+			t.Errorf("normalizeBuilderID(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestScanReportsObservedBuilders(t *testing.T) {
+	const generator = "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml"
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "a.intoto.jsonl"),
+		levelStatement(generator+"@refs/tags/v1.9.0", "https://example.com/build", `[{"name":"a","digest":{"sha256":"1"}}]`, `[]`)+"\n"+
+			levelStatement(generator+"@refs/tags/v2.0.0", "https://example.com/build", `[{"name":"b","digest":{"sha256":"2"}}]`, `[]`)+"\n")
+	writeFile(t, filepath.Join(workspace, "b.intoto.json"), testStatement)
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if want := "https://builder.example=1," + generator + "=2"; meta["builders"] != want {
+		t.Errorf("builders = %q, want %q", meta["builders"], want)
+	}
+	if meta["builder_count"] != "2" {
+		t.Errorf("builder_count = %q, want 2", meta["builder_count"])
+	}
+
+	found := findByRule(resp.GetFindings(), "PROV-002")
+	if len(found) != 2 {
+		t.Fatalf("expected PROV-002 for both statements without materials, got %d", len(found))
+	}
+	for _, f := range found {
+		if !strings.HasPrefix(f.GetMetadata()["builder_id"], generator+"@refs/tags/") {
+			t.Errorf("PROV-002 at line %d has builder_id %q", f.GetLocation().GetStartLine(), f.GetMetadata()["builder_id"])
+		}
+	}
+}
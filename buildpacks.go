@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// buildpackRuleID flags Cloud Native Buildpacks builds that pull their
+// builder or buildpacks by a mutable reference, so that the build platform
+// itself can change between builds of the same source.
+const buildpackRuleID = "PROV-063"
+
+// Why a builder or buildpack reference is mutable.
+const (
+	buildpackNoDigest  = "no_digest"
+	buildpackNoVersion = "no_version"
+)
+
+// Where a builder or buildpack reference is declared.
+const (
+	buildpackSourceDescriptor = "project_toml"
+	buildpackSourceCommand    = "pack_command"
+)
+
+// How a pack build produces an SBOM.
+const (
+	packSBOMOutputDir = "sbom_output_dir"
+	packSBOMBuilder   = "builder"
+	packSBOMNone      = "none"
+)
+
+// buildpackPublishers maps the name prefixes of well-known builders and
+// buildpacks, images without docker.io or buildpack IDs, to their
+// publishers; anything else is third-party.
+var buildpackPublishers = []struct {
+	prefix    string
+	publisher string
+}{
+	{"paketobuildpacks/", "paketo"},
+	{"paketo-buildpacks/", "paketo"},
+	{"gcr.io/paketo-buildpacks/", "paketo"},
+	{"heroku/", "heroku"},
+	{"gcr.io/buildpacks/", "google"},
+	{"google.", "google"},
+}
+
+// sbomPublishers are the publishers whose builders write an SBOM of every
+// image they build.
+var sbomPublishers = map[string]bool{"paketo": true}
+
+// buildpackURLVersion matches a version in the path of a buildpack URL.
+var buildpackURLVersion = regexp.MustCompile(`\d+\.\d+`)
+
+// packBuildValueFlags are the pack build options that take a value.
+var packBuildValueFlags = map[string]bool{
+	"--builder": true, "-B": true, "--buildpack": true, "-b": true, "--path": true, "-p": true,
+	"--env": true, "-e": true, "--env-file": true, "--descriptor": true, "-d": true, "--run-image": true,
+	"--network": true, "--cache-image": true, "--cache": true, "--tag": true, "-t": true,
+	"--lifecycle-image": true, "--pull-policy": true, "--volume": true, "--workspace": true,
+	"--previous-image": true, "--gid": true, "--uid": true, "--creation-time": true,
+	"--sbom-output-dir": true, "--report-output-dir": true, "--default-process": true, "-D": true,
+	"--docker-host": true, "--platform": true, "--extension": true, "--pre-buildpack": true,
+	"--post-buildpack": true,
+}
+
+// buildpackAnalyzer checks Cloud Native Buildpacks project descriptors.
+type buildpackAnalyzer struct{}
+
+func (buildpackAnalyzer) kinds() fileKind { return kindBuildpack }
+
+func (buildpackAnalyzer) name() string { return "buildpack" }
+
+func (buildpackAnalyzer) matches(_, name string, _ *provenanceMatcher) fileKind {
+	if name == "project.toml" {
+		return kindBuildpack
+	}
+	return 0
+}
+
+func (buildpackAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := r.findings.files().ReadFile(job.path)
+	if err != nil {
+		r.summary.filesUnreadable++
+		return nil
+	}
+	scanProjectDescriptor(r.findings, job.path, data)
+	return nil
+}
+
+// buildpackPublisher returns the publisher of a builder or buildpack, or ""
+// for a third-party one.
+func buildpackPublisher(ref string) string {
+	name := strings.TrimPrefix(strings.TrimLeft(strings.TrimPrefix(ref, "docker:"), "/"), "urn:cnb:registry:")
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "index.docker.io/"), "docker.io/")
+	for _, p := range buildpackPublishers {
+		if strings.HasPrefix(name, p.prefix) {
+			return p.publisher
+		}
+	}
+	return ""
+}
+
+// builderRefProblem returns why a builder image reference is mutable, or ""
+// when it is pinned by digest or built from variables.
+func builderRefProblem(ref string) string {
+	ref = strings.TrimLeft(strings.TrimPrefix(ref, "docker:"), "/")
+	if ref == "" || strings.ContainsAny(ref, "$%{") {
+		return ""
+	}
+	if image, ok := parseImageRef(ref); ok && image.digest == "" {
+		return buildpackNoDigest
+	}
+	return ""
+}
+
+// buildpackRefProblem returns why a buildpack reference is mutable, or "".
+// Images must be pinned by digest, and registry buildpacks and URLs must
+// name a version. Buildpacks taken from the builder, by a bare ID or a
+// urn:cnb:builder: or from=builder reference, follow the builder's pin, and
+// local paths are part of the source.
+func buildpackRefProblem(ref string) string {
+	switch {
+	case ref == "" || strings.ContainsAny(ref, "$%{"):
+		return ""
+	case strings.HasPrefix(ref, "docker:"):
+		return builderRefProblem(ref)
+	case strings.HasPrefix(ref, "urn:cnb:registry:"):
+		if !strings.Contains(ref, "@") {
+			return buildpackNoVersion
+		}
+		return ""
+	case strings.HasPrefix(ref, "urn:cnb:builder:") || strings.HasPrefix(ref, "from=builder"):
+		return ""
+	case strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://"):
+		if !buildpackURLVersion.MatchString(ref) {
+			return buildpackNoVersion
+		}
+		return ""
+	case strings.HasPrefix(ref, ".") || strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "file:"):
+		return ""
+	case strings.Contains(ref, "@"):
+		// An ID at a version or an image at a digest.
+		return ""
+	}
+	first, _, hasSlash := strings.Cut(ref, "/")
+	if strings.Contains(ref, ":") || hasSlash && (strings.Contains(first, ".") || first == "localhost") {
+		return builderRefProblem(ref)
+	}
+	return ""
+}
+
+// newBuildpackFinding starts a PROV-063 finding for a mutable builder or
+// buildpack reference. Confidence is High for third-party ones and Medium
+// for those of well-known publishers, whose tags are maintained but can
+// still move.
+func newBuildpackFinding(findings *findingSet, filePath string, line int, builder bool, ref, reason, source string) *findingBuilder {
+	publisher := buildpackPublisher(ref)
+	confidence := sdk.ConfidenceHigh
+	if publisher != "" {
+		confidence = sdk.ConfidenceMedium
+	} else {
+		publisher = "third_party"
+	}
+	kind, message := "unpinned_buildpack", fmt.Sprintf("Buildpack %s is fetched without a version", ref)
+	switch {
+	case builder:
+		kind, message = "unpinned_builder", fmt.Sprintf("Buildpacks builder %s is not pinned by digest; the build platform can change under the same tag", ref)
+	case reason == buildpackNoDigest:
+		message = fmt.Sprintf("Buildpack image %s is not pinned by digest", ref)
+	}
+	return findings.Finding(buildpackRuleID, sdk.SeverityMedium, confidence, message).
+		At(filePath, line, line).
+		WithMetadata("type", kind).
+		WithMetadata("reference", ref).
+		WithMetadata("reason", reason).
+		WithMetadata("source", source).
+		WithMetadata("publisher", publisher)
+}
+
+// scanProjectDescriptor flags the mutable builder and buildpack references
+// of a project.toml, in the io.buildpacks tables of schema 0.2 and the
+// build table of schema 0.1. A file that does not parse, or that has
+// neither table, is left alone.
+func scanProjectDescriptor(findings *findingSet, filePath string, data []byte) {
+	doc, err := parseTOML(data)
+	if err != nil {
+		return
+	}
+	cnb := doc.table.subtable("io").subtable("buildpacks")
+	legacy := doc.table.subtable("build")
+	if cnb == nil && legacy == nil {
+		return
+	}
+	for _, t := range []*tomlTableValue{cnb, legacy} {
+		if v := t.get("builder"); v != nil && v.kind == tomlString {
+			if reason := builderRefProblem(v.str); reason != "" {
+				newBuildpackFinding(findings, filePath, v.line, true, v.str, reason, buildpackSourceDescriptor).Done()
+			}
+		}
+	}
+	groups := []*tomlValue{cnb.get("group"), cnb.subtable("pre").get("group"), cnb.subtable("post").get("group"), legacy.get("buildpacks")}
+	for _, group := range groups {
+		if group == nil || group.kind != tomlArray {
+			continue
+		}
+		for _, entry := range group.array {
+			if entry.kind != tomlTable {
+				continue
+			}
+			uri := entry.table.get("uri")
+			if uri == nil || uri.kind != tomlString {
+				continue
+			}
+			if reason := buildpackRefProblem(uri.str); reason != "" {
+				newBuildpackFinding(findings, filePath, uri.line, false, uri.str, reason, buildpackSourceDescriptor).Done()
+			}
+		}
+	}
+}
+
+// packBuild is a pack build invocation.
+type packBuild struct {
+	image      string
+	builder    string
+	buildpacks []string
+	publish    bool
+	sbomDir    bool
+}
+
+// sbomOutput says how the build produces an SBOM: written out with
+// --sbom-output-dir, by a builder that records one in every image, or not
+// at all as far as the command shows.
+func (b packBuild) sbomOutput() string {
+	switch {
+	case b.sbomDir:
+		return packSBOMOutputDir
+	case b.builder != "" && sbomPublishers[buildpackPublisher(b.builder)]:
+		return packSBOMBuilder
+	}
+	return packSBOMNone
+}
+
+// packBuildsOf returns the pack build invocations of a logical command.
+func packBuildsOf(text string) []packBuild {
+	var builds []packBuild
+	for _, c := range newShellParser().parse(text) {
+		words := c.words
+		for len(words) > 0 && (words[0] == "sudo" || envAssignment.MatchString(words[0])) {
+			words = words[1:]
+		}
+		if len(words) < 2 || path.Base(words[0]) != "pack" || words[1] != "build" {
+			continue
+		}
+		var b packBuild
+		for i := 2; i < len(words); i++ {
+			flag, value, inline := strings.Cut(words[i], "=")
+			if !strings.HasPrefix(flag, "-") {
+				if b.image == "" {
+					b.image = words[i]
+				}
+				continue
+			}
+			if !inline && packBuildValueFlags[flag] && i+1 < len(words) {
+				i++
+				value = words[i]
+			}
+			switch flag {
+			case "--publish":
+				b.publish = value == "" || value == "true"
+			case "--builder", "-B":
+				b.builder = value
+			case "--buildpack", "-b", "--pre-buildpack", "--post-buildpack":
+				for _, bp := range strings.Split(value, ",") {
+					if bp = strings.TrimSpace(bp); bp != "" {
+						b.buildpacks = append(b.buildpacks, bp)
+					}
+				}
+			case "--sbom-output-dir":
+				b.sbomDir = true
+			}
+		}
+		builds = append(builds, b)
+	}
+	return builds
+}
+
+// reportPackBuilds flags the mutable builder and buildpack references of
+// each pack build in a logical command, noting whether the build publishes
+// its image and how it produces an SBOM. A build whose builder records an
+// SBOM in the image counts as an SBOM step.
+func reportPackBuilds(findings *findingSet, summary *scanSummary, filePath string, cmd logicalCommand, origin commandOrigin, action *actionTracker) {
+	if !strings.Contains(cmd.text, "pack") {
+		return
+	}
+	for _, b := range packBuildsOf(cmd.text) {
+		sbom := b.sbomOutput()
+		if sbom == packSBOMBuilder {
+			summary.sbomSteps++
+		}
+		report := func(builder bool, ref, reason string) {
+			fb := newBuildpackFinding(findings, filePath, cmd.line, builder, ref, reason, buildpackSourceCommand).
+				WithMetadata("publish", strconv.FormatBool(b.publish)).
+				WithMetadata("sbom_output", sbom)
+			if b.image != "" {
+				fb.WithMetadata("image", b.image)
+			}
+			if cmd.section != "" {
+				fb.WithMetadata("section", cmd.section)
+			}
+			action.annotate(origin.annotate(fb)).Done()
+		}
+		if reason := builderRefProblem(b.builder); reason != "" {
+			report(true, b.builder, reason)
+		}
+		for _, bp := range b.buildpacks {
+			if reason := buildpackRefProblem(bp); reason != "" {
+				report(false, bp, reason)
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBuildpackRefProblem(t *testing.T) {
+	for _, tt := range []struct {
+		ref, want string
+	}{
+		{ref: "docker://gcr.io/paketo-buildpacks/go:4.0.0", want: buildpackNoDigest},
+		{ref: "docker://gcr.io/paketo-buildpacks/go@sha256:0123456789abcdef", want: ""},
+		{ref: "ghcr.io/acme/buildpack", want: buildpackNoDigest},
+		{ref: "acme/buildpack:1.2", want: buildpackNoDigest},
+		{ref: "urn:cnb:registry:acme/buildpack", want: buildpackNoVersion},
+		{ref: "urn:cnb:registry:acme/buildpack@1.2.0", want: ""},
+		{ref: "acme/buildpack@1.2.0", want: ""},
+		{ref: "https://example.com/buildpacks/latest.tgz", want: buildpackNoVersion},
+		{ref: "https://example.com/buildpacks/go-1.2.0.tgz", want: ""},
+		{ref: "urn:cnb:builder:paketo-buildpacks/go", want: ""},
+		{ref: "from=builder", want: ""},
+		{ref: "paketo-buildpacks/go", want: ""},
+		{ref: "./buildpacks/custom", want: ""},
+		{ref: "$BUILDPACK", want: ""},
+	} {
+		if got := buildpackRefProblem(tt.ref); got != tt.want {
+			t.Errorf("buildpackRefProblem(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+	if got := builderRefProblem("paketobuildpacks/builder:base"); got != buildpackNoDigest {
+		t.Errorf("builderRefProblem of a tag = %q", got)
+	}
+	if got := builderRefProblem("paketobuildpacks/builder@sha256:0123456789abcdef"); got != "" {
+		t.Errorf("builderRefProblem of a digest = %q", got)
+	}
+}
+
+func TestScanProjectDescriptor(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "project.toml"), `[_]
+schema-version = "0.2"
+
+[io.buildpacks]
+builder = "paketobuildpacks/builder:base"
+
+[[io.buildpacks.group]]
+uri = "docker://ghcr.io/acme/node-extras:1.0"
+
+[[io.buildpacks.group]]
+uri = "urn:cnb:registry:acme/telemetry@2.1.0"
+
+[[io.buildpacks.group]]
+id = "paketo-buildpacks/nodejs"
+
+[[io.buildpacks.post.group]]
+uri = "urn:cnb:registry:acme/cleanup"
+`)
+	writeFile(t, filepath.Join(workspace, "legacy", "project.toml"), `[build]
+builder = "registry.example.com/builder@sha256:0123456789abcdef"
+
+[[build.buildpacks]]
+uri = "https://example.com/buildpacks/latest.tgz"
+`)
+	writeFile(t, filepath.Join(workspace, "other", "project.toml"), "[tool]\nbuilder = \"acme/builder:latest\"\n")
+
+	found := findByRule(invokeScan(t, testClient(t), workspace).GetFindings(), buildpackRuleID)
+	got := make(map[string]string)
+	for _, f := range found {
+		meta := f.GetMetadata()
+		got[meta["reference"]] = strings.Join([]string{f.GetLocation().GetFilePath(), strconv.Itoa(int(f.GetLocation().GetStartLine())), meta["type"], meta["reason"], meta["publisher"], f.GetConfidence().String()}, " ")
+		if meta["source"] != buildpackSourceDescriptor {
+			t.Errorf("source %q for %s", meta["source"], meta["reference"])
+		}
+	}
+	want := map[string]string{
+		"paketobuildpacks/builder:base":             "project.toml 5 unpinned_builder no_digest paketo CONFIDENCE_MEDIUM",
+		"docker://ghcr.io/acme/node-extras:1.0":     "project.toml 8 unpinned_buildpack no_digest third_party CONFIDENCE_HIGH",
+		"urn:cnb:registry:acme/cleanup":             "project.toml 17 unpinned_buildpack no_version third_party CONFIDENCE_HIGH",
+		"https://example.com/buildpacks/latest.tgz": "legacy/project.toml 5 unpinned_buildpack no_version third_party CONFIDENCE_HIGH",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got findings %v, want %v", got, want)
+	}
+	for ref, w := range want {
+		if got[ref] != w {
+			t.Errorf("finding for %s = %q, want %q", ref, got[ref], w)
+		}
+	}
+}
+
+func TestScanPackBuild(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), `on: push
+jobs:
+  image:
+    runs-on: ubuntu-latest
+    steps:
+      - run: |
+          pack build ghcr.io/acme/api \
+            --builder acme/builder:jammy \
+            --buildpack urn:cnb:registry:acme/extras,paketo-buildpacks/go \
+            --publish
+      - run: pack build ghcr.io/acme/web --builder paketobuildpacks/builder-jammy-base:latest --publish
+      - run: pack build acme/local --builder acme/builder@sha256:0123456789abcdef --sbom-output-dir sbom
+`)
+
+	resp := invokeScan(t, testClient(t), workspace)
+	found := findByRule(resp.GetFindings(), buildpackRuleID)
+	got := make(map[string]map[string]string)
+	for _, f := range found {
+		meta := f.GetMetadata()
+		meta["line"] = strconv.Itoa(int(f.GetLocation().GetStartLine()))
+		got[meta["reference"]] = meta
+	}
+	if len(found) != 3 || len(got) != 3 {
+		t.Fatalf("expected three findings, got %v", got)
+	}
+	if meta := got["acme/builder:jammy"]; meta["type"] != "unpinned_builder" || meta["line"] != "7" || meta["image"] != "ghcr.io/acme/api" ||
+		meta["publish"] != "true" || meta["sbom_output"] != packSBOMNone || meta["source"] != buildpackSourceCommand || meta["publisher"] != "third_party" {
+		t.Errorf("unexpected metadata for the third-party builder: %v", meta)
+	}
+	if meta := got["urn:cnb:registry:acme/extras"]; meta["type"] != "unpinned_buildpack" || meta["reason"] != buildpackNoVersion {
+		t.Errorf("unexpected metadata for the registry buildpack: %v", meta)
+	}
+	if meta := got["paketobuildpacks/builder-jammy-base:latest"]; meta["sbom_output"] != packSBOMBuilder || meta["publisher"] != "paketo" {
+		t.Errorf("unexpected metadata for the Paketo builder: %v", meta)
+	}
+
+	// The single-line publish is a publish step, and the Paketo builder
+	// records an SBOM in the image.
+	missing := false
+	for _, f := range resp.GetFindings() {
+		switch f.GetRuleId() {
+		case "PROV-001":
+			missing = true
+			if meta := f.GetMetadata(); meta["publication"] != publicationExternal || !strings.Contains(meta["publish_targets"], "container:ghcr.io") {
+				t.Errorf("unexpected PROV-001 metadata %v", meta)
+			}
+		case missingSBOMRuleID:
+			t.Error("pack builds producing SBOMs reported as missing an SBOM")
+		}
+	}
+	if !missing {
+		t.Error("expected PROV-001 for the published images")
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// cachePoisoningRuleID flags release jobs that restore caches an attacker
+// can write, or execute what they restore.
+const cachePoisoningRuleID = "PROV-030"
+
+// triggerPullRequestTarget runs a workflow for pull requests in the context
+// of the base repository, with access to its caches.
+const triggerPullRequestTarget = "pull_request_target"
+
+var (
+	// cacheActions are the actions/cache actions; the restore and save
+	// variants do only half of the work.
+	cacheActions = map[string]bool{"actions/cache": true, "actions/cache/restore": true, "actions/cache/save": true}
+	// prTrigger matches the pull request events of a workflow's on: key.
+	prTrigger = regexp.MustCompile(`\bpull_request(?:_target)?\b`)
+	// idTokenWrite matches a permissions entry granting an OIDC token.
+	idTokenWrite = regexp.MustCompile(`^id-token:\s*["']?write\b`)
+	// keyExpression matches a ${{ }} expression in a cache key.
+	keyExpression = regexp.MustCompile(`\$\{\{\s*(.*?)\s*\}\}`)
+	// stableKeyExpression matches expressions that are the same for every
+	// run on a given runner, so they belong to a key's fixed prefix.
+	stableKeyExpression = regexp.MustCompile(`^(?:runner\.(?:os|arch)|matrix\.[A-Za-z0-9_.-]+)$`)
+)
+
+// cacheStep is an actions/cache step of a workflow job.
+type cacheStep struct {
+	line        int
+	action      string
+	key         string
+	restoreKeys []string
+	paths       []string
+	saveAlways  bool
+}
+
+// newCacheStep reads a cache step from its inputs.
+func newCacheStep(s *workflowStep) cacheStep {
+	return cacheStep{
+		line:        s.line,
+		action:      s.action,
+		key:         s.inputs["key"],
+		restoreKeys: inputList(s.inputs["restore-keys"]),
+		paths:       inputList(s.inputs["path"]),
+		saveAlways:  s.inputs["save-always"] == "true",
+	}
+}
+
+// inputList splits a multi-line action input into its non-empty lines.
+func inputList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, "\n") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// restores reports whether the step restores a cache entry.
+func (c cacheStep) restores() bool {
+	return c.action != "actions/cache/save"
+}
+
+// saves reports whether the step saves a cache entry.
+func (c cacheStep) saves() bool {
+	return c.action != "actions/cache/restore"
+}
+
+// cacheKeyPrefix returns the part of a cache key that is fixed for every
+// run: the text before the first expression that varies between runs, such
+// as hashFiles or github.sha. Runner and matrix expressions are kept,
+// normalized, since they only select among a few fixed values.
+func cacheKeyPrefix(key string) string {
+	var b strings.Builder
+	rest := key
+	for {
+		loc := keyExpression.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			b.WriteString(rest)
+			return b.String()
+		}
+		b.WriteString(rest[:loc[0]])
+		expr := rest[loc[2]:loc[3]]
+		if !stableKeyExpression.MatchString(expr) {
+			return b.String()
+		}
+		b.WriteString("${{ " + expr + " }}")
+		rest = rest[loc[1]:]
+	}
+}
+
+// keysOverlap reports whether a key written with writerPrefix can be
+// restored by a key or restore key with readerPrefix. Both prefixes must be
+// known: either one extending the other leaves room for a match.
+func keysOverlap(readerPrefix, writerPrefix string) bool {
+	if readerPrefix == "" || writerPrefix == "" {
+		return false
+	}
+	return strings.HasPrefix(writerPrefix, readerPrefix) || strings.HasPrefix(readerPrefix, writerPrefix)
+}
+
+var (
+	// workspacePathPrefixes spell the workspace root in workflow paths.
+	workspacePathPrefixes = []string{"${{ github.workspace }}/", "${{github.workspace}}/", "$GITHUB_WORKSPACE/", "${GITHUB_WORKSPACE}/", "./"}
+	// workspaceRootReplacer drops the workspace root from a command.
+	workspaceRootReplacer = strings.NewReplacer("${{ github.workspace }}/", "", "${{github.workspace}}/", "", "$GITHUB_WORKSPACE/", "", "${GITHUB_WORKSPACE}/", "")
+)
+
+// normalizeWorkflowPath rewrites a path from a workflow into one spelling:
+// relative to the workspace, or below "~/" for the home directory.
+func normalizeWorkflowPath(p string) string {
+	p = strings.Trim(p, `"'`)
+	for _, prefix := range workspacePathPrefixes {
+		p = strings.TrimPrefix(p, prefix)
+	}
+	for _, home := range []string{"$HOME/", "${HOME}/"} {
+		if rest, ok := strings.CutPrefix(p, home); ok {
+			p = "~/" + rest
+		}
+	}
+	p = strings.TrimSuffix(strings.TrimSuffix(p, "/**"), "/*")
+	return strings.TrimSuffix(p, "/")
+}
+
+// executesFrom reports whether a shell command runs a program from below
+// dir, or adds dir to the PATH of later steps through $GITHUB_PATH.
+func executesFrom(command, dir string) bool {
+	dir = normalizeWorkflowPath(dir)
+	if dir == "" || dir == "." || strings.HasPrefix(dir, "!") || strings.ContainsAny(dir, "*?") {
+		return false
+	}
+	if strings.Contains(command, "GITHUB_PATH") {
+		// Expressions contain spaces, so the workspace root is dropped
+		// before the command is split into words.
+		for _, w := range strings.Fields(workspaceRootReplacer.Replace(command)) {
+			if p := normalizeWorkflowPath(w); p == dir || strings.HasPrefix(p, dir+"/") {
+				return true
+			}
+		}
+	}
+	for _, simple := range commandSeparator.Split(command, -1) {
+		words := strings.Fields(simple)
+		for len(words) > 0 && (commandWrappers[path.Base(words[0])] || envAssignment.MatchString(words[0])) {
+			words = words[1:]
+		}
+		if len(words) > 0 && strings.HasPrefix(normalizeWorkflowPath(words[0]), dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// jobIDToken reports whether a job may request an OIDC token, from its own
+// permissions or, without them, the workflow's.
+func (w *workflowTracker) jobIDToken(j *workflowJob) bool {
+	if j.permissions {
+		return j.idToken
+	}
+	return w.idToken
+}
+
+// reportCaches flags the cache steps of a workflow's release jobs whose
+// restored paths are executed later in the job, and cache steps in jobs
+// that can mint an OIDC token that save even on failure or use a key
+// without any expression.
+func (w *workflowTracker) reportCaches(findings *findingSet, filePath string) {
+	for _, j := range w.jobs {
+		idToken := w.jobIDToken(j)
+		if !w.release && !idToken {
+			continue
+		}
+		for _, c := range j.caches {
+			if c.restores() {
+				reportExecutedCache(findings, filePath, j, c)
+			}
+			if !idToken {
+				continue
+			}
+			if c.saveAlways {
+				reportIDTokenCache(findings, filePath, j, c, "cache_save_always_with_id_token",
+					fmt.Sprintf("Job %s can request an OIDC token and saves cache %q even when it fails (save-always)", j.name, c.key))
+			}
+			if c.key != "" && !strings.Contains(c.key, "${{") {
+				reportIDTokenCache(findings, filePath, j, c, "unscoped_cache_key_with_id_token",
+					fmt.Sprintf("Job %s can request an OIDC token and uses cache key %q, which is the same for every ref and input", j.name, c.key))
+			}
+		}
+	}
+}
+
+// reportExecutedCache flags the first command after a cache restore that
+// runs a program from a restored path.
+func reportExecutedCache(findings *findingSet, filePath string, j *workflowJob, c cacheStep) {
+	for _, p := range c.paths {
+		for _, cmd := range j.commands {
+			if cmd.line <= c.line || !executesFrom(cmd.command, p) {
+				continue
+			}
+			findings.Finding(
+				cachePoisoningRuleID,
+				sdk.SeverityMedium,
+				sdk.ConfidenceMedium,
+				fmt.Sprintf("Release job %s executes %s from cached path %s; a poisoned cache entry runs in the build", j.name, cmd.command, p),
+			).
+				At(filePath, cmd.line, cmd.line).
+				WithMetadata("type", "cached_path_executed").
+				WithMetadata("job", j.name).
+				WithMetadata("cache_path", p).
+				WithMetadata("cache_key", c.key).
+				WithMetadata("cache_line", strconv.Itoa(c.line)).
+				Done()
+			break
+		}
+	}
+}
+
+// reportIDTokenCache flags a cache step of a job with id-token: write.
+func reportIDTokenCache(findings *findingSet, filePath string, j *workflowJob, c cacheStep, kind, message string) {
+	findings.Finding(cachePoisoningRuleID, sdk.SeverityMedium, sdk.ConfidenceMedium, message).
+		At(filePath, c.line, c.line).
+		WithMetadata("type", kind).
+		WithMetadata("job", j.name).
+		WithMetadata("cache_key", c.key).
+		Done()
+}
+
+// workflowCache is a cache step recorded for the cross-workflow check.
+type workflowCache struct {
+	path string
+	// rel is the workflow's workspace-relative path.
+	rel string
+	job string
+	// prTrigger is the workflow's pull request event, if any; release is
+	// set when the workflow or job releases or can mint an OIDC token.
+	prTrigger string
+	release   bool
+	cacheStep
+}
+
+// recordWorkflowCaches records the cache steps of a workflow for the
+// cross-workflow check.
+func (s *scanSummary) recordWorkflowCaches(filePath, rel string, w *workflowTracker) {
+	for _, j := range w.jobs {
+		for _, c := range j.caches {
+			s.workflowCaches = append(s.workflowCaches, workflowCache{
+				path:      filePath,
+				rel:       rel,
+				job:       j.name,
+				prTrigger: w.prTrigger,
+				release:   w.release || w.jobIDToken(j),
+				cacheStep: c,
+			})
+		}
+	}
+}
+
+// checkCacheSharing flags cache restores in release workflows whose key or
+// restore keys match keys saved by workflows that run on pull requests, so
+// pull request code can choose what the release build restores. Each
+// reader is reported once per writing workflow.
+func checkCacheSharing(findings *findingSet, caches []workflowCache) {
+	for _, r := range caches {
+		if !r.release || !r.restores() {
+			continue
+		}
+		readerKeys := append([]string{r.key}, r.restoreKeys...)
+		reported := make(map[string]bool)
+		for _, w := range caches {
+			if w.prTrigger == "" || !w.saves() || reported[w.rel] {
+				continue
+			}
+			writerPrefix := cacheKeyPrefix(w.key)
+			for _, key := range readerKeys {
+				if !keysOverlap(cacheKeyPrefix(key), writerPrefix) {
+					continue
+				}
+				reported[w.rel] = true
+				severity := sdk.SeverityMedium
+				if w.prTrigger == triggerPullRequestTarget {
+					severity = sdk.SeverityHigh
+				}
+				findings.Finding(
+					cachePoisoningRuleID,
+					severity,
+					sdk.ConfidenceMedium,
+					fmt.Sprintf("Release job %s restores cache key %q, which %s workflow %s saves", r.job, key, w.prTrigger, w.rel),
+				).
+					At(r.path, r.line, r.line).
+					WithMetadata("type", "cache_shared_with_pr").
+					WithMetadata("cache_key", key).
+					WithMetadata("reader_workflow", r.rel).
+					WithMetadata("reader_job", r.job).
+					WithMetadata("writer_workflow", w.rel).
+					WithMetadata("writer_job", w.job).
+					WithMetadata("writer_key", w.key).
+					WithMetadata("writer_line", strconv.Itoa(w.line)).
+					WithMetadata("pr_trigger", w.prTrigger).
+					Done()
+				break
+			}
+		}
+	}
+}
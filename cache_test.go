@@ -0,0 +1,135 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCacheKeyPrefix(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"${{ runner.os }}-go-${{ hashFiles('**/go.sum') }}", "${{ runner.os }}-go-"},
+		{"${{runner.os}}-${{ matrix.arch }}-tools", "${{ runner.os }}-${{ matrix.arch }}-tools"},
+		{"deps-${{ github.sha }}", "deps-"},
+		{"${{ github.ref_name }}-deps", ""},
+		{"static-key", "static-key"},
+	}
+	for _, tt := range tests {
+		if got := cacheKeyPrefix(tt.key); got != tt.want {
+			t.Errorf("cacheKeyPrefix(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestExecutesFrom(t *testing.T) {
+	tests := []struct {
+		command string
+		dir     string
+		want    bool
+	}{
+		{"./tools/bin/golangci-lint run", "tools/bin", true},
+		{"sudo $HOME/.cargo/bin/cross build", "~/.cargo/bin", true},
+		{`echo "${{ github.workspace }}/.bin" >> "$GITHUB_PATH"`, ".bin", true},
+		{"go build ./...", "~/go/pkg/mod", false},
+		{"cat tools/bin/VERSION", "tools/bin", false},
+	}
+	for _, tt := range tests {
+		if got := executesFrom(tt.command, tt.dir); got != tt.want {
+			t.Errorf("executesFrom(%q, %q) = %v, want %v", tt.command, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestScanCacheSharedWithPullRequests(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "pr.yml"), strings.Join([]string{
+		"on: pull_request_target",
+		"jobs:",
+		"  test:",
+		"    steps:",
+		"      - uses: actions/cache@v4",
+		"        with:",
+		"          path: ~/.cache/go-build",
+		"          key: ${{ runner.os }}-go-${{ github.head_ref }}",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), strings.Join([]string{
+		"on:",
+		"  push:",
+		"    tags: ['v*']",
+		"permissions:",
+		"  id-token: write",
+		"jobs:",
+		"  build:",
+		"    steps:",
+		"      - name: Restore",
+		"        uses: actions/cache/restore@v4",
+		"        with:",
+		"          path: |",
+		"            ~/.cache/go-build",
+		"            tools/bin",
+		"          key: release-${{ hashFiles('go.sum') }}",
+		"          restore-keys: |",
+		"            ${{ runner.os }}-go-",
+		"      - run: ./tools/bin/goreleaser release",
+		"      - uses: actions/cache@v4",
+		"        with:",
+		"          path: dist",
+		"          key: release-dist",
+		"          save-always: true",
+	}, "\n")+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	byType := make(map[string][]map[string]string)
+	for _, f := range findByRule(resp.GetFindings(), cachePoisoningRuleID) {
+		meta := f.GetMetadata()
+		meta["line"] = strconv.Itoa(int(f.GetLocation().GetStartLine()))
+		meta["severity"] = severityNames[f.GetSeverity()]
+		byType[meta["type"]] = append(byType[meta["type"]], meta)
+	}
+
+	shared := byType["cache_shared_with_pr"]
+	if len(shared) != 1 {
+		t.Fatalf("expected one shared cache finding, got %v", byType)
+	}
+	if m := shared[0]; m["reader_workflow"] != ".github/workflows/release.yml" || m["writer_workflow"] != ".github/workflows/pr.yml" ||
+		m["cache_key"] != "${{ runner.os }}-go-" || m["writer_line"] != "5" || m["line"] != "10" || m["severity"] != "high" {
+		t.Errorf("unexpected shared cache finding: %v", m)
+	}
+
+	executed := byType["cached_path_executed"]
+	if len(executed) != 1 || executed[0]["cache_path"] != "tools/bin" || executed[0]["line"] != "18" {
+		t.Errorf("expected tools/bin executed at line 18, got %v", executed)
+	}
+	if got := byType["cache_save_always_with_id_token"]; len(got) != 1 || got[0]["line"] != "19" {
+		t.Errorf("expected save-always finding at line 19, got %v", got)
+	}
+	if got := byType["unscoped_cache_key_with_id_token"]; len(got) != 1 || got[0]["cache_key"] != "release-dist" {
+		t.Errorf("expected unscoped key finding for release-dist, got %v", got)
+	}
+}
+
+func TestScanCacheOutsideReleaseWorkflows(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "ci.yml"), strings.Join([]string{
+		"on: [push, pull_request]",
+		"jobs:",
+		"  test:",
+		"    steps:",
+		"      - uses: actions/cache@v4",
+		"        with:",
+		"          path: bin",
+		"          key: tools",
+		"      - run: ./bin/lint",
+	}, "\n")+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	if got := findByRule(resp.GetFindings(), cachePoisoningRuleID); len(got) != 0 {
+		t.Errorf("expected no %s findings outside release workflows, got %d", cachePoisoningRuleID, len(got))
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// Reasons of the Cargo reproducibility findings.
+const (
+	cargoReasonGitDependency = "Cargo git dependency is not pinned to a rev"
+	cargoReasonPatchBranch   = "Cargo [patch] entry follows a git branch"
+	cargoReasonMissingLock   = "Binary crate has no Cargo.lock"
+	cargoReasonBuildIdentity = "build.rs embeds the build user or host name"
+	cargoReasonBuildTime     = "build.rs embeds the build time"
+	cargoReasonInstall       = "cargo install without --locked ignores the crate's Cargo.lock"
+)
+
+// cargoDependencySections are the manifest tables that declare
+// dependencies, at the top level or under a target.
+var cargoDependencySections = []string{"dependencies", "dev-dependencies", "build-dependencies", "dev_dependencies", "build_dependencies"}
+
+// cargoAnalyzer checks Cargo manifests and build scripts for
+// reproducibility.
+type cargoAnalyzer struct{}
+
+func (cargoAnalyzer) kinds() fileKind { return kindCargo }
+
+func (cargoAnalyzer) name() string { return "cargo" }
+
+func (cargoAnalyzer) matches(_, name string, _ *provenanceMatcher) fileKind {
+	if name == "Cargo.toml" || name == "build.rs" {
+		return kindCargo
+	}
+	return 0
+}
+
+func (cargoAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := r.findings.files().ReadFile(job.path)
+	if err != nil {
+		r.summary.filesUnreadable++
+		return nil
+	}
+	if filepath.Base(job.path) == "build.rs" {
+		return scanBuildScript(ctx, r.findings, job.path, data)
+	}
+	scanCargoManifest(r.findings, job.path, data)
+	return nil
+}
+
+// cargoLockFor returns the Cargo.lock governing the crate in dir: the
+// nearest one in dir or a parent within the workspace, where a Cargo
+// workspace keeps it. It returns "" when there is none.
+func cargoLockFor(fsys workspaceFS, root, dir string) string {
+	for {
+		lock := filepath.Join(dir, "Cargo.lock")
+		if info, err := fsys.Stat(lock); err == nil && info.Mode().IsRegular() {
+			return lock
+		}
+		if dir == root || len(dir) <= len(root) {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// newCargoFinding starts a PROV-003 finding for a Cargo manifest or build
+// script.
+func newCargoFinding(findings *findingSet, filePath string, line int, confidence pluginv1.Confidence, reason, remediation string) *findingBuilder {
+	return findings.Finding(
+		"PROV-003",
+		sdk.SeverityMedium,
+		confidence,
+		fmt.Sprintf("Build reproducibility risk: %s", reason),
+	).
+		At(filePath, line, line).
+		WithMetadata("type", "reproducibility_risk").
+		WithMetadata("reason", reason).
+		WithMetadata("remediation", remediation).
+		WithMetadata("ecosystem", "cargo")
+}
+
+// gitRefDescription describes what an unpinned git dependency follows.
+func gitRefDescription(entry *tomlTableValue) string {
+	switch {
+	case entry.str("branch") != "":
+		return "branch " + entry.str("branch")
+	case entry.str("tag") != "":
+		return "tag " + entry.str("tag")
+	}
+	return "default branch"
+}
+
+// scanCargoManifest flags git dependencies without a rev, [patch] entries
+// following a branch, and binary crates without a Cargo.lock. Git sources
+// are recorded by commit in Cargo.lock, so with one present they drop to
+// Medium confidence: the lock holds until the next cargo update. A
+// manifest that does not parse is left alone.
+func scanCargoManifest(findings *findingSet, filePath string, data []byte) {
+	doc, err := parseTOML(data)
+	if err != nil {
+		return
+	}
+	root := doc.table
+	lock := cargoLockFor(findings.files(), findings.root, filepath.Dir(filePath))
+	confidence := sdk.ConfidenceHigh
+	if lock != "" {
+		confidence = sdk.ConfidenceMedium
+	}
+
+	type section struct {
+		name  string
+		table *tomlTableValue
+	}
+	var sections []section
+	for _, name := range cargoDependencySections {
+		if t := root.subtable(name); t != nil {
+			sections = append(sections, section{name, t})
+		}
+	}
+	if t := root.subtable("workspace").subtable("dependencies"); t != nil {
+		sections = append(sections, section{"workspace.dependencies", t})
+	}
+	if targets := root.subtable("target"); targets != nil {
+		for _, cfg := range targets.keys {
+			for _, name := range cargoDependencySections {
+				if t := targets.subtable(cfg).subtable(name); t != nil {
+					sections = append(sections, section{fmt.Sprintf("target.%s.%s", cfg, name), t})
+				}
+			}
+		}
+	}
+	for _, s := range sections {
+		for _, dep := range s.table.keys {
+			entry := s.table.subtable(dep)
+			git := entry.get("git")
+			if git == nil || git.kind != tomlString || entry.get("rev") != nil {
+				continue
+			}
+			newCargoFinding(findings, filePath, git.line, confidence, cargoReasonGitDependency,
+				"Pin the dependency with rev = \"<commit>\"").
+				WithMetadata("dependency", dep).
+				WithMetadata("section", s.name).
+				WithMetadata("git", git.str).
+				WithMetadata("git_ref", gitRefDescription(entry)).
+				Done()
+		}
+	}
+
+	if patches := root.subtable("patch"); patches != nil {
+		for _, source := range patches.keys {
+			entries := patches.subtable(source)
+			if entries == nil {
+				continue
+			}
+			for _, dep := range entries.keys {
+				entry := entries.subtable(dep)
+				git := entry.get("git")
+				if git == nil || git.kind != tomlString || entry.get("rev") != nil || entry.get("tag") != nil {
+					continue
+				}
+				newCargoFinding(findings, filePath, git.line, confidence, cargoReasonPatchBranch,
+					"Point the patch at a commit with rev = \"<commit>\"").
+					WithMetadata("dependency", dep).
+					WithMetadata("patch_source", source).
+					WithMetadata("git", git.str).
+					WithMetadata("git_ref", gitRefDescription(entry)).
+					Done()
+			}
+		}
+	}
+
+	if pkg := root.get("package"); pkg != nil && pkg.kind == tomlTable && lock == "" {
+		binary := root.get("bin") != nil
+		if !binary {
+			binary, _ = manifestBinary(findings.files(), filePath, data)
+		}
+		if binary {
+			newCargoFinding(findings, filePath, pkg.line, sdk.ConfidenceHigh, cargoReasonMissingLock,
+				"Commit Cargo.lock so the binary builds from the dependency versions it was tested with").
+				Done()
+		}
+	}
+}
+
+// Build script patterns, matched against code with comments removed.
+var (
+	// buildScriptIdentity matches reads of the build user or host name.
+	buildScriptIdentity = regexp.MustCompile(`\b(?:option_)?env!\s*\(\s*"(?:USER|USERNAME|LOGNAME|HOSTNAME|COMPUTERNAME)"|\benv::var(?:_os)?\s*\(\s*"(?:USER|USERNAME|LOGNAME|HOSTNAME|COMPUTERNAME)"|\bwhoami::|\bhostname::get\b|\bgethostname\s*\(`)
+	// buildScriptTime matches reads of the wall clock.
+	buildScriptTime = regexp.MustCompile(`\bSystemTime::now\s*\(|\b(?:Utc|Local)::now\s*\(|\bOffsetDateTime::now_(?:utc|local)\s*\(`)
+	// buildScriptOutDirWrite matches a build script writing a file, which
+	// only reaches the crate when it writes into OUT_DIR.
+	buildScriptOutDirWrite = regexp.MustCompile(`\bfs::write\s*\(|\bFile::create\s*\(|\bwrite(?:ln)?!\s*\(|\.write_all\s*\(`)
+	// buildScriptRustcEnv matches a build script setting a variable the
+	// crate reads with env!.
+	buildScriptRustcEnv = regexp.MustCompile(`cargo::?rustc-env=`)
+	// outDirInclude matches crate source pulling in a generated file.
+	outDirInclude = regexp.MustCompile(`\binclude(?:_str|_bytes)?!\s*\(\s*concat!\s*\(\s*env!\s*\(\s*"OUT_DIR"`)
+)
+
+// Caps on the crate sources searched for include! of OUT_DIR files.
+const (
+	maxCargoSourceFiles = 256
+	maxCargoSourceBytes = 1 << 20
+)
+
+// scanBuildScript flags a build script that reads the build user, host, or
+// time and passes it on to the crate, through a file written into OUT_DIR
+// or a cargo:rustc-env variable; what a build script keeps to itself does
+// not reach the artifact. The value is known to be consumed when the crate
+// sets rustc-env or its sources include! a file from OUT_DIR (High
+// confidence), and otherwise only likely to be (Medium). Time reads pass
+// when the script also honours SOURCE_DATE_EPOCH.
+func scanBuildScript(ctx context.Context, findings *findingSet, filePath string, data []byte) error {
+	code := stripRustComments(data)
+	rustcEnv := buildScriptRustcEnv.Match(code)
+	writesOutDir := bytes.Contains(code, []byte("OUT_DIR")) && buildScriptOutDirWrite.Match(code)
+	if !rustcEnv && !writesOutDir {
+		return nil
+	}
+	sourceDate := bytes.Contains(code, []byte("SOURCE_DATE_EPOCH"))
+
+	confidence := sdk.ConfidenceMedium
+	consumer := ""
+	if rustcEnv {
+		confidence, consumer = sdk.ConfidenceHigh, "rustc_env"
+	} else if src, err := includesOutDir(ctx, findings.files(), filepath.Join(filepath.Dir(filePath), "src")); err != nil {
+		return err
+	} else if src != "" {
+		confidence, consumer = sdk.ConfidenceHigh, workspacePath(findings.root, src)
+	}
+
+	for i, line := range bytes.Split(code, []byte("\n")) {
+		reason, remediation := "", ""
+		switch {
+		case buildScriptIdentity.Match(line):
+			reason, remediation = cargoReasonBuildIdentity, "Leave the user and host out of generated code, or take them from a fixed input"
+		case buildScriptTime.Match(line) && !sourceDate:
+			reason, remediation = cargoReasonBuildTime, "Read SOURCE_DATE_EPOCH instead of the wall clock"
+		default:
+			continue
+		}
+		fb := newCargoFinding(findings, filePath, i+1, confidence, reason, remediation)
+		if consumer != "" {
+			fb.WithMetadata("consumed_by", consumer)
+		}
+		fb.Done()
+	}
+	return nil
+}
+
+// includesOutDir returns the first Rust source under dir that include!s a
+// file from OUT_DIR, reading at most maxCargoSourceFiles files of up to
+// maxCargoSourceBytes each. It returns "" when there is none.
+func includesOutDir(ctx context.Context, fsys workspaceFS, dir string) (string, error) {
+	found, files := "", 0
+	err := fsys.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(d.Name()) != ".rs" {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if files++; files > maxCargoSourceFiles {
+			return fs.SkipAll
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxCargoSourceBytes {
+			return nil
+		}
+		data, err := fsys.ReadFile(p)
+		if err == nil && outDirInclude.Match(stripRustComments(data)) {
+			found = p
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if isContextError(err) {
+		return "", err
+	}
+	return found, nil
+}
+
+// stripRustComments blanks out the line and block comments of Rust source,
+// keeping string literals and newlines so that lines keep their numbers.
+// Block comments nest, as in Rust.
+func stripRustComments(data []byte) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+	blank := func(from, to int) {
+		for j := from; j < to; j++ {
+			if out[j] != '\n' {
+				out[j] = ' '
+			}
+		}
+	}
+	for i := 0; i < len(data); {
+		switch {
+		case bytes.HasPrefix(data[i:], []byte("//")):
+			end := bytes.IndexByte(data[i:], '\n')
+			if end < 0 {
+				end = len(data) - i
+			}
+			blank(i, i+end)
+			i += end
+		case bytes.HasPrefix(data[i:], []byte("/*")):
+			depth, j := 1, i+2
+			for j < len(data) && depth > 0 {
+				switch {
+				case bytes.HasPrefix(data[j:], []byte("/*")):
+					depth++
+					j += 2
+				case bytes.HasPrefix(data[j:], []byte("*/")):
+					depth--
+					j += 2
+				default:
+					j++
+				}
+			}
+			blank(i, j)
+			i = j
+		case data[i] == 'r' && (i == 0 || !isRustIdentByte(data[i-1])) && rawStringStart(data[i+1:]) >= 0:
+			hashes := rawStringStart(data[i+1:])
+			closing := append([]byte{'"'}, bytes.Repeat([]byte{'#'}, hashes)...)
+			start := i + 2 + hashes
+			end := bytes.Index(data[start:], closing)
+			if end < 0 {
+				return out
+			}
+			i = start + end + len(closing)
+		case data[i] == '"':
+			i++
+			for i < len(data) && data[i] != '"' {
+				if data[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i++
+		case data[i] == '\'':
+			// A character literal closes after one character or escape;
+			// anything else is a lifetime.
+			switch _, size := utf8.DecodeRune(data[i+1:]); {
+			case i+1 < len(data) && data[i+1] == '\\':
+				if end := bytes.IndexByte(data[min(len(data), i+3):min(len(data), i+13)], '\''); end >= 0 {
+					i += 3 + end
+				}
+				i++
+			case i+1+size < len(data) && data[i+1+size] == '\'':
+				i += size + 2
+			default:
+				i++
+			}
+		default:
+			i++
+		}
+	}
+	return out
+}
+
+// rawStringStart returns the number of # opening a raw string literal at
+// the start of data, after its r, or -1 if data does not open one.
+func rawStringStart(data []byte) int {
+	n := 0
+	for n < len(data) && data[n] == '#' {
+		n++
+	}
+	if n < len(data) && data[n] == '"' {
+		return n
+	}
+	return -1
+}
+
+func isRustIdentByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_'
+}
+
+// cargoInstallValueFlags are the cargo install options that take a value.
+var cargoInstallValueFlags = map[string]bool{
+	"--version": true, "--vers": true, "--git": true, "--branch": true, "--tag": true, "--rev": true,
+	"--path": true, "--root": true, "--registry": true, "--index": true, "--features": true, "-F": true,
+	"--target": true, "--target-dir": true, "--profile": true, "--bin": true, "--example": true,
+	"--jobs": true, "-j": true, "--config": true, "-Z": true, "--color": true,
+}
+
+// reportCargoInstall flags each cargo install in a logical command that
+// neither passes --locked nor --frozen, so that the installed tool is
+// built from whatever dependency versions are newest.
+func reportCargoInstall(findings *findingSet, filePath string, cmd logicalCommand, origin commandOrigin, action *actionTracker) {
+	if !strings.Contains(cmd.text, "cargo") {
+		return
+	}
+	for _, c := range newShellParser().parse(cmd.text) {
+		words := c.words
+		for len(words) > 0 && (words[0] == "sudo" || envAssignment.MatchString(words[0])) {
+			words = words[1:]
+		}
+		if len(words) < 2 || path.Base(words[0]) != "cargo" {
+			continue
+		}
+		args := words[1:]
+		if strings.HasPrefix(args[0], "+") {
+			args = args[1:]
+		}
+		if len(args) == 0 || args[0] != "install" {
+			continue
+		}
+		locked, crate := false, ""
+		for i := 1; i < len(args); i++ {
+			switch a := args[i]; {
+			case a == "--locked" || a == "--frozen" || a == "--list":
+				locked = true
+			case cargoInstallValueFlags[a]:
+				i++
+			case !strings.HasPrefix(a, "-") && crate == "":
+				crate = a
+			}
+		}
+		if locked {
+			continue
+		}
+		fb := newEmbeddingFinding(findings, filePath, cmd, cargoReasonInstall, "Pass --locked to build with the crate's Cargo.lock").
+			WithMetadata("ecosystem", "cargo")
+		if crate != "" {
+			fb.WithMetadata("crate", crate)
+		}
+		action.annotate(origin.annotate(fb)).Done()
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// cargoFindings returns the Cargo PROV-003 findings keyed by path, line,
+// and reason.
+func cargoFindings(findings []*pluginv1.Finding) map[string]*pluginv1.Finding {
+	out := make(map[string]*pluginv1.Finding)
+	for _, f := range findByRule(findings, "PROV-003") {
+		if f.GetMetadata()["ecosystem"] != "cargo" {
+			continue
+		}
+		key := f.GetLocation().GetFilePath() + ":" + strconv.Itoa(int(f.GetLocation().GetStartLine())) + " " + f.GetMetadata()["reason"]
+		out[key] = f
+	}
+	return out
+}
+
+func TestScanCargoManifest(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Cargo.toml"), strings.Join([]string{
+		`[package]`,
+		`name = "app"`,
+		``,
+		`[dependencies]`,
+		`serde = "1"`,
+		`pinned = { git = "https://github.com/org/pinned", rev = "0123456" }`,
+		`tracked = { git = "https://github.com/org/tracked", branch = "main" }`,
+		``,
+		`[dependencies.tagged]`,
+		`version = "1"`,
+		`git = "https://github.com/org/tagged"`,
+		`tag = "v1.0.0"`,
+		``,
+		`[target.'cfg(windows)'.build-dependencies]`,
+		`winres = { git = "https://github.com/org/winres" }`,
+		``,
+		`[patch.crates-io]`,
+		`serde = { git = "https://github.com/org/serde", branch = "fix" }`,
+		`rand = { git = "https://github.com/org/rand", rev = "abcdef0" }`,
+		`log = { path = "../log" }`,
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, "src", "main.rs"), "fn main() {}\n")
+	// A library crate in the same workspace needs no lock of its own.
+	writeFile(t, filepath.Join(workspace, "lib", "Cargo.toml"), "[package]\nname = \"lib\"\n")
+	client := testClient(t)
+
+	got := cargoFindings(invokeScan(t, client, workspace).GetFindings())
+	want := map[string]string{
+		"Cargo.toml:1 " + cargoReasonMissingLock:    "",
+		"Cargo.toml:7 " + cargoReasonGitDependency:  "tracked branch main",
+		"Cargo.toml:11 " + cargoReasonGitDependency: "tagged tag v1.0.0",
+		"Cargo.toml:15 " + cargoReasonGitDependency: "winres default branch",
+		"Cargo.toml:18 " + cargoReasonPatchBranch:   "serde branch fix",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d Cargo findings, want %d: %v", len(got), len(want), got)
+	}
+	for key, w := range want {
+		f, ok := got[key]
+		if !ok {
+			t.Errorf("missing %s", key)
+			continue
+		}
+		meta := f.GetMetadata()
+		if w != "" && meta["dependency"]+" "+meta["git_ref"] != w {
+			t.Errorf("%s: metadata %v, want %s", key, meta, w)
+		}
+		if f.GetConfidence() != sdk.ConfidenceHigh {
+			t.Errorf("%s: confidence %s without a Cargo.lock", key, f.GetConfidence())
+		}
+	}
+	if meta := got["Cargo.toml:15 "+cargoReasonGitDependency].GetMetadata(); meta["section"] != "target.cfg(windows).build-dependencies" {
+		t.Errorf("unexpected section %q", meta["section"])
+	}
+
+	// A lock records git sources by commit until the next cargo update.
+	writeFile(t, filepath.Join(workspace, "Cargo.lock"), "version = 3\n")
+	got = cargoFindings(invokeScan(t, client, workspace).GetFindings())
+	if _, ok := got["Cargo.toml:1 "+cargoReasonMissingLock]; ok || len(got) != 4 {
+		t.Errorf("expected the four git findings and no missing lock, got %v", got)
+	}
+	for key, f := range got {
+		if f.GetConfidence() != sdk.ConfidenceMedium {
+			t.Errorf("%s: confidence %s with a Cargo.lock", key, f.GetConfidence())
+		}
+	}
+}
+
+func TestScanBuildScript(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		include    bool
+		want       []string
+		confidence pluginv1.Confidence
+	}{
+		{
+			name: "rustc-env",
+			script: strings.Join([]string{
+				`fn main() {`,
+				`    // let user = env!("USER");`,
+				`    let user = env::var("USER").unwrap();`,
+				`    println!("cargo:rustc-env=BUILD_USER={}", user);`,
+				`}`,
+			}, "\n"),
+			want:       []string{"3 " + cargoReasonBuildIdentity},
+			confidence: sdk.ConfidenceHigh,
+		},
+		{
+			name: "out dir include",
+			script: strings.Join([]string{
+				`fn main() {`,
+				`    let out = PathBuf::from(env::var("OUT_DIR").unwrap());`,
+				`    /* SystemTime::now() /* nested */ is fine here */`,
+				`    let now = SystemTime::now().duration_since(UNIX_EPOCH).unwrap();`,
+				`    fs::write(out.join("built.rs"), format!("const BUILT: u64 = {};", now.as_secs())).unwrap();`,
+				`}`,
+			}, "\n"),
+			include:    true,
+			want:       []string{"4 " + cargoReasonBuildTime},
+			confidence: sdk.ConfidenceHigh,
+		},
+		{
+			name: "out dir unconsumed",
+			script: strings.Join([]string{
+				`fn main() {`,
+				`    let out = env::var("OUT_DIR").unwrap();`,
+				`    let host = env!("HOSTNAME");`,
+				`    fs::write(format!("{out}/host"), host).unwrap();`,
+				`}`,
+			}, "\n"),
+			want:       []string{"3 " + cargoReasonBuildIdentity},
+			confidence: sdk.ConfidenceMedium,
+		},
+		{
+			name: "source date epoch",
+			script: strings.Join([]string{
+				`fn main() {`,
+				`    let now = env::var("SOURCE_DATE_EPOCH").ok().unwrap_or_else(|| SystemTime::now().elapsed().unwrap().as_secs().to_string());`,
+				`    println!("cargo:rustc-env=BUILT={now}");`,
+				`}`,
+			}, "\n"),
+		},
+		{
+			name: "kept to itself",
+			script: strings.Join([]string{
+				`fn main() {`,
+				`    eprintln!("built by {}", env!("USER"));`,
+				`    println!("cargo:rerun-if-changed=build.rs");`,
+				`}`,
+			}, "\n"),
+		},
+		{
+			name: "strings are not comments",
+			script: strings.Join([]string{
+				`fn main() {`,
+				`    let url = "https://example.com"; let user = env!("USER");`,
+				`    let raw = r#"/* "# ; let host = env!("HOSTNAME");`,
+				`    println!("cargo:rustc-env=WHO={user}{host}");`,
+				`}`,
+			}, "\n"),
+			want:       []string{"2 " + cargoReasonBuildIdentity, "3 " + cargoReasonBuildIdentity},
+			confidence: sdk.ConfidenceHigh,
+		},
+	}
+	client := testClient(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			writeFile(t, filepath.Join(workspace, "build.rs"), tt.script+"\n")
+			lib := "pub fn f() {}\n"
+			if tt.include {
+				lib = "include!(concat!(env!(\"OUT_DIR\"), \"/built.rs\"));\n"
+			}
+			writeFile(t, filepath.Join(workspace, "src", "lib.rs"), lib)
+
+			got := cargoFindings(invokeScan(t, client, workspace).GetFindings())
+			if len(got) != len(tt.want) {
+				t.Errorf("got %d findings, want %d: %v", len(got), len(tt.want), got)
+			}
+			for _, w := range tt.want {
+				f, ok := got["build.rs:"+w]
+				if !ok {
+					t.Errorf("missing build.rs:%s", w)
+					continue
+				}
+				if f.GetConfidence() != tt.confidence {
+					t.Errorf("build.rs:%s: confidence %s, want %s", w, f.GetConfidence(), tt.confidence)
+				}
+				if tt.include && f.GetMetadata()["consumed_by"] != "src/lib.rs" {
+					t.Errorf("build.rs:%s: consumed_by %q", w, f.GetMetadata()["consumed_by"])
+				}
+			}
+		})
+	}
+}
+
+func TestScanCargoInstall(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "ci.yml"), strings.Join([]string{
+		"jobs:",
+		"  build:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - run: cargo install cargo-audit",
+		"      - run: cargo install --locked cargo-deny",
+		"      - run: cargo +nightly install --version 0.9.1 --force cargo-fuzz && cargo build",
+		"      - run: sudo cargo install --frozen --path .",
+		"      - run: echo 'cargo install is slow'",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, "Makefile"), "tools:\n\tcargo install --git https://github.com/org/tool\n")
+
+	got := cargoFindings(invokeScan(t, testClient(t), workspace).GetFindings())
+	want := map[string]string{
+		".github/workflows/ci.yml:5 " + cargoReasonInstall: "cargo-audit",
+		".github/workflows/ci.yml:7 " + cargoReasonInstall: "cargo-fuzz",
+		"Makefile:2 " + cargoReasonInstall:                 "",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d findings, want %d: %v", len(got), len(want), got)
+	}
+	for key, crate := range want {
+		if f, ok := got[key]; !ok {
+			t.Errorf("missing %s", key)
+		} else if f.GetMetadata()["crate"] != crate {
+			t.Errorf("%s: crate %q, want %q", key, f.GetMetadata()["crate"], crate)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// untrustedRefRuleID flags a release job that builds from a ref chosen by
+// whoever triggered the workflow rather than the triggering tag or commit.
+const untrustedRefRuleID = "PROV-044"
+
+// Who chooses a checkout ref.
+const (
+	refSourceDispatchInput   = "dispatch_input"
+	refSourcePullRequest     = "pull_request"
+	refSourceDispatchPayload = "dispatch_payload"
+	refSourceWorkflowRun     = "workflow_run"
+	refSourceMergeRef        = "merge_ref"
+)
+
+// implicitMergeRef stands for the ref actions/checkout fetches by default
+// in a pull request workflow.
+const implicitMergeRef = "refs/pull/<number>/merge"
+
+var (
+	// untrustedRefSources match the expressions of checkout refs that the
+	// person or event triggering the workflow controls.
+	untrustedRefSources = []struct {
+		source  string
+		pattern *regexp.Regexp
+	}{
+		{refSourceDispatchInput, regexp.MustCompile(`\b(?:github\.event\.)?inputs\.[A-Za-z0-9_-]+`)},
+		{refSourcePullRequest, regexp.MustCompile(`\bgithub\.head_ref\b|\bgithub\.event\.pull_request\.(?:head\.(?:ref|sha)|merge_commit_sha)\b|\brefs/pull/`)},
+		{refSourceDispatchPayload, regexp.MustCompile(`\bgithub\.event\.client_payload\.[A-Za-z0-9_.-]+`)},
+		{refSourceWorkflowRun, regexp.MustCompile(`\bgithub\.event\.workflow_run\.head_(?:branch|sha)\b`)},
+	}
+	// gitCheckoutCommand matches a run command that switches the checked
+	// out commit.
+	gitCheckoutCommand = regexp.MustCompile(`\bgit\s+(?:checkout|switch|fetch|reset)\b`)
+	// rebuildCompare matches commands that verify a promoted build against
+	// its provenance or compare it with a rebuild.
+	rebuildCompare = regexp.MustCompile(`\bdiffoscope\b|\breprotest\b|\bsha256sum\s+(?:-c|--check)\b`)
+	// nonPRTrigger matches events other than pull requests in a workflow's
+	// on: key.
+	nonPRTrigger = regexp.MustCompile(`\b(?:push|release|workflow_dispatch|schedule|workflow_call|workflow_run|repository_dispatch|merge_group)\b`)
+)
+
+// checkoutRef is a checkout of a workflow job: an actions/checkout step
+// with its ref input, or a git command.
+type checkoutRef struct {
+	line int
+	ref  string
+	// command is set for a git run command, whose ref is the command.
+	command bool
+}
+
+// untrustedRefSource returns who chooses a checkout ref, and the
+// expression choosing it, or empty strings for a ref fixed by the trigger.
+func untrustedRefSource(ref string) (source, expression string) {
+	for _, s := range untrustedRefSources {
+		if m := s.pattern.FindString(ref); m != "" {
+			return s.source, m
+		}
+	}
+	return "", ""
+}
+
+// releasesArtifacts reports whether a job publishes artifacts or attests
+// them, so that the ref it builds from ends up in provenance.
+func (j *workflowJob) releasesArtifacts() bool {
+	return j.publishes || j.attestLine != 0
+}
+
+// reportCheckoutRefs flags the checkouts of release jobs whose ref comes
+// from event inputs, a pull request, or a dispatch payload, and checkouts
+// without a ref in workflows that only run on pull requests, which build
+// the merge ref. Workflows that verify or compare what they promote rebuild
+// from a trusted ref elsewhere and are skipped.
+func (w *workflowTracker) reportCheckoutRefs(findings *findingSet, filePath string) {
+	if w.compares {
+		return
+	}
+	for _, j := range w.jobs {
+		if !j.releasesArtifacts() {
+			continue
+		}
+		for _, c := range j.checkouts {
+			source, expression := untrustedRefSource(c.ref)
+			if source == "" && !c.command && c.ref == "" && w.prTrigger != "" && !w.otherTrigger {
+				source, expression = refSourceMergeRef, implicitMergeRef
+			}
+			if source == "" {
+				continue
+			}
+			findings.Finding(
+				untrustedRefRuleID,
+				sdk.SeverityMedium,
+				sdk.ConfidenceMedium,
+				fmt.Sprintf("Release job %s builds from %s, which the trigger chooses rather than the tag or commit being released", j.name, expression),
+			).
+				At(filePath, c.line, c.line).
+				WithMetadata("type", "untrusted_checkout_ref").
+				WithMetadata("job", j.name).
+				WithMetadata("ref", strings.TrimSpace(c.ref)).
+				WithMetadata("ref_expression", expression).
+				WithMetadata("ref_source", source).
+				Done()
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUntrustedRefSource(t *testing.T) {
+	tests := []struct {
+		ref        string
+		source     string
+		expression string
+	}{
+		{"${{ github.event.inputs.ref }}", refSourceDispatchInput, "github.event.inputs.ref"},
+		{"${{ inputs.tag }}", refSourceDispatchInput, "inputs.tag"},
+		{"${{ github.event.pull_request.head.sha }}", refSourcePullRequest, "github.event.pull_request.head.sha"},
+		{"refs/pull/${{ github.event.number }}/merge", refSourcePullRequest, "refs/pull/"},
+		{"${{ github.event.client_payload.sha }}", refSourceDispatchPayload, "github.event.client_payload.sha"},
+		{"${{ github.event.workflow_run.head_sha }}", refSourceWorkflowRun, "github.event.workflow_run.head_sha"},
+		{"${{ github.sha }}", "", ""},
+		{"${{ github.ref_name }}", "", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		source, expression := untrustedRefSource(tt.ref)
+		if source != tt.source || expression != tt.expression {
+			t.Errorf("untrustedRefSource(%q) = %q, %q, want %q, %q", tt.ref, source, expression, tt.source, tt.expression)
+		}
+	}
+}
+
+func TestScanUntrustedCheckoutRef(t *testing.T) {
+	workspace := t.TempDir()
+	workflows := filepath.Join(workspace, ".github", "workflows")
+	writeFile(t, filepath.Join(workflows, "dispatch.yml"), strings.Join([]string{
+		"on:",
+		"  workflow_dispatch:",
+		"    inputs:",
+		"      ref:",
+		"        required: true",
+		"jobs:",
+		"  release:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - uses: actions/checkout@v4",
+		"        with:",
+		"          ref: ${{ github.event.inputs.ref }}",
+		"      - run: make dist",
+		"      - uses: softprops/action-gh-release@v2",
+		"        with:",
+		"          files: dist/*",
+		"  docs:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - uses: actions/checkout@v4",
+		"        with:",
+		"          ref: ${{ inputs.ref }}",
+		"      - run: make docs",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workflows, "preview.yml"), strings.Join([]string{
+		"on: pull_request",
+		"jobs:",
+		"  preview:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - uses: actions/checkout@v4",
+		"      - run: npm publish --tag preview",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workflows, "tag.yml"), strings.Join([]string{
+		"on:",
+		"  push:",
+		"    tags: ['v*']",
+		"jobs:",
+		"  publish:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - uses: actions/checkout@v4",
+		"      - run: npm publish",
+	}, "\n")+"\n")
+	client := testClient(t)
+
+	found := findByRule(invokeScan(t, client, workspace).GetFindings(), untrustedRefRuleID)
+	sources := make(map[string]string)
+	for _, f := range found {
+		sources[f.GetMetadata()["job"]] = f.GetMetadata()["ref_source"]
+	}
+	if len(found) != 2 || sources["release"] != refSourceDispatchInput || sources["preview"] != refSourceMergeRef {
+		t.Fatalf("expected release and preview to be flagged, got %v", sources)
+	}
+	for _, f := range found {
+		if f.GetMetadata()["job"] == "release" && (f.GetLocation().GetStartLine() != 10 || f.GetMetadata()["ref_expression"] != "github.event.inputs.ref") {
+			t.Errorf("release finding at line %d with ref_expression %q", f.GetLocation().GetStartLine(), f.GetMetadata()["ref_expression"])
+		}
+	}
+
+	// Verifying the promoted build against a rebuild makes the dispatch
+	// workflow a promotion rather than a release from an arbitrary ref.
+	writeFile(t, filepath.Join(workflows, "dispatch.yml"), strings.Join([]string{
+		"on: workflow_dispatch",
+		"jobs:",
+		"  release:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - uses: actions/checkout@v4",
+		"        with:",
+		"          ref: ${{ inputs.ref }}",
+		"      - run: make dist && sha256sum --check checksums.txt",
+		"      - run: gh release upload ${{ inputs.ref }} dist/*",
+	}, "\n")+"\n")
+	found = findByRule(invokeScan(t, client, workspace).GetFindings(), untrustedRefRuleID)
+	if len(found) != 1 || found[0].GetMetadata()["job"] != "preview" {
+		t.Errorf("expected only the preview job once the dispatch workflow compares, got %d findings", len(found))
+	}
+}
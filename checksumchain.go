@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// checksumChainRuleID flags breaks in the chain from an artifact through a
+// checksums file to the attestation whose subject is that checksums file:
+// entries whose artifact does not match, and artifacts beside the
+// checksums file that it does not list.
+const checksumChainRuleID = "PROV-045"
+
+var (
+	// checksumEntry matches a sha256sum line, "<digest>  <name>" or
+	// "<digest> *<name>" in binary mode.
+	checksumEntry = regexp.MustCompile(`^([0-9a-fA-F]{64})\s+\*?(.+)$`)
+	// bsdChecksumEntry matches a BSD-style line, "SHA256 (<name>) = <digest>".
+	bsdChecksumEntry = regexp.MustCompile(`^SHA256\s*\((.+)\)\s*=\s*([0-9a-fA-F]{64})$`)
+	// bareChecksum matches a single-artifact checksums file holding only a
+	// digest, such as app.tar.gz.sha256.
+	bareChecksum = regexp.MustCompile(`^([0-9a-fA-F]{64})$`)
+)
+
+// checksumListing is an entry of a checksums file.
+type checksumListing struct {
+	line   int
+	name   string
+	sha256 string
+}
+
+// parseChecksums reads the sha256 entries of a checksums file named name.
+// A file holding a bare digest lists the artifact its name is derived from.
+func parseChecksums(name string, data []byte) []checksumListing {
+	var listings []checksumListing
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		var entry, digest string
+		if m := checksumEntry.FindStringSubmatch(line); m != nil {
+			digest, entry = m[1], m[2]
+		} else if m := bsdChecksumEntry.FindStringSubmatch(line); m != nil {
+			entry, digest = m[1], m[2]
+		} else if m := bareChecksum.FindStringSubmatch(line); m != nil && strings.EqualFold(path.Ext(name), ".sha256") {
+			digest, entry = m[1], strings.TrimSuffix(name, path.Ext(name))
+		} else {
+			continue
+		}
+		listings = append(listings, checksumListing{line: lineNum, name: strings.TrimSpace(entry), sha256: strings.ToLower(digest)})
+	}
+	return listings
+}
+
+// checksumFileOf finds the checksums file a subject names: relative to the
+// attestation's directory, then to the workspace root, then by base name
+// beside the attestation. It returns "" when none is a regular file.
+func checksumFileOf(fsys workspaceFS, root string, subj subjectRecord) string {
+	name := path.Clean(strings.TrimPrefix(slashName(subj.name), "./"))
+	dir := filepath.Dir(subj.location)
+	candidates := []string{filepath.Join(dir, filepath.FromSlash(name))}
+	if resolvable(name) && name != ".." && !strings.HasPrefix(name, "../") {
+		candidates = append(candidates, filepath.Join(root, filepath.FromSlash(name)))
+	}
+	candidates = append(candidates, filepath.Join(dir, path.Base(name)))
+	for _, c := range candidates {
+		if info, err := fsys.Stat(c); err == nil && info.Mode().IsRegular() {
+			return c
+		}
+	}
+	return ""
+}
+
+// verifyChecksumChains follows each subject that names a checksums file
+// present in the workspace. A checksums file matching its subject vouches
+// for the artifacts it lists: each present artifact is verified against its
+// entry and, once matching, counts as covered by the attestation, so the
+// pairing check does not report it as unattested. Release artifacts beside
+// the checksums file that it does not list are reported at Low severity.
+// Subjects whose checksums file does not match are reported as in the
+// archive subject check and vouch for nothing.
+func verifyChecksumChains(ctx context.Context, findings *findingSet, summary *scanSummary, maxFileSize int64) error {
+	root := findings.root
+	followed := make(map[string]bool)
+	for i := range summary.subjectRecords {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		subj := &summary.subjectRecords[i]
+		if subj.archive != "" || subj.paired || !checksumFileName.MatchString(path.Base(slashName(subj.name))) {
+			continue
+		}
+		checksums := checksumFileOf(findings.files(), root, *subj)
+		if checksums == "" {
+			continue
+		}
+		digest := fileDigest(findings.files(), checksums, maxFileSize)
+		if digest == "" {
+			continue
+		}
+		subj.paired = true
+		if digest != subj.sha256 {
+			reportChecksumSubjectMismatch(findings, *subj, checksums, digest)
+			continue
+		}
+		summary.subjectsVerified++
+		if followed[checksums] {
+			continue
+		}
+		followed[checksums] = true
+		data, err := findings.files().ReadFile(checksums)
+		if err != nil {
+			continue
+		}
+		followChecksums(findings, summary, checksums, parseChecksums(filepath.Base(checksums), data), *subj, maxFileSize)
+	}
+	return nil
+}
+
+// followChecksums verifies the artifacts a checksums file lists and looks
+// for artifacts beside it that it does not.
+func followChecksums(findings *findingSet, summary *scanSummary, checksums string, listings []checksumListing, subj subjectRecord, maxFileSize int64) {
+	root := findings.root
+	dir := filepath.Dir(checksums)
+	listed := make(map[string]bool, len(listings))
+	for _, l := range listings {
+		name := path.Clean(strings.TrimPrefix(slashName(l.name), "./"))
+		if !resolvable(name) || name == ".." || strings.HasPrefix(name, "../") {
+			continue
+		}
+		artifact := filepath.Join(dir, filepath.FromSlash(name))
+		listed[artifact] = true
+		digest := fileDigest(findings.files(), artifact, maxFileSize)
+		switch digest {
+		case "":
+			// Not on disk, or too large to hash.
+			continue
+		case l.sha256:
+			summary.checksumArtifactsVerified++
+			if summary.checksumCovered == nil {
+				summary.checksumCovered = make(map[string]bool)
+			}
+			summary.checksumCovered[workspacePath(root, artifact)] = true
+			continue
+		}
+		findings.Finding(
+			checksumChainRuleID,
+			sdk.SeverityHigh,
+			sdk.ConfidenceHigh,
+			fmt.Sprintf("Artifact %s does not match its entry in attested checksums file %s", workspacePath(root, artifact), workspacePath(root, checksums)),
+		).
+			At(checksums, l.line, l.line).
+			WithMetadata("type", "checksum_entry_mismatch").
+			WithMetadata("artifact", workspacePath(root, artifact)).
+			WithMetadata("checksum_digest", "sha256:"+l.sha256).
+			WithMetadata("artifact_digest", "sha256:"+digest).
+			WithMetadata("attestation", workspacePath(root, subj.location)).
+			Done()
+	}
+
+	entries, err := findings.files().ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		artifact := filepath.Join(dir, e.Name())
+		if !e.Type().IsRegular() || artifactExt(e.Name()) == "" || listed[artifact] || checksumFileName.MatchString(e.Name()) {
+			continue
+		}
+		findings.Finding(
+			checksumChainRuleID,
+			sdk.SeverityLow,
+			sdk.ConfidenceMedium,
+			fmt.Sprintf("Artifact %s is not listed in attested checksums file %s", workspacePath(root, artifact), workspacePath(root, checksums)),
+		).
+			At(artifact, 0, 0).
+			WithMetadata("type", "artifact_not_in_checksums").
+			WithMetadata("artifact", workspacePath(root, artifact)).
+			WithMetadata("checksums_file", workspacePath(root, checksums)).
+			WithMetadata("attestation", workspacePath(root, subj.location)).
+			Done()
+	}
+}
+
+// reportChecksumSubjectMismatch flags a subject whose checksums file does
+// not match it, as the archive subject check would.
+func reportChecksumSubjectMismatch(findings *findingSet, subj subjectRecord, checksums, digest string) {
+	fb := findings.Finding(
+		subjectDigestMismatchRuleID,
+		sdk.SeverityHigh,
+		sdk.ConfidenceHigh,
+		fmt.Sprintf("Attestation subject %s does not match the sha256 digest of its artifact", subj.name),
+	).
+		At(subj.location, subj.line, subj.line).
+		WithMetadata("type", "subject_digest_mismatch").
+		WithMetadata("subject", subj.name).
+		WithMetadata("subject_digest", "sha256:"+subj.sha256).
+		WithMetadata("artifact", workspacePath(findings.root, checksums)).
+		WithMetadata("artifact_digest", "sha256:"+digest)
+	if subj.index >= 0 {
+		fb.WithMetadata("statement_index", strconv.Itoa(subj.index))
+	}
+	if subj.builder != "" {
+		fb.WithMetadata("builder_id", subj.builder)
+	}
+	fb.Done()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseChecksums(t *testing.T) {
+	const digest = "d35c3f79ed151c242c87477b4f0c1e9c712022812747786cf6164d2a78afc393"
+	data := strings.Join([]string{
+		digest + "  app.deb",
+		strings.ToUpper(digest) + " *bin/app.exe",
+		"SHA256 (app.rpm) = " + digest,
+		"# comment",
+		"md5  app.zip",
+	}, "\n")
+	want := []checksumListing{
+		{1, "app.deb", digest},
+		{2, "bin/app.exe", digest},
+		{3, "app.rpm", digest},
+	}
+	if got := parseChecksums("checksums.txt", []byte(data)); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseChecksums = %+v, want %+v", got, want)
+	}
+	if got := parseChecksums("app.tar.gz.sha256", []byte(digest+"\n")); len(got) != 1 || got[0].name != "app.tar.gz" {
+		t.Errorf("bare digest: got %+v", got)
+	}
+	if got := parseChecksums("checksums.txt", []byte(digest+"\n")); len(got) != 0 {
+		t.Errorf("bare digest outside a .sha256 file: got %+v", got)
+	}
+}
+
+func TestScanChecksumChain(t *testing.T) {
+	workspace := t.TempDir()
+	dist := filepath.Join(workspace, "dist")
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n")
+	writeFile(t, filepath.Join(dist, "app.deb"), "deb")
+	writeFile(t, filepath.Join(dist, "app.rpm"), "tampered rpm")
+	writeFile(t, filepath.Join(dist, "tool.deb"), "tool")
+	checksums := sha256Hex([]byte("deb")) + "  app.deb\n" + sha256Hex([]byte("rpm")) + "  app.rpm\n"
+	writeFile(t, filepath.Join(dist, "checksums.txt"), checksums)
+	writeFile(t, filepath.Join(dist, "multiple.intoto.jsonl"), subjectStatement("checksums.txt", sha256Hex([]byte(checksums)))+"\n")
+	// A per-artifact attestation establishes the naming convention for
+	// .deb files, which the checksums file satisfies for app.deb.
+	writeFile(t, filepath.Join(dist, "tool.deb.intoto.jsonl"), subjectStatement("tool.deb", sha256Hex([]byte("tool")))+"\n")
+	client := testClient(t)
+
+	resp := invokeScan(t, client, workspace)
+	found := findByRule(resp.GetFindings(), checksumChainRuleID)
+	if len(found) != 2 {
+		t.Fatalf("expected two %s findings, got %d", checksumChainRuleID, len(found))
+	}
+	for _, f := range found {
+		meta := f.GetMetadata()
+		switch meta["artifact"] {
+		case "dist/app.rpm":
+			if meta["type"] != "checksum_entry_mismatch" || f.GetLocation().GetStartLine() != 2 || severityNames[f.GetSeverity()] != "high" {
+				t.Errorf("unexpected finding %v at line %d", meta, f.GetLocation().GetStartLine())
+			}
+		case "dist/tool.deb":
+			if meta["type"] != "artifact_not_in_checksums" || severityNames[f.GetSeverity()] != "low" {
+				t.Errorf("unexpected finding %v", meta)
+			}
+		default:
+			t.Errorf("unexpected finding for %s", meta["artifact"])
+		}
+	}
+	for _, f := range findByRule(resp.GetFindings(), attestationPairRuleID) {
+		if f.GetMetadata()["artifact"] == "dist/app.deb" {
+			t.Errorf("expected app.deb to be covered by the checksums file, got %s", f.GetMessage())
+		}
+	}
+	summary := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if summary["checksum_artifacts_verified"] != "1" || summary["subjects_verified"] != "2" {
+		t.Errorf("checksum_artifacts_verified = %s, subjects_verified = %s", summary["checksum_artifacts_verified"], summary["subjects_verified"])
+	}
+
+	// A checksums file that does not match its subject vouches for nothing.
+	writeFile(t, filepath.Join(dist, "checksums.txt"), checksums+sha256Hex([]byte("tool"))+"  tool.deb\n")
+	resp = invokeScan(t, client, workspace)
+	if found := findByRule(resp.GetFindings(), checksumChainRuleID); len(found) != 0 {
+		t.Errorf("expected no %s findings for a checksums file that does not match its subject, got %d", checksumChainRuleID, len(found))
+	}
+	if found := findByRule(resp.GetFindings(), subjectDigestMismatchRuleID); len(found) != 1 || found[0].GetMetadata()["artifact"] != "dist/checksums.txt" {
+		t.Errorf("expected a %s finding for checksums.txt, got %d", subjectDigestMismatchRuleID, len(found))
+	}
+}
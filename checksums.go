@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// checksumRuleID flags release mechanisms that publish artifacts without
+// checksums, when the workspace generates no attestations either.
+const checksumRuleID = "PROV-036"
+
+// Release mechanisms a checksum gap is reported for, besides the npm and
+// pypi publish kinds.
+const (
+	mechanismGoReleaser    = "goreleaser"
+	mechanismGitHubRelease = publishGitHubRelease
+)
+
+var (
+	// checksumFileName matches release files that carry checksums, such as
+	// checksums.txt, SHA256SUMS, or app.tar.gz.sha256.
+	checksumFileName = regexp.MustCompile(`(?i)checksums?\b|sha(?:1|224|256|384|512)sums|\.(?:sha(?:1|224|256|384|512)|md5)(?:\b|$)`)
+	// checksumCommand matches commands that compute a checksum manifest.
+	checksumCommand = regexp.MustCompile(`\b(?:sha(?:1|224|256|384|512)sum|shasum|b2sum|md5sum)\b|\bopenssl\s+dgst\b|\bGet-FileHash\b`)
+	// attestationCommand matches commands that generate attestations:
+	// cosign attest and npm publish --provenance.
+	attestationCommand = regexp.MustCompile(`\bcosign\s+attest(?:-blob)?\b|\bnpm\s+publish\b.*--provenance(?:=true)?(?:\s|$)`)
+	// ghRelease matches a gh release command that can upload files, and
+	// captures its arguments.
+	ghRelease = regexp.MustCompile(`\bgh\s+release\s+(upload|create)\s+(.*)`)
+	// shellWord matches a word of a command, keeping quoted strings whole.
+	shellWord = regexp.MustCompile(`"[^"]*"|'[^']*'|\S+`)
+	// ghReleaseValueFlags are the gh release flags that take a value.
+	ghReleaseValueFlags = map[string]bool{
+		"-n": true, "--notes": true, "-F": true, "--notes-file": true, "-t": true, "--title": true,
+		"-R": true, "--repo": true, "--target": true, "--discussion-category": true, "--notes-start-tag": true,
+	}
+	// releaseFileInputs are the inputs naming the files of each release
+	// action.
+	releaseFileInputs = map[string]string{
+		"softprops/action-gh-release":     "files",
+		"svenstaro/upload-release-action": "file",
+		"ncipollo/release-action":         "artifacts",
+	}
+)
+
+// releaseUpload is a release action step of a workflow job.
+type releaseUpload struct {
+	line   int
+	action string
+	files  []string
+	// draft is set when the step creates the release as a draft.
+	draft bool
+}
+
+// newReleaseUpload reads a release action step from its inputs. Files may
+// be listed one per line or separated by commas.
+func newReleaseUpload(s *workflowStep) releaseUpload {
+	u := releaseUpload{line: s.line, action: s.action, draft: strings.EqualFold(s.inputs["draft"], "true")}
+	for _, item := range inputList(s.inputs[releaseFileInputs[s.action]]) {
+		for _, f := range strings.Split(item, ",") {
+			if f = strings.Trim(strings.TrimSpace(f), `"'`); f != "" {
+				u.files = append(u.files, f)
+			}
+		}
+	}
+	return u
+}
+
+// ghReleaseFiles returns the files a gh release upload or create command
+// uploads: its positional arguments after the tag, without any #label
+// suffix.
+func ghReleaseFiles(command string) []string {
+	m := ghRelease.FindStringSubmatch(command)
+	if m == nil {
+		return nil
+	}
+	var files []string
+	tag := false
+	// Expressions contain spaces, so they are collapsed before the command
+	// is split into words.
+	words := shellWord.FindAllString(keyExpression.ReplaceAllLiteralString(m[2], "${{}}"), -1)
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if commandSeparator.MatchString(w) && !strings.ContainsAny(w, `"'`) {
+			break
+		}
+		if strings.HasPrefix(w, "-") {
+			if ghReleaseValueFlags[w] {
+				i++
+			}
+			continue
+		}
+		if !tag {
+			tag = true
+			continue
+		}
+		f, _, _ := strings.Cut(strings.Trim(w, `"'`), "#")
+		files = append(files, f)
+	}
+	return files
+}
+
+// shellVariable matches a shell variable reference.
+var shellVariable = regexp.MustCompile(`\$\{?\w+\}?`)
+
+// dynamicFiles reports whether an upload takes any of its files wholly from
+// an expression or variable, so what it uploads is unknown.
+func dynamicFiles(files []string) bool {
+	for _, f := range files {
+		if shellVariable.ReplaceAllString(keyExpression.ReplaceAllString(f, ""), "") == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checksumsCovered reports whether an upload's file list publishes
+// checksums: it names a checksum file, or a glob picks up the checksums
+// the same config generates.
+func checksumsCovered(files []string, generates bool) bool {
+	for _, f := range files {
+		if checksumFileName.MatchString(path.Base(f)) {
+			return true
+		}
+		if generates && strings.ContainsAny(f, "*?") {
+			return true
+		}
+	}
+	return false
+}
+
+// checksumGap is a release mechanism that publishes no checksums.
+type checksumGap struct {
+	path      string
+	line      int
+	mechanism string
+	missing   string
+	severity  pluginv1.Severity
+	// step is the release command or action, and files what it uploads.
+	step  string
+	files []string
+}
+
+// checksumTracker follows a build or CI config for its release mechanisms
+// and whether they publish checksums.
+type checksumTracker struct {
+	goreleaser  bool
+	inChecksum  bool
+	disableLine int
+	// generates is set when any command of the config computes checksums.
+	generates bool
+	uploads   []checksumGap
+	publishes []publishStep
+}
+
+// isGoReleaserConfig reports whether a base name is a goreleaser config.
+func isGoReleaserConfig(name string) bool {
+	return name == ".goreleaser.yml" || name == ".goreleaser.yaml"
+}
+
+// add reads the next line of the config, with its context and command as
+// classified.
+func (c *checksumTracker) add(summary *scanSummary, filePath string, lineNum int, line string, lc lineContext, command string) {
+	if lc == contextComment || lc == contextEcho || lc == contextHeredoc {
+		return
+	}
+	if m := usesKey.FindStringSubmatch(strings.TrimSpace(line)); m != nil && isAttestationAction(m[1]) {
+		summary.attestationSteps++
+	}
+	if containsAny(line, "cosign", "npm") && attestationCommand.MatchString(line) {
+		summary.attestationSteps++
+	}
+	if c.goreleaser {
+		c.trackGoReleaser(lineNum, line)
+	}
+	if command == "" {
+		command = line
+	}
+	if containsAny(command, "sum", "dgst", "Get-FileHash") && checksumCommand.MatchString(command) {
+		c.generates = true
+	}
+	if files := ghReleaseFiles(command); len(files) > 0 {
+		c.uploads = append(c.uploads, checksumGap{
+			path: filePath, line: lineNum, mechanism: mechanismGitHubRelease, step: "gh release", files: files,
+		})
+	}
+	for _, step := range publishStepsOf(filePath, lineNum, command, isASCII(command)) {
+		if step.kind == publishNPM || step.kind == publishPyPI {
+			c.publishes = append(c.publishes, step)
+		}
+	}
+}
+
+// trackGoReleaser reads a line of a goreleaser config, noting a top-level
+// checksum section that sets disable: true.
+func (c *checksumTracker) trackGoReleaser(lineNum int, line string) {
+	trimmed := strings.TrimSpace(line)
+	key := yamlKey.FindStringSubmatch(trimmed)
+	if key == nil {
+		return
+	}
+	if line[0] != ' ' && line[0] != '\t' {
+		c.inChecksum = key[1] == "checksum"
+		return
+	}
+	if c.inChecksum && key[1] == "disable" && yamlScalar(strings.TrimSpace(trimmed[len(key[0]):])) == "true" {
+		c.disableLine = lineNum
+	}
+}
+
+// finish records the config's checksum gaps in summary, including those of
+// the workflow's release actions, if any.
+func (c *checksumTracker) finish(summary *scanSummary, filePath string, workflow *workflowTracker) {
+	if c.disableLine > 0 {
+		summary.checksumGaps = append(summary.checksumGaps, checksumGap{
+			path: filePath, line: c.disableLine, mechanism: mechanismGoReleaser, severity: sdk.SeverityMedium,
+			missing: "checksum.disable is true, so the release carries no checksums file",
+		})
+	}
+	uploads := c.uploads
+	if workflow != nil {
+		for _, j := range workflow.jobs {
+			for _, u := range j.releaseUploads {
+				if len(u.files) == 0 {
+					continue
+				}
+				uploads = append(uploads, checksumGap{
+					path: filePath, line: u.line, mechanism: mechanismGitHubRelease, step: u.action, files: u.files,
+				})
+			}
+		}
+	}
+	for _, u := range uploads {
+		if dynamicFiles(u.files) || checksumsCovered(u.files, c.generates) {
+			continue
+		}
+		u.severity = sdk.SeverityMedium
+		u.missing = "the uploaded files include no checksums file"
+		summary.checksumGaps = append(summary.checksumGaps, u)
+	}
+	if c.generates {
+		return
+	}
+	for _, p := range c.publishes {
+		summary.checksumGaps = append(summary.checksumGaps, checksumGap{
+			path: filePath, line: p.line, mechanism: p.kind, severity: sdk.SeverityLow,
+			missing: "no checksum manifest of the published packages is produced",
+		})
+	}
+}
+
+// reportChecksumGaps flags each recorded release mechanism that publishes no
+// checksums. It is only called when the workspace generates no attestations,
+// which would make checksums redundant.
+func reportChecksumGaps(findings *findingSet, gaps []checksumGap) {
+	for _, g := range gaps {
+		fb := findings.Finding(
+			checksumRuleID,
+			g.severity,
+			sdk.ConfidenceMedium,
+			fmt.Sprintf("Release via %s publishes no checksums: %s", g.mechanism, g.missing),
+		).
+			At(g.path, g.line, g.line).
+			WithMetadata("type", "missing_checksums").
+			WithMetadata("mechanism", g.mechanism).
+			WithMetadata("missing", g.missing)
+		if g.step != "" {
+			fb.WithMetadata("release_step", g.step)
+		}
+		if len(g.files) > 0 {
+			fb.WithMetadata("files", strings.Join(g.files, ","))
+		}
+		fb.Done()
+	}
+}
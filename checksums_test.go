@@ -0,0 +1,118 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGHReleaseFiles(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"gh release upload v1.0 dist/app.tar.gz dist/checksums.txt", []string{"dist/app.tar.gz", "dist/checksums.txt"}},
+		{`gh release create "$TAG" --title "Release 1" --notes "fixes" app.zip#Binary`, []string{"app.zip"}},
+		{"gh release create ${{ github.ref_name }} --generate-notes", nil},
+		{"gh release upload ${{ github.ref_name }} out/*.tgz && echo done", []string{"out/*.tgz"}},
+		{"gh release view v1.0", nil},
+	}
+	for _, tt := range tests {
+		if got := ghReleaseFiles(tt.command); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ghReleaseFiles(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestChecksumsCovered(t *testing.T) {
+	tests := []struct {
+		files     []string
+		generates bool
+		want      bool
+	}{
+		{[]string{"dist/app.tar.gz", "dist/SHA256SUMS"}, false, true},
+		{[]string{"app.tar.gz", "app.tar.gz.sha256"}, false, true},
+		{[]string{"dist/checksums.txt"}, false, true},
+		{[]string{"dist/app.tar.gz"}, true, false},
+		{[]string{"dist/*"}, true, true},
+		{[]string{"dist/*"}, false, false},
+	}
+	for _, tt := range tests {
+		if got := checksumsCovered(tt.files, tt.generates); got != tt.want {
+			t.Errorf("checksumsCovered(%q, %v) = %v, want %v", tt.files, tt.generates, got, tt.want)
+		}
+	}
+}
+
+func TestScanMissingChecksums(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".goreleaser.yml"), strings.Join([]string{
+		"builds:",
+		"  - binary: app",
+		"checksum:",
+		"  disable: true",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), strings.Join([]string{
+		"on:",
+		"  push:",
+		"    tags: ['v*']",
+		"jobs:",
+		"  release:",
+		"    steps:",
+		"      - run: make dist",
+		"      - uses: softprops/action-gh-release@v2",
+		"        with:",
+		"          files: |",
+		"            dist/app-linux.tar.gz",
+		"            dist/app-darwin.tar.gz",
+		"      - run: gh release upload ${{ github.ref_name }} dist/app.zip dist/app.zip.sha256",
+		"      - run: npm publish",
+		"  docs:",
+		"    steps:",
+		"      - uses: softprops/action-gh-release@v2",
+		"        with:",
+		"          files: ${{ steps.docs.outputs.files }}",
+	}, "\n")+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	got := make(map[string]map[string]string)
+	for _, f := range findByRule(resp.GetFindings(), checksumRuleID) {
+		meta := f.GetMetadata()
+		meta["severity"] = severityNames[f.GetSeverity()]
+		got[meta["mechanism"]+":"+f.GetLocation().GetFilePath()] = meta
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected three %s findings, got %v", checksumRuleID, got)
+	}
+	if meta := got["goreleaser:.goreleaser.yml"]; meta["type"] != "missing_checksums" || meta["severity"] != "medium" {
+		t.Errorf("unexpected goreleaser finding: %v", meta)
+	}
+	if meta := got["github-release:.github/workflows/release.yml"]; meta["release_step"] != "softprops/action-gh-release" ||
+		meta["files"] != "dist/app-linux.tar.gz,dist/app-darwin.tar.gz" || meta["severity"] != "medium" {
+		t.Errorf("unexpected release upload finding: %v", meta)
+	}
+	if meta := got["npm:.github/workflows/release.yml"]; meta["severity"] != "low" {
+		t.Errorf("unexpected npm finding: %v", meta)
+	}
+}
+
+func TestScanMissingChecksumsSuppressedByAttestation(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".goreleaser.yaml"), "checksum:\n  disable: true\n")
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), strings.Join([]string{
+		"on: release",
+		"jobs:",
+		"  release:",
+		"    steps:",
+		"      - run: gh release upload v1 dist/app.tar.gz",
+		"      - uses: actions/attest-build-provenance@v2",
+	}, "\n")+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	if gaps := findByRule(resp.GetFindings(), checksumRuleID); len(gaps) != 0 {
+		t.Errorf("expected no %s findings when attestations are generated, got %d", checksumRuleID, len(gaps))
+	}
+}
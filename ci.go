@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// missingCIRuleID flags a workspace that has build configuration but no CI
+// system, so its artifacts are presumably built on developer machines.
+const missingCIRuleID = "PROV-020"
+
+// ciSystemFiles lists base names that show a CI system builds the workspace
+// without being CI configs the plugin analyzes.
+var ciSystemFiles = map[string]bool{
+	"Jenkinsfile":             true,
+	"cloudbuild.yaml":         true,
+	"cloudbuild.json":         true,
+	".travis.yml":             true,
+	"bitbucket-pipelines.yml": true,
+	".drone.yml":              true,
+	"appveyor.yml":            true,
+	".appveyor.yml":           true,
+}
+
+// maxListedBuildConfigs caps the build configs named in PROV-020 metadata.
+const maxListedBuildConfigs = 20
+
+// buildConfigRef is a build config found during the walk.
+type buildConfigRef struct {
+	path string
+	// rel is the workspace-relative slash path.
+	rel string
+}
+
+// primaryBuildConfig returns the build config a workspace-level finding is
+// anchored at: the shallowest, then the first by path.
+func primaryBuildConfig(configs []buildConfigRef) buildConfigRef {
+	sorted := append([]buildConfigRef(nil), configs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		di, dj := strings.Count(sorted[i].rel, "/"), strings.Count(sorted[j].rel, "/")
+		if di != dj {
+			return di < dj
+		}
+		return sorted[i].rel < sorted[j].rel
+	})
+	return sorted[0]
+}
+
+// reportMissingCI flags a workspace with build configuration but no CI
+// configuration, anchored at its primary build config.
+func reportMissingCI(findings *findingSet, configs []buildConfigRef) {
+	primary := primaryBuildConfig(configs)
+
+	rels := make([]string, len(configs))
+	for i, c := range configs {
+		rels[i] = c.rel
+	}
+	sort.Strings(rels)
+	if len(rels) > maxListedBuildConfigs {
+		rels = rels[:maxListedBuildConfigs]
+	}
+
+	findings.Finding(
+		missingCIRuleID,
+		sdk.SeverityMedium,
+		sdk.ConfidenceMedium,
+		"Build configuration found but no CI configuration; artifacts may be built outside any CI system",
+	).
+		At(primary.path, 0, 0).
+		WithMetadata("type", "missing_ci").
+		WithMetadata("build_configs", strings.Join(rels, ",")).
+		WithMetadata("build_config_count", strconv.Itoa(len(configs))).
+		Done()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestScanMissingCI(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		disabled bool
+		want     int
+	}{
+		{"build configs without CI", map[string]string{"Makefile": "build:\n", "docker/Dockerfile": "FROM scratch\n"}, false, 1},
+		{"no build config", map[string]string{"main.go": "package main\n"}, false, 0},
+		{"github workflow", map[string]string{"Makefile": "build:\n", ".github/workflows/ci.yml": "on: push\n"}, false, 0},
+		{"jenkinsfile", map[string]string{"Makefile": "build:\n", "Jenkinsfile": "pipeline {}\n"}, false, 0},
+		{"travis", map[string]string{"Makefile": "build:\n", ".travis.yml": "language: go\n"}, false, 0},
+		{"disabled", map[string]string{"Makefile": "build:\n"}, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			for name, content := range tt.files {
+				writeFile(t, filepath.Join(workspace, name), content)
+			}
+
+			resp := invokeScanWithInput(t, testClient(t), map[string]any{
+				"workspace_root": workspace,
+				"check_ci":       !tt.disabled,
+			})
+
+			found := findByRule(resp.GetFindings(), missingCIRuleID)
+			if len(found) != tt.want {
+				t.Fatalf("expected %d %s findings, got %d", tt.want, missingCIRuleID, len(found))
+			}
+			if len(found) == 0 {
+				return
+			}
+			if got := found[0].GetLocation().GetFilePath(); got != "Makefile" {
+				t.Errorf("expected the finding at the root Makefile, got %q", got)
+			}
+			if got := found[0].GetMetadata()["build_configs"]; got != "Makefile,docker/Dockerfile" {
+				t.Errorf("build_configs = %q", got)
+			}
+			if len(findByRule(resp.GetFindings(), "PROV-001")) != 1 {
+				t.Error("expected PROV-001 alongside the missing CI finding")
+			}
+		})
+	}
+}
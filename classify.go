@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// globMatcher matches slash-separated names against a fixed set of glob
+// patterns. Literal patterns and patterns with a single '*' are answered with
+// map lookups and prefix/suffix checks; anything else falls back to
+// path.Match. Classification runs for every walked file, so this avoids
+// re-interpreting each pattern per file.
+type globMatcher struct {
+	exact   map[string]bool
+	affixes []affixPattern
+	globs   []string
+}
+
+// affixPattern is a glob of the form prefix*suffix. As with path.Match, the
+// '*' does not match '/'.
+type affixPattern struct {
+	prefix, suffix string
+}
+
+// newGlobMatcher compiles patterns, which must be valid path.Match globs.
+func newGlobMatcher(patterns []string) *globMatcher {
+	m := &globMatcher{exact: make(map[string]bool)}
+	for _, pattern := range patterns {
+		star := strings.IndexByte(pattern, '*')
+		switch {
+		case !strings.ContainsAny(pattern, `*?[\`):
+			m.exact[pattern] = true
+		case star >= 0 && !strings.ContainsAny(pattern[:star]+pattern[star+1:], `*?[\`):
+			m.affixes = append(m.affixes, affixPattern{prefix: pattern[:star], suffix: pattern[star+1:]})
+		default:
+			m.globs = append(m.globs, pattern)
+		}
+	}
+	return m
+}
+
+// match reports whether name matches any pattern.
+func (m *globMatcher) match(name string) bool {
+	if m.exact[name] {
+		return true
+	}
+	for _, a := range m.affixes {
+		if len(name) >= len(a.prefix)+len(a.suffix) &&
+			strings.HasPrefix(name, a.prefix) &&
+			strings.HasSuffix(name, a.suffix) &&
+			!strings.Contains(name[len(a.prefix):len(name)-len(a.suffix)], "/") {
+			return true
+		}
+	}
+	for _, glob := range m.globs {
+		if matched, _ := path.Match(glob, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Compiled form of ciConfigPatterns.
+var ciConfigMatcher = newGlobMatcher(ciConfigPatterns)
+
+// provenanceMatcher decides which files are provenance candidates from their
+// workspace-relative slash paths. It combines three kinds of rule: globs on
+// the base name, such as *.intoto.jsonl; globs on the whole path, in which a
+// ** segment spans any number of directories, such as
+// .github/attestations/*.sigstore; and directory rules, which take any JSON
+// or JSONL file anywhere beneath a directory of a given name. Name and path
+// globs match case-insensitively; directory names match exactly.
+type provenanceMatcher struct {
+	names *globMatcher
+	paths [][]string
+	dirs  map[string]bool
+}
+
+// provenanceDirExts are the extensions a file beneath a provenance directory
+// must have.
+var provenanceDirExts = map[string]bool{".json": true, ".jsonl": true}
+
+// newProvenanceMatcher compiles patterns, each a base name glob or, when it
+// contains a '/', a path glob, along with directory rules for dirs.
+func newProvenanceMatcher(patterns, dirs []string) (*provenanceMatcher, error) {
+	m := &provenanceMatcher{dirs: make(map[string]bool, len(dirs))}
+	var names []string
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if !strings.Contains(pattern, "/") {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			names = append(names, pattern)
+			continue
+		}
+		segments := strings.Split(strings.TrimPrefix(pattern, "./"), "/")
+		for _, seg := range segments {
+			if seg == "" || seg == "." || seg == ".." {
+				return nil, fmt.Errorf("invalid pattern %q: must be a clean workspace-relative path", pattern)
+			}
+			if _, err := path.Match(seg, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+		m.paths = append(m.paths, segments)
+	}
+	m.names = newGlobMatcher(names)
+	for _, dir := range dirs {
+		m.dirs[dir] = true
+	}
+	return m, nil
+}
+
+// defaultProvenanceMatcher applies provenanceFilePatterns and provenanceDirs.
+var defaultProvenanceMatcher = mustProvenanceMatcher(provenanceFilePatterns, provenanceDirs)
+
+// mustProvenanceMatcher is newProvenanceMatcher for built-in patterns.
+func mustProvenanceMatcher(patterns, dirs []string) *provenanceMatcher {
+	m, err := newProvenanceMatcher(patterns, dirs)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// match reports whether the file at the workspace-relative slash path rel is
+// a provenance candidate.
+func (m *provenanceMatcher) match(rel string) bool {
+	dir, name := "", rel
+	if i := strings.LastIndexByte(rel, '/'); i >= 0 {
+		dir, name = rel[:i], rel[i+1:]
+	}
+	if m.names.match(strings.ToLower(name)) {
+		return true
+	}
+	if len(m.paths) > 0 {
+		segments := strings.Split(strings.ToLower(rel), "/")
+		for _, pattern := range m.paths {
+			if matchSegments(pattern, segments) {
+				return true
+			}
+		}
+	}
+	if dir == "" || len(m.dirs) == 0 || !provenanceDirExts[strings.ToLower(path.Ext(name))] {
+		return false
+	}
+	for _, d := range strings.Split(dir, "/") {
+		if m.dirs[d] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments reports whether path segments match pattern segments, where
+// a "**" pattern segment matches zero or more path segments.
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"path"
+	"testing"
+)
+
+func TestGlobMatcherAgreesWithPathMatch(t *testing.T) {
+	patterns := append(append([]string{"a?c.json", "[xy].yml"}, provenanceFilePatterns...), ciConfigPatterns...)
+	m := newGlobMatcher(patterns)
+
+	names := []string{
+		"provenance.json",
+		"app.intoto.jsonl",
+		".intoto.json",
+		"dir/app.intoto.json",
+		"release.provenance.json",
+		"attestation.json",
+		"attestation.json.bak",
+		"x.att.json",
+		".github/workflows/release.yml",
+		".github/workflows/nested/release.yml",
+		".github/workflows/release.yaml",
+		".gitlab-ci.yml",
+		"sub/.gitlab-ci.yml",
+		".circleci/config.yml",
+		"abc.json",
+		"x.yml",
+		"z.yml",
+		"Makefile",
+	}
+	for _, name := range names {
+		want := false
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, name); matched {
+				want = true
+				break
+			}
+		}
+		if got := m.match(name); got != want {
+			t.Errorf("match(%q) = %v, path.Match says %v", name, got, want)
+		}
+	}
+}
+
+func TestProvenanceMatcher(t *testing.T) {
+	extra := []string{"*_provenance.json", ".github/attestations/*.sigstore", "release/**/*.bundle"}
+	m := mustProvenanceMatcher(append(append([]string{}, provenanceFilePatterns...), extra...), provenanceDirs)
+
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		// Default base name patterns, at any depth and in any case.
+		{"build.intoto.jsonl", true},
+		{"app.intoto.json", true},
+		{"dist/app.intoto.json", true},
+		{"release.provenance.json", true},
+		{"provenance.json", true},
+		{"attestation.json", true},
+		{"release.att.json", true},
+		{"npm/pkg.publish.attestation", true},
+		{"Build.INTOTO.jsonl", true},
+		{"attestation.json.bak", false},
+		{"package.json", false},
+		{"main.go", false},
+		{"Makefile", false},
+		// Directory rules.
+		{"attestations/build-123.json", true},
+		{"ci/.slsa/nested/build.jsonl", true},
+		{"attestations/README.md", false},
+		{"Attestations/build.json", false},
+		{"attestations.json", false},
+		// Extra base name and path globs.
+		{"dist/app_1.0_linux_amd64_provenance.json", true},
+		{".github/attestations/app.sigstore", true},
+		{".GitHub/attestations/app.sigstore", true},
+		{"app.sigstore", false},
+		{"sub/.github/attestations/app.sigstore", false},
+		{".github/attestations/v1/app.sigstore", false},
+		{"release/app.bundle", true},
+		{"release/v1/linux/app.bundle", true},
+		{"dist/release/app.bundle", false},
+	}
+	for _, tt := range tests {
+		if got := m.match(tt.rel); got != tt.want {
+			t.Errorf("match(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"[", "/abs/*.json", "a//b.json", "../up/*.json", "dir/[x"} {
+		if _, err := newProvenanceMatcher([]string{bad}, nil); err == nil {
+			t.Errorf("newProvenanceMatcher(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestClassifyFile(t *testing.T) {
+	provenance := mustProvenanceMatcher(provenanceFilePatterns, []string{"attestations"})
+
+	tests := []struct {
+		rel  string
+		want fileKind
+	}{
+		{"cmd/server/main.go", 0},
+		{"release/app.intoto.jsonl", kindProvenance},
+		{"attestations/build-123.json", kindProvenance},
+		{"attestations/README.md", kindVerification},
+		{"deploy/Dockerfile", kindBuildConfig | kindImageSource},
+		{"deploy/compose.yaml", kindImageSource | kindVerification},
+		{".github/workflows/release.yml", kindCIConfig},
+		{".github/workflows/cloudbuild.yaml", kindBuildConfig | kindCIConfig},
+		{".github/actions/setup/action.yml", kindImageSource | kindVerification | kindAction},
+		{"keys/signing.key", kindVerification},
+		{".devcontainer/devcontainer.json", kindDevcontainer},
+	}
+	for _, tt := range tests {
+		if got := classifyFile(tt.rel, path.Base(tt.rel), provenance); got != tt.want {
+			t.Errorf("classifyFile(%q) = %b, want %b", tt.rel, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkClassifyFile(b *testing.B) {
+	paths := []string{
+		"cmd/server/main.go",
+		"internal/store/store_test.go",
+		"README.md",
+		".github/workflows/release.yml",
+		"deploy/Dockerfile",
+		"release/app.intoto.jsonl",
+		"docs/images/logo.png",
+		"web/src/components/Button.tsx",
+		"attestations/build-123.json",
+		"Makefile",
+		"pkg/api/v1/types.pb.go",
+		"config/settings.json",
+	}
+	for i := 0; i < b.N; i++ {
+		for _, rel := range paths {
+			classifyFile(rel, path.Base(rel), defaultProvenanceMatcher)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// codeOwnersLocations are the places a CODEOWNERS file is looked for, in
+// the order GitHub searches them; the first found is used.
+var codeOwnersLocations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// codeOwnersSection matches a GitLab section header such as "[Docs] @docs",
+// "^[Optional]", or "[Reviewers][2] @a @b", capturing its default owners.
+// A glob character class such as "[Mm]akefile" is not followed by a space
+// and stays a pattern.
+var codeOwnersSection = regexp.MustCompile(`^\^?\[[^\]]+\](?:\[\d+\])?(?:\s+(.*))?$`)
+
+// codeOwnersRule is one pattern line of a CODEOWNERS file. A rule without
+// owners of its own leaves the paths it matches without owners, or, in a
+// GitLab section, gives them the section's default owners.
+type codeOwnersRule struct {
+	re     *regexp.Regexp
+	owners []string
+}
+
+// codeOwnersSectionRules are the rules of one section, in file order. The
+// rules before any section header form a section of their own.
+type codeOwnersSectionRules struct {
+	defaults []string
+	rules    []codeOwnersRule
+}
+
+// codeOwners resolves the owners of workspace paths from a CODEOWNERS file.
+type codeOwners struct {
+	// path is the workspace-relative slash path of the file.
+	path     string
+	sections []*codeOwnersSectionRules
+}
+
+// loadCodeOwners reads the workspace's CODEOWNERS file, or returns nil when
+// it has none.
+func loadCodeOwners(fsys workspaceFS, root string) *codeOwners {
+	for _, rel := range codeOwnersLocations {
+		data, err := fsys.ReadFile(filepath.Join(root, filepath.FromSlash(rel)))
+		if err == nil {
+			return parseCodeOwners(rel, string(data))
+		}
+	}
+	return nil
+}
+
+// parseCodeOwners parses a CODEOWNERS file: one pattern per line followed
+// by owners (@user, @org/team, or an email address), with comments and
+// optional GitLab section headers. Lines whose pattern cannot be compiled
+// are skipped.
+func parseCodeOwners(rel, data string) *codeOwners {
+	c := &codeOwners{path: rel}
+	section := &codeOwnersSectionRules{}
+	c.sections = append(c.sections, section)
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if m := codeOwnersSection.FindStringSubmatch(line); m != nil && allOwners(codeOwnersFields(m[1])) {
+			section = &codeOwnersSectionRules{defaults: codeOwnersFields(m[1])}
+			c.sections = append(c.sections, section)
+			continue
+		}
+		fields := codeOwnersFields(line)
+		re := codeOwnersPattern(fields[0])
+		if re == nil {
+			continue
+		}
+		var owners []string
+		for _, f := range fields[1:] {
+			if strings.HasPrefix(f, "#") {
+				break
+			}
+			owners = append(owners, f)
+		}
+		section.rules = append(section.rules, codeOwnersRule{re: re, owners: owners})
+	}
+	return c
+}
+
+// codeOwnersFields splits a line on whitespace that is not escaped with a
+// backslash, dropping a trailing comment.
+func codeOwnersFields(line string) []string {
+	var fields []string
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && i+1 < len(line) && line[i+1] == ' ':
+			b.WriteString(`\ `)
+			i++
+		case c == ' ' || c == '\t':
+			if b.Len() > 0 {
+				fields = append(fields, b.String())
+				b.Reset()
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if b.Len() > 0 {
+		fields = append(fields, b.String())
+	}
+	return fields
+}
+
+// allOwners reports whether every field names an owner.
+func allOwners(fields []string) bool {
+	for _, f := range fields {
+		if strings.HasPrefix(f, "#") {
+			return true
+		}
+		if !strings.Contains(f, "@") {
+			return false
+		}
+	}
+	return true
+}
+
+// codeOwnersPattern compiles a CODEOWNERS pattern with gitignore rules: a
+// slash anywhere but the end anchors it to the root, a trailing slash
+// matches directories only, and a pattern matching a directory matches
+// everything below it. A pattern ending in /* matches only the files
+// directly in its directory.
+func codeOwnersPattern(pattern string) *regexp.Regexp {
+	if strings.HasPrefix(pattern, "!") {
+		return nil
+	}
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimRight(pattern, "/")
+	if pattern == "" {
+		return nil
+	}
+	anchored := strings.Contains(pattern, "/")
+	shallow := strings.HasSuffix(pattern, "/*")
+	expr := globToRegexp(strings.TrimPrefix(pattern, "/"))
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	switch {
+	case dirOnly:
+		expr += "/.*"
+	case !shallow:
+		expr += "(?:/.*)?"
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return nil
+	}
+	return re
+}
+
+// owners returns the owners of a workspace-relative slash path. Within a
+// section the last matching rule wins; the owners of every section with a
+// match are combined, as GitLab does. Paths matching no rule have none.
+func (c *codeOwners) owners(rel string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, s := range c.sections {
+		var match *codeOwnersRule
+		for i := range s.rules {
+			if s.rules[i].re.MatchString(rel) {
+				match = &s.rules[i]
+			}
+		}
+		if match == nil {
+			continue
+		}
+		owners := match.owners
+		if len(owners) == 0 {
+			owners = s.defaults
+		}
+		for _, o := range owners {
+			if !seen[o] {
+				seen[o] = true
+				out = append(out, o)
+			}
+		}
+	}
+	return out
+}
+
+// ownerCounts counts the findings owned by each owner, a finding counting
+// for each of its owners, along with those owned by nobody. The summary
+// itself is left out.
+func (s *findingSet) ownerCounts() (map[string]int, int) {
+	counts := make(map[string]int)
+	unowned := 0
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.items {
+		if f.ruleID == summaryRuleID {
+			continue
+		}
+		owners := s.owners.owners(workspacePath(s.root, f.path))
+		if len(owners) == 0 {
+			unowned++
+		}
+		for _, o := range owners {
+			counts[o]++
+		}
+	}
+	return counts, unowned
+}
+
+// formatOwnerCounts renders owner counts as owner=count pairs, by
+// descending count and then owner.
+func formatOwnerCounts(counts map[string]int) string {
+	owners := sortedKeys(counts)
+	sort.SliceStable(owners, func(i, j int) bool { return counts[owners[i]] > counts[owners[j]] })
+	pairs := make([]string, len(owners))
+	for i, o := range owners {
+		pairs[i] = o + "=" + strconv.Itoa(counts[o])
+	}
+	return strings.Join(pairs, ",")
+}
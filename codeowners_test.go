@@ -0,0 +1,120 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testCodeOwners is a representative CODEOWNERS file: default owners,
+// extension, directory, anchored, and shallow patterns, an explicitly
+// unowned path, escapes, comments, and a GitLab section.
+const testCodeOwners = `# Default owners for everything.
+*                       @acme/core
+
+*.js                    @acme/frontend # inline comment
+/build/logs/            @alice
+docs/*                  docs@example.com
+apps/                   @acme/apps
+/scripts/ @acme/ops @bob
+**/provenance/**        @acme/security
+[Mm]akefile             @acme/build
+/vendor/generated
+space\ dir/             @carol
+
+[Release] @acme/release
+.github/workflows/release.yml
+*.intoto.jsonl          @acme/attest
+`
+
+func TestCodeOwnersResolution(t *testing.T) {
+	c := parseCodeOwners(".github/CODEOWNERS", testCodeOwners)
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "main.go", want: "@acme/core"},
+		{path: "web/app.js", want: "@acme/frontend"},
+		{path: "build/logs/out.txt", want: "@alice"},
+		{path: "nested/build/logs/out.txt", want: "@acme/core"},
+		{path: "docs/index.md", want: "docs@example.com"},
+		{path: "docs/guides/setup.md", want: "@acme/core"},
+		{path: "apps/api/main.go", want: "@acme/apps"},
+		{path: "services/apps/main.go", want: "@acme/apps"},
+		{path: "apps", want: "@acme/core"},
+		{path: "scripts/release.sh", want: "@acme/ops,@bob"},
+		{path: "tools/scripts/run.sh", want: "@acme/core"},
+		{path: "out/provenance/app.json", want: "@acme/security"},
+		{path: "Makefile", want: "@acme/build"},
+		{path: "sub/makefile", want: "@acme/build"},
+		{path: "vendor/generated/x.go", want: ""},
+		{path: "space dir/file", want: "@carol"},
+		{path: ".github/workflows/release.yml", want: "@acme/core,@acme/release"},
+		{path: "dist/app.intoto.jsonl", want: "@acme/core,@acme/attest"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(c.owners(tt.path), ","); got != tt.want {
+			t.Errorf("owners(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCodeOwnersWithoutDefault(t *testing.T) {
+	c := parseCodeOwners("CODEOWNERS", "/src/ @dev\n")
+	if got := c.owners("README.md"); len(got) != 0 {
+		t.Errorf("expected no owners for an unmatched path, got %v", got)
+	}
+}
+
+func TestScanFindingOwners(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "docs", "CODEOWNERS"), "* @acme/core\n/docker/ @acme/images\n/legacy/\n")
+	writeFile(t, filepath.Join(workspace, "CODEOWNERS"), "* @ignored\n")
+	writeFile(t, filepath.Join(workspace, ".github", "CODEOWNERS"), "* @acme/core\n/docker/ @acme/images\n/legacy/\n")
+	writeFile(t, filepath.Join(workspace, "docker", "Dockerfile"), "FROM alpine:latest\n")
+	writeFile(t, filepath.Join(workspace, "legacy", "Dockerfile"), "FROM alpine:latest\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+	owned := 0
+	for _, f := range resp.GetFindings() {
+		meta := f.GetMetadata()
+		if f.GetRuleId() == summaryRuleID {
+			if meta["codeowners"] != ".github/CODEOWNERS" || !strings.Contains(meta["findings_by_owner"], "@acme/images=") || meta["unowned_findings"] == "0" {
+				t.Errorf("unexpected summary metadata %v", meta)
+			}
+			continue
+		}
+		owners, ok := meta["owners"]
+		if !ok {
+			t.Errorf("finding %s at %s has no owners metadata", f.GetRuleId(), f.GetLocation().GetFilePath())
+		}
+		switch f.GetLocation().GetFilePath() {
+		case "docker/Dockerfile":
+			owned++
+			if owners != "@acme/images" {
+				t.Errorf("owners %q for docker/Dockerfile", owners)
+			}
+		case "legacy/Dockerfile":
+			if owners != "" {
+				t.Errorf("owners %q for legacy/Dockerfile, want none", owners)
+			}
+		}
+	}
+	if owned == 0 {
+		t.Fatal("expected findings for docker/Dockerfile")
+	}
+}
+
+func TestScanWithoutCodeOwners(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), "FROM alpine:latest\n")
+
+	for _, f := range invokeScan(t, testClient(t), workspace).GetFindings() {
+		if _, ok := f.GetMetadata()["owners"]; ok {
+			t.Errorf("finding %s has owners without a CODEOWNERS file", f.GetRuleId())
+		}
+		if _, ok := f.GetMetadata()["codeowners"]; ok {
+			t.Error("summary names a CODEOWNERS file that does not exist")
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// confirmedProvenanceRuleID marks a provenance file that passed every check.
+// It is only emitted when emit_confirmations is set.
+const confirmedProvenanceRuleID = "PROV-021"
+
+// Signature statuses of a confirmed provenance file.
+const (
+	signatureSigned   = "signed"
+	signaturePartial  = "partially_signed"
+	signatureUnsigned = "unsigned"
+)
+
+// provenanceConfirmation summarizes a provenance file whose statements all
+// parsed and passed the per-statement checks. Whether it is confirmed is
+// decided once the workspace-level checks have run.
+type provenanceConfirmation struct {
+	location       string
+	statements     int
+	signed         int
+	tlogEntries    int
+	subjects       int
+	builders       map[string]bool
+	predicateTypes map[string]bool
+	minLevel       int
+}
+
+// newProvenanceConfirmation summarizes the statements of a provenance file.
+// minLevel is the lowest estimated SLSA build level among them.
+func newProvenanceConfirmation(location string, statements []parsedStatement, minLevel int) provenanceConfirmation {
+	c := provenanceConfirmation{
+		location:       location,
+		statements:     len(statements),
+		builders:       make(map[string]bool),
+		predicateTypes: make(map[string]bool),
+		minLevel:       minLevel,
+	}
+	for i := range statements {
+		ps := &statements[i]
+		if ps.Signatures > 0 {
+			c.signed++
+		}
+		c.tlogEntries += ps.TlogEntries
+		c.subjects += len(ps.Statement.Subject)
+		if id := ps.Predicate.builderID(); id != "" {
+			c.builders[id] = true
+		}
+		if ps.Statement.PredicateType != "" {
+			c.predicateTypes[ps.Statement.PredicateType] = true
+		}
+	}
+	return c
+}
+
+// signatureStatus reports whether all, some, or none of the statements are
+// signed.
+func (c *provenanceConfirmation) signatureStatus() string {
+	switch c.signed {
+	case c.statements:
+		return signatureSigned
+	case 0:
+		return signatureUnsigned
+	}
+	return signaturePartial
+}
+
+// predicateVersion shortens SLSA provenance predicate types to their version,
+// such as "slsa-v1"; other predicate types are returned unchanged.
+func predicateVersion(predicateType string) string {
+	if strings.HasPrefix(predicateType, slsaProvenancePrefix) {
+		return "slsa-" + strings.TrimPrefix(predicateType, slsaProvenancePrefix)
+	}
+	return predicateType
+}
+
+// reportConfirmations adds an informational finding for each recorded
+// provenance file that no other check flagged: no finding above
+// informational severity is anchored at it and none of its statements
+// conflicts with another attestation.
+func reportConfirmations(findings *findingSet, summary *scanSummary) {
+	flagged := make(map[string]bool)
+	for _, f := range findings.items {
+		if f.severity != sdk.SeverityInfo {
+			flagged[f.path] = true
+		}
+	}
+	for location := range summary.conflictingLocations {
+		flagged[location] = true
+	}
+
+	confirmations := append([]provenanceConfirmation(nil), summary.confirmations...)
+	sort.Slice(confirmations, func(i, j int) bool {
+		return confirmations[i].location < confirmations[j].location
+	})
+	for i := range confirmations {
+		c := &confirmations[i]
+		if flagged[c.location] {
+			continue
+		}
+		versions := make(map[string]bool, len(c.predicateTypes))
+		for pt := range c.predicateTypes {
+			versions[predicateVersion(pt)] = true
+		}
+		status := c.signatureStatus()
+		findings.Finding(
+			confirmedProvenanceRuleID,
+			sdk.SeverityInfo,
+			sdk.ConfidenceHigh,
+			fmt.Sprintf("Complete %s provenance covering %d subjects", strings.ReplaceAll(status, "_", " "), c.subjects),
+		).
+			At(c.location, 0, 0).
+			WithMetadata("type", "provenance_confirmed").
+			WithMetadata("builder_ids", strings.Join(sortedKeys(c.builders), ",")).
+			WithMetadata("predicate_types", strings.Join(sortedKeys(c.predicateTypes), ",")).
+			WithMetadata("predicate_versions", strings.Join(sortedKeys(versions), ",")).
+			WithMetadata("signature_status", status).
+			WithMetadata("tlog_entries", strconv.Itoa(c.tlogEntries)).
+			WithMetadata("statements", strconv.Itoa(c.statements)).
+			WithMetadata("subject_count", strconv.Itoa(c.subjects)).
+			WithMetadata("slsa_level", strconv.Itoa(c.minLevel)).
+			Done()
+	}
+}
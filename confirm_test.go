@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanEmitConfirmations(t *testing.T) {
+	payload := base64.StdEncoding.EncodeToString([]byte(testStatement))
+	signed := `{"payloadType":"application/vnd.in-toto+json","payload":"` + payload + `","signatures":[{"keyid":"k","sig":"s"}]}`
+
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tgo build .\n")
+	writeFile(t, filepath.Join(workspace, "signed.intoto.jsonl"), signed+"\n")
+	writeFile(t, filepath.Join(workspace, "provenance.json"), testStatement)
+	writeFile(t, filepath.Join(workspace, "incomplete.intoto.json"),
+		`{"_type":"https://in-toto.io/Statement/v1","subject":[{"name":"lib","digest":{"sha256":"123"}}],"predicate":{}}`)
+	client := testClient(t)
+
+	resp := invokeScanWithInput(t, client, map[string]any{
+		"workspace_root":   workspace,
+		"fail_on_severity": "low",
+	})
+	if found := findByRule(resp.GetFindings(), confirmedProvenanceRuleID); len(found) != 0 {
+		t.Fatalf("expected no confirmations by default, got %d", len(found))
+	}
+	violations := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()["gate_violations"]
+
+	resp = invokeScanWithInput(t, client, map[string]any{
+		"workspace_root":     workspace,
+		"fail_on_severity":   "low",
+		"emit_confirmations": true,
+	})
+	found := findByRule(resp.GetFindings(), confirmedProvenanceRuleID)
+	if len(found) != 2 {
+		t.Fatalf("expected confirmations for the two complete files, got %d", len(found))
+	}
+	want := map[string]string{
+		"provenance.json":     signatureUnsigned,
+		"signed.intoto.jsonl": signatureSigned,
+	}
+	for _, f := range found {
+		meta := f.GetMetadata()
+		path := f.GetLocation().GetFilePath()
+		if meta["signature_status"] != want[path] {
+			t.Errorf("%s: signature_status = %q, want %q", path, meta["signature_status"], want[path])
+		}
+		if meta["builder_ids"] != "https://builder.example" || meta["predicate_versions"] != "slsa-v0.2" || meta["subject_count"] != "1" {
+			t.Errorf("%s: unexpected metadata %v", path, meta)
+		}
+	}
+
+	summary := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if summary["gate_violations"] != violations {
+		t.Errorf("confirmations changed gate_violations from %s to %s", violations, summary["gate_violations"])
+	}
+}
+
+func TestScanConfirmationsVetoedByOtherChecks(t *testing.T) {
+	other := `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2",` +
+		`"subject":[{"name":"app","digest":{"sha256":"abc123def4567890abc123def4567890abc123def4567890abc123def4567890"}}],"predicate":{"builder":{"id":"https://other.example"},` +
+		`"materials":[{"uri":"git+https://example.com/repo","digest":{"sha1":"def"}}]}}`
+
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "a.intoto.json"), testStatement)
+	writeFile(t, filepath.Join(workspace, "b.intoto.json"), other)
+	writeFile(t, filepath.Join(workspace, "c.intoto.json"), strings.Replace(testStatement, `"abc123def4567890`, `"fed123def4567890`, 1))
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root":     workspace,
+		"emit_confirmations": true,
+	})
+	if got := len(findByRule(resp.GetFindings(), conflictingAttestationsRuleID)); got != 1 {
+		t.Fatalf("expected one conflict, got %d", got)
+	}
+	found := findByRule(resp.GetFindings(), confirmedProvenanceRuleID)
+	if len(found) != 1 || found[0].GetLocation().GetFilePath() != "c.intoto.json" {
+		t.Errorf("expected only the unrelated provenance to be confirmed, got %d confirmations", len(found))
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// conflictingAttestationsRuleID flags statements that attest the same subject
+// digest but disagree about how it was built.
+const conflictingAttestationsRuleID = "PROV-019"
+
+// maxConflictDetails caps the subjects and materials listed in a conflict
+// finding's metadata.
+const maxConflictDetails = 10
+
+// Claims compared between statements attesting the same subject.
+const (
+	claimBuilderID = "builder_id"
+	claimSource    = "source_repo"
+	claimMaterials = "materials"
+)
+
+// statementClaims is what one statement claims about how its subjects were
+// built, kept for cross-statement comparison.
+type statementClaims struct {
+	location string
+	line     int
+	// index is the statement's position, or -1 when its document holds a
+	// single statement.
+	index   int
+	builder string
+	source  string
+	// signed reports whether the statement came in an envelope carrying at
+	// least one signature.
+	signed bool
+	// materials maps material URIs to their digests, keyed by algorithm.
+	materials map[string]map[string]string
+	// subjects maps "alg:hex" subject digests to subject names.
+	subjects map[string]string
+}
+
+// label names the statement for finding metadata.
+func (c *statementClaims) label(root string) string {
+	label := workspacePath(root, c.location)
+	if c.index >= 0 {
+		label += "#" + strconv.Itoa(c.index)
+	}
+	return label
+}
+
+// recordClaims keeps a statement's builder, source, and material claims,
+// indexed by its subject digests.
+func (s *scanSummary) recordClaims(location string, ps *parsedStatement, single bool) {
+	c := statementClaims{
+		location:  location,
+		line:      ps.Line,
+		index:     ps.Index,
+		builder:   ps.Predicate.builderID(),
+		source:    ps.Predicate.sourceRepo(),
+		signed:    ps.Signatures > 0,
+		materials: make(map[string]map[string]string),
+		subjects:  make(map[string]string),
+	}
+	if single {
+		c.index = -1
+	}
+	for _, subj := range ps.Statement.Subject {
+		for alg, digest := range subj.Digest {
+			if digest != "" {
+				c.subjects[strings.ToLower(alg)+":"+strings.ToLower(digest)] = subj.Name
+			}
+		}
+	}
+	if len(c.subjects) == 0 {
+		return
+	}
+	for _, m := range ps.Predicate.allMaterials() {
+		uri := m.URI
+		if uri == "" {
+			uri = m.Name
+		}
+		if uri == "" || len(m.Digest) == 0 {
+			continue
+		}
+		digests := c.materials[uri]
+		if digests == nil {
+			digests = make(map[string]string)
+			c.materials[uri] = digests
+		}
+		for alg, digest := range m.Digest {
+			digests[strings.ToLower(alg)] = strings.ToLower(digest)
+		}
+	}
+	s.claims = append(s.claims, c)
+}
+
+// claimsByDigest sorts the recorded claims by location and indexes them by
+// subject digest.
+func (s *scanSummary) claimsByDigest() map[string][]int {
+	// Workers record claims in any order.
+	sort.Slice(s.claims, func(i, j int) bool {
+		a, b := &s.claims[i], &s.claims[j]
+		if a.location != b.location {
+			return a.location < b.location
+		}
+		return a.index < b.index
+	})
+	byDigest := make(map[string][]int)
+	for i := range s.claims {
+		for digest := range s.claims[i].subjects {
+			byDigest[digest] = append(byDigest[digest], i)
+		}
+	}
+	return byDigest
+}
+
+// conflictingFields returns the claims on which a and b disagree. A field
+// only one of them sets is not a disagreement, and materials are compared
+// only where both record a digest for the same URI and algorithm.
+func conflictingFields(a, b *statementClaims) (fields []string, materials []string) {
+	if a.builder != "" && b.builder != "" && a.builder != b.builder {
+		fields = append(fields, claimBuilderID)
+	}
+	if a.source != "" && b.source != "" && a.source != b.source {
+		fields = append(fields, claimSource)
+	}
+	for uri, digestsA := range a.materials {
+		digestsB, ok := b.materials[uri]
+		if !ok {
+			continue
+		}
+		for alg, digest := range digestsA {
+			if other, ok := digestsB[alg]; ok && other != digest {
+				materials = append(materials, uri)
+				break
+			}
+		}
+	}
+	if len(materials) > 0 {
+		fields = append(fields, claimMaterials)
+	}
+	return fields, materials
+}
+
+// reportConflictingAttestations reports statements that attest the same
+// subject digest with contradicting builder, source, or material claims.
+// Statements that agree, such as a bare statement and its DSSE-wrapped copy,
+// are not reported. Subjects shared by the same set of conflicting
+// statements are reported together; disagreeing builders or sources are
+// High, disagreeing material digests alone Medium.
+func reportConflictingAttestations(findings *findingSet, summary *scanSummary) {
+	byDigest := summary.claimsByDigest()
+
+	type conflict struct {
+		claims    []int
+		fields    map[string]bool
+		materials map[string]bool
+		digests   []string
+	}
+	conflicts := make(map[string]*conflict)
+	for _, digest := range sortedKeys(byDigest) {
+		indices := byDigest[digest]
+		if len(indices) < 2 {
+			continue
+		}
+		involved := make(map[int]bool)
+		fields := make(map[string]bool)
+		materials := make(map[string]bool)
+		for i, a := range indices {
+			for _, b := range indices[i+1:] {
+				f, m := conflictingFields(&summary.claims[a], &summary.claims[b])
+				if len(f) == 0 {
+					continue
+				}
+				involved[a], involved[b] = true, true
+				for _, field := range f {
+					fields[field] = true
+				}
+				for _, uri := range m {
+					materials[uri] = true
+				}
+			}
+		}
+		if len(involved) == 0 {
+			continue
+		}
+
+		claims := make([]int, 0, len(involved))
+		for i := range involved {
+			claims = append(claims, i)
+		}
+		sort.Ints(claims)
+		key := fmt.Sprint(claims) + strings.Join(sortedKeys(fields), ",")
+		c := conflicts[key]
+		if c == nil {
+			c = &conflict{claims: claims, fields: fields, materials: make(map[string]bool)}
+			conflicts[key] = c
+		}
+		for uri := range materials {
+			c.materials[uri] = true
+		}
+		c.digests = append(c.digests, digest)
+	}
+
+	for _, key := range sortedKeys(conflicts) {
+		c := conflicts[key]
+		var files, subjects []string
+		builders := make(map[string]bool)
+		sources := make(map[string]bool)
+		for _, i := range c.claims {
+			claims := &summary.claims[i]
+			files = append(files, claims.label(findings.root))
+			if summary.conflictingLocations == nil {
+				summary.conflictingLocations = make(map[string]bool)
+			}
+			summary.conflictingLocations[claims.location] = true
+			builders[claims.builder] = true
+			sources[claims.source] = true
+		}
+		sort.Strings(files)
+		named := make(map[string]bool)
+		for _, digest := range c.digests {
+			name := summary.claims[c.claims[0]].subjects[digest]
+			if name != "" && !named[name] && len(subjects) < maxConflictDetails {
+				named[name] = true
+				subjects = append(subjects, name)
+			}
+		}
+
+		severity := sdk.SeverityMedium
+		if c.fields[claimBuilderID] || c.fields[claimSource] {
+			severity = sdk.SeverityHigh
+		}
+		first := &summary.claims[c.claims[0]]
+		fields := sortedKeys(c.fields)
+		fb := findings.Finding(
+			conflictingAttestationsRuleID,
+			severity,
+			sdk.ConfidenceHigh,
+			fmt.Sprintf("%d attestations of subject digest %s disagree on %s", len(c.claims), c.digests[0], strings.Join(fields, ", ")),
+		).
+			At(first.location, first.line, first.line).
+			WithMetadata("type", "conflicting_attestations").
+			WithMetadata("conflicting_fields", strings.Join(fields, ",")).
+			WithMetadata("conflicting_files", strings.Join(files, ",")).
+			WithMetadata("subject_digest", c.digests[0]).
+			WithMetadata("subject_digest_count", strconv.Itoa(len(c.digests))).
+			WithMetadata("subjects", strings.Join(subjects, ","))
+		if c.fields[claimBuilderID] {
+			delete(builders, "")
+			fb.WithMetadata("builder_ids", strings.Join(sortedKeys(builders), ","))
+		}
+		if c.fields[claimSource] {
+			delete(sources, "")
+			fb.WithMetadata("source_repos", strings.Join(sortedKeys(sources), ","))
+		}
+		if len(c.materials) > 0 {
+			uris := sortedKeys(c.materials)
+			if len(uris) > maxConflictDetails {
+				uris = uris[:maxConflictDetails]
+			}
+			fb.WithMetadata("conflicting_materials", strings.Join(uris, ","))
+		}
+		fb.Done()
+	}
+}
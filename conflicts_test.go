@@ -0,0 +1,93 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+func TestScanConflictingAttestations(t *testing.T) {
+	const (
+		digestApp = "1111111111111111111111111111111111111111111111111111111111111111"
+		digestCLI = "2222222222222222222222222222222222222222222222222222222222222222"
+		digestLib = "3333333333333333333333333333333333333333333333333333333333333333"
+	)
+	subjects := func(pairs ...string) string {
+		list := ""
+		for i := 0; i+1 < len(pairs); i += 2 {
+			if list != "" {
+				list += ","
+			}
+			list += `{"name":"` + pairs[i] + `","digest":{"sha256":"` + pairs[i+1] + `"}}`
+		}
+		return "[" + list + "]"
+	}
+	material := func(digest string) string {
+		return `[{"uri":"git+https://github.com/example/app","digest":{"sha1":"` + digest + `"}}]`
+	}
+
+	workspace := t.TempDir()
+	release := levelStatement("https://github.com/actions/runner", "https://github.com/actions/workflow",
+		subjects("app", digestApp, "cli", digestCLI), material("aaaa"))
+	// The same statement, bare and DSSE-wrapped, is not a conflict.
+	writeFile(t, filepath.Join(workspace, "release", "provenance.json"), release)
+	writeFile(t, filepath.Join(workspace, "release", "app.intoto.json"), signed(release))
+	// A rebuild elsewhere claims another builder for both subjects.
+	writeFile(t, filepath.Join(workspace, "mirror", "provenance.json"),
+		levelStatement("https://ci.example.com/builder", "https://github.com/actions/workflow",
+			subjects("app", digestApp, "cli", digestCLI), material("aaaa")))
+	// The library's two statements agree on the builder but not the source
+	// commit.
+	writeFile(t, filepath.Join(workspace, "lib", "lib.intoto.jsonl"),
+		levelStatement("https://github.com/actions/runner", "https://github.com/actions/workflow", subjects("lib", digestLib), material("bbbb"))+"\n"+
+			levelStatement("https://github.com/actions/runner", "https://github.com/actions/workflow", subjects("lib", digestLib), material("cccc"))+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	found := findByRule(resp.GetFindings(), conflictingAttestationsRuleID)
+	if len(found) != 2 {
+		t.Fatalf("expected 2 %s findings, got %d", conflictingAttestationsRuleID, len(found))
+	}
+	byFields := make(map[string]map[string]string)
+	for _, f := range found {
+		meta := f.GetMetadata()
+		byFields[meta["conflicting_fields"]] = meta
+		wantSeverity := sdk.SeverityHigh
+		if meta["conflicting_fields"] == claimMaterials {
+			wantSeverity = sdk.SeverityMedium
+		}
+		if f.GetSeverity() != wantSeverity {
+			t.Errorf("%s severity = %v, want %v", meta["conflicting_fields"], f.GetSeverity(), wantSeverity)
+		}
+	}
+
+	builder := byFields[claimBuilderID]
+	if builder == nil {
+		t.Fatalf("expected a builder_id conflict, got %v", byFields)
+	}
+	for key, want := range map[string]string{
+		"conflicting_files":    "mirror/provenance.json,release/app.intoto.json,release/provenance.json",
+		"builder_ids":          "https://ci.example.com/builder,https://github.com/actions/runner",
+		"subject_digest_count": "2",
+		"subjects":             "app,cli",
+	} {
+		if builder[key] != want {
+			t.Errorf("builder conflict %s = %q, want %q", key, builder[key], want)
+		}
+	}
+
+	materials := byFields[claimMaterials]
+	if materials == nil {
+		t.Fatalf("expected a materials conflict, got %v", byFields)
+	}
+	for key, want := range map[string]string{
+		"conflicting_files":     "lib/lib.intoto.jsonl#0,lib/lib.intoto.jsonl#1",
+		"conflicting_materials": "git+https://github.com/example/app",
+		"subject_digest":        "sha256:" + digestLib,
+	} {
+		if materials[key] != want {
+			t.Errorf("materials conflict %s = %q, want %q", key, materials[key], want)
+		}
+	}
+}
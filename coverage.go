@@ -0,0 +1,208 @@
+package main
+
+import "strings"
+
+// Coverage statuses of a rule family.
+const (
+	coverageRan     = "ran"
+	coveragePartial = "partial"
+	coverageSkipped = "skipped"
+)
+
+// Reasons a rule family was skipped or only partly covered.
+const (
+	skipDisabledByInput     = "disabled_by_input"
+	skipNoMatchingFiles     = "no_matching_files"
+	skipLimitHit            = "limit_hit"
+	skipPrerequisiteMissing = "prerequisite_missing"
+	skipIncrementalScan     = "incremental_scan"
+)
+
+// workspaceChecksFamily names the cross-file checks in the coverage of an
+// incremental scan, which skips them.
+const workspaceChecksFamily = "workspace_checks"
+
+// ruleFamily is a group of rules that stand or fall together: they analyze
+// the same files or depend on the same input.
+type ruleFamily struct {
+	name string
+	// rules are the family's rules; disabling every one of them skips it.
+	rules []string
+	// kinds are the file categories the family analyzes; with none matched
+	// it had nothing to check. Families fed by other analyses have none.
+	kinds fileKind
+	// skip returns why the scan options or the workspace skip the family,
+	// or "".
+	skip func(opts scanOptions, s *scanSummary) string
+}
+
+// ruleFamilies lists the families reported in the coverage section.
+var ruleFamilies = []ruleFamily{
+	{
+		name: "attestation_validation",
+		rules: []string{"PROV-002", "PROV-008", "PROV-009", deprecatedPredicateRuleID, subjectDigestMismatchRuleID,
+			conflictingAttestationsRuleID, digestConsistencyRuleID, sourceRefRuleID, workflowIdentityRuleID,
+			knownBadGeneratorRuleID, ephemeralSourceRuleID},
+		kinds: kindProvenance,
+	},
+	{
+		name: "reproducibility",
+		rules: []string{"PROV-003", onbuildRuleID, verifiedPathMismatchRuleID, wrapperIntegrityRuleID, registryOverrideRuleID,
+			vendoredBinaryRuleID, buildpackRuleID},
+		kinds: kindBuildConfig | kindCIConfig | kindCargo | kindWrapper | kindRegistry | kindBinary | kindBuildpack,
+	},
+	{
+		name: "ci_hardening",
+		rules: []string{unpinnedActionRuleID, deprecatedRuntimeRuleID, cachePoisoningRuleID, disallowedActionRuleID,
+			envInjectionRuleID, untrustedRefRuleID, postSignWriteRuleID, shaPinningRatioRuleID, artifactHandoffRuleID,
+			dormantWorkflowRuleID, longLivedKeyRuleID},
+		kinds: kindCIConfig | kindAction,
+	},
+	{
+		name:  "image_attestation",
+		rules: []string{unattestedImageRuleID, tagOnlyImageRuleID},
+		kinds: kindImageSource,
+		skip: func(opts scanOptions, _ *scanSummary) string {
+			if !opts.checkImages {
+				return skipDisabledByInput
+			}
+			return ""
+		},
+	},
+	{
+		name:  "sbom",
+		rules: []string{missingSBOMRuleID, emptySBOMRuleID},
+		kinds: kindSBOM | kindBuildConfig,
+		skip: func(opts scanOptions, _ *scanSummary) string {
+			if !opts.checkSBOM {
+				return skipDisabledByInput
+			}
+			return ""
+		},
+	},
+	{
+		name:  "lockfile_correlation",
+		rules: []string{lowLockfileOverlapRuleID, lockfileDigestMismatchRuleID},
+		kinds: kindLockfile,
+	},
+	{
+		name:  "archive_inspection",
+		rules: []string{unattestedArchiveImageRuleID},
+		kinds: kindArchive,
+		// Archives are opt-in.
+		skip: func(opts scanOptions, _ *scanSummary) string {
+			if !opts.scanArchives {
+				return skipPrerequisiteMissing
+			}
+			return ""
+		},
+	},
+	{
+		name:  "signature_verification",
+		rules: []string{unmatchedPolicyRuleID, weakKeyRuleID},
+		kinds: kindVerification,
+		// Signing is checked against the keys and admission policies in
+		// the workspace; without any there is no trust root.
+		skip: func(_ scanOptions, s *scanSummary) string {
+			if s.verificationKeys == 0 && len(s.imagePolicies) == 0 {
+				return skipPrerequisiteMissing
+			}
+			return ""
+		},
+	},
+	{
+		name:  "policy_evaluation",
+		rules: []string{policyDenialRuleID},
+		skip: func(opts scanOptions, _ *scanSummary) string {
+			if len(opts.policyFiles) == 0 {
+				return skipPrerequisiteMissing
+			}
+			return ""
+		},
+	},
+	{
+		name:  "script_following",
+		rules: []string{missingScriptRuleID},
+		skip: func(opts scanOptions, _ *scanSummary) string {
+			if !opts.followScripts {
+				return skipDisabledByInput
+			}
+			if opts.incremental {
+				return skipIncrementalScan
+			}
+			return ""
+		},
+	},
+}
+
+// familyCoverage is the outcome of one rule family in a scan.
+type familyCoverage struct {
+	family string
+	status string
+	// reason says why the family was skipped or partial; empty when it
+	// ran in full.
+	reason string
+}
+
+// String formats the coverage as family=status or family=status:reason.
+func (c familyCoverage) String() string {
+	if c.reason == "" {
+		return c.family + "=" + c.status
+	}
+	return c.family + "=" + c.status + ":" + c.reason
+}
+
+// scanCoverage decides, for each rule family, whether the scan ran it in
+// full, in part, or not at all. Skipping by input or a missing
+// prerequisite comes first, then having no files to analyze; a family
+// whose files were all over max_file_size or the time budget is skipped,
+// and one that lost only some of them, or whose scan was interrupted, is
+// partial. In an incremental scan every family that ran is partial, as
+// only the changed files were analyzed, and the skipped cross-file checks
+// are listed as a family of their own.
+func scanCoverage(opts scanOptions, s *scanSummary) []familyCoverage {
+	out := make([]familyCoverage, 0, len(ruleFamilies))
+	for _, f := range ruleFamilies {
+		c := familyCoverage{family: f.name, status: coverageSkipped}
+		switch {
+		case allDisabled(f.rules, opts.disabledRules):
+			c.reason = skipDisabledByInput
+		case f.skip != nil && f.skip(opts, s) != "":
+			c.reason = f.skip(opts, s)
+		case f.kinds != 0 && !s.kindsAnalyzed.has(f.kinds) && s.kindsLimited.has(f.kinds):
+			c.reason = skipLimitHit
+		case f.kinds != 0 && !s.kindsAnalyzed.has(f.kinds):
+			c.reason = skipNoMatchingFiles
+		case s.kindsLimited.has(f.kinds) || s.interrupted != nil:
+			c.status, c.reason = coveragePartial, skipLimitHit
+		case opts.incremental:
+			c.status, c.reason = coveragePartial, skipIncrementalScan
+		default:
+			c.status = coverageRan
+		}
+		out = append(out, c)
+	}
+	if opts.incremental {
+		out = append(out, familyCoverage{family: workspaceChecksFamily, status: coverageSkipped, reason: skipIncrementalScan})
+	}
+	return out
+}
+
+// allDisabled reports whether every rule is in disabled.
+func allDisabled(rules []string, disabled map[string]bool) bool {
+	for _, id := range rules {
+		if !disabled[id] {
+			return false
+		}
+	}
+	return len(rules) > 0
+}
+
+// formatCoverage joins family coverages for the summary metadata.
+func formatCoverage(coverage []familyCoverage) string {
+	parts := make([]string, len(coverage))
+	for i, c := range coverage {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRuleFamilies(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, f := range ruleFamilies {
+		if seen[f.name] {
+			t.Errorf("duplicate family %s", f.name)
+		}
+		seen[f.name] = true
+		if len(f.rules) == 0 {
+			t.Errorf("%s: no rules", f.name)
+		}
+		for _, id := range f.rules {
+			if _, ok := lookupRule(id); !ok || id == summaryRuleID {
+				t.Errorf("%s: unknown rule %s", f.name, id)
+			}
+		}
+	}
+}
+
+// coverageOf parses the coverage metadata of a scan's summary finding.
+func coverageOf(t *testing.T, meta map[string]string) map[string]string {
+	t.Helper()
+	raw, ok := meta["coverage"]
+	if !ok {
+		t.Fatal("summary has no coverage")
+	}
+	out := make(map[string]string)
+	for _, entry := range strings.Split(raw, ",") {
+		family, outcome, ok := strings.Cut(entry, "=")
+		if !ok {
+			t.Fatalf("malformed coverage entry %q", entry)
+		}
+		out[family] = outcome
+	}
+	if len(out) != len(ruleFamilies) {
+		t.Errorf("coverage lists %d families, want %d: %s", len(out), len(ruleFamilies), raw)
+	}
+	return out
+}
+
+func TestScanCoverage(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "provenance.intoto.jsonl"), testStatement+"\n")
+	writeFile(t, filepath.Join(workspace, "Makefile"), "all:\n")
+	client := testClient(t)
+
+	tests := []struct {
+		name  string
+		input map[string]any
+		want  map[string]string
+	}{
+		{
+			name: "defaults",
+			want: map[string]string{
+				"attestation_validation": "ran",
+				"reproducibility":        "ran",
+				"ci_hardening":           "skipped:no_matching_files",
+				"archive_inspection":     "skipped:prerequisite_missing",
+				"signature_verification": "skipped:prerequisite_missing",
+				"policy_evaluation":      "skipped:prerequisite_missing",
+				"script_following":       "ran",
+			},
+		},
+		{
+			name:  "size limit",
+			input: map[string]any{"max_file_size": 64},
+			want: map[string]string{
+				"attestation_validation": "skipped:limit_hit",
+				"reproducibility":        "ran",
+			},
+		},
+		{
+			name: "disabled by input",
+			input: map[string]any{
+				"disabled_rules": strings.Join(ruleFamilies[0].rules, ","),
+				"check_images":   false,
+				"follow_scripts": false,
+				"scan_archives":  true,
+			},
+			want: map[string]string{
+				"attestation_validation": "skipped:disabled_by_input",
+				"image_attestation":      "skipped:disabled_by_input",
+				"script_following":       "skipped:disabled_by_input",
+				"archive_inspection":     "skipped:no_matching_files",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := map[string]any{"workspace_root": workspace}
+			for k, v := range tt.input {
+				input[k] = v
+			}
+			summary := findByRule(invokeScanWithInput(t, client, input).GetFindings(), summaryRuleID)
+			if len(summary) != 1 {
+				t.Fatalf("expected one summary, got %d", len(summary))
+			}
+			got := coverageOf(t, summary[0].GetMetadata())
+			for family, want := range tt.want {
+				if got[family] != want {
+					t.Errorf("%s = %q, want %q", family, got[family], want)
+				}
+			}
+		})
+	}
+
+	// A trust root in the workspace lets signing be verified.
+	writeFile(t, filepath.Join(workspace, "cosign.pub"), "-----BEGIN PUBLIC KEY-----\n-----END PUBLIC KEY-----\n")
+	summary := findByRule(invokeScan(t, client, workspace).GetFindings(), summaryRuleID)
+	if got := coverageOf(t, summary[0].GetMetadata())["signature_verification"]; got != "ran" {
+		t.Errorf("signature_verification = %q with a public key, want ran", got)
+	}
+}
+
+func TestScanCoveragePartial(t *testing.T) {
+	opts, err := parseScanOptions(map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outcome := func(s *scanSummary, family string) string {
+		for _, c := range scanCoverage(opts, s) {
+			if c.family == family {
+				return c.String()
+			}
+		}
+		return ""
+	}
+
+	s := &scanSummary{kindsAnalyzed: kindProvenance | kindBuildConfig, kindsLimited: kindProvenance}
+	if got := outcome(s, "attestation_validation"); got != "attestation_validation=partial:limit_hit" {
+		t.Errorf("got %q with some provenance over a limit", got)
+	}
+	if got := outcome(s, "reproducibility"); got != "reproducibility=ran" {
+		t.Errorf("got %q for an unaffected family", got)
+	}
+
+	s = &scanSummary{kindsAnalyzed: kindBuildConfig, interrupted: context.DeadlineExceeded}
+	if got := outcome(s, "reproducibility"); got != "reproducibility=partial:limit_hit" {
+		t.Errorf("got %q for an interrupted scan", got)
+	}
+	if got := outcome(s, "attestation_validation"); got != "attestation_validation=skipped:no_matching_files" {
+		t.Errorf("got %q for a family with no files", got)
+	}
+}
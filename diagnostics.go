@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// analyzerFailureRuleID reports a file an analyzer failed or panicked on,
+// or whose analysis ran out of time, whose findings may be missing.
+const analyzerFailureRuleID = "PROV-053"
+
+// maxAnalyzerErrorLen bounds the error text carried by a failure finding.
+const maxAnalyzerErrorLen = 256
+
+// sanitizeAnalyzerError returns an error as a single line of bounded length,
+// with paths under the workspace root made relative, so that diagnostics do
+// not leak the scanning host's layout.
+func sanitizeAnalyzerError(err error, root string) string {
+	msg := err.Error()
+	if root != "" {
+		msg = strings.ReplaceAll(msg, root+string(filepath.Separator), "")
+		msg = strings.ReplaceAll(msg, root, ".")
+	}
+	msg = strings.Join(strings.Fields(msg), " ")
+	if len(msg) > maxAnalyzerErrorLen {
+		msg = strings.ToValidUTF8(msg[:maxAnalyzerErrorLen], "") + "..."
+	}
+	return msg
+}
+
+// reportAnalyzerFailure flags a file an analyzer could not finish.
+func reportAnalyzerFailure(findings *findingSet, filePath, analyzer string, err error) {
+	msg := sanitizeAnalyzerError(err, findings.root)
+	findings.Finding(
+		analyzerFailureRuleID,
+		sdk.SeverityLow,
+		sdk.ConfidenceHigh,
+		fmt.Sprintf("The %s analyzer failed on this file, so its findings for it may be missing: %s", analyzer, msg),
+	).
+		At(filePath, 0, 0).
+		WithMetadata("type", "analyzer_failure").
+		WithMetadata("analyzer", analyzer).
+		WithMetadata("error", msg).
+		WithMetadata("panic", fmt.Sprint(strings.HasPrefix(msg, "panic: "))).
+		Done()
+}
+
+// reportTimeBudgetExceeded flags a file whose analysis was abandoned in the
+// named analyzer when the per-file time budget ran out.
+func reportTimeBudgetExceeded(findings *findingSet, filePath, analyzer string, budget time.Duration) {
+	findings.Finding(
+		analyzerFailureRuleID,
+		sdk.SeverityLow,
+		sdk.ConfidenceHigh,
+		fmt.Sprintf("Analysis of this file was abandoned in the %s analyzer after its %s time budget; findings for the rest of it may be missing", analyzer, budget),
+	).
+		At(filePath, 0, 0).
+		WithMetadata("type", "time_budget_exceeded").
+		WithMetadata("analyzer", analyzer).
+		WithMetadata("budget_ms", strconv.FormatInt(budget.Milliseconds(), 10)).
+		Done()
+}
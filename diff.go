@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// diffRuleID identifies findings produced by the diff tool.
+const diffRuleID = "PROV-004"
+
+// provenanceView aggregates the comparable facts from every statement found
+// on one side of a diff.
+type provenanceView struct {
+	builders    map[string]bool
+	buildTypes  map[string]bool
+	sources     map[string]bool
+	entryPoints map[string]bool
+	// materials maps material URI (or name) to its formatted digest set.
+	materials map[string]string
+	// subjects maps subject name to its formatted digest set.
+	subjects map[string]string
+	// oversized lists the files a directory walk skipped for exceeding
+	// defaultMaxFileSize.
+	oversized []string
+}
+
+func newProvenanceView() *provenanceView {
+	return &provenanceView{
+		builders:    make(map[string]bool),
+		buildTypes:  make(map[string]bool),
+		sources:     make(map[string]bool),
+		entryPoints: make(map[string]bool),
+		materials:   make(map[string]string),
+		subjects:    make(map[string]string),
+	}
+}
+
+// add records the facts of a single statement.
+func (v *provenanceView) add(ps *parsedStatement) {
+	addNonEmpty(v.builders, ps.Predicate.builderID())
+	addNonEmpty(v.buildTypes, ps.Predicate.buildTypeURI())
+	addNonEmpty(v.sources, ps.Predicate.sourceRepo())
+	addNonEmpty(v.entryPoints, ps.Predicate.entryPoint())
+	for _, m := range ps.Predicate.allMaterials() {
+		key := m.URI
+		if key == "" {
+			key = m.Name
+		}
+		if key != "" {
+			v.materials[key] = formatDigest(m.Digest)
+		}
+	}
+	for _, subj := range ps.Statement.Subject {
+		if subj.Name != "" {
+			v.subjects[subj.Name] = formatDigest(subj.Digest)
+		}
+	}
+}
+
+func addNonEmpty(set map[string]bool, value string) {
+	if value != "" {
+		set[value] = true
+	}
+}
+
+// provenanceChange is a single category of difference between two views.
+type provenanceChange struct {
+	kind     string
+	severity pluginv1.Severity
+	message  string
+	before   []string
+	after    []string
+}
+
+func handleDiff(ctx context.Context, req sdk.ToolRequest) (*pluginv1.InvokeToolResponse, error) {
+	basePath, _ := req.Input["base"].(string)
+	headPath, _ := req.Input["head"].(string)
+
+	resp := sdk.NewResponse()
+
+	if basePath == "" || headPath == "" {
+		return resp.Build(), nil
+	}
+
+	basePath, err := resolveInputPath("base", basePath, req.WorkspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	headPath, err = resolveInputPath("head", headPath, req.WorkspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := loadProvenanceView(ctx, basePath)
+	if err != nil {
+		return nil, fmt.Errorf("loading base: %w", err)
+	}
+	head, err := loadProvenanceView(ctx, headPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading head: %w", err)
+	}
+
+	findings := &findingSet{root: req.WorkspaceRoot}
+	for _, c := range diffProvenance(base, head) {
+		findings.Finding(diffRuleID, c.severity, sdk.ConfidenceHigh, c.message).
+			At(headPath, 0, 0).
+			WithMetadata("type", "provenance_diff").
+			WithMetadata("change", c.kind).
+			WithMetadata("before", strings.Join(c.before, ", ")).
+			WithMetadata("after", strings.Join(c.after, ", ")).
+			WithMetadata("base", workspacePath(findings.root, basePath)).
+			WithMetadata("head", workspacePath(findings.root, headPath)).
+			Done()
+	}
+
+	if len(base.oversized) > 0 || len(head.oversized) > 0 {
+		findings.Finding(diffRuleID, sdk.SeverityInfo, sdk.ConfidenceHigh,
+			fmt.Sprintf("Provenance files over the %d byte limit were not compared: %d", defaultMaxFileSize, len(base.oversized)+len(head.oversized))).
+			At(headPath, 0, 0).
+			WithMetadata("type", "provenance_diff").
+			WithMetadata("change", "oversized_skipped").
+			WithMetadata("before", strings.Join(workspacePaths(findings.root, base.oversized), ", ")).
+			WithMetadata("after", strings.Join(workspacePaths(findings.root, head.oversized), ", ")).
+			WithMetadata("base", workspacePath(findings.root, basePath)).
+			WithMetadata("head", workspacePath(findings.root, headPath)).
+			Done()
+	}
+
+	findings.build(resp)
+	return resp.Build(), nil
+}
+
+// workspacePaths applies workspacePath to each of paths.
+func workspacePaths(root string, paths []string) []string {
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		out[i] = workspacePath(root, p)
+	}
+	return out
+}
+
+// resolveInputPath resolves a relative tool input path against the workspace
+// root when one is available, and rejects a path that leads outside it,
+// directly or through a symlink. Without a workspace root there is nothing
+// to confine the path to and it is used as given.
+func resolveInputPath(input, path, workspaceRoot string) (string, error) {
+	if workspaceRoot == "" {
+		return path, nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workspaceRoot, path)
+	}
+	absRoot, err := filepath.Abs(workspaceRoot)
+	if err != nil {
+		return "", fmt.Errorf("resolving workspace root %q: %w", workspaceRoot, err)
+	}
+	if !withinDir(realPath(absRoot), realPath(filepath.Clean(path))) {
+		return "", fmt.Errorf("%s: %q is outside the workspace", input, path)
+	}
+	return path, nil
+}
+
+// loadProvenanceView parses a provenance file, or every provenance file under
+// a directory, into a view. A file given explicitly must parse and fit in
+// defaultMaxFileSize; unparsable files found while walking a directory are
+// skipped, and oversized ones are skipped and recorded in the view.
+func loadProvenanceView(ctx context.Context, path string) (*provenanceView, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	view := newProvenanceView()
+
+	if !info.IsDir() {
+		data, err := readBoundedFile(path, defaultMaxFileSize)
+		if err != nil {
+			return nil, err
+		}
+		statements, err := parseProvenance(ctx, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for i := range statements {
+			view.add(&statements[i])
+		}
+		return view, nil
+	}
+
+	err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !defaultProvenanceMatcher.match(slashRel(path, p)) {
+			return nil
+		}
+		data, err := readBoundedFile(p, defaultMaxFileSize)
+		if errors.Is(err, errFileTooLarge) {
+			view.oversized = append(view.oversized, p)
+			return nil
+		}
+		if err != nil {
+			return nil
+		}
+		statements, err := parseProvenance(ctx, data)
+		if err != nil {
+			return nil
+		}
+		for i := range statements {
+			view.add(&statements[i])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// diffProvenance compares two views and returns one change per category of
+// difference, in a fixed order.
+func diffProvenance(base, head *provenanceView) []provenanceChange {
+	var changes []provenanceChange
+
+	setChange := func(kind string, severity pluginv1.Severity, label string, before, after map[string]bool) {
+		b, a := sortedKeys(before), sortedKeys(after)
+		if strings.Join(b, "\n") != strings.Join(a, "\n") {
+			changes = append(changes, provenanceChange{
+				kind:     kind,
+				severity: severity,
+				message:  fmt.Sprintf("Provenance %s changed", label),
+				before:   b,
+				after:    a,
+			})
+		}
+	}
+
+	setChange("builder_id", sdk.SeverityHigh, "builder ID", base.builders, head.builders)
+	setChange("source_repo", sdk.SeverityHigh, "source repository", base.sources, head.sources)
+	setChange("entry_point", sdk.SeverityHigh, "build entry point", base.entryPoints, head.entryPoints)
+	setChange("build_type", sdk.SeverityMedium, "build type", base.buildTypes, head.buildTypes)
+
+	added, removed, changed := diffDigestMaps(base.materials, head.materials)
+	if len(added) > 0 {
+		changes = append(changes, provenanceChange{
+			kind:     "materials_added",
+			severity: sdk.SeverityLow,
+			message:  fmt.Sprintf("Provenance materials added: %d", len(added)),
+			after:    added,
+		})
+	}
+	if len(removed) > 0 {
+		changes = append(changes, provenanceChange{
+			kind:     "materials_removed",
+			severity: sdk.SeverityMedium,
+			message:  fmt.Sprintf("Provenance materials removed: %d", len(removed)),
+			before:   removed,
+		})
+	}
+	if len(changed) > 0 {
+		var before, after []string
+		for _, key := range changed {
+			before = append(before, key+"@"+base.materials[key])
+			after = append(after, key+"@"+head.materials[key])
+		}
+		changes = append(changes, provenanceChange{
+			kind:     "materials_digest_changed",
+			severity: sdk.SeverityLow,
+			message:  fmt.Sprintf("Provenance material digests changed: %d", len(changed)),
+			before:   before,
+			after:    after,
+		})
+	}
+
+	added, removed, changed = diffDigestMaps(base.subjects, head.subjects)
+	if len(added) > 0 {
+		changes = append(changes, provenanceChange{
+			kind:     "subjects_added",
+			severity: sdk.SeverityLow,
+			message:  fmt.Sprintf("Provenance subjects added: %d", len(added)),
+			after:    added,
+		})
+	}
+	if len(removed) > 0 {
+		changes = append(changes, provenanceChange{
+			kind:     "subjects_removed",
+			severity: sdk.SeverityMedium,
+			message:  fmt.Sprintf("Provenance subjects removed: %d", len(removed)),
+			before:   removed,
+		})
+	}
+	if len(changed) > 0 {
+		var before, after []string
+		for _, key := range changed {
+			before = append(before, key+"@"+base.subjects[key])
+			after = append(after, key+"@"+head.subjects[key])
+		}
+		changes = append(changes, provenanceChange{
+			kind:     "subjects_digest_changed",
+			severity: sdk.SeverityMedium,
+			message:  fmt.Sprintf("Provenance subject digests changed: %d", len(changed)),
+			before:   before,
+			after:    after,
+		})
+	}
+
+	return changes
+}
+
+// diffDigestMaps returns the sorted keys only in head, only in base, and
+// present in both with different digests.
+func diffDigestMaps(base, head map[string]string) (added, removed, changed []string) {
+	for key, digest := range head {
+		baseDigest, ok := base[key]
+		switch {
+		case !ok:
+			added = append(added, key)
+		case baseDigest != digest:
+			changed = append(changed, key)
+		}
+	}
+	for key := range base {
+		if _, ok := head[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+func TestDiffReportsChangesAcrossBareAndDSSE(t *testing.T) {
+	client := testClient(t)
+	dir := filepath.Join(testdataDir(t), "diff")
+
+	resp := invokeTool(t, client, "diff", map[string]any{
+		"base": filepath.Join(dir, "base.intoto.jsonl"),
+		"head": filepath.Join(dir, "head.intoto.json"),
+	})
+
+	changes := make(map[string]*pluginv1.Finding)
+	for _, f := range findByRule(resp.GetFindings(), diffRuleID) {
+		changes[f.GetMetadata()["change"]] = f
+	}
+
+	tests := []struct {
+		change   string
+		severity pluginv1.Severity
+		before   string
+		after    string
+	}{
+		{"builder_id", sdk.SeverityHigh, "slsa-github-generator", "self-hosted-runner"},
+		{"source_repo", sdk.SeverityHigh, "example/repo", "attacker/repo"},
+		{"entry_point", sdk.SeverityHigh, "release.yml", "build.yml"},
+		{"materials_added", sdk.SeverityLow, "", "golang.org/x/sys"},
+		{"materials_removed", sdk.SeverityMedium, "example/repo", ""},
+		{"materials_digest_changed", sdk.SeverityLow, "sha256:3333", "sha256:6666"},
+		{"subjects_added", sdk.SeverityLow, "", "myapp-linux-arm64"},
+		{"subjects_removed", sdk.SeverityMedium, "myapp-darwin-amd64", ""},
+		{"subjects_digest_changed", sdk.SeverityMedium, "myapp-linux-amd64@sha256:1111", "myapp-linux-amd64@sha256:4444"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.change, func(t *testing.T) {
+			f, ok := changes[tt.change]
+			if !ok {
+				t.Fatalf("expected a %s finding with change %q", diffRuleID, tt.change)
+			}
+			if f.GetSeverity() != tt.severity {
+				t.Errorf("severity = %v, want %v", f.GetSeverity(), tt.severity)
+			}
+			meta := f.GetMetadata()
+			if !strings.Contains(meta["before"], tt.before) {
+				t.Errorf("before = %q, want it to contain %q", meta["before"], tt.before)
+			}
+			if !strings.Contains(meta["after"], tt.after) {
+				t.Errorf("after = %q, want it to contain %q", meta["after"], tt.after)
+			}
+		})
+	}
+
+	if _, ok := changes["build_type"]; ok {
+		t.Error("build type is unchanged and should not be reported")
+	}
+}
+
+func TestDiffIdenticalProvenanceHasNoFindings(t *testing.T) {
+	client := testClient(t)
+	path := filepath.Join(testdataDir(t), "diff", "base.intoto.jsonl")
+
+	resp := invokeTool(t, client, "diff", map[string]any{
+		"base": path,
+		"head": path,
+	})
+	if len(resp.GetFindings()) != 0 {
+		t.Errorf("expected no findings when diffing a file against itself, got %d", len(resp.GetFindings()))
+	}
+}
+
+func TestDiffDirectories(t *testing.T) {
+	client := testClient(t)
+
+	resp := invokeTool(t, client, "diff", map[string]any{
+		"base": filepath.Join(testdataDir(t), "with-provenance"),
+		"head": filepath.Join(testdataDir(t), "diff"),
+	})
+	if len(findByRule(resp.GetFindings(), diffRuleID)) == 0 {
+		t.Fatal("expected differences between the with-provenance and diff fixture directories")
+	}
+}
+
+func TestDiffRelativePathsResolveAgainstWorkspace(t *testing.T) {
+	client := testClient(t)
+
+	resp := invokeToolInWorkspace(t, client, "diff", filepath.Join(testdataDir(t), "diff"), map[string]any{
+		"base": "base.intoto.jsonl",
+		"head": "head.intoto.json",
+	})
+	if len(findByRule(resp.GetFindings(), diffRuleID)) == 0 {
+		t.Fatal("expected relative base/head paths to resolve against the workspace root")
+	}
+}
+
+func TestResolveInputPathStaysInWorkspace(t *testing.T) {
+	workspace := t.TempDir()
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "provenance.json"), "{}")
+	writeFile(t, filepath.Join(outside, "provenance.json"), "{}")
+	symlinkOrSkip(t, outside, filepath.Join(workspace, "escape"))
+
+	got, err := resolveInputPath("base", "provenance.json", workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(workspace, "provenance.json"); got != want {
+		t.Errorf("resolveInputPath() = %q, want %q", got, want)
+	}
+
+	outsidePath := filepath.Join(outside, "provenance.json")
+	if got, err := resolveInputPath("base", outsidePath, ""); err != nil || got != outsidePath {
+		t.Errorf("without a workspace root, resolveInputPath() = %q, %v; want the path unchanged", got, err)
+	}
+
+	for _, input := range []string{
+		outsidePath,
+		filepath.Join("..", filepath.Base(outside), "provenance.json"),
+		filepath.Join("escape", "provenance.json"),
+	} {
+		_, err := resolveInputPath("base", input, workspace)
+		if err == nil || !strings.Contains(err.Error(), "outside the workspace") {
+			t.Errorf("resolveInputPath(%q) error = %v, want it rejected as outside the workspace", input, err)
+		}
+	}
+}
+
+func TestDiffSkipsOversizedProvenance(t *testing.T) {
+	statement, err := os.ReadFile(filepath.Join(testdataDir(t), "diff", "base.intoto.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "base", "provenance.intoto.jsonl"), string(statement))
+	writeFile(t, filepath.Join(workspace, "head", "provenance.intoto.jsonl"), string(statement))
+	huge := filepath.Join(workspace, "head", "attestation.json")
+	writeFile(t, huge, "{}")
+	if err := os.Truncate(huge, defaultMaxFileSize+1); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := invokeToolInWorkspace(t, testClient(t), "diff", workspace, map[string]any{
+		"base": "base",
+		"head": "head",
+	})
+	found := findByRule(resp.GetFindings(), diffRuleID)
+	if len(found) != 1 {
+		t.Fatalf("expected only the oversized_skipped finding, got %v", found)
+	}
+	meta := found[0].GetMetadata()
+	if meta["change"] != "oversized_skipped" || meta["after"] != "head/attestation.json" || meta["before"] != "" {
+		t.Errorf("unexpected oversized_skipped metadata: %v", meta)
+	}
+	if found[0].GetSeverity() != sdk.SeverityInfo {
+		t.Errorf("severity = %v, want Info", found[0].GetSeverity())
+	}
+
+	if _, err := loadProvenanceView(context.Background(), huge); !errors.Is(err, errFileTooLarge) {
+		t.Errorf("loading an oversized file directly: err = %v, want errFileTooLarge", err)
+	}
+}
+
+func TestDiffDirectoriesMatchNestedProvenancePaths(t *testing.T) {
+	statement := func(builder string) string {
+		return `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2",` +
+			`"subject":[{"name":"myapp","digest":{"sha256":"1111111111111111111111111111111111111111111111111111111111111111"}}],` +
+			`"predicate":{"builder":{"id":"` + builder + `"}}}`
+	}
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "release-1", "attestations", "build-1.json"), statement("https://example.com/builder-a"))
+	writeFile(t, filepath.Join(workspace, "release-2", "attestations", "build-2.json"), statement("https://example.com/builder-b"))
+
+	resp := invokeToolInWorkspace(t, testClient(t), "diff", workspace, map[string]any{
+		"base": "release-1",
+		"head": "release-2",
+	})
+	found := findByRule(resp.GetFindings(), diffRuleID)
+	if len(found) != 1 || found[0].GetMetadata()["change"] != "builder_id" {
+		t.Fatalf("expected a builder_id change between the attestations/ files, got %v", found)
+	}
+}
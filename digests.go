@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// digestConsistencyRuleID flags subject digests a statement contradicts
+// itself on or that cannot be what their algorithm key says, typical of
+// malformed generators.
+const digestConsistencyRuleID = "PROV-046"
+
+// Reasons a subject digest is inconsistent.
+const (
+	digestReasonDuplicateSubject = "duplicate_subject"
+	digestReasonLength           = "digest_length_mismatch"
+	digestReasonBase64           = "digest_base64_encoded"
+	digestReasonNotHex           = "digest_not_lowercase_hex"
+)
+
+// digestHexLengths holds the hex length of each fixed-size algorithm of the
+// in-toto digest set. Algorithms whose length varies, such as gitCommit,
+// are not checked.
+var digestHexLengths = map[string]int{
+	"md5": 32, "sha1": 40, "sha224": 56, "sha256": 64, "sha384": 96, "sha512": 128,
+	"sha512_224": 56, "sha512_256": 64,
+	"sha3_224": 56, "sha3_256": 64, "sha3_384": 96, "sha3_512": 128,
+}
+
+// digestAlgorithmOfLength names the common algorithm a hex digest of each
+// length most likely comes from.
+var digestAlgorithmOfLength = map[int]string{32: "md5", 40: "sha1", 56: "sha224", 64: "sha256", 96: "sha384", 128: "sha512"}
+
+// digestProblem is an inconsistent digest of one subject.
+type digestProblem struct {
+	reason    string
+	severity  pluginv1.Severity
+	index     int
+	name      string
+	algorithm string
+	message   string
+	// metadata holds the reason's own details.
+	metadata [][2]string
+}
+
+// isHexDigest reports whether s is non-empty and made of hex digits of
+// either case. Its length is checked separately.
+func isHexDigest(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789abcdefABCDEF") == ""
+}
+
+// digestProblems checks the subjects of a statement for names listed twice
+// with different digests, digests whose length does not fit their
+// algorithm, and digests that are not lowercase hex, calling out base64,
+// which generators emit by mistake.
+func digestProblems(ps *parsedStatement) []digestProblem {
+	var problems []digestProblem
+	// first maps each subject name to the index of its first occurrence.
+	first := make(map[string]int)
+	for i, subj := range ps.Statement.Subject {
+		label := subj.Name
+		if label == "" {
+			label = strconv.Itoa(i)
+		}
+		if subj.Name != "" {
+			j, seen := first[subj.Name]
+			switch {
+			case !seen:
+				first[subj.Name] = i
+			case formatDigest(ps.Statement.Subject[j].Digest) != formatDigest(subj.Digest):
+				problems = append(problems, digestProblem{
+					reason: digestReasonDuplicateSubject, severity: sdk.SeverityMedium, index: i, name: subj.Name,
+					message: fmt.Sprintf("Subject %s is listed twice with different digests (subjects %d and %d)", subj.Name, j, i),
+					metadata: [][2]string{
+						{"first_subject_index", strconv.Itoa(j)},
+						{"first_digest", formatDigest(ps.Statement.Subject[j].Digest)},
+						{"digest", formatDigest(subj.Digest)},
+					},
+				})
+			}
+		}
+
+		for _, alg := range sortedKeys(subj.Digest) {
+			value := subj.Digest[alg]
+			if value == "" {
+				continue
+			}
+			want := digestHexLengths[alg]
+			problem := digestProblem{index: i, name: subj.Name, algorithm: alg}
+			switch {
+			case !isHexDigest(value):
+				problem.reason, problem.severity = digestReasonNotHex, sdk.SeverityLow
+				problem.message = fmt.Sprintf("Subject %s has a %s digest that is not hex", label, alg)
+				if decoded, err := decodeBase64(value); err == nil && (len(decoded)*2 == want || (want == 0 && digestAlgorithmOfLength[len(decoded)*2] != "")) {
+					problem.reason = digestReasonBase64
+					problem.message = fmt.Sprintf("Subject %s has a base64-encoded %s digest; in-toto digests are lowercase hex", label, alg)
+					problem.metadata = [][2]string{{"decoded_digest", hex.EncodeToString(decoded)}}
+				}
+			case want != 0 && len(value) != want:
+				problem.reason, problem.severity = digestReasonLength, sdk.SeverityMedium
+				problem.message = fmt.Sprintf("Subject %s has a %s digest of %d hex characters, expected %d", label, alg, len(value), want)
+				problem.metadata = [][2]string{{"expected_length", strconv.Itoa(want)}, {"actual_length", strconv.Itoa(len(value))}}
+				if likely := digestAlgorithmOfLength[len(value)]; likely != "" {
+					problem.message += fmt.Sprintf(", the length of %s", likely)
+					problem.metadata = append(problem.metadata, [2]string{"likely_algorithm", likely})
+				}
+			case value != strings.ToLower(value):
+				problem.reason, problem.severity = digestReasonNotHex, sdk.SeverityLow
+				problem.message = fmt.Sprintf("Subject %s has an uppercase %s digest; in-toto digests are lowercase hex", label, alg)
+			default:
+				continue
+			}
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDigestProblems(t *testing.T) {
+	const digest = "4b825dc642cb6eb9a060e54bf8d69288fbee4904b825dc642cb6eb9a060e54bf"
+	tests := []struct {
+		name     string
+		subjects string
+		reasons  []string
+	}{
+		{"consistent", `[{"name":"a","digest":{"sha256":"` + digest + `","gitCommit":"4b825dc6"}},{"name":"a","digest":{"sha256":"` + digest + `","gitCommit":"4b825dc6"}}]`, nil},
+		{"duplicate", `[{"name":"a","digest":{"sha256":"` + digest + `"}},{"name":"a","digest":{"sha256":"` + strings.Repeat("0", 64) + `"}}]`, []string{digestReasonDuplicateSubject}},
+		{"length", `[{"name":"a","digest":{"sha512":"` + digest + `"}}]`, []string{digestReasonLength}},
+		{"base64", `[{"name":"a","digest":{"sha256":"S4JdxkLLbrmgYOVL+NaSiPvuSQS4JdxkLLbrmgYOVL8="}}]`, []string{digestReasonBase64}},
+		{"not hex", `[{"name":"a","digest":{"sha256":"not-a-digest"}}]`, []string{digestReasonNotHex}},
+		{"uppercase", `[{"name":"a","digest":{"sha256":"` + strings.ToUpper(digest) + `"}}]`, []string{digestReasonNotHex}},
+	}
+	for _, tt := range tests {
+		statements, err := parseProvenance(context.Background(), []byte(`{"_type":"https://in-toto.io/Statement/v1","subject":`+tt.subjects+`,"predicate":{}}`))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var reasons []string
+		for _, p := range digestProblems(&statements[0]) {
+			reasons = append(reasons, p.reason)
+		}
+		if strings.Join(reasons, ",") != strings.Join(tt.reasons, ",") {
+			t.Errorf("%s: reasons = %v, want %v", tt.name, reasons, tt.reasons)
+		}
+	}
+}
+
+func TestScanSubjectDigests(t *testing.T) {
+	found := findByRule(invokeScan(t, testClient(t), filepath.Join(testdataDir(t), "subject-digests")).GetFindings(), digestConsistencyRuleID)
+	reasons := make(map[string]string)
+	for _, f := range found {
+		reasons[filepath.Base(f.GetLocation().GetFilePath())] = f.GetMetadata()["reason"] + "/" + severityNames[f.GetSeverity()]
+	}
+	want := map[string]string{
+		"duplicate-subjects.intoto.jsonl": digestReasonDuplicateSubject + "/medium",
+		"digest-length.intoto.jsonl":      digestReasonLength + "/medium",
+		"base64-digest.intoto.jsonl":      digestReasonBase64 + "/low",
+		"uppercase-digest.intoto.jsonl":   digestReasonNotHex + "/low",
+	}
+	if len(found) != len(want) {
+		t.Fatalf("expected %d %s findings, got %v", len(want), digestConsistencyRuleID, reasons)
+	}
+	for file, reason := range want {
+		if reasons[file] != reason {
+			t.Errorf("%s: got %q, want %q", file, reasons[file], reason)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// dormantWorkflowRuleID flags a GitHub Actions workflow that can still
+// attest or sign artifacts but never runs on its own: it is dispatched by
+// hand only, or its triggers are filtered to branches or paths the
+// repository does not have.
+const dormantWorkflowRuleID = "PROV-060"
+
+// Why a workflow is dormant.
+const (
+	dormantManualOnly      = "manual_only"
+	dormantMissingBranches = "missing_branches"
+	dormantMissingPaths    = "missing_paths"
+)
+
+// triggerFilters are the event filters a dormant trigger can be judged by.
+// The others, such as branches-ignore, are recorded only so that their
+// entries are not taken for those of the filter before them.
+var triggerFilters = map[string]bool{
+	"branches": true, "branches-ignore": true,
+	"paths": true, "paths-ignore": true,
+	"tags": true, "tags-ignore": true,
+}
+
+// workflowTrigger is an event of a workflow's on section with the positive
+// branch and path filters it lists. Negated entries are left out, and tags
+// is set when the event also filters on tags.
+type workflowTrigger struct {
+	event    string
+	line     int
+	branches []string
+	paths    []string
+	tags     bool
+}
+
+// trackTrigger reads a line of the workflow's on section: a list of
+// events after on itself, or an event key, or a filter of the last event
+// and its entries.
+func (w *workflowTracker) trackTrigger(trimmed string, indent, lineNum int) {
+	if indent == 0 {
+		_, value, _ := strings.Cut(trimmed, ":")
+		if value = yamlScalar(strings.TrimSpace(value)); value != "" {
+			for _, e := range strings.Split(strings.Trim(value, "[]"), ",") {
+				w.addTrigger(yamlScalar(strings.TrimSpace(e)), lineNum)
+			}
+		}
+		return
+	}
+	if w.triggerIndent == 0 {
+		w.triggerIndent = indent
+	}
+	if indent <= w.triggerIndent {
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok {
+			w.addTrigger(yamlScalar(strings.TrimSpace(item)), lineNum)
+		} else if m := yamlKey.FindStringSubmatch(trimmed); m != nil {
+			w.addTrigger(m[1], lineNum)
+		}
+		w.triggerFilter = ""
+		return
+	}
+	if len(w.triggers) == 0 {
+		return
+	}
+	t := &w.triggers[len(w.triggers)-1]
+	if m := yamlKey.FindStringSubmatch(trimmed); m != nil {
+		w.triggerFilter = ""
+		if !triggerFilters[m[1]] {
+			return
+		}
+		w.triggerFilter = m[1]
+		if strings.HasPrefix(m[1], "tags") {
+			t.tags = true
+		}
+		value := yamlScalar(strings.TrimSpace(trimmed[len(m[0]):]))
+		if value != "" {
+			for _, e := range strings.Split(strings.Trim(value, "[]"), ",") {
+				t.addFilter(w.triggerFilter, yamlScalar(strings.TrimSpace(e)))
+			}
+		}
+		return
+	}
+	if item, ok := strings.CutPrefix(trimmed, "- "); ok && w.triggerFilter != "" {
+		t.addFilter(w.triggerFilter, yamlScalar(strings.TrimSpace(item)))
+	}
+}
+
+func (w *workflowTracker) addTrigger(event string, lineNum int) {
+	if event != "" {
+		w.triggers = append(w.triggers, workflowTrigger{event: event, line: lineNum})
+	}
+}
+
+// addFilter records an entry of a branches or paths filter. Negated
+// entries only narrow the filter and are dropped.
+func (t *workflowTrigger) addFilter(filter, entry string) {
+	if entry == "" || strings.HasPrefix(entry, "!") {
+		return
+	}
+	switch filter {
+	case "branches":
+		t.branches = append(t.branches, entry)
+	case "paths":
+		t.paths = append(t.paths, entry)
+	}
+}
+
+// filtered reports whether the trigger is one that may never fire because
+// of its filters: a push or pull request event filtered by branch or path
+// but not by tag.
+func (t workflowTrigger) filtered() bool {
+	switch t.event {
+	case "push", "pull_request", "pull_request_target":
+		return !t.tags && (len(t.branches) > 0 || len(t.paths) > 0)
+	}
+	return false
+}
+
+// dormantWorkflow is a workflow, every trigger of which is manual or
+// filtered, with a job able to attest or sign artifacts.
+type dormantWorkflow struct {
+	path     string
+	triggers []workflowTrigger
+	job      string
+	step     stepRef
+	idToken  bool
+}
+
+// recordDormantCandidate records a workflow that attests or signs
+// artifacts and runs only when dispatched or on filtered events, to be
+// checked against the repository's branches and files once the walk is
+// over.
+func (s *scanSummary) recordDormantCandidate(filePath string, w *workflowTracker) {
+	if len(w.triggers) == 0 {
+		return
+	}
+	for _, t := range w.triggers {
+		if t.event != "workflow_dispatch" && !t.filtered() {
+			return
+		}
+	}
+	for _, j := range w.jobs {
+		if steps := j.signingSteps(); len(steps) > 0 {
+			s.dormantWorkflows = append(s.dormantWorkflows, dormantWorkflow{
+				path:     filePath,
+				triggers: w.triggers,
+				job:      j.name,
+				step:     steps[0],
+				idToken:  w.jobIDToken(j),
+			})
+			return
+		}
+	}
+}
+
+// gitBranches returns the local and remote-tracking branches of the
+// workspace's git repository, from its refs and packed-refs. ok is false
+// when the workspace has no git data to read them from.
+func gitBranches(fsys workspaceFS, root string) (branches []string, ok bool) {
+	dir := gitCommonDir(fsys, root)
+	if dir == "" {
+		return nil, false
+	}
+	add := func(ref string) {
+		if b, found := strings.CutPrefix(ref, "refs/heads/"); found {
+			branches = append(branches, b)
+		} else if r, found := strings.CutPrefix(ref, "refs/remotes/"); found {
+			if _, b, found := strings.Cut(r, "/"); found && b != "HEAD" {
+				branches = append(branches, b)
+			}
+		}
+	}
+	refs := filepath.Join(dir, "refs")
+	_ = fsys.WalkDir(refs, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(dir, p); err == nil {
+			add(filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if data, err := fsys.ReadFile(filepath.Join(dir, "packed-refs")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if fields := strings.Fields(line); len(fields) == 2 && !strings.HasPrefix(line, "#") {
+				add(fields[1])
+			}
+		}
+	}
+	return branches, len(branches) > 0
+}
+
+// branchFilterPattern compiles a GitHub Actions branch filter: * matches
+// within a path segment, ** across them, ? and + repeat the character
+// before them, and brackets enclose a character range.
+func branchFilterPattern(filter string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(filter); i++ {
+		switch c := filter[i]; c {
+		case '*':
+			if i+1 < len(filter) && filter[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?', '+', '[', ']':
+			b.WriteByte(c)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil
+	}
+	return re
+}
+
+// missingBranches returns the branch filters of the trigger matching none
+// of branches, or nil when any filter matches one.
+func (t workflowTrigger) missingBranches(branches []string) []string {
+	for _, f := range t.branches {
+		re := branchFilterPattern(f)
+		if re == nil {
+			return nil
+		}
+		for _, b := range branches {
+			if re.MatchString(b) {
+				return nil
+			}
+		}
+	}
+	return t.branches
+}
+
+// missingPaths returns the path filters of the trigger under whose literal
+// prefix the workspace holds nothing, or nil when any may match a file.
+func (t workflowTrigger) missingPaths(fsys workspaceFS, root string) []string {
+	for _, f := range t.paths {
+		literal := f
+		if i := strings.IndexAny(f, "*?[+"); i >= 0 {
+			literal = path.Dir(f[:i] + "x")
+		}
+		if literal == "." || literal == "" {
+			return nil
+		}
+		if _, err := fsys.Stat(filepath.Join(root, filepath.FromSlash(literal))); err == nil {
+			return nil
+		}
+	}
+	return t.paths
+}
+
+// checkDormantWorkflows flags the recorded workflows none of whose
+// triggers can fire on their own. Branch filters are only judged against
+// the repository's branches when its git data is in the workspace.
+func checkDormantWorkflows(_ context.Context, ws *workspaceScan) error {
+	if len(ws.summary.dormantWorkflows) == 0 {
+		return nil
+	}
+	fsys := ws.findings.files()
+	branches, hasRefs := gitBranches(fsys, ws.root)
+	for _, d := range ws.summary.dormantWorkflows {
+		var events, reasons, missingBranches, missingPaths []string
+		dormant := true
+		for _, t := range d.triggers {
+			events = append(events, t.event)
+			if t.event == "workflow_dispatch" {
+				continue
+			}
+			var mb, mp []string
+			if len(t.branches) > 0 && hasRefs {
+				mb = t.missingBranches(branches)
+			}
+			if len(t.paths) > 0 {
+				mp = t.missingPaths(fsys, ws.root)
+			}
+			if mb == nil && mp == nil {
+				dormant = false
+				break
+			}
+			missingBranches = append(missingBranches, mb...)
+			missingPaths = append(missingPaths, mp...)
+		}
+		if !dormant {
+			continue
+		}
+		if len(missingBranches) > 0 {
+			reasons = append(reasons, dormantMissingBranches)
+		}
+		if len(missingPaths) > 0 {
+			reasons = append(reasons, dormantMissingPaths)
+		}
+		message := fmt.Sprintf("Workflow only runs when dispatched by hand, yet job %s can still attest or sign artifacts", d.job)
+		if len(reasons) == 0 {
+			reasons = append(reasons, dormantManualOnly)
+		} else {
+			message = fmt.Sprintf("Workflow triggers are filtered to branches or paths the repository does not have, yet job %s can still attest or sign artifacts", d.job)
+		}
+		fb := ws.findings.Finding(dormantWorkflowRuleID, sdk.SeverityLow, sdk.ConfidenceMedium, message).
+			At(d.path, d.triggers[0].line, d.triggers[0].line).
+			WithMetadata("type", "dormant_workflow").
+			WithMetadata("reason", strings.Join(reasons, ",")).
+			WithMetadata("triggers", strings.Join(events, ",")).
+			WithMetadata("attestation_job", d.job).
+			WithMetadata("attestation_step", d.step.step).
+			WithMetadata("attestation_line", strconv.Itoa(d.step.line)).
+			WithMetadata("id_token", strconv.FormatBool(d.idToken)).
+			WithMetadata("git_refs", strconv.FormatBool(hasRefs))
+		if len(missingBranches) > 0 {
+			fb.WithMetadata("missing_branches", strings.Join(missingBranches, ","))
+		}
+		if len(missingPaths) > 0 {
+			fb.WithMetadata("missing_paths", strings.Join(missingPaths, ","))
+		}
+		fb.Done()
+	}
+	return nil
+}
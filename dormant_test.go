@@ -0,0 +1,101 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dormantWorkflowYAML is a workflow on the given triggers with a job
+// attesting its build.
+func dormantWorkflowYAML(on ...string) string {
+	return strings.Join(append(append([]string{}, on...),
+		"permissions:",
+		"  id-token: write",
+		"  attestations: write",
+		"jobs:",
+		"  release:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - run: make dist",
+		"      - uses: actions/attest-build-provenance@v1",
+		"        with:",
+		"          subject-path: dist/app",
+	), "\n") + "\n"
+}
+
+func TestScanDormantWorkflows(t *testing.T) {
+	tests := []struct {
+		name     string
+		on       []string
+		git      bool
+		reason   string
+		branches string
+		paths    string
+	}{
+		{name: "manual only", on: []string{"on: workflow_dispatch"}, reason: dormantManualOnly},
+		{name: "manual only with inputs", on: []string{"on:", "  workflow_dispatch:", "    inputs:", "      branches:", "        type: string"}, reason: dormantManualOnly},
+		{name: "missing branch", on: []string{"on:", "  push:", "    branches: [release/1.x]", "  workflow_dispatch:"}, git: true, reason: dormantMissingBranches, branches: "release/1.x"},
+		{name: "missing branch block list", on: []string{"on:", "  push:", "    branches:", "      - legacy", "      - '!main'"}, git: true, reason: dormantMissingBranches, branches: "legacy"},
+		{name: "existing branch", on: []string{"on:", "  push:", "    branches: [main]"}, git: true},
+		{name: "packed branch glob", on: []string{"on:", "  push:", "    branches: ['stable/**']"}, git: true},
+		{name: "remote branch", on: []string{"on:", "  push:", "    branches: [develop]"}, git: true},
+		{name: "branch without git data", on: []string{"on:", "  push:", "    branches: [legacy]"}},
+		{name: "missing path", on: []string{"on:", "  push:", "    paths:", "      - 'legacy/**'"}, reason: dormantMissingPaths, paths: "legacy/**"},
+		{name: "existing path", on: []string{"on:", "  push:", "    paths: ['src/**']"}},
+		{name: "tags", on: []string{"on:", "  push:", "    branches: [legacy]", "    tags: ['v*']"}, git: true},
+		{name: "other event", on: []string{"on: [workflow_dispatch, release]"}},
+		{name: "unfiltered push", on: []string{"on:", "  push:", "  workflow_dispatch:"}},
+	}
+	client := testClient(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), dormantWorkflowYAML(tt.on...))
+			writeFile(t, filepath.Join(workspace, "src", "main.go"), "package main\n")
+			if tt.git {
+				writeFile(t, filepath.Join(workspace, ".git", "refs", "heads", "main"), strings.Repeat("a", 40)+"\n")
+				writeFile(t, filepath.Join(workspace, ".git", "refs", "remotes", "origin", "develop"), strings.Repeat("b", 40)+"\n")
+				writeFile(t, filepath.Join(workspace, ".git", "packed-refs"), "# pack-refs with: peeled fully-peeled sorted\n"+strings.Repeat("c", 40)+" refs/heads/stable/2.0/fixes\n")
+			}
+
+			found := findByRule(invokeScan(t, client, workspace).GetFindings(), dormantWorkflowRuleID)
+			if tt.reason == "" {
+				if len(found) != 0 {
+					t.Errorf("expected no findings, got %v", found)
+				}
+				return
+			}
+			if len(found) != 1 {
+				t.Fatalf("expected one finding, got %d", len(found))
+			}
+			meta := found[0].GetMetadata()
+			if meta["reason"] != tt.reason || meta["attestation_job"] != "release" || meta["id_token"] != "true" {
+				t.Errorf("unexpected metadata %v", meta)
+			}
+			if meta["missing_branches"] != tt.branches || meta["missing_paths"] != tt.paths {
+				t.Errorf("missing branches %q and paths %q, want %q and %q", meta["missing_branches"], meta["missing_paths"], tt.branches, tt.paths)
+			}
+			if want := map[bool]string{true: "true", false: "false"}[tt.git]; meta["git_refs"] != want {
+				t.Errorf("git_refs = %q, want %q", meta["git_refs"], want)
+			}
+		})
+	}
+}
+
+func TestScanDormantWorkflowWithoutAttestation(t *testing.T) {
+	workspace := t.TempDir()
+	workflow := strings.Join([]string{
+		"on: workflow_dispatch",
+		"jobs:",
+		"  cleanup:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - run: make clean",
+	}, "\n") + "\n"
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "cleanup.yml"), workflow)
+
+	if found := findByRule(invokeScan(t, testClient(t), workspace).GetFindings(), dormantWorkflowRuleID); len(found) != 0 {
+		t.Errorf("expected no findings for a workflow that neither attests nor signs, got %d", len(found))
+	}
+}
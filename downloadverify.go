@@ -0,0 +1,492 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// verifiedPathMismatchRuleID flags build scripts that verify a download's
+// checksum or signature but then use a file the verification did not
+// cover: another download, or the same path downloaded again.
+const verifiedPathMismatchRuleID = "PROV-052"
+
+var (
+	// checksumFileSuffix matches the extension of a checksum file named
+	// after the file it covers, as in tool.tar.gz.sha256.
+	checksumFileSuffix = regexp.MustCompile(`(?i)\.(?:sha(?:1|256|512)(?:sums?)?|md5(?:sum)?|checksums?|asc|sig)$`)
+	// downloadURL matches a URL argument of a download command.
+	downloadURL = regexp.MustCompile(`^(?:https?|ftp)://`)
+	// hashComparison matches a command comparing a computed digest rather
+	// than printing it.
+	hashComparison = regexp.MustCompile(`==|!=|\s=\s|\bgrep\b|\bcmp\b|\bdiff\b|\btest\b|\[`)
+)
+
+var (
+	// checksumTools compute file digests.
+	checksumTools = map[string]bool{"sha256sum": true, "sha512sum": true, "sha1sum": true, "sha384sum": true, "shasum": true, "md5sum": true, "b2sum": true}
+	// interpreters run a script file given as their first argument.
+	interpreters = map[string]bool{"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "source": true, ".": true, "python": true, "python3": true, "perl": true, "ruby": true, "node": true}
+	// packageInstallers install package files given as arguments.
+	packageInstallers = map[string]bool{"dpkg": true, "rpm": true, "apt": true, "apt-get": true, "yum": true, "dnf": true, "apk": true, "pip": true, "pip3": true, "npm": true, "gem": true}
+	// fileMovers copy or move a file, and install puts it into use.
+	fileMovers = map[string]bool{"mv": true, "cp": true, "install": true}
+)
+
+// download is a file a build script downloaded.
+type download struct {
+	path string
+	line int
+	// verified is set once a checksum or signature check covers the file.
+	verified   bool
+	verifyLine int
+	// redownloaded is set when the path was downloaded again after an
+	// earlier download of it was verified.
+	redownloaded bool
+}
+
+// downloadFlow follows, through the commands of one job, Makefile target,
+// or Dockerfile stage, which files are downloaded, which of them a checksum
+// or signature check verifies, and which are then executed, extracted, or
+// installed.
+type downloadFlow struct {
+	section string
+	parser  *shellParser
+	// downloads holds the latest download of each path.
+	downloads map[string]*download
+	// verified lists every path a verification covered, and verifyLine the
+	// line of the first verification.
+	verified   []string
+	verifyLine int
+	reported   map[*download]bool
+}
+
+func newDownloadFlow() *downloadFlow {
+	f := &downloadFlow{}
+	f.reset("")
+	return f
+}
+
+// reset starts following a new job, target, or stage.
+func (f *downloadFlow) reset(section string) {
+	f.section = section
+	f.parser = newShellParser()
+	f.downloads = make(map[string]*download)
+	f.verified = nil
+	f.verifyLine = 0
+	f.reported = make(map[*download]bool)
+}
+
+// add follows a logical command and flags the files it uses that a
+// verification elsewhere in the section does not cover.
+func (f *downloadFlow) add(findings *findingSet, filePath string, cmd logicalCommand, origin commandOrigin, action *actionTracker) {
+	switch cmd.context {
+	case contextRunCommand, contextRecipe, contextDockerInstruction, contextEcho:
+	default:
+		return
+	}
+	if cmd.section != f.section {
+		f.reset(cmd.section)
+	}
+	text := cmd.text
+	if cmd.context == contextRecipe {
+		text = strings.ReplaceAll(text, "$$", "$")
+	}
+	for _, c := range f.parser.parse(text) {
+		for _, used := range f.used(c) {
+			f.check(findings, filePath, cmd, used, origin, action)
+		}
+		f.verify(c, cmd.line, text)
+		// Digests compared in a test are computed in substitutions, as in
+		// [ "$(sha256sum tool.tgz | cut -d' ' -f1)" = "$SUM" ].
+		for _, w := range c.words {
+			for _, sub := range commandSubstitutions(w) {
+				for _, inner := range newShellParser().parse(sub) {
+					f.verify(inner, cmd.line, text)
+				}
+			}
+		}
+		f.move(c)
+		for _, p := range downloadedPaths(c) {
+			d := &download{path: p, line: cmd.line}
+			if prev := f.lookup(p); prev != nil && (prev.verified || prev.redownloaded) {
+				d.redownloaded = true
+				d.verifyLine = prev.verifyLine
+			}
+			f.downloads[cleanScriptPath(p)] = d
+		}
+	}
+}
+
+// lookup returns the latest download of a path, matching a relative path by
+// its base name so a cd between commands does not hide the file.
+func (f *downloadFlow) lookup(p string) *download {
+	p = cleanScriptPath(p)
+	if d := f.downloads[p]; d != nil {
+		return d
+	}
+	for key, d := range f.downloads {
+		if scriptPathsMatch(key, p) {
+			return d
+		}
+	}
+	return nil
+}
+
+// cleanScriptPath normalizes a path as a script names it.
+func cleanScriptPath(p string) string {
+	return path.Clean(strings.TrimPrefix(p, "*"))
+}
+
+// scriptPathsMatch reports whether two cleaned paths name the same file:
+// they are equal, or one is relative and they share a base name.
+func scriptPathsMatch(a, b string) bool {
+	if a == b {
+		return true
+	}
+	return (!path.IsAbs(a) || !path.IsAbs(b)) && path.Base(a) == path.Base(b)
+}
+
+// commandSubstitutions returns the commands of the $(...) and backtick
+// substitutions in a word.
+func commandSubstitutions(word string) []string {
+	var subs []string
+	for i := 0; i < len(word); i++ {
+		switch {
+		case strings.HasPrefix(word[i:], "$("):
+			depth := 0
+			for j := i + 1; j < len(word); j++ {
+				if word[j] == '(' {
+					depth++
+				} else if word[j] == ')' {
+					if depth--; depth == 0 {
+						subs = append(subs, word[i+2:j])
+						i = j
+						break
+					}
+				}
+			}
+		case word[i] == '`':
+			if end := strings.IndexByte(word[i+1:], '`'); end >= 0 {
+				subs = append(subs, word[i+1:i+1+end])
+				i += end + 1
+			}
+		}
+	}
+	return subs
+}
+
+// downloadedPaths returns the files a curl or wget command writes.
+func downloadedPaths(c shellCommand) []string {
+	var out []string
+	remoteName := false
+	var urls []string
+	args := c.words[1:]
+	switch c.words[0] {
+	case "curl":
+		for i := 0; i < len(args); i++ {
+			a := args[i]
+			switch {
+			case downloadURL.MatchString(a):
+				urls = append(urls, a)
+			case a == "--output" || a == "-o" || isShortFlagCluster(a, 'o'):
+				if i+1 < len(args) {
+					out = append(out, args[i+1])
+					i++
+				}
+			case strings.HasPrefix(a, "--output="):
+				out = append(out, strings.TrimPrefix(a, "--output="))
+			case a == "--remote-name" || a == "--remote-name-all" || hasShortFlag(a, 'O'):
+				remoteName = true
+			}
+		}
+		if len(out) == 0 && !remoteName {
+			out = c.redirects
+		}
+	case "wget":
+		remoteName = true
+		for i := 0; i < len(args); i++ {
+			a := args[i]
+			switch {
+			case downloadURL.MatchString(a):
+				urls = append(urls, a)
+			case a == "--output-document" || a == "-O" || isShortFlagCluster(a, 'O'):
+				if i+1 < len(args) {
+					out = append(out, args[i+1])
+					i++
+				}
+				remoteName = false
+			case strings.HasPrefix(a, "--output-document="):
+				out = append(out, strings.TrimPrefix(a, "--output-document="))
+				remoteName = false
+			case hasShortFlag(a, 'O'):
+				// -qO- and -Ofile hold the output in the cluster.
+				out = append(out, a[strings.IndexByte(a, 'O')+1:])
+				remoteName = false
+			}
+		}
+	default:
+		return nil
+	}
+	if remoteName {
+		for _, raw := range urls {
+			if u, err := url.Parse(raw); err == nil && strings.Trim(u.Path, "/") != "" {
+				out = append(out, path.Base(u.Path))
+			}
+		}
+	}
+	var paths []string
+	for _, p := range out {
+		if p != "-" && p != "/dev/null" && p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// hasShortFlag reports whether a word is a cluster of short options, such
+// as -fsSLO, holding the option flag.
+func hasShortFlag(word string, flag byte) bool {
+	return len(word) > 1 && word[0] == '-' && word[1] != '-' && strings.IndexByte(word, flag) > 0
+}
+
+// isShortFlagCluster reports whether a word is a cluster of short options,
+// such as -fsSLo, ending in the option flag, which takes the next word.
+func isShortFlagCluster(word string, flag byte) bool {
+	return len(word) > 2 && word[0] == '-' && word[1] != '-' && word[len(word)-1] == flag
+}
+
+// verify records the files a checksum or signature command verifies. A
+// checksum list whose entries cannot be told covers every download so far.
+func (f *downloadFlow) verify(c shellCommand, lineNum int, text string) {
+	names, all, ok := verifiedPaths(c, text)
+	if !ok {
+		return
+	}
+	if f.verifyLine == 0 {
+		f.verifyLine = lineNum
+	}
+	if all {
+		f.verified = append(f.verified, "*")
+		for _, d := range f.downloads {
+			d.verified, d.verifyLine = true, lineNum
+		}
+		return
+	}
+	for _, name := range names {
+		f.verified = append(f.verified, name)
+		if d := f.lookup(name); d != nil {
+			d.verified, d.verifyLine = true, lineNum
+		}
+	}
+}
+
+// verifiedPaths returns the files a command verifies, or all when it checks
+// a checksum list whose entries cannot be told; ok is false for commands
+// that verify nothing.
+func verifiedPaths(c shellCommand, text string) (names []string, all, ok bool) {
+	tool := path.Base(c.words[0])
+	args := c.words[1:]
+	switch {
+	case checksumTools[tool]:
+		check := false
+		var files []string
+		for i := 0; i < len(args); i++ {
+			a := args[i]
+			switch {
+			case a == "--check" || hasShortFlag(a, 'c'):
+				check = true
+			case a == "-a" || a == "--algorithm":
+				i++
+			case strings.HasPrefix(a, "-") && a != "-":
+			default:
+				files = append(files, a)
+			}
+		}
+		if !check {
+			// Hashing a file only verifies it when the digest is compared.
+			if !hashComparison.MatchString(text) {
+				return nil, false, false
+			}
+			return files, false, len(files) > 0
+		}
+		if len(files) == 0 || files[0] == "-" {
+			return checksumListEntries(c.input, c.pipedFrom)
+		}
+		for _, file := range files {
+			if checksumFileSuffix.MatchString(file) && !strings.Contains(strings.ToUpper(path.Base(file)), "SUMS") {
+				names = append(names, checksumFileSuffix.ReplaceAllString(file, ""))
+				continue
+			}
+			if c.pipedFrom == nil {
+				return nil, true, true
+			}
+		}
+		if len(names) == 0 {
+			return nil, true, true
+		}
+		return names, false, true
+	case tool == "gpg" || tool == "gpg2" || tool == "gpgv":
+		for i, a := range args {
+			if a != "--verify" && tool != "gpgv" {
+				continue
+			}
+			rest := nonFlagWords(args[i+1:])
+			if tool == "gpgv" {
+				rest = nonFlagWords(args)
+			}
+			switch len(rest) {
+			case 0:
+				return nil, false, false
+			case 1:
+				return []string{checksumFileSuffix.ReplaceAllString(rest[0], "")}, false, true
+			default:
+				return rest[1:], false, true
+			}
+		}
+	case tool == "cosign" && len(args) > 0 && strings.HasPrefix(args[0], "verify-blob"):
+		return []string{args[len(args)-1]}, false, true
+	}
+	return nil, false, false
+}
+
+// checksumListEntries returns the files named by a checksum list read from
+// a here-string or a pipe: the last word of echoed "<digest>  <file>" text,
+// a file grep selects, or the file a single-file checksum list covers.
+func checksumListEntries(input string, from *shellCommand) (names []string, all, ok bool) {
+	if input != "" {
+		if fields := strings.Fields(input); len(fields) > 0 {
+			return []string{fields[len(fields)-1]}, false, true
+		}
+	}
+	if from == nil {
+		return nil, true, true
+	}
+	args := nonFlagWords(from.words[1:])
+	switch from.words[0] {
+	case "echo", "printf":
+		if fields := strings.Fields(strings.Join(args, " ")); len(fields) > 0 {
+			return []string{fields[len(fields)-1]}, false, true
+		}
+	case "grep":
+		if len(args) > 0 {
+			return []string{args[0]}, false, true
+		}
+	case "cat":
+		if len(args) == 1 && checksumFileSuffix.MatchString(args[0]) {
+			return []string{checksumFileSuffix.ReplaceAllString(args[0], "")}, false, true
+		}
+	}
+	return nil, true, true
+}
+
+// nonFlagWords returns the words that are not options.
+func nonFlagWords(words []string) []string {
+	var out []string
+	for _, w := range words {
+		if !strings.HasPrefix(w, "-") || w == "-" {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// used returns the files a command executes, extracts, or installs.
+func (f *downloadFlow) used(c shellCommand) []string {
+	tool := c.words[0]
+	args := c.words[1:]
+	var paths []string
+	switch {
+	case f.lookup(tool) != nil && strings.Contains(tool, "/"):
+		paths = append(paths, tool)
+	case interpreters[tool]:
+		if rest := nonFlagWords(args); len(rest) > 0 {
+			paths = append(paths, rest[0])
+		}
+	case tool == "tar":
+		for i, a := range args {
+			switch {
+			case strings.HasPrefix(a, "--file="):
+				paths = append(paths, strings.TrimPrefix(a, "--file="))
+			case (a == "--file" || i == 0 && !strings.HasPrefix(a, "-") && strings.HasSuffix(a, "f") || isShortFlagCluster(a, 'f') || a == "-f") && i+1 < len(args):
+				paths = append(paths, args[i+1])
+			}
+		}
+	case tool == "unzip" || tool == "gunzip":
+		if rest := nonFlagWords(args); len(rest) > 0 {
+			paths = append(paths, rest[0])
+		}
+	case packageInstallers[tool]:
+		paths = append(paths, nonFlagWords(args)...)
+	case tool == "install" || (tool == "mv" || tool == "cp") && len(args) > 0 && strings.Contains(args[len(args)-1], "bin"):
+		if rest := nonFlagWords(args); len(rest) > 1 {
+			paths = append(paths, rest[:len(rest)-1]...)
+		}
+	}
+	var used []string
+	for _, p := range paths {
+		if f.lookup(p) != nil {
+			used = append(used, p)
+		}
+	}
+	return used
+}
+
+// move carries a download's state to where mv or cp puts it.
+func (f *downloadFlow) move(c shellCommand) {
+	if !fileMovers[c.words[0]] {
+		return
+	}
+	rest := nonFlagWords(c.words[1:])
+	if len(rest) != 2 {
+		return
+	}
+	src := f.lookup(rest[0])
+	if src == nil {
+		return
+	}
+	dst := *src
+	dst.path = rest[1]
+	f.downloads[cleanScriptPath(rest[1])] = &dst
+}
+
+// check flags the use of a download the section's verifications do not
+// cover, once per download.
+func (f *downloadFlow) check(findings *findingSet, filePath string, cmd logicalCommand, used string, origin commandOrigin, action *actionTracker) {
+	d := f.lookup(used)
+	if d == nil || d.verified || f.verifyLine == 0 || f.reported[d] {
+		return
+	}
+	f.reported[d] = true
+	verified := append([]string(nil), f.verified...)
+	sort.Strings(verified)
+
+	kind, message := "unverified_path_used", fmt.Sprintf("Build script verifies %s but uses %s, which no verification covers", strings.Join(verified, ", "), used)
+	if d.redownloaded {
+		kind, message = "redownloaded_after_verification", fmt.Sprintf("Build script downloads %s again after verifying it and uses the unverified copy", used)
+	}
+	fb := findings.Finding(
+		verifiedPathMismatchRuleID,
+		sdk.SeverityMedium,
+		sdk.ConfidenceMedium,
+		message,
+	).
+		At(filePath, cmd.line, cmd.line).
+		WithMetadata("type", kind).
+		WithMetadata("used_path", used).
+		WithMetadata("verified_paths", strings.Join(verified, ",")).
+		WithMetadata("download_line", strconv.Itoa(d.line))
+	if d.redownloaded {
+		fb.WithMetadata("verify_line", strconv.Itoa(d.verifyLine))
+	}
+	if cmd.section != "" {
+		fb.WithMetadata("section", cmd.section)
+	}
+	action.annotate(origin.annotate(fb)).Done()
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShellParser(t *testing.T) {
+	p := newShellParser()
+	cmds := p.parse(`VERSION=1.2.3 && FILE="tool-${VERSION}.tgz"; curl -fsSLo "$FILE" https://example.com/$FILE 2>/dev/null && echo "${SUM}  ${FILE}" | sha256sum -c - > check.log`)
+	var got [][]string
+	for _, c := range cmds {
+		got = append(got, c.words)
+	}
+	want := [][]string{
+		{"VERSION=1.2.3"},
+		{"FILE=tool-1.2.3.tgz"},
+		{"curl", "-fsSLo", "tool-1.2.3.tgz", "https://example.com/tool-1.2.3.tgz"},
+		{"echo", "${SUM}  tool-1.2.3.tgz"},
+		{"sha256sum", "-c", "-"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("words = %q, want %q", got, want)
+	}
+	if len(cmds[2].redirects) != 0 || !reflect.DeepEqual(cmds[4].redirects, []string{"check.log"}) {
+		t.Errorf("redirects = %q, %q", cmds[2].redirects, cmds[4].redirects)
+	}
+	if cmds[4].pipedFrom == nil || cmds[4].pipedFrom.words[0] != "echo" {
+		t.Errorf("sha256sum not piped from echo: %+v", cmds[4].pipedFrom)
+	}
+
+	cmds = p.parse(`sha256sum --check <<< "$SUM  tool.tgz" && curl -s https://example.com/x > "out file" 2>&1`)
+	if len(cmds) != 2 || cmds[0].input != "$SUM  tool.tgz" || !reflect.DeepEqual(cmds[1].redirects, []string{"out file"}) {
+		t.Errorf("unexpected commands: %+v", cmds)
+	}
+}
+
+func TestDownloadFlow(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []string
+		// want maps the lines of findings to their type.
+		want map[int]string
+	}{
+		{
+			name: "verified then extracted",
+			script: []string{
+				`curl -fsSLo helm.tgz https://get.helm.sh/helm-v3.14.0-linux-amd64.tar.gz`,
+				`echo "${HELM_SHA256}  helm.tgz" | sha256sum -c -`,
+				`tar -xzf helm.tgz -C /usr/local/bin --strip-components=1 linux-amd64/helm`,
+			},
+		},
+		{
+			name: "checksum file named after the download",
+			script: []string{
+				`curl -fsSLO https://github.com/example/tool/releases/download/v1.0.0/tool_linux_amd64.tar.gz`,
+				`curl -fsSLO https://github.com/example/tool/releases/download/v1.0.0/tool_linux_amd64.tar.gz.sha256`,
+				`sha256sum --check tool_linux_amd64.tar.gz.sha256`,
+				`tar xzf tool_linux_amd64.tar.gz`,
+			},
+		},
+		{
+			name: "grep from a checksum list",
+			script: []string{
+				`wget -q https://releases.example.com/v2/tool_2.0_linux_amd64.zip https://releases.example.com/v2/SHA256SUMS`,
+				`grep tool_2.0_linux_amd64.zip SHA256SUMS | sha256sum -c -`,
+				`unzip tool_2.0_linux_amd64.zip -d /opt/tool`,
+			},
+		},
+		{
+			name: "whole checksum list",
+			script: []string{
+				`wget https://releases.example.com/v2/tool.zip`,
+				`wget https://releases.example.com/v2/SHA256SUMS`,
+				`sha256sum --ignore-missing -c SHA256SUMS`,
+				`unzip tool.zip`,
+			},
+		},
+		{
+			name: "digest compared in a test",
+			script: []string{
+				`curl -sSL -o /tmp/install.sh https://example.com/install.sh`,
+				`[ "$(sha256sum /tmp/install.sh | cut -d' ' -f1)" = "$INSTALL_SHA" ] || exit 1`,
+				`bash /tmp/install.sh`,
+			},
+		},
+		{
+			name: "signature then moved into use",
+			script: []string{
+				`curl -sSLo kubectl https://dl.k8s.io/release/v1.30.0/bin/linux/amd64/kubectl`,
+				`curl -sSLo kubectl.sig https://dl.k8s.io/release/v1.30.0/bin/linux/amd64/kubectl.sig`,
+				`cosign verify-blob --certificate-identity krel-staging@k8s-releng-prod.iam.gserviceaccount.com --signature kubectl.sig kubectl`,
+				`install -m 0755 kubectl /usr/local/bin/kubectl`,
+			},
+		},
+		{
+			name: "no verification at all",
+			script: []string{
+				`curl -fsSLo tool.tgz https://example.com/tool.tgz`,
+				`tar xzf tool.tgz`,
+			},
+		},
+		{
+			name: "verifies one file, extracts another",
+			script: []string{
+				`curl -fsSLo tool.tgz https://example.com/tool-1.0.tgz`,
+				`curl -fsSLo tool-plugins.tgz https://example.com/plugins-1.0.tgz`,
+				`echo "$TOOL_SHA  tool.tgz" | sha256sum -c`,
+				`tar xzf tool.tgz`,
+				`tar xzf tool-plugins.tgz`,
+			},
+			want: map[int]string{5: "unverified_path_used"},
+		},
+		{
+			name: "redownloaded after verification",
+			script: []string{
+				`curl -fsSLo /tmp/installer.sh https://example.com/installer.sh`,
+				`sha256sum -c <<< "$INSTALLER_SHA  /tmp/installer.sh"`,
+				`curl -fsSLo /tmp/installer.sh https://example.com/installer.sh?latest=1`,
+				`sh /tmp/installer.sh`,
+			},
+			want: map[int]string{4: "redownloaded_after_verification"},
+		},
+		{
+			name: "verified file, unverified file moved into use",
+			script: []string{
+				`FILE=terraform_1.8.0_linux_amd64.zip`,
+				`curl -fsSLO https://releases.hashicorp.com/terraform/1.8.0/$FILE`,
+				`curl -fsSLo terraform-provider.zip https://example.com/provider.zip`,
+				`curl -fsSLO https://releases.hashicorp.com/terraform/1.8.0/terraform_1.8.0_SHA256SUMS`,
+				`grep $FILE terraform_1.8.0_SHA256SUMS | sha256sum -c`,
+				`mv terraform-provider.zip /usr/local/bin/`,
+			},
+			want: map[int]string{6: "unverified_path_used"},
+		},
+		{
+			name: "hashed but not compared",
+			script: []string{
+				`curl -fsSLo a.tgz https://example.com/a.tgz`,
+				`curl -fsSLo b.tgz https://example.com/b.tgz`,
+				`sha256sum a.tgz`,
+				`tar xzf b.tgz`,
+			},
+		},
+		{
+			name: "executes the download directly",
+			script: []string{
+				`curl -fsSLo ./bin/tool https://example.com/tool && curl -fsSLo ./bin/helper https://example.com/helper`,
+				`echo "$TOOL_SHA  ./bin/tool" | sha256sum -c && chmod +x ./bin/tool ./bin/helper`,
+				`./bin/helper --version`,
+			},
+			want: map[int]string{3: "unverified_path_used"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := &findingSet{}
+			flow := newDownloadFlow()
+			for i, text := range tt.script {
+				flow.add(findings, "build.sh", logicalCommand{line: i + 1, context: contextRunCommand, text: text}, commandOrigin{}, nil)
+			}
+			got := make(map[int]string)
+			for _, f := range findings.items {
+				for _, kv := range f.metadata {
+					if kv[0] == "type" {
+						got[f.startLine] = kv[1]
+					}
+				}
+			}
+			if len(got) == 0 {
+				got = nil
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findings = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanVerifiedPathMismatch(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), strings.Join([]string{
+		"FROM debian:12.5 AS tools",
+		"ARG TOOL=tool_1.0_linux_amd64.tar.gz",
+		"RUN curl -fsSLO https://example.com/${TOOL} \\",
+		"    && curl -fsSLo extra.tar.gz https://example.com/extra.tar.gz \\",
+		"    && echo \"${TOOL_SHA256}  ${TOOL}\" | sha256sum -c - \\",
+		"    && tar xzf ${TOOL} && tar xzf extra.tar.gz",
+		"FROM debian:12.5",
+		"RUN tar xzf extra.tar.gz",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, "Makefile"), strings.Join([]string{
+		"tools:",
+		"\tcurl -fsSLo bin/lint https://example.com/lint",
+		"\techo \"$(LINT_SHA)  bin/lint\" | sha256sum -c",
+		"\tcurl -fsSLo bin/lint https://example.com/lint-latest",
+		"\t./bin/lint run",
+	}, "\n")+"\n")
+
+	found := findByRule(invokeScan(t, testClient(t), workspace).GetFindings(), verifiedPathMismatchRuleID)
+	type key struct {
+		path string
+		line int32
+	}
+	got := make(map[key]string)
+	for _, f := range found {
+		got[key{f.GetLocation().GetFilePath(), f.GetLocation().GetStartLine()}] = f.GetMetadata()["used_path"]
+	}
+	want := map[key]string{
+		{"Dockerfile", 3}: "extra.tar.gz",
+		{"Makefile", 5}:   "./bin/lint",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findings = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// Categories of host details a build can embed. Each logical command is
+// reported at most once per category, by the first pattern that matches.
+const (
+	embedIdentity = "identity"
+	embedHome     = "home"
+	embedPath     = "path"
+)
+
+// hostEmbeddingPatterns detect build commands that bake the identity or
+// paths of the build machine into their outputs. They are matched against
+// logical commands, joined across backslash continuations, and ordered from
+// the most specific. Keyword prescreens ASCII commands as in
+// nonDeterministicPatterns. Embedding patterns only apply to commands that
+// write into an output: ldflags, -D defines, or generated sources and
+// configs.
+var hostEmbeddingPatterns = []struct {
+	Keyword     string
+	Category    string
+	Pattern     *regexp.Regexp
+	Embedding   bool
+	Reason      string
+	Remediation string
+}{
+	{
+		"ldflags", embedIdentity,
+		regexp.MustCompile("-ldflags\\b.*(?:\\$\\(\\s*(?:shell\\s+)?(?:whoami|hostname|id\\s+-un)\\s*\\)|`\\s*(?:whoami|hostname)\\s*`)"), false,
+		"Go -ldflags embed the build user or host name",
+		"Set -X values from fixed inputs such as the commit or SOURCE_DATE_EPOCH",
+	},
+	{
+		"hostname", embedIdentity,
+		regexp.MustCompile("\\$\\(\\s*(?:shell\\s+)?hostname\\b[^)]*\\)|`\\s*hostname\\s*`"), false,
+		"Embedding the build host name makes output non-reproducible",
+		"Use a fixed builder identifier instead of the host name",
+	},
+	{
+		"hostname", embedIdentity,
+		regexp.MustCompile(`\$\{?HOSTNAME\b`), true,
+		"Embedding the build host name makes output non-reproducible",
+		"Use a fixed builder identifier instead of the host name",
+	},
+	{
+		"who", embedIdentity,
+		regexp.MustCompile("\\$\\(\\s*(?:shell\\s+)?(?:whoami|id\\s+-un)\\s*\\)|`\\s*whoami\\s*`"), false,
+		"Embedding the build user makes output non-reproducible",
+		"Use a fixed value instead of the user running the build",
+	},
+	{
+		"user", embedIdentity,
+		regexp.MustCompile(`\$\{?USER\b`), true,
+		"Embedding the build user makes output non-reproducible",
+		"Use a fixed value instead of the user running the build",
+	},
+	{
+		"home", embedHome,
+		regexp.MustCompile(`\$\{?HOME\b`), true,
+		"Embedding the home directory makes output depend on the build machine",
+		"Use paths relative to the source root, or map them with -trimpath or -ffile-prefix-map",
+	},
+	{
+		"$", embedPath,
+		regexp.MustCompile(`\$\{?(?:PWD|GITHUB_WORKSPACE|CI_PROJECT_DIR|WORKSPACE|CURDIR)\b|\$\((?:pwd|CURDIR|shell pwd)\)`), true,
+		"Embedding the absolute build path makes output depend on the checkout location",
+		"Use paths relative to the source root, or map them with -trimpath or -ffile-prefix-map",
+	},
+}
+
+// capturedGitCommand matches a git command whose output a command captures,
+// in a $(...), Makefile $(shell ...), or backtick substitution, and
+// captures the git command.
+var capturedGitCommand = regexp.MustCompile("(?:\\$\\(\\s*(?:shell\\s+)?|`\\s*)(git\\s+[^)`]*)")
+
+// vcsEmbeddingPatterns detect captured git commands whose output differs
+// between builds of the same commit. Flag is the option or placeholder
+// responsible, and Unless, if set, matches options that make the output
+// deterministic again.
+var vcsEmbeddingPatterns = []struct {
+	Flag        string
+	Pattern     *regexp.Regexp
+	Unless      *regexp.Regexp
+	Reason      string
+	Remediation string
+}{
+	{
+		"--dirty", regexp.MustCompile(`\bdescribe\b.*\s--dirty\b`), nil,
+		"Embedding git describe --dirty output marks builds of a modified tree, so builds of the same commit differ",
+		"Embed the exact tag or commit SHA, and fail release builds on a dirty tree instead",
+	},
+	{
+		"--always", regexp.MustCompile(`\bdescribe\b.*\s--always\b`), nil,
+		"Embedding git describe --always output falls back to an abbreviated hash on untagged commits, which depends on the clone's depth and fetched tags",
+		"Embed git describe --tags --exact-match on release tags, or the full commit SHA",
+	},
+	{
+		"--abbrev-ref", regexp.MustCompile(`\brev-parse\b.*\s--abbrev-ref\b`), nil,
+		"Embedding git rev-parse --abbrev-ref HEAD embeds the branch name, so builds of the same commit from different branches differ",
+		"Embed the exact tag or commit SHA instead of the branch name",
+	},
+	{
+		"--show-current", regexp.MustCompile(`\bbranch\b.*\s--show-current\b`), nil,
+		"Embedding git branch --show-current embeds the branch name, so builds of the same commit from different branches differ",
+		"Embed the exact tag or commit SHA instead of the branch name",
+	},
+	{
+		"symbolic-ref", regexp.MustCompile(`\bsymbolic-ref\b`), nil,
+		"Embedding git symbolic-ref HEAD embeds the branch name, so builds of the same commit from different branches differ",
+		"Embed the exact tag or commit SHA instead of the branch name",
+	},
+	{
+		"%cd", regexp.MustCompile(`\b(?:log|show)\b.*--(?:format|pretty)[=\s]*(?:"[^"]*|'[^']*|\S*)%cd`), deterministicDate,
+		"Embedding git log --format=%cd formats the commit date per the builder's log.date setting and time zone",
+		"Use %ct, or --date=unix or --date=iso-strict, for a fixed date format",
+	},
+	{
+		"%ad", regexp.MustCompile(`\b(?:log|show)\b.*--(?:format|pretty)[=\s]*(?:"[^"]*|'[^']*|\S*)%ad`), deterministicDate,
+		"Embedding git log --format=%ad formats the author date per the builder's log.date setting and time zone",
+		"Use %at, or --date=unix or --date=iso-strict, for a fixed date format",
+	},
+}
+
+// deterministicDate matches git --date formats that do not depend on the
+// builder's time zone or locale.
+var deterministicDate = regexp.MustCompile(`--date[=\s](?:unix|raw|iso8601-strict|iso-strict|iso8601|iso|rfc2822|rfc|short)(?:\s|$|["'])`)
+
+// embeddingContext matches commands that write values into build outputs:
+// Go ldflags and -X settings, C and CMake -D defines, and redirects or
+// in-place edits generating source or config files.
+var embeddingContext = regexp.MustCompile(`-ldflags\b|(?:^|\s)-X[\s=]|(?:^|\s)-D[A-Za-z_]\w*=|(?:>>?|\btee\s+(?:-a\s+)?)\s*["']?\S+\.(?:h|hh|hpp|c|cc|go|py|rs|java|js|ts|json|ya?ml|toml|conf|cfg|ini|properties|env)\b|\bsed\s+(?:.*\s)?-i\b|\benvsubst\b`)
+
+// testSectionWords mark CI jobs and Makefile targets that only test the
+// build; what they embed does not ship.
+var testSectionWords = map[string]bool{"test": true, "tests": true, "check": true, "checks": true}
+
+// isTestSection reports whether a CI job or Makefile target name looks
+// test-only, such as test, unit-tests, or check_format.
+func isTestSection(section string) bool {
+	for _, word := range strings.FieldsFunc(strings.ToLower(section), func(r rune) bool {
+		return r == '-' || r == '_' || r == '.' || r == ':' || r == '/'
+	}) {
+		if testSectionWords[word] {
+			return true
+		}
+	}
+	return false
+}
+
+// logicalCommand is a command joined across backslash continuations,
+// located at its first line.
+type logicalCommand struct {
+	line    int
+	context lineContext
+	section string
+	text    string
+}
+
+// commandJoiner joins the lines of a config into logical commands.
+type commandJoiner struct {
+	pending *logicalCommand
+}
+
+// add feeds the next line's command text and returns the logical command it
+// completes, if any.
+func (j *commandJoiner) add(lineNum int, lc lineContext, section, text string) (logicalCommand, bool) {
+	if j.pending == nil {
+		j.pending = &logicalCommand{line: lineNum, context: lc, section: section}
+	}
+	text = strings.TrimSpace(text)
+	continued := strings.HasSuffix(text, `\`)
+	j.pending.text += strings.TrimSpace(strings.TrimSuffix(text, `\`))
+	if continued {
+		j.pending.text += " "
+		return logicalCommand{}, false
+	}
+	return j.flush()
+}
+
+// flush returns the logical command still being joined, if any.
+func (j *commandJoiner) flush() (logicalCommand, bool) {
+	if j.pending == nil {
+		return logicalCommand{}, false
+	}
+	cmd := *j.pending
+	j.pending = nil
+	return cmd, true
+}
+
+// reportHostEmbedding flags a logical command that embeds the build user,
+// host name, home directory, or absolute build path. Commands in test-only
+// jobs and targets drop to Low confidence.
+func reportHostEmbedding(findings *findingSet, filePath string, cmd logicalCommand, origin commandOrigin, action *actionTracker) {
+	ascii := isASCII(cmd.text)
+	// embeddingContext is only matched once a pattern needing it passes its
+	// keyword prescreen, since on long commands it costs more than all of
+	// the prescreens together.
+	var embedding, checkedEmbedding bool
+	reported := make(map[string]bool)
+	for _, p := range hostEmbeddingPatterns {
+		if reported[p.Category] {
+			continue
+		}
+		if ascii && !containsFoldASCII(cmd.text, p.Keyword) {
+			continue
+		}
+		if p.Embedding && !checkedEmbedding {
+			embedding, checkedEmbedding = embeddingContext.MatchString(cmd.text), true
+		}
+		if p.Embedding && !embedding {
+			continue
+		}
+		if !p.Pattern.MatchString(cmd.text) {
+			continue
+		}
+		reported[p.Category] = true
+		fb := newEmbeddingFinding(findings, filePath, cmd, p.Reason, p.Remediation)
+		action.annotate(origin.annotate(fb)).Done()
+	}
+}
+
+// reportVCSEmbedding flags a logical command that captures the output of a
+// git command which differs between builds of the same commit, such as
+// git describe --dirty or a branch name, once per command. Exact commit
+// SHAs and tags are deterministic and not flagged.
+func reportVCSEmbedding(findings *findingSet, filePath string, cmd logicalCommand, origin commandOrigin, action *actionTracker) {
+	if !strings.Contains(cmd.text, "git") {
+		return
+	}
+	for _, m := range capturedGitCommand.FindAllStringSubmatch(cmd.text, -1) {
+		for _, p := range vcsEmbeddingPatterns {
+			if !p.Pattern.MatchString(m[1]) || p.Unless != nil && p.Unless.MatchString(m[1]) {
+				continue
+			}
+			fb := newEmbeddingFinding(findings, filePath, cmd, p.Reason, p.Remediation).
+				WithMetadata("vcs_flag", p.Flag)
+			action.annotate(origin.annotate(fb)).Done()
+			return
+		}
+	}
+}
+
+// newEmbeddingFinding starts a PROV-003 finding for a logical command that
+// embeds details of the build machine or checkout. Commands in test-only
+// jobs and targets drop to Low confidence.
+func newEmbeddingFinding(findings *findingSet, filePath string, cmd logicalCommand, reason, remediation string) *findingBuilder {
+	confidence := cmd.context.confidence()
+	if isTestSection(cmd.section) {
+		confidence = sdk.ConfidenceLow
+	}
+	fb := findings.Finding(
+		"PROV-003",
+		sdk.SeverityMedium,
+		confidence,
+		fmt.Sprintf("Build reproducibility risk: %s", reason),
+	).
+		At(filePath, cmd.line, cmd.line).
+		WithMetadata("type", "reproducibility_risk").
+		WithMetadata("reason", reason).
+		WithMetadata("remediation", remediation).
+		WithMetadata("context", string(cmd.context))
+	if cmd.section != "" {
+		fb.WithMetadata("section", cmd.section)
+	}
+	return fb
+}
+
+// isCMakeFile reports whether a base name is a CMake script.
+func isCMakeFile(name string) bool {
+	return name == "CMakeLists.txt" || strings.HasSuffix(strings.ToLower(name), ".cmake")
+}
+
+var (
+	// configureFileCall matches a CMake configure_file call and captures its
+	// first argument, the template.
+	configureFileCall = regexp.MustCompile(`(?i)\bconfigure_file\s*\(\s*"?([^\s")]+)`)
+	// sourceDirVariable matches a CMake source or build directory variable
+	// in a template, in @VAR@ or ${VAR} form.
+	sourceDirVariable = regexp.MustCompile(`[@$]\{?((?:CMAKE_CURRENT|CMAKE|PROJECT)_(?:SOURCE|BINARY)_DIR)[@}]`)
+)
+
+// maxTemplateSize bounds how much of a configure_file template is read.
+const maxTemplateSize = 1 << 20
+
+// cmakeConfigure joins CMake configure_file calls, whose arguments may
+// span lines, and checks their templates.
+type cmakeConfigure struct {
+	line int
+	args string
+}
+
+// add feeds the next line of a CMake script and flags a completed
+// configure_file call whose template substitutes an absolute source or
+// build directory, which then ends up in the generated, often installed,
+// file.
+func (c *cmakeConfigure) add(findings *findingSet, filePath string, lineNum int, line string) {
+	if c.line == 0 {
+		if !strings.Contains(strings.ToLower(line), "configure_file") {
+			return
+		}
+		c.line = lineNum
+	}
+	c.args += " " + strings.TrimSpace(line)
+	if !strings.Contains(c.args, ")") {
+		return
+	}
+	call, callLine := c.args, c.line
+	c.line, c.args = 0, ""
+
+	m := configureFileCall.FindStringSubmatch(call)
+	if m == nil {
+		return
+	}
+	template := strings.TrimPrefix(m[1], "${CMAKE_CURRENT_SOURCE_DIR}/")
+	if strings.Contains(template, "${") || filepath.IsAbs(template) {
+		return
+	}
+	f, err := findings.files().Open(filepath.Join(filepath.Dir(filePath), filepath.FromSlash(template)))
+	if err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	data, err := io.ReadAll(io.LimitReader(f, maxTemplateSize))
+	if err != nil {
+		return
+	}
+	v := sourceDirVariable.FindSubmatch(data)
+	if v == nil {
+		return
+	}
+	reason := "CMake configure_file templates an absolute source or build directory into a generated file"
+	findings.Finding(
+		"PROV-003",
+		sdk.SeverityMedium,
+		sdk.ConfidenceMedium,
+		fmt.Sprintf("Build reproducibility risk: %s", reason),
+	).
+		At(filePath, callLine, callLine).
+		WithMetadata("type", "reproducibility_risk").
+		WithMetadata("reason", reason).
+		WithMetadata("remediation", "Substitute paths relative to CMAKE_INSTALL_PREFIX, or map them with -ffile-prefix-map").
+		WithMetadata("context", string(contextOther)).
+		WithMetadata("template", template).
+		WithMetadata("variable", string(v[1])).
+		Done()
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIsTestSection(t *testing.T) {
+	tests := []struct {
+		section string
+		want    bool
+	}{
+		{"test", true},
+		{"unit-tests", true},
+		{"check_format", true},
+		{"build", false},
+		{"attestation", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isTestSection(tt.section); got != tt.want {
+			t.Errorf("isTestSection(%q) = %v, want %v", tt.section, got, tt.want)
+		}
+	}
+}
+
+func TestCommandJoiner(t *testing.T) {
+	var j commandJoiner
+	if _, ok := j.add(3, contextRunCommand, "build", `go build \`); ok {
+		t.Fatal("continued line completed a command")
+	}
+	cmd, ok := j.add(4, contextRunCommand, "build", `  -ldflags "-X main.host=$(hostname)"`)
+	if !ok || cmd.line != 3 || cmd.text != `go build -ldflags "-X main.host=$(hostname)"` {
+		t.Errorf("got %+v, %v", cmd, ok)
+	}
+	if _, ok := j.flush(); ok {
+		t.Error("flush returned a completed command")
+	}
+}
+
+func TestScanHostEmbedding(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), strings.Join([]string{
+		"build:",
+		"\tgo build \\",
+		"\t  -ldflags \"-X main.builder=$$(whoami) -X main.root=$(CURDIR)\" ./cmd/app",
+		"\techo \"building in $$HOME\"",
+		"\techo \"#define SRC \\\"$$PWD\\\"\" > version.h",
+		"test:",
+		"\techo \"$$(hostname)\" > testdata/host.txt && go build -ldflags \"-X main.host=$$(hostname)\"",
+	}, "\n")+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	got := make(map[int][]map[string]string)
+	for _, f := range findByRule(resp.GetFindings(), "PROV-003") {
+		meta := f.GetMetadata()
+		meta["confidence"] = confidenceNames[f.GetConfidence()]
+		got[int(f.GetLocation().GetStartLine())] = append(got[int(f.GetLocation().GetStartLine())], meta)
+	}
+	reasons := make(map[string]bool)
+	for _, meta := range got[2] {
+		reasons[meta["reason"]] = meta["remediation"] != ""
+	}
+	if len(got[2]) != 2 || !reasons["Go -ldflags embed the build user or host name"] ||
+		!reasons["Embedding the absolute build path makes output depend on the checkout location"] {
+		t.Errorf("expected ldflags identity and path findings at line 2, got %v", got[2])
+	}
+	if len(got[4]) != 0 {
+		t.Errorf("expected no finding for $HOME outside an embedding command, got %v", got[4])
+	}
+	if len(got[5]) != 1 || !strings.Contains(got[5][0]["reason"], "absolute build path") {
+		t.Errorf("expected a build path finding at line 5, got %v", got[5])
+	}
+	if len(got[7]) != 1 || got[7][0]["confidence"] != "low" || got[7][0]["section"] != "test" {
+		t.Errorf("expected one low-confidence finding in the test target, got %v", got[7])
+	}
+}
+
+func TestScanHostEmbeddingMakeShell(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), strings.Join([]string{
+		"build:",
+		"\tgo build -ldflags \"-X main.user=$(shell whoami)\" ./cmd/app",
+		"\techo \"#define HOST \\\"$(shell hostname -s)\\\"\" > version.h",
+		"\techo \"#define USER \\\"$(shell whoami)\\\"\" >> version.h",
+	}, "\n")+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	got := make(map[int][]string)
+	for _, f := range findByRule(resp.GetFindings(), "PROV-003") {
+		line := int(f.GetLocation().GetStartLine())
+		got[line] = append(got[line], f.GetMetadata()["reason"])
+	}
+	want := map[int]string{
+		2: "Go -ldflags embed the build user or host name",
+		3: "Embedding the build host name makes output non-reproducible",
+		4: "Embedding the build user makes output non-reproducible",
+	}
+	for line, reason := range want {
+		if !slices.Contains(got[line], reason) {
+			t.Errorf("line %d: expected %q for a $(shell ...) substitution, got %v", line, reason, got[line])
+		}
+	}
+}
+
+func TestScanVCSEmbedding(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), strings.Join([]string{
+		"VERSION := $(shell git describe --tags --dirty)",
+		"COMMIT := $(shell git rev-parse HEAD)",
+		"TAG := $(shell git describe --tags --exact-match)",
+		"build:",
+		"\tgo build -ldflags \"-X main.branch=$$(git rev-parse --abbrev-ref HEAD)\" ./cmd/app",
+		"\tgo build -ldflags \"-X main.date=$$(git log -1 --format='%h %cd')\" ./cmd/app",
+		"\tgo build -ldflags \"-X main.date=$$(git log -1 --format=%cd --date=iso-strict)\" ./cmd/app",
+		"\techo `git describe --always` > VERSION.txt",
+		"\tgit describe --dirty",
+	}, "\n")+"\n")
+
+	got := make(map[int32]string)
+	for _, f := range findByRule(invokeScan(t, testClient(t), workspace).GetFindings(), "PROV-003") {
+		if flag := f.GetMetadata()["vcs_flag"]; flag != "" {
+			if !strings.Contains(f.GetMetadata()["reason"], flag) {
+				t.Errorf("reason %q does not name %s", f.GetMetadata()["reason"], flag)
+			}
+			got[f.GetLocation().GetStartLine()] = flag
+		}
+	}
+	want := map[int32]string{1: "--dirty", 5: "--abbrev-ref", 6: "%cd", 8: "--always"}
+	if len(got) != len(want) {
+		t.Errorf("findings = %v, want %v", got, want)
+	}
+	for line, flag := range want {
+		if got[line] != flag {
+			t.Errorf("line %d: vcs_flag = %q, want %q", line, got[line], flag)
+		}
+	}
+}
+
+func TestScanCMakeConfigureFile(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "CMakeLists.txt"), strings.Join([]string{
+		"project(app C)",
+		"configure_file(",
+		"  ${CMAKE_CURRENT_SOURCE_DIR}/config.h.in",
+		"  ${CMAKE_BINARY_DIR}/config.h)",
+		"configure_file(version.h.in version.h @ONLY)",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, "config.h.in"), "#define DATA_DIR \"@CMAKE_SOURCE_DIR@/data\"\n")
+	writeFile(t, filepath.Join(workspace, "version.h.in"), "#define VERSION \"@PROJECT_VERSION@\"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	var configured []map[string]string
+	for _, f := range findByRule(resp.GetFindings(), "PROV-003") {
+		if f.GetMetadata()["template"] != "" {
+			if f.GetLocation().GetStartLine() != 2 {
+				t.Errorf("configure_file finding at line %d, want 2", f.GetLocation().GetStartLine())
+			}
+			configured = append(configured, f.GetMetadata())
+		}
+	}
+	if len(configured) != 1 || configured[0]["template"] != "config.h.in" || configured[0]["variable"] != "CMAKE_SOURCE_DIR" {
+		t.Errorf("expected one configure_file finding for config.h.in, got %v", configured)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// envPrefix starts the name of every environment variable that sets a
+// plugin-wide default for a scan input, as NOX_PROVENANCE_<INPUT>: for
+// example NOX_PROVENANCE_MAX_FILE_SIZE defaults max_file_size.
+const envPrefix = "NOX_PROVENANCE_"
+
+// envInputs lists the scan inputs that may be defaulted from the
+// environment. workspace_root, workspace_archive, and changed_files are
+// deliberately absent: they are per request.
+var envInputs = map[string]bool{
+	"fail_on_severity":             true,
+	"required_slsa_level":          true,
+	"follow_symlinks":              true,
+	"respect_gitignore":            true,
+	"skip_dirs":                    true,
+	"replace_skip_dirs":            true,
+	"check_images":                 true,
+	"check_sbom":                   true,
+	"check_ci":                     true,
+	"check_source_subjects":        true,
+	"check_gitlab_provenance":      true,
+	"assume_produces_artifacts":    true,
+	"follow_scripts":               true,
+	"collect_metrics":              true,
+	"scan_archives":                true,
+	"emit_confirmations":           true,
+	"min_lockfile_overlap":         true,
+	"min_sha_pinned":               true,
+	"staleness_days":               true,
+	"provenance_dirs":              true,
+	"extra_provenance_patterns":    true,
+	"max_depth":                    true,
+	"concurrency":                  true,
+	"max_file_size":                true,
+	"file_time_budget_ms":          true,
+	"disabled_rules":               true,
+	"trusted_builders":             true,
+	"secret_allowlist":             true,
+	"action_denylist":              true,
+	"action_allowlist":             true,
+	"min_attestations_per_subject": true,
+	"policy_files":                 true,
+	"allowed_source_refs":          true,
+	"attestation_naming":           true,
+	"trusted_registries":           true,
+	"vendored_binary_allowlist":    true,
+}
+
+// inputDefaults holds scan input values read from the environment at
+// startup. Values stay strings, which every input parser accepts.
+type inputDefaults map[string]string
+
+// envDefaults is the configuration loaded by run. It is empty in tests.
+var envDefaults inputDefaults
+
+// loadEnvDefaults reads NOX_PROVENANCE_* variables from environ, given in
+// the form returned by os.Environ. Unknown variables and values the scan
+// tool would reject are errors, so a misconfigured host fails at startup
+// instead of on every request.
+func loadEnvDefaults(environ []string) (inputDefaults, error) {
+	defaults := make(inputDefaults)
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(key, envPrefix) {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(key, envPrefix))
+		if !envInputs[name] {
+			return nil, fmt.Errorf("unknown environment variable %s: no scan input %q", key, name)
+		}
+		defaults[name] = value
+	}
+	if _, err := parseScanOptions(defaults.apply(nil)); err != nil {
+		return nil, fmt.Errorf("invalid %s environment default: %w", envPrefix+"*", err)
+	}
+	return defaults, nil
+}
+
+// apply returns input with the defaults added for every key the request did
+// not set. input itself is not modified.
+func (d inputDefaults) apply(input map[string]any) map[string]any {
+	if len(d) == 0 {
+		return input
+	}
+	merged := make(map[string]any, len(input)+len(d))
+	for name, value := range d {
+		merged[name] = value
+	}
+	for name, value := range input {
+		merged[name] = value
+	}
+	return merged
+}
+
+// applied lists the defaults the request did not override as sorted
+// "name=value" pairs, recording where the effective configuration came from.
+func (d inputDefaults) applied(input map[string]any) []string {
+	var pairs []string
+	for name, value := range d {
+		if _, set := input[name]; !set {
+			pairs = append(pairs, name+"="+value)
+		}
+	}
+	sort.Strings(pairs)
+	return pairs
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setEnvDefaults installs defaults for the duration of a test.
+func setEnvDefaults(t *testing.T, defaults inputDefaults) {
+	t.Helper()
+	prev := envDefaults
+	envDefaults = defaults
+	t.Cleanup(func() { envDefaults = prev })
+}
+
+func TestLoadEnvDefaults(t *testing.T) {
+	defaults, err := loadEnvDefaults([]string{
+		"PATH=/usr/bin",
+		"NOX_PROVENANCE_MAX_FILE_SIZE=1024",
+		"NOX_PROVENANCE_DISABLED_RULES=prov-003,PROV-020",
+		"NOX_PROVENANCE_CHECK_SBOM=false",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defaults) != 3 || defaults["max_file_size"] != "1024" || defaults["check_sbom"] != "false" {
+		t.Errorf("unexpected defaults %v", defaults)
+	}
+
+	opts, err := parseScanOptions(defaults.apply(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.maxFileSize != 1024 || opts.checkSBOM || !opts.disabledRules["PROV-003"] || !opts.disabledRules["PROV-020"] {
+		t.Errorf("defaults not applied: %+v", opts)
+	}
+}
+
+func TestLoadEnvDefaultsRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want string
+	}{
+		{"unknown variable", "NOX_PROVENANCE_MAX_FILESIZE=10", "unknown environment variable NOX_PROVENANCE_MAX_FILESIZE"},
+		{"workspace root", "NOX_PROVENANCE_WORKSPACE_ROOT=/src", "unknown environment variable"},
+		{"bad integer", "NOX_PROVENANCE_MAX_FILE_SIZE=big", "max_file_size must be an integer"},
+		{"bad boolean", "NOX_PROVENANCE_CHECK_CI=maybe", "check_ci must be a boolean"},
+		{"unknown rule", "NOX_PROVENANCE_DISABLED_RULES=PROV-999", `unknown rule "PROV-999"`},
+		{"summary rule", "NOX_PROVENANCE_DISABLED_RULES=PROV-000", "PROV-000 cannot be disabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadEnvDefaults([]string{tt.env})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestEnvDefaultsRequestPrecedence(t *testing.T) {
+	defaults := inputDefaults{"max_depth": "2", "check_ci": "false"}
+	input := map[string]any{"max_depth": float64(5)}
+
+	merged := defaults.apply(input)
+	if merged["max_depth"] != float64(5) || merged["check_ci"] != "false" {
+		t.Errorf("unexpected merged input %v", merged)
+	}
+	if len(input) != 1 {
+		t.Errorf("apply modified the request input: %v", input)
+	}
+	if got := strings.Join(defaults.applied(input), ";"); got != "check_ci=false" {
+		t.Errorf("applied = %q, want check_ci=false", got)
+	}
+}
+
+func TestScanEnvDefaults(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), "FROM golang:latest\n")
+	setEnvDefaults(t, inputDefaults{"disabled_rules": "PROV-003,PROV-020"})
+
+	resp := invokeScan(t, testClient(t), workspace)
+	for _, id := range []string{"PROV-003", "PROV-020"} {
+		if found := findByRule(resp.GetFindings(), id); len(found) != 0 {
+			t.Errorf("expected %s to be disabled by the environment, got %d findings", id, len(found))
+		}
+	}
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["env_defaults"] != "disabled_rules=PROV-003,PROV-020" {
+		t.Errorf("env_defaults = %q", meta["env_defaults"])
+	}
+
+	// The request input takes precedence over the environment.
+	resp = invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root": workspace,
+		"disabled_rules": []any{},
+	})
+	if found := findByRule(resp.GetFindings(), "PROV-003"); len(found) == 0 {
+		t.Error("expected PROV-003 once the request overrides disabled_rules")
+	}
+	if meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata(); meta["env_defaults"] != "" {
+		t.Errorf("expected no env_defaults when the request overrides them, got %q", meta["env_defaults"])
+	}
+}
+
+func TestScanTrustedBuilders(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "a.intoto.jsonl"),
+		levelStatement("https://github.com/actions/runner@v2", "https://example.com/build", `[{"name":"a","digest":{"sha256":"1"}}]`, `[]`)+"\n"+
+			levelStatement("https://ci.internal.example/runner", "https://example.com/build", `[{"name":"b","digest":{"sha256":"2"}}]`, `[]`)+"\n")
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root":   workspace,
+		"trusted_builders": "HTTPS://GitHub.com/actions/",
+	})
+
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["untrusted_builders"] != "https://ci.internal.example/runner" || meta["untrusted_builder_count"] != "1" {
+		t.Errorf("untrusted_builders = %q (%s)", meta["untrusted_builders"], meta["untrusted_builder_count"])
+	}
+
+	resp = invokeScan(t, testClient(t), workspace)
+	if _, set := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()["untrusted_builders"]; set {
+		t.Error("expected no untrusted_builders without trusted_builders")
+	}
+}
+
+func TestRulesReportEnvDisabledRules(t *testing.T) {
+	setEnvDefaults(t, inputDefaults{"disabled_rules": "PROV-003"})
+
+	resp := invokeTool(t, testClient(t), "rules", map[string]any{})
+	for _, f := range resp.GetFindings() {
+		want := f.GetRuleId() == "PROV-003"
+		if got := f.GetMetadata()["disabled_by_default"] == "true"; got != want {
+			t.Errorf("%s: disabled_by_default = %q", f.GetRuleId(), f.GetMetadata()["disabled_by_default"])
+		}
+	}
+}
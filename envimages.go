@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// unpinnedEnvImageRuleID flags build environment images, such as dev
+// containers and CI job and service containers, referenced without a
+// digest.
+const unpinnedEnvImageRuleID = "PROV-039"
+
+// Where a build environment image is declared.
+const (
+	envImageDevcontainer = "devcontainer"
+	envImageContainer    = "container"
+	envImageService      = "service"
+	envImageJob          = "job_image"
+)
+
+// isDevcontainerConfig reports whether a base name is a dev container
+// configuration.
+func isDevcontainerConfig(name string) bool {
+	return name == "devcontainer.json" || name == ".devcontainer.json"
+}
+
+// envImageRef is a build environment image found in a config.
+type envImageRef struct {
+	line int
+	raw  string
+	kind string
+	// job is the CI job declaring the image, and service the service name.
+	job     string
+	service string
+}
+
+// envImageBlock is the container, image, or services mapping whose nested
+// lines are being read.
+type envImageBlock struct {
+	key    string
+	indent int
+	// service is the service mapping being read, at serviceIndent.
+	service       string
+	serviceIndent int
+}
+
+// envImageTracker follows the CI job and service containers of a GitHub
+// workflow (container: and services:) or GitLab CI config (image: and
+// services:) line by line.
+type envImageTracker struct {
+	// keys are the keys that declare images on the platform.
+	keys  map[string]bool
+	block *envImageBlock
+	refs  []envImageRef
+}
+
+// newEnvImageTracker returns a tracker for the CI platform of a config, or
+// nil when the platform declares no job containers.
+func newEnvImageTracker(platform string) *envImageTracker {
+	switch platform {
+	case platformGitHub:
+		return &envImageTracker{keys: map[string]bool{"container": true, "services": true}}
+	case platformGitLab:
+		return &envImageTracker{keys: map[string]bool{"image": true, "services": true}}
+	}
+	return nil
+}
+
+// track reads the next line of the config.
+func (t *envImageTracker) track(line string, lineNum int, lc lineContext, section string) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || lc == contextComment || lc == contextRunCommand {
+		return
+	}
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	item, isItem := strings.CutPrefix(trimmed, "- ")
+	// Sequence items may sit at the indentation of their key.
+	if b := t.block; b != nil && (indent < b.indent || indent == b.indent && !(isItem && b.key == "services")) {
+		t.block = nil
+	}
+	key := yamlKey.FindStringSubmatch(item)
+	value := ""
+	if key != nil {
+		value = yamlScalar(strings.TrimSpace(item[len(key[0]):]))
+	}
+	job := section
+	if t.keys[job] || job == "default" {
+		// Top-level defaults of a GitLab config belong to no job.
+		job = ""
+	}
+
+	if t.block == nil {
+		if key == nil || isItem || !t.keys[key[1]] {
+			return
+		}
+		kind := envImageContainer
+		switch key[1] {
+		case "image":
+			kind = envImageJob
+		case "services":
+			kind = envImageService
+		}
+		if value != "" && key[1] != "services" {
+			t.add(lineNum, value, kind, job, "")
+			return
+		}
+		t.block = &envImageBlock{key: key[1], indent: indent, serviceIndent: -1}
+		return
+	}
+
+	b := t.block
+	switch {
+	case b.key != "services":
+		// container: and image: mappings name the image in image: (GitHub)
+		// or name: (GitLab).
+		if key != nil && (key[1] == "image" || key[1] == "name") && value != "" {
+			kind := envImageContainer
+			if b.key == "image" {
+				kind = envImageJob
+			}
+			t.add(lineNum, value, kind, job, "")
+		}
+	case isItem && b.serviceIndent < 0:
+		// GitLab services: "- image" or "- name: image".
+		switch {
+		case key == nil:
+			t.add(lineNum, yamlScalar(item), envImageService, job, "")
+		case key[1] == "name" && value != "":
+			t.add(lineNum, value, envImageService, job, "")
+		}
+	default:
+		if b.serviceIndent < 0 || indent <= b.serviceIndent {
+			if key != nil && value == "" {
+				b.service, b.serviceIndent = key[1], indent
+			}
+			return
+		}
+		if key != nil && (key[1] == "image" || key[1] == "name") && value != "" {
+			t.add(lineNum, value, envImageService, job, b.service)
+		}
+	}
+}
+
+// add records an image reference. References built from expressions or
+// variables cannot be judged and are skipped.
+func (t *envImageTracker) add(lineNum int, raw, kind, job, service string) {
+	if raw == "" || strings.ContainsAny(raw, "${") {
+		return
+	}
+	t.refs = append(t.refs, envImageRef{line: lineNum, raw: raw, kind: kind, job: job, service: service})
+}
+
+// report flags the tracked images that are not pinned by digest.
+func (t *envImageTracker) report(findings *findingSet, filePath string) {
+	for _, ref := range t.refs {
+		reportEnvImage(findings, filePath, ref)
+	}
+}
+
+// reportEnvImage flags a build environment image referenced by tag (Medium)
+// or by latest or no tag at all (High). Digest-pinned references are
+// immutable and pass.
+func reportEnvImage(findings *findingSet, filePath string, ref envImageRef) {
+	parsed, ok := parseImageRef(ref.raw)
+	if !ok || parsed.digest != "" {
+		return
+	}
+	severity := sdk.SeverityMedium
+	reason := fmt.Sprintf("tag %s can be moved to a different image", parsed.tag)
+	switch {
+	case strings.LastIndex(ref.raw, ":") < strings.LastIndex(ref.raw, "/") || !strings.Contains(ref.raw, ":"):
+		severity = sdk.SeverityHigh
+		reason = "without a tag it resolves to latest, which changes with every push of the image"
+	case parsed.tag == "latest":
+		severity = sdk.SeverityHigh
+		reason = "latest changes with every push of the image"
+	}
+	fb := findings.Finding(
+		unpinnedEnvImageRuleID,
+		severity,
+		sdk.ConfidenceHigh,
+		fmt.Sprintf("Build environment image %s is not pinned by digest: %s", ref.raw, reason),
+	).
+		At(filePath, ref.line, ref.line).
+		WithMetadata("type", "unpinned_build_image").
+		WithMetadata("image", ref.raw).
+		WithMetadata("image_repository", parsed.repository).
+		WithMetadata("image_tag", parsed.tag).
+		WithMetadata("declared_in", ref.kind)
+	if ref.job != "" {
+		fb.WithMetadata("job", ref.job)
+	}
+	if ref.service != "" {
+		fb.WithMetadata("service", ref.service)
+	}
+	fb.Done()
+}
+
+// devcontainerKey matches a key of a dev container config and captures it.
+var devcontainerKey = regexp.MustCompile(`["']?(image|dockerfile|dockerFile)["']?\s*:`)
+
+// scanDevcontainer checks the image of a dev container config, which is
+// JSON with comments, and links a Dockerfile it builds from into the
+// Dockerfile checks, as a reference followed like a script.
+func scanDevcontainer(ctx context.Context, findings *findingSet, filePath string, summary *scanSummary) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := findings.files().ReadFile(filePath)
+	if err != nil {
+		summary.filesUnreadable++
+		return nil
+	}
+	converted, err := json5ToJSON(data)
+	if err != nil {
+		return nil
+	}
+	var config struct {
+		Image string `json:"image"`
+		Build struct {
+			Dockerfile string `json:"dockerfile"`
+		} `json:"build"`
+		// dockerFile is the legacy top-level spelling.
+		DockerFile string `json:"dockerFile"`
+	}
+	if json.Unmarshal(converted, &config) != nil {
+		return nil
+	}
+
+	// Lines are those of the first occurrence of each key.
+	lines := make(map[string]int)
+	for _, m := range devcontainerKey.FindAllSubmatchIndex(data, -1) {
+		key := strings.ToLower(string(data[m[2]:m[3]]))
+		if lines[key] == 0 {
+			lines[key] = 1 + bytes.Count(data[:m[0]], []byte("\n"))
+		}
+	}
+	if config.Image != "" {
+		reportEnvImage(findings, filePath, envImageRef{line: lines["image"], raw: config.Image, kind: envImageDevcontainer})
+	}
+	dockerfile := config.Build.Dockerfile
+	if dockerfile == "" {
+		dockerfile = config.DockerFile
+	}
+	if dockerfile != "" && resolvable(dockerfile) {
+		summary.scriptRefs = append(summary.scriptRefs, scriptRef{
+			from:      filePath,
+			line:      lines["dockerfile"],
+			invokedBy: workspacePath(findings.root, filePath),
+			script:    path.Clean(dockerfile),
+			dir:       filepath.Dir(filePath),
+			explicit:  true,
+			format:    formatDockerfile,
+		})
+	}
+	return nil
+}
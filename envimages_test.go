@@ -0,0 +1,137 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanWorkflowEnvImages(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "ci.yml"), strings.Join([]string{
+		"on: push",
+		"jobs:",
+		"  build:",
+		"    container: golang:1.22",
+		"    services:",
+		"      redis:",
+		"        image: redis",
+		"        ports:",
+		"          - 6379:6379",
+		"      db:",
+		"        image: postgres@sha256:" + strings.Repeat("ab", 32),
+		"    steps:",
+		"      - uses: some/action@" + strings.Repeat("a", 40),
+		"        with:",
+		"          image: ignored:latest",
+		"  lint:",
+		"    container:",
+		"      image: ghcr.io/example/lint:latest",
+		"      credentials:",
+		"        username: bot",
+		"  matrix:",
+		"    container: ${{ matrix.image }}",
+	}, "\n")+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	got := make(map[string]map[string]string)
+	for _, f := range findByRule(resp.GetFindings(), unpinnedEnvImageRuleID) {
+		meta := f.GetMetadata()
+		meta["severity"] = severityNames[f.GetSeverity()]
+		got[meta["image"]] = meta
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected three %s findings, got %v", unpinnedEnvImageRuleID, got)
+	}
+	if meta := got["golang:1.22"]; meta["severity"] != "medium" || meta["declared_in"] != envImageContainer || meta["job"] != "build" {
+		t.Errorf("unexpected job container finding: %v", meta)
+	}
+	if meta := got["redis"]; meta["severity"] != "high" || meta["declared_in"] != envImageService || meta["service"] != "redis" {
+		t.Errorf("unexpected service finding: %v", meta)
+	}
+	if meta := got["ghcr.io/example/lint:latest"]; meta["severity"] != "high" || meta["job"] != "lint" {
+		t.Errorf("unexpected container mapping finding: %v", meta)
+	}
+}
+
+func TestScanGitLabEnvImages(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".gitlab-ci.yml"), strings.Join([]string{
+		"image: node:20",
+		"services:",
+		"- docker:dind",
+		"build:",
+		"  image:",
+		"    name: registry.example.com/tools/builder@sha256:" + strings.Repeat("cd", 32),
+		"    entrypoint: [\"\"]",
+		"  services:",
+		"    - name: postgres:16",
+		"      alias: db",
+		"    - redis:latest",
+		"  script:",
+		"    - make build",
+	}, "\n")+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	got := make(map[string]string)
+	for _, f := range findByRule(resp.GetFindings(), unpinnedEnvImageRuleID) {
+		meta := f.GetMetadata()
+		got[meta["image"]] = meta["declared_in"] + " " + meta["job"] + " " + severityNames[f.GetSeverity()]
+	}
+	want := map[string]string{
+		"node:20":      "job_image  medium",
+		"docker:dind":  "service  medium",
+		"postgres:16":  "service build medium",
+		"redis:latest": "service build high",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for image, w := range want {
+		if got[image] != w {
+			t.Errorf("%s: got %q, want %q", image, got[image], w)
+		}
+	}
+}
+
+func TestScanDevcontainer(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".devcontainer", "devcontainer.json"), strings.Join([]string{
+		"{",
+		"  // The toolchain image.",
+		"  \"name\": \"app\",",
+		"  \"image\": \"mcr.microsoft.com/devcontainers/go:1.22\",",
+		"  \"customizations\": {},",
+		"}",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, "tools", ".devcontainer.json"), strings.Join([]string{
+		"{",
+		"  /* Built locally. */",
+		"  \"build\": {\"dockerfile\": \"dev.containerfile\"},",
+		"}",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, "tools", "dev.containerfile"), "FROM alpine:3.20\nCOPY id_rsa /root/.ssh/id_rsa\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	found := findByRule(resp.GetFindings(), unpinnedEnvImageRuleID)
+	if len(found) != 1 {
+		t.Fatalf("expected one %s finding, got %d", unpinnedEnvImageRuleID, len(found))
+	}
+	if f := found[0]; f.GetLocation().GetFilePath() != ".devcontainer/devcontainer.json" || f.GetLocation().GetStartLine() != 4 ||
+		f.GetMetadata()["declared_in"] != envImageDevcontainer || severityNames[f.GetSeverity()] != "medium" {
+		t.Errorf("unexpected finding at %s:%d: %v", f.GetLocation().GetFilePath(), f.GetLocation().GetStartLine(), f.GetMetadata())
+	}
+
+	var copied bool
+	for _, f := range findByRule(resp.GetFindings(), secretRuleID) {
+		if f.GetLocation().GetFilePath() == "tools/dev.containerfile" {
+			copied = true
+		}
+	}
+	if !copied {
+		t.Error("expected the dev container's Dockerfile to be scanned")
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// envInjectionRuleID flags attacker-controlled event fields that reach a
+// run script through an env: variable the script expands unquoted, and
+// such fields in the env: of jobs holding write permissions.
+const envInjectionRuleID = "PROV-049"
+
+// Scopes of an env: block.
+const (
+	envScopeWorkflow = "workflow"
+	envScopeJob      = "job"
+	envScopeStep     = "step"
+)
+
+var (
+	// untrustedContext matches the event fields whoever opens an issue,
+	// pull request, comment, or commit writes freely.
+	untrustedContext = regexp.MustCompile(`\bgithub\.(?:head_ref|event\.(?:` +
+		`(?:issue|pull_request|discussion)\.(?:title|body)|` +
+		`pull_request\.head\.(?:ref|label|repo\.default_branch)|` +
+		`(?:comment|review|review_comment)\.body|` +
+		`pages(?:\.\*|\[\d+\])\.page_name|` +
+		`(?:commits(?:\.\*|\[\d+\])|head_commit)\.(?:message|author\.(?:email|name))|` +
+		`workflow_run\.(?:head_branch|head_commit\.(?:message|author\.(?:email|name)))))\b`)
+	// shellVarRef matches a shell parameter expansion, $NAME or ${NAME...},
+	// capturing the name.
+	shellVarRef = regexp.MustCompile(`^\$(?:\{([A-Za-z_][A-Za-z0-9_]*)[^}]*\}|([A-Za-z_][A-Za-z0-9_]*))`)
+	// shellAssignment matches the start of a word assigning a variable,
+	// whose value is not split.
+	shellAssignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=$`)
+)
+
+// envDef is a variable of an env: block.
+type envDef struct {
+	line  int
+	name  string
+	scope string
+	job   string
+	step  int
+	// expression is the untrusted context the value reads, if any.
+	expression string
+}
+
+// envRun is a run command of a step.
+type envRun struct {
+	line    int
+	job     string
+	step    int
+	command string
+}
+
+// envFlowTracker follows the env: blocks of a workflow or composite action
+// and the run commands of its steps, to match variables holding untrusted
+// event fields with the scripts expanding them.
+type envFlowTracker struct {
+	// action is set for a composite action, whose steps form a single job.
+	action bool
+	job    string
+	// stepsIndent is the indentation of the steps: key and itemIndent that
+	// of its items, -1 outside the steps; step is the current step's index.
+	stepsIndent int
+	itemIndent  int
+	step        int
+	// envIndent is the indentation of the open env: key, -1 if none, and
+	// envScope its scope.
+	envIndent int
+	envScope  string
+	// permIndent is the indentation of the open permissions: key, -1 if
+	// none, and permJob the job it belongs to, empty for the workflow's.
+	permIndent int
+	permJob    string
+
+	// declared holds the jobs with their own permissions, and write those
+	// granting any write scope, "" standing for the workflow.
+	declared map[string]bool
+	write    map[string]bool
+
+	defs []envDef
+	runs []envRun
+}
+
+func newEnvFlowTracker(action bool) *envFlowTracker {
+	t := &envFlowTracker{action: action, declared: make(map[string]bool), write: make(map[string]bool)}
+	t.resetJob("")
+	return t
+}
+
+// resetJob starts reading a new job, or the workflow's own keys.
+func (t *envFlowTracker) resetJob(job string) {
+	t.job = job
+	t.stepsIndent, t.itemIndent, t.step = -1, -1, -1
+	t.envIndent, t.permIndent = -1, -1
+}
+
+// track reads the next line of the file, given the classifier's context
+// and command for it.
+func (t *envFlowTracker) track(line string, lineNum int, lc lineContext, command string, lines *lineClassifier) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || lc == contextComment {
+		return
+	}
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	if !t.action && (indent == 0 || lines.inJobs && indent == lines.jobIndent) {
+		job := ""
+		if indent > 0 {
+			job = lines.section
+		}
+		t.resetJob(job)
+		if indent > 0 {
+			return
+		}
+	}
+
+	if t.envIndent >= 0 && indent <= t.envIndent {
+		t.envIndent = -1
+	}
+	if t.permIndent >= 0 && indent <= t.permIndent {
+		t.permIndent = -1
+	}
+	item, isItem := strings.CutPrefix(trimmed, "- ")
+	if t.stepsIndent >= 0 && (indent < t.stepsIndent || indent == t.stepsIndent && !isItem) {
+		t.stepsIndent, t.itemIndent, t.step = -1, -1, -1
+	}
+	if t.stepsIndent >= 0 && isItem && (t.itemIndent < 0 || indent == t.itemIndent) {
+		t.itemIndent = indent
+		t.step++
+		t.envIndent = -1
+	}
+	// Echo commands are run commands too, classified apart for other
+	// checks.
+	if lc == contextRunCommand || lc == contextEcho {
+		t.runs = append(t.runs, envRun{line: lineNum, job: t.job, step: t.step, command: command})
+		return
+	}
+
+	keyIndent := indent
+	if isItem {
+		keyIndent += 2
+	} else {
+		item = trimmed
+	}
+	key := yamlKey.FindStringSubmatch(item)
+	if key == nil {
+		return
+	}
+	value := yamlScalar(strings.TrimSpace(item[len(key[0]):]))
+	switch {
+	case t.envIndent >= 0:
+		def := envDef{line: lineNum, name: key[1], scope: t.envScope, job: t.job, step: t.step}
+		if strings.Contains(value, "${{") {
+			def.expression = untrustedContext.FindString(value)
+		}
+		t.defs = append(t.defs, def)
+	case t.permIndent >= 0:
+		if value == "write" {
+			t.write[t.permJob] = true
+		}
+	case key[1] == "steps" && value == "":
+		t.stepsIndent, t.itemIndent, t.step = keyIndent, -1, -1
+	case key[1] == "env" && value == "":
+		t.envIndent, t.envScope = keyIndent, envScopeJob
+		switch {
+		case t.stepsIndent >= 0 && t.step >= 0:
+			t.envScope = envScopeStep
+		case !t.action && t.job == "":
+			t.envScope = envScopeWorkflow
+		}
+	case key[1] == "permissions" && !t.action && t.stepsIndent < 0:
+		t.declared[t.job] = true
+		switch value {
+		case "":
+			t.permIndent, t.permJob = keyIndent, t.job
+		case "write-all":
+			t.write[t.job] = true
+		}
+	}
+}
+
+// unquotedExpansions returns the variables a shell command expands outside
+// quotes, where their values are split into words and globbed, leaving out
+// the values of assignments.
+func unquotedExpansions(command string) []string {
+	var names []string
+	var quote byte
+	wordStart := 0
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == '\\' && quote != '\'':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.IndexByte(" \t;|&()<>`", c) >= 0:
+			wordStart = i + 1
+		case c == '$':
+			m := shellVarRef.FindStringSubmatch(command[i:])
+			if m == nil {
+				continue
+			}
+			if !shellAssignment.MatchString(command[wordStart:i]) {
+				names = append(names, m[1]+m[2])
+			}
+			i += len(m[0]) - 1
+		}
+	}
+	return names
+}
+
+// lookup returns the definition of a variable a run command sees: the
+// step's own, then the job's, then the workflow's.
+func (t *envFlowTracker) lookup(r envRun, name string) *envDef {
+	var found *envDef
+	rank := 0
+	for i := range t.defs {
+		d := &t.defs[i]
+		if d.name != name {
+			continue
+		}
+		score := 0
+		switch {
+		case d.scope == envScopeStep && d.job == r.job && d.step == r.step:
+			score = 3
+		case d.scope == envScopeJob && d.job == r.job:
+			score = 2
+		case d.scope == envScopeWorkflow:
+			score = 1
+		}
+		if score > rank {
+			found, rank = d, score
+		}
+	}
+	return found
+}
+
+// elevated reports whether a job's token can write, from its own
+// permissions or, without them, the workflow's.
+func (t *envFlowTracker) elevated(job string) bool {
+	if t.declared[job] {
+		return t.write[job]
+	}
+	return t.write[""]
+}
+
+// report flags run commands expanding, unquoted, a variable that holds an
+// untrusted event field (Medium), and the remaining such variables defined
+// for jobs whose token can write (Low).
+func (t *envFlowTracker) report(findings *findingSet, filePath string) {
+	flowed := make(map[*envDef]bool)
+	for _, r := range t.runs {
+		seen := make(map[string]bool)
+		for _, name := range unquotedExpansions(r.command) {
+			d := t.lookup(r, name)
+			if seen[name] || d == nil || d.expression == "" {
+				continue
+			}
+			seen[name] = true
+			flowed[d] = true
+			fb := findings.Finding(
+				envInjectionRuleID,
+				sdk.SeverityMedium,
+				sdk.ConfidenceMedium,
+				fmt.Sprintf("Run script expands $%s unquoted, which holds %s; quote it so the value cannot change what the script runs", name, d.expression),
+			).
+				At(filePath, r.line, r.line).
+				WithMetadata("type", "unquoted_untrusted_env").
+				WithMetadata("variable", name).
+				WithMetadata("expression", d.expression).
+				WithMetadata("env_scope", d.scope).
+				WithMetadata("env_line", strconv.Itoa(d.line))
+			if r.job != "" {
+				fb.WithMetadata("job", r.job)
+			}
+			if r.step >= 0 {
+				fb.WithMetadata("step_index", strconv.Itoa(r.step))
+			}
+			fb.Done()
+		}
+	}
+	if t.action {
+		return
+	}
+	for i := range t.defs {
+		d := &t.defs[i]
+		if d.expression == "" || flowed[d] || !t.definedElevated(d) {
+			continue
+		}
+		fb := findings.Finding(
+			envInjectionRuleID,
+			sdk.SeverityLow,
+			sdk.ConfidenceMedium,
+			fmt.Sprintf("Environment variable %s holds %s in a job whose token can write", d.name, d.expression),
+		).
+			At(filePath, d.line, d.line).
+			WithMetadata("type", "untrusted_env_with_write_token").
+			WithMetadata("variable", d.name).
+			WithMetadata("expression", d.expression).
+			WithMetadata("env_scope", d.scope)
+		if d.job != "" {
+			fb.WithMetadata("job", d.job)
+		}
+		fb.Done()
+	}
+}
+
+// definedElevated reports whether a variable is defined for a job whose token
+// can write; a workflow's variable is, when any of its jobs' can.
+func (t *envFlowTracker) definedElevated(d *envDef) bool {
+	if d.scope != envScopeWorkflow {
+		return t.elevated(d.job)
+	}
+	if t.write[""] {
+		return true
+	}
+	for job, write := range t.write {
+		if write && job != "" {
+			return true
+		}
+	}
+	return false
+}
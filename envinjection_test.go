@@ -0,0 +1,139 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+func TestUnquotedExpansions(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{`echo $TITLE`, []string{"TITLE"}},
+		{`gh issue comment ${NUMBER} --body ${BODY:-none}`, []string{"NUMBER", "BODY"}},
+		{`echo "$TITLE" '$TITLE'`, nil},
+		{`echo "Title: ${TITLE}" > notes.md`, nil},
+		{`NAME=$BRANCH make dist`, nil},
+		{`make dist VERSION=$BRANCH`, nil},
+		{`git tag --message=$MESSAGE`, []string{"MESSAGE"}},
+		{`echo \$TITLE ${{ github.sha }}`, nil},
+		{`test -n "$A" && echo $B`, []string{"B"}},
+	}
+	for _, tt := range tests {
+		if got := unquotedExpansions(tt.command); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("unquotedExpansions(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestUntrustedContext(t *testing.T) {
+	for _, expr := range []string{
+		"github.event.issue.title",
+		"github.event.pull_request.body",
+		"github.event.pull_request.head.ref",
+		"github.head_ref",
+		"github.event.comment.body",
+		"github.event.commits[0].message",
+		"github.event.head_commit.author.email",
+		"github.event.workflow_run.head_branch",
+	} {
+		if got := untrustedContext.FindString("${{ " + expr + " }}"); got != expr {
+			t.Errorf("untrustedContext matched %q in %s", got, expr)
+		}
+	}
+	for _, expr := range []string{"github.sha", "github.event.issue.number", "github.event.pull_request.head.sha", "github.ref_name"} {
+		if got := untrustedContext.FindString("${{ " + expr + " }}"); got != "" {
+			t.Errorf("untrustedContext matched %q in %s", got, expr)
+		}
+	}
+}
+
+func TestScanEnvInjection(t *testing.T) {
+	workspace := t.TempDir()
+	workflows := filepath.Join(workspace, ".github", "workflows")
+	writeFile(t, filepath.Join(workflows, "triage.yml"), strings.Join([]string{
+		"on: issues",
+		"env:",
+		"  ISSUE_BODY: ${{ github.event.issue.body }}",
+		"jobs:",
+		"  label:",
+		"    runs-on: ubuntu-latest",
+		"    env:",
+		"      TITLE: ${{ github.event.issue.title }}",
+		"    steps:",
+		"      - run: echo $TITLE",
+		"      - run: echo \"$TITLE\" \"$ISSUE_BODY\"",
+		"      - name: Summarize",
+		"        env:",
+		"          BRANCH: ${{ github.head_ref }}",
+		"          SHA: ${{ github.sha }}",
+		"        run: |",
+		"          git log -1 $SHA",
+		"          ./summarize.sh --branch ${BRANCH}",
+		"      - run: echo $BRANCH",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workflows, "comment.yml"), strings.Join([]string{
+		"on: issue_comment",
+		"jobs:",
+		"  reply:",
+		"    runs-on: ubuntu-latest",
+		"    permissions:",
+		"      issues: write",
+		"    steps:",
+		"      - env:",
+		"          COMMENT: ${{ github.event.comment.body }}",
+		"        run: ./reply.sh \"$COMMENT\"",
+		"  read:",
+		"    runs-on: ubuntu-latest",
+		"    permissions:",
+		"      contents: read",
+		"    steps:",
+		"      - env:",
+		"          COMMENT: ${{ github.event.comment.body }}",
+		"        run: ./read.sh \"$COMMENT\"",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, ".github", "actions", "notes", "action.yml"), strings.Join([]string{
+		"name: notes",
+		"runs:",
+		"  using: composite",
+		"  steps:",
+		"    - shell: bash",
+		"      env:",
+		"        MESSAGE: ${{ github.event.head_commit.message }}",
+		"      run: echo $MESSAGE >> notes.md",
+	}, "\n")+"\n")
+
+	found := findByRule(invokeScan(t, testClient(t), workspace).GetFindings(), envInjectionRuleID)
+	type key struct {
+		path string
+		line int32
+	}
+	got := make(map[key]string)
+	for _, f := range found {
+		got[key{f.GetLocation().GetFilePath(), f.GetLocation().GetStartLine()}] = f.GetMetadata()["variable"]
+		if f.GetMetadata()["type"] == "unquoted_untrusted_env" && f.GetSeverity() != sdk.SeverityMedium {
+			t.Errorf("unquoted expansion of %s at severity %v", f.GetMetadata()["variable"], f.GetSeverity())
+		}
+	}
+	want := map[key]string{
+		{".github/workflows/triage.yml", 10}:    "TITLE",
+		{".github/workflows/triage.yml", 18}:    "BRANCH",
+		{".github/workflows/comment.yml", 9}:    "COMMENT",
+		{".github/actions/notes/action.yml", 8}: "MESSAGE",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findings = %v, want %v", got, want)
+	}
+	for _, f := range found {
+		if f.GetLocation().GetFilePath() == ".github/workflows/comment.yml" {
+			if m := f.GetMetadata(); f.GetSeverity() != sdk.SeverityLow || m["type"] != "untrusted_env_with_write_token" || m["job"] != "reply" {
+				t.Errorf("comment.yml finding: severity %v, metadata %v", f.GetSeverity(), m)
+			}
+		}
+	}
+}
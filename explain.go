@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// explainRuleID identifies the informational findings of the explain tool.
+const explainRuleID = "PROV-022"
+
+// maxExplainedStatements caps the statements explained when no
+// statement_index is given.
+const maxExplainedStatements = 50
+
+// maxPredicateExcerpt bounds the pretty-printed predicate in an explanation.
+const maxPredicateExcerpt = 1024
+
+// Outcomes of an explained completeness check.
+const (
+	checkPass    = "pass"
+	checkFail    = "fail"
+	checkSkipped = "skipped"
+)
+
+// explainedCheck is the outcome of one completeness check on a statement,
+// with the JSON pointer of the field it inspected.
+type explainedCheck struct {
+	name    string
+	outcome string
+	pointer string
+}
+
+// handleExplain re-parses one provenance file and describes each statement:
+// how it was wrapped, its predicate, every completeness check, and its
+// signatures. The findings are informational and only explain what scan
+// reports.
+func handleExplain(ctx context.Context, req sdk.ToolRequest) (*pluginv1.InvokeToolResponse, error) {
+	path, _ := req.Input["path"].(string)
+
+	resp := sdk.NewResponse()
+
+	if path == "" {
+		return resp.Build(), nil
+	}
+	path, err := resolveInputPath("path", path, req.WorkspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := intInput(req.Input, "statement_index", -1)
+	if err != nil {
+		return nil, err
+	}
+	if _, set := req.Input["statement_index"]; set && index < 0 {
+		return nil, fmt.Errorf("statement_index must not be negative, got %d", index)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory, not a provenance file", path)
+	}
+	data, err := readBoundedFile(path, defaultMaxFileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := &findingSet{root: req.WorkspaceRoot}
+	statements, err := parseProvenance(ctx, data)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		findings.Finding(explainRuleID, sdk.SeverityInfo, sdk.ConfidenceHigh, "Provenance could not be parsed: "+err.Error()).
+			At(path, 0, 0).
+			WithMetadata("type", "provenance_explanation").
+			WithMetadata("parsed", "false").
+			WithMetadata("parse_error", err.Error()).
+			Done()
+		findings.build(resp)
+		return resp.Build(), nil
+	}
+
+	selected := statements
+	switch {
+	case index >= len(statements):
+		return nil, fmt.Errorf("statement_index %d is out of range: %s holds %d statements", index, path, len(statements))
+	case index >= 0:
+		selected = statements[index : index+1]
+	case len(statements) > maxExplainedStatements:
+		selected = statements[:maxExplainedStatements]
+	}
+
+	for i := range selected {
+		explainStatement(findings, path, &selected[i], len(statements))
+	}
+	findings.build(resp)
+	return resp.Build(), nil
+}
+
+// explainStatement adds the explanation of one statement. JSON pointers are
+// relative to the decoded in-toto statement, which for a DSSE envelope or
+// Sigstore bundle is the base64 payload.
+func explainStatement(findings *findingSet, location string, ps *parsedStatement, total int) {
+	checks := explainChecks(ps)
+	var failed []string
+	for _, c := range checks {
+		if c.outcome == checkFail {
+			failed = append(failed, c.name)
+		}
+	}
+
+	level, gap := estimateSLSALevel(ps)
+	status := signatureUnsigned
+	if ps.Signatures > 0 {
+		status = signatureSigned
+	}
+	summary := "all completeness checks pass"
+	if len(failed) > 0 {
+		summary = "failed checks: " + strings.Join(failed, ", ")
+	}
+
+	excerpt, truncated := predicateExcerpt(ps.Statement.Predicate)
+	fb := findings.Finding(
+		explainRuleID,
+		sdk.SeverityInfo,
+		sdk.ConfidenceHigh,
+		fmt.Sprintf("Statement %d of %d (%s envelope): %s", ps.Index, total, ps.Envelope, summary),
+	).
+		At(location, ps.Line, ps.Line).
+		WithMetadata("type", "provenance_explanation").
+		WithMetadata("parsed", "true").
+		WithMetadata("statement_index", strconv.Itoa(ps.Index)).
+		WithMetadata("statement_count", strconv.Itoa(total)).
+		WithMetadata("byte_offset", strconv.Itoa(ps.Offset)).
+		WithMetadata("envelope", ps.Envelope).
+		WithMetadata("statement_type", ps.Statement.Type).
+		WithMetadata("predicate_type", ps.Statement.PredicateType).
+		WithMetadata("predicate_version", predicateVersion(ps.Statement.PredicateType)).
+		WithMetadata("builder_id", ps.Predicate.builderID()).
+		WithMetadata("build_type", ps.Predicate.buildTypeURI()).
+		WithMetadata("subject_count", strconv.Itoa(len(ps.Statement.Subject))).
+		WithMetadata("signature_status", status).
+		WithMetadata("signatures", strconv.Itoa(ps.Signatures)).
+		WithMetadata("tlog_entries", strconv.Itoa(ps.TlogEntries)).
+		WithMetadata("slsa_level", strconv.Itoa(level)).
+		WithMetadata("slsa_level_gap", gap).
+		WithMetadata("failed_checks", strings.Join(failed, ",")).
+		WithMetadata("predicate_excerpt", excerpt).
+		WithMetadata("predicate_truncated", strconv.FormatBool(truncated))
+	for _, c := range checks {
+		fb.WithMetadata("check_"+c.name, c.outcome).
+			WithMetadata("check_"+c.name+"_pointer", c.pointer)
+	}
+	fb.Done()
+}
+
+// explainChecks runs the completeness checks behind PROV-002 on a statement,
+// in the same order, recording where each looked. Subject checks point at
+// the first subject that fails them.
+func explainChecks(ps *parsedStatement) []explainedCheck {
+	c := completenessProblems(ps)
+	failed := make(map[string]bool, len(c.statement))
+	for _, reason := range c.statement {
+		failed[reason] = true
+	}
+
+	outcome := func(ok bool) string {
+		if ok {
+			return checkPass
+		}
+		return checkFail
+	}
+	subjectCheck := func(name, reason, field string) explainedCheck {
+		for _, sp := range c.subjects {
+			for _, r := range sp.reasons {
+				if r == reason {
+					return explainedCheck{name, checkFail, fmt.Sprintf("/subject/%d/%s", sp.index, field)}
+				}
+			}
+		}
+		return explainedCheck{name, checkPass, "/subject"}
+	}
+
+	checks := []explainedCheck{
+		{"subject", outcome(!failed["missing subject"]), "/subject"},
+		subjectCheck("subject_name", "subject missing name", "name"),
+		subjectCheck("subject_digest", "subject missing digest", "digest"),
+		{"predicate", outcome(!failed["missing predicate"]), "/predicate"},
+	}
+
+	builderPointer, materialsPointer := "/predicate/builder/id", "/predicate/materials"
+	if strings.HasPrefix(predicateVersion(ps.Statement.PredicateType), "slsa-v1") {
+		builderPointer, materialsPointer = "/predicate/runDetails/builder/id", "/predicate/buildDefinition/resolvedDependencies"
+	}
+	builder := explainedCheck{"builder_id", checkSkipped, builderPointer}
+	materials := explainedCheck{"materials", checkSkipped, materialsPointer}
+	// PyPI publish predicates name no builder or materials.
+	if len(ps.Statement.Predicate) > 0 && ps.PredicateOK && !isPyPIStatement(ps) {
+		builder.outcome = outcome(!failed["missing builder ID"])
+		materials.outcome = outcome(!failed["missing materials"])
+	}
+	checks = append(checks, builder, materials)
+
+	// v0.1 recipes also name the material they were defined in.
+	if ps.Statement.PredicateType == slsaRecipePredicateType {
+		recipe := explainedCheck{"recipe_material", checkSkipped, "/predicate/recipe/definedInMaterial"}
+		if ps.PredicateOK && ps.Predicate.Recipe.DefinedInMaterial != nil {
+			recipe.outcome = outcome(!failed["recipe material out of range"])
+		}
+		checks = append(checks, recipe)
+	}
+	return checks
+}
+
+// predicateExcerpt pretty-prints a predicate, cut to maxPredicateExcerpt
+// bytes at a UTF-8 boundary, and reports whether it was cut.
+func predicateExcerpt(raw json.RawMessage) (string, bool) {
+	if len(raw) == 0 {
+		return "", false
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		buf.Reset()
+		buf.Write(raw)
+	}
+	if buf.Len() <= maxPredicateExcerpt {
+		return buf.String(), false
+	}
+	return strings.ToValidUTF8(string(buf.Bytes()[:maxPredicateExcerpt]), ""), true
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+func TestExplainStatements(t *testing.T) {
+	workspace := t.TempDir()
+	v1 := `{"_type":"https://in-toto.io/Statement/v1","predicateType":"https://slsa.dev/provenance/v1",` +
+		`"subject":[{"name":"a","digest":{"sha256":"1"}},{"name":"b"}],"predicate":{"buildDefinition":{"buildType":"https://example.com/build"}}}`
+	writeFile(t, filepath.Join(workspace, "release.intoto.jsonl"), signed(testStatement)+"\n"+v1+"\n")
+
+	resp := invokeToolInWorkspace(t, testClient(t), "explain", workspace, map[string]any{"path": "release.intoto.jsonl"})
+
+	found := findByRule(resp.GetFindings(), explainRuleID)
+	if len(found) != 2 {
+		t.Fatalf("expected one explanation per statement, got %d", len(found))
+	}
+
+	complete := found[0].GetMetadata()
+	for key, want := range map[string]string{
+		"envelope":            envelopeDSSE,
+		"predicate_version":   "slsa-v0.2",
+		"signature_status":    signatureSigned,
+		"check_builder_id":    checkPass,
+		"check_materials":     checkPass,
+		"failed_checks":       "",
+		"predicate_truncated": "false",
+	} {
+		if complete[key] != want {
+			t.Errorf("statement 0: %s = %q, want %q", key, complete[key], want)
+		}
+	}
+	if !strings.Contains(complete["predicate_excerpt"], "\n  \"builder\": {") {
+		t.Errorf("expected a pretty-printed predicate, got %q", complete["predicate_excerpt"])
+	}
+
+	incomplete := found[1].GetMetadata()
+	for key, want := range map[string]string{
+		"statement_index":              "1",
+		"envelope":                     envelopeNone,
+		"signature_status":             signatureUnsigned,
+		"check_subject_digest":         checkFail,
+		"check_subject_digest_pointer": "/subject/1/digest",
+		"check_builder_id":             checkFail,
+		"check_builder_id_pointer":     "/predicate/runDetails/builder/id",
+		"check_materials_pointer":      "/predicate/buildDefinition/resolvedDependencies",
+		"failed_checks":                "subject_digest,builder_id,materials",
+	} {
+		if incomplete[key] != want {
+			t.Errorf("statement 1: %s = %q, want %q", key, incomplete[key], want)
+		}
+	}
+	if found[1].GetLocation().GetStartLine() != 2 {
+		t.Errorf("statement 1 anchored at line %d, want 2", found[1].GetLocation().GetStartLine())
+	}
+}
+
+func TestExplainStatementIndex(t *testing.T) {
+	workspace := t.TempDir()
+	path := filepath.Join(workspace, "a.intoto.jsonl")
+	writeFile(t, path, testStatement+"\n"+testStatement+"\n")
+
+	resp := invokeTool(t, testClient(t), "explain", map[string]any{"path": path, "statement_index": "1"})
+	found := findByRule(resp.GetFindings(), explainRuleID)
+	if len(found) != 1 || found[0].GetMetadata()["statement_index"] != "1" {
+		t.Fatalf("expected only statement 1 to be explained, got %d findings", len(found))
+	}
+
+	_, err := handleExplain(context.Background(), sdk.ToolRequest{Input: map[string]any{"path": path, "statement_index": float64(2)}})
+	if err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("expected an out of range error, got %v", err)
+	}
+}
+
+func TestExplainUnparsable(t *testing.T) {
+	workspace := t.TempDir()
+	path := filepath.Join(workspace, "provenance.json")
+	writeFile(t, path, "{not json")
+
+	resp := invokeTool(t, testClient(t), "explain", map[string]any{"path": path})
+	found := findByRule(resp.GetFindings(), explainRuleID)
+	if len(found) != 1 || found[0].GetMetadata()["parsed"] != "false" || found[0].GetMetadata()["parse_error"] == "" {
+		t.Fatalf("expected a single explanation of the parse error, got %v", found)
+	}
+	if found[0].GetSeverity() != sdk.SeverityInfo {
+		t.Errorf("explanations must be informational, got %v", found[0].GetSeverity())
+	}
+}
+
+func TestPredicateExcerptTruncates(t *testing.T) {
+	raw := `{"notes":"` + strings.Repeat("é", maxPredicateExcerpt) + `"}`
+	excerpt, truncated := predicateExcerpt([]byte(raw))
+	if !truncated || len(excerpt) > maxPredicateExcerpt {
+		t.Errorf("expected an excerpt of at most %d bytes, got %d (truncated %v)", maxPredicateExcerpt, len(excerpt), truncated)
+	}
+	if !strings.HasPrefix(excerpt, "{\n  \"notes\"") {
+		t.Errorf("unexpected excerpt start %q", excerpt[:20])
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// finding is a scan result buffered until the response is built, so that
+// response-level decisions such as severity gating can see every finding.
+type finding struct {
+	ruleID     string
+	severity   pluginv1.Severity
+	confidence pluginv1.Confidence
+	message    string
+	path       string
+	startLine  int
+	endLine    int
+	metadata   [][2]string
+}
+
+// sanitize replaces invalid UTF-8 in every string of the finding with U+FFFD.
+// File names, ignore patterns, and error text come from the filesystem and
+// may be in any encoding, but protobuf strings must be valid UTF-8 and a
+// single bad string makes the host reject the whole response.
+func (f *finding) sanitize() {
+	f.message = validUTF8(f.message)
+	f.path = validUTF8(f.path)
+	for i := range f.metadata {
+		f.metadata[i][0] = validUTF8(f.metadata[i][0])
+		f.metadata[i][1] = validUTF8(f.metadata[i][1])
+	}
+}
+
+// validUTF8 returns s with each run of invalid UTF-8 bytes replaced by U+FFFD.
+func validUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	return strings.ToValidUTF8(s, "\uFFFD")
+}
+
+// findingSet accumulates findings during a scan. Its builder methods mirror
+// sdk.ResponseBuilder so call sites read the same either way. Findings may be
+// added from several goroutines; items must only be read once they are done.
+type findingSet struct {
+	mu    sync.Mutex
+	items []*finding
+
+	// root is the workspace the findings belong to. Locations under it are
+	// reported relative to it when the response is built.
+	root string
+
+	// fsys is the filesystem the workspace is read from; nil reads it from
+	// disk.
+	fsys workspaceFS
+
+	// disabled holds rule IDs whose findings are discarded as they are
+	// added.
+	disabled map[string]bool
+
+	// owners resolves the CODEOWNERS of finding paths; nil when the
+	// workspace has no CODEOWNERS file.
+	owners *codeOwners
+}
+
+// reorderFindings, when set, is applied to the buffered findings before they
+// are sorted. Tests use it to simulate arbitrary walk and worker orders.
+var reorderFindings func([]*finding)
+
+// findingBuilder populates a single finding before it is added to a set.
+type findingBuilder struct {
+	set *findingSet
+	f   *finding
+}
+
+// Finding starts a new finding with the given rule, severity, confidence, and
+// message.
+func (s *findingSet) Finding(ruleID string, severity pluginv1.Severity, confidence pluginv1.Confidence, message string) *findingBuilder {
+	return &findingBuilder{
+		set: s,
+		f: &finding{
+			ruleID:     ruleID,
+			severity:   severity,
+			confidence: confidence,
+			message:    message,
+		},
+	}
+}
+
+// At sets the file location of the finding.
+func (b *findingBuilder) At(path string, startLine, endLine int) *findingBuilder {
+	b.f.path = path
+	b.f.startLine = startLine
+	b.f.endLine = endLine
+	return b
+}
+
+// WithMetadata attaches a metadata key/value pair to the finding.
+func (b *findingBuilder) WithMetadata(key, value string) *findingBuilder {
+	b.f.metadata = append(b.f.metadata, [2]string{key, value})
+	return b
+}
+
+// Done adds the finding to its set, unless its rule is disabled.
+func (b *findingBuilder) Done() *findingSet {
+	if b.set.disabled[b.f.ruleID] {
+		return b.set
+	}
+	b.set.mu.Lock()
+	b.set.items = append(b.set.items, b.f)
+	b.set.mu.Unlock()
+	return b.set
+}
+
+// sort orders findings by path, line, rule ID, and message so the response
+// does not depend on walk or worker scheduling order. Remaining ties are
+// broken on end line and metadata so the order is total.
+func (s *findingSet) sort() {
+	sort.Slice(s.items, func(i, j int) bool {
+		a, b := s.items[i], s.items[j]
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		if a.startLine != b.startLine {
+			return a.startLine < b.startLine
+		}
+		if a.ruleID != b.ruleID {
+			return a.ruleID < b.ruleID
+		}
+		if a.message != b.message {
+			return a.message < b.message
+		}
+		if a.endLine != b.endLine {
+			return a.endLine < b.endLine
+		}
+		return metadataLess(a.metadata, b.metadata)
+	})
+}
+
+// metadataLess compares metadata pairs lexically.
+func metadataLess(a, b [][2]string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i][0] != b[i][0] {
+				return a[i][0] < b[i][0]
+			}
+			return a[i][1] < b[i][1]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// build makes locations workspace-relative and valid UTF-8, tags each
+// finding with its rule's category and, given a CODEOWNERS file, its
+// owners, sorts the buffered findings, and writes them into the response
+// builder.
+func (s *findingSet) build(resp *sdk.ResponseBuilder) {
+	for _, f := range s.items {
+		f.path = workspacePath(s.root, f.path)
+		f.classify()
+		if s.owners != nil && f.ruleID != summaryRuleID {
+			f.metadata = append(f.metadata, [2]string{"owners", strings.Join(s.owners.owners(f.path), ",")})
+		}
+		f.sanitize()
+	}
+	if reorderFindings != nil {
+		reorderFindings(s.items)
+	}
+	s.sort()
+	for _, f := range s.items {
+		fb := resp.Finding(f.ruleID, f.severity, f.confidence, f.message).
+			At(f.path, f.startLine, f.endLine)
+		for _, kv := range f.metadata {
+			fb = fb.WithMetadata(kv[0], kv[1])
+		}
+		fb.Done()
+	}
+}
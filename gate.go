@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nox-hq/nox/core/baseline"
+	corefindings "github.com/nox-hq/nox/core/findings"
+	"github.com/nox-hq/nox/core/suppress"
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// severityRank orders severities from least to most severe so thresholds can
+// be compared independently of the protobuf enum values.
+var severityRank = map[pluginv1.Severity]int{
+	sdk.SeverityInfo:     0,
+	sdk.SeverityLow:      1,
+	sdk.SeverityMedium:   2,
+	sdk.SeverityHigh:     3,
+	sdk.SeverityCritical: 4,
+}
+
+// gateSeverities maps accepted fail_on_severity input values to severities.
+var gateSeverities = map[string]pluginv1.Severity{
+	"low":      sdk.SeverityLow,
+	"medium":   sdk.SeverityMedium,
+	"high":     sdk.SeverityHigh,
+	"critical": sdk.SeverityCritical,
+}
+
+// parseGateSeverity converts a fail_on_severity input value to a severity.
+func parseGateSeverity(value string) (pluginv1.Severity, error) {
+	sev, ok := gateSeverities[strings.ToLower(strings.TrimSpace(value))]
+	if !ok {
+		return 0, fmt.Errorf("invalid fail_on_severity %q: must be one of low, medium, high, critical", value)
+	}
+	return sev, nil
+}
+
+// gateResult is the outcome of evaluating findings against a severity
+// threshold.
+type gateResult struct {
+	threshold  string
+	violations int
+	// suppressed counts findings at or above threshold that a baseline
+	// entry or inline nox:ignore marker excludes from the gate.
+	suppressed int
+}
+
+// failed reports whether any finding met or exceeded the threshold.
+func (g *gateResult) failed() bool {
+	return g.violations > 0
+}
+
+// evaluateGate counts the findings at or above threshold. The scan summary,
+// provenance confirmations, and explanations are informational and never
+// count toward the gate. Findings the host would suppress, by the
+// workspace baseline or an inline nox:ignore marker, are counted apart, so
+// the gate agrees with what the host reports.
+func evaluateGate(findings *findingSet, threshold pluginv1.Severity, name string, maxFileSize int64) *gateResult {
+	result := &gateResult{threshold: name}
+	suppressions := newGateSuppressions(findings, maxFileSize)
+	for _, f := range findings.items {
+		if f.ruleID == summaryRuleID || f.ruleID == confirmedProvenanceRuleID || f.ruleID == explainRuleID {
+			continue
+		}
+		if severityRank[f.severity] < severityRank[threshold] {
+			continue
+		}
+		if suppressions.suppressed(f) {
+			result.suppressed++
+			continue
+		}
+		result.violations++
+	}
+	return result
+}
+
+// gateSuppressions holds the suppressions the host applies to findings:
+// the entries of the workspace baseline, matched by the fingerprint the
+// host computes, and the nox:ignore markers of the files findings are
+// anchored at, read as needed.
+type gateSuppressions struct {
+	findings    *findingSet
+	maxFileSize int64
+	now         time.Time
+	baseline    map[string]baseline.Entry
+	inline      map[string][]suppress.Suppression
+}
+
+// newGateSuppressions loads the workspace baseline. A missing or unreadable
+// baseline suppresses nothing, as for the host.
+func newGateSuppressions(findings *findingSet, maxFileSize int64) *gateSuppressions {
+	g := &gateSuppressions{findings: findings, maxFileSize: maxFileSize, now: time.Now(), inline: make(map[string][]suppress.Suppression)}
+	data, err := g.read(baseline.DefaultPath(findings.root))
+	if err != nil {
+		return g
+	}
+	var b baseline.Baseline
+	if json.Unmarshal(data, &b) != nil {
+		return g
+	}
+	g.baseline = make(map[string]baseline.Entry, len(b.Entries))
+	for _, e := range b.Entries {
+		g.baseline[e.Fingerprint] = e
+	}
+	return g
+}
+
+// read reads a workspace file no larger than max_file_size.
+func (g *gateSuppressions) read(name string) ([]byte, error) {
+	info, err := g.findings.files().Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() || info.Size() > g.maxFileSize {
+		return nil, fmt.Errorf("%s: not a file within max_file_size", name)
+	}
+	return g.findings.files().ReadFile(name)
+}
+
+// suppressed reports whether the host would suppress a finding.
+func (g *gateSuppressions) suppressed(f *finding) bool {
+	rel := workspacePath(g.findings.root, f.path)
+	if e, ok := g.baseline[corefindings.ComputeFingerprint(f.ruleID, corefindings.Location{FilePath: rel, StartLine: f.startLine}, validUTF8(f.message))]; ok {
+		if e.ExpiresAt == nil || g.now.Before(*e.ExpiresAt) {
+			return true
+		}
+	}
+	if f.startLine <= 0 || rel == "." {
+		return false
+	}
+	markers, ok := g.inline[f.path]
+	if !ok {
+		if data, err := g.read(filepath.Clean(f.path)); err == nil {
+			markers = suppress.ScanForSuppressions(data, rel)
+		}
+		g.inline[f.path] = markers
+	}
+	for _, m := range markers {
+		if m.MatchesFinding(f.ruleID, f.startLine, g.now) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// knownBadGeneratorRuleID flags provenance generators, release actions, and
+// signing tools that are archived or affected by an advisory, as referenced
+// by workflows or recorded in provenance.
+const knownBadGeneratorRuleID = "PROV-055"
+
+// generatorAdvisoriesJSON is the known-bad generator table. Entries are
+// data, so adding or amending one needs no code change.
+//
+//go:embed generators.json
+var generatorAdvisoriesJSON []byte
+
+// generatorAdvisory is one entry of the known-bad generator table.
+type generatorAdvisory struct {
+	Name string `json:"name"`
+	// Actions are owner/repo prefixes of uses: references, and Builders
+	// prefixes of builder IDs recorded in provenance.
+	Actions  []string `json:"actions"`
+	Builders []string `json:"builders"`
+	// Versions from Introduced up to, but not including, Fixed are
+	// affected; an empty bound is open. Every version of an archived
+	// entry is.
+	Introduced string `json:"introduced"`
+	Fixed      string `json:"fixed"`
+	Archived   bool   `json:"archived"`
+	// Commits maps full commit SHAs of the actions to the release each
+	// was tagged as, so SHA-pinned references can be placed in the range.
+	Commits map[string]string `json:"commits"`
+	// InvocationIDs are patterns of the build invocation IDs only affected
+	// releases record, matched when the builder ID carries no version.
+	InvocationIDs []string `json:"invocation_ids"`
+	// VersionInput names the action input choosing the version of the tool
+	// the action installs; that version is checked instead of the action's
+	// own ref.
+	VersionInput string `json:"version_input"`
+	Reason       string `json:"reason"`
+	Advisory     string `json:"advisory"`
+	Upgrade      string `json:"upgrade"`
+
+	invocationIDs []*regexp.Regexp
+}
+
+// generatorAdvisories is the parsed known-bad generator table.
+var generatorAdvisories = mustParseGeneratorAdvisories(generatorAdvisoriesJSON)
+
+// parseGeneratorAdvisories decodes and validates the known-bad generator
+// table.
+func parseGeneratorAdvisories(data []byte) ([]*generatorAdvisory, error) {
+	var advisories []*generatorAdvisory
+	if err := json.Unmarshal(data, &advisories); err != nil {
+		return nil, err
+	}
+	for i, a := range advisories {
+		switch {
+		case a.Name == "" || a.Reason == "" || a.Advisory == "":
+			return nil, fmt.Errorf("entry %d: name, reason, and advisory are required", i)
+		case len(a.Actions) == 0 && len(a.Builders) == 0:
+			return nil, fmt.Errorf("%s: no actions or builders to match", a.Name)
+		case !a.Archived && a.Introduced == "" && a.Fixed == "":
+			return nil, fmt.Errorf("%s: no affected versions", a.Name)
+		}
+		for _, v := range append([]string{a.Introduced, a.Fixed}, mapValues(a.Commits)...) {
+			if _, ok := parseToolVersion(v); v != "" && !ok {
+				return nil, fmt.Errorf("%s: invalid version %q", a.Name, v)
+			}
+		}
+		for sha := range a.Commits {
+			if !fullCommitSHA.MatchString(sha) {
+				return nil, fmt.Errorf("%s: invalid commit %q", a.Name, sha)
+			}
+		}
+		for _, pattern := range a.InvocationIDs {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", a.Name, err)
+			}
+			a.invocationIDs = append(a.invocationIDs, re)
+		}
+	}
+	return advisories, nil
+}
+
+// mustParseGeneratorAdvisories parses the embedded table, which tests keep
+// valid.
+func mustParseGeneratorAdvisories(data []byte) []*generatorAdvisory {
+	advisories, err := parseGeneratorAdvisories(data)
+	if err != nil {
+		panic("generators.json: " + err.Error())
+	}
+	return advisories
+}
+
+// mapValues returns the values of m in key order.
+func mapValues(m map[string]string) []string {
+	out := make([]string, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		out = append(out, m[k])
+	}
+	return out
+}
+
+// parseToolVersion parses a dotted numeric version such as v1.2.3 or 1.2,
+// ignoring a tag prefix and any pre-release or build suffix. ok is false
+// for anything else, such as a branch name.
+func parseToolVersion(s string) ([]int, bool) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "refs/tags/"), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	if s == "" {
+		return nil, false
+	}
+	var parts []int
+	for _, p := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
+
+// compareToolVersions compares version v with bound b. A component missing
+// from v is taken as larger than any, since a partial tag such as v1 moves
+// with the latest release of its line; one missing from b is zero.
+func compareToolVersions(v, b []int) int {
+	for i := 0; i < max(len(v), len(b)); i++ {
+		if i >= len(v) {
+			return 1
+		}
+		bi := 0
+		if i < len(b) {
+			bi = b[i]
+		}
+		switch {
+		case v[i] < bi:
+			return -1
+		case v[i] > bi:
+			return 1
+		}
+	}
+	return 0
+}
+
+// affects reports whether version, which must parse, is in the affected
+// range.
+func (a *generatorAdvisory) affects(version string) bool {
+	if a.Archived {
+		return true
+	}
+	v, ok := parseToolVersion(version)
+	if !ok {
+		return false
+	}
+	if lo, ok := parseToolVersion(a.Introduced); ok && compareToolVersions(v, lo) < 0 {
+		return false
+	}
+	if hi, ok := parseToolVersion(a.Fixed); ok && compareToolVersions(v, hi) >= 0 {
+		return false
+	}
+	return true
+}
+
+// affectedRange renders the affected versions for messages and metadata.
+func (a *generatorAdvisory) affectedRange() string {
+	switch {
+	case a.Archived:
+		return "all versions (archived)"
+	case a.Introduced != "" && a.Fixed != "":
+		return ">=" + a.Introduced + " <" + a.Fixed
+	case a.Fixed != "":
+		return "<" + a.Fixed
+	}
+	return ">=" + a.Introduced
+}
+
+// matchesAction reports whether a uses: reference names one of the
+// advisory's actions or a path within one.
+func (a *generatorAdvisory) matchesAction(ref string) bool {
+	name, _, _ := strings.Cut(strings.ToLower(ref), "@")
+	for _, action := range a.Actions {
+		action = strings.ToLower(action)
+		if name == action || strings.HasPrefix(name, action+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// generatorMatch is a reference found to use an affected generator.
+type generatorMatch struct {
+	advisory *generatorAdvisory
+	// reference is the uses: reference or builder ID, and version the
+	// release it was placed at, empty when it could not be.
+	reference string
+	version   string
+	// how names the evidence: archived, tag, commit, version_comment,
+	// unmapped_commit, input, builder_id, or invocation_id.
+	how        string
+	confidence pluginv1.Confidence
+}
+
+// versionComment matches the release a SHA pin is annotated with, as in
+// "@<sha> # v1.2.3" or "# tag=v1.2.3".
+var versionComment = regexp.MustCompile(`#\s*(?:tag=|pin @)?(v?\d+(?:\.\d+)*)\b`)
+
+// pinnedVersion places a ref or SHA at a release of the advisory's
+// actions: a version tag itself, a commit the table maps, or the version
+// comment after an unmapped commit. An unmapped commit without a comment
+// matches with Low confidence, as its release is unknown.
+func (a *generatorAdvisory) pinnedVersion(pin, comment string) (version, how string, confidence pluginv1.Confidence, ok bool) {
+	if fullCommitSHA.MatchString(pin) {
+		if v, found := a.Commits[strings.ToLower(pin)]; found {
+			return v, "commit", sdk.ConfidenceHigh, true
+		}
+		if m := versionComment.FindStringSubmatch(comment); m != nil {
+			return m[1], "version_comment", sdk.ConfidenceMedium, true
+		}
+		return "", "unmapped_commit", sdk.ConfidenceLow, true
+	}
+	if _, parsed := parseToolVersion(pin); parsed {
+		return pin, "tag", sdk.ConfidenceHigh, true
+	}
+	return "", "", 0, false
+}
+
+// matchUses checks the uses: reference of a workflow or action step. It
+// returns the advisory whose version input the step may set instead, for
+// advisories that check the tool an action installs.
+func matchUses(ref, line string) ([]generatorMatch, *generatorAdvisory) {
+	var matches []generatorMatch
+	var pending *generatorAdvisory
+	for _, a := range generatorAdvisories {
+		if !a.matchesAction(ref) {
+			continue
+		}
+		if a.VersionInput != "" {
+			pending = a
+			continue
+		}
+		pin, _, _ := actionPin(ref)
+		_, comment, _ := strings.Cut(line, "#")
+		version, how, confidence, ok := a.pinnedVersion(pin, "#"+comment)
+		switch {
+		case a.Archived:
+			matches = append(matches, generatorMatch{a, ref, version, "archived", sdk.ConfidenceHigh})
+		case !ok:
+		case how == "unmapped_commit" || a.affects(version):
+			matches = append(matches, generatorMatch{a, ref, version, how, confidence})
+		}
+	}
+	return matches, pending
+}
+
+// matchBuilder checks the builder a provenance statement records: the
+// version suffix of its builder ID or, lacking one, the shape of its
+// invocation ID.
+func matchBuilder(p *slsaPredicate) []generatorMatch {
+	id := p.builderID()
+	var matches []generatorMatch
+	for _, a := range generatorAdvisories {
+		if !hasAnyPrefix(id, a.Builders) {
+			continue
+		}
+		if a.Archived {
+			matches = append(matches, generatorMatch{a, id, "", "archived", sdk.ConfidenceHigh})
+			continue
+		}
+		if i := strings.LastIndex(id, "@"); i >= 0 {
+			version, how, confidence, ok := a.pinnedVersion(strings.TrimPrefix(id[i+1:], "refs/tags/"), "")
+			if ok {
+				if how == "tag" {
+					how = "builder_id"
+				}
+				if how == "unmapped_commit" || a.affects(version) {
+					matches = append(matches, generatorMatch{a, id, version, how, confidence})
+				}
+				continue
+			}
+		}
+		invocation := p.invocationID()
+		for _, re := range a.invocationIDs {
+			if invocation != "" && re.MatchString(invocation) {
+				matches = append(matches, generatorMatch{a, id, "", "invocation_id", sdk.ConfidenceLow})
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// message describes a match for a finding.
+func (m generatorMatch) message(subject string) string {
+	a := m.advisory
+	affected := a.affectedRange()
+	switch m.how {
+	case "unmapped_commit":
+		affected = "unmapped commit, affected " + affected
+	case "invocation_id":
+		affected = "invocation ID shape of " + affected
+	}
+	return fmt.Sprintf("%s matches known-bad %s (%s): %s; upgrade to %s", subject, a.Name, affected, a.Reason, a.Upgrade)
+}
+
+// annotate adds the advisory and evidence of a match to a finding.
+func (m generatorMatch) annotate(fb *findingBuilder) *findingBuilder {
+	a := m.advisory
+	fb.WithMetadata("type", "known_bad_generator").
+		WithMetadata("generator", a.Name).
+		WithMetadata("reference", m.reference).
+		WithMetadata("match", m.how).
+		WithMetadata("affected_range", a.affectedRange()).
+		WithMetadata("advisory", a.Advisory).
+		WithMetadata("upgrade", a.Upgrade)
+	if m.version != "" {
+		fb.WithMetadata("version", m.version)
+	}
+	return fb
+}
+
+// generatorTracker checks the uses: references of a workflow or action
+// against the known-bad generator table, following the step inputs of
+// actions whose installed tool version is checked.
+type generatorTracker struct {
+	// pending is the advisory whose version input the current step may
+	// set, with the step's uses: reference.
+	pending *generatorAdvisory
+	ref     string
+}
+
+// uses checks a uses: reference.
+func (g *generatorTracker) uses(findings *findingSet, filePath string, lineNum int, line, ref string, action *actionTracker, origin commandOrigin) {
+	matches, pending := matchUses(ref, line)
+	g.pending, g.ref = pending, ref
+	for _, m := range matches {
+		g.report(findings, filePath, lineNum, m, "Action "+ref, action, origin)
+	}
+}
+
+// input reads a YAML line of a step for the version input of a pending
+// advisory. A new step item ends the previous step.
+func (g *generatorTracker) input(findings *findingSet, filePath string, lineNum int, line string, action *actionTracker, origin commandOrigin) {
+	if g.pending == nil {
+		return
+	}
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "- ") {
+		g.pending = nil
+		return
+	}
+	m := yamlKey.FindStringSubmatch(trimmed)
+	if m == nil || m[1] != g.pending.VersionInput {
+		return
+	}
+	a := g.pending
+	g.pending = nil
+	version := yamlScalar(strings.TrimSpace(trimmed[len(m[0]):]))
+	if _, ok := parseToolVersion(version); !ok || !a.affects(version) {
+		return
+	}
+	g.report(findings, filePath, lineNum, generatorMatch{a, g.ref, version, "input", sdk.ConfidenceHigh},
+		fmt.Sprintf("Action %s installing %s %s", g.ref, a.Name, version), action, origin)
+}
+
+func (g *generatorTracker) report(findings *findingSet, filePath string, lineNum int, m generatorMatch, subject string, action *actionTracker, origin commandOrigin) {
+	fb := findings.Finding(knownBadGeneratorRuleID, sdk.SeverityMedium, m.confidence, m.message(subject)).
+		At(filePath, lineNum, lineNum)
+	action.annotate(origin.annotate(m.annotate(fb))).Done()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// useGeneratorAdvisories replaces the known-bad generator table for the
+// rest of a test.
+func useGeneratorAdvisories(t *testing.T, table string) {
+	t.Helper()
+	advisories, err := parseGeneratorAdvisories([]byte(table))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := generatorAdvisories
+	generatorAdvisories = advisories
+	t.Cleanup(func() { generatorAdvisories = saved })
+}
+
+func TestParseGeneratorAdvisories(t *testing.T) {
+	if _, err := parseGeneratorAdvisories(generatorAdvisoriesJSON); err != nil {
+		t.Fatalf("embedded table: %v", err)
+	}
+	for name, table := range map[string]string{
+		"missing reason":   `[{"name": "x", "actions": ["a/b"], "fixed": "1.0", "advisory": "x"}]`,
+		"nothing to match": `[{"name": "x", "fixed": "1.0", "reason": "r", "advisory": "x"}]`,
+		"no range":         `[{"name": "x", "actions": ["a/b"], "reason": "r", "advisory": "x"}]`,
+		"bad version":      `[{"name": "x", "actions": ["a/b"], "fixed": "main", "reason": "r", "advisory": "x"}]`,
+		"bad commit":       `[{"name": "x", "actions": ["a/b"], "fixed": "1.0", "commits": {"abc": "0.9"}, "reason": "r", "advisory": "x"}]`,
+		"bad pattern":      `[{"name": "x", "builders": ["b"], "fixed": "1.0", "invocation_ids": ["("], "reason": "r", "advisory": "x"}]`,
+	} {
+		if _, err := parseGeneratorAdvisories([]byte(table)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestGeneratorAdvisoryAffects(t *testing.T) {
+	a := &generatorAdvisory{Introduced: "1.0.0", Fixed: "1.5.0"}
+	for version, want := range map[string]bool{
+		"v1.2.0":            true,
+		"refs/tags/v1.4.99": true,
+		"1.0":               true,
+		"v1.5.0-rc.1":       false,
+		"v1.5.0":            false,
+		"v0.9.1":            false,
+		// A major tag moves with its latest release.
+		"v1":   false,
+		"v0":   false,
+		"main": false,
+	} {
+		if got := a.affects(version); got != want {
+			t.Errorf("affects(%q) = %v, want %v", version, got, want)
+		}
+	}
+	if got := (&generatorAdvisory{Fixed: "2.0.0"}).affects("v1"); !got {
+		t.Error("expected every release of v1 to be affected by a fix in 2.0.0")
+	}
+}
+
+func TestScanKnownBadGenerators(t *testing.T) {
+	const sha = "0123456789abcdef0123456789abcdef01234567"
+	useGeneratorAdvisories(t, `[
+  {"name": "slsa-github-generator", "actions": ["slsa-framework/slsa-github-generator"],
+   "builders": ["https://github.com/slsa-framework/slsa-github-generator/"],
+   "fixed": "1.5.0", "commits": {"`+sha+`": "v1.2.0"}, "invocation_ids": ["^[0-9]+-[0-9]+$"],
+   "reason": "old trust root", "advisory": "ADV-1", "upgrade": "v2.0.0"},
+  {"name": "actions/create-release", "actions": ["actions/create-release"], "archived": true,
+   "reason": "archived", "advisory": "ADV-2", "upgrade": "gh release create"},
+  {"name": "cosign", "actions": ["sigstore/cosign-installer"], "version_input": "cosign-release",
+   "fixed": "1.12.0", "reason": "verify-blob bug", "advisory": "ADV-3", "upgrade": "v2.2.4"}
+]`)
+	const generator = "slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml"
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), strings.Join([]string{
+		"jobs:",
+		"  provenance:",
+		"    uses: " + generator + "@v1.2.0",
+		"  current:",
+		"    uses: " + generator + "@v2.0.0",
+		"  mapped:",
+		"    uses: " + generator + "@" + sha,
+		"  commented:",
+		"    uses: " + generator + "@fedcba9876543210fedcba9876543210fedcba98 # v1.4.0",
+		"  unmapped:",
+		"    uses: " + generator + "@fedcba9876543210fedcba9876543210fedcba98",
+		"  release:",
+		"    steps:",
+		"      - uses: actions/create-release@v1",
+		"      - uses: sigstore/cosign-installer@v2",
+		"        with:",
+		"          cosign-release: 'v1.11.0'",
+		"      - uses: sigstore/cosign-installer@v3",
+		"        with:",
+		"          cosign-release: v2.2.4",
+		"      - uses: sigstore/cosign-installer@v3",
+		"      - name: unrelated",
+		"        with:",
+		"          cosign-release: v1.0.0",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, "old.intoto.jsonl"),
+		`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","subject":[{"name":"app","digest":{"sha256":"abc"}}],"predicate":{"builder":{"id":"https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@refs/tags/v1.2.0"}}}`+"\n")
+	writeFile(t, filepath.Join(workspace, "unversioned.intoto.jsonl"),
+		`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","subject":[{"name":"app","digest":{"sha256":"abc"}}],"predicate":{"builder":{"id":"https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml"},"metadata":{"buildInvocationId":"4242-1"}}}`+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	got := make(map[string]*pluginv1.Finding)
+	for _, f := range findByRule(resp.GetFindings(), knownBadGeneratorRuleID) {
+		got[f.GetLocation().GetFilePath()+":"+strconv.Itoa(int(f.GetLocation().GetStartLine()))] = f
+	}
+	want := map[string]struct {
+		match      string
+		confidence pluginv1.Confidence
+		version    string
+	}{
+		".github/workflows/release.yml:3":  {"tag", sdk.ConfidenceHigh, "v1.2.0"},
+		".github/workflows/release.yml:7":  {"commit", sdk.ConfidenceHigh, "v1.2.0"},
+		".github/workflows/release.yml:9":  {"version_comment", sdk.ConfidenceMedium, "v1.4.0"},
+		".github/workflows/release.yml:11": {"unmapped_commit", sdk.ConfidenceLow, ""},
+		".github/workflows/release.yml:14": {"archived", sdk.ConfidenceHigh, "v1"},
+		".github/workflows/release.yml:17": {"input", sdk.ConfidenceHigh, "v1.11.0"},
+		"old.intoto.jsonl:1":               {"builder_id", sdk.ConfidenceHigh, "v1.2.0"},
+		"unversioned.intoto.jsonl:1":       {"invocation_id", sdk.ConfidenceLow, ""},
+	}
+	for key, w := range want {
+		f, ok := got[key]
+		if !ok {
+			t.Errorf("missing %s finding at %s", knownBadGeneratorRuleID, key)
+			continue
+		}
+		meta := f.GetMetadata()
+		if meta["match"] != w.match || f.GetConfidence() != w.confidence || meta["version"] != w.version || meta["advisory"] == "" || meta["affected_range"] == "" {
+			t.Errorf("%s: unexpected finding %s %v", key, f.GetConfidence(), meta)
+		}
+	}
+	for key, f := range got {
+		if _, ok := want[key]; !ok {
+			t.Errorf("unexpected %s finding at %s: %s", knownBadGeneratorRuleID, key, f.GetMessage())
+		}
+	}
+	if f := got[".github/workflows/release.yml:17"]; f != nil {
+		meta := f.GetMetadata()
+		if meta["affected_range"] != "<1.12.0" || meta["advisory"] != "ADV-3" || meta["generator"] != "cosign" {
+			t.Errorf("unexpected cosign metadata %v", meta)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Ignore file names read during the walk.
+const (
+	gitignoreFile = ".gitignore"
+	noxignoreFile = ".noxignore"
+)
+
+// ignoreRule is a single pattern line from a .gitignore or .noxignore file.
+type ignoreRule struct {
+	// pattern is the line as written, used in finding metadata.
+	pattern string
+	// source is the path of the file the rule came from.
+	source string
+	// base is the slash-separated directory of source relative to the
+	// workspace root, empty for the root itself.
+	base    string
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// fromGitignore reports whether the rule came from a .gitignore file.
+func (r *ignoreRule) fromGitignore() bool {
+	return filepath.Base(r.source) == gitignoreFile
+}
+
+// ignoreMatcher evaluates gitignore-style rules collected from every ignore
+// file seen so far during the walk. Rules are kept in the order they were
+// loaded; since directories are loaded before their children, rules from
+// deeper files come later and win, as do later lines within a file.
+type ignoreMatcher struct {
+	gitignore bool
+	rules     []*ignoreRule
+	// fsys is the filesystem ignore files are read from; nil reads them
+	// from disk.
+	fsys workspaceFS
+}
+
+// load reads the ignore files in dir, whose workspace-relative slash path is
+// rel. .gitignore files are only read when gitignore support is enabled.
+func (m *ignoreMatcher) load(dir, rel string) {
+	if m.gitignore {
+		m.loadFile(filepath.Join(dir, gitignoreFile), rel)
+	}
+	m.loadFile(filepath.Join(dir, noxignoreFile), rel)
+}
+
+func (m *ignoreMatcher) loadFile(file, base string) {
+	fsys := m.fsys
+	if fsys == nil {
+		fsys = osFS{}
+	}
+	f, err := fsys.Open(file)
+	if err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule := parseIgnoreLine(scanner.Text(), file, base); rule != nil {
+			m.rules = append(m.rules, rule)
+		}
+	}
+}
+
+// match reports whether the workspace-relative slash path rel is ignored,
+// along with the last rule that matched it. A path matched last by a negated
+// rule is not ignored but still returns that rule.
+func (m *ignoreMatcher) match(rel string, isDir bool) (bool, *ignoreRule) {
+	var matched *ignoreRule
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		sub := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			sub = rel[len(r.base)+1:]
+		}
+		if r.re.MatchString(sub) {
+			matched = r
+		}
+	}
+	if matched == nil {
+		return false, nil
+	}
+	return !matched.negate, matched
+}
+
+// parseIgnoreLine parses one line of an ignore file, returning nil for blank
+// lines, comments, and patterns that cannot be compiled.
+func parseIgnoreLine(line, source, base string) *ignoreRule {
+	line = trimIgnoreTrailingSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	rule := &ignoreRule{pattern: line, source: source, base: base}
+
+	pattern := line
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return nil
+	}
+
+	// A slash anywhere but the end anchors the pattern to the ignore file's
+	// directory; otherwise it matches at any depth below it.
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	expr := globToRegexp(pattern)
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "^(?:.*/)?" + expr + "$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil
+	}
+	rule.re = re
+	return rule
+}
+
+// trimIgnoreTrailingSpace removes trailing spaces unless escaped with a
+// backslash.
+func trimIgnoreTrailingSpace(line string) string {
+	line = strings.TrimRight(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// globToRegexp converts a gitignore glob to an unanchored regular expression
+// over slash-separated paths.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// slashRel returns path relative to root with forward slashes, or "." for the
+// root itself.
+func slashRel(root, p string) string {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	return path.Clean(filepath.ToSlash(rel))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	m := &ignoreMatcher{gitignore: true}
+	for _, line := range []string{
+		"# comment",
+		"",
+		"*.log",
+		"!keep.log",
+		"/build",
+		"dist/",
+		"docs/**/*.tmp",
+		`\#literal`,
+		"trailing   ",
+		"bin/*.exe",
+	} {
+		if r := parseIgnoreLine(line, ".gitignore", ""); r != nil {
+			m.rules = append(m.rules, r)
+		}
+	}
+	for _, line := range []string{"!*.log", "local.txt"} {
+		if r := parseIgnoreLine(line, "sub/.gitignore", "sub"); r != nil {
+			m.rules = append(m.rules, r)
+		}
+	}
+
+	tests := []struct {
+		path   string
+		isDir  bool
+		expect bool
+	}{
+		{"app.log", false, true},
+		{"nested/deep/app.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"build", false, true},
+		{"src/build", true, false},
+		{"dist", true, true},
+		{"dist", false, false},
+		{"src/dist", true, true},
+		{"docs/a/b/c.tmp", false, true},
+		{"docs/c.tmp", false, true},
+		{"other/c.tmp", false, false},
+		{"#literal", false, true},
+		{"trailing", false, true},
+		{"bin/tool.exe", false, true},
+		{"bin/sub/tool.exe", false, false},
+		{"sub/app.log", false, false},
+		{"sub/local.txt", false, true},
+		{"local.txt", false, false},
+		{"main.go", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, _ := m.match(tt.path, tt.isDir)
+			if got != tt.expect {
+				t.Errorf("match(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestScanRespectsGitignore(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".gitignore"), "dist/\nprovenance.json\n")
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tgo build .\n")
+	writeFile(t, filepath.Join(workspace, "provenance.json"), testStatement)
+	writeFile(t, filepath.Join(workspace, "dist", "Dockerfile"), "FROM alpine:latest\n")
+
+	client := testClient(t)
+
+	resp := invokeScan(t, client, workspace)
+	if found := findByRule(resp.GetFindings(), "PROV-003"); len(found) != 0 {
+		t.Errorf("expected gitignored dist/ to be skipped, got %d PROV-003 findings", len(found))
+	}
+	if len(findByRule(resp.GetFindings(), "PROV-001")) == 0 {
+		t.Error("a gitignored provenance file must not count as provenance")
+	}
+	found := findByRule(resp.GetFindings(), "PROV-006")
+	if len(found) != 1 {
+		t.Fatalf("expected one PROV-006 finding for the gitignored provenance file, got %d", len(found))
+	}
+	if got := found[0].GetMetadata()["ignore_pattern"]; got != "provenance.json" {
+		t.Errorf("ignore_pattern = %q, want %q", got, "provenance.json")
+	}
+
+	resp = invokeScanWithInput(t, client, map[string]any{
+		"workspace_root":    workspace,
+		"respect_gitignore": false,
+	})
+	if len(findByRule(resp.GetFindings(), "PROV-003")) == 0 {
+		t.Error("expected dist/ to be scanned when respect_gitignore is false")
+	}
+	if len(findByRule(resp.GetFindings(), "PROV-001")) != 0 {
+		t.Error("expected provenance.json to count when respect_gitignore is false")
+	}
+}
+
+func TestScanRespectsNoxignore(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".noxignore"), "fixtures/\n")
+	writeFile(t, filepath.Join(workspace, "fixtures", "Dockerfile"), "FROM alpine:latest\n")
+
+	client := testClient(t)
+	resp := invokeScanWithInput(t, client, map[string]any{
+		"workspace_root":    workspace,
+		"respect_gitignore": false,
+	})
+	if got := len(withoutSummary(resp.GetFindings())); got != 0 {
+		t.Errorf("expected .noxignore exclusions to apply regardless of respect_gitignore, got %d findings", got)
+	}
+}
+
+func TestScanReportsGitignoredProvenance(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".gitignore"), "dist/\n*.intoto.jsonl\n")
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tgo build .\n")
+	writeFile(t, filepath.Join(workspace, "dist", "app.intoto.jsonl"), testStatement)
+	writeFile(t, filepath.Join(workspace, "dist", "app"), "binary")
+	writeFile(t, filepath.Join(workspace, "release", "app.intoto.jsonl"), testStatement)
+	writeFile(t, filepath.Join(workspace, "sub", ".gitignore"), "!release.intoto.jsonl\n")
+	writeFile(t, filepath.Join(workspace, "sub", "release.intoto.jsonl"), testStatement)
+	writeFile(t, filepath.Join(workspace, "sub", "other.intoto.jsonl"), testStatement)
+	writeFile(t, filepath.Join(workspace, "local", ".gitignore"), "*\n")
+	writeFile(t, filepath.Join(workspace, "local", "slsa", "build.json"), testStatement)
+	writeFile(t, filepath.Join(workspace, ".noxignore"), "fixtures/\n")
+	writeFile(t, filepath.Join(workspace, "fixtures", "provenance.json"), testStatement)
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root":  workspace,
+		"provenance_dirs": "slsa",
+	})
+
+	type ignored struct{ pattern, source string }
+	got := make(map[string]ignored)
+	for _, f := range findByRule(resp.GetFindings(), "PROV-006") {
+		meta := f.GetMetadata()
+		got[f.GetLocation().GetFilePath()] = ignored{meta["ignore_pattern"], meta["ignore_source"]}
+	}
+	want := map[string]ignored{
+		"dist/app.intoto.jsonl":    {"dist/", ".gitignore"},
+		"release/app.intoto.jsonl": {"*.intoto.jsonl", ".gitignore"},
+		"sub/other.intoto.jsonl":   {"*.intoto.jsonl", ".gitignore"},
+		"local/slsa/build.json":    {"*", "local/.gitignore"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected PROV-006 findings for %v, got %v", want, got)
+	}
+	for location, w := range want {
+		if got[location] != w {
+			t.Errorf("PROV-006 at %s = %+v, want %+v", location, got[location], w)
+		}
+	}
+	// The negated file is committed and counts as provenance.
+	if found := findByRule(resp.GetFindings(), "PROV-001"); len(found) != 0 {
+		t.Errorf("expected the re-included provenance file to count, got %d PROV-001 findings", len(found))
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// gitlabProvenanceRuleID flags a GitLab CI job that publishes artifacts in
+// a pipeline that generates no provenance for them.
+const gitlabProvenanceRuleID = "PROV-043"
+
+// How a GitLab CI job publishes artifacts.
+const (
+	gitlabPublishRelease    = "release"
+	gitlabPublishReleaseCLI = "release-cli"
+	gitlabPublishRegistry   = "registry-push"
+	gitlabPublishPackage    = "package-upload"
+)
+
+var (
+	// gitlabGlobalKeys are the top-level keys of a GitLab CI config that
+	// are not jobs.
+	gitlabGlobalKeys = map[string]bool{
+		"default": true, "include": true, "stages": true, "variables": true, "workflow": true,
+		"image": true, "services": true, "cache": true, "before_script": true, "after_script": true,
+	}
+	// attestationReports are the artifacts:reports types that record what
+	// a job built.
+	attestationReports = map[string]bool{"cyclonedx": true}
+
+	// artifactsMetadataVar matches the variable that has the runner write
+	// SLSA provenance for a job's artifacts.
+	artifactsMetadataVar = regexp.MustCompile(`^["']?RUNNER_GENERATE_ARTIFACTS_METADATA["']?\s*:\s*["']?(?i:true)\b`)
+	releaseCLI           = regexp.MustCompile(`\brelease-cli\b`)
+	// gitlabRegistryPush matches image pushes beyond docker, podman, and
+	// buildah, which publishStepsOf already knows.
+	gitlabRegistryPush = regexp.MustCompile(`\bcrane\s+(?:push|copy|cp)\b|/kaniko/executor\b.*--destination|\bskopeo\s+copy\b`)
+	// gitlabPackageUpload matches an upload to the GitLab package registry.
+	gitlabPackageUpload = regexp.MustCompile(`\bcurl\b.*(?:--upload-file|\s-T\s).*/packages/`)
+
+	// yamlAnchor and yamlAlias match a line ending in an anchor or alias,
+	// such as ".base: &base" and "<<: *base".
+	yamlAnchor = regexp.MustCompile(`(?:^|:\s+|-\s+)&([A-Za-z0-9_.-]+)\s*$`)
+	yamlAlias  = regexp.MustCompile(`(?:^|:\s+|-\s+)\*([A-Za-z0-9_.-]+)\s*$`)
+)
+
+// gitlabPublish is a publish step of a GitLab CI job.
+type gitlabPublish struct {
+	line      int
+	mechanism string
+}
+
+// gitlabJob is a top-level entry of a GitLab CI config: a job, a hidden
+// template, or a global keyword.
+type gitlabJob struct {
+	name string
+	line int
+	// childIndent is the indentation of the entry's own keys, -1 until read.
+	childIndent int
+	childKey    string
+	// reportsIndent is the indentation of artifacts:reports while its
+	// report types are read, -1 otherwise.
+	reportsIndent int
+	// anchorIndent is the indentation of an anchored key whose value may
+	// be a list of script commands, such as ".script: &script", and
+	// itemIndent that of its items once read; both are -1 otherwise.
+	anchorIndent int
+	itemIndent   int
+
+	// extends names the templates the job extends, and aliases the
+	// anchors it merges or reuses.
+	extends []string
+	aliases []string
+
+	publish []gitlabPublish
+	// provenance is set when the entry generates provenance or signs.
+	provenance bool
+}
+
+// gitlabTracker follows the jobs of a GitLab CI config line by line: how
+// they publish, and whether anything in the pipeline generates provenance.
+type gitlabTracker struct {
+	jobs   []*gitlabJob
+	byName map[string]*gitlabJob
+	// anchors maps each anchor to the entry defining it. An anchor nested
+	// in an entry stands for the whole entry.
+	anchors map[string]*gitlabJob
+}
+
+func newGitLabTracker() *gitlabTracker {
+	return &gitlabTracker{byName: make(map[string]*gitlabJob), anchors: make(map[string]*gitlabJob)}
+}
+
+// track reads the next line of the config, given the classifier's context
+// and command for it.
+func (t *gitlabTracker) track(line string, lineNum int, lc lineContext, command string) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || lc == contextComment {
+		return
+	}
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	if indent == 0 {
+		name, ok := yamlMappingKey(trimmed)
+		if !ok {
+			return
+		}
+		j := &gitlabJob{name: name, line: lineNum, childIndent: -1, reportsIndent: -1, anchorIndent: -1, itemIndent: -1}
+		t.jobs = append(t.jobs, j)
+		t.byName[j.name] = j
+		if m := yamlAnchor.FindStringSubmatch(trimmed); m != nil {
+			t.anchors[m[1]] = j
+			j.anchorIndent = 0
+		}
+		if j.name == "include" && containsFoldASCII(trimmed, "slsa") {
+			j.provenance = true
+		}
+		return
+	}
+	if len(t.jobs) == 0 {
+		return
+	}
+	j := t.jobs[len(t.jobs)-1]
+	key := yamlKey.FindStringSubmatch(trimmed)
+
+	if lc != contextRunCommand && j.anchoredCommand(trimmed, indent, lineNum) {
+		return
+	}
+	if m := yamlAnchor.FindStringSubmatch(trimmed); m != nil {
+		t.anchors[m[1]] = j
+		j.anchorIndent, j.itemIndent = indent, -1
+	}
+	if m := yamlAlias.FindStringSubmatch(trimmed); m != nil {
+		j.aliases = append(j.aliases, m[1])
+	}
+	if artifactsMetadataVar.MatchString(trimmed) || (j.name == "include" && containsFoldASCII(trimmed, "slsa")) {
+		j.provenance = true
+	}
+	if j.childIndent < 0 {
+		j.childIndent = indent
+	}
+	if indent == j.childIndent && key != nil {
+		j.childKey, j.reportsIndent = key[1], -1
+	}
+	if lc == contextRunCommand {
+		j.trackCommand(lineNum, command)
+		return
+	}
+
+	if indent == j.childIndent && key != nil {
+		value := yamlScalar(strings.TrimSpace(trimmed[len(key[0]):]))
+		switch j.childKey {
+		case "release":
+			j.publish = append(j.publish, gitlabPublish{line: lineNum, mechanism: gitlabPublishRelease})
+		case "extends":
+			for _, name := range strings.Split(strings.Trim(value, "[]"), ",") {
+				if name = strings.Trim(strings.TrimSpace(name), `"'`); name != "" {
+					j.extends = append(j.extends, name)
+				}
+			}
+		}
+		return
+	}
+
+	switch j.childKey {
+	case "extends":
+		if name, ok := strings.CutPrefix(trimmed, "- "); ok {
+			j.extends = append(j.extends, yamlScalar(strings.TrimSpace(name)))
+		}
+	case "artifacts":
+		if j.reportsIndent >= 0 && indent <= j.reportsIndent {
+			j.reportsIndent = -1
+		}
+		switch {
+		case key != nil && key[1] == "reports":
+			j.reportsIndent = indent
+		case key != nil && j.reportsIndent >= 0 && attestationReports[key[1]]:
+			j.provenance = true
+		}
+	}
+}
+
+// anchoredCommand reads a line below an anchored key as a script command
+// when the key's value is a list, which jobs reuse with "script: *name"
+// outside any script key. It reports whether the line was one.
+func (j *gitlabJob) anchoredCommand(trimmed string, indent, lineNum int) bool {
+	if j.anchorIndent < 0 {
+		return false
+	}
+	item, isItem := strings.CutPrefix(trimmed, "- ")
+	switch {
+	case indent <= j.anchorIndent:
+		j.anchorIndent, j.itemIndent = -1, -1
+		return false
+	case j.itemIndent < 0 && isItem:
+		j.itemIndent = indent
+	case j.itemIndent < 0 || indent < j.itemIndent:
+		j.anchorIndent, j.itemIndent = -1, -1
+		return false
+	case indent > j.itemIndent || !isItem:
+		return true
+	}
+	j.trackCommand(lineNum, yamlScalar(strings.TrimSpace(item)))
+	return true
+}
+
+// trackCommand records what a script command of the entry publishes or
+// signs.
+func (j *gitlabJob) trackCommand(lineNum int, command string) {
+	if signingStepPattern.MatchString(command) {
+		j.provenance = true
+	}
+	if releaseCLI.MatchString(command) {
+		j.publish = append(j.publish, gitlabPublish{line: lineNum, mechanism: gitlabPublishReleaseCLI})
+	}
+	if gitlabRegistryPush.MatchString(command) {
+		j.publish = append(j.publish, gitlabPublish{line: lineNum, mechanism: gitlabPublishRegistry})
+	}
+	if gitlabPackageUpload.MatchString(command) {
+		j.publish = append(j.publish, gitlabPublish{line: lineNum, mechanism: gitlabPublishPackage})
+	}
+	for _, step := range publishStepsOf("", lineNum, command, isASCII(command)) {
+		mechanism := gitlabPublishPackage
+		switch step.kind {
+		case publishContainer:
+			mechanism = gitlabPublishRegistry
+		case publishGitHubRelease:
+			mechanism = gitlabPublishRelease
+		}
+		j.publish = append(j.publish, gitlabPublish{line: lineNum, mechanism: mechanism})
+	}
+}
+
+// hidden reports whether an entry is a template or global keyword rather
+// than a job the pipeline runs.
+func (j *gitlabJob) hidden() bool {
+	return strings.HasPrefix(j.name, ".") || gitlabGlobalKeys[j.name]
+}
+
+// resolve returns the publish steps of a job and whether it generates
+// provenance, including what it inherits through extends: and anchors.
+func (t *gitlabTracker) resolve(j *gitlabJob, seen map[*gitlabJob]bool) ([]gitlabPublish, bool) {
+	if seen[j] {
+		return nil, false
+	}
+	seen[j] = true
+	publish, provenance := append([]gitlabPublish(nil), j.publish...), j.provenance
+	var inherited []*gitlabJob
+	for _, name := range j.extends {
+		inherited = append(inherited, t.byName[name])
+	}
+	for _, alias := range j.aliases {
+		inherited = append(inherited, t.anchors[alias])
+	}
+	for _, parent := range inherited {
+		if parent == nil {
+			continue
+		}
+		p, prov := t.resolve(parent, seen)
+		publish = append(publish, p...)
+		provenance = provenance || prov
+	}
+	return publish, provenance
+}
+
+// report flags each job that publishes, unless a global keyword or any
+// job of the pipeline generates provenance. Templates only count through
+// the jobs that use them.
+func (t *gitlabTracker) report(findings *findingSet, filePath string) {
+	type publisher struct {
+		job     *gitlabJob
+		publish []gitlabPublish
+	}
+	var publishers []publisher
+	for _, j := range t.jobs {
+		if gitlabGlobalKeys[j.name] {
+			if j.provenance {
+				return
+			}
+			continue
+		}
+		if j.hidden() {
+			continue
+		}
+		publish, provenance := t.resolve(j, make(map[*gitlabJob]bool))
+		if provenance {
+			return
+		}
+		if len(publish) > 0 {
+			publishers = append(publishers, publisher{job: j, publish: publish})
+		}
+	}
+	for _, p := range publishers {
+		seen := make(map[string]bool)
+		var mechanisms []string
+		for _, step := range p.publish {
+			if !seen[step.mechanism] {
+				seen[step.mechanism] = true
+				mechanisms = append(mechanisms, step.mechanism)
+			}
+		}
+		sort.Strings(mechanisms)
+		findings.Finding(
+			gitlabProvenanceRuleID,
+			sdk.SeverityMedium,
+			sdk.ConfidenceMedium,
+			fmt.Sprintf("GitLab CI job %q publishes artifacts (%s) without provenance generation", p.job.name, strings.Join(mechanisms, ", ")),
+		).
+			At(filePath, p.job.line, p.job.line).
+			WithMetadata("type", "published_without_provenance").
+			WithMetadata("job", p.job.name).
+			WithMetadata("publish_mechanism", strings.Join(mechanisms, ",")).
+			WithMetadata("publish_line", strconv.Itoa(p.publish[0].line)).
+			Done()
+	}
+}
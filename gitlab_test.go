@@ -0,0 +1,85 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitLabTrackerInheritance(t *testing.T) {
+	config := strings.Join([]string{
+		".base: &base",
+		"  stage: release",
+		"  script:",
+		"    - docker push registry.example.com/app:latest",
+		"",
+		".signed:",
+		"  after_script:",
+		"    - cosign attest --yes --predicate provenance.json registry.example.com/app:latest",
+		"",
+		"merged:",
+		"  <<: *base",
+		"",
+		"extended:",
+		"  extends:",
+		"    - .signed",
+		"  release:",
+		"    tag_name: $CI_COMMIT_TAG",
+	}, "\n")
+	tracker := newGitLabTracker()
+	lines := newFormatClassifier(formatYAML)
+	for i, line := range strings.Split(config, "\n") {
+		lc, command := lines.classifyCommand(line)
+		tracker.track(line, i+1, lc, command)
+	}
+
+	publish, provenance := tracker.resolve(tracker.byName["merged"], make(map[*gitlabJob]bool))
+	if len(publish) != 1 || publish[0].mechanism != gitlabPublishRegistry || publish[0].line != 4 || provenance {
+		t.Errorf("merged: publish = %+v, provenance = %v", publish, provenance)
+	}
+	publish, provenance = tracker.resolve(tracker.byName["extended"], make(map[*gitlabJob]bool))
+	if len(publish) != 1 || publish[0].mechanism != gitlabPublishRelease || !provenance {
+		t.Errorf("extended: publish = %+v, provenance = %v", publish, provenance)
+	}
+}
+
+func TestScanGitLabProvenance(t *testing.T) {
+	client := testClient(t)
+	if found := findByRule(invokeScan(t, client, filepath.Join(testdataDir(t), "gitlab-hardened")).GetFindings(), gitlabProvenanceRuleID); len(found) != 0 {
+		t.Errorf("expected no %s findings for the hardened pipeline, got %d", gitlabProvenanceRuleID, len(found))
+	}
+
+	workspace := filepath.Join(testdataDir(t), "gitlab-release")
+	found := findByRule(invokeScan(t, client, workspace).GetFindings(), gitlabProvenanceRuleID)
+	jobs := make(map[string]string)
+	for _, f := range found {
+		jobs[f.GetMetadata()["job"]] = f.GetMetadata()["publish_mechanism"]
+	}
+	if len(found) != 2 || jobs["release"] != gitlabPublishReleaseCLI || jobs["upload"] != gitlabPublishPackage {
+		t.Errorf("expected release and upload jobs to be flagged, got %v", jobs)
+	}
+
+	resp := invokeScanWithInput(t, client, map[string]any{
+		"workspace_root":          workspace,
+		"check_gitlab_provenance": false,
+	})
+	if found := findByRule(resp.GetFindings(), gitlabProvenanceRuleID); len(found) != 0 {
+		t.Errorf("expected check_gitlab_provenance=false to disable %s, got %d", gitlabProvenanceRuleID, len(found))
+	}
+}
+
+func TestScanGitLabQuotedAndSpacedJobNames(t *testing.T) {
+	found := findByRule(invokeScan(t, testClient(t), filepath.Join(testdataDir(t), "gitlab-job-names")).GetFindings(), gitlabProvenanceRuleID)
+	jobs := make(map[string]string)
+	lines := make(map[string]int32)
+	for _, f := range found {
+		jobs[f.GetMetadata()["job"]] = f.GetMetadata()["publish_mechanism"]
+		lines[f.GetMetadata()["job"]] = f.GetLocation().GetStartLine()
+	}
+	if len(found) != 2 || jobs["release c"] != gitlabPublishRelease || jobs["deploy prod"] != gitlabPublishRegistry {
+		t.Errorf("expected the quoted \"release c\" and spaced deploy prod jobs to be flagged on their own, got %v", jobs)
+	}
+	if lines["release c"] != 15 || lines["deploy prod"] != 21 {
+		t.Errorf("expected the jobs at lines 15 and 21, got %v", lines)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+)
+
+// updateGolden rewrites the golden files instead of comparing against them:
+//
+//	go test -run TestRuleCatalogCoversFixtures -update
+var updateGolden = flag.Bool("update", false, "rewrite testdata golden files")
+
+// goldenRoot stands in for the scanned workspace in golden files.
+const goldenRoot = "$WORKSPACE"
+
+// goldenVolatileKeys are summary metadata keys that differ between runs or
+// machines, dropped from golden files.
+var goldenVolatileKeys = map[string]bool{
+	"elapsed_ms":   true,
+	"env_defaults": true,
+}
+
+// goldenFinding is the canonical form of a finding in a golden file.
+type goldenFinding struct {
+	Rule       string            `json:"rule"`
+	Path       string            `json:"path"`
+	Line       int32             `json:"line,omitempty"`
+	Severity   string            `json:"severity"`
+	Confidence string            `json:"confidence"`
+	Message    string            `json:"message"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// goldenFindings converts findings to their canonical form, with the
+// workspace root and volatile metadata normalized out, sorted by path, line,
+// rule, and message. encoding/json writes the metadata keys sorted.
+func goldenFindings(findings []*pluginv1.Finding, root string) []goldenFinding {
+	normalize := func(s string) string {
+		s = strings.ReplaceAll(s, root, goldenRoot)
+		return strings.ReplaceAll(s, filepath.ToSlash(root), goldenRoot)
+	}
+	out := make([]goldenFinding, 0, len(findings))
+	for _, f := range findings {
+		g := goldenFinding{
+			Rule:       f.GetRuleId(),
+			Path:       normalize(f.GetLocation().GetFilePath()),
+			Line:       f.GetLocation().GetStartLine(),
+			Severity:   severityNames[f.GetSeverity()],
+			Confidence: confidenceNames[f.GetConfidence()],
+			Message:    normalize(f.GetMessage()),
+		}
+		for key, value := range f.GetMetadata() {
+			if goldenVolatileKeys[key] || strings.HasPrefix(key, "metric_") {
+				continue
+			}
+			if g.Metadata == nil {
+				g.Metadata = make(map[string]string)
+			}
+			g.Metadata[key] = normalize(value)
+		}
+		out = append(out, g)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.Message < b.Message
+	})
+	return out
+}
+
+// compareGolden checks findings against the golden file at path, or
+// rewrites it under -update.
+func compareGolden(t *testing.T, path string, findings []*pluginv1.Finding, root string) {
+	t.Helper()
+	got, err := json.MarshalIndent(goldenFindings(findings, root), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v; run go test -run %s -update to create it", err, t.Name())
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	var wantFindings []goldenFinding
+	if err := json.Unmarshal(want, &wantFindings); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	gotLines, wantLines := goldenLines(goldenFindings(findings, root)), goldenLines(wantFindings)
+	for line := range wantLines {
+		if !gotLines[line] {
+			t.Errorf("missing finding: %s", line)
+		}
+	}
+	for line := range gotLines {
+		if !wantLines[line] {
+			t.Errorf("unexpected finding: %s", line)
+		}
+	}
+	t.Errorf("findings differ from %s; run go test -run %s -update to accept them", filepath.Base(path), t.Name())
+}
+
+// goldenLines indexes golden findings by their single-line JSON, so a
+// mismatch names the findings that differ rather than a whole file.
+func goldenLines(findings []goldenFinding) map[string]bool {
+	lines := make(map[string]bool, len(findings))
+	for _, f := range findings {
+		data, _ := json.Marshal(f)
+		lines[string(data)] = true
+	}
+	return lines
+}
+
+func TestGoldenFindingsNormalize(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "ws")
+	findings := []*pluginv1.Finding{
+		{
+			RuleId:   "PROV-003",
+			Message:  "b",
+			Location: &pluginv1.Location{FilePath: "Makefile", StartLine: 4},
+			Metadata: map[string]string{"type": "x", "script": root + "/build.sh"},
+		},
+		{
+			RuleId:   summaryRuleID,
+			Message:  "summary",
+			Location: &pluginv1.Location{FilePath: "."},
+			Metadata: map[string]string{"workspace_root": root, "elapsed_ms": "12", "metric_files_visited": "3", "files_walked": "3"},
+		},
+		{RuleId: "PROV-003", Message: "a", Location: &pluginv1.Location{FilePath: "Makefile", StartLine: 4}},
+	}
+
+	got := goldenFindings(findings, root)
+	if len(got) != 3 || got[0].Path != "." || got[1].Message != "a" || got[2].Message != "b" {
+		t.Fatalf("unexpected order: %+v", got)
+	}
+	if want := map[string]string{"workspace_root": goldenRoot, "files_walked": "3"}; len(got[0].Metadata) != len(want) ||
+		got[0].Metadata["workspace_root"] != goldenRoot {
+		t.Errorf("summary metadata = %v, want %v", got[0].Metadata, want)
+	}
+	if got[2].Metadata["script"] != goldenRoot+"/build.sh" {
+		t.Errorf("script = %q, want the root normalized", got[2].Metadata["script"])
+	}
+}
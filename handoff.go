@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// artifactHandoffRuleID flags a GitHub Actions job that attests artifacts
+// downloaded from the job that built them without checking they are the
+// ones it built.
+const artifactHandoffRuleID = "PROV-059"
+
+// Why an artifact handoff is not verified.
+const (
+	handoffNoExpectedDigest = "no_expected_digest"
+	handoffDigestUnverified = "digest_not_verified"
+)
+
+// checksumCheckCommand matches commands that check files against expected
+// checksums.
+var checksumCheckCommand = regexp.MustCompile(`\b(?:sha(?:1|224|256|384|512)sum|shasum|b2sum)\b.*\s(?:-c|--check)\b`)
+
+// artifactStep is an upload-artifact or download-artifact step. name is
+// empty for a download of every artifact or of a pattern.
+type artifactStep struct {
+	line int
+	name string
+}
+
+// artifactHandoff is a download, in an attesting job, of artifacts uploaded
+// by a job it needs.
+type artifactHandoff struct {
+	builder  *workflowJob
+	attester *workflowJob
+	download artifactStep
+	reason   string
+}
+
+// handoffs returns the downloads of attesting jobs whose artifacts come
+// from a job they need and are attested without an expected digest: the
+// attesting job neither reads the building job's outputs, nor, reading
+// them, checks the download against them before its first attestation or
+// attests the digest they carry.
+func (w *workflowTracker) handoffs() []artifactHandoff {
+	var out []artifactHandoff
+	for _, a := range w.jobs {
+		if a.attestLine == 0 || a.attestsOutputDigest {
+			continue
+		}
+		for _, d := range a.downloads {
+			if d.line > a.attestLine {
+				continue
+			}
+			b := w.uploader(a, d)
+			if b == nil {
+				continue
+			}
+			reason := handoffNoExpectedDigest
+			if a.readsOutputs[b.name] {
+				if a.verifiesBefore(a.attestLine) {
+					continue
+				}
+				reason = handoffDigestUnverified
+			}
+			out = append(out, artifactHandoff{builder: b, attester: a, download: d, reason: reason})
+		}
+	}
+	return out
+}
+
+// uploader returns the job, other than a and among those it needs, that
+// uploads the artifact d downloads, or nil. A download of every artifact
+// comes from the first such job uploading any.
+func (w *workflowTracker) uploader(a *workflowJob, d artifactStep) *workflowJob {
+	for _, b := range w.jobs {
+		if b == a || !w.dependsOn(a, b.name) {
+			continue
+		}
+		for _, u := range b.uploads {
+			if d.name == "" || u.name == d.name {
+				return b
+			}
+		}
+	}
+	return nil
+}
+
+// isArtifactCheck reports whether a run command checks files against
+// checksums or verifies their signatures or attestations.
+func isArtifactCheck(command string) bool {
+	return checksumCheckCommand.MatchString(command) || verifyStepPattern.MatchString(command)
+}
+
+// verifiesBefore reports whether the job checks its artifacts before line.
+func (j *workflowJob) verifiesBefore(line int) bool {
+	for _, l := range j.verifyLines {
+		if l < line {
+			return true
+		}
+	}
+	return false
+}
+
+// reportHandoffs flags attesting jobs that attest artifacts handed over by
+// another job without an expected digest.
+func (w *workflowTracker) reportHandoffs(findings *findingSet, filePath string) {
+	for _, h := range w.handoffs() {
+		artifact := h.download.name
+		if artifact == "" {
+			artifact = "all artifacts"
+		}
+		var message string
+		switch h.reason {
+		case handoffNoExpectedDigest:
+			message = fmt.Sprintf("Job %s attests %s downloaded from job %s without receiving the digest %s produced; pass it through needs.%s.outputs and verify it before attesting", h.attester.name, artifact, h.builder.name, h.builder.name, h.builder.name)
+		case handoffDigestUnverified:
+			message = fmt.Sprintf("Job %s reads the outputs of job %s but attests %s downloaded from it without checking them against the expected digest", h.attester.name, h.builder.name, artifact)
+		}
+		fb := findings.Finding(artifactHandoffRuleID, sdk.SeverityMedium, sdk.ConfidenceMedium, message).
+			At(filePath, h.download.line, h.download.line).
+			WithMetadata("type", "unverified_artifact_handoff").
+			WithMetadata("reason", h.reason).
+			WithMetadata("build_job", h.builder.name).
+			WithMetadata("attestation_job", h.attester.name).
+			WithMetadata("attestation_step", h.attester.attestStep).
+			WithMetadata("attestation_line", strconv.Itoa(h.attester.attestLine))
+		if h.download.name != "" {
+			fb.WithMetadata("artifact", h.download.name)
+		}
+		fb.Done()
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// handoffWorkflow is a build job uploading dist, followed by an attest job
+// running the given steps.
+func handoffWorkflow(attestSteps ...string) string {
+	return strings.Join(append([]string{
+		"on:",
+		"  push:",
+		"    tags: ['v*']",
+		"jobs:",
+		"  build:",
+		"    runs-on: ubuntu-latest",
+		"    outputs:",
+		"      digest: ${{ steps.hash.outputs.digest }}",
+		"    steps:",
+		"      - run: make dist",
+		"      - id: hash",
+		"        run: echo \"digest=$(sha256sum dist/app | cut -d' ' -f1)\" >> \"$GITHUB_OUTPUT\"",
+		"      - uses: actions/upload-artifact@v4",
+		"        with:",
+		"          name: dist",
+		"          path: dist/",
+		"  attest:",
+		"    needs: [build]",
+		"    runs-on: ubuntu-latest",
+		"    permissions:",
+		"      id-token: write",
+		"      attestations: write",
+		"    steps:",
+	}, attestSteps...), "\n") + "\n"
+}
+
+var (
+	handoffDownload = []string{
+		"      - uses: actions/download-artifact@v4",
+		"        with:",
+		"          name: dist",
+	}
+	handoffAttest = []string{
+		"      - uses: actions/attest-build-provenance@v1",
+		"        with:",
+		"          subject-path: dist/app",
+	}
+)
+
+func handoffSteps(parts ...[]string) []string {
+	var out []string
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func TestScanArtifactHandoffs(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  []string
+		reason string
+	}{
+		{name: "no expected digest", steps: handoffSteps(handoffDownload, handoffAttest), reason: handoffNoExpectedDigest},
+		{
+			name: "digest not verified",
+			steps: handoffSteps(handoffDownload, []string{
+				"      - run: echo \"expecting ${{ needs.build.outputs.digest }}\"",
+			}, handoffAttest),
+			reason: handoffDigestUnverified,
+		},
+		{
+			name: "verified after attesting",
+			steps: handoffSteps(handoffDownload, handoffAttest, []string{
+				"      - run: echo \"${{ needs.build.outputs.digest }}  dist/app\" | sha256sum -c -",
+			}),
+			reason: handoffDigestUnverified,
+		},
+		{
+			name: "download of every artifact",
+			steps: handoffSteps([]string{
+				"      - uses: actions/download-artifact@v4",
+				"        with:",
+				"          pattern: '*'",
+			}, handoffAttest),
+			reason: handoffNoExpectedDigest,
+		},
+		{
+			name: "hardened",
+			steps: handoffSteps(handoffDownload, []string{
+				"      - run: echo \"$DIGEST  dist/app\" | sha256sum --check -",
+				"        env:",
+				"          DIGEST: ${{ needs.build.outputs.digest }}",
+			}, handoffAttest),
+		},
+		{
+			name: "digest attested from outputs",
+			steps: handoffSteps(handoffDownload, []string{
+				"      - uses: actions/attest-build-provenance@v1",
+				"        with:",
+				"          subject-name: app",
+				"          subject-digest: sha256:${{ needs.build.outputs.digest }}",
+			}),
+		},
+		{
+			name: "other artifact",
+			steps: handoffSteps([]string{
+				"      - uses: actions/download-artifact@v4",
+				"        with:",
+				"          name: docs",
+			}, handoffAttest),
+		},
+		{name: "no attestation", steps: handoffDownload},
+	}
+	client := testClient(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), handoffWorkflow(tt.steps...))
+
+			found := findByRule(invokeScan(t, client, workspace).GetFindings(), artifactHandoffRuleID)
+			if tt.reason == "" {
+				if len(found) != 0 {
+					t.Errorf("expected no findings, got %v", found)
+				}
+				return
+			}
+			if len(found) != 1 {
+				t.Fatalf("expected one finding, got %d", len(found))
+			}
+			meta := found[0].GetMetadata()
+			if meta["reason"] != tt.reason || meta["build_job"] != "build" || meta["attestation_job"] != "attest" {
+				t.Errorf("unexpected metadata %v", meta)
+			}
+			if line := found[0].GetLocation().GetStartLine(); line != 24 {
+				t.Errorf("finding at line %d, want the download at 24", line)
+			}
+		})
+	}
+}
+
+func TestScanArtifactHandoffUnrelatedJob(t *testing.T) {
+	workspace := t.TempDir()
+	workflow := strings.Replace(handoffWorkflow(handoffSteps(handoffDownload, handoffAttest)...), "    needs: [build]\n", "", 1)
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), workflow)
+
+	if found := findByRule(invokeScan(t, testClient(t), workspace).GetFindings(), artifactHandoffRuleID); len(found) != 0 {
+		t.Errorf("expected no findings for a job that does not need the builder, got %d", len(found))
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// workflowIdentityRuleID flags GitHub Actions provenance whose workflow
+// repository or path does not match the workspace.
+const workflowIdentityRuleID = "PROV-037"
+
+// githubWorkflowDir holds the workflows a GitHub provenance entry point
+// names.
+const githubWorkflowDir = ".github/workflows/"
+
+// gitRemote is the workspace remote that provenance repositories are
+// compared against.
+type gitRemote struct {
+	// repository is the normalized "host/owner/repo" of the remote's URL.
+	repository string
+	name       string
+	// fallback is set when the workspace has no origin remote and name is
+	// the first remote of the config instead.
+	fallback bool
+}
+
+// gitConfigPath returns the config file of the workspace's git repository.
+func gitConfigPath(fsys workspaceFS, root string) string {
+	dir := gitCommonDir(fsys, root)
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "config")
+}
+
+// gitCommonDir returns the directory holding the config and refs of the
+// workspace's git repository, or "" outside one. A .git file, as in
+// worktrees and submodules, points at the git directory, whose commondir
+// names the shared one.
+func gitCommonDir(fsys workspaceFS, root string) string {
+	dir := filepath.Join(root, ".git")
+	info, err := fsys.Stat(dir)
+	if err != nil {
+		return ""
+	}
+	if !info.IsDir() {
+		data, err := fsys.ReadFile(dir)
+		if err != nil {
+			return ""
+		}
+		gitdir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+		if !ok {
+			return ""
+		}
+		dir = filepath.FromSlash(strings.TrimSpace(gitdir))
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(root, dir)
+		}
+	}
+	if common, err := fsys.ReadFile(filepath.Join(dir, "commondir")); err == nil {
+		c := filepath.FromSlash(strings.TrimSpace(string(common)))
+		if !filepath.IsAbs(c) {
+			c = filepath.Join(dir, c)
+		}
+		dir = c
+	}
+	return dir
+}
+
+// workspaceRemote reads the workspace's git remote: origin, or the first
+// remote with a URL when there is no origin. It is empty outside a git
+// repository or without remotes. The checked-out ref plays no part, so
+// detached heads read the same.
+func workspaceRemote(fsys workspaceFS, root string) gitRemote {
+	config := gitConfigPath(fsys, root)
+	if config == "" {
+		return gitRemote{}
+	}
+	f, err := fsys.Open(config)
+	if err != nil {
+		return gitRemote{}
+	}
+	defer func() { _ = f.Close() }()
+
+	var first gitRemote
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = ""
+			if name, ok := strings.CutPrefix(strings.TrimSuffix(line, "]"), "[remote "); ok {
+				section = strings.Trim(name, `"`)
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if section == "" || !ok || strings.TrimSpace(key) != "url" {
+			continue
+		}
+		remote := gitRemote{repository: normalizeRepository(value), name: section}
+		if section == "origin" {
+			return remote
+		}
+		if first.name == "" {
+			first = remote
+			first.fallback = true
+		}
+	}
+	return first
+}
+
+// workflowIdentity is the workflow a GitHub Actions provenance statement
+// claims it was built by, waiting to be checked against the workspace.
+type workflowIdentity struct {
+	location  string
+	line      int
+	index     int
+	builderID string
+	// repository is the normalized workflow repository, and path the
+	// workflow file within it.
+	repository string
+	path       string
+}
+
+// recordWorkflowIdentity records the workflow identity of a SLSA statement
+// whose entry point is a GitHub Actions workflow.
+func (s *scanSummary) recordWorkflowIdentity(location string, ps *parsedStatement) {
+	p := ps.Predicate
+	workflow, _, _ := strings.Cut(strings.TrimPrefix(p.entryPoint(), "./"), "@")
+	if !strings.HasPrefix(workflow, githubWorkflowDir) {
+		return
+	}
+	repo := p.sourceRepo()
+	if repo != "" {
+		repo = normalizeRepository(strings.TrimPrefix(repo, "git+"))
+	}
+	s.workflowIdentities = append(s.workflowIdentities, workflowIdentity{
+		location:   location,
+		line:       ps.Line,
+		index:      ps.Index,
+		builderID:  p.builderID(),
+		repository: repo,
+		path:       workflow,
+	})
+}
+
+// isForkOf reports whether two normalized repositories share host and name
+// but not owner, as a fork and its upstream do.
+func isForkOf(a, b string) bool {
+	ai, bi := strings.LastIndex(a, "/"), strings.LastIndex(b, "/")
+	if ai < 0 || bi < 0 || a[ai:] != b[bi:] {
+		return false
+	}
+	aHost, _, _ := strings.Cut(a, "/")
+	bHost, _, _ := strings.Cut(b, "/")
+	return aHost == bHost && a != b
+}
+
+// verifyWorkflowIdentities checks each recorded workflow identity against
+// the workspace: the workflow repository must be the workspace remote (a
+// fork of it is Medium, anything else High), and the workflow file must
+// exist in the workspace unless the repository is another one altogether.
+func verifyWorkflowIdentities(findings *findingSet, summary *scanSummary) {
+	remote := workspaceRemote(findings.files(), findings.root)
+	_, err := findings.files().Stat(filepath.Join(findings.root, filepath.FromSlash(githubWorkflowDir)))
+	hasWorkflows := err == nil
+
+	for _, w := range summary.workflowIdentities {
+		// Without a remote to compare, the workspace is taken to be the
+		// repository when it has workflows of its own.
+		checkPath := hasWorkflows
+		if remote.repository != "" && w.repository != "" && w.repository != remote.repository {
+			fork := isForkOf(w.repository, remote.repository)
+			kind, severity := "repository_mismatch", sdk.SeverityHigh
+			message := fmt.Sprintf("Provenance was built by a workflow in %s, not the workspace repository %s", w.repository, remote.repository)
+			if fork {
+				kind, severity = "fork_provenance", sdk.SeverityMedium
+				message = fmt.Sprintf("Provenance was built by a workflow in %s, a fork of the workspace repository %s", w.repository, remote.repository)
+			}
+			reportWorkflowIdentity(findings, w, remote, severity, sdk.ConfidenceHigh, kind, message)
+			// A fork shares the workspace's workflows; another repository
+			// has its own.
+			checkPath = fork
+		} else if remote.repository != "" && w.repository != "" {
+			checkPath = true
+		}
+		if !checkPath {
+			continue
+		}
+		if _, err := findings.files().Stat(filepath.Join(findings.root, filepath.FromSlash(w.path))); err != nil {
+			reportWorkflowIdentity(findings, w, remote, sdk.SeverityMedium, sdk.ConfidenceMedium, "workflow_not_found",
+				fmt.Sprintf("Provenance names workflow %s, which does not exist in the workspace", w.path))
+		}
+	}
+}
+
+// reportWorkflowIdentity flags a workflow identity, recording the remote it
+// was compared against and, when origin was missing, the remote used
+// instead.
+func reportWorkflowIdentity(findings *findingSet, w workflowIdentity, remote gitRemote, severity pluginv1.Severity, confidence pluginv1.Confidence, kind, message string) {
+	fb := findings.Finding(workflowIdentityRuleID, severity, confidence, message).
+		At(w.location, w.line, w.line).
+		WithMetadata("type", kind).
+		WithMetadata("statement_index", strconv.Itoa(w.index)).
+		WithMetadata("workflow_path", w.path)
+	if w.repository != "" {
+		fb.WithMetadata("workflow_repository", w.repository)
+	}
+	if w.builderID != "" {
+		fb.WithMetadata("builder_id", w.builderID)
+	}
+	if remote.repository != "" {
+		fb.WithMetadata("origin_repository", remote.repository).
+			WithMetadata("remote", remote.name)
+		if remote.fallback {
+			fb.WithMetadata("remote_fallback", "first_remote")
+		}
+	}
+	fb.Done()
+}
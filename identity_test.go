@@ -0,0 +1,134 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// workflowStatement returns a SLSA v1 statement built by a GitHub workflow.
+func workflowStatement(repository, path string) string {
+	return `{"_type":"https://in-toto.io/Statement/v1","predicateType":"https://slsa.dev/provenance/v1",` +
+		`"subject":[{"name":"app","digest":{"sha256":"` + strings.Repeat("ab", 32) + `"}}],` +
+		`"predicate":{"buildDefinition":{"buildType":"https://actions.github.io/buildtypes/workflow/v1",` +
+		`"externalParameters":{"workflow":{"ref":"refs/tags/v1.0.0","repository":"` + repository + `","path":"` + path + `"}}},` +
+		`"runDetails":{"builder":{"id":"https://github.com/actions/runner/github-hosted"}}}}`
+}
+
+func TestWorkspaceRemote(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   gitRemote
+	}{
+		{
+			"origin",
+			"[remote \"upstream\"]\n\turl = https://github.com/upstream/app\n[remote \"origin\"]\n\turl = git@github.com:example/app.git\n",
+			gitRemote{repository: "github.com/example/app", name: "origin"},
+		},
+		{
+			"fallback",
+			"[core]\n\tbare = false\n[remote \"upstream\"]\n\turl = https://github.com/upstream/app.git\n[remote \"mirror\"]\n\turl = https://gitlab.com/example/app\n",
+			gitRemote{repository: "github.com/upstream/app", name: "upstream", fallback: true},
+		},
+		{"no remotes", "[core]\n\tbare = false\n", gitRemote{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			writeFile(t, filepath.Join(workspace, ".git", "config"), tt.config)
+			if got := workspaceRemote(osFS{}, workspace); got != tt.want {
+				t.Errorf("workspaceRemote = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkspaceRemoteWorktree(t *testing.T) {
+	base := t.TempDir()
+	writeFile(t, filepath.Join(base, "main", ".git", "config"), "[remote \"origin\"]\n\turl = https://github.com/example/app\n")
+	writeFile(t, filepath.Join(base, "main", ".git", "worktrees", "wt", "commondir"), "../..\n")
+	workspace := filepath.Join(base, "wt")
+	writeFile(t, filepath.Join(workspace, ".git"), "gitdir: ../main/.git/worktrees/wt\n")
+
+	if got := workspaceRemote(osFS{}, workspace); got.repository != "github.com/example/app" {
+		t.Errorf("workspaceRemote = %+v, want the main checkout's origin", got)
+	}
+}
+
+func TestIsForkOf(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"github.com/someone/app", "github.com/example/app", true},
+		{"github.com/example/app", "github.com/example/app", false},
+		{"github.com/example/other", "github.com/example/app", false},
+		{"gitlab.com/someone/app", "github.com/example/app", false},
+	}
+	for _, tt := range tests {
+		if got := isForkOf(tt.a, tt.b); got != tt.want {
+			t.Errorf("isForkOf(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestScanWorkflowIdentity(t *testing.T) {
+	tests := []struct {
+		name       string
+		repository string
+		path       string
+		kinds      map[string]string
+	}{
+		{"match", "https://github.com/example/app", ".github/workflows/release.yml", map[string]string{}},
+		{"fork", "https://github.com/someone/app", ".github/workflows/release.yml", map[string]string{"fork_provenance": "medium"}},
+		{"mismatch", "https://github.com/other/tool", ".github/workflows/missing.yml", map[string]string{"repository_mismatch": "high"}},
+		{"missing workflow", "https://github.com/example/app", ".github/workflows/publish.yml", map[string]string{"workflow_not_found": "medium"}},
+		{"fork missing workflow", "https://github.com/someone/app", ".github/workflows/publish.yml", map[string]string{"fork_provenance": "medium", "workflow_not_found": "medium"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			writeFile(t, filepath.Join(workspace, ".git", "config"), "[remote \"origin\"]\n\turl = git@github.com:example/app.git\n")
+			writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), "on: release\njobs: {}\n")
+			writeFile(t, filepath.Join(workspace, "provenance.json"), workflowStatement(tt.repository, tt.path))
+
+			resp := invokeScan(t, testClient(t), workspace)
+
+			got := make(map[string]string)
+			for _, f := range findByRule(resp.GetFindings(), workflowIdentityRuleID) {
+				meta := f.GetMetadata()
+				got[meta["type"]] = severityNames[f.GetSeverity()]
+				if meta["origin_repository"] != "github.com/example/app" || meta["remote"] != "origin" || meta["workflow_path"] != tt.path {
+					t.Errorf("unexpected metadata: %v", meta)
+				}
+			}
+			if len(got) != len(tt.kinds) {
+				t.Fatalf("got findings %v, want %v", got, tt.kinds)
+			}
+			for kind, severity := range tt.kinds {
+				if got[kind] != severity {
+					t.Errorf("%s: severity %q, want %q", kind, got[kind], severity)
+				}
+			}
+		})
+	}
+}
+
+func TestScanWorkflowIdentityFallbackRemote(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".git", "config"), "[remote \"upstream\"]\n\turl = https://github.com/example/app\n")
+	writeFile(t, filepath.Join(workspace, "provenance.json"), workflowStatement("https://github.com/someone/app", ".github/workflows/release.yml"))
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	found := findByRule(resp.GetFindings(), workflowIdentityRuleID)
+	if len(found) != 2 {
+		t.Fatalf("expected a fork and a missing workflow finding, got %d", len(found))
+	}
+	for _, f := range found {
+		if meta := f.GetMetadata(); meta["remote"] != "upstream" || meta["remote_fallback"] != "first_remote" {
+			t.Errorf("expected the upstream remote as fallback, got %v", meta)
+		}
+	}
+}
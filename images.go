@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// Rule IDs for image attestation correlation.
+const (
+	unattestedImageRuleID = "PROV-010"
+	tagOnlyImageRuleID    = "PROV-011"
+)
+
+// Image reference sources.
+const (
+	imageSourceDockerfile = "dockerfile"
+	imageSourceCompose    = "compose"
+	imageSourceKubernetes = "kubernetes"
+)
+
+// defaultRegistry is the registry of image references that name none.
+const defaultRegistry = "docker.io"
+
+// imageRef is a container image reference found in the workspace.
+type imageRef struct {
+	// raw is the reference as written.
+	raw string
+	// repository is the normalized repository, including the registry.
+	repository string
+	tag        string
+	// digest is the lowercased "algorithm:hex" digest, if pinned.
+	digest string
+
+	source string
+	path   string
+	line   int
+	// instruction is the Dockerfile instruction referencing the image when
+	// it is not FROM.
+	instruction string
+}
+
+// parseImageRef splits and normalizes an image reference. Short Docker Hub
+// names are expanded, so "nginx" and "docker.io/library/nginx" compare
+// equal. It reports false for references it cannot interpret.
+func parseImageRef(raw string) (imageRef, bool) {
+	ref := imageRef{raw: raw}
+	name := raw
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.digest = strings.ToLower(name[i+1:])
+		name = name[:i]
+		if !strings.Contains(ref.digest, ":") {
+			return imageRef{}, false
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.tag = name[i+1:]
+		name = name[:i]
+	}
+	if name == "" || strings.ContainsAny(name, " \t$") {
+		return imageRef{}, false
+	}
+
+	first, rest, hasSlash := strings.Cut(name, "/")
+	switch {
+	case hasSlash && (strings.ContainsAny(first, ".:") || first == "localhost"):
+		ref.repository = name
+	case hasSlash:
+		ref.repository = defaultRegistry + "/" + name
+	default:
+		ref.repository = defaultRegistry + "/library/" + name
+		rest = name
+	}
+	if first == "index.docker.io" {
+		ref.repository = defaultRegistry + "/" + rest
+	}
+	if ref.tag == "" && ref.digest == "" {
+		ref.tag = "latest"
+	}
+	return ref, true
+}
+
+// imageSourceOf returns the image source a file name implies, or "" for
+// YAML files that are only Kubernetes manifests if their content says so.
+func imageSourceOf(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case lower == "dockerfile" || lower == "containerfile" ||
+		strings.HasPrefix(lower, "dockerfile.") || strings.HasSuffix(lower, ".dockerfile"):
+		return imageSourceDockerfile
+	case (strings.HasPrefix(lower, "docker-compose") || strings.HasPrefix(lower, "compose.")) && isYAMLName(lower):
+		return imageSourceCompose
+	}
+	return ""
+}
+
+// isYAMLName reports whether a lowercase file name has a YAML extension.
+func isYAMLName(lower string) bool {
+	return strings.HasSuffix(lower, ".yml") || strings.HasSuffix(lower, ".yaml")
+}
+
+// isImageSource reports whether a file may hold image references worth
+// extracting.
+func isImageSource(name string) bool {
+	return imageSourceOf(name) != "" || isYAMLName(strings.ToLower(name))
+}
+
+var (
+	yamlImagePattern   = regexp.MustCompile(`^\s*(?:-\s+)?image:\s*["']?([^"'\s#]+)`)
+	k8sAPIVersionLine  = regexp.MustCompile(`(?m)^apiVersion:\s*\S`)
+	k8sKindLine        = regexp.MustCompile(`(?m)^kind:\s*\S`)
+	goTemplateDelimits = []byte("{{")
+)
+
+// scanImageReferences extracts image references from a Dockerfile, compose
+// file, or Kubernetes manifest. YAML that is neither is ignored, and
+// templated YAML such as Helm chart templates is skipped rather than
+// half-parsed.
+func scanImageReferences(ctx context.Context, fsys workspaceFS, filePath string, summary *scanSummary) error {
+	data, err := fsys.ReadFile(filePath)
+	if err != nil {
+		summary.filesUnreadable++
+		return nil
+	}
+
+	source := imageSourceOf(filepath.Base(filePath))
+	if source == "" {
+		if !k8sAPIVersionLine.Match(data) || !k8sKindLine.Match(data) {
+			return nil
+		}
+		if bytes.Contains(data, goTemplateDelimits) {
+			summary.templatesSkipped++
+			return nil
+		}
+		source = imageSourceKubernetes
+	}
+
+	stages := make(map[string]bool)
+	var allStages map[string]bool
+	if source == imageSourceDockerfile {
+		allStages = dockerfileStages(data)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	lineNum := 0
+	var pace cancelCheck
+	for scanner.Scan() {
+		lineNum++
+		if pace.due(len(scanner.Bytes())) && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var raw, instruction string
+		if source == imageSourceDockerfile {
+			raw = dockerfileFromImage(scanner.Text(), stages)
+			if raw == "" {
+				if raw = copyFromImage(scanner.Text(), allStages); raw != "" {
+					instruction = "COPY --from"
+				}
+			}
+		} else if m := yamlImagePattern.FindStringSubmatch(scanner.Text()); m != nil {
+			raw = m[1]
+		}
+		if raw == "" {
+			continue
+		}
+		ref, ok := parseImageRef(raw)
+		if !ok {
+			continue
+		}
+		ref.source, ref.path, ref.line, ref.instruction = source, filePath, lineNum, instruction
+		summary.imageRefs = append(summary.imageRefs, ref)
+	}
+	return scanner.Err()
+}
+
+// dockerfileFromImage returns the image a FROM instruction builds on, or ""
+// for other lines, the scratch image, and earlier build stages. Stage names
+// declared with AS are added to stages.
+func dockerfileFromImage(line string, stages map[string]bool) string {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+		return ""
+	}
+	args := fields[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	image := args[0]
+	earlierStage := stages[strings.ToLower(image)]
+	if len(args) >= 3 && strings.EqualFold(args[1], "AS") {
+		stages[strings.ToLower(args[2])] = true
+	}
+	if earlierStage || strings.EqualFold(image, "scratch") {
+		return ""
+	}
+	return image
+}
+
+// dockerfileStages returns the lowercased names of all build stages a
+// Dockerfile declares with FROM ... AS.
+func dockerfileStages(data []byte) map[string]bool {
+	stages := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		dockerfileFromImage(line, stages)
+	}
+	return stages
+}
+
+// copyFromImage returns the image a COPY --from instruction copies from, or
+// "" for other lines and copies from build stages, named or numbered.
+func copyFromImage(line string, stages map[string]bool) string {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "COPY") {
+		return ""
+	}
+	for _, arg := range fields[1:] {
+		if !strings.HasPrefix(arg, "--") {
+			break
+		}
+		from, ok := strings.CutPrefix(arg, "--from=")
+		if !ok {
+			continue
+		}
+		from = strings.Trim(from, `"'`)
+		if _, err := strconv.Atoi(from); err == nil || from == "" || stages[strings.ToLower(from)] {
+			return ""
+		}
+		return from
+	}
+	return ""
+}
+
+// reportImageAttestations compares the image references found in the
+// workspace with the subject digests of its attestations. Digest-pinned
+// references no attestation covers are reported, as are tag-only references,
+// which can never be matched by digest. Deployed images (compose and
+// Kubernetes) are reported at Medium, Dockerfile base images at Low.
+// Tag-only references are reported with lower confidence when an update bot
+// maintains docker digest pins, since the bot compensates for them.
+func reportImageAttestations(findings *findingSet, summary *scanSummary) {
+	pinsManagedBy := summary.pinsManagedBy(pinEcosystemDocker)
+	for _, ref := range summary.imageRefs {
+		if ref.digest != "" && summary.attestedDigests[ref.digest] {
+			summary.imagesAttested++
+			continue
+		}
+
+		var fb *findingBuilder
+		if ref.digest == "" {
+			confidence := sdk.ConfidenceHigh
+			if pinsManagedBy != "" {
+				confidence = sdk.ConfidenceMedium
+			}
+			fb = findings.Finding(
+				tagOnlyImageRuleID,
+				sdk.SeverityLow,
+				confidence,
+				fmt.Sprintf("Image %s is referenced by tag only and cannot be matched to an attestation by digest", ref.raw),
+			).WithMetadata("type", "tag_only_image").
+				WithMetadata("image_tag", ref.tag)
+			if pinsManagedBy != "" {
+				fb.WithMetadata("pins_managed_by", pinsManagedBy)
+			}
+		} else {
+			severity := sdk.SeverityMedium
+			if ref.source == imageSourceDockerfile {
+				severity = sdk.SeverityLow
+			}
+			fb = findings.Finding(
+				unattestedImageRuleID,
+				severity,
+				sdk.ConfidenceMedium,
+				fmt.Sprintf("No attestation in the workspace covers image %s", ref.raw),
+			).WithMetadata("type", "unattested_image").
+				WithMetadata("image_digest", ref.digest)
+		}
+		fb.At(ref.path, ref.line, ref.line).
+			WithMetadata("image", ref.raw).
+			WithMetadata("image_repository", ref.repository).
+			WithMetadata("image_source", ref.source)
+		if ref.instruction != "" {
+			fb.WithMetadata("dockerfile_instruction", ref.instruction)
+		}
+		fb.Done()
+	}
+}
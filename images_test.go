@@ -0,0 +1,177 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+func TestParseImageRef(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		raw        string
+		repository string
+		tag        string
+		digest     string
+	}{
+		{"nginx", "docker.io/library/nginx", "latest", ""},
+		{"nginx:1.25", "docker.io/library/nginx", "1.25", ""},
+		{"library/nginx:1.25", "docker.io/library/nginx", "1.25", ""},
+		{"index.docker.io/library/nginx:1.25", "docker.io/library/nginx", "1.25", ""},
+		{"ghcr.io/example/app:v1@" + strings.ToUpper(digest), "ghcr.io/example/app", "v1", digest},
+		{"ghcr.io/example/app@" + digest, "ghcr.io/example/app", "", digest},
+		{"localhost:5000/app:dev", "localhost:5000/app", "dev", ""},
+		{"registry.example.com:5000/team/app", "registry.example.com:5000/team/app", "latest", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			ref, ok := parseImageRef(tt.raw)
+			if !ok {
+				t.Fatalf("parseImageRef(%q) failed", tt.raw)
+			}
+			if ref.repository != tt.repository || ref.tag != tt.tag || ref.digest != tt.digest {
+				t.Errorf("parseImageRef(%q) = %q, %q, %q; want %q, %q, %q",
+					tt.raw, ref.repository, ref.tag, ref.digest, tt.repository, tt.tag, tt.digest)
+			}
+		})
+	}
+
+	for _, raw := range []string{"", "app@nodigest", "${IMAGE}", ":tag"} {
+		if _, ok := parseImageRef(raw); ok {
+			t.Errorf("parseImageRef(%q) succeeded, want failure", raw)
+		}
+	}
+}
+
+func TestDockerfileFromImage(t *testing.T) {
+	lines := []struct {
+		line string
+		want string
+	}{
+		{"FROM golang:1.22 AS build", "golang:1.22"},
+		{"RUN go build ./...", ""},
+		{"from --platform=$BUILDPLATFORM alpine:3.19 as certs", "alpine:3.19"},
+		{"FROM build AS test", ""},
+		{"FROM scratch", ""},
+		{"FROM gcr.io/distroless/static", "gcr.io/distroless/static"},
+	}
+	stages := make(map[string]bool)
+	for _, tt := range lines {
+		if got := dockerfileFromImage(tt.line, stages); got != tt.want {
+			t.Errorf("dockerfileFromImage(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestCopyFromImage(t *testing.T) {
+	stages := dockerfileStages([]byte("FROM golang:1.22 AS Build\nFROM build AS test\nFROM alpine:3.19\nFROM scratch AS final\n"))
+	tests := []struct {
+		line, want string
+	}{
+		{"COPY --from=build /out/app /app", ""},
+		{"COPY --from=BUILD /out/app /app", ""},
+		{"copy --chown=app --from=final /app /app", ""},
+		{"COPY --from=2 /etc/ssl /etc/ssl", ""},
+		{"COPY --from=${TOOLS} /bin/tool /bin/tool", "${TOOLS}"},
+		{"COPY --from=ghcr.io/example/tools:1.0 /bin/tool /bin/tool", "ghcr.io/example/tools:1.0"},
+		{"COPY --link --from=busybox /bin/sh /bin/sh", "busybox"},
+		{"COPY . /src", ""},
+		{"COPY ./--from=x /src", ""},
+		{"RUN --mount=from=busybox true", ""},
+	}
+	for _, tt := range tests {
+		if got := copyFromImage(tt.line, stages); got != tt.want {
+			t.Errorf("copyFromImage(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestScanChecksCopyFromImages(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), strings.Join([]string{
+		"FROM golang@sha256:" + strings.Repeat("c", 64) + " AS build",
+		"COPY --from=ghcr.io/example/tools:1.0 /bin/tool /usr/local/bin/tool",
+		"FROM gcr.io/distroless/static@sha256:" + strings.Repeat("d", 64),
+		"COPY --from=build /out/app /app",
+		"COPY --from=0 /etc/ssl /etc/ssl",
+		"COPY --from=later /etc/passwd /etc/passwd",
+		"FROM scratch AS later",
+	}, "\n")+"\n")
+
+	found := findByRule(invokeScan(t, testClient(t), workspace).GetFindings(), tagOnlyImageRuleID)
+	if len(found) != 1 {
+		t.Fatalf("expected one %s finding, got %d", tagOnlyImageRuleID, len(found))
+	}
+	f := found[0]
+	if m := f.GetMetadata(); f.GetLocation().GetStartLine() != 2 || m["image"] != "ghcr.io/example/tools:1.0" || m["dockerfile_instruction"] != "COPY --from" {
+		t.Errorf("unexpected finding at line %d: %v", f.GetLocation().GetStartLine(), m)
+	}
+}
+
+func TestScanCorrelatesImagesWithAttestations(t *testing.T) {
+	const (
+		attested   = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		unattested = "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	)
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Dockerfile"),
+		"FROM golang:1.22 AS build\nFROM build AS test\nFROM gcr.io/distroless/static@"+unattested+"\n")
+	writeFile(t, filepath.Join(workspace, "compose.yaml"),
+		"services:\n  app:\n    image: ghcr.io/example/app@"+strings.ToUpper(attested)+"\n")
+	writeFile(t, filepath.Join(workspace, "deploy", "worker.yaml"),
+		"apiVersion: apps/v1\nkind: Deployment\nspec:\n  template:\n    spec:\n      containers:\n        - image: \"ghcr.io/example/worker@"+unattested+"\"\n")
+	writeFile(t, filepath.Join(workspace, "chart", "templates", "deployment.yaml"),
+		"apiVersion: apps/v1\nkind: Deployment\nspec:\n  containers:\n    - image: {{ .Values.image }}\n")
+	writeFile(t, filepath.Join(workspace, "config.yaml"), "image: not-a-manifest:1\n")
+	writeFile(t, filepath.Join(workspace, "release", "app.intoto.jsonl"),
+		levelStatement("https://github.com/actions/runner", "https://github.com/actions/workflow",
+			`[{"name":"ghcr.io/example/app","digest":{"sha256":"`+strings.TrimPrefix(attested, "sha256:")+`"}}]`, `[]`)+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	unattestedFindings := findByRule(resp.GetFindings(), unattestedImageRuleID)
+	if len(unattestedFindings) != 2 {
+		t.Fatalf("expected 2 %s findings, got %d", unattestedImageRuleID, len(unattestedFindings))
+	}
+	severities := map[string]pluginv1.Severity{}
+	for _, f := range unattestedFindings {
+		severities[f.GetLocation().GetFilePath()] = f.GetSeverity()
+	}
+	if severities["Dockerfile"] != sdk.SeverityLow || severities["deploy/worker.yaml"] != sdk.SeverityMedium {
+		t.Errorf("unexpected %s severities by path: %v", unattestedImageRuleID, severities)
+	}
+
+	tagOnly := findByRule(resp.GetFindings(), tagOnlyImageRuleID)
+	if len(tagOnly) != 1 {
+		t.Fatalf("expected 1 %s finding, got %d", tagOnlyImageRuleID, len(tagOnly))
+	}
+	meta := tagOnly[0].GetMetadata()
+	if meta["image_repository"] != "docker.io/library/golang" || tagOnly[0].GetLocation().GetStartLine() != 1 {
+		t.Errorf("unexpected %s finding: %v at line %d", tagOnlyImageRuleID, meta, tagOnly[0].GetLocation().GetStartLine())
+	}
+
+	summary := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	for key, want := range map[string]string{"images_found": "4", "images_attested": "1", "templates_skipped": "1"} {
+		if summary[key] != want {
+			t.Errorf("%s = %q, want %q", key, summary[key], want)
+		}
+	}
+}
+
+func TestScanCheckImagesDisabled(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), "FROM golang:1.22\n")
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root": workspace,
+		"check_images":   false,
+	})
+
+	if found := findByRule(resp.GetFindings(), tagOnlyImageRuleID); len(found) != 0 {
+		t.Errorf("expected no %s findings with check_images disabled, got %d", tagOnlyImageRuleID, len(found))
+	}
+}
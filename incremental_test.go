@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+)
+
+// fileFindingKeys returns the findings located in the given files, as
+// sorted rule, location, and message strings.
+func fileFindingKeys(findings []*pluginv1.Finding, files map[string]bool) []string {
+	var keys []string
+	for _, f := range findings {
+		loc := f.GetLocation()
+		if files[loc.GetFilePath()] {
+			keys = append(keys, fmt.Sprintf("%s %s:%d %s", f.GetRuleId(), loc.GetFilePath(), loc.GetStartLine(), f.GetMessage()))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestScanChangedFiles(t *testing.T) {
+	workspace := generateWorkspace(t, 400, 200)
+	changed := []any{"services/svc-007/Dockerfile", "./services/svc-042/provenance.json"}
+	files := map[string]bool{"services/svc-007/Dockerfile": true, "services/svc-042/provenance.json": true}
+	client := testClient(t)
+
+	full := invokeScan(t, client, workspace).GetFindings()
+	incremental := invokeScanWithInput(t, client, map[string]any{
+		"workspace_root": workspace,
+		"changed_files":  changed,
+	}).GetFindings()
+
+	want := fileFindingKeys(full, files)
+	if len(want) == 0 {
+		t.Fatal("expected per-file findings in the changed files from the full scan")
+	}
+	if got := fileFindingKeys(incremental, files); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("incremental findings differ from the full scan:\ngot  %v\nwant %v", got, want)
+	}
+
+	for _, f := range incremental {
+		if f.GetRuleId() == "PROV-001" {
+			t.Errorf("incremental scan ran workspace check %s", f.GetRuleId())
+		}
+		if f.GetRuleId() != summaryRuleID {
+			if !files[f.GetLocation().GetFilePath()] {
+				t.Errorf("finding %s at unchanged file %s", f.GetRuleId(), f.GetLocation().GetFilePath())
+			}
+			continue
+		}
+		meta := f.GetMetadata()
+		if meta["files_walked"] != "2" || meta["incremental"] != "true" || meta["changed_files"] != "2" || meta["changed_files_missing"] != "0" {
+			t.Errorf("unexpected summary metadata %v", meta)
+		}
+		if !strings.Contains(meta["coverage"], "workspace_checks=skipped:incremental_scan") ||
+			!strings.Contains(meta["coverage"], "script_following=skipped:incremental_scan") ||
+			!strings.Contains(meta["coverage"], "reproducibility=partial:incremental_scan") {
+			t.Errorf("coverage %q does not record the incremental scan", meta["coverage"])
+		}
+	}
+}
+
+func TestScanChangedFilesDeleted(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), "FROM alpine:latest\n")
+	writeFile(t, filepath.Join(workspace, "vendor", "Dockerfile"), "FROM alpine:latest\n")
+	writeFile(t, filepath.Join(workspace, ".gitignore"), "dist/\n")
+	writeFile(t, filepath.Join(workspace, "dist", "Dockerfile"), "FROM alpine:latest\n")
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root": workspace,
+		"changed_files":  "deleted/Dockerfile,vendor/Dockerfile,dist/Dockerfile,vendor",
+	})
+	for _, f := range resp.GetFindings() {
+		if f.GetRuleId() != summaryRuleID {
+			t.Errorf("unexpected finding %s at %s", f.GetRuleId(), f.GetLocation().GetFilePath())
+			continue
+		}
+		if meta := f.GetMetadata(); meta["files_walked"] != "0" || meta["changed_files"] != "4" || meta["changed_files_missing"] != "2" {
+			t.Errorf("unexpected summary metadata %v", meta)
+		}
+	}
+}
+
+func TestScanEmptyChangedFilesRunsFullScan(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), "FROM alpine:latest\n")
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tgo build .\n")
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root": workspace,
+		"changed_files":  "",
+	})
+	if len(findByRule(resp.GetFindings(), "PROV-001")) != 1 {
+		t.Error("expected the workspace checks of a full scan")
+	}
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["files_walked"] != "2" || meta["incremental"] != "" {
+		t.Errorf("unexpected summary metadata %v", meta)
+	}
+}
+
+func TestChangedFilesInput(t *testing.T) {
+	for _, tt := range []struct {
+		input   any
+		want    string
+		wantErr bool
+	}{
+		{input: []any{"a/b.yml", "./a/b.yml", "a//c/../d"}, want: "a/b.yml,a/d"},
+		{input: "/etc/passwd", wantErr: true},
+		{input: "../outside", wantErr: true},
+		{input: "a/../..", wantErr: true},
+		{input: ".", wantErr: true},
+		{input: []any{1}, wantErr: true},
+	} {
+		opts, err := parseScanOptions(map[string]any{"changed_files": tt.input})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("changed_files %v: error %v, want error %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (!opts.incremental || strings.Join(opts.changedFiles, ",") != tt.want) {
+			t.Errorf("changed_files %v = %v (incremental %v), want %q", tt.input, opts.changedFiles, opts.incremental, tt.want)
+		}
+	}
+	for _, input := range []map[string]any{{}, {"changed_files": ""}, {"changed_files": " , "}, {"changed_files": []any{}}} {
+		if opts, err := parseScanOptions(input); err != nil || opts.incremental {
+			t.Errorf("scan with %v is incremental (%v)", input, err)
+		}
+	}
+}
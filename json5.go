@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// json5ToJSON rewrites a JSON5 document as JSON so it can be decoded with
+// encoding/json. It handles the JSON5 extensions that appear in hand-written
+// config files: comments, trailing commas, single-quoted strings, unquoted
+// object keys, hexadecimal numbers, leading or trailing decimal points, and
+// explicit plus signs. Infinity and NaN have no JSON form and are rejected.
+func json5ToJSON(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	out.Grow(len(data))
+	// pendingComma holds a comma until the next token shows it is not
+	// trailing.
+	pendingComma := false
+
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return nil, errors.New("unterminated block comment")
+			}
+			i += end + 4
+		case c == ',':
+			pendingComma = true
+			i++
+		case c == '}' || c == ']':
+			pendingComma = false
+			out.WriteByte(c)
+			i++
+		default:
+			if pendingComma {
+				out.WriteByte(',')
+				pendingComma = false
+			}
+			n, err := json5Token(&out, data[i:])
+			if err != nil {
+				return nil, fmt.Errorf("offset %d: %w", i, err)
+			}
+			i += n
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// json5Token writes the JSON form of the token at the start of data and
+// returns its length.
+func json5Token(out *bytes.Buffer, data []byte) (int, error) {
+	c := data[0]
+	switch {
+	case c == '{' || c == '[' || c == ':':
+		out.WriteByte(c)
+		return 1, nil
+	case c == '"' || c == '\'':
+		return json5String(out, data)
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return json5Number(out, data)
+	}
+
+	n := 0
+	for n < len(data) {
+		r, size := utf8.DecodeRune(data[n:])
+		if r != '_' && r != '$' && !unicode.IsLetter(r) && !(n > 0 && unicode.IsDigit(r)) {
+			break
+		}
+		n += size
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("unexpected character %q", c)
+	}
+	word := string(data[:n])
+	switch word {
+	case "true", "false", "null":
+		out.WriteString(word)
+	case "Infinity", "NaN":
+		return 0, fmt.Errorf("%s has no JSON representation", word)
+	default:
+		// An unquoted object key.
+		out.WriteString(strconv.Quote(word))
+	}
+	return n, nil
+}
+
+// json5String writes a single- or double-quoted JSON5 string as a JSON
+// string and returns its length. Escaped line breaks continue the string.
+func json5String(out *bytes.Buffer, data []byte) (int, error) {
+	quote := data[0]
+	var b strings.Builder
+	for i := 1; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == quote:
+			encoded, err := jsonString(b.String())
+			if err != nil {
+				return 0, err
+			}
+			out.WriteString(encoded)
+			return i + 1, nil
+		case c == '\n':
+			return 0, errors.New("unterminated string")
+		case c != '\\':
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i == len(data) {
+			break
+		}
+		switch e := data[i]; e {
+		case '\n':
+		case '\r':
+			if i+1 < len(data) && data[i+1] == '\n' {
+				i++
+			}
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'v':
+			b.WriteByte('\v')
+		case '0':
+			b.WriteByte(0)
+		case 'u':
+			if i+4 >= len(data) {
+				return 0, errors.New("truncated unicode escape")
+			}
+			r, err := strconv.ParseUint(string(data[i+1:i+5]), 16, 16)
+			if err != nil {
+				return 0, fmt.Errorf("invalid unicode escape: %w", err)
+			}
+			b.WriteRune(rune(r))
+			i += 4
+		default:
+			b.WriteByte(e)
+		}
+	}
+	return 0, errors.New("unterminated string")
+}
+
+// jsonString quotes s as a JSON string.
+func jsonString(s string) (string, error) {
+	var b bytes.Buffer
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String(), nil
+}
+
+// json5Number writes a JSON5 number as a JSON number and returns its length.
+func json5Number(out *bytes.Buffer, data []byte) (int, error) {
+	n := 0
+	for n < len(data) && strings.IndexByte("+-.0123456789abcdefABCDEFxXeE", data[n]) >= 0 {
+		n++
+	}
+	if n < len(data) && (data[n] == 'I' || data[n] == 'N') {
+		return 0, errors.New("Infinity and NaN have no JSON representation")
+	}
+	text := strings.TrimPrefix(string(data[:n]), "+")
+	sign := ""
+	if strings.HasPrefix(text, "-") {
+		sign, text = "-", text[1:]
+	}
+	if strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X") {
+		v, err := strconv.ParseUint(text[2:], 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid hexadecimal number %q", data[:n])
+		}
+		out.WriteString(sign + strconv.FormatUint(v, 10))
+		return n, nil
+	}
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", data[:n])
+	}
+	if strings.ContainsAny(text, ".eE") {
+		out.WriteString(sign + strconv.FormatFloat(v, 'g', -1, 64))
+	} else {
+		out.WriteString(sign + text)
+	}
+	return n, nil
+}
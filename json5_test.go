@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestJSON5ToJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain JSON", input: `{"a": [1, "b"]}`, want: `{"a":[1,"b"]}`},
+		{name: "comments", input: "{\n  // line\n  \"a\": /* block */ 1\n}", want: `{"a":1}`},
+		{name: "trailing commas", input: `{"a": [1, 2,], "b": {"c": true,},}`, want: `{"a":[1,2],"b":{"c":true}}`},
+		{name: "unquoted keys", input: `{extends: ["config:recommended"], $schema: null}`, want: `{"extends":["config:recommended"],"$schema":null}`},
+		{name: "single quotes", input: `{'a': 'it\'s "quoted"'}`, want: `{"a":"it's \"quoted\""}`},
+		{name: "line continuation", input: "{a: 'one \\\ntwo'}", want: `{"a":"one two"}`},
+		{name: "numbers", input: `[0x1F, +1, .5, 5., -0x10, 1e3]`, want: `[31,1,0.5,5,-16,1000]`},
+		{name: "comment markers in strings", input: `{a: "http://x/*y*/"}`, want: `{"a":"http://x/*y*/"}`},
+		{name: "infinity", input: `{a: Infinity}`, wantErr: true},
+		{name: "unterminated string", input: `{a: 'b}`, wantErr: true},
+		{name: "unterminated comment", input: `{a: 1 /* b}`, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := json5ToJSON([]byte(tc.input))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("json5ToJSON(%q) = %s, want %s", tc.input, got, tc.want)
+			}
+		})
+	}
+}
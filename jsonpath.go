@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rootJSONPath is the json_path of a finding about a statement as a whole.
+const rootJSONPath = "$"
+
+// JSON paths name values within an in-toto statement the way the SLSA
+// specs do: object keys joined by dots and array elements by index, as in
+// subject[3].digest or predicate.materials[12].uri. Keys that would be
+// ambiguous in that form are quoted, as in externalParameters["a.b"].
+
+// jsonPathKey appends an object key to a path.
+func jsonPathKey(parent, key string) string {
+	if key == "" || strings.ContainsAny(key, `.[]"`) {
+		return parent + "[" + strconv.Quote(key) + "]"
+	}
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// jsonPathIndex appends an array index to a path.
+func jsonPathIndex(parent string, i int) string {
+	return parent + "[" + strconv.Itoa(i) + "]"
+}
+
+// parentJSONPath returns the path of the value holding the one at p, or ""
+// for a top-level member.
+func parentJSONPath(p string) string {
+	switch {
+	case strings.HasSuffix(p, `"]`):
+		return p[:strings.LastIndex(p, `["`)]
+	case strings.HasSuffix(p, "]"):
+		return p[:strings.LastIndex(p, "[")]
+	}
+	if i := strings.LastIndex(p, "."); i >= 0 {
+		return p[:i]
+	}
+	return ""
+}
+
+// pointerJSONPath converts a JSON pointer such as /predicate/materials/0/uri
+// to a JSON path. Tokens made only of digits are taken as array indexes.
+func pointerJSONPath(pointer string) string {
+	out := ""
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		if i, err := strconv.Atoi(token); err == nil && i >= 0 && out != "" {
+			out = jsonPathIndex(out, i)
+			continue
+		}
+		out = jsonPathKey(out, token)
+	}
+	return out
+}
+
+// jsonFrame is an object or array being indexed by indexJSONPaths.
+type jsonFrame struct {
+	path  string
+	array bool
+	index int
+	// key is the member whose value comes next; hasKey is false while an
+	// object waits for a key.
+	key    string
+	hasKey bool
+}
+
+// next moves the frame past one of its values.
+func (f *jsonFrame) next() {
+	f.index++
+	f.hasKey = false
+}
+
+// indexJSONPaths maps the path of every value nested in a JSON document to
+// the byte offset where the value starts. The document itself is not
+// included. Indexing stops at the end of the first value or at a syntax
+// error, keeping what was indexed before it.
+func indexJSONPaths(raw []byte) map[string]int {
+	offsets := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	var stack []*jsonFrame
+	for {
+		start := skipJSONSeparators(raw, int(dec.InputOffset()))
+		tok, err := dec.Token()
+		if err != nil {
+			return offsets
+		}
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+		} else {
+			path := ""
+			if n := len(stack); n > 0 {
+				top := stack[n-1]
+				if !top.array && !top.hasKey {
+					top.key, top.hasKey = tok.(string), true
+					continue
+				}
+				if top.array {
+					path = jsonPathIndex(top.path, top.index)
+				} else {
+					path = jsonPathKey(top.path, top.key)
+				}
+				offsets[path] = start
+			}
+			if d, ok := tok.(json.Delim); ok {
+				stack = append(stack, &jsonFrame{path: path, array: d == '['})
+				continue
+			}
+		}
+		if len(stack) == 0 {
+			return offsets
+		}
+		stack[len(stack)-1].next()
+	}
+}
+
+// skipJSONSeparators returns the offset of the first byte at or after off
+// that is not whitespace or a separator between JSON tokens.
+func skipJSONSeparators(raw []byte, off int) int {
+	for off < len(raw) {
+		switch raw[off] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			off++
+		default:
+			return off
+		}
+	}
+	return off
+}
+
+// lineIndex maps byte offsets of a file to one-based line numbers. The
+// newlines are located on first use.
+type lineIndex struct {
+	data     []byte
+	newlines []int
+	indexed  bool
+}
+
+// line returns the line holding the byte at off.
+func (l *lineIndex) line(off int) int {
+	if !l.indexed {
+		l.indexed = true
+		for i, c := range l.data {
+			if c == '\n' {
+				l.newlines = append(l.newlines, i)
+			}
+		}
+	}
+	return sort.SearchInts(l.newlines, off) + 1
+}
+
+// statementLocator resolves the JSON paths of a statement to lines of the
+// document holding it. A path missing from the statement resolves to its
+// nearest enclosing value, and any path within an enveloped statement to
+// the encoded payload.
+type statementLocator struct {
+	lines   *lineIndex
+	ps      *parsedStatement
+	offsets map[string]int
+}
+
+// line returns the line of the value at path p.
+func (l *statementLocator) line(p string) int {
+	if l.ps.Raw == nil {
+		return l.ps.Line
+	}
+	if p == rootJSONPath {
+		return l.lines.line(l.ps.Offset)
+	}
+	if l.ps.PayloadPath != "" {
+		p = l.ps.PayloadPath
+	}
+	if l.offsets == nil {
+		l.offsets = indexJSONPaths(l.ps.Raw)
+	}
+	for ; p != ""; p = parentJSONPath(p) {
+		if off, ok := l.offsets[p]; ok {
+			return l.lines.line(l.ps.Offset + off)
+		}
+	}
+	return l.lines.line(l.ps.Offset)
+}
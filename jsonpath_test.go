@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIndexJSONPaths(t *testing.T) {
+	raw := []byte(`{"a": {"b": [1, {"c": null}], "x.y": true}, "d": []}`)
+	got := indexJSONPaths(raw)
+	want := map[string]string{
+		"a":        `{"b"`,
+		"a.b":      `[1,`,
+		"a.b[0]":   `1,`,
+		"a.b[1]":   `{"c"`,
+		"a.b[1].c": `null`,
+		`a["x.y"]`: `true`,
+		"d":        `[]`,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d paths, want %d: %v", len(got), len(want), got)
+	}
+	for path, prefix := range want {
+		off, ok := got[path]
+		if !ok || !strings.HasPrefix(string(raw[off:]), prefix) {
+			t.Errorf("%s at %d (%v), want the value starting %q", path, off, ok, prefix)
+		}
+	}
+}
+
+func TestJSONPathHelpers(t *testing.T) {
+	for p, want := range map[string]string{
+		"subject[3].digest":                   "subject[3]",
+		"subject[3]":                          "subject",
+		"subject":                             "",
+		`predicate.externalParameters["a.b"]`: "predicate.externalParameters",
+		"predicate.buildDefinition.resolvedDependencies": "predicate.buildDefinition",
+	} {
+		if got := parentJSONPath(p); got != want {
+			t.Errorf("parentJSONPath(%q) = %q, want %q", p, got, want)
+		}
+	}
+	for pointer, want := range map[string]string{
+		"/predicate/materials/12/uri":                       "predicate.materials[12].uri",
+		"/predicate/invocation/parameters/a~1b":             "predicate.invocation.parameters.a/b",
+		"/predicate/buildDefinition/externalParameters/a.b": `predicate.buildDefinition.externalParameters["a.b"]`,
+	} {
+		if got := pointerJSONPath(pointer); got != want {
+			t.Errorf("pointerJSONPath(%q) = %q, want %q", pointer, got, want)
+		}
+	}
+}
+
+// locatedStatement is a statement with problems deep in its subjects and
+// materials.
+func locatedStatement() map[string]any {
+	subjects := make([]any, 4)
+	for i := range subjects {
+		subjects[i] = map[string]any{"name": fmt.Sprintf("app-%d", i), "digest": map[string]string{"sha256": strings.Repeat(fmt.Sprint(i), 64)}}
+	}
+	subjects[1].(map[string]any)["digest"] = map[string]string{"sha256": "abcd"}
+	delete(subjects[3].(map[string]any), "digest")
+	materials := make([]any, 13)
+	for i := range materials {
+		materials[i] = map[string]any{"uri": fmt.Sprintf("git+https://github.com/example/dep-%d", i), "digest": map[string]string{"sha1": strings.Repeat("a", 40)}}
+	}
+	materials[12] = map[string]any{"uri": "file:///secrets/gcp-sa.json", "digest": map[string]string{"sha256": strings.Repeat("b", 64)}}
+	return map[string]any{
+		"_type":         "https://in-toto.io/Statement/v0.1",
+		"predicateType": "https://slsa.dev/provenance/v0.2",
+		"subject":       subjects,
+		"predicate": map[string]any{
+			"builder":   map[string]string{"id": "https://github.com/actions/runner"},
+			"materials": materials,
+		},
+	}
+}
+
+// lineOf returns the one-based line of the first occurrence of needle.
+func lineOf(t *testing.T, text, needle string) int {
+	t.Helper()
+	i := strings.Index(text, needle)
+	if i < 0 {
+		t.Fatalf("%q not found", needle)
+	}
+	return strings.Count(text[:i], "\n") + 1
+}
+
+func TestProvenanceFindingLocations(t *testing.T) {
+	stmt := locatedStatement()
+	compact, err := json.Marshal(stmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pretty, err := json.MarshalIndent(stmt, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := json.MarshalIndent(map[string]any{
+		"payloadType": "application/vnd.in-toto+json",
+		"payload":     base64.StdEncoding.EncodeToString(compact),
+		"signatures":  []any{},
+	}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := string(pretty)
+
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "compact.intoto.json"), string(compact)+"\n")
+	writeFile(t, filepath.Join(workspace, "pretty.intoto.json"), p+"\n")
+	writeFile(t, filepath.Join(workspace, "envelope.intoto.json"), string(envelope)+"\n")
+	resp := invokeScan(t, testClient(t), workspace)
+
+	// The findings of each file, by rule and json_path.
+	got := make(map[string]int)
+	for _, f := range resp.GetFindings() {
+		if path := f.GetMetadata()["json_path"]; path != "" {
+			got[f.GetLocation().GetFilePath()+" "+f.GetRuleId()+" "+path] = int(f.GetLocation().GetStartLine())
+		}
+	}
+	payloadLine := lineOf(t, string(envelope), `"payload"`)
+	for path, prettyLine := range map[string]int{
+		"PROV-002 subject[3]": lineOf(t, p, `"name": "app-3"`) - 1,
+		digestConsistencyRuleID + " subject[1].digest.sha256": lineOf(t, p, `"abcd"`),
+		secretRuleID + " predicate.materials[12].uri":         lineOf(t, p, `"file:///secrets/gcp-sa.json"`),
+	} {
+		for file, want := range map[string]int{
+			"compact.intoto.json":  1,
+			"pretty.intoto.json":   prettyLine,
+			"envelope.intoto.json": payloadLine,
+		} {
+			key := file + " " + path
+			if line, ok := got[key]; !ok {
+				t.Errorf("missing %s", key)
+			} else if line != want {
+				t.Errorf("%s at line %d, want %d", key, line, want)
+			}
+		}
+	}
+}
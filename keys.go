@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// weakKeyRuleID flags committed verification keys and signing certificates
+// whose keys fall below the signing key policy.
+const weakKeyRuleID = "PROV-035"
+
+// Where an assessed key was found.
+const (
+	keySourcePublicKey   = "public_key"
+	keySourceCertificate = "certificate"
+)
+
+// Key types the key policy assesses.
+const (
+	keyTypeRSA     = "rsa"
+	keyTypeDSA     = "dsa"
+	keyTypeECDSA   = "ecdsa"
+	keyTypeEd25519 = "ed25519"
+)
+
+// pemBegin starts a PEM block.
+var pemBegin = []byte("-----BEGIN ")
+
+// minRSABits is the smallest RSA modulus the key policy accepts.
+const minRSABits = 2048
+
+var (
+	oidPublicKeyRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidPublicKeyDSA     = asn1.ObjectIdentifier{1, 2, 840, 10040, 4, 1}
+	oidPublicKeyECDSA   = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidPublicKeyEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// ecdsaCurves is the key policy for ECDSA: named curves by OID, with
+// whether they are accepted. Only the NIST curves of at least 256 bits are;
+// curves missing from the table are reported by OID.
+var ecdsaCurves = map[string]struct {
+	name string
+	bits int
+	ok   bool
+}{
+	"1.2.840.10045.3.1.7":   {"P-256", 256, true},
+	"1.3.132.0.34":          {"P-384", 384, true},
+	"1.3.132.0.35":          {"P-521", 521, true},
+	"1.2.840.10045.3.1.1":   {"P-192", 192, false},
+	"1.3.132.0.33":          {"P-224", 224, false},
+	"1.3.132.0.10":          {"secp256k1", 256, false},
+	"1.3.36.3.3.2.8.1.1.7":  {"brainpoolP256r1", 256, false},
+	"1.3.36.3.3.2.8.1.1.11": {"brainpoolP384r1", 384, false},
+	"1.3.36.3.3.2.8.1.1.13": {"brainpoolP512r1", 512, false},
+}
+
+// keyAssessment is what the key policy concluded about one public key.
+type keyAssessment struct {
+	keyType string
+	// bits is the key size, zero when unknown.
+	bits  int
+	curve string
+	// weak is set with the reason when the key falls below the policy.
+	weak   bool
+	reason string
+}
+
+// assessPublicKey judges a DER SubjectPublicKeyInfo against the key policy.
+// The structure is decoded by hand first, so that keys crypto/x509 refuses,
+// such as those on unsupported curves or of the wrong Ed25519 length, are
+// still judged. It reports false for algorithms the policy does not cover.
+func assessPublicKey(der []byte) (keyAssessment, bool) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if rest, err := asn1.Unmarshal(der, &spki); err != nil || len(rest) > 0 {
+		return keyAssessment{}, false
+	}
+	alg := spki.Algorithm.Algorithm
+	switch {
+	case alg.Equal(oidPublicKeyRSA):
+		a := keyAssessment{keyType: keyTypeRSA}
+		pub, err := x509.ParsePKIXPublicKey(der)
+		if key, ok := pub.(*rsa.PublicKey); err == nil && ok {
+			a.bits = key.N.BitLen()
+		}
+		switch {
+		case a.bits == 0:
+			a.weak, a.reason = true, "malformed RSA key"
+		case a.bits < minRSABits:
+			a.weak, a.reason = true, fmt.Sprintf("RSA key of %d bits is below %d bits", a.bits, minRSABits)
+		}
+		return a, true
+	case alg.Equal(oidPublicKeyDSA):
+		a := keyAssessment{keyType: keyTypeDSA, weak: true, reason: "DSA keys are deprecated for signing"}
+		var params struct{ P, Q, G *big.Int }
+		if _, err := asn1.Unmarshal(spki.Algorithm.Parameters.FullBytes, &params); err == nil {
+			a.bits = params.P.BitLen()
+		}
+		return a, true
+	case alg.Equal(oidPublicKeyECDSA):
+		a := keyAssessment{keyType: keyTypeECDSA}
+		var curve asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(spki.Algorithm.Parameters.FullBytes, &curve); err != nil {
+			a.weak, a.reason = true, "ECDSA key without a named curve"
+			return a, true
+		}
+		c, known := ecdsaCurves[curve.String()]
+		switch {
+		case !known:
+			a.curve = curve.String()
+			a.weak, a.reason = true, fmt.Sprintf("ECDSA curve %s is not a NIST curve", a.curve)
+		case !c.ok:
+			a.curve, a.bits = c.name, c.bits
+			a.weak, a.reason = true, fmt.Sprintf("ECDSA curve %s is legacy or not a NIST curve", c.name)
+		default:
+			a.curve, a.bits = c.name, c.bits
+		}
+		return a, true
+	case alg.Equal(oidPublicKeyEd25519):
+		a := keyAssessment{keyType: keyTypeEd25519, bits: 256}
+		if n := len(spki.PublicKey.Bytes); n != ed25519.PublicKeySize || spki.PublicKey.BitLength != 8*n {
+			a.bits = 0
+			a.weak, a.reason = true, fmt.Sprintf("malformed Ed25519 key of %d bytes", n)
+		}
+		return a, true
+	}
+	return keyAssessment{}, false
+}
+
+// assessCertificateKey judges the public key of a DER certificate.
+func assessCertificateKey(der []byte) (keyAssessment, bool) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return keyAssessment{}, false
+	}
+	return assessPublicKey(cert.RawSubjectPublicKeyInfo)
+}
+
+// reportWeakKey flags a key that falls below the key policy. fb carries the
+// location and any context of where the key was found.
+func reportWeakKey(fb *findingBuilder, a keyAssessment, source string) {
+	fb.WithMetadata("type", "weak_signing_key").
+		WithMetadata("key_type", a.keyType).
+		WithMetadata("key_source", source).
+		WithMetadata("reason", a.reason)
+	if a.bits > 0 {
+		fb.WithMetadata("key_size", strconv.Itoa(a.bits))
+	}
+	if a.curve != "" {
+		fb.WithMetadata("curve", a.curve)
+	}
+	fb.Done()
+}
+
+// scanKeyFile assesses the PEM blocks of a key file: public keys and
+// certificates against the key policy, and private keys, which are never
+// meant to be committed.
+func scanKeyFile(findings *findingSet, filePath string, data []byte, policy provenancePolicy) {
+	for line := 1; ; {
+		start := bytes.Index(data, pemBegin)
+		block, rest := pem.Decode(data)
+		if block == nil {
+			return
+		}
+		// Blocks are located at the line of their BEGIN header.
+		blockLine := line + bytes.Count(data[:max(start, 0)], []byte("\n"))
+		line += bytes.Count(data[:len(data)-len(rest)], []byte("\n"))
+		data = rest
+
+		var (
+			a      keyAssessment
+			ok     bool
+			source string
+		)
+		switch {
+		case block.Type == "PUBLIC KEY":
+			a, ok = assessPublicKey(block.Bytes)
+			source = keySourcePublicKey
+		case block.Type == "CERTIFICATE":
+			a, ok = assessCertificateKey(block.Bytes)
+			source = keySourceCertificate
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			reportPrivateKey(findings, filePath, blockLine, block, policy)
+			continue
+		}
+		if ok && a.weak {
+			reportWeakKey(findings.Finding(
+				weakKeyRuleID,
+				sdk.SeverityMedium,
+				sdk.ConfidenceHigh,
+				fmt.Sprintf("Weak signing key: %s", a.reason),
+			).At(filePath, blockLine, blockLine), a, source)
+		}
+	}
+}
+
+// reportPrivateKey flags a PEM private key committed to the workspace,
+// unless secret_allowlist exempts the file. Only the block type is reported,
+// never key material.
+func reportPrivateKey(findings *findingSet, filePath string, line int, block *pem.Block, policy provenancePolicy) {
+	rel := workspacePath(findings.root, filePath)
+	if secretAllowed(policy.secretAllowlist, rel) {
+		return
+	}
+	encrypted := strings.Contains(block.Type, "ENCRYPTED") || block.Headers["Proc-Type"] != ""
+	findings.Finding(
+		secretRuleID,
+		sdk.SeverityHigh,
+		sdk.ConfidenceHigh,
+		fmt.Sprintf("Private key committed to the repository: %s", rel),
+	).
+		At(filePath, line, line).
+		WithMetadata("type", "committed_private_key").
+		WithMetadata("credential_kind", credentialPrivateKey).
+		WithMetadata("pem_type", block.Type).
+		WithMetadata("encrypted", strconv.FormatBool(encrypted)).
+		Done()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// rawPublicKey builds a SubjectPublicKeyInfo by hand, for keys crypto/x509
+// cannot marshal.
+func rawPublicKey(t *testing.T, alg asn1.ObjectIdentifier, params any, key []byte) []byte {
+	t.Helper()
+	id := pkix.AlgorithmIdentifier{Algorithm: alg}
+	if params != nil {
+		raw, err := asn1.Marshal(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id.Parameters = asn1.RawValue{FullBytes: raw}
+	}
+	der, err := asn1.Marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}{id, asn1.BitString{Bytes: key, BitLength: 8 * len(key)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func marshalPublicKey(t *testing.T, pub any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestAssessPublicKey(t *testing.T) {
+	rsa1024, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dsaParams := struct{ P, Q, G *big.Int }{new(big.Int).Lsh(big.NewInt(1), 1023), big.NewInt(3), big.NewInt(2)}
+
+	tests := []struct {
+		name    string
+		der     []byte
+		keyType string
+		bits    int
+		curve   string
+		weak    bool
+	}{
+		{"rsa 1024", marshalPublicKey(t, &rsa1024.PublicKey), "rsa", 1024, "", true},
+		{"ecdsa p-224", marshalPublicKey(t, &p224.PublicKey), "ecdsa", 224, "P-224", true},
+		{"ecdsa p-256", marshalPublicKey(t, &p256.PublicKey), "ecdsa", 256, "P-256", false},
+		{"ecdsa secp256k1", rawPublicKey(t, oidPublicKeyECDSA, asn1.ObjectIdentifier{1, 3, 132, 0, 10}, make([]byte, 65)), "ecdsa", 256, "secp256k1", true},
+		{"dsa", rawPublicKey(t, oidPublicKeyDSA, dsaParams, []byte{2, 1, 5}), "dsa", 1024, "", true},
+		{"ed25519", marshalPublicKey(t, ed), "ed25519", 256, "", false},
+		{"ed25519 truncated", rawPublicKey(t, oidPublicKeyEd25519, nil, make([]byte, 31)), "ed25519", 0, "", true},
+	}
+	for _, tt := range tests {
+		a, ok := assessPublicKey(tt.der)
+		if !ok {
+			t.Errorf("%s: not assessed", tt.name)
+			continue
+		}
+		if a.keyType != tt.keyType || a.bits != tt.bits || a.curve != tt.curve || a.weak != tt.weak {
+			t.Errorf("%s: got %+v", tt.name, a)
+		}
+	}
+}
+
+func TestScanSigningKeys(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strong, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &weak.PublicKey, weak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(typ string, der []byte) string {
+		return string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}))
+	}
+
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "cosign.pub"), encode("PUBLIC KEY", marshalPublicKey(t, &weak.PublicKey)))
+	writeFile(t, filepath.Join(workspace, "keys", "release.pem"), "# release key\n"+encode("PUBLIC KEY", marshalPublicKey(t, &strong.PublicKey))+encode("CERTIFICATE", cert))
+	writeFile(t, filepath.Join(workspace, "keys", "signing.key"), encode("EC PRIVATE KEY", []byte("not a real key")))
+	writeFile(t, filepath.Join(workspace, "testdata", "fixture.key"), encode("PRIVATE KEY", []byte("not a real key")))
+	stmt := levelStatement("https://github.com/actions/runner", "b", `[{"name":"app","digest":{"sha256":"abc123def4567890abc123def4567890abc123def4567890abc123def4567890"}}]`, `[]`)
+	writeFile(t, filepath.Join(workspace, "app.intoto.json"),
+		`{"mediaType":"application/vnd.dev.sigstore.bundle.v0.3+json","verificationMaterial":{"certificate":{"rawBytes":"`+
+			base64.StdEncoding.EncodeToString(cert)+`"},"tlogEntries":[]},"dsseEnvelope":`+signed(stmt)+`}`)
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root":   workspace,
+		"secret_allowlist": "testdata/*",
+	})
+
+	got := make(map[string][]map[string]string)
+	for _, f := range findByRule(resp.GetFindings(), weakKeyRuleID) {
+		got[f.GetLocation().GetFilePath()] = append(got[f.GetLocation().GetFilePath()], f.GetMetadata())
+	}
+	if meta := got["cosign.pub"]; len(meta) != 1 || meta[0]["key_type"] != "rsa" || meta[0]["key_size"] != "1024" || meta[0]["key_source"] != keySourcePublicKey {
+		t.Errorf("unexpected cosign.pub findings: %v", meta)
+	}
+	if meta := got["keys/release.pem"]; len(meta) != 1 || meta[0]["key_source"] != keySourceCertificate {
+		t.Errorf("expected only the certificate in keys/release.pem to be weak, got %v", meta)
+	}
+	if meta := got["app.intoto.json"]; len(meta) != 1 || meta[0]["envelope"] != envelopeSigstore || meta[0]["key_size"] != "1024" {
+		t.Errorf("unexpected bundle findings: %v", meta)
+	}
+
+	var private []string
+	for _, f := range findByRule(resp.GetFindings(), secretRuleID) {
+		if f.GetMetadata()["type"] == "committed_private_key" {
+			private = append(private, f.GetLocation().GetFilePath())
+			if f.GetMetadata()["pem_type"] != "EC PRIVATE KEY" {
+				t.Errorf("pem_type = %q, want EC PRIVATE KEY", f.GetMetadata()["pem_type"])
+			}
+		}
+	}
+	if len(private) != 1 || private[0] != "keys/signing.key" {
+		t.Errorf("expected one committed private key in keys/signing.key, got %v", private)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// lineContext describes where in a build or CI config a line sits, as far as
+// a line-at-a-time reader can tell. Reproducibility findings scale their
+// confidence by it.
+type lineContext string
+
+const (
+	contextDockerInstruction lineContext = "dockerfile_instruction"
+	contextRunCommand        lineContext = "run_command"
+	contextRecipe            lineContext = "makefile_recipe"
+	contextComment           lineContext = "comment"
+	contextEcho              lineContext = "echo_string"
+	contextHeredoc           lineContext = "heredoc"
+	contextOther             lineContext = "other"
+)
+
+// confidence returns how likely a pattern matched in this context is to
+// affect the build: commands that run are High, text that is only printed
+// or commented is Low.
+func (c lineContext) confidence() pluginv1.Confidence {
+	switch c {
+	case contextDockerInstruction, contextRunCommand, contextRecipe:
+		return sdk.ConfidenceHigh
+	case contextComment, contextEcho, contextHeredoc:
+		return sdk.ConfidenceLow
+	default:
+		return sdk.ConfidenceMedium
+	}
+}
+
+// configFormat is the syntax a build or CI config is read as.
+type configFormat int
+
+const (
+	formatOther configFormat = iota
+	formatDockerfile
+	formatMakefile
+	formatYAML
+	formatShell
+)
+
+// configFormatOf picks the syntax of a config from its base name.
+func configFormatOf(name string) configFormat {
+	lower := strings.ToLower(name)
+	switch {
+	case imageSourceOf(name) == imageSourceDockerfile:
+		return formatDockerfile
+	case lower == "makefile" || lower == "gnumakefile" || strings.HasSuffix(lower, ".mk"):
+		return formatMakefile
+	case isYAMLName(lower):
+		return formatYAML
+	case isShellScriptName(lower):
+		return formatShell
+	}
+	return formatOther
+}
+
+// shellScriptExts lists the extensions of shell scripts.
+var shellScriptExts = []string{".sh", ".bash", ".zsh", ".ksh"}
+
+// isShellScriptName reports whether a lowercase file name has a shell
+// script extension.
+func isShellScriptName(lower string) bool {
+	for _, ext := range shellScriptExts {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// heredocStart matches a shell or Dockerfile heredoc operator and
+	// captures its terminator word.
+	heredocStart = regexp.MustCompile(`<<-?\s*["']?([A-Za-z_][A-Za-z0-9_]*)["']?`)
+	// dockerInstruction matches the keyword opening a Dockerfile instruction.
+	dockerInstruction = regexp.MustCompile(`^(?i)(FROM|RUN|CMD|ENTRYPOINT|COPY|ADD|ENV|ARG|LABEL|WORKDIR|USER|EXPOSE|VOLUME|SHELL|ONBUILD|HEALTHCHECK|STOPSIGNAL)\s`)
+	// yamlCommandKey matches a YAML key whose value is shell to run, with an
+	// optional list dash, and captures the inline value.
+	yamlCommandKey = regexp.MustCompile(`^(-\s+)?(run|script|before_script|after_script|command|commands):\s*(.*)$`)
+	// yamlKey matches a plain YAML mapping key and captures it.
+	yamlKey = regexp.MustCompile(`^([A-Za-z0-9_.-]+):(?:\s|$)`)
+	// yamlAnyKey matches any YAML mapping key and captures it, as a double-
+	// or single-quoted scalar or as plain text up to the first ": ". A plain
+	// key may not start with an indicator such as a list dash or comment.
+	yamlAnyKey = regexp.MustCompile(`^(?:"((?:[^"\\]|\\.)*)"|'((?:[^']|'')*)'|([^\s"'#&*!|>%@` + "`" + `\[\]{},?:-]|[?:-]\S)(.*?))\s*:(?:\s|$)`)
+	// makeTarget matches a Makefile rule line and captures its first target.
+	makeTarget = regexp.MustCompile(`^([A-Za-z0-9_./%-]+)(?:\s+[^:=]*)?\s*:(?:[^=]|$)`)
+)
+
+// yamlMappingKey returns the mapping key opening trimmed, unquoted, which
+// unlike yamlKey may be quoted or contain spaces, as job names often do.
+func yamlMappingKey(trimmed string) (string, bool) {
+	m := yamlAnyKey.FindStringSubmatch(trimmed)
+	switch {
+	case m == nil:
+		return "", false
+	case strings.HasPrefix(trimmed, `"`):
+		if key, err := strconv.Unquote(`"` + m[1] + `"`); err == nil {
+			return key, true
+		}
+		return m[1], true
+	case strings.HasPrefix(trimmed, "'"):
+		return strings.ReplaceAll(m[2], "''", "'"), true
+	}
+	return m[3] + m[4], true
+}
+
+// lineClassifier assigns a lineContext to each line of one file. It is fed
+// lines in order because heredocs and YAML blocks span lines.
+type lineClassifier struct {
+	format configFormat
+
+	// heredocEnd is the terminator of the open heredoc, empty if none.
+	heredocEnd string
+	// blockIndent is the indentation of the YAML key whose block value is
+	// being read, or -1 outside such a block.
+	blockIndent int
+	// continued is set when the previous Dockerfile line ended in a
+	// backslash, so this one belongs to the same instruction.
+	continued bool
+
+	// section is the CI job or Makefile target the current line belongs to,
+	// empty when unknown. jobIndent is the indentation of job keys below a
+	// top-level "jobs:" key, or -1 outside one.
+	section   string
+	inJobs    bool
+	jobIndent int
+}
+
+// newLineClassifier returns a classifier for a config with the given base
+// name.
+func newLineClassifier(name string) *lineClassifier {
+	return newFormatClassifier(configFormatOf(filepath.Base(name)))
+}
+
+// newFormatClassifier returns a classifier that reads lines as format.
+func newFormatClassifier(format configFormat) *lineClassifier {
+	return &lineClassifier{format: format, blockIndent: -1, jobIndent: -1}
+}
+
+// classify returns the context of the next line.
+func (c *lineClassifier) classify(line string) lineContext {
+	lc, _ := c.classifyCommand(line)
+	return lc
+}
+
+// classifyCommand returns the context of the next line together with the
+// shell command it holds, empty if none.
+func (c *lineClassifier) classifyCommand(line string) (lineContext, string) {
+	trimmed := strings.TrimSpace(line)
+
+	if c.heredocEnd != "" {
+		if trimmed == c.heredocEnd {
+			c.heredocEnd = ""
+		}
+		return contextHeredoc, ""
+	}
+	if m := heredocStart.FindStringSubmatch(line); m != nil {
+		c.heredocEnd = m[1]
+	}
+
+	if strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "//") {
+		return contextComment, ""
+	}
+
+	c.trackSection(line, trimmed)
+	structural, command := c.structure(line, trimmed)
+	if isEchoCommand(command) {
+		return contextEcho, command
+	}
+	return structural, command
+}
+
+// trackSection follows the CI job or Makefile target a line belongs to.
+// Jobs are the keys below a top-level "jobs:" key (GitHub Actions) or, in
+// files without one, the top-level keys themselves (GitLab CI).
+func (c *lineClassifier) trackSection(line, trimmed string) {
+	switch c.format {
+	case formatMakefile:
+		if strings.HasPrefix(line, "\t") {
+			return
+		}
+		if m := makeTarget.FindStringSubmatch(trimmed); m != nil && !strings.HasPrefix(m[1], ".") {
+			c.section = m[1]
+		}
+	case formatYAML:
+		if trimmed == "" {
+			return
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		key, ok := yamlMappingKey(trimmed)
+		switch {
+		case indent == 0:
+			c.inJobs = ok && key == "jobs"
+			c.jobIndent = -1
+			c.section = ""
+			if ok && !c.inJobs {
+				c.section = key
+			}
+		case c.inJobs:
+			if c.jobIndent < 0 {
+				c.jobIndent = indent
+			}
+			if indent == c.jobIndent && ok {
+				c.section = key
+			}
+		}
+	}
+}
+
+// structure returns the context the file's syntax gives a non-comment line,
+// along with the shell command the line holds, if any.
+func (c *lineClassifier) structure(line, trimmed string) (lineContext, string) {
+	switch c.format {
+	case formatDockerfile:
+		continued := c.continued
+		c.continued = strings.HasSuffix(trimmed, `\`)
+		if continued {
+			return contextDockerInstruction, trimmed
+		}
+		if m := dockerInstruction.FindStringSubmatch(trimmed); m != nil {
+			return contextDockerInstruction, strings.TrimSpace(trimmed[len(m[0]):])
+		}
+	case formatMakefile:
+		if strings.HasPrefix(line, "\t") {
+			return contextRecipe, strings.TrimLeft(trimmed, "@-+")
+		}
+	case formatYAML:
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if c.blockIndent >= 0 {
+			if trimmed == "" || indent > c.blockIndent {
+				return contextRunCommand, strings.TrimPrefix(trimmed, "- ")
+			}
+			c.blockIndent = -1
+		}
+		if m := yamlCommandKey.FindStringSubmatch(trimmed); m != nil {
+			value := strings.TrimSpace(m[3])
+			if value == "" || value == "|" || value == ">" || strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+				c.blockIndent = indent
+				if m[1] != "" {
+					c.blockIndent += len(m[1])
+				}
+				return contextOther, ""
+			}
+			return contextRunCommand, strings.Trim(value, `"'`)
+		}
+	case formatShell:
+		return contextRunCommand, trimmed
+	}
+	return contextOther, trimmed
+}
+
+// isEchoCommand reports whether a shell command only prints its arguments.
+func isEchoCommand(command string) bool {
+	word, _, _ := strings.Cut(command, " ")
+	return word == "echo" || word == "printf"
+}
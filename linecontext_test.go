@@ -0,0 +1,173 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineClassifier(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		// lines are classified in order; want holds one context per line.
+		lines []string
+		want  []lineContext
+	}{
+		{
+			name:  "dockerfile instructions",
+			file:  "Dockerfile",
+			lines: []string{"FROM golang:latest", "run apt-get install curl", "# FROM alpine:latest"},
+			want:  []lineContext{contextDockerInstruction, contextDockerInstruction, contextComment},
+		},
+		{
+			name:  "dockerfile continuation",
+			file:  "build.dockerfile",
+			lines: []string{"RUN apt-get update && \\", "    apt-get install curl"},
+			want:  []lineContext{contextDockerInstruction, contextDockerInstruction},
+		},
+		{
+			name:  "dockerfile echo",
+			file:  "Dockerfile",
+			lines: []string{`RUN echo "use the latest release"`},
+			want:  []lineContext{contextEcho},
+		},
+		{
+			name:  "dockerfile heredoc",
+			file:  "Dockerfile",
+			lines: []string{"COPY <<EOF /etc/notes", "pull image:latest", "EOF", "FROM alpine:latest"},
+			want:  []lineContext{contextDockerInstruction, contextHeredoc, contextHeredoc, contextDockerInstruction},
+		},
+		{
+			name:  "makefile recipe and variable",
+			file:  "Makefile",
+			lines: []string{"DATE := $(shell date)", "build:", "\tgo build .", "\t@echo built on $(DATE)", "\t# date"},
+			want:  []lineContext{contextOther, contextOther, contextRecipe, contextEcho, contextComment},
+		},
+		{
+			name: "github actions run",
+			file: ".github/workflows/release.yml",
+			lines: []string{
+				"steps:",
+				"  - run: curl -sSL https://example.com | sh",
+				"  - name: build",
+				"    run: |",
+				"      docker pull app:latest",
+				"",
+				"      printf 'latest\\n'",
+				"  - uses: actions/checkout@v4",
+			},
+			want: []lineContext{
+				contextOther, contextRunCommand, contextOther, contextOther,
+				contextRunCommand, contextRunCommand, contextEcho, contextOther,
+			},
+		},
+		{
+			name:  "gitlab script list",
+			file:  ".gitlab-ci.yml",
+			lines: []string{"build:", "  image: golang:latest", "  script:", "    - make build", "  tags: [latest]"},
+			want:  []lineContext{contextOther, contextOther, contextOther, contextRunCommand, contextOther},
+		},
+		{
+			name:  "yaml merge key is not a heredoc",
+			file:  "Taskfile.yml",
+			lines: []string{"<<: *defaults", "cmd: latest"},
+			want:  []lineContext{contextOther, contextOther},
+		},
+		{
+			name:  "jenkinsfile comment",
+			file:  "Jenkinsfile",
+			lines: []string{"// uses latest", "sh 'make'"},
+			want:  []lineContext{contextComment, contextOther},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newLineClassifier(filepath.FromSlash(tt.file))
+			for i, line := range tt.lines {
+				if got := c.classify(line); got != tt.want[i] {
+					t.Errorf("line %d %q: got %s, want %s", i+1, line, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestYAMLMappingKey(t *testing.T) {
+	tests := []struct {
+		line string
+		key  string
+		ok   bool
+	}{
+		{"build:", "build", true},
+		{"deploy prod:", "deploy prod", true},
+		{`"release c":`, "release c", true},
+		{`"say \"hi\"": x`, `say "hi"`, true},
+		{"'it''s': x", "it's", true},
+		{".template: &base", ".template", true},
+		{"image: golang:1.22", "image", true},
+		{"url: https://example.com", "url", true},
+		{"- item: x", "", false},
+		{"# comment: x", "", false},
+		{"https://example.com", "", false},
+		{"plain scalar", "", false},
+	}
+	for _, tt := range tests {
+		key, ok := yamlMappingKey(tt.line)
+		if key != tt.key || ok != tt.ok {
+			t.Errorf("yamlMappingKey(%q) = %q, %v; want %q, %v", tt.line, key, ok, tt.key, tt.ok)
+		}
+	}
+}
+
+func TestLineContextConfidence(t *testing.T) {
+	tests := map[lineContext]string{
+		contextDockerInstruction: "high",
+		contextRunCommand:        "high",
+		contextRecipe:            "high",
+		contextOther:             "medium",
+		contextComment:           "low",
+		contextEcho:              "low",
+		contextHeredoc:           "low",
+	}
+	for lc, want := range tests {
+		if got := confidenceNames[lc.confidence()]; got != want {
+			t.Errorf("%s: confidence %s, want %s", lc, got, want)
+		}
+	}
+}
+
+func TestScanReproducibilityConfidence(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), strings.Join([]string{
+		"FROM golang:latest",
+		`RUN echo "pin nothing, use latest"`,
+		"# FROM alpine:latest",
+	}, "\n")+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	want := map[int]struct {
+		context    string
+		confidence string
+	}{
+		1: {"dockerfile_instruction", "high"},
+		2: {"echo_string", "low"},
+		3: {"comment", "low"},
+	}
+	found := findByRule(resp.GetFindings(), "PROV-003")
+	if len(found) != len(want) {
+		t.Fatalf("expected %d PROV-003 findings, got %d", len(want), len(found))
+	}
+	for _, f := range found {
+		line := int(f.GetLocation().GetStartLine())
+		w := want[line]
+		if got := f.GetMetadata()["context"]; got != w.context {
+			t.Errorf("line %d: context %q, want %q", line, got, w.context)
+		}
+		if got := confidenceNames[f.GetConfidence()]; got != w.confidence {
+			t.Errorf("line %d: confidence %s, want %s", line, got, w.confidence)
+		}
+	}
+}
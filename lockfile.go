@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// Rule IDs for cross-checking provenance materials against lockfiles.
+const (
+	lowLockfileOverlapRuleID     = "PROV-013"
+	lockfileDigestMismatchRuleID = "PROV-014"
+)
+
+// defaultMinLockfileOverlap is the min_lockfile_overlap used when the input
+// is unset, as a percentage.
+const defaultMinLockfileOverlap = 50
+
+// Dependency ecosystems that lockfiles and materials are matched in.
+const (
+	ecosystemGo  = "golang"
+	ecosystemNPM = "npm"
+)
+
+// lockfileNames maps lockfile names to the ecosystem they pin.
+var lockfileNames = map[string]string{
+	"go.sum":              ecosystemGo,
+	"package-lock.json":   ecosystemNPM,
+	"npm-shrinkwrap.json": ecosystemNPM,
+}
+
+// lockEntry is a dependency version pinned by a workspace lockfile.
+type lockEntry struct {
+	// digests maps a digest algorithm to its lowercase hex value.
+	digests map[string]string
+	path    string
+}
+
+// dependencyKey identifies a dependency version across URI forms as
+// "ecosystem:name@version".
+func dependencyKey(ecosystem, name, version string) string {
+	return ecosystem + ":" + name + "@" + version
+}
+
+// ecosystemOf returns the ecosystem of a dependency key.
+func ecosystemOf(key string) string {
+	ecosystem, _, _ := strings.Cut(key, ":")
+	return ecosystem
+}
+
+// materialRef is a provenance material that names a dependency version.
+type materialRef struct {
+	uri     string
+	key     string
+	digests map[string]string
+}
+
+// statementMaterials records the dependency materials of one statement so
+// they can be compared with lockfiles once every file has been analyzed.
+type statementMaterials struct {
+	location string
+	line     int
+	// index is the statement's position, or -1 when its document holds a
+	// single statement.
+	index     int
+	materials []materialRef
+}
+
+// dependencyMaterials returns the materials of a statement that normalize to
+// a dependency version.
+func dependencyMaterials(ps *parsedStatement) []materialRef {
+	var refs []materialRef
+	for _, m := range ps.Predicate.allMaterials() {
+		uri := m.URI
+		if uri == "" {
+			uri = m.Name
+		}
+		key, ok := normalizeMaterialURI(uri)
+		if !ok {
+			continue
+		}
+		digests := make(map[string]string, len(m.Digest))
+		for alg, value := range m.Digest {
+			if canonical, ok := canonicalDigest(value); ok {
+				digests[strings.ToLower(alg)] = canonical
+			}
+		}
+		refs = append(refs, materialRef{uri: uri, key: key, digests: digests})
+	}
+	return refs
+}
+
+// normalizeMaterialURI maps the URI forms a material may use for a Go module
+// or npm package to a dependency key: package URLs ("pkg:golang/...",
+// "pkg:npm/..."), Go module proxy URLs (".../@v/<version>.zip"), and npm
+// registry tarball URLs (".../<name>/-/<base>-<version>.tgz"). It reports
+// false for anything else, such as source repositories.
+func normalizeMaterialURI(uri string) (string, bool) {
+	if rest, ok := strings.CutPrefix(uri, "pkg:"); ok {
+		return normalizePURL(rest)
+	}
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", false
+	}
+	p := u.EscapedPath()
+	if module, file, ok := strings.Cut(p, "/@v/"); ok {
+		version := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(file, ".zip"), ".mod"), ".info")
+		if version == file || version == "" {
+			return "", false
+		}
+		name, ok := unescapeModulePath(strings.TrimPrefix(module, "/"))
+		if !ok || name == "" {
+			return "", false
+		}
+		return dependencyKey(ecosystemGo, name, version), true
+	}
+	if pkg, file, ok := strings.Cut(p, "/-/"); ok && strings.HasSuffix(file, ".tgz") {
+		name, err := url.PathUnescape(strings.TrimPrefix(pkg, "/"))
+		if err != nil || name == "" {
+			return "", false
+		}
+		base := name[strings.LastIndex(name, "/")+1:]
+		version, ok := strings.CutPrefix(strings.TrimSuffix(file, ".tgz"), base+"-")
+		if !ok || version == "" {
+			return "", false
+		}
+		return dependencyKey(ecosystemNPM, name, version), true
+	}
+	return "", false
+}
+
+// normalizePURL normalizes the part of a package URL after "pkg:".
+// Qualifiers and subpaths are dropped.
+func normalizePURL(rest string) (string, bool) {
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	typ, path, ok := strings.Cut(rest, "/")
+	if !ok {
+		return "", false
+	}
+	ecosystem := strings.ToLower(typ)
+	if ecosystem != ecosystemGo && ecosystem != ecosystemNPM {
+		return "", false
+	}
+	at := strings.LastIndex(path, "@")
+	if at <= 0 || at == len(path)-1 {
+		return "", false
+	}
+	name, err := url.PathUnescape(path[:at])
+	if err != nil {
+		return "", false
+	}
+	version, err := url.PathUnescape(path[at+1:])
+	if err != nil {
+		return "", false
+	}
+	return dependencyKey(ecosystem, name, version), true
+}
+
+// unescapeModulePath reverses the Go module proxy's case encoding, in which
+// each uppercase letter is written as '!' followed by its lowercase form.
+func unescapeModulePath(escaped string) (string, bool) {
+	escaped, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", false
+	}
+	var b strings.Builder
+	for i := 0; i < len(escaped); i++ {
+		c := escaped[i]
+		if c != '!' {
+			b.WriteByte(c)
+			continue
+		}
+		if i+1 == len(escaped) || escaped[i+1] < 'a' || escaped[i+1] > 'z' {
+			return "", false
+		}
+		i++
+		b.WriteByte(escaped[i] - 'a' + 'A')
+	}
+	return b.String(), true
+}
+
+// canonicalDigest returns a digest value as lowercase hex. Values may be hex
+// or base64 and may carry an "alg:" prefix, as go.sum hashes do.
+func canonicalDigest(value string) (string, bool) {
+	if i := strings.IndexByte(value, ':'); i >= 0 {
+		value = value[i+1:]
+	}
+	if value == "" {
+		return "", false
+	}
+	if _, err := hex.DecodeString(value); err == nil {
+		return strings.ToLower(value), true
+	}
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", false
+	}
+	return hex.EncodeToString(raw), true
+}
+
+// scanLockfile records the dependency versions pinned by a go.sum,
+// package-lock.json, or npm-shrinkwrap.json file. Malformed lockfiles are
+// ignored.
+func scanLockfile(ctx context.Context, fsys workspaceFS, filePath string, summary *scanSummary) error {
+	data, err := fsys.ReadFile(filePath)
+	if err != nil {
+		summary.filesUnreadable++
+		return nil
+	}
+	if lockfileNames[filepath.Base(filePath)] == ecosystemGo {
+		return parseGoSum(ctx, filePath, data, summary)
+	}
+	parsePackageLock(filePath, data, summary)
+	return nil
+}
+
+// parseGoSum records go.sum entries. Only the module zip hash ("h1:") is
+// kept as a digest; "/go.mod" lines still record the version.
+func parseGoSum(ctx context.Context, filePath string, data []byte, summary *scanSummary) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		if lineNum%cancelCheckInterval == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		version, goMod := strings.CutSuffix(fields[1], "/go.mod")
+		key := dependencyKey(ecosystemGo, fields[0], version)
+		digests := map[string]string{}
+		if alg, _, ok := strings.Cut(fields[2], ":"); ok && !goMod {
+			if canonical, ok := canonicalDigest(fields[2]); ok {
+				digests[alg] = canonical
+			}
+		}
+		summary.recordLockEntry(key, lockEntry{digests: digests, path: filePath})
+	}
+	return scanner.Err()
+}
+
+// npmLockPackage is a package entry in package-lock.json. Dependencies is
+// the nested lockfile v1 layout.
+type npmLockPackage struct {
+	Version      string                    `json:"version"`
+	Integrity    string                    `json:"integrity"`
+	Link         bool                      `json:"link"`
+	Dependencies map[string]npmLockPackage `json:"dependencies"`
+}
+
+// parsePackageLock records package-lock.json entries from the v2/v3
+// "packages" map or, for v1 lockfiles, the nested "dependencies" tree.
+func parsePackageLock(filePath string, data []byte, summary *scanSummary) {
+	var lock struct {
+		Packages     map[string]npmLockPackage `json:"packages"`
+		Dependencies map[string]npmLockPackage `json:"dependencies"`
+	}
+	if json.Unmarshal(data, &lock) != nil {
+		return
+	}
+
+	record := func(name string, pkg npmLockPackage) {
+		if name == "" || pkg.Version == "" || pkg.Link {
+			return
+		}
+		summary.recordLockEntry(dependencyKey(ecosystemNPM, name, pkg.Version),
+			lockEntry{digests: integrityDigests(pkg.Integrity), path: filePath})
+	}
+
+	if len(lock.Packages) > 0 {
+		for path, pkg := range lock.Packages {
+			i := strings.LastIndex(path, "node_modules/")
+			if i < 0 {
+				continue
+			}
+			record(path[i+len("node_modules/"):], pkg)
+		}
+		return
+	}
+	var walk func(deps map[string]npmLockPackage)
+	walk = func(deps map[string]npmLockPackage) {
+		for name, pkg := range deps {
+			record(name, pkg)
+			walk(pkg.Dependencies)
+		}
+	}
+	walk(lock.Dependencies)
+}
+
+// integrityDigests parses a Subresource Integrity string such as
+// "sha512-<base64> sha1-<base64>" into hex digests by algorithm.
+func integrityDigests(integrity string) map[string]string {
+	digests := map[string]string{}
+	for _, field := range strings.Fields(integrity) {
+		alg, value, ok := strings.Cut(field, "-")
+		if !ok {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		digests[strings.ToLower(alg)] = hex.EncodeToString(raw)
+	}
+	return digests
+}
+
+// reportLockfileMismatches compares each statement's dependency materials
+// with the workspace lockfiles. A material whose digest contradicts the
+// lockfile entry for the same version is reported at Medium; a statement
+// whose materials mostly miss the lockfiles is reported at Low when
+// minOverlap (a percentage) is positive. Only ecosystems the workspace has a
+// lockfile for are compared.
+func reportLockfileMismatches(findings *findingSet, summary *scanSummary, minOverlap int) {
+	ecosystems := make(map[string]bool)
+	for key := range summary.lockEntries {
+		ecosystems[ecosystemOf(key)] = true
+	}
+
+	for _, sm := range summary.statementMaterials {
+		finding := func(ruleID string, severity pluginv1.Severity, message string) *findingBuilder {
+			fb := findings.Finding(ruleID, severity, sdk.ConfidenceMedium, message).
+				At(sm.location, sm.line, sm.line)
+			if sm.index >= 0 {
+				fb.WithMetadata("statement_index", strconv.Itoa(sm.index))
+			}
+			return fb
+		}
+
+		compared, matched := 0, 0
+		for _, m := range sm.materials {
+			if !ecosystems[ecosystemOf(m.key)] {
+				continue
+			}
+			compared++
+			entry, ok := summary.lockEntries[m.key]
+			if !ok {
+				continue
+			}
+			matched++
+			for _, alg := range sortedKeys(m.digests) {
+				want, ok := entry.digests[alg]
+				if !ok || want == m.digests[alg] {
+					continue
+				}
+				finding(lockfileDigestMismatchRuleID, sdk.SeverityMedium,
+					fmt.Sprintf("Provenance material %s claims a %s digest that contradicts the lockfile", m.uri, alg)).
+					WithMetadata("type", "lockfile_digest_mismatch").
+					WithMetadata("material", m.uri).
+					WithMetadata("dependency", m.key).
+					WithMetadata("digest_algorithm", alg).
+					WithMetadata("material_digest", m.digests[alg]).
+					WithMetadata("lockfile_digest", want).
+					WithMetadata("lockfile", workspacePath(findings.root, entry.path)).
+					Done()
+			}
+		}
+
+		if compared == 0 || minOverlap <= 0 || matched*100 >= minOverlap*compared {
+			continue
+		}
+		finding(lowLockfileOverlapRuleID, sdk.SeverityLow,
+			fmt.Sprintf("Only %d of %d provenance materials match a workspace lockfile entry", matched, compared)).
+			WithMetadata("type", "low_lockfile_overlap").
+			WithMetadata("materials_compared", strconv.Itoa(compared)).
+			WithMetadata("materials_matched", strconv.Itoa(matched)).
+			WithMetadata("min_lockfile_overlap", strconv.Itoa(minOverlap)).
+			Done()
+	}
+}
+
+// recordLockEntry adds a lockfile entry. Entries for the same version from
+// one lockfile are combined; across lockfiles, the entry from the first path
+// in sorted order wins so results do not depend on scan order.
+func (s *scanSummary) recordLockEntry(key string, entry lockEntry) {
+	if s.lockEntries == nil {
+		s.lockEntries = make(map[string]lockEntry)
+	}
+	existing, ok := s.lockEntries[key]
+	switch {
+	case !ok || entry.path < existing.path:
+		s.lockEntries[key] = entry
+	case entry.path == existing.path:
+		for alg, digest := range entry.digests {
+			existing.digests[alg] = digest
+		}
+	}
+}
+
+// recordMaterials keeps a statement's dependency materials for the lockfile
+// cross-check.
+func (s *scanSummary) recordMaterials(location string, ps *parsedStatement, single bool) {
+	materials := dependencyMaterials(ps)
+	if len(materials) == 0 {
+		return
+	}
+	index := ps.Index
+	if single {
+		index = -1
+	}
+	s.statementMaterials = append(s.statementMaterials, statementMaterials{
+		location:  location,
+		line:      ps.Line,
+		index:     index,
+		materials: materials,
+	})
+}
+
+// mergeLockfiles folds the lockfile entries and statement materials recorded
+// in other into s.
+func (s *scanSummary) mergeLockfiles(other *scanSummary) {
+	s.statementMaterials = append(s.statementMaterials, other.statementMaterials...)
+	for key, entry := range other.lockEntries {
+		s.recordLockEntry(key, entry)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeMaterialURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"pkg:golang/github.com/google/uuid@v1.6.0", "golang:github.com/google/uuid@v1.6.0"},
+		{"pkg:golang/github.com/Azure/go-autorest@v14.2.0%2Bincompatible?type=module", "golang:github.com/Azure/go-autorest@v14.2.0+incompatible"},
+		{"https://proxy.golang.org/github.com/google/uuid/@v/v1.6.0.zip", "golang:github.com/google/uuid@v1.6.0"},
+		{"https://goproxy.example/github.com/!azure/go-autorest/@v/v14.2.0+incompatible.mod", "golang:github.com/Azure/go-autorest@v14.2.0+incompatible"},
+		{"pkg:npm/left-pad@1.3.0", "npm:left-pad@1.3.0"},
+		{"pkg:npm/%40babel/core@7.24.0", "npm:@babel/core@7.24.0"},
+		{"pkg:npm/@babel/core@7.24.0#lib", "npm:@babel/core@7.24.0"},
+		{"https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz", "npm:left-pad@1.3.0"},
+		{"https://registry.npmjs.org/@babel/core/-/core-7.24.0.tgz", "npm:@babel/core@7.24.0"},
+		{"https://registry.yarnpkg.com/@babel%2fcore/-/core-7.24.0.tgz", "npm:@babel/core@7.24.0"},
+	}
+	for _, tt := range tests {
+		got, ok := normalizeMaterialURI(tt.uri)
+		if !ok || got != tt.want {
+			t.Errorf("normalizeMaterialURI(%q) = %q, %v; want %q", tt.uri, got, ok, tt.want)
+		}
+	}
+
+	for _, uri := range []string{
+		"git+https://github.com/example/repo@refs/heads/main",
+		"pkg:pypi/requests@2.31.0",
+		"pkg:npm/left-pad",
+		"https://proxy.golang.org/github.com/google/uuid/@v/list",
+		"https://proxy.golang.org/github.com/!Bad/@v/v1.0.0.zip",
+		"https://registry.npmjs.org/left-pad/-/other-1.3.0.tgz",
+	} {
+		if got, ok := normalizeMaterialURI(uri); ok {
+			t.Errorf("normalizeMaterialURI(%q) = %q, want no match", uri, got)
+		}
+	}
+}
+
+func TestCanonicalDigest(t *testing.T) {
+	raw := []byte("0123456789abcdef0123456789abcdef")
+	want := hex.EncodeToString(raw)
+	for _, value := range []string{want, "SHA256:" + want, "h1:" + base64.StdEncoding.EncodeToString(raw)} {
+		if got, ok := canonicalDigest(value); !ok || got != want {
+			t.Errorf("canonicalDigest(%q) = %q, %v; want %q", value, got, ok, want)
+		}
+	}
+	if _, ok := canonicalDigest("not a digest!"); ok {
+		t.Error("expected an undecodable digest to be rejected")
+	}
+}
+
+func TestScanCrossChecksLockfiles(t *testing.T) {
+	const (
+		uuidHash  = "h1:NIvaJDMOsjHA8n1jAhLSgzrAzy1Hgr+hNrb57e+94F0="
+		otherHash = "h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	)
+	uuidHex, _ := canonicalDigest(uuidHash)
+	otherHex, _ := canonicalDigest(otherHash)
+
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "go.sum"),
+		"github.com/google/uuid v1.6.0 "+uuidHash+"\n"+
+			"github.com/google/uuid v1.6.0/go.mod h1:TIyPZe4MgqvfeYDBFedMoGGpEw/LqOeaOT+nhxU+yHo=\n"+
+			"golang.org/x/sys v0.20.0 "+otherHash+"\n")
+	writeFile(t, filepath.Join(workspace, "web", "package-lock.json"),
+		`{"lockfileVersion":3,"packages":{"":{"name":"web"},"node_modules/left-pad":{"version":"1.3.0","integrity":"sha512-`+
+			base64.StdEncoding.EncodeToString([]byte("left-pad"))+`"}}}`)
+
+	materials := `[{"uri":"git+https://github.com/example/repo","digest":{"sha1":"abc"}},` +
+		`{"uri":"pkg:golang/github.com/google/uuid@v1.6.0","digest":{"h1":"` + uuidHex + `"}},` +
+		`{"uri":"https://proxy.golang.org/golang.org/x/sys/@v/v0.20.0.zip","digest":{"h1":"` + uuidHex + `"}},` +
+		`{"uri":"https://registry.npmjs.org/left-pad/-/left-pad-1.3.0.tgz"}]`
+	unrelated := `[{"uri":"pkg:golang/github.com/other/a@v1.0.0"},{"uri":"pkg:golang/github.com/other/b@v1.0.0"},` +
+		`{"uri":"pkg:golang/github.com/google/uuid@v1.6.0"},{"uri":"pkg:pypi/requests@2.31.0"}]`
+	writeFile(t, filepath.Join(workspace, "release", "app.intoto.jsonl"),
+		levelStatement("https://github.com/actions/runner", "https://github.com/actions/workflow", `[{"name":"app","digest":{"sha256":"abc123def4567890abc123def4567890abc123def4567890abc123def4567890"}}]`, materials)+"\n"+
+			levelStatement("https://github.com/actions/runner", "https://github.com/actions/workflow", `[{"name":"cli","digest":{"sha256":"abc123def4567890abc123def4567890abc123def4567890abc123def4567890"}}]`, unrelated)+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	mismatches := findByRule(resp.GetFindings(), lockfileDigestMismatchRuleID)
+	if len(mismatches) != 1 {
+		t.Fatalf("expected 1 %s finding, got %d", lockfileDigestMismatchRuleID, len(mismatches))
+	}
+	meta := mismatches[0].GetMetadata()
+	if meta["dependency"] != "golang:golang.org/x/sys@v0.20.0" || meta["lockfile"] != "go.sum" ||
+		meta["lockfile_digest"] != otherHex || meta["statement_index"] != "0" {
+		t.Errorf("unexpected %s metadata %v", lockfileDigestMismatchRuleID, meta)
+	}
+
+	overlap := findByRule(resp.GetFindings(), lowLockfileOverlapRuleID)
+	if len(overlap) != 1 {
+		t.Fatalf("expected 1 %s finding, got %d", lowLockfileOverlapRuleID, len(overlap))
+	}
+	meta = overlap[0].GetMetadata()
+	if meta["statement_index"] != "1" || meta["materials_compared"] != "3" || meta["materials_matched"] != "1" {
+		t.Errorf("unexpected %s metadata %v", lowLockfileOverlapRuleID, meta)
+	}
+	if line := overlap[0].GetLocation().GetStartLine(); line != 2 {
+		t.Errorf("%s line = %d, want 2", lowLockfileOverlapRuleID, line)
+	}
+
+	resp = invokeScanWithInput(t, testClient(t), map[string]any{"workspace_root": workspace, "min_lockfile_overlap": 0})
+	if found := findByRule(resp.GetFindings(), lowLockfileOverlapRuleID); len(found) != 0 {
+		t.Errorf("expected no %s findings with min_lockfile_overlap 0, got %d", lowLockfileOverlapRuleID, len(found))
+	}
+}
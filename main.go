@@ -2,14 +2,19 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
 	"github.com/nox-hq/nox/sdk"
@@ -26,6 +31,17 @@ var provenanceFilePatterns = []string{
 	"provenance.json",
 	"attestation.json",
 	"*.att.json",
+	"*.publish.attestation",
+}
+
+// provenanceDirs lists directory names under which any JSON or JSONL file is
+// a provenance candidate, whatever its name. Candidates only count as
+// provenance if their content looks like an attestation.
+var provenanceDirs = []string{
+	"attestations",
+	".attestations",
+	"slsa",
+	".slsa",
 }
 
 // buildConfigFiles lists files that describe build processes.
@@ -41,6 +57,7 @@ var buildConfigFiles = map[string]bool{
 	"build.gradle":     true,
 	"build.gradle.kts": true,
 	"pom.xml":          true,
+	"CMakeLists.txt":   true,
 }
 
 // ciConfigPatterns lists CI configuration file patterns.
@@ -53,265 +70,981 @@ var ciConfigPatterns = []string{
 }
 
 // nonDeterministicPatterns detects build commands that produce
-// non-reproducible outputs.
+// non-reproducible outputs. Keyword is a lowercase literal every match
+// contains; lines without it skip the regular expression. Timestamp patterns
+// are judged against the SOURCE_DATE_EPOCH in scope.
 var nonDeterministicPatterns = []struct {
-	Pattern *regexp.Regexp
-	Reason  string
+	Keyword   string
+	Pattern   *regexp.Regexp
+	Reason    string
+	Timestamp bool
 }{
-	{regexp.MustCompile(`(?i)\bcurl\b.*\|\s*(sh|bash)\b`), "Piping remote script to shell is non-reproducible"},
-	{regexp.MustCompile(`(?i)\bwget\b.*\|\s*(sh|bash)\b`), "Piping remote script to shell is non-reproducible"},
-	{regexp.MustCompile(`(?i)\b(apt-get|apk|yum)\s+install\s+[a-zA-Z][a-zA-Z0-9._-]*\s*$`), "Package install without version pinning"},
-	{regexp.MustCompile(`(?i)\blatest\b`), "Using 'latest' tag is non-deterministic"},
-	{regexp.MustCompile(`(?i)\bDATE\b|\bdate\s*\(`), "Embedding build date makes output non-reproducible"},
-	{regexp.MustCompile(`(?i)\bRANDOM\b|\brand\(`), "Random values in build produce non-deterministic output"},
+	{"curl", regexp.MustCompile(`(?i)\bcurl\b.*\|\s*(sh|bash)\b`), "Piping remote script to shell is non-reproducible", false},
+	{"wget", regexp.MustCompile(`(?i)\bwget\b.*\|\s*(sh|bash)\b`), "Piping remote script to shell is non-reproducible", false},
+	{"install", regexp.MustCompile(`(?i)\b(apt-get|apk|yum)\s+install\s+[a-zA-Z][a-zA-Z0-9._-]*\s*$`), "Package install without version pinning", false},
+	{"latest", regexp.MustCompile(`(?i)\blatest\b`), "Using 'latest' tag is non-deterministic", false},
+	{"date", regexp.MustCompile(`(?i)\bDATE\b|\bdate\s*\(`), "Embedding build date makes output non-reproducible", true},
+	{"rand", regexp.MustCompile(`(?i)\bRANDOM\b|\brand\(`), "Random values in build produce non-deterministic output", false},
 }
 
 // skippedDirs contains directory names to skip during recursive walks.
 var skippedDirs = map[string]bool{
-	".git":         true,
-	"vendor":       true,
-	"node_modules": true,
-	"__pycache__":  true,
-	".venv":        true,
-}
-
-// inTotoStatement represents a minimal in-toto attestation statement.
-type inTotoStatement struct {
-	Type          string `json:"_type"`
-	PredicateType string `json:"predicateType"`
-	Subject       []struct {
-		Name   string            `json:"name"`
-		Digest map[string]string `json:"digest"`
-	} `json:"subject"`
-	Predicate json.RawMessage `json:"predicate"`
-}
-
-// slsaPredicate represents a minimal SLSA provenance predicate.
-type slsaPredicate struct {
-	Builder struct {
-		ID string `json:"id"`
-	} `json:"builder"`
-	BuildType string `json:"buildType"`
-	Materials []struct {
-		URI    string            `json:"uri"`
-		Digest map[string]string `json:"digest"`
-	} `json:"materials"`
+	".git":           true,
+	"vendor":         true,
+	"node_modules":   true,
+	"__pycache__":    true,
+	".venv":          true,
+	"target":         true,
+	".tox":           true,
+	".mypy_cache":    true,
+	".pytest_cache":  true,
+	".gradle":        true,
+	".terraform":     true,
+	"bazel-out":      true,
+	"bazel-bin":      true,
+	"bazel-testlogs": true,
 }
 
 func buildServer() *sdk.PluginServer {
-	manifest := sdk.NewManifest("nox/provenance", version).
+	manifest := advertiseParsers(sdk.NewManifest("nox/provenance", version).
 		Capability("provenance", "SLSA attestation generation and verification").
 		Tool("scan", "Scan for missing or incomplete SLSA attestations and provenance metadata", true).
-		Done().
+		Tool("diff", "Compare two provenance files or directories and report structural differences", true).
+		Tool("validate", "Validate provenance content passed inline without writing it to disk", true).
+		Tool("rules", "List every rule the plugin can emit with its default severity, confidence, and category", true).
+		Tool("explain", "Explain the parsing and completeness checks of one provenance file statement by statement", true).
+		Done()).
 		Safety(sdk.WithRiskClass(sdk.RiskPassive)).
 		Build()
 
 	return sdk.NewPluginServer(manifest).
-		HandleTool("scan", handleScan)
+		HandleTool("scan", handleScan).
+		HandleTool("diff", handleDiff).
+		HandleTool("validate", handleValidate).
+		HandleTool("rules", handleRules).
+		HandleTool("explain", handleExplain)
 }
 
 func handleScan(ctx context.Context, req sdk.ToolRequest) (*pluginv1.InvokeToolResponse, error) {
-	workspaceRoot, _ := req.Input["workspace_root"].(string)
-	if workspaceRoot == "" {
-		workspaceRoot = req.WorkspaceRoot
+	workspaceRoot, err := resolveWorkspaceRoot(req)
+	if err != nil {
+		return nil, err
+	}
+	archivePath, err := resolveWorkspaceArchive(req)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := parseScanOptions(envDefaults.apply(req.Input))
+	if err != nil {
+		return nil, err
 	}
 
 	resp := sdk.NewResponse()
 
+	// A workspace archive is read into memory and scanned in place of a
+	// directory.
+	var fsys workspaceFS = osFS{}
+	var archive *archiveFS
+	if archivePath != "" {
+		if archive, err = loadWorkspaceArchive(archivePath, opts.maxFileSize); err != nil {
+			return nil, err
+		}
+		workspaceRoot, fsys = archive.root, archive
+	}
+
 	if workspaceRoot == "" {
 		return resp.Build(), nil
 	}
 
-	hasProvenance := false
+	if opts.policy.rego, err = loadRegoPolicy(ctx, fsys, workspaceRoot, opts.policyFiles); err != nil {
+		return nil, err
+	}
+
+	findings := &findingSet{root: workspaceRoot, fsys: fsys, disabled: opts.disabledRules}
+	start := time.Now()
+	summary := &scanSummary{
+		trustedBuilders: opts.trustedBuilders,
+		collectMetrics:  opts.collectMetrics,
+		envDefaults:     envDefaults.applied(req.Input),
+	}
+	if archive != nil {
+		summary.workspaceArchive = archivePath
+		summary.archiveLinksSkipped = archive.linksSkipped
+	}
 	hasBuildConfig := false
+	hasCIConfig := false
+	var buildConfigs []buildConfigRef
+	// configPaths holds the build and CI configs the pool scans, so that
+	// followed script references do not scan them again.
+	configPaths := make(map[string]bool)
+	// limitedKinds holds the kinds of oversized files the walk skipped;
+	// workers also record limited kinds, so it joins the summary once the
+	// pool is drained.
+	var limitedKinds fileKind
 
-	err := filepath.WalkDir(workspaceRoot, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return nil
-		}
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-		if d.IsDir() {
-			if skippedDirs[d.Name()] {
-				return filepath.SkipDir
-			}
-			return nil
-		}
+	pool := startScanPool(ctx, opts.concurrency, opts.fileTimeBudget, opts.policy, opts.provenance, findings, summary)
 
-		name := d.Name()
+	// Links in an archive were resolved as it was read.
+	walker := &workspaceWalker{
+		root:           workspaceRoot,
+		followSymlinks: opts.followSymlinks && archive == nil,
+		skipDirs:       opts.skipDirs,
+		maxDepth:       opts.maxDepth,
+		summary:        summary,
+		findings:       findings,
+		ignores:        &ignoreMatcher{gitignore: opts.respectGitignore, fsys: fsys},
+		provenance:     opts.provenance,
+		visit: func(path, rel string, d fs.DirEntry) error {
+			summary.filesWalked++
+			summary.lastPath = path
 
-		// Check for provenance files.
-		if isProvenanceFile(name) {
-			hasProvenance = true
-			return scanProvenanceFile(resp, path)
-		}
+			// Classify only; the pool reads and analyzes the file.
+			kind := classifyFile(rel, d.Name(), opts.provenance)
+			if !opts.checkImages {
+				kind &^= kindImageSource
+			}
+			if !opts.scanArchives {
+				kind &^= kindArchive
+			}
+			if !opts.checkSBOM {
+				kind &^= kindSBOM
+			}
+			if isSBOMFile(d.Name()) {
+				summary.sbomFiles++
+			}
+			if ciSystemFiles[d.Name()] {
+				hasCIConfig = true
+			}
+			summary.observeProductionFile(path, rel, d.Name())
+			if kind == 0 {
+				return nil
+			}
+			if kind.has(kindBuildConfig) {
+				summary.buildConfigFiles++
+				buildConfigs = append(buildConfigs, buildConfigRef{path: path, rel: rel})
+			}
+			if kind.has(kindCIConfig) {
+				summary.ciConfigFiles++
+				hasCIConfig = true
+			}
+			if kind.has(kindBuildConfig | kindCIConfig) {
+				hasBuildConfig = true
+				configPaths[path] = true
+			}
+			if kind.has(kindAction) {
+				summary.actionFiles++
+				configPaths[path] = true
+			}
+			// An oversized provenance file is reported instead of counted.
+			size, ok := oversized(path, d, opts.maxFileSize)
+			// Binaries are only sniffed, whatever their size.
+			if ok && kind == kindBinary {
+				ok = false
+			}
+			if ok {
+				summary.filesOversized++
+				limitedKinds |= kind
+				if kind.has(kindProvenance) {
+					reportOversizedProvenance(findings, path, size, opts.maxFileSize)
+				}
+				return nil
+			}
+			if kind.has(kindProvenance) {
+				summary.provenanceFiles++
+			}
+			summary.kindsAnalyzed |= kind
+			return pool.submit(ctx, scanJob{path: path, kind: kind, size: size})
+		},
+	}
 
-		// Check for build configs and scan for reproducibility risks.
-		if buildConfigFiles[name] || isCIConfig(path, workspaceRoot) {
-			hasBuildConfig = true
-			return scanBuildFileForReproducibility(resp, path)
+	walkStart := time.Now()
+	var walkErr error
+	if opts.incremental {
+		summary.incremental = true
+		walkErr = walker.walkChanged(ctx, opts.changedFiles)
+	} else {
+		walkErr = walker.walk(ctx)
+	}
+	// Workers merge their phase timings into the summary until the pool
+	// is drained, so the walk time is recorded only after that.
+	walkElapsed := time.Since(walkStart)
+	poolErr := pool.wait()
+	summary.addPhase(phaseWalk, walkElapsed)
+	summary.kindsLimited |= limitedKinds
+	for _, err := range []error{walkErr, poolErr} {
+		switch {
+		case err == nil:
+		case isContextError(err):
+			if summary.interrupted == nil {
+				summary.interrupted = err
+			}
+		default:
+			return nil, fmt.Errorf("walking workspace: %w", err)
 		}
+	}
+	// Workers drop queued jobs silently once ctx is done, so the walk may
+	// finish cleanly while analysis was cut short.
+	if summary.interrupted == nil {
+		summary.interrupted = ctx.Err()
+	}
 
-		return nil
-	})
-	if err != nil && err != context.Canceled {
-		return nil, fmt.Errorf("walking workspace: %w", err)
+	// Follow the scripts build and CI commands invoke before any check that
+	// depends on what the builds do. An incremental scan analyzes only the
+	// changed files and skips the checks that need the whole workspace.
+	if opts.followScripts && !opts.incremental && len(summary.scriptRefs) > 0 && summary.interrupted == nil {
+		followStart := time.Now()
+		if err := followScripts(ctx, findings, summary, configPaths, opts.policy, opts.maxFileSize); err != nil {
+			summary.interrupted = err
+		}
+		summary.timePhase(phaseBuildScan, followStart)
+	}
+	checksStart := time.Now()
+	if !opts.incremental {
+		runWorkspaceChecks(ctx, &workspaceScan{
+			root:           workspaceRoot,
+			opts:           opts,
+			findings:       findings,
+			summary:        summary,
+			hasBuildConfig: hasBuildConfig,
+			hasCIConfig:    hasCIConfig,
+			buildConfigs:   buildConfigs,
+			configPaths:    configPaths,
+		})
 	}
 
-	// If there are build configs but no provenance files, flag the missing attestation.
-	if hasBuildConfig && !hasProvenance {
-		resp.Finding(
-			"PROV-001",
-			sdk.SeverityHigh,
-			sdk.ConfidenceMedium,
-			"No SLSA attestation or provenance files found in workspace with build configuration",
-		).
-			At(workspaceRoot, 0, 0).
-			WithMetadata("type", "missing_attestation").
-			Done()
+	// Gate on severity before the summary is added; the summary records the
+	// outcome so hosts can fail the build while still receiving all findings.
+	if opts.failOnSeverity != "" {
+		summary.gate = evaluateGate(findings, opts.gateThreshold, opts.failOnSeverity, opts.maxFileSize)
 	}
 
+	summary.timePhase(phaseWorkspaceChecks, checksStart)
+	summary.coverage = scanCoverage(opts, summary)
+	findings.owners = loadCodeOwners(fsys, workspaceRoot)
+	summary.elapsed = time.Since(start)
+	summary.emit(findings, workspaceRoot)
+
+	findings.build(resp)
 	return resp.Build(), nil
 }
 
-// isProvenanceFile checks whether a filename matches known provenance naming conventions.
-func isProvenanceFile(name string) bool {
-	lower := strings.ToLower(name)
-	for _, pattern := range provenanceFilePatterns {
-		matched, _ := filepath.Match(pattern, lower)
-		if matched {
-			return true
-		}
+// oversized reports whether a file is larger than limit, along with its size.
+// Symlinked files are measured by their target.
+func oversized(path string, d fs.DirEntry, limit int64) (int64, bool) {
+	info, err := d.Info()
+	if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		info, err = os.Stat(path)
 	}
-	return false
+	if err != nil {
+		return 0, false
+	}
+	return info.Size(), info.Size() > limit
+}
+
+// reportOversizedProvenance flags a provenance file that was too large to
+// validate; it does not count as provenance for the workspace.
+func reportOversizedProvenance(findings *findingSet, path string, size, limit int64) {
+	findings.Finding(
+		"PROV-007",
+		sdk.SeverityLow,
+		sdk.ConfidenceHigh,
+		"Provenance file exceeds size limit and was not validated",
+	).
+		At(path, 0, 0).
+		WithMetadata("type", "oversized_provenance").
+		WithMetadata("size_bytes", strconv.FormatInt(size, 10)).
+		WithMetadata("max_file_size", strconv.FormatInt(limit, 10)).
+		Done()
+}
+
+// isContextError reports whether err stems from cancellation or an expired
+// deadline, in which case a scan returns what it collected so far.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// reportUnreadableProvenance flags a provenance file that exists but could not
+// be read; it does not count as provenance for the workspace.
+func reportUnreadableProvenance(findings *findingSet, path string, err error) {
+	findings.Finding(
+		"PROV-008",
+		sdk.SeverityLow,
+		sdk.ConfidenceHigh,
+		"Provenance file could not be read and was not validated",
+	).
+		At(path, 0, 0).
+		WithMetadata("type", "unreadable_provenance").
+		WithMetadata("error", err.Error()).
+		Done()
 }
 
-// isCIConfig checks whether a path matches CI configuration patterns relative
-// to the workspace root.
-func isCIConfig(path, workspaceRoot string) bool {
-	rel, err := filepath.Rel(workspaceRoot, path)
+// isCIConfig checks whether a workspace-relative slash path matches CI
+// configuration patterns.
+func isCIConfig(rel string) bool {
+	return ciConfigMatcher.match(rel)
+}
+
+// scanProvenanceFile reads and validates an in-toto attestation file. Files
+// that share a provenance name but hold some other JSON document are skipped.
+func scanProvenanceFile(ctx context.Context, findings *findingSet, filePath string, policy provenancePolicy, summary *scanSummary) error {
+	data, err := findings.files().ReadFile(filePath)
 	if err != nil {
-		return false
+		summary.filesUnreadable++
+		reportUnreadableProvenance(findings, filePath, err)
+		return nil
 	}
-	for _, pattern := range ciConfigPatterns {
-		matched, _ := filepath.Match(pattern, rel)
-		if matched {
-			return true
-		}
+	if !looksLikeAttestation(data) {
+		summary.nonAttestationFiles++
+		return nil
 	}
-	return false
+	summary.attestationFiles++
+	summary.attestationPaths = append(summary.attestationPaths, filePath)
+
+	return checkProvenance(ctx, findings, filePath, data, policy, summary)
 }
 
-// scanProvenanceFile reads and validates an in-toto attestation file.
-func scanProvenanceFile(resp *sdk.ResponseBuilder, filePath string) error {
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil
+// maxSubjectFindings caps the per-subject PROV-002 findings for a single
+// statement; beyond it the defective subjects collapse into one finding.
+const maxSubjectFindings = 50
+
+// checkProvenance parses a provenance document and reports incomplete
+// metadata for each statement it holds: one finding for statement-level
+// problems and one per defective subject. A document with no decodable
+// statement is validated as an empty statement so the gap is still reported.
+// A document whose statements all pass is kept as a confirmation candidate.
+// On cancellation the statements handled so far keep their findings and the
+// context error is returned.
+func checkProvenance(ctx context.Context, findings *findingSet, location string, data []byte, policy provenancePolicy, summary *scanSummary) error {
+	statements, err := parseProvenance(ctx, data)
+	ctxErr := ctx.Err()
+	switch {
+	case ctxErr != nil:
+		summary.statementsParsed += len(statements)
+		err = nil
+	case err != nil:
+		summary.parseFailures++
+		statements = []parsedStatement{{}}
+	default:
+		summary.statementsParsed += len(statements)
 	}
 
-	var stmt inTotoStatement
-	if err := json.Unmarshal(data, &stmt); err != nil {
-		// Try line-delimited format (JSONL).
-		lines := strings.Split(string(data), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" {
-				continue
+	// clean stays set while every statement parses and passes its checks;
+	// minLevel is the lowest estimated level among them.
+	clean, minLevel := err == nil && ctxErr == nil, maxSLSALevel
+	lines := &lineIndex{data: data}
+	for i := range statements {
+		if ctxErr == nil && i%cancelCheckInterval == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		ps := &statements[i]
+
+		// A parse failure leaves nothing to estimate a level from, and PyPI
+		// publish statements make no SLSA build claims.
+		level, gap := -1, ""
+		pypi := isPyPIStatement(ps)
+		if err == nil {
+			if !pypi {
+				level, gap = estimateSLSALevel(ps)
+				summary.recordSLSALevel(ps, level)
+				summary.recordBuilder(ps)
+				summary.recordClaims(location, ps, len(statements) == 1)
+				minLevel = min(minLevel, level)
 			}
-			if err := json.Unmarshal([]byte(line), &stmt); err == nil {
-				break
+			summary.recordSubjectDigests(ps)
+			summary.recordMaterials(location, ps, len(statements) == 1)
+			summary.recordSubjects(location, ps, len(statements) == 1)
+			summary.recordStatementTime(location, ps)
+			if isSBOMStatement(ps) {
+				summary.sbomAttestations++
 			}
 		}
-	}
 
-	// Check for incomplete metadata.
-	incomplete := false
-	var reasons []string
+		// findingWith starts a finding carrying the statement context,
+		// located at the value at jsonPath, and finding one with High
+		// confidence.
+		locator := &statementLocator{lines: lines, ps: ps}
+		findingWith := func(jsonPath, ruleID string, severity pluginv1.Severity, confidence pluginv1.Confidence, message string) *findingBuilder {
+			line := locator.line(jsonPath)
+			fb := findings.Finding(ruleID, severity, confidence, message).
+				At(location, line, line).
+				WithMetadata("json_path", jsonPath)
+			if len(statements) > 1 {
+				fb.WithMetadata("statement_index", strconv.Itoa(ps.Index))
+			}
+			if location == inlineLocation {
+				fb.WithMetadata("byte_offset", strconv.Itoa(ps.Offset))
+			}
+			if err != nil {
+				fb.WithMetadata("parse_error", err.Error())
+			}
+			if level >= 0 {
+				fb.WithMetadata("slsa_level", strconv.Itoa(level))
+			}
+			if id := ps.Predicate.builderID(); id != "" {
+				fb.WithMetadata("builder_id", id)
+			}
+			return fb
+		}
+		finding := func(jsonPath, ruleID string, severity pluginv1.Severity, message string) *findingBuilder {
+			return findingWith(jsonPath, ruleID, severity, sdk.ConfidenceHigh, message)
+		}
 
-	if len(stmt.Subject) == 0 {
-		incomplete = true
-		reasons = append(reasons, "missing subject")
-	} else {
-		for _, subj := range stmt.Subject {
-			if subj.Name == "" {
-				incomplete = true
-				reasons = append(reasons, "subject missing name")
+		if level >= 0 && level < policy.requiredSLSALevel {
+			clean = false
+			finding(rootJSONPath, "PROV-009", sdk.SeverityHigh,
+				fmt.Sprintf("Estimated SLSA build level %d is below the required level %d (missing %s)", level, policy.requiredSLSALevel, gap)).
+				WithMetadata("type", "slsa_level_unmet").
+				WithMetadata("required_slsa_level", strconv.Itoa(policy.requiredSLSALevel)).
+				WithMetadata("slsa_level_gap", gap).
+				Done()
+		}
+
+		if err == nil && !pypi && len(policy.allowedSourceRefs) > 0 && strings.HasPrefix(ps.Statement.PredicateType, slsaProvenancePrefix) {
+			allowed := strings.Join(policy.allowedSourceRefs, ",")
+			switch ref, field := ps.Predicate.sourceRef(); {
+			case ref == "":
+				clean = false
+				finding("predicate", sourceRefRuleID, sdk.SeverityLow, "Provenance records no source ref to check against allowed_source_refs").
+					WithMetadata("type", "source_ref_unknown").
+					WithMetadata("build_type", ps.Predicate.buildTypeURI()).
+					WithMetadata("allowed_source_refs", allowed).
+					Done()
+			case matchSourceRef(policy.allowedSourceRefs, ref) == "":
+				clean = false
+				finding("predicate."+field, sourceRefRuleID, sdk.SeverityMedium,
+					fmt.Sprintf("Provenance was built from %s, which allowed_source_refs does not permit", ref)).
+					WithMetadata("type", "source_ref_not_allowed").
+					WithMetadata("source_ref", ref).
+					WithMetadata("source_ref_field", field).
+					WithMetadata("allowed_source_refs", allowed).
+					Done()
+			}
+		}
+
+		// A statement the policy fails on is reported too, so a policy
+		// cannot be bypassed by a statement it chokes on.
+		if policy.rego != nil && err == nil {
+			denials, evalErr := policy.rego.evaluate(ctx, workspacePath(findings.root, location), ps)
+			if evalErr != nil && ctx.Err() == nil {
+				clean = false
+				finding(rootJSONPath, policyDenialRuleID, sdk.SeverityHigh, fmt.Sprintf("Policy evaluation failed: %v", evalErr)).
+					WithMetadata("type", "policy_evaluation_failed").
+					WithMetadata("policy_error", evalErr.Error()).
+					Done()
+			}
+			for _, d := range denials {
+				clean = false
+				finding(rootJSONPath, policyDenialRuleID, sdk.SeverityHigh, fmt.Sprintf("Policy rule %s denied the statement: %s", d.rule, d.message)).
+					WithMetadata("type", "policy_denial").
+					WithMetadata("policy_rule", d.rule).
+					WithMetadata("policy_message", d.message).
+					Done()
 			}
-			if len(subj.Digest) == 0 {
-				incomplete = true
-				reasons = append(reasons, "subject missing digest")
+		}
+
+		if ps.Certificate != "" {
+			if der, derr := decodeBase64(ps.Certificate); derr == nil {
+				if a, ok := assessCertificateKey(der); ok && a.weak {
+					clean = false
+					reportWeakKey(finding(rootJSONPath, weakKeyRuleID, sdk.SeverityMedium, fmt.Sprintf("Weak signing key: %s", a.reason)).
+						WithMetadata("envelope", ps.Envelope), a, keySourceCertificate)
+				}
 			}
 		}
-	}
 
-	if len(stmt.Predicate) > 0 {
-		var pred slsaPredicate
-		if err := json.Unmarshal(stmt.Predicate, &pred); err == nil {
-			if pred.Builder.ID == "" {
-				incomplete = true
-				reasons = append(reasons, "missing builder ID")
+		if pypi && err == nil {
+			publisher, ok := publisherIdentity(ps.Certificate)
+			if !ok {
+				clean = false
+				finding(rootJSONPath, pypiAttestationRuleID, sdk.SeverityMedium,
+					"PyPI attestation carries no Trusted Publisher identity").
+					WithMetadata("type", "missing_publisher_identity").
+					WithMetadata("envelope", ps.Envelope).
+					Done()
 			}
-			if len(pred.Materials) == 0 {
-				incomplete = true
-				reasons = append(reasons, "missing materials")
+			if location != inlineLocation {
+				summary.recordPyPIAttestation(location, ps, publisher)
 			}
 		}
-	} else {
-		incomplete = true
-		reasons = append(reasons, "missing predicate")
+
+		if err == nil && !pypi && location != inlineLocation && strings.HasPrefix(ps.Statement.PredicateType, slsaProvenancePrefix) {
+			summary.recordWorkflowIdentity(location, ps)
+		}
+
+		if err == nil && !pypi && strings.HasPrefix(ps.Statement.PredicateType, slsaProvenancePrefix) {
+			refs := sourceReferences(&ps.Predicate)
+			ephemeral := ephemeralReferences(refs)
+			if len(ephemeral) > maxEphemeralReferenceFindings {
+				summary.findingsCapped += len(ephemeral) - maxEphemeralReferenceFindings
+				ephemeral = ephemeral[:maxEphemeralReferenceFindings]
+			}
+			for _, r := range ephemeral {
+				clean = false
+				finding("predicate."+r.field, ephemeralSourceRuleID, sdk.SeverityMedium, ephemeralMessage(r)).
+					WithMetadata("type", "ephemeral_source_revision").
+					WithMetadata("reference", r.reference).
+					WithMetadata("reference_field", r.field).
+					WithMetadata("revision_kind", r.kind).
+					WithMetadata("repository", r.repository).
+					Done()
+			}
+			if location != inlineLocation {
+				summary.recordSourceRevisions(location, ps, refs)
+			}
+		}
+
+		if err == nil && !pypi {
+			for _, m := range matchBuilder(&ps.Predicate) {
+				clean = false
+				m.annotate(findingWith(ps.Predicate.builderIDField(ps.Statement.PredicateType), knownBadGeneratorRuleID, sdk.SeverityMedium, m.confidence,
+					m.message("Provenance builder "+m.reference))).Done()
+			}
+		}
+
+		if ps.Statement.PredicateType == slsaRecipePredicateType {
+			clean = false
+			finding("predicateType", deprecatedPredicateRuleID, sdk.SeverityLow,
+				"Provenance uses the deprecated SLSA v0.1 predicate; migrate the builder to SLSA provenance v1").
+				WithMetadata("type", "deprecated_predicate_version").
+				WithMetadata("predicate_type", ps.Statement.PredicateType).
+				WithMetadata("build_type", ps.Predicate.buildTypeURI()).
+				Done()
+		}
+
+		if err == nil {
+			for _, ref := range secretReferences(ps, policy.secretAllowlist) {
+				clean = false
+				finding(pointerJSONPath(ref.pointer), secretRuleID, sdk.SeverityHigh,
+					fmt.Sprintf("Provenance references credential file %s", ref.value)).
+					WithMetadata("type", "secret_reference").
+					WithMetadata("secret_path", ref.value).
+					WithMetadata("credential_kind", ref.kind).
+					WithMetadata("field", ref.pointer).
+					Done()
+			}
+		}
+
+		if err == nil && policy.checkSourceSubjects && location != inlineLocation {
+			if names := sourceSubjects(findings.files(), findings.root, ps); len(names) > 0 {
+				clean = false
+				finding("subject", sourceSubjectsRuleID, sdk.SeverityMedium,
+					"Provenance subjects appear to be source files, not build artifacts").
+					WithMetadata("type", "source_subjects").
+					WithMetadata("subject_count", strconv.Itoa(len(names))).
+					WithMetadata("sample_subjects", strings.Join(names[:min(len(names), maxSourceSubjectSamples)], ",")).
+					Done()
+			}
+		}
+
+		if err == nil {
+			problems := digestProblems(ps)
+			if len(problems) > maxSubjectFindings {
+				summary.findingsCapped += len(problems) - maxSubjectFindings
+				problems = problems[:maxSubjectFindings]
+			}
+			for _, p := range problems {
+				clean = false
+				jsonPath := jsonPathKey(jsonPathIndex("subject", p.index), "digest")
+				if p.algorithm != "" {
+					jsonPath = jsonPathKey(jsonPath, p.algorithm)
+				}
+				fb := finding(jsonPath, digestConsistencyRuleID, p.severity, p.message).
+					WithMetadata("type", "inconsistent_digest").
+					WithMetadata("reason", p.reason).
+					WithMetadata("subject_index", strconv.Itoa(p.index))
+				if p.name != "" {
+					fb.WithMetadata("subject_name", p.name)
+				}
+				if p.algorithm != "" {
+					fb.WithMetadata("algorithm", p.algorithm)
+				}
+				for _, kv := range p.metadata {
+					fb.WithMetadata(kv[0], kv[1])
+				}
+				fb.Done()
+			}
+		}
+
+		c := completenessProblems(ps)
+		if c.ok() {
+			continue
+		}
+		clean = false
+
+		// report starts a PROV-002 finding for the given reasons.
+		report := func(jsonPath, message string, reasons []string) *findingBuilder {
+			return finding(jsonPath, "PROV-002", sdk.SeverityMedium, message).
+				WithMetadata("type", "incomplete_metadata").
+				WithMetadata("reasons", strings.Join(reasons, ", "))
+		}
+
+		if len(c.statement) > 0 {
+			report(statementReasonField(ps, c.statement[0]), fmt.Sprintf("Incomplete provenance metadata: %s", strings.Join(c.statement, ", ")), c.statement).Done()
+		}
+
+		if len(c.subjects) > maxSubjectFindings {
+			summary.findingsCapped += len(c.subjects) - 1
+			reasons := c.subjectReasons()
+			report("subject", fmt.Sprintf("Incomplete provenance metadata: %d subjects incomplete (%s)", len(c.subjects), strings.Join(reasons, ", ")), reasons).
+				WithMetadata("incomplete_subjects", strconv.Itoa(len(c.subjects))).
+				Done()
+			continue
+		}
+		for _, sp := range c.subjects {
+			label := fmt.Sprintf("subject %d", sp.index)
+			if sp.name != "" {
+				label = fmt.Sprintf("subject %d (%s)", sp.index, sp.name)
+			}
+			fb := report(jsonPathIndex("subject", sp.index), fmt.Sprintf("Incomplete provenance metadata: %s: %s", label, strings.Join(sp.reasons, ", ")), sp.reasons).
+				WithMetadata("subject_index", strconv.Itoa(sp.index))
+			if sp.name != "" {
+				fb.WithMetadata("subject_name", sp.name)
+			}
+			fb.Done()
+		}
 	}
 
-	if incomplete {
-		resp.Finding(
-			"PROV-002",
-			sdk.SeverityMedium,
-			sdk.ConfidenceHigh,
-			fmt.Sprintf("Incomplete provenance metadata: %s", strings.Join(reasons, ", ")),
-		).
-			At(filePath, 0, 0).
-			WithMetadata("type", "incomplete_metadata").
-			WithMetadata("reasons", strings.Join(reasons, ", ")).
-			Done()
+	if clean {
+		summary.confirmations = append(summary.confirmations, newProvenanceConfirmation(location, statements, minLevel))
 	}
 
-	return nil
+	return ctxErr
 }
 
 // scanBuildFileForReproducibility checks build configuration files for patterns
-// that produce non-deterministic outputs.
-func scanBuildFileForReproducibility(resp *sdk.ResponseBuilder, filePath string) error {
-	f, err := os.Open(filePath)
+// that produce non-deterministic outputs. Confidence follows the context of
+// the matching line, so a pattern in a command outranks one in a comment.
+// Scripts the commands invoke and Makefiles the config includes are recorded
+// for following, and findings in a followed script name the step that
+// invoked it. Recipe findings note their Makefile target and, for artifact
+// and maintenance targets, its kind. Embedded dates derived from a
+// SOURCE_DATE_EPOCH defined in the file or job pass. Credential files copied
+// into images or left on disk by commands are reported as well.
+// On cancellation it stops promptly, keeping findings for the lines already
+// scanned, and returns the context error.
+func scanBuildFileForReproducibility(ctx context.Context, findings *findingSet, filePath string, origin commandOrigin, policy provenancePolicy, summary *scanSummary) error {
+	f, err := findings.files().Open(filePath)
 	if err != nil {
+		summary.filesUnreadable++
 		return nil
 	}
 	defer func() { _ = f.Close() }()
 
-	scanner := bufio.NewScanner(f)
+	reader := bufio.NewReader(f)
+	if isBinary(reader) {
+		summary.binarySkipped++
+		return nil
+	}
+
+	scanner := bufio.NewScanner(reader)
+	lines := newLineClassifier(filePath)
+	switch {
+	case origin.format != formatOther:
+		lines = newFormatClassifier(origin.format)
+	case origin.invokedBy != "" && lines.format == formatOther:
+		// Invoked scripts without an extension are shell scripts.
+		lines = newFormatClassifier(formatShell)
+	}
+	var action *actionTracker
+	var workflow *workflowTracker
+	var envImages *envImageTracker
+	var gitlab *gitlabTracker
+	var envFlow *envFlowTracker
+	rel := workspacePath(findings.root, filePath)
+	repository := workspaceName(findings.root)
+	if origin.invokedBy == "" {
+		envImages = newEnvImageTracker(ciPlatform(rel))
+		if policy.checkGitLabProvenance && ciPlatform(rel) == platformGitLab {
+			gitlab = newGitLabTracker()
+		}
+		if isActionDefinition(filepath.Base(filePath)) {
+			action = newActionTracker(rel)
+			envFlow = newEnvFlowTracker(true)
+		} else if isGitHubWorkflow(rel) {
+			workflow = &workflowTracker{}
+			envFlow = newEnvFlowTracker(false)
+		}
+	}
+	var writes credentialWrites
+	var generators generatorTracker
+	var dates sourceDateScope
+	var joiner commandJoiner
+	// onbuild joins Dockerfile ONBUILD instructions apart, keeping the
+	// keyword the classifier strips.
+	var onbuild commandJoiner
+	commands := &commandScan{
+		findings:  findings,
+		summary:   summary,
+		filePath:  filePath,
+		origin:    origin,
+		policy:    policy,
+		action:    action,
+		workflow:  workflow,
+		downloads: newDownloadFlow(),
+	}
+	checksums := checksumTracker{goreleaser: isGoReleaserConfig(filepath.Base(filePath))}
+	var cmake *cmakeConfigure
+	if isCMakeFile(filepath.Base(filePath)) {
+		cmake = &cmakeConfigure{}
+	}
 	lineNum := 0
+	var pace cancelCheck
 	for scanner.Scan() {
 		lineNum++
+		if pace.due(len(scanner.Bytes())) && ctx.Err() != nil {
+			return ctx.Err()
+		}
 		line := scanner.Text()
+		if action != nil {
+			action.track(line, lineNum)
+		}
+		ascii := isASCII(line)
+		if isSBOMStep(line, ascii) {
+			summary.sbomSteps++
+		}
+		summary.recordVerificationLine(filePath, line, ascii)
+		lc, command := lines.classifyCommand(line)
+		if workflow != nil {
+			workflow.track(line, lineNum, lc, command, lines)
+		}
+		if envImages != nil {
+			envImages.track(line, lineNum, lc, lines.section)
+		}
+		if gitlab != nil {
+			gitlab.track(line, lineNum, lc, command)
+		}
+		if envFlow != nil {
+			envFlow.track(line, lineNum, lc, command, lines)
+		}
+		summary.recordPublishLine(filePath, lineNum, line, ascii, lc)
+		summary.recordBuildCommand(command, ascii, lc, lines.section)
+		summary.recordMultiPlatformBuild(filePath, lineNum, line, ascii, lc)
+		checksums.add(summary, filePath, lineNum, line, lc, command)
+		if origin.dir != "" && (lc == contextRunCommand || lc == contextRecipe) {
+			summary.recordScriptRefs(findings.root, filePath, lineNum, lines.section, command, origin)
+		}
+		if lines.format == formatMakefile && lc == contextOther && origin.dir != "" {
+			summary.recordMakeIncludes(findings.root, filePath, lineNum, command, origin)
+		}
+		dates.observe(line, lc, lines.format, lines.section)
+		targetKind := ""
+		if lc == contextRecipe {
+			targetKind = makeTargetKind(lines.section, repository)
+			summary.recordMakeTarget(rel, lines.section)
+		}
+		switch {
+		case lines.format == formatDockerfile && lc == contextDockerInstruction:
+			if instruction, secrets := copiedSecrets(line, policy.secretAllowlist); len(secrets) > 0 {
+				reportCopiedSecrets(findings, filePath, lineNum, instruction, secrets)
+			}
+			reportSecretArgDeclarations(findings, filePath, lineNum, line)
+			if fields := strings.Fields(line); len(fields) > 0 && strings.EqualFold(fields[0], "FROM") {
+				commands.downloads.reset(lines.section)
+			}
+			if onbuild.pending != nil || onbuildInstruction.MatchString(strings.TrimSpace(line)) {
+				if cmd, ok := onbuild.add(lineNum, lc, lines.section, line); ok {
+					reportOnbuildTrigger(findings, filePath, cmd)
+				}
+			}
+		case lc == contextRunCommand || lc == contextEcho:
+			writes.record(lineNum, command, policy.secretAllowlist)
+		case lines.format == formatYAML && lc == contextOther:
+			if m := gitlabComponent.FindStringSubmatch(strings.TrimSpace(line)); m != nil && ciPlatform(rel) == platformGitLab {
+				summary.recordComponentPin(m[1])
+			}
+			if m := usesKey.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+				if workflow != nil || action != nil {
+					summary.recordActionPin(m[1])
+					generators.uses(findings, filePath, lineNum, line, m[1], action, origin)
+				}
+				reportUnpinnedAction(findings, filePath, lineNum, m[1], action, origin)
+				if pattern := matchActionPattern(policy.actionDenylist, m[1]); pattern != "" {
+					job := ""
+					if workflow != nil {
+						job = lines.section
+					}
+					reportDeniedAction(findings, filePath, lineNum, m[1], pattern, job, action)
+				}
+			} else {
+				generators.input(findings, filePath, lineNum, line, action, origin)
+			}
+		}
 
 		for _, nd := range nonDeterministicPatterns {
+			// Case-insensitive regexps also fold some non-ASCII letters, so
+			// the prescreen only applies to ASCII lines.
+			if ascii && !containsFoldASCII(line, nd.Keyword) {
+				continue
+			}
 			if nd.Pattern.MatchString(line) {
-				resp.Finding(
+				status := ""
+				if nd.Timestamp {
+					if status = dates.status(line, lines.section); status == sourceDateDerived {
+						continue
+					}
+				}
+				fb := findings.Finding(
 					"PROV-003",
 					sdk.SeverityMedium,
-					sdk.ConfidenceMedium,
+					recipeConfidence(lc, targetKind),
 					fmt.Sprintf("Build reproducibility risk: %s", nd.Reason),
 				).
 					At(filePath, lineNum, lineNum).
 					WithMetadata("type", "reproducibility_risk").
 					WithMetadata("reason", nd.Reason).
-					Done()
+					WithMetadata("context", string(lc))
+				if lc == contextRecipe && lines.section != "" {
+					fb.WithMetadata("target", lines.section)
+				}
+				if targetKind != "" {
+					fb.WithMetadata("target_kind", targetKind)
+				}
+				if status != "" {
+					fb.WithMetadata("source_date_epoch", status).
+						WithMetadata("remediation", sourceDateRemediations[status])
+				}
+				action.annotate(origin.annotate(fb)).Done()
+			}
+		}
+
+		if lc != contextComment {
+			// Continuation lines are taken verbatim: recipe prefixes such
+			// as - only apply to the first line of a command.
+			text := command
+			if text == "" || joiner.pending != nil {
+				text = line
+			}
+			if cmd, ok := joiner.add(lineNum, lc, lines.section, text); ok {
+				commands.check(cmd)
 			}
 		}
+		if cmake != nil && lc != contextComment {
+			cmake.add(findings, filePath, lineNum, line)
+		}
+	}
+	if cmd, ok := joiner.flush(); ok {
+		commands.check(cmd)
+	}
+	if cmd, ok := onbuild.flush(); ok {
+		reportOnbuildTrigger(findings, filePath, cmd)
 	}
 
+	writes.report(findings, filePath, origin)
+	if workflow != nil {
+		workflow.close()
+	}
+	checksums.finish(summary, filePath, workflow)
+	if envImages != nil {
+		envImages.report(findings, filePath)
+	}
+	if gitlab != nil {
+		gitlab.report(findings, filePath)
+	}
+	if workflow != nil {
+		workflow.finish(findings, summary, filePath, rel, policy)
+	}
+	if action != nil {
+		action.finish(findings, filePath, summary)
+	}
+	if envFlow != nil {
+		envFlow.report(findings, filePath)
+	}
+
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		// A line beyond the scanner's buffer ends the scan of this file
+		// rather than the workspace's.
+		summary.linesTruncated++
+		return nil
+	}
 	return scanner.Err()
 }
 
+// commandScan runs the checks that read whole logical commands, joined
+// across continuation lines, of a build or CI config. Checks of a new
+// command are added to check, so the end of the file and every joined
+// command run the same ones.
+type commandScan struct {
+	findings  *findingSet
+	summary   *scanSummary
+	filePath  string
+	origin    commandOrigin
+	policy    provenancePolicy
+	action    *actionTracker
+	workflow  *workflowTracker
+	downloads *downloadFlow
+}
+
+// check runs every command check over a logical command.
+func (c *commandScan) check(cmd logicalCommand) {
+	reportHostEmbedding(c.findings, c.filePath, cmd, c.origin, c.action)
+	reportVCSEmbedding(c.findings, c.filePath, cmd, c.origin, c.action)
+	reportSecretBuildArgs(c.findings, c.filePath, cmd, c.origin, c.action)
+	reportCargoInstall(c.findings, c.filePath, cmd, c.origin, c.action)
+	reportPackBuilds(c.findings, c.summary, c.filePath, cmd, c.origin, c.action)
+	reportRegistryCommand(c.findings, c.filePath, cmd, c.origin, c.action, c.policy)
+	c.downloads.add(c.findings, c.filePath, cmd, c.origin, c.action)
+	c.workflow.trackWrites(cmd)
+	c.workflow.trackSigning(cmd)
+}
+
+// isASCII reports whether s contains only ASCII bytes.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFoldASCII reports whether s contains the lowercase ASCII literal
+// substr, ignoring ASCII case in s.
+func containsFoldASCII(s, substr string) bool {
+	n := len(substr)
+	for i := 0; i+n <= len(s); i++ {
+		j := 0
+		for j < n && lowerASCII(s[i+j]) == substr[j] {
+			j++
+		}
+		if j == n {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny reports whether s contains any of the literals. It prescreens
+// lines before patterns that cannot match without one of them, which on long
+// lines is far cheaper than running the pattern.
+func containsAny(s string, literals ...string) bool {
+	for _, literal := range literals {
+		if strings.Contains(s, literal) {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerASCII lowercases an ASCII letter and returns other bytes unchanged.
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// binarySniffSize is how much of a file is inspected for NUL bytes before
+// line-based scanning.
+const binarySniffSize = 8000
+
+// isBinary reports whether the first block of the reader contains a NUL byte,
+// without consuming it.
+func isBinary(r *bufio.Reader) bool {
+	head, _ := r.Peek(binarySniffSize)
+	return bytes.IndexByte(head, 0) >= 0
+}
+
 func main() {
 	os.Exit(run())
 }
@@ -320,6 +1053,13 @@ func run() int {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
+	defaults, err := loadEnvDefaults(os.Environ())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nox-plugin-provenance: %v\n", err)
+		return 1
+	}
+	envDefaults = defaults
+
 	srv := buildServer()
 	if err := srv.Serve(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "nox-plugin-provenance: %v\n", err)
@@ -2,11 +2,19 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
 	"net"
+	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	corefindings "github.com/nox-hq/nox/core/findings"
 	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
 	"github.com/nox-hq/nox/registry"
 	"github.com/nox-hq/nox/sdk"
@@ -45,9 +53,13 @@ func TestScanWithoutProvenanceFlagsMissingAttestation(t *testing.T) {
 		t.Fatal("expected at least one PROV-001 (missing attestation) finding")
 	}
 
+	// Neither config publishes anything, so the finding is downgraded.
 	for _, f := range found {
-		if f.GetSeverity() != sdk.SeverityHigh {
-			t.Errorf("PROV-001 severity should be HIGH, got %v", f.GetSeverity())
+		if f.GetSeverity() != sdk.SeverityMedium {
+			t.Errorf("PROV-001 severity should be MEDIUM, got %v", f.GetSeverity())
+		}
+		if got := f.GetMetadata()["publication"]; got != publicationNone {
+			t.Errorf("publication = %q, want %q", got, publicationNone)
 		}
 	}
 }
@@ -72,6 +84,131 @@ func TestScanIncompleteProvenanceMetadata(t *testing.T) {
 	}
 }
 
+func TestScanSkipsNonAttestationJSON(t *testing.T) {
+	client := testClient(t)
+	resp := invokeScan(t, client, filepath.Join(testdataDir(t), "webauthn-fixture"))
+
+	if findings := withoutSummary(resp.GetFindings()); len(findings) != 0 {
+		t.Errorf("expected a WebAuthn attestation.json to scan clean, got %d findings", len(findings))
+	}
+	summary := findByRule(resp.GetFindings(), summaryRuleID)
+	if got := summary[0].GetMetadata()["non_attestation_files"]; got != "1" {
+		t.Errorf("non_attestation_files = %q, want 1", got)
+	}
+}
+
+func TestScanNonAttestationJSONDoesNotCountAsProvenance(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tgo build .\n")
+	writeFile(t, filepath.Join(workspace, "provenance.json"), `{"name":"fixture","version":"1.0.0"}`)
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	if len(findByRule(resp.GetFindings(), "PROV-001")) != 1 {
+		t.Error("expected PROV-001 when the only provenance-named file is not an attestation")
+	}
+	if len(findByRule(resp.GetFindings(), "PROV-002")) != 0 {
+		t.Error("expected no PROV-002 for a file that is not an attestation")
+	}
+}
+
+func TestScanAttestationsDirectoryLayout(t *testing.T) {
+	client := testClient(t)
+	workspace := filepath.Join(testdataDir(t), "attestations-layout")
+
+	resp := invokeScan(t, client, workspace)
+	if found := findByRule(resp.GetFindings(), "PROV-001"); len(found) != 0 {
+		t.Errorf("expected no PROV-001 with attestations in attestation directories, got %d", len(found))
+	}
+	if found := findByRule(resp.GetFindings(), "PROV-002"); len(found) != 0 {
+		t.Errorf("expected no PROV-002 for complete attestations, got %d", len(found))
+	}
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["provenance_files_scanned"] != "3" || meta["non_attestation_files"] != "1" {
+		t.Errorf("provenance_files_scanned = %q, non_attestation_files = %q; want 3 and 1",
+			meta["provenance_files_scanned"], meta["non_attestation_files"])
+	}
+
+	resp = invokeScanWithInput(t, client, map[string]any{
+		"workspace_root":  workspace,
+		"provenance_dirs": "slsa",
+	})
+	if found := findByRule(resp.GetFindings(), "PROV-001"); len(found) != 1 {
+		t.Errorf("expected PROV-001 when only slsa/ is a provenance directory, got %d", len(found))
+	}
+}
+
+func TestScanExtraProvenancePatterns(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tgo build .\n")
+	writeFile(t, filepath.Join(workspace, "dist", "app_1.0.0_provenance.json"),
+		subjectStatement("app_1.0.0_linux_amd64.tar.gz", strings.Repeat("ab", 32))+"\n")
+	client := testClient(t)
+
+	if found := findByRule(invokeScan(t, client, workspace).GetFindings(), "PROV-001"); len(found) != 1 {
+		t.Errorf("expected PROV-001 before goreleaser's naming is configured, got %d", len(found))
+	}
+
+	resp := invokeScanWithInput(t, client, map[string]any{
+		"workspace_root":            workspace,
+		"extra_provenance_patterns": "*_provenance.json,.github/attestations/*.sigstore",
+	})
+	if found := findByRule(resp.GetFindings(), "PROV-001"); len(found) != 0 {
+		t.Errorf("expected no PROV-001 with the extra pattern, got %d", len(found))
+	}
+
+	_, err := parseScanOptions(map[string]any{"extra_provenance_patterns": "dist/["})
+	if err == nil || !strings.Contains(err.Error(), "extra_provenance_patterns") {
+		t.Errorf("expected an extra_provenance_patterns error, got %v", err)
+	}
+}
+
+func TestScanLatin1BuildConfig(t *testing.T) {
+	client := testClient(t)
+	resp := invokeScan(t, client, filepath.Join(testdataDir(t), "latin1"))
+
+	if len(findByRule(resp.GetFindings(), "PROV-003")) == 0 {
+		t.Error("expected PROV-003 from the Latin-1 Makefile")
+	}
+	assertValidUTF8(t, resp.GetFindings())
+}
+
+func TestScanInvalidUTF8FileName(t *testing.T) {
+	workspace := t.TempDir()
+	name := "r\xe9lease.intoto.jsonl"
+	if err := os.WriteFile(filepath.Join(workspace, name), []byte(`{"_type":"https://in-toto.io/Statement/v0.1","subject":[]}`), 0o644); err != nil {
+		t.Skipf("filesystem rejects non-UTF-8 names: %v", err)
+	}
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	found := findByRule(resp.GetFindings(), "PROV-002")
+	if len(found) == 0 {
+		t.Fatal("expected PROV-002 for the statement in the non-UTF-8 file")
+	}
+	if got, want := found[0].GetLocation().GetFilePath(), "r\uFFFDlease.intoto.jsonl"; got != want {
+		t.Errorf("location = %q, want %q", got, want)
+	}
+	assertValidUTF8(t, resp.GetFindings())
+}
+
+// assertValidUTF8 fails the test if any string the host would serialize is
+// not valid UTF-8.
+func assertValidUTF8(t *testing.T, findings []*pluginv1.Finding) {
+	t.Helper()
+	for _, f := range findings {
+		strs := []string{f.GetRuleId(), f.GetMessage(), f.GetLocation().GetFilePath()}
+		for k, v := range f.GetMetadata() {
+			strs = append(strs, k, v)
+		}
+		for _, s := range strs {
+			if !utf8.ValidString(s) {
+				t.Errorf("%s finding carries invalid UTF-8 %q", f.GetRuleId(), s)
+			}
+		}
+	}
+}
+
 func TestScanReproducibilityRisk(t *testing.T) {
 	client := testClient(t)
 	resp := invokeScan(t, client, filepath.Join(testdataDir(t), "without-provenance"))
@@ -95,8 +232,66 @@ func TestScanEmptyWorkspace(t *testing.T) {
 	client := testClient(t)
 	resp := invokeScan(t, client, t.TempDir())
 
-	if len(resp.GetFindings()) != 0 {
-		t.Errorf("expected zero findings for empty workspace, got %d", len(resp.GetFindings()))
+	findings := withoutSummary(resp.GetFindings())
+	if len(findings) != 0 {
+		t.Errorf("expected zero findings for empty workspace, got %d", len(findings))
+	}
+
+	summary := findByRule(resp.GetFindings(), summaryRuleID)
+	if len(summary) != 1 {
+		t.Fatalf("expected exactly one %s summary finding, got %d", summaryRuleID, len(summary))
+	}
+	if got := summary[0].GetMetadata()["files_walked"]; got != "0" {
+		t.Errorf("files_walked = %q, want %q", got, "0")
+	}
+}
+
+func TestScanSummaryMetadata(t *testing.T) {
+	client := testClient(t)
+
+	tests := []struct {
+		fixture string
+		expect  map[string]string
+	}{
+		{"without-provenance", map[string]string{
+			"files_walked":               "2",
+			"provenance_files_scanned":   "0",
+			"build_config_files_scanned": "2",
+			"ci_config_files_scanned":    "0",
+			"statements_parsed":          "0",
+			"parse_failures":             "0",
+			"walk_errors":                "0",
+			"partial":                    "false",
+		}},
+		{"with-provenance", map[string]string{
+			"files_walked":             "2",
+			"provenance_files_scanned": "1",
+			"statements_parsed":        "1",
+			"parse_failures":           "0",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			resp := invokeScan(t, client, filepath.Join(testdataDir(t), tt.fixture))
+
+			summary := findByRule(resp.GetFindings(), summaryRuleID)
+			if len(summary) != 1 {
+				t.Fatalf("expected exactly one %s summary finding, got %d", summaryRuleID, len(summary))
+			}
+			if summary[0].GetSeverity() != sdk.SeverityInfo {
+				t.Errorf("%s severity should be INFO, got %v", summaryRuleID, summary[0].GetSeverity())
+			}
+			meta := summary[0].GetMetadata()
+			for key, want := range tt.expect {
+				if got := meta[key]; got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+			if meta["elapsed_ms"] == "" {
+				t.Error("summary should include elapsed_ms")
+			}
+		})
 	}
 }
 
@@ -120,33 +315,346 @@ func TestScanNoWorkspace(t *testing.T) {
 	}
 }
 
-func TestIsProvenanceFile(t *testing.T) {
+func TestScanFailOnSeverityGate(t *testing.T) {
+	client := testClient(t)
+	workspace := filepath.Join(testdataDir(t), "without-provenance")
+
 	tests := []struct {
-		name   string
-		expect bool
+		threshold  string
+		status     string
+		violations string
 	}{
-		{"build.intoto.jsonl", true},
-		{"app.intoto.json", true},
-		{"provenance.json", true},
-		{"attestation.json", true},
-		{"release.att.json", true},
-		{"package.json", false},
-		{"main.go", false},
-		{"Makefile", false},
+		{"critical", "passed", "0"},
+		{"high", "passed", "0"},
+		{"medium", "failed", "5"},
+		{"LOW", "failed", "7"},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := isProvenanceFile(tt.name)
-			if got != tt.expect {
-				t.Errorf("isProvenanceFile(%q) = %v, want %v", tt.name, got, tt.expect)
+		t.Run(tt.threshold, func(t *testing.T) {
+			resp := invokeScanWithInput(t, client, map[string]any{
+				"workspace_root":   workspace,
+				"fail_on_severity": tt.threshold,
+			})
+
+			if len(findByRule(resp.GetFindings(), "PROV-001")) == 0 {
+				t.Error("gated scan must still return all findings")
+			}
+			summary := findByRule(resp.GetFindings(), summaryRuleID)
+			if len(summary) != 1 {
+				t.Fatalf("expected exactly one %s summary finding, got %d", summaryRuleID, len(summary))
+			}
+			meta := summary[0].GetMetadata()
+			if meta["gate_status"] != tt.status {
+				t.Errorf("gate_status = %q, want %q", meta["gate_status"], tt.status)
+			}
+			if meta["gate_violations"] != tt.violations {
+				t.Errorf("gate_violations = %q, want %q", meta["gate_violations"], tt.violations)
 			}
 		})
 	}
 }
 
+func TestScanGateHonorsSuppressions(t *testing.T) {
+	client := testClient(t)
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), strings.Join([]string{
+		"# nox:ignore PROV-003 -- tracked by the base image policy",
+		"FROM alpine:latest",
+		"FROM node:latest",
+		"FROM golang:latest",
+	}, "\n")+"\n")
+
+	var unsuppressed int
+	var node *pluginv1.Finding
+	for _, f := range invokeScan(t, client, workspace).GetFindings() {
+		if f.GetRuleId() == summaryRuleID || severityRank[f.GetSeverity()] < severityRank[sdk.SeverityMedium] {
+			continue
+		}
+		unsuppressed++
+		if f.GetRuleId() == "PROV-003" && f.GetLocation().GetStartLine() == 3 {
+			node = f
+		}
+	}
+	if node == nil {
+		t.Fatal("expected a PROV-003 finding for node:latest")
+	}
+	fingerprint := corefindings.ComputeFingerprint(node.GetRuleId(), corefindings.Location{FilePath: node.GetLocation().GetFilePath(), StartLine: 3}, node.GetMessage())
+	writeFile(t, filepath.Join(workspace, ".nox", "baseline.json"), `{"schema_version": "1.0.0", "entries": [{"fingerprint": "`+fingerprint+`", "rule_id": "PROV-003"}]}`)
+
+	resp := invokeScanWithInput(t, client, map[string]any{"workspace_root": workspace, "fail_on_severity": "medium"})
+	var latest int
+	for _, f := range resp.GetFindings() {
+		if f.GetRuleId() == "PROV-003" {
+			latest++
+		}
+	}
+	if latest != 3 {
+		t.Errorf("expected every PROV-003 finding to be returned, got %d", latest)
+	}
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["gate_suppressed"] != "2" || meta["gate_violations"] != fmt.Sprint(unsuppressed-2) {
+		t.Errorf("gate_suppressed = %q, gate_violations = %q; want 2 and %d", meta["gate_suppressed"], meta["gate_violations"], unsuppressed-2)
+	}
+}
+
+func TestScanWithoutGateOmitsGateMetadata(t *testing.T) {
+	client := testClient(t)
+	resp := invokeScan(t, client, filepath.Join(testdataDir(t), "without-provenance"))
+
+	summary := findByRule(resp.GetFindings(), summaryRuleID)
+	if len(summary) != 1 {
+		t.Fatalf("expected exactly one %s summary finding, got %d", summaryRuleID, len(summary))
+	}
+	if _, ok := summary[0].GetMetadata()["gate_status"]; ok {
+		t.Error("gate_status should be absent when fail_on_severity is not set")
+	}
+}
+
+func TestScanInvalidFailOnSeverity(t *testing.T) {
+	client := testClient(t)
+
+	input, err := structpb.NewStruct(map[string]any{
+		"workspace_root":   t.TempDir(),
+		"fail_on_severity": "severe",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.InvokeTool(context.Background(), &pluginv1.InvokeToolRequest{
+		ToolName: "scan",
+		Input:    input,
+	})
+	if err == nil {
+		t.Fatal("expected an error for an invalid fail_on_severity value")
+	}
+}
+
+func TestScanConcurrencyIsDeterministic(t *testing.T) {
+	workspace := generateWorkspace(t, 20, 20)
+	client := testClient(t)
+
+	serial := invokeScanWithInput(t, client, map[string]any{"workspace_root": workspace, "concurrency": 1})
+	concurrent := invokeScanWithInput(t, client, map[string]any{"workspace_root": workspace, "concurrency": 8})
+
+	a, b := withoutSummary(serial.GetFindings()), withoutSummary(concurrent.GetFindings())
+	if len(a) != len(b) {
+		t.Fatalf("serial scan produced %d findings, concurrent scan %d", len(a), len(b))
+	}
+	for i := range a {
+		if a[i].GetRuleId() != b[i].GetRuleId() ||
+			a[i].GetLocation().GetFilePath() != b[i].GetLocation().GetFilePath() ||
+			a[i].GetLocation().GetStartLine() != b[i].GetLocation().GetStartLine() {
+			t.Fatalf("finding %d differs between serial and concurrent scans", i)
+		}
+	}
+}
+
+func TestScanOrderIsIndependentOfWalkOrder(t *testing.T) {
+	workspace := generateWorkspace(t, 10, 10)
+	writeFile(t, filepath.Join(workspace, "attestation.intoto.jsonl"), testStatement+"\n{\"_type\":\"x\"}\n{\"_type\":\"y\"}\n")
+	client := testClient(t)
+
+	scan := func(seed int64) []string {
+		rng := rand.New(rand.NewSource(seed))
+		reorderFindings = func(items []*finding) {
+			rng.Shuffle(len(items), func(i, j int) { items[i], items[j] = items[j], items[i] })
+		}
+		defer func() { reorderFindings = nil }()
+
+		resp := invokeScanWithInput(t, client, map[string]any{"workspace_root": workspace, "concurrency": 4})
+		var out []string
+		for _, f := range withoutSummary(resp.GetFindings()) {
+			out = append(out, fmt.Sprint(f.GetRuleId(), f.GetLocation().GetFilePath(),
+				f.GetLocation().GetStartLine(), f.GetLocation().GetEndLine(), f.GetMessage(), f.GetMetadata()))
+		}
+		return out
+	}
+
+	first, second := scan(1), scan(2)
+	if len(first) == 0 {
+		t.Fatal("expected findings from the generated workspace")
+	}
+	if strings.Join(first, "\n") != strings.Join(second, "\n") {
+		t.Error("finding order changed between scans with different walk orders")
+	}
+}
+
+func TestScanInvalidConcurrency(t *testing.T) {
+	client := testClient(t)
+
+	input, err := structpb.NewStruct(map[string]any{
+		"workspace_root": t.TempDir(),
+		"concurrency":    0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.InvokeTool(context.Background(), &pluginv1.InvokeToolRequest{
+		ToolName: "scan",
+		Input:    input,
+	})
+	if err == nil {
+		t.Fatal("expected an error for concurrency below 1")
+	}
+}
+
+func TestScanCancellationStopsMidFile(t *testing.T) {
+	workspace := t.TempDir()
+
+	var large strings.Builder
+	for large.Len() < 12<<20 {
+		large.WriteString("RUN echo step && curl -sSL https://example.com/install.sh | sh\n")
+	}
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), large.String())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	resp, err := handleScan(ctx, sdk.ToolRequest{Input: map[string]any{"workspace_root": workspace}})
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("cancelled scan should return partial results, got error: %v", err)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("cancelled scan took %v, expected it to stop promptly", elapsed)
+	}
+	found := findByRule(resp.GetFindings(), "PROV-003")
+	if len(found) == 0 {
+		t.Error("expected findings collected before cancellation to be preserved")
+	}
+	lines := strings.Count(large.String(), "\n")
+	if len(found) >= lines {
+		t.Errorf("expected the scan to stop before the end of the file, got %d findings for %d lines", len(found), lines)
+	}
+}
+
+func TestScanDeadlineReturnsPartialResults(t *testing.T) {
+	workspace := generateWorkspace(t, 500, 2000)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	resp, err := handleScan(ctx, sdk.ToolRequest{Input: map[string]any{"workspace_root": workspace}})
+	if err != nil {
+		t.Fatalf("expected partial results on deadline expiry, got error: %v", err)
+	}
+	if len(findByRule(resp.GetFindings(), "PROV-003")) == 0 {
+		t.Error("expected findings collected before the deadline")
+	}
+
+	summary := findByRule(resp.GetFindings(), summaryRuleID)
+	if len(summary) != 1 {
+		t.Fatalf("expected exactly one %s summary finding, got %d", summaryRuleID, len(summary))
+	}
+	meta := summary[0].GetMetadata()
+	if meta["partial"] != "true" || meta["partial_reason"] != "deadline_exceeded" {
+		t.Errorf("partial = %q, partial_reason = %q; want true, deadline_exceeded", meta["partial"], meta["partial_reason"])
+	}
+	if meta["walked_through"] == "" {
+		t.Error("expected walked_through to record how far the walk got")
+	}
+}
+
+func TestContainsFoldASCII(t *testing.T) {
+	tests := []struct {
+		s, substr string
+		want      bool
+	}{
+		{"RUN curl -sSL x | sh", "curl", true},
+		{"RUN CURL -sSL x | sh", "curl", true},
+		{"FROM alpine:Latest", "latest", true},
+		{"FROM alpine:3.19", "latest", false},
+		{"cur", "curl", false},
+		{"", "date", false},
+	}
+	for _, tt := range tests {
+		if got := containsFoldASCII(tt.s, tt.substr); got != tt.want {
+			t.Errorf("containsFoldASCII(%q, %q) = %v, want %v", tt.s, tt.substr, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkScanBuildFileLines(b *testing.B) {
+	lines := []string{
+		"FROM golang:1.22 AS build",
+		"WORKDIR /src",
+		"COPY go.mod go.sum ./",
+		"RUN go mod download",
+		"COPY . .",
+		"RUN CGO_ENABLED=0 go build -trimpath -o /out/app ./cmd/app",
+		"ENV PATH=/usr/local/bin:$PATH",
+		"RUN curl -sSL https://example.com/install.sh | sh",
+	}
+	var content strings.Builder
+	for i := 0; i < 5000; i++ {
+		content.WriteString(lines[i%len(lines)])
+		content.WriteString("\n")
+	}
+	path := filepath.Join(b.TempDir(), "Dockerfile")
+	writeFile(b, path, content.String())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := scanBuildFileForReproducibility(context.Background(), &findingSet{}, path, commandOrigin{}, provenancePolicy{}, &scanSummary{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScanSerial(b *testing.B) {
+	benchmarkScan(b, 1)
+}
+
+func BenchmarkScanConcurrent(b *testing.B) {
+	benchmarkScan(b, runtime.GOMAXPROCS(0))
+}
+
+func benchmarkScan(b *testing.B, concurrency int) {
+	workspace := generateWorkspace(b, 200, 200)
+	req := sdk.ToolRequest{Input: map[string]any{
+		"workspace_root": workspace,
+		"concurrency":    float64(concurrency),
+	}}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := handleScan(context.Background(), req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 // --- helpers ---
 
+// generateWorkspace creates a tree of dirs service directories, each holding
+// a Dockerfile of roughly lines lines (every tenth one a reproducibility
+// risk) and an incomplete provenance file.
+func generateWorkspace(tb testing.TB, dirs, lines int) string {
+	tb.Helper()
+	root := tb.TempDir()
+
+	var dockerfile strings.Builder
+	for i := 0; i < lines; i++ {
+		if i%10 == 0 {
+			dockerfile.WriteString("RUN curl -sSL https://example.com/install.sh | sh\n")
+		} else {
+			dockerfile.WriteString("RUN echo building step\n")
+		}
+	}
+
+	for i := 0; i < dirs; i++ {
+		dir := filepath.Join(root, "services", fmt.Sprintf("svc-%03d", i))
+		writeFile(tb, filepath.Join(dir, "Dockerfile"), dockerfile.String())
+		writeFile(tb, filepath.Join(dir, "provenance.json"), `{"subject":[]}`)
+	}
+	return root
+}
+
 func testdataDir(t *testing.T) string {
 	t.Helper()
 	_, filename, _, ok := runtime.Caller(0)
@@ -184,23 +692,74 @@ func testClient(t *testing.T) pluginv1.PluginServiceClient {
 
 func invokeScan(t *testing.T, client pluginv1.PluginServiceClient, workspaceRoot string) *pluginv1.InvokeToolResponse {
 	t.Helper()
-	input, err := structpb.NewStruct(map[string]any{
+	return invokeScanWithInput(t, client, map[string]any{
 		"workspace_root": workspaceRoot,
 	})
+}
+
+func invokeScanWithInput(t *testing.T, client pluginv1.PluginServiceClient, fields map[string]any) *pluginv1.InvokeToolResponse {
+	t.Helper()
+	return invokeTool(t, client, "scan", fields)
+}
+
+func invokeTool(t *testing.T, client pluginv1.PluginServiceClient, tool string, fields map[string]any) *pluginv1.InvokeToolResponse {
+	t.Helper()
+	return invokeToolInWorkspace(t, client, tool, "", fields)
+}
+
+func invokeToolInWorkspace(t *testing.T, client pluginv1.PluginServiceClient, tool, workspaceRoot string, fields map[string]any) *pluginv1.InvokeToolResponse {
+	t.Helper()
+	input, err := structpb.NewStruct(fields)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	resp, err := client.InvokeTool(context.Background(), &pluginv1.InvokeToolRequest{
-		ToolName: "scan",
-		Input:    input,
+		ToolName:      tool,
+		Input:         input,
+		WorkspaceRoot: workspaceRoot,
 	})
 	if err != nil {
-		t.Fatalf("InvokeTool(scan): %v", err)
+		t.Fatalf("InvokeTool(%s): %v", tool, err)
+	}
+	if tool != "rules" {
+		checkCatalog(t, resp.GetFindings())
 	}
 	return resp
 }
 
+// checkCatalog fails the test if a finding's rule, severity, or confidence is
+// missing from the rule catalog, or it lacks its rule's category.
+func checkCatalog(t *testing.T, findings []*pluginv1.Finding) {
+	t.Helper()
+	for _, f := range findings {
+		rule, ok := lookupRule(f.GetRuleId())
+		if !ok {
+			t.Errorf("rule %s is emitted but missing from the rule catalog", f.GetRuleId())
+			continue
+		}
+		if !slices.Contains(rule.severities, f.GetSeverity()) {
+			t.Errorf("rule %s is emitted at severity %v, which the catalog does not list", rule.id, f.GetSeverity())
+		}
+		if !slices.Contains(rule.confidences, f.GetConfidence()) {
+			t.Errorf("rule %s is emitted at confidence %v, which the catalog does not list", rule.id, f.GetConfidence())
+		}
+		if got := f.GetMetadata()["category"]; got != rule.category {
+			t.Errorf("rule %s finding has category %q, want %q", rule.id, got, rule.category)
+		}
+	}
+}
+
+func withoutSummary(findings []*pluginv1.Finding) []*pluginv1.Finding {
+	var result []*pluginv1.Finding
+	for _, f := range findings {
+		if f.GetRuleId() != summaryRuleID {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
 func findByRule(findings []*pluginv1.Finding, ruleID string) []*pluginv1.Finding {
 	var result []*pluginv1.Finding
 	for _, f := range findings {
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// maxIncludeDepth bounds how deep Makefile includes are followed.
+const maxIncludeDepth = 5
+
+// makeInclude matches a Makefile include directive, captures whether it is
+// optional (-include or sinclude), and its file list.
+var makeInclude = regexp.MustCompile(`^(-|s)?include\s+(.+)$`)
+
+// recordMakeIncludes records the files an include directive of a Makefile
+// pulls in, for following as Makefiles. make resolves them against its
+// working directory, which the includer shares, and remakes missing ones
+// from rules, so a missing include is not reported. Files named by
+// variables or globs cannot be resolved and are skipped, as are includes
+// nested beyond maxIncludeDepth.
+func (s *scanSummary) recordMakeIncludes(root, from string, lineNum int, directive string, origin commandOrigin) {
+	m := makeInclude.FindStringSubmatch(directive)
+	if m == nil || origin.depth >= maxIncludeDepth {
+		return
+	}
+	value, _, _ := strings.Cut(m[2], "#")
+	for _, file := range strings.Fields(value) {
+		if !resolvable(file) {
+			continue
+		}
+		s.scriptRefs = append(s.scriptRefs, scriptRef{
+			from:       from,
+			line:       lineNum,
+			invokedBy:  workspacePath(root, from),
+			script:     path.Clean(file),
+			dir:        origin.dir,
+			fromScript: true,
+			format:     formatMakefile,
+			include:    true,
+			depth:      origin.depth + 1,
+		})
+	}
+}
+
+// Kinds of Makefile target, by what their recipes are for.
+const (
+	// targetArtifact targets produce the files a release ships.
+	targetArtifact = "artifact"
+	// targetMaintenance targets test or clean up and ship nothing.
+	targetMaintenance = "maintenance"
+)
+
+// artifactDirs are the output directories whose files artifact targets
+// produce.
+var artifactDirs = []string{"dist", "build"}
+
+// cleanSectionWords mark Makefile targets that remove build outputs.
+var cleanSectionWords = map[string]bool{"clean": true, "distclean": true, "mostlyclean": true, "realclean": true}
+
+// makeTargetKind classifies a Makefile target from its name: targets under
+// or named after an output directory, such as dist/app or a phony dist, and
+// targets named like the repository, such as bin/app, are artifact targets;
+// test and clean targets are maintenance. Other targets are unclassified.
+func makeTargetKind(target, repository string) string {
+	if target == "" {
+		return ""
+	}
+	if isTestSection(target) {
+		return targetMaintenance
+	}
+	for _, word := range strings.FieldsFunc(strings.ToLower(target), func(r rune) bool {
+		return r == '-' || r == '_' || r == '.'
+	}) {
+		if cleanSectionWords[word] {
+			return targetMaintenance
+		}
+	}
+	clean := path.Clean(strings.TrimPrefix(target, "./"))
+	for _, dir := range artifactDirs {
+		if clean == dir || strings.HasPrefix(clean, dir+"/") {
+			return targetArtifact
+		}
+	}
+	if repository != "" && strings.EqualFold(path.Base(clean), repository) {
+		return targetArtifact
+	}
+	return ""
+}
+
+// recipeConfidence returns the confidence of a finding in a recipe of a
+// target of the given kind: maintenance recipes ship nothing, so their
+// findings drop a level.
+func recipeConfidence(lc lineContext, kind string) pluginv1.Confidence {
+	if lc == contextRecipe && kind == targetMaintenance {
+		return sdk.ConfidenceMedium
+	}
+	return lc.confidence()
+}
+
+// workspaceName returns the base name of the workspace, which artifact
+// targets are named after.
+func workspaceName(root string) string {
+	name := filepath.Base(root)
+	if name == "." || name == string(filepath.Separator) {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMakeTargetKind(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"dist/app", targetArtifact},
+		{"./build/%.o", targetArtifact},
+		{"dist", targetArtifact},
+		{"bin/myapp", targetArtifact},
+		{"myapp", targetArtifact},
+		{"distclean", targetMaintenance},
+		{"clean-docker", targetMaintenance},
+		{"unit-tests", targetMaintenance},
+		{"builder", ""},
+		{"install", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := makeTargetKind(tt.target, "myapp"); got != tt.want {
+			t.Errorf("makeTargetKind(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestScanMakefileIncludes(t *testing.T) {
+	workspace := filepath.Join(t.TempDir(), "myapp")
+	writeFile(t, filepath.Join(workspace, "Makefile"), strings.Join([]string{
+		"include build/common.mk # shared rules",
+		"-include local.mk $(DEPS)",
+		"all: dist/app",
+		"\t$(MAKE) -C docs -f docs.mk html",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, "build", "common.mk"), strings.Join([]string{
+		"include build/go.mk",
+		"dist/app:",
+		"\tgo build -o $@ -ldflags \"-X main.date=$$(date +%s)\"",
+		"clean:",
+		"\trm -rf dist # date",
+		"\ttouch -d \"$$(date)\" .stamp",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, "build", "go.mk"), "myapp:\n\tcurl -sSL https://example.com/install | sh\n")
+	writeFile(t, filepath.Join(workspace, "docs", "docs.mk"), "html:\n\tcurl -sSL https://example.com/x | sh\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	type want struct {
+		includedBy, invokedBy, kind, confidence string
+	}
+	wants := map[string]want{
+		"build/common.mk:3": {"Makefile", "", targetArtifact, "high"},
+		"build/common.mk:6": {"Makefile", "", targetMaintenance, "medium"},
+		"build/go.mk:2":     {"build/common.mk", "", targetArtifact, "high"},
+		"docs/docs.mk:2":    {"", "Makefile#all", "", "high"},
+	}
+	seen := make(map[string]bool)
+	for _, f := range findByRule(resp.GetFindings(), "PROV-003") {
+		key := fmt.Sprintf("%s:%d", f.GetLocation().GetFilePath(), f.GetLocation().GetStartLine())
+		w, ok := wants[key]
+		if !ok {
+			continue
+		}
+		seen[key] = true
+		meta := f.GetMetadata()
+		if meta["included_by"] != w.includedBy || meta["invoked_by"] != w.invokedBy {
+			t.Errorf("%s: included_by = %q, invoked_by = %q, want %q and %q", key, meta["included_by"], meta["invoked_by"], w.includedBy, w.invokedBy)
+		}
+		if meta["target_kind"] != w.kind {
+			t.Errorf("%s: target_kind = %q, want %q", key, meta["target_kind"], w.kind)
+		}
+		if got := confidenceNames[f.GetConfidence()]; got != w.confidence {
+			t.Errorf("%s: confidence %s, want %s", key, got, w.confidence)
+		}
+	}
+	for key := range wants {
+		if !seen[key] {
+			t.Errorf("expected PROV-003 at %s", key)
+		}
+	}
+	if missing := findByRule(resp.GetFindings(), missingScriptRuleID); len(missing) != 0 {
+		t.Errorf("a missing -include is remade by make, got %d %s findings", len(missing), missingScriptRuleID)
+	}
+}
+
+func TestScanMakefileIncludeDepth(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), "include mk/1.mk\n")
+	for i := 1; i <= maxIncludeDepth+2; i++ {
+		writeFile(t, filepath.Join(workspace, "mk", fmt.Sprintf("%d.mk", i)),
+			fmt.Sprintf("include mk/%d.mk\nstep%d:\n\tcurl -sSL https://example.com/x | sh\n", i+1, i))
+	}
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	scanned := make(map[string]bool)
+	for _, f := range findByRule(resp.GetFindings(), "PROV-003") {
+		scanned[f.GetLocation().GetFilePath()] = true
+	}
+	if len(scanned) != maxIncludeDepth {
+		t.Errorf("expected includes followed %d deep, scanned %v", maxIncludeDepth, scanned)
+	}
+	if scanned[fmt.Sprintf("mk/%d.mk", maxIncludeDepth+1)] {
+		t.Errorf("include beyond depth %d was followed", maxIncludeDepth)
+	}
+}
@@ -0,0 +1,609 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// matrixAttestationRuleID flags a release workflow whose matrix job
+// publishes one artifact per leg while its attestation covers at most one.
+const matrixAttestationRuleID = "PROV-029"
+
+// Where the attestation of a matrix job's artifacts was found, when it does
+// not cover every leg.
+const (
+	attestationMissing        = "missing"
+	attestationUnrelatedJob   = "unrelated_job"
+	attestationNoDownload     = "fan_in_without_download"
+	attestationSingleArtifact = "fan_in_single_artifact"
+	attestationMatrixOutputs  = "matrix_outputs"
+)
+
+var (
+	// releaseActions upload their inputs to a GitHub release.
+	releaseActions = map[string]bool{"softprops/action-gh-release": true, "svenstaro/upload-release-action": true, "ncipollo/release-action": true}
+	// needsOutputs matches an expression reading another job's outputs.
+	needsOutputs = regexp.MustCompile(`needs\.([A-Za-z0-9_-]+)\.outputs`)
+	// flowMatrixKey matches a dimension of an inline matrix mapping.
+	flowMatrixKey = regexp.MustCompile(`([A-Za-z0-9_-]+)\s*:\s*\[`)
+)
+
+// actionName returns an action reference without its ref.
+func actionName(ref string) string {
+	name, _, _ := strings.Cut(ref, "@")
+	return strings.ToLower(name)
+}
+
+// isAttestationAction reports whether a step or reusable workflow
+// reference generates provenance or signs artifacts.
+func isAttestationAction(ref string) bool {
+	switch name := actionName(ref); {
+	case name == "actions/attest-build-provenance" || name == "actions/attest":
+		return true
+	case strings.HasPrefix(name, "slsa-framework/slsa-github-generator/"):
+		return true
+	case name == "sigstore/gh-action-sigstore-python":
+		return true
+	}
+	return false
+}
+
+// workflowJob is a job of a GitHub workflow, as far as the matrix
+// attestation check needs it.
+type workflowJob struct {
+	name string
+	// childIndent is the indentation of the job's own keys, -1 until read.
+	childIndent int
+	childKey    string
+
+	// dimensions are the matrix keys, or "dynamic" for a matrix built by an
+	// expression; matrixLine is where the matrix is declared.
+	dimensions   []string
+	matrixLine   int
+	matrixIndent int
+	dimIndent    int
+
+	needs []string
+	// produces is set when a step uploads or publishes artifacts.
+	produces bool
+	// attestLine and attestStep locate the first attestation or signing
+	// step, zero if the job has none; attestations lists them all.
+	attestLine   int
+	attestStep   string
+	attestations []stepRef
+	// downloadsAll is set when a download-artifact step fetches every
+	// artifact or a pattern; singleDownloads names the artifacts fetched by
+	// name.
+	downloadsAll    bool
+	singleDownloads []string
+	// uploads and downloads are the job's upload-artifact and
+	// download-artifact steps, and attestsOutputDigest is set when an
+	// attestation step takes its subject digest from another job's outputs.
+	uploads             []artifactStep
+	downloads           []artifactStep
+	attestsOutputDigest bool
+	// verifyLines are the lines of run commands that check checksums or
+	// verify signatures, including an echo piped into a checksum check.
+	verifyLines []int
+	// readsOutputs holds the jobs whose outputs the job reads.
+	readsOutputs map[string]bool
+
+	// permissions is set when the job declares its own permissions, and
+	// idToken when they grant id-token: write.
+	permissions bool
+	idToken     bool
+	// uses are the actions and reusable workflows the job references.
+	uses []actionUse
+	// caches are the job's cache steps and commands its run commands, in
+	// order.
+	caches   []cacheStep
+	commands []workflowCommand
+	// releaseUploads are the job's release action steps, and buildArgs its
+	// docker/build-push-action steps.
+	releaseUploads []releaseUpload
+	buildArgs      []buildArgStep
+	// publishes is set when a step publishes artifacts, beyond uploading
+	// them to the run; publishRefs are the publish commands other than
+	// container pushes. checkouts are the job's checkouts, in order.
+	publishes   bool
+	publishRefs []stepRef
+	checkouts   []checkoutRef
+	// signs are the job's gpg and minisign file signatures, and
+	// signedWrites its commands writing provenance or checksum files, read
+	// by shell with its variables.
+	signs        []stepRef
+	signedWrites []signedFileWrite
+	shell        *shellParser
+
+	// step is the open action step whose inputs are being read, if any.
+	step *workflowStep
+}
+
+// actionUse is a uses: reference of a workflow job.
+type actionUse struct {
+	line int
+	ref  string
+}
+
+// workflowCommand is a run command of a workflow job.
+type workflowCommand struct {
+	line    int
+	command string
+}
+
+// workflowStep is an action step whose with: inputs the checks read.
+type workflowStep struct {
+	action string
+	line   int
+	// indent is the indentation of the step's list item.
+	indent int
+	inputs map[string]string
+	// blockKey is the input whose block scalar value is being read, below
+	// its key at blockIndent.
+	blockKey    string
+	blockIndent int
+}
+
+// openStep starts reading the inputs of an action step, given its uses:
+// line.
+func (j *workflowJob) openStep(action, trimmed string, indent, lineNum int) {
+	j.closeStep()
+	if !strings.HasPrefix(trimmed, "- ") {
+		indent -= 2
+	}
+	j.step = &workflowStep{action: action, line: lineNum, indent: indent, inputs: make(map[string]string)}
+}
+
+// trackInput reads a line of the open step.
+func (s *workflowStep) trackInput(trimmed string, indent int) {
+	if s.blockKey != "" && indent > s.blockIndent {
+		s.inputs[s.blockKey] += trimmed + "\n"
+		return
+	}
+	s.blockKey = ""
+	// Keys at the step's own level, such as name and if, are not inputs.
+	key := yamlKey.FindStringSubmatch(trimmed)
+	if key == nil || indent <= s.indent+2 {
+		return
+	}
+	value := yamlScalar(strings.TrimSpace(trimmed[len(key[0]):]))
+	if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+		s.blockKey, s.blockIndent, value = key[1], indent, ""
+	}
+	s.inputs[key[1]] = value
+}
+
+// closeStep records the action step being read, if any.
+func (j *workflowJob) closeStep() {
+	s := j.step
+	if s == nil {
+		return
+	}
+	j.step = nil
+	if isAttestationAction(s.action) {
+		if needsOutputs.MatchString(s.inputs["subject-digest"]) {
+			j.attestsOutputDigest = true
+		}
+		return
+	}
+	if s.action == "actions/upload-artifact" {
+		name := s.inputs["name"]
+		if name == "" {
+			name = "artifact"
+		}
+		j.uploads = append(j.uploads, artifactStep{line: s.line, name: name})
+		return
+	}
+	if s.action == "actions/checkout" {
+		j.checkouts = append(j.checkouts, checkoutRef{line: s.line, ref: s.inputs["ref"]})
+		return
+	}
+	if releaseActions[s.action] {
+		j.releaseUploads = append(j.releaseUploads, newReleaseUpload(s))
+		return
+	}
+	if s.action == "docker/build-push-action" {
+		j.buildArgs = append(j.buildArgs, buildArgStep{line: s.line, args: inputList(s.inputs["build-args"])})
+		return
+	}
+	if s.action != "actions/download-artifact" {
+		j.caches = append(j.caches, newCacheStep(s))
+		return
+	}
+	name := s.inputs["name"]
+	if name != "" && s.inputs["pattern"] == "" && !strings.Contains(name, "${{") {
+		j.singleDownloads = append(j.singleDownloads, name)
+	} else {
+		j.downloadsAll, name = true, ""
+	}
+	j.downloads = append(j.downloads, artifactStep{line: s.line, name: name})
+}
+
+// isGitHubWorkflow reports whether a workspace-relative slash path is a
+// GitHub Actions workflow.
+func isGitHubWorkflow(rel string) bool {
+	return strings.HasPrefix(rel, ".github/workflows/") && isYAMLName(strings.ToLower(rel))
+}
+
+// workflowTracker follows the jobs of a GitHub workflow line by line: their
+// matrix dimensions, dependencies, and the steps that produce, download,
+// and attest artifacts.
+type workflowTracker struct {
+	jobs []*workflowJob
+	// release is set when the workflow runs on a release or tag, or any
+	// job publishes artifacts.
+	release bool
+	// prTrigger is the pull request event the workflow runs on, if any,
+	// pull_request_target taking precedence.
+	prTrigger string
+	// idToken is set when the workflow-level permissions grant id-token:
+	// write to jobs without their own.
+	idToken bool
+	// otherTrigger is set when the workflow runs on events besides pull
+	// requests, and compares when a job verifies or compares what it
+	// builds.
+	otherTrigger bool
+	compares     bool
+	// draftRelease is set when a step creates the release as a draft.
+	draftRelease bool
+	// triggers are the events of the on section. triggerIndent is the
+	// indentation of their keys and triggerFilter the filter whose entries
+	// are being read.
+	triggers      []workflowTrigger
+	triggerIndent int
+	triggerFilter string
+	// keySigns are the steps signing with a long-lived key, kmsSigns those
+	// signing with a KMS key, and keyless those signing with the
+	// workflow's identity; keyImport is set when a step imports a gpg key.
+	// keyEnvs are the cosign key variables defined from secrets, which
+	// only stand for a signing step in jobs with no keySigns.
+	keySigns  []keySigning
+	keyEnvs   []keySigning
+	kmsSigns  []stepRef
+	keyless   []stepRef
+	keyImport bool
+}
+
+// close ends the workflow, recording its last open step.
+func (w *workflowTracker) close() {
+	if j := w.current(); j != nil {
+		j.closeStep()
+	}
+}
+
+// finish runs the checks over the whole workflow once it has been read,
+// and records what the workspace checks need from it in the file's
+// summary. Checks of a new workflow are added here.
+func (w *workflowTracker) finish(findings *findingSet, summary *scanSummary, filePath, rel string, policy provenancePolicy) {
+	w.report(findings, filePath)
+	w.reportCaches(findings, filePath)
+	w.reportCheckoutRefs(findings, filePath)
+	w.reportAttestationOrder(findings, filePath)
+	w.reportPostSignWrites(findings, filePath)
+	w.reportHandoffs(findings, filePath)
+	w.reportSigningKeys(findings, filePath)
+	w.reportBuildArgs(findings, filePath)
+	w.reportAllowlist(findings, filePath, policy.actionAllowlist)
+	summary.recordWorkflowCaches(filePath, rel, w)
+	summary.recordDormantCandidate(filePath, w)
+	summary.recordSigningStyles(rel, w)
+}
+
+// current returns the job being read, or nil outside the jobs.
+func (w *workflowTracker) current() *workflowJob {
+	if len(w.jobs) == 0 {
+		return nil
+	}
+	return w.jobs[len(w.jobs)-1]
+}
+
+// track reads the next line of the workflow, given the classifier that has
+// already classified it.
+func (w *workflowTracker) track(line string, lineNum int, lc lineContext, command string, lines *lineClassifier) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || lc == contextComment {
+		return
+	}
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	if lines.inJobs {
+		w.trackSigningLine(trimmed, lineNum, lines.section)
+	} else {
+		w.trackSigningLine(trimmed, lineNum, "")
+	}
+	if !lines.inJobs {
+		switch lines.section {
+		case "on":
+			if strings.Contains(trimmed, "release") || strings.Contains(trimmed, "tags") {
+				w.release = true
+			}
+			if m := prTrigger.FindString(trimmed); m != "" && w.prTrigger != triggerPullRequestTarget {
+				w.prTrigger = m
+			}
+			if nonPRTrigger.MatchString(trimmed) {
+				w.otherTrigger = true
+			}
+			w.trackTrigger(trimmed, indent, lineNum)
+		case "permissions":
+			if idTokenWrite.MatchString(trimmed) || strings.HasSuffix(trimmed, ": write-all") {
+				w.idToken = true
+			}
+		}
+		return
+	}
+	if indent == lines.jobIndent {
+		if j := w.current(); j != nil {
+			j.closeStep()
+		}
+		w.jobs = append(w.jobs, &workflowJob{name: lines.section, childIndent: -1, matrixIndent: -1, readsOutputs: make(map[string]bool)})
+		return
+	}
+	j := w.current()
+	if j == nil || indent < lines.jobIndent {
+		return
+	}
+	if j.childIndent < 0 {
+		j.childIndent = indent
+	}
+
+	for _, m := range needsOutputs.FindAllStringSubmatch(line, -1) {
+		j.readsOutputs[m[1]] = true
+	}
+	if j.step != nil && strings.HasPrefix(trimmed, "- ") && indent <= j.step.indent {
+		j.closeStep()
+	}
+	if (lc == contextRunCommand || lc == contextEcho) && isArtifactCheck(command) {
+		j.verifyLines = append(j.verifyLines, lineNum)
+	}
+	if lc == contextRunCommand {
+		j.commands = append(j.commands, workflowCommand{line: lineNum, command: command})
+		if strings.Contains(command, "cosign") && signingStepPattern.MatchString(command) {
+			j.attest(lineNum, "cosign")
+		}
+		if steps := publishStepsOf("", lineNum, command, isASCII(command)); len(steps) > 0 {
+			j.produces, j.publishes, w.release = true, true, true
+			if draftReleaseCommand.MatchString(command) {
+				w.draftRelease = true
+			}
+			for _, step := range steps {
+				if step.kind != publishContainer {
+					j.publishRefs = append(j.publishRefs, stepRef{line: lineNum, step: step.kind})
+				}
+			}
+		}
+		if strings.Contains(command, "git") && gitCheckoutCommand.MatchString(command) {
+			j.checkouts = append(j.checkouts, checkoutRef{line: lineNum, ref: command, command: true})
+		}
+		if containsAny(command, "verify", "diffoscope", "reprotest", "sha256sum") && (verifyStepPattern.MatchString(command) || rebuildCompare.MatchString(command)) {
+			w.compares = true
+		}
+		return
+	}
+
+	key := yamlKey.FindStringSubmatch(trimmed)
+	if indent == j.childIndent && key != nil {
+		j.closeStep()
+		j.childKey = key[1]
+		value := yamlScalar(strings.TrimSpace(trimmed[len(key[0]):]))
+		switch j.childKey {
+		case "permissions":
+			j.permissions, j.idToken = true, value == "write-all"
+		case "needs":
+			for _, n := range strings.Split(strings.Trim(value, "[]"), ",") {
+				if n = strings.Trim(strings.TrimSpace(n), `"'`); n != "" {
+					j.needs = append(j.needs, n)
+				}
+			}
+		case "uses":
+			// A reusable workflow such as the SLSA generator.
+			j.uses = append(j.uses, actionUse{line: lineNum, ref: value})
+			if isAttestationAction(value) {
+				j.attest(lineNum, actionName(value))
+			}
+		}
+		return
+	}
+
+	switch j.childKey {
+	case "permissions":
+		if idTokenWrite.MatchString(trimmed) {
+			j.idToken = true
+		}
+	case "needs":
+		if n, ok := strings.CutPrefix(trimmed, "- "); ok {
+			j.needs = append(j.needs, strings.Trim(strings.TrimSpace(n), `"'`))
+		}
+	case "strategy":
+		j.trackMatrix(trimmed, indent, lineNum, key)
+	case "steps":
+		w.trackStep(j, trimmed, indent, lineNum)
+	}
+}
+
+// trackMatrix reads a line of a job's strategy, collecting the dimensions
+// of its matrix.
+func (j *workflowJob) trackMatrix(trimmed string, indent, lineNum int, key []string) {
+	if j.matrixIndent >= 0 && indent <= j.matrixIndent {
+		j.matrixIndent = -1
+	}
+	if j.matrixIndent < 0 {
+		if key == nil || key[1] != "matrix" {
+			return
+		}
+		j.matrixLine = lineNum
+		value := strings.TrimSpace(trimmed[len(key[0]):])
+		switch {
+		case strings.Contains(value, "${{"):
+			j.dimensions = append(j.dimensions, "dynamic")
+		case strings.HasPrefix(value, "{"):
+			for _, m := range flowMatrixKey.FindAllStringSubmatch(value, -1) {
+				j.dimensions = append(j.dimensions, m[1])
+			}
+		default:
+			j.matrixIndent, j.dimIndent = indent, -1
+		}
+		return
+	}
+	if j.dimIndent < 0 {
+		j.dimIndent = indent
+	}
+	if indent != j.dimIndent || key == nil || key[1] == "exclude" {
+		return
+	}
+	if key[1] == "include" && len(j.dimensions) > 0 {
+		return
+	}
+	j.dimensions = append(j.dimensions, key[1])
+}
+
+// trackStep reads a line of a job's steps.
+func (w *workflowTracker) trackStep(j *workflowJob, trimmed string, indent, lineNum int) {
+	if m := usesKey.FindStringSubmatch(trimmed); m != nil {
+		j.closeStep()
+		j.uses = append(j.uses, actionUse{line: lineNum, ref: m[1]})
+		name := actionName(m[1])
+		switch {
+		case isAttestationAction(m[1]):
+			j.attest(lineNum, name)
+			j.openStep(name, trimmed, indent, lineNum)
+		case name == "actions/upload-artifact":
+			j.produces = true
+			j.openStep(name, trimmed, indent, lineNum)
+		case releaseActions[name]:
+			j.produces, j.publishes, w.release = true, true, true
+			j.openStep(name, trimmed, indent, lineNum)
+		case name == "actions/download-artifact" || name == "actions/checkout" || name == "docker/build-push-action" || cacheActions[name]:
+			j.openStep(name, trimmed, indent, lineNum)
+		}
+		return
+	}
+	if j.step != nil {
+		j.step.trackInput(trimmed, indent)
+	}
+}
+
+// attest records an attestation or signing step of the job.
+func (j *workflowJob) attest(lineNum int, step string) {
+	if j.attestLine == 0 {
+		j.attestLine, j.attestStep = lineNum, step
+	}
+	j.attestations = append(j.attestations, stepRef{line: lineNum, step: step})
+}
+
+// dependsOn reports whether job j needs the named job, directly or through
+// other jobs.
+func (w *workflowTracker) dependsOn(j *workflowJob, name string) bool {
+	byName := make(map[string]*workflowJob, len(w.jobs))
+	for _, job := range w.jobs {
+		byName[job.name] = job
+	}
+	seen := make(map[string]bool)
+	queue := append([]string(nil), j.needs...)
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n == name {
+			return true
+		}
+		if seen[n] || byName[n] == nil {
+			continue
+		}
+		seen[n] = true
+		queue = append(queue, byName[n].needs...)
+	}
+	return false
+}
+
+// matrixGap is a matrix job whose per-leg artifacts are not all attested.
+type matrixGap struct {
+	job *workflowJob
+	// scope tells where the attestation was found; attester is the job it
+	// runs in, nil when it is missing.
+	scope    string
+	attester *workflowJob
+}
+
+// gaps returns the matrix jobs of a release workflow that produce artifacts
+// per leg without attesting them in the leg itself or in a dependent job
+// that downloads every leg's artifacts.
+func (w *workflowTracker) gaps() []matrixGap {
+	if !w.release {
+		return nil
+	}
+	var gaps []matrixGap
+	for _, j := range w.jobs {
+		if len(j.dimensions) == 0 || !j.produces || j.attestLine > 0 {
+			continue
+		}
+		var gap *matrixGap
+		covered := false
+		for _, k := range w.jobs {
+			if k == j || k.attestLine == 0 {
+				continue
+			}
+			if !w.dependsOn(k, j.name) {
+				if gap == nil {
+					gap = &matrixGap{job: j, scope: attestationUnrelatedJob, attester: k}
+				}
+				continue
+			}
+			scope := attestationNoDownload
+			switch {
+			case k.downloadsAll:
+				covered = true
+			case k.readsOutputs[j.name]:
+				scope = attestationMatrixOutputs
+			case len(k.singleDownloads) > 0:
+				scope = attestationSingleArtifact
+			}
+			if gap == nil || gap.scope == attestationUnrelatedJob {
+				gap = &matrixGap{job: j, scope: scope, attester: k}
+			}
+		}
+		switch {
+		case covered:
+		case gap != nil:
+			gaps = append(gaps, *gap)
+		default:
+			gaps = append(gaps, matrixGap{job: j, scope: attestationMissing})
+		}
+	}
+	return gaps
+}
+
+// report flags the matrix attestation gaps of the workflow.
+func (w *workflowTracker) report(findings *findingSet, filePath string) {
+	for _, g := range w.gaps() {
+		j := g.job
+		dims := strings.Join(j.dimensions, ",")
+		subject := fmt.Sprintf("Matrix job %s (%s) publishes an artifact per leg", j.name, strings.Join(j.dimensions, " × "))
+		var message string
+		switch g.scope {
+		case attestationMissing:
+			message = subject + " but the workflow has no attestation step"
+		case attestationUnrelatedJob:
+			message = fmt.Sprintf("%s but attestation runs in job %s, which does not depend on it", subject, g.attester.name)
+		case attestationNoDownload:
+			message = fmt.Sprintf("%s but fan-in job %s attests without downloading the matrix artifacts", subject, g.attester.name)
+		case attestationSingleArtifact:
+			message = fmt.Sprintf("%s but fan-in job %s downloads and attests only %s", subject, g.attester.name, strings.Join(g.attester.singleDownloads, ", "))
+		case attestationMatrixOutputs:
+			message = fmt.Sprintf("%s but job %s attests the outputs of %s, which hold the value of a single leg", subject, g.attester.name, j.name)
+		}
+		fb := findings.Finding(matrixAttestationRuleID, sdk.SeverityMedium, sdk.ConfidenceMedium, message).
+			At(filePath, j.matrixLine, j.matrixLine).
+			WithMetadata("type", "matrix_attestation_gap").
+			WithMetadata("job", j.name).
+			WithMetadata("matrix_dimensions", dims).
+			WithMetadata("attestation_scope", g.scope)
+		if g.attester != nil {
+			fb.WithMetadata("attestation_job", g.attester.name).
+				WithMetadata("attestation_step", g.attester.attestStep).
+				WithMetadata("attestation_line", strconv.Itoa(g.attester.attestLine))
+		}
+		fb.Done()
+	}
+}
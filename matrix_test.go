@@ -0,0 +1,199 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// matrixBuildJob is a release workflow's matrix job uploading one artifact
+// per leg.
+var matrixBuildJob = []string{
+	"on:",
+	"  push:",
+	"    tags: ['v*']",
+	"jobs:",
+	"  build:",
+	"    runs-on: ${{ matrix.os }}",
+	"    strategy:",
+	"      matrix:",
+	"        os: [ubuntu-latest, macos-latest]",
+	"        arch: [amd64, arm64]",
+	"        exclude:",
+	"          - os: macos-latest",
+	"            arch: amd64",
+	"    steps:",
+	"      - run: make dist",
+	"      - uses: actions/upload-artifact@v4",
+	"        with:",
+	"          name: dist-${{ matrix.os }}-${{ matrix.arch }}",
+	"          path: dist/",
+}
+
+func TestMatrixAttestationGaps(t *testing.T) {
+	tests := []struct {
+		name string
+		// jobs follow the matrix build job.
+		jobs      []string
+		wantScope string
+		wantJob   string
+	}{
+		{
+			name:      "missing",
+			jobs:      nil,
+			wantScope: attestationMissing,
+		},
+		{
+			name: "unrelated job",
+			jobs: []string{
+				"  sign:",
+				"    steps:",
+				"      - uses: actions/attest-build-provenance@v2",
+			},
+			wantScope: attestationUnrelatedJob,
+			wantJob:   "sign",
+		},
+		{
+			name: "single artifact",
+			jobs: []string{
+				"  attest:",
+				"    needs: [build]",
+				"    steps:",
+				"      - name: Fetch",
+				"        uses: actions/download-artifact@v4",
+				"        with:",
+				"          name: dist-ubuntu-latest-amd64",
+				"      - uses: actions/attest-build-provenance@v2",
+			},
+			wantScope: attestationSingleArtifact,
+			wantJob:   "attest",
+		},
+		{
+			name: "no download",
+			jobs: []string{
+				"  release:",
+				"    needs:",
+				"      - build",
+				"    steps:",
+				"      - run: cosign sign-blob dist/app",
+			},
+			wantScope: attestationNoDownload,
+			wantJob:   "release",
+		},
+		{
+			name: "matrix outputs",
+			jobs: []string{
+				"  provenance:",
+				"    needs: build",
+				"    uses: slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@v2.0.0",
+				"    with:",
+				"      base64-subjects: ${{ needs.build.outputs.hashes }}",
+			},
+			wantScope: attestationMatrixOutputs,
+			wantJob:   "provenance",
+		},
+		{
+			name: "fan-in downloads everything",
+			jobs: []string{
+				"  publish:",
+				"    needs: build",
+				"    steps:",
+				"      - uses: actions/download-artifact@v4",
+				"        with:",
+				"          pattern: dist-*",
+				"          merge-multiple: true",
+				"      - uses: actions/attest-build-provenance@v2",
+			},
+		},
+		{
+			name: "transitive fan-in",
+			jobs: []string{
+				"  test:",
+				"    needs: build",
+				"  publish:",
+				"    needs: [test]",
+				"    steps:",
+				"      - uses: actions/download-artifact@v4",
+				"      - run: cosign attest-blob --predicate p.json dist/app",
+			},
+		},
+	}
+	for _, tt := range tests {
+		lines := append(append([]string(nil), matrixBuildJob...), tt.jobs...)
+		classifier := newLineClassifier("release.yml")
+		w := &workflowTracker{}
+		for i, line := range lines {
+			lc, command := classifier.classifyCommand(line)
+			w.track(line, i+1, lc, command, classifier)
+		}
+		gaps := w.gaps()
+		if tt.wantScope == "" {
+			if len(gaps) != 0 {
+				t.Errorf("%s: unexpected gap %s", tt.name, gaps[0].scope)
+			}
+			continue
+		}
+		if len(gaps) != 1 {
+			t.Errorf("%s: got %d gaps, want 1", tt.name, len(gaps))
+			continue
+		}
+		g := gaps[0]
+		if g.scope != tt.wantScope || g.job.name != "build" || strings.Join(g.job.dimensions, ",") != "os,arch" {
+			t.Errorf("%s: got %s on %s %v, want %s on build [os arch]", tt.name, g.scope, g.job.name, g.job.dimensions, tt.wantScope)
+		}
+		if tt.wantJob != "" && (g.attester == nil || g.attester.name != tt.wantJob) {
+			t.Errorf("%s: attestation job %v, want %s", tt.name, g.attester, tt.wantJob)
+		}
+	}
+}
+
+func TestMatrixAttestationNotReleaseWorkflow(t *testing.T) {
+	lines := []string{
+		"on: pull_request",
+		"jobs:",
+		"  test:",
+		"    strategy:",
+		"      matrix: { go: [1.24, 1.25] }",
+		"    steps:",
+		"      - uses: actions/upload-artifact@v4",
+	}
+	classifier := newLineClassifier("ci.yml")
+	w := &workflowTracker{}
+	for i, line := range lines {
+		lc, command := classifier.classifyCommand(line)
+		w.track(line, i+1, lc, command, classifier)
+	}
+	if gaps := w.gaps(); len(gaps) != 0 {
+		t.Errorf("expected no gaps outside release workflows, got %d", len(gaps))
+	}
+	if dims := w.jobs[0].dimensions; strings.Join(dims, ",") != "go" {
+		t.Errorf("inline matrix dimensions %v, want [go]", dims)
+	}
+}
+
+func TestScanMatrixAttestationGap(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), strings.Join(append(matrixBuildJob,
+		"  attest:",
+		"    needs: build",
+		"    steps:",
+		"      - uses: actions/attest-build-provenance@v2",
+		"        with:",
+		"          subject-path: dist/*",
+	), "\n")+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	gaps := findByRule(resp.GetFindings(), matrixAttestationRuleID)
+	if len(gaps) != 1 {
+		t.Fatalf("expected one %s finding, got %d", matrixAttestationRuleID, len(gaps))
+	}
+	f := gaps[0]
+	meta := f.GetMetadata()
+	if f.GetLocation().GetStartLine() != 8 || meta["job"] != "build" || meta["matrix_dimensions"] != "os,arch" {
+		t.Errorf("unexpected finding at line %d: %v", f.GetLocation().GetStartLine(), meta)
+	}
+	if meta["attestation_scope"] != attestationNoDownload || meta["attestation_job"] != "attest" || meta["attestation_line"] != "23" {
+		t.Errorf("unexpected attestation location: %v", meta)
+	}
+}
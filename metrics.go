@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scan phases timed for metrics. Worker phases sum the time spent on every
+// worker, so with concurrency they can exceed the wall-clock scan time.
+const (
+	phaseWalk            = "walk"
+	phaseProvenance      = "provenance"
+	phaseBuildScan       = "build_scan"
+	phaseCIAnalysis      = "ci_analysis"
+	phaseWorkspaceChecks = "workspace_checks"
+)
+
+// metricPhases lists the phases in the order their metrics are emitted.
+var metricPhases = []string{phaseWalk, phaseProvenance, phaseBuildScan, phaseCIAnalysis, phaseWorkspaceChecks}
+
+// timePhase adds the time since start to a phase.
+func (s *scanSummary) timePhase(phase string, start time.Time) {
+	s.addPhase(phase, time.Since(start))
+}
+
+// addPhase adds a measured duration to a phase.
+func (s *scanSummary) addPhase(phase string, d time.Duration) {
+	if s.phases == nil {
+		s.phases = make(map[string]time.Duration)
+	}
+	s.phases[phase] += d
+}
+
+// mergeMetrics folds the metrics recorded in other into s.
+func (s *scanSummary) mergeMetrics(other *scanSummary) {
+	for phase, d := range other.phases {
+		if s.phases == nil {
+			s.phases = make(map[string]time.Duration)
+		}
+		s.phases[phase] += d
+	}
+	s.bytesRead += other.bytesRead
+	s.linesTruncated += other.linesTruncated
+	s.findingsCapped += other.findingsCapped
+}
+
+// seconds renders a duration as fractional seconds.
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 6, 64)
+}
+
+// emitMetrics adds the scan metrics to the summary finding: phase timings in
+// seconds, volume counters, limit-hit counters, and the findings emitted
+// per rule, all as plain integers or decimal seconds.
+func (s *scanSummary) emitMetrics(fb *findingBuilder, findings *findingSet) {
+	for _, phase := range metricPhases {
+		fb.WithMetadata("metric_"+phase+"_seconds", seconds(s.phases[phase]))
+	}
+
+	perRule := make(map[string]int)
+	for _, f := range findings.items {
+		perRule[f.ruleID]++
+	}
+	counts := make([]string, 0, len(perRule))
+	for _, id := range sortedKeys(perRule) {
+		counts = append(counts, fmt.Sprintf("%s=%d", id, perRule[id]))
+	}
+
+	fb.WithMetadata("metric_total_seconds", seconds(s.elapsed)).
+		WithMetadata("metric_files_visited", strconv.Itoa(s.filesWalked)).
+		WithMetadata("metric_bytes_read", strconv.FormatInt(s.bytesRead, 10)).
+		WithMetadata("metric_findings_total", strconv.Itoa(len(findings.items))).
+		WithMetadata("metric_findings_by_rule", strings.Join(counts, ",")).
+		WithMetadata("metric_files_size_skipped", strconv.Itoa(s.filesOversized)).
+		WithMetadata("metric_lines_truncated", strconv.Itoa(s.linesTruncated)).
+		WithMetadata("metric_findings_capped", strconv.Itoa(s.findingsCapped))
+}
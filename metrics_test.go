@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+func TestScanMetrics(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tcurl -sSL https://example.com/install | sh\n")
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "ci.yml"), "on: push\njobs:\n  build:\n    steps:\n      - run: make build\n")
+	writeFile(t, filepath.Join(workspace, "app.intoto.jsonl"), testStatement+"\n")
+	// A line beyond the scanner buffer stops this file, not the scan.
+	writeFile(t, filepath.Join(workspace, "tools", "Dockerfile"), "FROM alpine:latest\nRUN echo "+strings.Repeat("x", 70*1024)+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+
+	for _, phase := range metricPhases {
+		key := "metric_" + phase + "_seconds"
+		if v, err := strconv.ParseFloat(meta[key], 64); err != nil || v < 0 {
+			t.Errorf("%s = %q, want non-negative seconds", key, meta[key])
+		}
+	}
+	for _, key := range []string{"metric_total_seconds", "metric_files_visited", "metric_bytes_read", "metric_findings_total",
+		"metric_files_size_skipped", "metric_lines_truncated", "metric_findings_capped"} {
+		if _, err := strconv.ParseFloat(meta[key], 64); err != nil {
+			t.Errorf("%s = %q, want a number", key, meta[key])
+		}
+	}
+	if meta["metric_files_visited"] != "4" || meta["metric_lines_truncated"] != "1" {
+		t.Errorf("files_visited = %q, lines_truncated = %q; want 4, 1", meta["metric_files_visited"], meta["metric_lines_truncated"])
+	}
+	if bytes, _ := strconv.ParseInt(meta["metric_bytes_read"], 10, 64); bytes < 70*1024 {
+		t.Errorf("metric_bytes_read = %q, want at least the Dockerfile size", meta["metric_bytes_read"])
+	}
+
+	// The per-rule counts cover every finding but the summary itself.
+	total := 0
+	for _, pair := range strings.Split(meta["metric_findings_by_rule"], ",") {
+		id, count, _ := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(count)
+		if err != nil || len(findByRule(resp.GetFindings(), id)) != n {
+			t.Errorf("metric_findings_by_rule entry %q does not match the findings", pair)
+		}
+		total += n
+	}
+	if strconv.Itoa(total) != meta["metric_findings_total"] || total != len(resp.GetFindings())-1 {
+		t.Errorf("metric_findings_total = %q, per-rule sum %d, findings %d", meta["metric_findings_total"], total, len(resp.GetFindings()))
+	}
+	if len(findByRule(resp.GetFindings(), "PROV-003")) == 0 {
+		t.Error("expected PROV-003 findings from the scanned build files")
+	}
+}
+
+func TestScanMetricsDisabled(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tgo build .\n")
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root":  workspace,
+		"collect_metrics": false,
+	})
+	for key := range findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata() {
+		if strings.HasPrefix(key, "metric_") {
+			t.Errorf("unexpected %s with collect_metrics disabled", key)
+		}
+	}
+}
+
+// BenchmarkScanMetrics guards the overhead of collecting metrics: the two
+// sub-benchmarks should stay within noise of each other.
+func BenchmarkScanMetrics(b *testing.B) {
+	workspace := generateWorkspace(b, 200, 200)
+	for _, enabled := range []bool{false, true} {
+		b.Run("collect_metrics="+strconv.FormatBool(enabled), func(b *testing.B) {
+			req := sdk.ToolRequest{Input: map[string]any{
+				"workspace_root":  workspace,
+				"collect_metrics": enabled,
+			}}
+			for i := 0; i < b.N; i++ {
+				if _, err := handleScan(context.Background(), req); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// indexSubjectRuleID flags provenance whose subject is a multi-platform
+// image index rather than the per-platform manifests it lists.
+const indexSubjectRuleID = "PROV-038"
+
+// Evidence that a subject digest is an image index.
+const (
+	indexEvidenceArchive = "image_index"
+	indexEvidenceBuild   = "multi_platform_build"
+)
+
+// multiPlatformFlag matches a build for several platforms: a buildx
+// --platform flag or a build action's platforms input listing more than
+// one, and captures the list.
+var multiPlatformFlag = regexp.MustCompile(`(?:--platform[=\s]+|\bplatforms:\s*)["']?([\w./-]+(?:\s*,\s*[\w./-]+)+)`)
+
+// imageIndex is a multi-platform image index found in an image archive.
+type imageIndex struct {
+	archive  string
+	children []archiveImage
+}
+
+// recordImageIndexes records the multi-platform indexes among an archive's
+// images and returns the images of every index by its digest.
+func (s *scanSummary) recordImageIndexes(archive string, images []archiveImage) map[string][]archiveImage {
+	indexes := make(map[string][]archiveImage)
+	for _, img := range images {
+		if img.index != "" {
+			indexes[img.index] = append(indexes[img.index], img)
+		}
+	}
+	for digest, children := range indexes {
+		if len(children) < 2 {
+			continue
+		}
+		if s.imageIndexes == nil {
+			s.imageIndexes = make(map[string]imageIndex)
+		}
+		s.imageIndexes[digest] = imageIndex{archive: archive, children: children}
+	}
+	return indexes
+}
+
+// multiPlatformBuild is a build or CI command that builds an image for
+// several platforms.
+type multiPlatformBuild struct {
+	path      string
+	line      int
+	platforms []string
+}
+
+// recordMultiPlatformBuild records a multi-platform image build in a build
+// or CI config line. Commented and echoed lines build nothing.
+func (s *scanSummary) recordMultiPlatformBuild(path string, lineNum int, line string, ascii bool, lc lineContext) {
+	if lc == contextComment || lc == contextEcho || lc == contextHeredoc {
+		return
+	}
+	if ascii && !containsFoldASCII(line, "platform") {
+		return
+	}
+	m := multiPlatformFlag.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+	var platforms []string
+	for _, p := range strings.Split(m[1], ",") {
+		platforms = append(platforms, strings.TrimSpace(p))
+	}
+	s.multiPlatformBuilds = append(s.multiPlatformBuilds, multiPlatformBuild{path: path, line: lineNum, platforms: platforms})
+}
+
+// mergeImageIndexes folds the indexes and multi-platform builds recorded in
+// other into s.
+func (s *scanSummary) mergeImageIndexes(other *scanSummary) {
+	for digest, index := range other.imageIndexes {
+		if s.imageIndexes == nil {
+			s.imageIndexes = make(map[string]imageIndex)
+		}
+		s.imageIndexes[digest] = index
+	}
+	s.multiPlatformBuilds = append(s.multiPlatformBuilds, other.multiPlatformBuilds...)
+}
+
+// subjectImageRepository returns the normalized repository of a subject
+// named by a registry-qualified image reference such as ghcr.io/org/app, or
+// "" for other subjects.
+func subjectImageRepository(name string) string {
+	first, _, hasSlash := strings.Cut(name, "/")
+	if !hasSlash || strings.Contains(name, "://") || strings.HasPrefix(name, "pkg:") ||
+		(!strings.ContainsAny(first, ".:") && first != "localhost") {
+		return ""
+	}
+	ref, ok := parseImageRef(name)
+	if !ok {
+		return ""
+	}
+	return ref.repository
+}
+
+// reportIndexSubjects flags provenance subjects that cover a multi-platform
+// image index but none of its per-platform manifests. A subject digest is an
+// index when an archive holds it as one; without that, an image subject
+// whose repository has a single attested digest is suspect when the CI
+// builds images for several platforms. Either way it is a heuristic, so
+// findings are Low confidence.
+func reportIndexSubjects(findings *findingSet, summary *scanSummary) {
+	reported := make(map[string]bool)
+	byRepository := make(map[string][]subjectRecord)
+	for _, subj := range summary.subjectRecords {
+		digest := "sha256:" + subj.sha256
+		index, ok := summary.imageIndexes[digest]
+		if !ok {
+			if repo := subjectImageRepository(subj.name); repo != "" {
+				byRepository[repo] = append(byRepository[repo], subj)
+			}
+			continue
+		}
+		key := subj.location + "\x00" + digest
+		if reported[key] || childrenAttested(summary, index) {
+			continue
+		}
+		reported[key] = true
+		var platforms, digests []string
+		for _, child := range index.children {
+			platforms = append(platforms, child.platform)
+			digests = append(digests, child.digest)
+		}
+		reportIndexSubject(findings, subj, indexEvidenceArchive,
+			fmt.Sprintf("Provenance subject %s covers image index %s, not its %d platform manifests", subj.name, digest, len(index.children))).
+			WithMetadata("archive", workspacePath(findings.root, index.archive)).
+			WithMetadata("platforms", strings.Join(platforms, ",")).
+			WithMetadata("child_digests", strings.Join(digests, ",")).
+			Done()
+	}
+
+	if len(summary.multiPlatformBuilds) == 0 {
+		return
+	}
+	build := summary.multiPlatformBuilds[0]
+	repos := make([]string, 0, len(byRepository))
+	for repo := range byRepository {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	for _, repo := range repos {
+		subjects := byRepository[repo]
+		digests := make(map[string]bool)
+		for _, subj := range subjects {
+			digests[subj.sha256] = true
+		}
+		if len(digests) != 1 {
+			continue
+		}
+		subj := subjects[0]
+		reportIndexSubject(findings, subj, indexEvidenceBuild,
+			fmt.Sprintf("Provenance subject %s names one digest while CI builds it for %s; the subject likely covers the image index, not the per-platform images",
+				subj.name, strings.Join(build.platforms, ", "))).
+			WithMetadata("image_repository", repo).
+			WithMetadata("platforms", strings.Join(build.platforms, ",")).
+			WithMetadata("build_path", workspacePath(findings.root, build.path)).
+			WithMetadata("build_line", strconv.Itoa(build.line)).
+			Done()
+	}
+}
+
+// childrenAttested reports whether any per-platform manifest of an index is
+// a subject of some attestation.
+func childrenAttested(summary *scanSummary, index imageIndex) bool {
+	for _, child := range index.children {
+		if summary.attestedDigests[child.digest] {
+			return true
+		}
+	}
+	return false
+}
+
+// reportIndexSubject starts a finding for a subject that covers an index.
+func reportIndexSubject(findings *findingSet, subj subjectRecord, evidence, message string) *findingBuilder {
+	fb := findings.Finding(indexSubjectRuleID, sdk.SeverityMedium, sdk.ConfidenceLow, message).
+		At(subj.location, subj.line, subj.line).
+		WithMetadata("type", "index_subject").
+		WithMetadata("evidence", evidence).
+		WithMetadata("subject", subj.name).
+		WithMetadata("subject_digest", "sha256:"+subj.sha256)
+	if subj.index >= 0 {
+		fb.WithMetadata("statement_index", strconv.Itoa(subj.index))
+	}
+	return fb
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordMultiPlatformBuild(t *testing.T) {
+	tests := []struct {
+		line      string
+		lc        lineContext
+		platforms []string
+	}{
+		{"docker buildx build --platform linux/amd64,linux/arm64 --push .", contextRunCommand, []string{"linux/amd64", "linux/arm64"}},
+		{"          platforms: linux/amd64, linux/arm64/v8", contextOther, []string{"linux/amd64", "linux/arm64/v8"}},
+		{"docker buildx build --platform=linux/amd64 .", contextRunCommand, nil},
+		{"# docker buildx build --platform linux/amd64,linux/arm64 .", contextComment, nil},
+	}
+	for _, tt := range tests {
+		s := &scanSummary{}
+		s.recordMultiPlatformBuild("ci.yml", 1, tt.line, true, tt.lc)
+		var got []string
+		if len(s.multiPlatformBuilds) > 0 {
+			got = s.multiPlatformBuilds[0].platforms
+		}
+		if !reflect.DeepEqual(got, tt.platforms) {
+			t.Errorf("%q: platforms %q, want %q", tt.line, got, tt.platforms)
+		}
+	}
+}
+
+func TestSubjectImageRepository(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"ghcr.io/example/app", "ghcr.io/example/app"},
+		{"localhost:5000/app:1.0", "localhost:5000/app"},
+		{"example/app", ""},
+		{"dist/app_linux_amd64.tar.gz", ""},
+		{"pkg:docker/example/app@1.0", ""},
+		{"https://example.com/app.zip", ""},
+	}
+	for _, tt := range tests {
+		if got := subjectImageRepository(tt.name); got != tt.want {
+			t.Errorf("subjectImageRepository(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScanIndexSubjectInArchive(t *testing.T) {
+	workspace := t.TempDir()
+	layout := &ociLayout{}
+	amd64 := layout.manifest(t, "\x1f\x8bamd64 layer")
+	arm64 := layout.manifest(t, "\x1f\x8barm64 layer")
+	index := layout.blob(t, map[string]any{
+		"mediaType": mediaTypeOCIIndex,
+		"manifests": []any{
+			map[string]any{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": amd64, "platform": map[string]string{"os": "linux", "architecture": "amd64"}},
+			map[string]any{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": arm64, "platform": map[string]string{"os": "linux", "architecture": "arm64"}},
+		},
+	})
+	layout.write(t, filepath.Join(workspace, "images", "app.tar"), []any{
+		map[string]any{"mediaType": mediaTypeOCIIndex, "digest": index, "annotations": map[string]string{annotationImageName: "ghcr.io/example/app:1.0"}},
+	})
+	writeFile(t, filepath.Join(workspace, "provenance.json"), subjectStatement("ghcr.io/example/app", strings.TrimPrefix(index, "sha256:")))
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{"workspace_root": workspace, "scan_archives": true})
+
+	found := findByRule(resp.GetFindings(), indexSubjectRuleID)
+	if len(found) != 1 {
+		t.Fatalf("expected one %s finding, got %d", indexSubjectRuleID, len(found))
+	}
+	meta := found[0].GetMetadata()
+	if meta["evidence"] != indexEvidenceArchive || meta["platforms"] != "linux/amd64,linux/arm64" ||
+		meta["child_digests"] != amd64+","+arm64 || meta["archive"] != "images/app.tar" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+	if got := confidenceNames[found[0].GetConfidence()]; got != "low" {
+		t.Errorf("confidence %s, want low", got)
+	}
+}
+
+func TestScanIndexSubjectFromBuild(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), strings.Join([]string{
+		"on: release",
+		"jobs:",
+		"  image:",
+		"    steps:",
+		"      - uses: docker/build-push-action@v6",
+		"        with:",
+		"          platforms: linux/amd64,linux/arm64",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, "image", "provenance.json"), subjectStatement("ghcr.io/example/app", strings.Repeat("ab", 32)))
+	writeFile(t, filepath.Join(workspace, "tool", "provenance.json"), subjectStatement(
+		"ghcr.io/example/tool", strings.Repeat("cd", 32), "ghcr.io/example/tool", strings.Repeat("ef", 32)))
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	found := findByRule(resp.GetFindings(), indexSubjectRuleID)
+	if len(found) != 1 {
+		t.Fatalf("expected one %s finding, got %d", indexSubjectRuleID, len(found))
+	}
+	meta := found[0].GetMetadata()
+	if meta["evidence"] != indexEvidenceBuild || meta["image_repository"] != "ghcr.io/example/app" ||
+		meta["build_path"] != ".github/workflows/release.yml" || meta["build_line"] != "7" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+}
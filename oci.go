@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// unattestedArchiveImageRuleID flags an image in a docker save tarball or OCI
+// image layout that carries no attestation manifest.
+const unattestedArchiveImageRuleID = "PROV-017"
+
+// Caps on the image layout entries retained in memory while an archive is
+// read. Layers are never retained: only entries that look like JSON are.
+const (
+	// maxImageBlobSize is the largest manifest, index, or attestation blob
+	// that is retained.
+	maxImageBlobSize = 4 << 20
+	// maxImageRetainedBytes is the most blob data retained per archive.
+	maxImageRetainedBytes = 64 << 20
+)
+
+// OCI and Docker media types.
+const (
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeInToto             = "application/vnd.in-toto+json"
+	mediaTypeDSSE               = "application/vnd.dsse.envelope.v1+json"
+	mediaTypeSigstoreBundle     = "application/vnd.dev.sigstore.bundle"
+)
+
+// Descriptor annotations that name images and link BuildKit attestation
+// manifests to the image they attest.
+const (
+	annotationImageName       = "io.containerd.image.name"
+	annotationRefName         = "org.opencontainers.image.ref.name"
+	annotationReferenceType   = "vnd.docker.reference.type"
+	annotationReferenceDigest = "vnd.docker.reference.digest"
+	annotationPredicateType   = "in-toto.io/predicate-type"
+	referenceTypeAttestation  = "attestation-manifest"
+)
+
+// ociDescriptor is a content descriptor in an OCI index or manifest.
+type ociDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	ArtifactType string            `json:"artifactType"`
+	Annotations  map[string]string `json:"annotations"`
+	Platform     *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant"`
+	} `json:"platform"`
+}
+
+// platform renders the descriptor's platform as os/arch[/variant].
+func (d ociDescriptor) platform() string {
+	if d.Platform == nil {
+		return ""
+	}
+	p := d.Platform.OS + "/" + d.Platform.Architecture
+	if d.Platform.Variant != "" {
+		p += "/" + d.Platform.Variant
+	}
+	return p
+}
+
+// isAttestationLayer reports whether a layer holds an in-toto statement,
+// DSSE envelope, or Sigstore bundle.
+func (d ociDescriptor) isAttestationLayer() bool {
+	return d.MediaType == mediaTypeInToto || d.MediaType == mediaTypeDSSE ||
+		strings.HasPrefix(d.MediaType, mediaTypeSigstoreBundle) || d.Annotations[annotationPredicateType] != ""
+}
+
+// ociManifest is an OCI image index or image manifest; only the fields that
+// distinguish the two and link attestations are decoded.
+type ociManifest struct {
+	MediaType    string          `json:"mediaType"`
+	ArtifactType string          `json:"artifactType"`
+	Config       ociDescriptor   `json:"config"`
+	Layers       []ociDescriptor `json:"layers"`
+	Manifests    []ociDescriptor `json:"manifests"`
+	Subject      *ociDescriptor  `json:"subject"`
+}
+
+// isIndex reports whether the manifest is an image index.
+func (m *ociManifest) isIndex(desc ociDescriptor) bool {
+	return desc.MediaType == mediaTypeOCIIndex || desc.MediaType == mediaTypeDockerManifestList ||
+		m.MediaType == mediaTypeOCIIndex || m.MediaType == mediaTypeDockerManifestList || len(m.Manifests) > 0
+}
+
+// isAttestationReferrer reports whether the manifest is an artifact attached
+// to another manifest that carries attestations.
+func (m *ociManifest) isAttestationReferrer() bool {
+	if m.Subject == nil || m.Subject.Digest == "" {
+		return false
+	}
+	for _, t := range []string{m.ArtifactType, m.Config.MediaType} {
+		if t == mediaTypeInToto || t == mediaTypeDSSE || strings.HasPrefix(t, mediaTypeSigstoreBundle) {
+			return true
+		}
+	}
+	for _, layer := range m.Layers {
+		if layer.isAttestationLayer() {
+			return true
+		}
+	}
+	return false
+}
+
+// imageArchive holds the JSON entries of a docker save tarball or OCI image
+// layout, keyed by entry path.
+type imageArchive struct {
+	path     string
+	blobs    map[string][]byte
+	retained int
+}
+
+// isImageLayoutEntry reports whether an archive entry may belong to an
+// image layout.
+func isImageLayoutEntry(name string) bool {
+	return name == "oci-layout" || name == "index.json" || name == "manifest.json" || strings.HasPrefix(name, "blobs/")
+}
+
+// retain keeps an image layout entry if it is JSON and within the caps.
+func (a *imageArchive) retain(name string, data []byte) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return
+	}
+	if len(data) > maxImageBlobSize || a.retained+len(data) > maxImageRetainedBytes {
+		return
+	}
+	a.blobs[name] = data
+	a.retained += len(data)
+}
+
+// isImageLayout reports whether the archive is an OCI image layout or a
+// docker save tarball.
+func (a *imageArchive) isImageLayout() bool {
+	return a.blobs["oci-layout"] != nil || a.blobs["index.json"] != nil || a.blobs["manifest.json"] != nil
+}
+
+// blob returns the entry path and content of the blob with the given digest.
+func (a *imageArchive) blob(digest string) (string, []byte) {
+	alg, hexDigest, ok := strings.Cut(digest, ":")
+	if !ok {
+		return "", nil
+	}
+	name := "blobs/" + alg + "/" + hexDigest
+	return name, a.blobs[name]
+}
+
+// archiveImage is an image manifest found in an image archive.
+type archiveImage struct {
+	name     string
+	platform string
+	digest   string
+	// index is the digest of the image index listing the manifest, if any.
+	index string
+}
+
+// scanImageArchive enumerates the images in a docker save tarball or OCI
+// image layout, validates the attestations attached to them as BuildKit
+// attestation manifests or OCI referrers, and reports images without any.
+func scanImageArchive(ctx context.Context, findings *findingSet, a *imageArchive, policy provenancePolicy, summary *scanSummary) error {
+	var images []archiveImage
+	attested := make(map[string]bool)
+	var layers []ociDescriptor
+	seen := make(map[string]bool)
+
+	// attach records the attestation layers of an attestation manifest.
+	attach := func(m *ociManifest, subject string) {
+		attested[subject] = true
+		for _, layer := range m.Layers {
+			if layer.isAttestationLayer() {
+				layers = append(layers, layer)
+			}
+		}
+	}
+
+	var visit func(desc ociDescriptor, name, index string, depth int)
+	visit = func(desc ociDescriptor, name, index string, depth int) {
+		if seen[desc.Digest] || depth > 8 {
+			return
+		}
+		seen[desc.Digest] = true
+		var m ociManifest
+		if _, data := a.blob(desc.Digest); data != nil {
+			_ = json.Unmarshal(data, &m)
+		}
+		switch {
+		case m.isIndex(desc):
+			for _, child := range m.Manifests {
+				childName := name
+				if n := imageName(child); n != "" {
+					childName = n
+				}
+				visit(child, childName, desc.Digest, depth+1)
+			}
+		case desc.Annotations[annotationReferenceType] == referenceTypeAttestation:
+			attach(&m, desc.Annotations[annotationReferenceDigest])
+		case m.isAttestationReferrer():
+			attach(&m, m.Subject.Digest)
+		default:
+			images = append(images, archiveImage{name: name, platform: desc.platform(), digest: desc.Digest, index: index})
+		}
+	}
+
+	if data := a.blobs["index.json"]; data != nil {
+		var index ociManifest
+		if json.Unmarshal(data, &index) == nil {
+			for _, desc := range index.Manifests {
+				visit(desc, imageName(desc), "", 0)
+			}
+		}
+		// Referrers need not be listed in the index.
+		for _, name := range sortedKeys(a.blobs) {
+			if !strings.HasPrefix(name, "blobs/") || seen[strings.Replace(strings.TrimPrefix(name, "blobs/"), "/", ":", 1)] {
+				continue
+			}
+			var m ociManifest
+			if json.Unmarshal(a.blobs[name], &m) == nil && m.isAttestationReferrer() {
+				attach(&m, m.Subject.Digest)
+			}
+		}
+	} else {
+		images = dockerSaveImages(a.blobs["manifest.json"])
+	}
+
+	summary.archiveImages += len(images)
+	indexes := summary.recordImageIndexes(a.path, images)
+	validated := make(map[string]bool)
+	for _, layer := range layers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		name, data := a.blob(layer.Digest)
+		if data == nil || validated[name] || !looksLikeAttestation(data) {
+			continue
+		}
+		validated[name] = true
+		summary.archiveAttestations++
+		summary.attestationFiles++
+		if err := checkProvenance(ctx, findings, a.path+"!/"+name, data, policy, summary); err != nil {
+			return err
+		}
+	}
+
+	for _, img := range images {
+		if attested[img.digest] {
+			continue
+		}
+		label := img.name
+		if label == "" {
+			label = img.digest
+		}
+		if img.platform != "" {
+			label += " (" + img.platform + ")"
+		}
+		message := fmt.Sprintf("Image %s in archive carries no attestation manifest", label)
+		// Children of a multi-platform index are reported per platform,
+		// with the platforms of the index that are covered.
+		var covered []string
+		children := indexes[img.index]
+		if len(children) > 1 {
+			for _, child := range children {
+				if attested[child.digest] {
+					covered = append(covered, child.platform)
+				}
+			}
+			message = fmt.Sprintf("Image %s in archive carries no attestation manifest; %d of the %d platforms of its index are attested", label, len(covered), len(children))
+		}
+		fb := findings.Finding(
+			unattestedArchiveImageRuleID,
+			sdk.SeverityMedium,
+			sdk.ConfidenceHigh,
+			message,
+		).
+			At(a.path, 0, 0).
+			WithMetadata("type", "unattested_archive_image").
+			WithMetadata("image", img.name).
+			WithMetadata("image_digest", img.digest).
+			WithMetadata("platform", img.platform)
+		if len(children) > 1 {
+			fb.WithMetadata("index_digest", img.index).
+				WithMetadata("index_platforms", strconv.Itoa(len(children))).
+				WithMetadata("attested_platforms", strings.Join(covered, ",")).
+				WithMetadata("index_attested", strconv.FormatBool(attested[img.index]))
+		}
+		fb.Done()
+	}
+	return nil
+}
+
+// imageName returns the image name a descriptor is annotated with.
+func imageName(desc ociDescriptor) string {
+	if name := desc.Annotations[annotationImageName]; name != "" {
+		return name
+	}
+	return desc.Annotations[annotationRefName]
+}
+
+// dockerSaveImages lists the images of a legacy docker save manifest.json.
+// That format cannot carry attestation manifests. Image digests are those of
+// the image configs.
+func dockerSaveImages(data []byte) []archiveImage {
+	var entries []struct {
+		Config   string   `json:"Config"`
+		RepoTags []string `json:"RepoTags"`
+	}
+	if json.Unmarshal(data, &entries) != nil {
+		return nil
+	}
+	var images []archiveImage
+	for _, e := range entries {
+		if e.Config == "" {
+			continue
+		}
+		img := archiveImage{digest: "sha256:" + strings.TrimSuffix(e.Config[strings.LastIndex(e.Config, "/")+1:], ".json")}
+		if len(e.RepoTags) > 0 {
+			img.name = e.RepoTags[0]
+		}
+		images = append(images, img)
+	}
+	return images
+}
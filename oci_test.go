@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+// ociLayout builds the entries of an OCI image layout. Blobs are stored
+// under their sha256 digest.
+type ociLayout struct {
+	entries []archiveEntry
+}
+
+// blob adds a blob and returns its descriptor digest.
+func (l *ociLayout) blob(t *testing.T, v any) string {
+	t.Helper()
+	data, ok := v.(string)
+	if !ok {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = string(raw)
+	}
+	digest := sha256Hex([]byte(data))
+	l.entries = append(l.entries, archiveEntry{"blobs/sha256/" + digest, data})
+	return "sha256:" + digest
+}
+
+// manifest adds an image manifest with one binary layer and returns its
+// digest.
+func (l *ociLayout) manifest(t *testing.T, layer string) string {
+	return l.blob(t, map[string]any{
+		"mediaType": "application/vnd.oci.image.manifest.v1+json",
+		"config":    map[string]any{"mediaType": "application/vnd.oci.image.config.v1+json", "digest": l.blob(t, `{"architecture":"amd64"}`)},
+		"layers":    []any{map[string]any{"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "digest": l.blob(t, layer)}},
+	})
+}
+
+// write adds oci-layout and index.json and writes the layout as a tar.
+func (l *ociLayout) write(t *testing.T, path string, index []any) {
+	t.Helper()
+	raw, err := json.Marshal(map[string]any{"schemaVersion": 2, "manifests": index})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := append([]archiveEntry{{"oci-layout", `{"imageLayoutVersion":"1.0.0"}`}}, l.entries...)
+	entries = append(entries, archiveEntry{"index.json", string(raw)})
+	writeTar(t, path, entries...)
+}
+
+func TestScanImageArchiveAttestations(t *testing.T) {
+	workspace := t.TempDir()
+	layout := &ociLayout{}
+
+	// A multi-platform BuildKit image: amd64 is attested, arm64 is not.
+	amd64 := layout.manifest(t, "\x1f\x8bamd64 layer")
+	arm64 := layout.manifest(t, "\x1f\x8barm64 layer")
+	statement := layout.blob(t, subjectStatement("pkg:docker/example/app@1.0?platform=linux%2Famd64", amd64[len("sha256:"):]))
+	attestation := layout.blob(t, map[string]any{
+		"mediaType": "application/vnd.oci.image.manifest.v1+json",
+		"config":    map[string]any{"mediaType": "application/vnd.oci.image.config.v1+json", "digest": layout.blob(t, `{}`)},
+		"layers": []any{map[string]any{
+			"mediaType":   mediaTypeInToto,
+			"digest":      statement,
+			"annotations": map[string]string{annotationPredicateType: "https://slsa.dev/provenance/v0.2"},
+		}},
+	})
+	index := layout.blob(t, map[string]any{
+		"mediaType": mediaTypeOCIIndex,
+		"manifests": []any{
+			map[string]any{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": amd64, "platform": map[string]string{"os": "linux", "architecture": "amd64"}},
+			map[string]any{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": arm64, "platform": map[string]string{"os": "linux", "architecture": "arm64"}},
+			map[string]any{
+				"mediaType":   "application/vnd.oci.image.manifest.v1+json",
+				"digest":      attestation,
+				"platform":    map[string]string{"os": "unknown", "architecture": "unknown"},
+				"annotations": map[string]string{annotationReferenceType: referenceTypeAttestation, annotationReferenceDigest: amd64},
+			},
+		},
+	})
+
+	// A single-platform image attested through an unlisted OCI referrer.
+	single := layout.manifest(t, "\x1f\x8bsingle layer")
+	layout.blob(t, map[string]any{
+		"mediaType":    "application/vnd.oci.image.manifest.v1+json",
+		"artifactType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"config":       map[string]any{"mediaType": "application/vnd.oci.empty.v1+json", "digest": layout.blob(t, `{ }`)},
+		"layers":       []any{map[string]any{"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json", "digest": layout.blob(t, bundled(subjectStatement("single", "abc"), 1))}},
+		"subject":      map[string]any{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": single},
+	})
+
+	layout.write(t, filepath.Join(workspace, "cache", "app.tar"), []any{
+		map[string]any{"mediaType": mediaTypeOCIIndex, "digest": index, "annotations": map[string]string{annotationImageName: "example/app:1.0"}},
+		map[string]any{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": single, "annotations": map[string]string{annotationRefName: "single"}},
+	})
+
+	writeTar(t, filepath.Join(workspace, "cache", "legacy.tar"),
+		archiveEntry{"manifest.json", `[{"Config":"0123abcd.json","RepoTags":["example/legacy:1"],"Layers":["layer.tar"]}]`},
+		archiveEntry{"0123abcd.json", `{"architecture":"amd64"}`},
+	)
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{"workspace_root": workspace, "scan_archives": true})
+
+	unattested := make(map[string]string)
+	for _, f := range findByRule(resp.GetFindings(), unattestedArchiveImageRuleID) {
+		meta := f.GetMetadata()
+		unattested[meta["image"]+" "+meta["platform"]] = f.GetLocation().GetFilePath()
+		if meta["platform"] == "linux/arm64" && (meta["index_digest"] != index || meta["attested_platforms"] != "linux/amd64" ||
+			meta["index_platforms"] != "2" || meta["index_attested"] != "false") {
+			t.Errorf("unexpected index metadata on the arm64 finding: %v", meta)
+		}
+	}
+	want := map[string]string{
+		"example/app:1.0 linux/arm64": "cache/app.tar",
+		"example/legacy:1 ":           "cache/legacy.tar",
+	}
+	if len(unattested) != len(want) {
+		t.Fatalf("expected %s findings for %v, got %v", unattestedArchiveImageRuleID, want, unattested)
+	}
+	for image, location := range want {
+		if unattested[image] != location {
+			t.Errorf("expected a %s finding for %q at %s, got %v", unattestedArchiveImageRuleID, image, location, unattested)
+		}
+	}
+
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["archive_images"] != "4" || meta["archive_attestations"] != "2" || meta["statements_parsed"] != "2" {
+		t.Errorf("archive_images = %q, archive_attestations = %q, statements_parsed = %q; want 4, 2, 2",
+			meta["archive_images"], meta["archive_attestations"], meta["statements_parsed"])
+	}
+}
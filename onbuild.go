@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// onbuildRuleID flags ONBUILD triggers running non-deterministic commands,
+// which every image built FROM the base image runs at its own build time.
+const onbuildRuleID = "PROV-051"
+
+// onbuildInstruction matches a Dockerfile ONBUILD instruction and captures
+// the trigger it defers.
+var onbuildInstruction = regexp.MustCompile(`^(?i)ONBUILD\s+(.*)$`)
+
+// reportOnbuildTrigger flags a Dockerfile ONBUILD instruction, joined
+// across continuations, whose trigger matches a non-deterministic pattern.
+func reportOnbuildTrigger(findings *findingSet, filePath string, cmd logicalCommand) {
+	m := onbuildInstruction.FindStringSubmatch(cmd.text)
+	if m == nil {
+		return
+	}
+	trigger := strings.TrimSpace(m[1])
+	instruction, _, _ := strings.Cut(trigger, " ")
+	for _, nd := range nonDeterministicPatterns {
+		if !nd.Pattern.MatchString(trigger) {
+			continue
+		}
+		findings.Finding(
+			onbuildRuleID,
+			sdk.SeverityMedium,
+			sdk.ConfidenceMedium,
+			fmt.Sprintf("ONBUILD %s trigger runs in every image built from this one: %s", strings.ToUpper(instruction), nd.Reason),
+		).
+			At(filePath, cmd.line, cmd.line).
+			WithMetadata("type", "non_deterministic_onbuild").
+			WithMetadata("trigger", strings.ToUpper(instruction)).
+			WithMetadata("reason", nd.Reason).
+			Done()
+	}
+}
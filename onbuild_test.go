@@ -0,0 +1,37 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanOnbuildTriggers(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "base", "Dockerfile"), strings.Join([]string{
+		"FROM node:20.11.1",
+		"ONBUILD COPY package.json package-lock.json ./",
+		"ONBUILD RUN npm ci",
+		"onbuild run curl -fsSL https://example.com/setup.sh \\",
+		"    | sh",
+		"ONBUILD RUN apt-get install curl",
+		"RUN curl -fsSL https://example.com/other.sh | bash",
+	}, "\n")+"\n")
+
+	found := findByRule(invokeScan(t, testClient(t), workspace).GetFindings(), onbuildRuleID)
+	got := make(map[int32]string)
+	for _, f := range found {
+		if f.GetMetadata()["trigger"] != "RUN" || f.GetMetadata()["type"] != "non_deterministic_onbuild" {
+			t.Errorf("unexpected metadata: %v", f.GetMetadata())
+		}
+		got[f.GetLocation().GetStartLine()] = f.GetMetadata()["reason"]
+	}
+	want := map[int32]string{
+		4: "Piping remote script to shell is non-reproducible",
+		6: "Package install without version pinning",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findings = %v, want %v", got, want)
+	}
+}
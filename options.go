@@ -0,0 +1,496 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+)
+
+// provenancePolicy holds the inputs that decide how parsed statements are
+// judged. The scan and validate tools share it.
+type provenancePolicy struct {
+	// requiredSLSALevel is the minimum estimated SLSA build level each
+	// statement must reach; zero disables the check.
+	requiredSLSALevel int
+	// secretAllowlist holds lowercased globs of credential-looking file
+	// names or paths that are known not to hold secrets.
+	secretAllowlist []string
+	// actionDenylist holds lowercased owner/repo globs of actions that must
+	// never run; actionAllowlist, when set, holds the only actions jobs
+	// that mint provenance may use.
+	actionDenylist  []string
+	actionAllowlist []string
+	// allowedSourceRefs holds lowercased globs of the git refs provenance
+	// may be built from; empty allows any ref.
+	allowedSourceRefs []string
+	// trustedRegistries holds lowercased globs of the registry and mirror
+	// hosts dependency configuration may point at; direct trusts a
+	// GOPROXY that fetches from version control.
+	trustedRegistries []string
+	// binaryAllowlist holds lowercased globs of vendored binaries, by base
+	// name or path, that are known to be acceptable.
+	binaryAllowlist []string
+	// checkSourceSubjects enables reporting statements whose subjects are
+	// all source files.
+	checkSourceSubjects bool
+	// checkGitLabProvenance enables reporting GitLab CI jobs that publish
+	// without provenance generation.
+	checkGitLabProvenance bool
+	// rego holds the compiled policy_files of a scan, or nil without any.
+	rego *regoPolicy
+}
+
+// parseProvenancePolicy reads and validates the provenance policy inputs.
+func parseProvenancePolicy(input map[string]any) (provenancePolicy, error) {
+	var policy provenancePolicy
+	var err error
+
+	if policy.requiredSLSALevel, err = intInput(input, "required_slsa_level", 0); err != nil {
+		return policy, err
+	}
+	if policy.requiredSLSALevel < 0 || policy.requiredSLSALevel > maxSLSALevel {
+		return policy, fmt.Errorf("required_slsa_level must be between 0 and %d, got %d", maxSLSALevel, policy.requiredSLSALevel)
+	}
+	if policy.checkSourceSubjects, err = boolInput(input, "check_source_subjects", true); err != nil {
+		return policy, err
+	}
+	if policy.checkGitLabProvenance, err = boolInput(input, "check_gitlab_provenance", true); err != nil {
+		return policy, err
+	}
+	if policy.secretAllowlist, err = globListInput(input, "secret_allowlist"); err != nil {
+		return policy, err
+	}
+	if policy.allowedSourceRefs, err = globListInput(input, "allowed_source_refs"); err != nil {
+		return policy, err
+	}
+	if policy.actionDenylist, err = globListInput(input, "action_denylist"); err != nil {
+		return policy, err
+	}
+	if policy.actionAllowlist, err = globListInput(input, "action_allowlist"); err != nil {
+		return policy, err
+	}
+	if policy.trustedRegistries, err = globListInput(input, "trusted_registries"); err != nil {
+		return policy, err
+	}
+	if policy.binaryAllowlist, err = globListInput(input, "vendored_binary_allowlist"); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
+
+// globAllowed reports whether a file name or path matches any of the
+// lowercased globs read by globListInput, by base name or whole path.
+func globAllowed(allow []string, name string) bool {
+	name = strings.ToLower(strings.ReplaceAll(name, `\`, "/"))
+	for _, pattern := range allow {
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// globListInput reads a list of path.Match globs, lowercased.
+func globListInput(input map[string]any, key string) ([]string, error) {
+	values, err := stringListInput(input, key)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, pattern := range values {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern %q: %w", key, pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// scanOptions holds the scan tool inputs beyond workspace_root.
+type scanOptions struct {
+	policy provenancePolicy
+
+	// failOnSeverity is the lowercased fail_on_severity input, empty when
+	// gating is disabled.
+	failOnSeverity string
+	gateThreshold  pluginv1.Severity
+
+	// followSymlinks enables descending into symlinked directories.
+	followSymlinks bool
+	// respectGitignore skips paths excluded by .gitignore files.
+	respectGitignore bool
+
+	// skipDirs decides which directories are pruned from the walk.
+	skipDirs *dirMatcher
+	// checkImages enables correlating image references with attestations.
+	checkImages bool
+	// checkSBOM enables reporting workspaces that never produce an SBOM.
+	checkSBOM bool
+	// checkCI enables reporting workspaces with build configs but no CI.
+	checkCI bool
+	// assumeProducesArtifacts skips the artifact production heuristics, so
+	// PROV-001 is never downgraded for a workspace that looks like a library.
+	assumeProducesArtifacts bool
+	// followScripts enables scanning the scripts build and CI commands
+	// invoke.
+	followScripts bool
+	// collectMetrics enables timing and counter metrics on the summary.
+	collectMetrics bool
+	// emitConfirmations enables informational findings for provenance files
+	// that pass every check.
+	emitConfirmations bool
+	// scanArchives enables inspecting tar and zip archives for embedded
+	// provenance and verifying subject digests around them.
+	scanArchives bool
+	// minLockfileOverlap is the percentage of a statement's dependency
+	// materials that must match a lockfile entry; zero disables the check.
+	minLockfileOverlap int
+	// minAttestationsPerSubject is how many independent attestations each
+	// subject digest needs; one disables the check.
+	minAttestationsPerSubject int
+	// minSHAPinned is the percentage of CI action and component
+	// references that must be pinned to a commit SHA; zero disables the
+	// check.
+	minSHAPinned int
+	// stalenessDays is how much newer than a provenance file a build config
+	// or artifact may be before the provenance is reported as stale; zero
+	// disables the check.
+	stalenessDays int
+	// provenance decides which files are provenance candidates, from
+	// provenanceFilePatterns, extra_provenance_patterns, and provenance_dirs.
+	provenance *provenanceMatcher
+	// maxDepth prunes directories nested deeper than this below the
+	// workspace root; negative means unlimited.
+	maxDepth int
+
+	// concurrency is the number of workers analyzing files.
+	concurrency int
+
+	// maxFileSize is the largest file, in bytes, that is analyzed.
+	maxFileSize int64
+	// fileTimeBudget bounds the time spent analyzing one file; zero
+	// disables the bound.
+	fileTimeBudget time.Duration
+
+	// disabledRules holds rule IDs whose findings are dropped.
+	disabledRules map[string]bool
+	// trustedBuilders holds normalized builder ID prefixes; observed
+	// builders matching none of them are reported in the summary.
+	trustedBuilders []string
+	// attestationNaming holds the conventions attestations are paired with
+	// artifacts by: the defaults and any attestation_naming entries.
+	attestationNaming []namingConvention
+	// policyFiles holds the workspace paths of Rego policies evaluated
+	// against each statement; they are compiled once the root is known.
+	policyFiles []string
+
+	// incremental is set when changed_files lists at least one file: only
+	// the listed files are analyzed, and the cross-file checks are skipped.
+	// An empty list runs a full scan.
+	incremental bool
+	// changedFiles holds the cleaned workspace-relative slash paths of the
+	// files an incremental scan analyzes.
+	changedFiles []string
+}
+
+// defaultMaxFileSize is the max_file_size used when the input is unset.
+const defaultMaxFileSize = 20 << 20
+
+// defaultFileTimeBudgetMS is the file_time_budget_ms used when the input is
+// unset.
+const defaultFileTimeBudgetMS = 5000
+
+// parseScanOptions reads and validates the optional scan tool inputs.
+func parseScanOptions(input map[string]any) (scanOptions, error) {
+	var opts scanOptions
+	var err error
+
+	if raw, ok := input["fail_on_severity"]; ok && raw != nil {
+		value, isString := raw.(string)
+		if !isString {
+			return opts, fmt.Errorf("fail_on_severity must be a string, got %T", raw)
+		}
+		if value != "" {
+			sev, err := parseGateSeverity(value)
+			if err != nil {
+				return opts, err
+			}
+			opts.failOnSeverity = strings.ToLower(strings.TrimSpace(value))
+			opts.gateThreshold = sev
+		}
+	}
+
+	if opts.policy, err = parseProvenancePolicy(input); err != nil {
+		return opts, err
+	}
+
+	if opts.followSymlinks, err = boolInput(input, "follow_symlinks", false); err != nil {
+		return opts, err
+	}
+	if opts.respectGitignore, err = boolInput(input, "respect_gitignore", true); err != nil {
+		return opts, err
+	}
+
+	extraSkipDirs, err := stringListInput(input, "skip_dirs")
+	if err != nil {
+		return opts, err
+	}
+	replaceSkipDirs, err := boolInput(input, "replace_skip_dirs", false)
+	if err != nil {
+		return opts, err
+	}
+	if opts.skipDirs, err = newDirMatcher(extraSkipDirs, replaceSkipDirs); err != nil {
+		return opts, err
+	}
+
+	if opts.checkImages, err = boolInput(input, "check_images", true); err != nil {
+		return opts, err
+	}
+	if opts.checkSBOM, err = boolInput(input, "check_sbom", true); err != nil {
+		return opts, err
+	}
+	if opts.checkCI, err = boolInput(input, "check_ci", true); err != nil {
+		return opts, err
+	}
+	if opts.assumeProducesArtifacts, err = boolInput(input, "assume_produces_artifacts", false); err != nil {
+		return opts, err
+	}
+	if opts.followScripts, err = boolInput(input, "follow_scripts", true); err != nil {
+		return opts, err
+	}
+	if opts.collectMetrics, err = boolInput(input, "collect_metrics", true); err != nil {
+		return opts, err
+	}
+	if opts.scanArchives, err = boolInput(input, "scan_archives", false); err != nil {
+		return opts, err
+	}
+	if opts.emitConfirmations, err = boolInput(input, "emit_confirmations", false); err != nil {
+		return opts, err
+	}
+
+	if opts.minLockfileOverlap, err = intInput(input, "min_lockfile_overlap", defaultMinLockfileOverlap); err != nil {
+		return opts, err
+	}
+	if opts.minLockfileOverlap < 0 || opts.minLockfileOverlap > 100 {
+		return opts, fmt.Errorf("min_lockfile_overlap must be between 0 and 100, got %d", opts.minLockfileOverlap)
+	}
+	if opts.minAttestationsPerSubject, err = intInput(input, "min_attestations_per_subject", defaultMinAttestationsPerSubject); err != nil {
+		return opts, err
+	}
+	if opts.minAttestationsPerSubject < 1 {
+		return opts, fmt.Errorf("min_attestations_per_subject must be at least 1, got %d", opts.minAttestationsPerSubject)
+	}
+	if opts.minSHAPinned, err = intInput(input, "min_sha_pinned", defaultMinSHAPinned); err != nil {
+		return opts, err
+	}
+	if opts.minSHAPinned < 0 || opts.minSHAPinned > 100 {
+		return opts, fmt.Errorf("min_sha_pinned must be between 0 and 100, got %d", opts.minSHAPinned)
+	}
+	if opts.stalenessDays, err = intInput(input, "staleness_days", defaultStalenessDays); err != nil {
+		return opts, err
+	}
+	if opts.stalenessDays < 0 {
+		return opts, fmt.Errorf("staleness_days must not be negative, got %d", opts.stalenessDays)
+	}
+
+	dirs := provenanceDirs
+	if _, set := input["provenance_dirs"]; set {
+		if dirs, err = stringListInput(input, "provenance_dirs"); err != nil {
+			return opts, err
+		}
+	}
+	extra, err := stringListInput(input, "extra_provenance_patterns")
+	if err != nil {
+		return opts, err
+	}
+	patterns := append(append([]string{}, provenanceFilePatterns...), extra...)
+	if opts.provenance, err = newProvenanceMatcher(patterns, dirs); err != nil {
+		return opts, fmt.Errorf("extra_provenance_patterns: %w", err)
+	}
+
+	if opts.maxDepth, err = intInput(input, "max_depth", -1); err != nil {
+		return opts, err
+	}
+	if _, set := input["max_depth"]; set && opts.maxDepth < 0 {
+		return opts, fmt.Errorf("max_depth must not be negative, got %d", opts.maxDepth)
+	}
+
+	if opts.concurrency, err = intInput(input, "concurrency", runtime.GOMAXPROCS(0)); err != nil {
+		return opts, err
+	}
+	if opts.concurrency < 1 {
+		return opts, fmt.Errorf("concurrency must be at least 1, got %d", opts.concurrency)
+	}
+
+	maxFileSize, err := intInput(input, "max_file_size", defaultMaxFileSize)
+	if err != nil {
+		return opts, err
+	}
+	if maxFileSize < 1 {
+		return opts, fmt.Errorf("max_file_size must be at least 1, got %d", maxFileSize)
+	}
+	opts.maxFileSize = int64(maxFileSize)
+
+	budget, err := intInput(input, "file_time_budget_ms", defaultFileTimeBudgetMS)
+	if err != nil {
+		return opts, err
+	}
+	if budget < 0 {
+		return opts, fmt.Errorf("file_time_budget_ms must not be negative, got %d", budget)
+	}
+	opts.fileTimeBudget = time.Duration(budget) * time.Millisecond
+
+	disabled, err := stringListInput(input, "disabled_rules")
+	if err != nil {
+		return opts, err
+	}
+	opts.disabledRules = make(map[string]bool, len(disabled))
+	for _, id := range disabled {
+		id = strings.ToUpper(id)
+		if _, known := lookupRule(id); !known {
+			return opts, fmt.Errorf("disabled_rules: unknown rule %q", id)
+		}
+		if id == summaryRuleID {
+			return opts, fmt.Errorf("disabled_rules: %s cannot be disabled", summaryRuleID)
+		}
+		opts.disabledRules[id] = true
+	}
+
+	trusted, err := stringListInput(input, "trusted_builders")
+	if err != nil {
+		return opts, err
+	}
+	for _, id := range trusted {
+		opts.trustedBuilders = append(opts.trustedBuilders, normalizeBuilderID(id))
+	}
+
+	if opts.policyFiles, err = stringListInput(input, "policy_files"); err != nil {
+		return opts, err
+	}
+	if opts.attestationNaming, err = attestationNamingInput(input); err != nil {
+		return opts, err
+	}
+	if opts.changedFiles, err = changedFilesInput(input); err != nil {
+		return opts, err
+	}
+	opts.incremental = len(opts.changedFiles) > 0
+
+	return opts, nil
+}
+
+// changedFilesInput reads changed_files, cleaning each path to a
+// workspace-relative slash path. Absolute paths and paths leaving the
+// workspace are rejected; duplicates are dropped.
+func changedFilesInput(input map[string]any) ([]string, error) {
+	paths, err := stringListInput(input, "changed_files")
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		clean := path.Clean(filepath.ToSlash(p))
+		if path.IsAbs(clean) || filepath.IsAbs(p) {
+			return nil, fmt.Errorf("changed_files entry %q must be relative to the workspace root", p)
+		}
+		if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("changed_files entry %q does not name a file in the workspace", p)
+		}
+		if !seen[clean] {
+			seen[clean] = true
+			out = append(out, clean)
+		}
+	}
+	return out, nil
+}
+
+// boolInput reads an optional boolean input, returning def when unset.
+// Strings such as "true" and "0" are also accepted for command-line and
+// environment convenience.
+func boolInput(input map[string]any, key string, def bool) (bool, error) {
+	raw, ok := input[key]
+	if !ok || raw == nil {
+		return def, nil
+	}
+	switch v := raw.(type) {
+	case bool:
+		return v, nil
+	case string:
+		value, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return false, fmt.Errorf("%s must be a boolean, got %q", key, v)
+		}
+		return value, nil
+	default:
+		return false, fmt.Errorf("%s must be a boolean, got %T", key, raw)
+	}
+}
+
+// intInput reads an optional integer input, returning def when unset.
+// Numbers arrive as float64 from protobuf structs; numeric strings are also
+// accepted for command-line convenience.
+func intInput(input map[string]any, key string, def int) (int, error) {
+	raw, ok := input[key]
+	if !ok || raw == nil {
+		return def, nil
+	}
+	switch v := raw.(type) {
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("%s must be an integer, got %v", key, v)
+		}
+		return int(v), nil
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("%s must be an integer, got %q", key, v)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("%s must be an integer, got %T", key, raw)
+	}
+}
+
+// stringListInput reads an optional list of strings. A single string is
+// split on commas for command-line convenience. Empty entries are dropped.
+func stringListInput(input map[string]any, key string) ([]string, error) {
+	raw, ok := input[key]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	var values []string
+	switch v := raw.(type) {
+	case string:
+		values = strings.Split(v, ",")
+	case []any:
+		for _, item := range v {
+			str, isString := item.(string)
+			if !isString {
+				return nil, fmt.Errorf("%s must be a list of strings, got element %T", key, item)
+			}
+			values = append(values, str)
+		}
+	default:
+		return nil, fmt.Errorf("%s must be a list of strings, got %T", key, raw)
+	}
+
+	out := values[:0]
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			out = append(out, value)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// lateAttestationRuleID flags a release workflow that publishes artifacts
+// before attesting or signing them, leaving a window in which they are
+// public without provenance, and none at all if the attestation fails.
+const lateAttestationRuleID = "PROV-047"
+
+// draftReleaseCommand matches a gh release command creating a draft release.
+var draftReleaseCommand = regexp.MustCompile(`\bgh\s+release\s+create\b.*\s(?:-d|--draft)(?:=true)?(?:\s|$)`)
+
+// stepRef locates a publish or attestation step of a workflow job.
+type stepRef struct {
+	line int
+	step string
+}
+
+// createsDraft reports whether a step of the workflow creates its release
+// as a draft, with gh or a release action.
+func (w *workflowTracker) createsDraft() bool {
+	if w.draftRelease {
+		return true
+	}
+	for _, j := range w.jobs {
+		for _, u := range j.releaseUploads {
+			if u.draft {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// publishesBefore returns the job's first publish step before line, if
+// any. Uploads to a release are left out when the workflow creates it as a
+// draft, since the artifacts stay private until it is published.
+func (w *workflowTracker) publishesBefore(j *workflowJob, line int) (stepRef, bool) {
+	draft := w.createsDraft()
+	first := stepRef{}
+	consider := func(r stepRef) {
+		if r.line < line && (first.line == 0 || r.line < first.line) {
+			first = r
+		}
+	}
+	for _, p := range j.publishRefs {
+		if p.step != publishGitHubRelease || !draft {
+			consider(p)
+		}
+	}
+	if !draft {
+		for _, u := range j.releaseUploads {
+			consider(stepRef{line: u.line, step: u.action})
+		}
+	}
+	return first, first.line != 0
+}
+
+// reportAttestationOrder flags release jobs that publish artifacts before
+// an attestation or signing step of the same job (Medium), and jobs that
+// publish before a job depending on them attests (Low). Container pushes
+// are not publish steps here: cosign signs images in the registry, so the
+// push must come first.
+func (w *workflowTracker) reportAttestationOrder(findings *findingSet, filePath string) {
+	for _, j := range w.jobs {
+		if len(j.attestations) > 0 {
+			last := j.attestations[len(j.attestations)-1]
+			if p, ok := w.publishesBefore(j, last.line); ok {
+				a := firstAttestationAfter(j, p.line)
+				reportLateAttestation(findings, filePath, j, p, j, a, sdk.SeverityMedium,
+					fmt.Sprintf("Job %s publishes artifacts (%s) before attesting them (%s)", j.name, p.step, a.step))
+			}
+			continue
+		}
+		p, ok := w.publishesBefore(j, math.MaxInt)
+		if !ok {
+			continue
+		}
+		for _, attester := range w.jobs {
+			if attester != j && len(attester.attestations) > 0 && w.dependsOn(attester, j.name) {
+				a := attester.attestations[0]
+				reportLateAttestation(findings, filePath, j, p, attester, a, sdk.SeverityLow,
+					fmt.Sprintf("Job %s publishes artifacts (%s) before job %s, which depends on it, attests them (%s)", j.name, p.step, attester.name, a.step))
+				break
+			}
+		}
+	}
+}
+
+// firstAttestationAfter returns the job's first attestation step after
+// line.
+func firstAttestationAfter(j *workflowJob, line int) stepRef {
+	for _, a := range j.attestations {
+		if a.line > line {
+			return a
+		}
+	}
+	return stepRef{}
+}
+
+// reportLateAttestation reports a publish step preceding an attestation.
+func reportLateAttestation(findings *findingSet, filePath string, j *workflowJob, p stepRef, attester *workflowJob, a stepRef, severity pluginv1.Severity, message string) {
+	findings.Finding(lateAttestationRuleID, severity, sdk.ConfidenceMedium, message).
+		At(filePath, p.line, p.line).
+		WithMetadata("type", "attestation_after_publish").
+		WithMetadata("job", j.name).
+		WithMetadata("publish_step", p.step).
+		WithMetadata("publish_line", strconv.Itoa(p.line)).
+		WithMetadata("attestation_job", attester.name).
+		WithMetadata("attestation_step", a.step).
+		WithMetadata("attestation_line", strconv.Itoa(a.line)).
+		Done()
+}
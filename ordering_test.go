@@ -0,0 +1,104 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+func TestScanAttestationAfterPublish(t *testing.T) {
+	workspace := t.TempDir()
+	workflows := filepath.Join(workspace, ".github", "workflows")
+	writeFile(t, filepath.Join(workflows, "release.yml"), strings.Join([]string{
+		"on:",
+		"  push:",
+		"    tags: ['v*']",
+		"jobs:",
+		"  release:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - uses: actions/checkout@v4",
+		"      - run: make dist",
+		"      - run: gh release upload ${{ github.ref_name }} dist/*",
+		"      - uses: actions/attest-build-provenance@v1",
+		"        with:",
+		"          subject-path: dist/*",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workflows, "publish.yml"), strings.Join([]string{
+		"on:",
+		"  push:",
+		"    tags: ['v*']",
+		"jobs:",
+		"  publish:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - uses: actions/checkout@v4",
+		"      - run: npm publish",
+		"  provenance:",
+		"    needs: publish",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - uses: actions/attest-build-provenance@v1",
+		"        with:",
+		"          subject-path: dist/*",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workflows, "image.yml"), strings.Join([]string{
+		"on:",
+		"  push:",
+		"    tags: ['v*']",
+		"jobs:",
+		"  image:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - run: docker push ghcr.io/example/app:${{ github.ref_name }}",
+		"      - run: cosign sign --yes ghcr.io/example/app:${{ github.ref_name }}",
+	}, "\n")+"\n")
+	client := testClient(t)
+
+	found := findByRule(invokeScan(t, client, workspace).GetFindings(), lateAttestationRuleID)
+	byJob := make(map[string]map[string]string)
+	for _, f := range found {
+		byJob[f.GetMetadata()["job"]] = f.GetMetadata()
+	}
+	if len(found) != 2 || byJob["release"] == nil || byJob["publish"] == nil {
+		t.Fatalf("expected the release and publish jobs to be flagged, got %v", byJob)
+	}
+	for _, f := range found {
+		m := f.GetMetadata()
+		switch m["job"] {
+		case "release":
+			if f.GetSeverity() != sdk.SeverityMedium || m["publish_line"] != "10" || m["attestation_line"] != "11" || m["attestation_job"] != "release" {
+				t.Errorf("release finding: severity %v, metadata %v", f.GetSeverity(), m)
+			}
+		case "publish":
+			if f.GetSeverity() != sdk.SeverityLow || m["publish_step"] != publishNPM || m["attestation_job"] != "provenance" || m["attestation_step"] != "actions/attest-build-provenance" {
+				t.Errorf("publish finding: severity %v, metadata %v", f.GetSeverity(), m)
+			}
+		}
+	}
+
+	// Creating the release as a draft and publishing it last keeps the
+	// uploads private until they are attested.
+	writeFile(t, filepath.Join(workflows, "release.yml"), strings.Join([]string{
+		"on:",
+		"  push:",
+		"    tags: ['v*']",
+		"jobs:",
+		"  release:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - uses: actions/checkout@v4",
+		"      - run: make dist",
+		"      - run: gh release create ${{ github.ref_name }} --draft dist/*",
+		"      - uses: actions/attest-build-provenance@v1",
+		"        with:",
+		"          subject-path: dist/*",
+		"      - run: gh release edit ${{ github.ref_name }} --draft=false",
+	}, "\n")+"\n")
+	found = findByRule(invokeScan(t, client, workspace).GetFindings(), lateAttestationRuleID)
+	if len(found) != 1 || found[0].GetMetadata()["job"] != "publish" {
+		t.Errorf("expected only the publish job once the release is a draft, got %d findings", len(found))
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// attestationPairRuleID flags attestations whose file name implies an
+// artifact that is absent, and artifacts missing the attestation their
+// siblings' naming implies.
+const attestationPairRuleID = "PROV-040"
+
+// artifactPlaceholder stands for the artifact file name in an attestation
+// naming convention.
+const artifactPlaceholder = "{artifact}"
+
+// defaultAttestationNaming lists the conventions goreleaser and the
+// slsa-github-generator builders name per-artifact attestations by.
+var defaultAttestationNaming = []string{
+	"{artifact}.intoto.jsonl",
+	"{artifact}.intoto.json",
+	"{artifact}.provenance.json",
+	"{artifact}.att.json",
+}
+
+// artifactExts lists the extensions of release artifacts, compound ones
+// first. A name pairing implies an artifact with one of them even when no
+// subject names it.
+var artifactExts = []string{
+	".tar.gz", ".tar.xz", ".tar.bz2", ".tar.zst",
+	".tgz", ".txz", ".tar", ".zip", ".7z",
+	".deb", ".rpm", ".apk", ".whl", ".jar", ".war", ".gem", ".nupkg", ".crate",
+	".exe", ".msi", ".dmg", ".pkg", ".appimage", ".snap", ".flatpak",
+}
+
+// artifactExt returns the release artifact extension of a file name,
+// lowercased, or "" when it has none.
+func artifactExt(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range artifactExts {
+		if strings.HasSuffix(lower, ext) && len(lower) > len(ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// namingConvention names the attestation of an artifact: dir, relative to
+// the artifact's directory, then prefix, the artifact's file name, and
+// suffix.
+type namingConvention struct {
+	template string
+	dir      string
+	prefix   string
+	suffix   string
+}
+
+// parseNamingConvention reads a convention such as
+// "attestations/{artifact}.intoto.jsonl".
+func parseNamingConvention(template string) (namingConvention, error) {
+	template = strings.TrimSpace(template)
+	if strings.Count(template, artifactPlaceholder) != 1 {
+		return namingConvention{}, fmt.Errorf("attestation_naming: %q must contain %s exactly once", template, artifactPlaceholder)
+	}
+	dir, file := path.Split(template)
+	prefix, suffix, ok := strings.Cut(file, artifactPlaceholder)
+	switch {
+	case !ok:
+		return namingConvention{}, fmt.Errorf("attestation_naming: %q must have %s in its file name", template, artifactPlaceholder)
+	case prefix == "" && suffix == "":
+		return namingConvention{}, fmt.Errorf("attestation_naming: %q does not distinguish attestations from artifacts", template)
+	case strings.ContainsAny(template, `*?[\`) || !resolvable(dir+"x") || strings.HasPrefix(path.Clean(dir+"x"), ".."):
+		return namingConvention{}, fmt.Errorf("attestation_naming: %q must be a relative path below the artifact's directory without globs", template)
+	}
+	if dir != "" {
+		dir = path.Clean(dir)
+	}
+	return namingConvention{template: template, dir: dir, prefix: prefix, suffix: suffix}, nil
+}
+
+// attestationNamingInput reads the attestation_naming input, which adds
+// conventions to the defaults.
+func attestationNamingInput(input map[string]any) ([]namingConvention, error) {
+	extra, err := stringListInput(input, "attestation_naming")
+	if err != nil {
+		return nil, err
+	}
+	var conventions []namingConvention
+	for _, template := range append(append([]string{}, defaultAttestationNaming...), extra...) {
+		c, err := parseNamingConvention(template)
+		if err != nil {
+			return nil, err
+		}
+		conventions = append(conventions, c)
+	}
+	return conventions, nil
+}
+
+// artifactOf returns the artifact an attestation at rel, a slash-separated
+// workspace path, is named for under the convention.
+func (c namingConvention) artifactOf(rel string) (string, bool) {
+	dir, file := path.Split(rel)
+	if len(file) <= len(c.prefix)+len(c.suffix) || !strings.HasPrefix(file, c.prefix) || !strings.HasSuffix(file, c.suffix) {
+		return "", false
+	}
+	dir = path.Clean(dir)
+	if c.dir != "" {
+		if dir != c.dir && !strings.HasSuffix(dir, "/"+c.dir) {
+			return "", false
+		}
+		dir = path.Clean(strings.TrimSuffix(dir, c.dir))
+	}
+	return path.Join(dir, file[len(c.prefix):len(file)-len(c.suffix)]), true
+}
+
+// attestationOf returns the attestation the convention names for an
+// artifact at rel.
+func (c namingConvention) attestationOf(rel string) string {
+	dir, file := path.Split(rel)
+	return path.Join(dir, c.dir, c.prefix+file+c.suffix)
+}
+
+// attestationPair is an attestation and the artifact its name implies.
+type attestationPair struct {
+	attestation string
+	artifact    string
+	convention  namingConvention
+}
+
+// pairAttestations pairs each attestation with the artifact its file name
+// implies under the naming conventions. The implied artifact is taken to be
+// real when its name has a release artifact extension or a subject of the
+// attestation names it; such an artifact that is absent is reported. A
+// present artifact is verified against the subject that names it, or the
+// only subject, and that subject is then left out of the archive subject
+// check. Directories holding a pair are then searched for artifacts of the
+// same kind that lack the attestation the convention calls for, other than
+// those an attested checksums file covers.
+func pairAttestations(ctx context.Context, findings *findingSet, summary *scanSummary, conventions []namingConvention, maxFileSize int64) error {
+	root := findings.root
+	// subjects maps each attestation's workspace path to its subjects.
+	subjects := make(map[string][]int)
+	for i, subj := range summary.subjectRecords {
+		if subj.archive == "" {
+			rel := workspacePath(root, subj.location)
+			subjects[rel] = append(subjects[rel], i)
+		}
+	}
+	attestations := make(map[string]bool, len(summary.attestationPaths))
+	for _, p := range summary.attestationPaths {
+		attestations[workspacePath(root, p)] = true
+	}
+
+	// established maps each directory holding a pair to its conventions by
+	// artifact extension, with an example pair.
+	established := make(map[string]map[string]attestationPair)
+	for _, location := range sortedKeys(attestations) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, c := range conventions {
+			artifact, ok := c.artifactOf(location)
+			if !ok {
+				continue
+			}
+			pair := attestationPair{attestation: location, artifact: artifact, convention: c}
+			attestationPath := filepath.Join(root, filepath.FromSlash(location))
+			named := subjectNaming(summary, subjects[location], path.Base(artifact))
+			ext := artifactExt(artifact)
+			if ext == "" && named < 0 {
+				continue
+			}
+			artifactPath := filepath.Join(root, filepath.FromSlash(artifact))
+			info, err := findings.files().Stat(artifactPath)
+			if err != nil || !info.Mode().IsRegular() {
+				reportAttestationPair(findings, attestationPath, 0, pair, sdk.ConfidenceMedium, "dangling_attestation",
+					fmt.Sprintf("Attestation %s implies artifact %s, which does not exist", location, artifact)).Done()
+				break
+			}
+			if ext != "" {
+				dir := path.Dir(artifact)
+				if established[dir] == nil {
+					established[dir] = make(map[string]attestationPair)
+				}
+				if _, ok := established[dir][ext]; !ok {
+					established[dir][ext] = pair
+				}
+			}
+			if named < 0 && len(subjects[location]) == 1 {
+				named = subjects[location][0]
+			}
+			if named < 0 {
+				if len(subjects[location]) > 0 {
+					reportAttestationPair(findings, attestationPath, summary.subjectRecords[subjects[location][0]].line, pair, sdk.ConfidenceMedium, "artifact_not_a_subject",
+						fmt.Sprintf("Attestation %s is named for %s, but none of its subjects is", location, artifact)).Done()
+				}
+				break
+			}
+			verifyPairedSubject(findings, summary, named, pair, fileDigest(findings.files(), artifactPath, maxFileSize))
+			break
+		}
+	}
+
+	for _, dir := range sortedKeys(established) {
+		entries, err := findings.files().ReadDir(filepath.Join(root, filepath.FromSlash(dir)))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.Type().IsRegular() {
+				continue
+			}
+			pair, ok := established[dir][artifactExt(e.Name())]
+			if !ok {
+				continue
+			}
+			artifact := path.Join(dir, e.Name())
+			if attestations[pair.convention.attestationOf(artifact)] || summary.checksumCovered[artifact] {
+				continue
+			}
+			expected := pair.convention.attestationOf(artifact)
+			reportAttestationPair(findings, filepath.Join(root, filepath.FromSlash(artifact)), 0,
+				attestationPair{attestation: expected, artifact: artifact, convention: pair.convention}, sdk.ConfidenceLow, "unattested_artifact",
+				fmt.Sprintf("Artifact %s has no attestation %s, unlike %s", artifact, expected, pair.artifact)).
+				WithMetadata("paired_example", pair.attestation).
+				Done()
+		}
+	}
+	return nil
+}
+
+// subjectNaming returns the index of the subject among indexes whose base
+// name is base, or -1.
+func subjectNaming(summary *scanSummary, indexes []int, base string) int {
+	for _, i := range indexes {
+		if path.Base(slashName(summary.subjectRecords[i].name)) == base {
+			return i
+		}
+	}
+	return -1
+}
+
+// verifyPairedSubject checks a subject against the digest of the artifact
+// its attestation is paired with, reporting a mismatch as in the archive
+// subject check.
+func verifyPairedSubject(findings *findingSet, summary *scanSummary, i int, pair attestationPair, digest string) {
+	subj := &summary.subjectRecords[i]
+	if subj.paired {
+		// Already verified through its checksums file.
+		return
+	}
+	subj.paired = true
+	switch digest {
+	case "":
+		// Too large or unreadable to hash.
+		return
+	case subj.sha256:
+		summary.subjectsVerified++
+		return
+	}
+	fb := findings.Finding(
+		subjectDigestMismatchRuleID,
+		sdk.SeverityHigh,
+		sdk.ConfidenceHigh,
+		fmt.Sprintf("Attestation subject %s does not match the sha256 digest of its artifact", subj.name),
+	).
+		At(subj.location, subj.line, subj.line).
+		WithMetadata("type", "subject_digest_mismatch").
+		WithMetadata("subject", subj.name).
+		WithMetadata("subject_digest", "sha256:"+subj.sha256).
+		WithMetadata("artifact", pair.artifact).
+		WithMetadata("artifact_digest", "sha256:"+digest).
+		WithMetadata("naming_convention", pair.convention.template)
+	if subj.index >= 0 {
+		fb.WithMetadata("statement_index", strconv.Itoa(subj.index))
+	}
+	if subj.builder != "" {
+		fb.WithMetadata("builder_id", subj.builder)
+	}
+	fb.Done()
+}
+
+// reportAttestationPair starts a finding for an inconsistent pair.
+func reportAttestationPair(findings *findingSet, location string, line int, pair attestationPair, confidence pluginv1.Confidence, kind, message string) *findingBuilder {
+	fb := findings.Finding(attestationPairRuleID, sdk.SeverityLow, confidence, message).
+		At(location, line, line).
+		WithMetadata("type", kind).
+		WithMetadata("attestation", pair.attestation).
+		WithMetadata("artifact", pair.artifact).
+		WithMetadata("naming_convention", pair.convention.template)
+	return fb
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNamingConvention(t *testing.T) {
+	tests := []struct {
+		template    string
+		attestation string
+		artifact    string
+	}{
+		{"{artifact}.intoto.jsonl", "dist/app_1.2.0_linux_amd64.tar.gz.intoto.jsonl", "dist/app_1.2.0_linux_amd64.tar.gz"},
+		{"{artifact}.intoto.jsonl", "app.intoto.jsonl", "app"},
+		{"attestations/{artifact}.json", "dist/attestations/app.zip.json", "dist/app.zip"},
+		{"attestations/{artifact}.json", "dist/app.zip.json", ""},
+		{"{artifact}.intoto.jsonl", "dist/.intoto.jsonl", ""},
+	}
+	for _, tt := range tests {
+		c, err := parseNamingConvention(tt.template)
+		if err != nil {
+			t.Fatalf("parseNamingConvention(%q): %v", tt.template, err)
+		}
+		artifact, ok := c.artifactOf(tt.attestation)
+		if artifact != tt.artifact || ok != (tt.artifact != "") {
+			t.Errorf("%s: artifactOf(%q) = %q, %v, want %q", tt.template, tt.attestation, artifact, ok, tt.artifact)
+		}
+		if ok && c.attestationOf(artifact) != tt.attestation {
+			t.Errorf("%s: attestationOf(%q) = %q, want %q", tt.template, artifact, c.attestationOf(artifact), tt.attestation)
+		}
+	}
+
+	for _, bad := range []string{"{artifact}", "intoto.jsonl", "{artifact}.{artifact}", "../att/{artifact}.json", "{artifact}/x.json", "*/{artifact}.json"} {
+		if _, err := parseNamingConvention(bad); err == nil {
+			t.Errorf("parseNamingConvention(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestScanPairsAttestationsWithArtifacts(t *testing.T) {
+	const wrong = "0000000000000000000000000000000000000000000000000000000000000000"
+	workspace := t.TempDir()
+	linux, darwin := "linux build", "darwin build"
+	writeFile(t, filepath.Join(workspace, "dist", "app_linux_amd64.tar.gz"), linux)
+	writeFile(t, filepath.Join(workspace, "dist", "app_linux_amd64.tar.gz.intoto.jsonl"),
+		subjectStatement("app_linux_amd64.tar.gz", sha256Hex([]byte(linux)))+"\n")
+	// The subject is named differently, so only the pairing ties it to the
+	// archive it is checked against.
+	writeFile(t, filepath.Join(workspace, "dist", "app_darwin_amd64.tar.gz"), darwin)
+	writeFile(t, filepath.Join(workspace, "dist", "app_darwin_amd64.tar.gz.intoto.jsonl"),
+		subjectStatement("app-darwin", wrong)+"\n")
+	writeFile(t, filepath.Join(workspace, "dist", "app_windows_amd64.zip"), "windows build")
+	writeFile(t, filepath.Join(workspace, "dist", "app_freebsd_amd64.tar.gz"), "freebsd build")
+	writeFile(t, filepath.Join(workspace, "dist", "checksums.txt"), "")
+	writeFile(t, filepath.Join(workspace, "dist", "app_arm64.deb.intoto.jsonl"),
+		subjectStatement("app_arm64.deb", wrong)+"\n")
+	// Named like no artifact and naming none, as slsa-github-generator's
+	// multiple.intoto.jsonl.
+	writeFile(t, filepath.Join(workspace, "dist", "multiple.intoto.jsonl"),
+		subjectStatement("app_windows_amd64.zip", wrong)+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	mismatches := findByRule(resp.GetFindings(), subjectDigestMismatchRuleID)
+	if len(mismatches) != 1 {
+		t.Fatalf("expected one %s finding, got %d", subjectDigestMismatchRuleID, len(mismatches))
+	}
+	meta := mismatches[0].GetMetadata()
+	if meta["artifact"] != "dist/app_darwin_amd64.tar.gz" || meta["naming_convention"] != "{artifact}.intoto.jsonl" {
+		t.Errorf("unexpected mismatch metadata: %v", meta)
+	}
+
+	want := map[string]string{
+		"dist/app_arm64.deb.intoto.jsonl": "dangling_attestation",
+		"dist/app_freebsd_amd64.tar.gz":   "unattested_artifact",
+	}
+	pairs := findByRule(resp.GetFindings(), attestationPairRuleID)
+	if len(pairs) != len(want) {
+		t.Fatalf("expected %d %s findings, got %d", len(want), attestationPairRuleID, len(pairs))
+	}
+	for _, f := range pairs {
+		location := f.GetLocation().GetFilePath()
+		if got := f.GetMetadata()["type"]; got != want[location] {
+			t.Errorf("%s: type = %q, want %q", location, got, want[location])
+		}
+		if severityNames[f.GetSeverity()] != "low" {
+			t.Errorf("%s: severity %s, want low", location, severityNames[f.GetSeverity()])
+		}
+		if got := f.GetMetadata()["attestation"]; location == "dist/app_freebsd_amd64.tar.gz" && got != location+".intoto.jsonl" {
+			t.Errorf("%s: attestation = %q, want the conventional name", location, got)
+		}
+	}
+}
+
+func TestScanAttestationNamingInput(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "release", "attestations", "app.bin.json"),
+		subjectStatement("app.bin", strings.Repeat("ab", 32))+"\n")
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root":     workspace,
+		"attestation_naming": "attestations/{artifact}.json",
+	})
+
+	pairs := findByRule(resp.GetFindings(), attestationPairRuleID)
+	if len(pairs) != 1 || pairs[0].GetMetadata()["artifact"] != "release/app.bin" {
+		t.Fatalf("expected the configured convention to pair release/app.bin, got %d findings", len(pairs))
+	}
+
+	_, err := parseScanOptions(map[string]any{"attestation_naming": "{artifact}"})
+	if err == nil || !strings.Contains(err.Error(), "attestation_naming") {
+		t.Errorf("expected an attestation_naming error, got %v", err)
+	}
+}
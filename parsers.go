@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// Kinds of parser capability advertised in the manifest. Each capability
+// is named "<kind>:<value>", as in "predicate-type:https://slsa.dev/provenance/v1".
+const (
+	parserKindPredicateType   = "predicate-type"
+	parserKindPredicatePrefix = "predicate-type-prefix"
+	parserKindEnvelope        = "envelope"
+	parserKindArchive         = "archive"
+	parserKindImageLayout     = "image-layout"
+	parserKindKeyType         = "key-type"
+)
+
+// parserCapability is something the provenance parsers can read, advertised
+// so hosts routing attestation work between plugins know what this one
+// handles.
+type parserCapability struct {
+	kind        string
+	value       string
+	description string
+}
+
+// name returns the capability name advertised in the manifest.
+func (c parserCapability) name() string {
+	return c.kind + ":" + c.value
+}
+
+// predicateParsers are the predicate types whose predicates are decoded and
+// checked, beyond the statement itself.
+var predicateParsers = []parserCapability{
+	{parserKindPredicateType, slsaRecipePredicateType, "SLSA provenance v0.1, checked and reported as deprecated"},
+	{parserKindPredicateType, slsaProvenancePrefix + "v0.2", "SLSA provenance v0.2"},
+	{parserKindPredicateType, slsaProvenancePrefix + "v1", "SLSA provenance v1"},
+	{parserKindPredicateType, pypiPredicatePrefix + "publish/v1", "PyPI publish attestations (PEP 740)"},
+}
+
+// parserCapabilities lists everything the parsers read: predicate types,
+// SBOM predicate type prefixes, envelope formats, archive and image layout
+// formats, and the key types the signing key policy assesses. It is built
+// from the tables the parsers themselves use, so it cannot drift from them.
+func parserCapabilities() []parserCapability {
+	caps := append([]parserCapability(nil), predicateParsers...)
+	for _, prefix := range sbomPredicateTypes {
+		caps = append(caps, parserCapability{parserKindPredicatePrefix, prefix, "SBOM attestations, counted toward SBOM coverage"})
+	}
+	caps = append(caps,
+		parserCapability{parserKindEnvelope, envelopeNone, "Bare in-toto statements, as JSON or JSONL"},
+		parserCapability{parserKindEnvelope, envelopeDSSE, "DSSE envelopes; signatures are counted, not verified"},
+		parserCapability{parserKindEnvelope, envelopeSigstore, "Sigstore bundles, with transparency log entries and certificates"},
+		parserCapability{parserKindEnvelope, envelopePEP740, "PEP 740 attestation objects"},
+	)
+	for _, ext := range archiveExtensions {
+		caps = append(caps, parserCapability{parserKindArchive, strings.TrimPrefix(ext, "."), "Archives inspected for embedded provenance and checked against subject digests"})
+	}
+	caps = append(caps,
+		parserCapability{parserKindImageLayout, "oci-layout", "OCI image layouts, with BuildKit attestation manifests"},
+		parserCapability{parserKindImageLayout, "docker-save", "docker save tarballs"},
+	)
+	for _, keyType := range []string{keyTypeRSA, keyTypeDSA, keyTypeECDSA, keyTypeEd25519} {
+		caps = append(caps, parserCapability{parserKindKeyType, keyType, "Public keys and certificates assessed against the signing key policy"})
+	}
+	return caps
+}
+
+// advertiseParsers adds the parser capabilities to a manifest, one
+// capability without tools each, since the manifest carries no free-form
+// metadata.
+func advertiseParsers(b *sdk.ManifestBuilder) *sdk.ManifestBuilder {
+	for _, c := range parserCapabilities() {
+		b = b.Capability(c.name(), c.description).Done()
+	}
+	return b
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+)
+
+func TestManifestAdvertisesFixturePredicateTypes(t *testing.T) {
+	manifest, err := buildServer().GetManifest(context.Background(), &pluginv1.GetManifestRequest{ApiVersion: "v1"})
+	if err != nil {
+		t.Fatalf("GetManifest: %v", err)
+	}
+	advertised := make(map[string]bool)
+	var prefixes []string
+	for _, c := range manifest.GetCapabilities() {
+		advertised[c.GetName()] = true
+		if prefix, ok := strings.CutPrefix(c.GetName(), parserKindPredicatePrefix+":"); ok {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if !advertised["provenance"] {
+		t.Error("provenance capability missing from the manifest")
+	}
+
+	seen := 0
+	err = filepath.WalkDir(testdataDir(t), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(path, ".golden.json") {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || !looksLikeAttestation(data) {
+			return err
+		}
+		statements, err := parseProvenance(context.Background(), data)
+		if err != nil {
+			return nil
+		}
+		for _, ps := range statements {
+			seen++
+			if pt := ps.Statement.PredicateType; pt != "" && !advertised[parserKindPredicateType+":"+pt] && !hasAnyPrefix(pt, prefixes) {
+				t.Errorf("%s: predicate type %s is not advertised", path, pt)
+			}
+			if !advertised[parserKindEnvelope+":"+ps.Envelope] {
+				t.Errorf("%s: envelope %s is not advertised", path, ps.Envelope)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen == 0 {
+		t.Fatal("no statements found in the fixtures")
+	}
+}
+
+func TestParserCapabilitiesUnique(t *testing.T) {
+	names := make(map[string]bool)
+	for _, c := range parserCapabilities() {
+		if names[c.name()] {
+			t.Errorf("capability %s advertised twice", c.name())
+		}
+		names[c.name()] = true
+		if c.description == "" {
+			t.Errorf("capability %s has no description", c.name())
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Dependency update bots whose configuration is recognized.
+const (
+	botRenovate   = "renovate"
+	botDependabot = "dependabot"
+)
+
+// Ecosystems whose digest pins a bot may maintain.
+const (
+	pinEcosystemDocker  = "docker"
+	pinEcosystemActions = "actions"
+)
+
+// renovateConfigNames are the file names Renovate reads its repository
+// config from, at the root or under .github or .gitlab.
+var renovateConfigNames = map[string]bool{
+	"renovate.json":     true,
+	"renovate.json5":    true,
+	".renovate.json5":   true,
+	".renovaterc":       true,
+	".renovaterc.json":  true,
+	".renovaterc.json5": true,
+}
+
+// pinConfigDirs are the workspace-relative directories bot configs are read
+// from.
+var pinConfigDirs = map[string]bool{".": true, ".github": true, ".gitlab": true}
+
+// pinningBot returns the bot a workspace-relative slash path configures, or
+// "" if it is not a bot config.
+func pinningBot(rel string) string {
+	dir, name := path.Dir(rel), path.Base(rel)
+	switch {
+	case renovateConfigNames[name] && pinConfigDirs[dir]:
+		return botRenovate
+	case rel == ".github/dependabot.yml" || rel == ".github/dependabot.yaml":
+		return botDependabot
+	}
+	return ""
+}
+
+// renovatePinPresets maps Renovate presets that enable digest pinning to the
+// ecosystems they pin.
+var renovatePinPresets = map[string][]string{
+	"docker:pindigests":                         {pinEcosystemDocker},
+	"helpers:pingithubactiondigests":            {pinEcosystemActions},
+	"helpers:pingithubactiondigeststosemver":    {pinEcosystemActions},
+	"config:best-practices":                     {pinEcosystemDocker, pinEcosystemActions},
+	"github>renovatebot/.github:best-practices": {pinEcosystemDocker, pinEcosystemActions},
+}
+
+// renovateEcosystems maps Renovate managers and datasources to the
+// ecosystem whose pins they maintain.
+var renovateEcosystems = map[string]string{
+	"docker":         pinEcosystemDocker,
+	"dockerfile":     pinEcosystemDocker,
+	"docker-compose": pinEcosystemDocker,
+	"kubernetes":     pinEcosystemDocker,
+	"helm-values":    pinEcosystemDocker,
+	"github-actions": pinEcosystemActions,
+	"github-tags":    pinEcosystemActions,
+}
+
+// renovateRule is the subset of a Renovate package rule or manager block
+// that decides digest pinning.
+type renovateRule struct {
+	Enabled          *bool    `json:"enabled"`
+	PinDigests       *bool    `json:"pinDigests"`
+	Extends          []string `json:"extends"`
+	MatchManagers    []string `json:"matchManagers"`
+	MatchDatasources []string `json:"matchDatasources"`
+}
+
+// renovateConfig is the subset of a Renovate repository config that decides
+// digest pinning.
+type renovateConfig struct {
+	renovateRule
+	PackageRules []renovateRule `json:"packageRules"`
+	// Manager blocks, which apply their settings to one manager.
+	Docker        *renovateRule `json:"docker"`
+	Dockerfile    *renovateRule `json:"dockerfile"`
+	DockerCompose *renovateRule `json:"docker-compose"`
+	Kubernetes    *renovateRule `json:"kubernetes"`
+	HelmValues    *renovateRule `json:"helm-values"`
+	GitHubActions *renovateRule `json:"github-actions"`
+}
+
+// dependabotEcosystems maps Dependabot package ecosystems to the ecosystem
+// whose pins they maintain. Dependabot keeps existing digest pins current
+// but does not add them.
+var dependabotEcosystems = map[string]string{
+	"docker":         pinEcosystemDocker,
+	"docker-compose": pinEcosystemDocker,
+	"github-actions": pinEcosystemActions,
+}
+
+var (
+	dependabotEcosystemPattern = regexp.MustCompile(`^\s*-?\s*package-ecosystem:\s*["']?([\w-]+)`)
+	dependabotDisabledPattern  = regexp.MustCompile(`^\s*open-pull-requests-limit:\s*["']?0\b`)
+)
+
+// scanPinningConfig records a Renovate or Dependabot config and the
+// ecosystems whose digest pins it maintains. Configs that cannot be parsed
+// count as parse failures.
+func scanPinningConfig(ctx context.Context, fsys workspaceFS, filePath string, summary *scanSummary) error {
+	data, err := fsys.ReadFile(filePath)
+	if err != nil {
+		summary.filesUnreadable++
+		return nil
+	}
+
+	var ecosystems []string
+	bot := botRenovate
+	if strings.HasPrefix(filepath.Base(filePath), "dependabot.") {
+		bot = botDependabot
+		ecosystems, err = dependabotPinnedEcosystems(ctx, data)
+	} else {
+		ecosystems, err = renovatePinnedEcosystems(data, filepath.Ext(filePath) == ".json5")
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		summary.parseFailures++
+		return nil
+	}
+
+	if summary.dependencyBots == nil {
+		summary.dependencyBots = make(map[string]bool)
+	}
+	summary.dependencyBots[bot] = true
+	for _, eco := range ecosystems {
+		summary.recordPinManager(eco, bot)
+	}
+	return nil
+}
+
+// renovatePinnedEcosystems returns the ecosystems a Renovate config pins by
+// digest. Renovate accepts JSON5 in every config file name, so plain JSON
+// that fails to decode is retried as JSON5.
+func renovatePinnedEcosystems(data []byte, json5 bool) ([]string, error) {
+	var cfg renovateConfig
+	if json5 || json.Unmarshal(data, &cfg) != nil {
+		converted, convErr := json5ToJSON(data)
+		if convErr != nil {
+			return nil, convErr
+		}
+		cfg = renovateConfig{}
+		if err := json.Unmarshal(converted, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Enabled != nil && !*cfg.Enabled {
+		return nil, nil
+	}
+
+	pinned := make(map[string]bool)
+	for _, preset := range cfg.Extends {
+		for _, eco := range renovatePinPresets[strings.ToLower(preset)] {
+			pinned[eco] = true
+		}
+	}
+	if cfg.PinDigests != nil {
+		for _, eco := range []string{pinEcosystemDocker, pinEcosystemActions} {
+			pinned[eco] = *cfg.PinDigests
+		}
+	}
+	for _, block := range []struct {
+		eco  string
+		rule *renovateRule
+	}{
+		{pinEcosystemDocker, cfg.Docker},
+		{pinEcosystemDocker, cfg.Dockerfile},
+		{pinEcosystemDocker, cfg.DockerCompose},
+		{pinEcosystemDocker, cfg.Kubernetes},
+		{pinEcosystemDocker, cfg.HelmValues},
+		{pinEcosystemActions, cfg.GitHubActions},
+	} {
+		if block.rule != nil && block.rule.PinDigests != nil {
+			pinned[block.eco] = *block.rule.PinDigests
+		}
+	}
+	// Later package rules override earlier ones, as in Renovate.
+	for _, rule := range cfg.PackageRules {
+		if rule.PinDigests == nil || (rule.Enabled != nil && !*rule.Enabled) {
+			continue
+		}
+		for _, eco := range rule.ecosystems() {
+			pinned[eco] = *rule.PinDigests
+		}
+	}
+
+	var ecosystems []string
+	for _, eco := range sortedKeys(pinned) {
+		if pinned[eco] {
+			ecosystems = append(ecosystems, eco)
+		}
+	}
+	return ecosystems, nil
+}
+
+// ecosystems returns the ecosystems a package rule applies to. A rule that
+// matches no manager or datasource applies to every ecosystem; one that
+// matches only others applies to none.
+func (r renovateRule) ecosystems() []string {
+	if len(r.MatchManagers) == 0 && len(r.MatchDatasources) == 0 {
+		return []string{pinEcosystemDocker, pinEcosystemActions}
+	}
+	seen := make(map[string]bool)
+	var ecosystems []string
+	for _, m := range append(append([]string(nil), r.MatchManagers...), r.MatchDatasources...) {
+		if eco := renovateEcosystems[m]; eco != "" && !seen[eco] {
+			seen[eco] = true
+			ecosystems = append(ecosystems, eco)
+		}
+	}
+	return ecosystems
+}
+
+// dependabotPinnedEcosystems returns the ecosystems a Dependabot config keeps
+// updated. Update entries with open-pull-requests-limit 0 are disabled.
+func dependabotPinnedEcosystems(ctx context.Context, data []byte) ([]string, error) {
+	var ecosystems []string
+	current, enabled := "", false
+	flush := func() {
+		if current != "" && enabled {
+			ecosystems = append(ecosystems, current)
+		}
+		current = ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	lineNum := 0
+	var pace cancelCheck
+	for scanner.Scan() {
+		lineNum++
+		if pace.due(len(scanner.Bytes())) && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		line := scanner.Text()
+		if m := dependabotEcosystemPattern.FindStringSubmatch(line); m != nil {
+			flush()
+			current, enabled = dependabotEcosystems[m[1]], true
+			continue
+		}
+		if dependabotDisabledPattern.MatchString(line) {
+			enabled = false
+		}
+	}
+	flush()
+	return ecosystems, scanner.Err()
+}
+
+// recordPinManager records that bot maintains the digest pins of eco.
+func (s *scanSummary) recordPinManager(eco, bot string) {
+	if s.pinManagers == nil {
+		s.pinManagers = make(map[string]map[string]bool)
+	}
+	if s.pinManagers[eco] == nil {
+		s.pinManagers[eco] = make(map[string]bool)
+	}
+	s.pinManagers[eco][bot] = true
+}
+
+// mergePinning folds the bot configs recorded in other into s.
+func (s *scanSummary) mergePinning(other *scanSummary) {
+	for bot := range other.dependencyBots {
+		if s.dependencyBots == nil {
+			s.dependencyBots = make(map[string]bool)
+		}
+		s.dependencyBots[bot] = true
+	}
+	for eco, bots := range other.pinManagers {
+		for bot := range bots {
+			s.recordPinManager(eco, bot)
+		}
+	}
+}
+
+// pinsManagedBy returns the comma-separated bots maintaining the digest pins
+// of eco, or "" if none do.
+func (s *scanSummary) pinsManagedBy(eco string) string {
+	return strings.Join(sortedKeys(s.pinManagers[eco]), ",")
+}
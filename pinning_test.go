@@ -0,0 +1,150 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+func TestRenovatePinnedEcosystems(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		json5  bool
+		want   string
+	}{
+		{name: "none", config: `{"extends": ["config:recommended"]}`, want: ""},
+		{name: "top-level pinDigests", config: `{"pinDigests": true}`, want: "actions,docker"},
+		{name: "presets", config: `{"extends": ["docker:pinDigests", "helpers:pinGitHubActionDigests"]}`, want: "actions,docker"},
+		{name: "best practices", config: `{"extends": ["config:best-practices"]}`, want: "actions,docker"},
+		{name: "manager block", config: `{"dockerfile": {"pinDigests": true}}`, want: "docker"},
+		{
+			name:   "package rules",
+			config: `{"packageRules": [{"matchManagers": ["github-actions"], "pinDigests": true}, {"matchDatasources": ["npm"], "pinDigests": true}]}`,
+			want:   "actions",
+		},
+		{
+			name:   "later rule disables",
+			config: `{"pinDigests": true, "packageRules": [{"matchManagers": ["dockerfile"], "pinDigests": false}]}`,
+			want:   "actions",
+		},
+		{name: "disabled", config: `{"enabled": false, "pinDigests": true}`, want: ""},
+		{
+			name:   "json5",
+			config: "{\n  // keep images pinned\n  extends: ['docker:pinDigests',],\n}",
+			json5:  true,
+			want:   "docker",
+		},
+		{name: "json5 in a json file", config: `{pinDigests: true}`, want: "actions,docker"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ecosystems, err := renovatePinnedEcosystems([]byte(tc.config), tc.json5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			summary := &scanSummary{}
+			for _, eco := range ecosystems {
+				summary.recordPinManager(eco, botRenovate)
+			}
+			got := ""
+			for _, eco := range sortedKeys(summary.pinManagers) {
+				if got != "" {
+					got += ","
+				}
+				got += eco
+			}
+			if got != tc.want {
+				t.Errorf("pinned ecosystems = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScanPinningMaintenance(t *testing.T) {
+	tests := []struct {
+		name           string
+		files          map[string]string
+		wantBots       string
+		wantDocker     string
+		wantActions    string
+		wantConfidence pluginv1.Confidence
+	}{
+		{
+			name:           "no bot",
+			wantConfidence: sdk.ConfidenceHigh,
+		},
+		{
+			name: "renovate",
+			files: map[string]string{
+				".github/renovate.json5": "{\n  extends: ['config:recommended', 'docker:pinDigests'],\n}\n",
+			},
+			wantBots:       "renovate",
+			wantDocker:     "renovate",
+			wantConfidence: sdk.ConfidenceMedium,
+		},
+		{
+			name: "dependabot",
+			files: map[string]string{
+				".github/dependabot.yml": "version: 2\nupdates:\n  - package-ecosystem: \"docker\"\n    directory: \"/\"\n  - package-ecosystem: github-actions\n    directory: \"/\"\n    open-pull-requests-limit: 0\n  - package-ecosystem: gomod\n    directory: \"/\"\n",
+			},
+			wantBots:       "dependabot",
+			wantDocker:     "dependabot",
+			wantConfidence: sdk.ConfidenceMedium,
+		},
+		{
+			name: "actions only",
+			files: map[string]string{
+				"renovate.json": `{"extends": ["helpers:pinGitHubActionDigests"]}`,
+			},
+			wantBots:       "renovate",
+			wantActions:    "renovate",
+			wantConfidence: sdk.ConfidenceHigh,
+		},
+		{
+			name: "nested config ignored",
+			files: map[string]string{
+				"vendor/lib/renovate.json": `{"pinDigests": true}`,
+			},
+			wantConfidence: sdk.ConfidenceHigh,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			writeFile(t, filepath.Join(workspace, "Dockerfile"), "FROM golang:1.22\n")
+			for name, content := range tc.files {
+				writeFile(t, filepath.Join(workspace, filepath.FromSlash(name)), content)
+			}
+
+			resp := invokeScan(t, testClient(t), workspace)
+
+			tagOnly := findByRule(resp.GetFindings(), tagOnlyImageRuleID)
+			if len(tagOnly) != 1 {
+				t.Fatalf("expected 1 %s finding, got %d", tagOnlyImageRuleID, len(tagOnly))
+			}
+			if got := tagOnly[0].GetConfidence(); got != tc.wantConfidence {
+				t.Errorf("%s confidence = %v, want %v", tagOnlyImageRuleID, got, tc.wantConfidence)
+			}
+			if got := tagOnly[0].GetSeverity(); got != sdk.SeverityLow {
+				t.Errorf("%s severity = %v, want low", tagOnlyImageRuleID, got)
+			}
+			if got := tagOnly[0].GetMetadata()["pins_managed_by"]; got != tc.wantDocker {
+				t.Errorf("pins_managed_by = %q, want %q", got, tc.wantDocker)
+			}
+
+			meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+			for key, want := range map[string]string{
+				"dependency_bots":        tc.wantBots,
+				"docker_pins_managed_by": tc.wantDocker,
+				"action_pins_managed_by": tc.wantActions,
+			} {
+				if meta[key] != want {
+					t.Errorf("%s = %q, want %q", key, meta[key], want)
+				}
+			}
+		})
+	}
+}
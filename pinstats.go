@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// shaPinningRatioRuleID flags a workspace whose CI configs pin too few of
+// the actions and components they reference to a commit SHA. It sums up
+// what PROV-027 reports reference by reference.
+const shaPinningRatioRuleID = "PROV-048"
+
+// defaultMinSHAPinned is the min_sha_pinned used when the input is unset,
+// as a percentage.
+const defaultMinSHAPinned = 50
+
+var (
+	// gitlabComponent matches an include of a GitLab CI/CD component and
+	// captures its reference.
+	gitlabComponent = regexp.MustCompile(`^(?:-\s+)?component:\s*["']?([^\s"'#]+)`)
+	// versionTag matches a ref that names a release, such as v4, 1.2.3, or
+	// v2.0.0-rc.1, rather than a branch.
+	versionTag = regexp.MustCompile(`^v?\d+(?:\.\d+)*(?:[-+][0-9A-Za-z.-]+)?$`)
+)
+
+// ciPinStats counts the actions and components CI configs reference from
+// outside the repository, by how they are pinned: to a commit SHA or image
+// digest, to a version tag, or to a branch, which includes references
+// without any ref.
+type ciPinStats struct {
+	total  int
+	sha    int
+	tag    int
+	branch int
+}
+
+// record counts a reference given the ref it is pinned to.
+func (p *ciPinStats) record(pin string, immutable bool) {
+	p.total++
+	switch {
+	case immutable:
+		p.sha++
+	case versionTag.MatchString(pin):
+		p.tag++
+	default:
+		p.branch++
+	}
+}
+
+// merge folds the counts of other into p.
+func (p *ciPinStats) merge(other ciPinStats) {
+	p.total += other.total
+	p.sha += other.sha
+	p.tag += other.tag
+	p.branch += other.branch
+}
+
+// shaPercent returns the share of references pinned to a SHA, rounded down.
+func (p ciPinStats) shaPercent() int {
+	if p.total == 0 {
+		return 0
+	}
+	return p.sha * 100 / p.total
+}
+
+// componentPin returns the version a GitLab component reference is pinned
+// to and whether it is a full commit SHA, or ok false for references built
+// from variables, whose pin cannot be known.
+func componentPin(ref string) (pin string, immutable, ok bool) {
+	if strings.Contains(ref, "$") {
+		return "", false, false
+	}
+	_, pin, _ = strings.Cut(ref, "@")
+	return pin, fullCommitSHA.MatchString(pin), true
+}
+
+// recordActionPin counts a uses: reference of a workflow or action. A
+// reusable workflow that must be referenced by a release tag cannot be
+// pinned to a SHA, so it is not counted.
+func (s *scanSummary) recordActionPin(ref string) {
+	if requiresTagRef(ref) {
+		return
+	}
+	if pin, immutable, ok := actionPin(ref); ok {
+		s.ciPins.record(pin, immutable)
+	}
+}
+
+// recordComponentPin counts a component include of a GitLab CI config.
+func (s *scanSummary) recordComponentPin(ref string) {
+	if pin, immutable, ok := componentPin(ref); ok {
+		s.ciPins.record(pin, immutable)
+	}
+}
+
+// reportSHAPinningRatio flags a workspace whose CI configs pin less than
+// minPercent of their references to a commit SHA.
+func reportSHAPinningRatio(findings *findingSet, stats ciPinStats, minPercent int) {
+	if stats.total == 0 || stats.sha*100 >= minPercent*stats.total {
+		return
+	}
+	findings.Finding(
+		shaPinningRatioRuleID,
+		sdk.SeverityMedium,
+		sdk.ConfidenceHigh,
+		fmt.Sprintf("Only %d of %d CI action and component references (%d%%) are pinned to a commit SHA, below the %d%% threshold",
+			stats.sha, stats.total, stats.shaPercent(), minPercent),
+	).
+		At(findings.root, 0, 0).
+		WithMetadata("type", "low_sha_pinning_ratio").
+		WithMetadata("ci_references", strconv.Itoa(stats.total)).
+		WithMetadata("sha_pinned", strconv.Itoa(stats.sha)).
+		WithMetadata("tag_pinned", strconv.Itoa(stats.tag)).
+		WithMetadata("branch_pinned", strconv.Itoa(stats.branch)).
+		WithMetadata("sha_pinned_percent", strconv.Itoa(stats.shaPercent())).
+		WithMetadata("min_sha_pinned", strconv.Itoa(minPercent)).
+		Done()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCIPinStatsRecord(t *testing.T) {
+	var stats ciPinStats
+	for _, ref := range []string{
+		"actions/checkout@8e5e7e5ab8b370d6c329ec480221332ada57f0ab",
+		"actions/setup-go@v5",
+		"actions/cache@4.0.2",
+		"example/action@main",
+		"example/other",
+		"docker://alpine@sha256:" + strings.Repeat("a", 64),
+		"docker://alpine:3.19",
+		"./local-action",
+		"${{ matrix.action }}",
+	} {
+		if pin, immutable, ok := actionPin(ref); ok {
+			stats.record(pin, immutable)
+		}
+	}
+	want := ciPinStats{total: 7, sha: 2, tag: 2, branch: 3}
+	if stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+	if got := stats.shaPercent(); got != 28 {
+		t.Errorf("shaPercent() = %d, want 28", got)
+	}
+}
+
+func TestScanSHAPinningRatio(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "ci.yml"), strings.Join([]string{
+		"on: push",
+		"jobs:",
+		"  build:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - uses: actions/checkout@8e5e7e5ab8b370d6c329ec480221332ada57f0ab",
+		"      - uses: actions/setup-go@v5",
+		"      - uses: ./.github/actions/build",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, ".gitlab-ci.yml"), strings.Join([]string{
+		"include:",
+		"  - component: gitlab.com/example/components/lint@1.2.0",
+		"  - component: gitlab.com/example/components/test@main",
+		"  - component: $CI_SERVER_FQDN/example/components/scan@2.0.0",
+		"build:",
+		"  script: make",
+	}, "\n")+"\n")
+	client := testClient(t)
+
+	resp := invokeScan(t, client, workspace)
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["ci_references"] != "4" || meta["ci_references_sha_pinned"] != "1" || meta["ci_references_tag_pinned"] != "2" || meta["ci_references_branch_pinned"] != "1" {
+		t.Errorf("unexpected summary pin counts: %v", meta)
+	}
+	found := findByRule(resp.GetFindings(), shaPinningRatioRuleID)
+	if len(found) != 1 {
+		t.Fatalf("expected one %s finding, got %d", shaPinningRatioRuleID, len(found))
+	}
+	if m := found[0].GetMetadata(); m["sha_pinned_percent"] != "25" || m["min_sha_pinned"] != "50" || m["ci_references"] != "4" {
+		t.Errorf("unexpected metadata: %v", m)
+	}
+	// The per-reference findings remain.
+	if n := len(findByRule(resp.GetFindings(), unpinnedActionRuleID)); n != 1 {
+		t.Errorf("expected one %s finding, got %d", unpinnedActionRuleID, n)
+	}
+
+	resp = invokeScanWithInput(t, client, map[string]any{"workspace_root": workspace, "min_sha_pinned": 25})
+	if found := findByRule(resp.GetFindings(), shaPinningRatioRuleID); len(found) != 0 {
+		t.Errorf("expected no %s findings at a 25%% threshold, got %d", shaPinningRatioRuleID, len(found))
+	}
+	resp = invokeScanWithInput(t, client, map[string]any{"workspace_root": workspace, "min_sha_pinned": 0})
+	if found := findByRule(resp.GetFindings(), shaPinningRatioRuleID); len(found) != 0 {
+		t.Errorf("expected no %s findings with min_sha_pinned 0, got %d", shaPinningRatioRuleID, len(found))
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// scanJob is a classified file waiting to be analyzed.
+type scanJob struct {
+	path string
+	kind fileKind
+	// size is the file size measured by the walk.
+	size int64
+}
+
+// scanPool analyzes classified files on a bounded set of workers. The walk
+// only classifies and submits; file reads, parsing, and pattern matching all
+// happen on the workers.
+type scanPool struct {
+	jobs     chan scanJob
+	wg       sync.WaitGroup
+	policy   provenancePolicy
+	findings *findingSet
+	// provenance decides which archive entries are provenance candidates,
+	// as for walked files.
+	provenance *provenanceMatcher
+	// budget bounds the time spent analyzing each file; zero disables it.
+	budget time.Duration
+
+	// mu guards summary and err.
+	mu      sync.Mutex
+	summary *scanSummary
+	err     error
+}
+
+// startScanPool starts workers that analyze submitted jobs until the pool is
+// closed by wait. Workers stop picking up new jobs once ctx is done.
+func startScanPool(ctx context.Context, workers int, budget time.Duration, policy provenancePolicy, provenance *provenanceMatcher, findings *findingSet, summary *scanSummary) *scanPool {
+	p := &scanPool{
+		jobs:       make(chan scanJob, workers*2),
+		policy:     policy,
+		findings:   findings,
+		provenance: provenance,
+		budget:     budget,
+		summary:    summary,
+	}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.work(ctx)
+	}
+	return p
+}
+
+// submit queues a job, giving up if ctx is done first.
+func (p *scanPool) submit(ctx context.Context, job scanJob) error {
+	select {
+	case p.jobs <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wait closes the pool, waits for in-flight jobs, and returns the first
+// analysis error encountered.
+func (p *scanPool) wait() error {
+	close(p.jobs)
+	p.wg.Wait()
+	return p.err
+}
+
+func (p *scanPool) work(ctx context.Context) {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		if ctx.Err() != nil {
+			continue
+		}
+
+		local := &scanSummary{}
+		err := analyzeFile(ctx, job, &fileReporter{findings: p.findings, summary: local, policy: p.policy, provenance: p.provenance, budget: p.budget})
+
+		p.mu.Lock()
+		p.summary.merge(local)
+		if err != nil && p.err == nil {
+			p.err = err
+		}
+		p.mu.Unlock()
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// postSignWriteRuleID flags release workflow steps that modify provenance
+// or checksum files after a step has signed or attested them, so the
+// published signatures no longer verify.
+const postSignWriteRuleID = "PROV-054"
+
+var (
+	// signedChecksumFile matches the base name of a checksums manifest, such
+	// as checksums.txt, app_1.0_checksums.txt, SHA256SUMS, or
+	// app.tar.gz.sha256.
+	signedChecksumFile = regexp.MustCompile(`(?i)^(?:.*[._-])?(?:checksums?|sha(?:1|224|256|384|512)sums?)(?:\.txt)?$|\.(?:sha(?:1|224|256|384|512)|md5)$`)
+	// fileSigningCommand matches commands that sign files outside cosign:
+	// gpg detached and clear signatures and minisign.
+	fileSigningCommand = regexp.MustCompile(`\bgpg2?\b.*\s(?:-b|--detach-sign|-s|--sign|--clearsign|--clear-sign)\b|\bminisign\s+(?:.*\s)?-S\b`)
+)
+
+// inPlaceEditors edit the files they are given when passed their in-place
+// flag.
+var inPlaceEditors = map[string]string{"sed": "i", "perl": "i", "yq": "i", "gsed": "i"}
+
+// signedFileWrite is a run command of a workflow job writing a provenance
+// or checksum file.
+type signedFileWrite struct {
+	line int
+	path string
+	// command names the writing command, as in "sed -i" or "redirect".
+	command string
+}
+
+// isSignedReleaseFile reports whether a path names a provenance or checksum
+// file, returning which.
+func isSignedReleaseFile(p string) (string, bool) {
+	name := strings.ToLower(path.Base(strings.Trim(p, `"'`)))
+	for _, pattern := range provenanceFilePatterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return "provenance", true
+		}
+	}
+	if signedChecksumFile.MatchString(name) {
+		return "checksums", true
+	}
+	return "", false
+}
+
+// writtenFiles returns the files a simple command writes, with the command
+// doing it: output redirects, the operands of in-place sed, perl, and yq,
+// tee, sponge, and truncate, dd's of=, and the destination of mv, cp, and
+// install unless it is a copy of a file with the same name.
+func writtenFiles(c shellCommand) [][2]string {
+	var out [][2]string
+	for _, r := range c.redirects {
+		out = append(out, [2]string{r, "redirect"})
+	}
+	words := c.words
+	for len(words) > 0 && (words[0] == "sudo" || envAssignment.MatchString(words[0])) {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return out
+	}
+	tool, args := path.Base(words[0]), words[1:]
+	switch {
+	case inPlaceEditors[tool] != "":
+		inPlace := false
+		for _, a := range args {
+			if a == "--in-place" || a == "--inplace" || strings.HasPrefix(a, "--in-place=") || hasShortFlag(a, inPlaceEditors[tool][0]) {
+				inPlace = true
+			}
+		}
+		if inPlace {
+			for _, a := range nonFlagWords(args) {
+				out = append(out, [2]string{a, tool + " -i"})
+			}
+		}
+	case tool == "tee" || tool == "sponge" || tool == "truncate":
+		for _, a := range nonFlagWords(args) {
+			out = append(out, [2]string{a, tool})
+		}
+	case tool == "dd":
+		for _, a := range args {
+			if of, ok := strings.CutPrefix(a, "of="); ok {
+				out = append(out, [2]string{of, tool})
+			}
+		}
+	case fileMovers[tool]:
+		for _, a := range args {
+			if a == "-t" || strings.HasPrefix(a, "--target-directory") {
+				return out
+			}
+		}
+		rest := nonFlagWords(args)
+		if len(rest) < 2 {
+			return out
+		}
+		dest := rest[len(rest)-1]
+		if len(rest) == 2 && path.Base(rest[0]) == path.Base(dest) {
+			return out
+		}
+		out = append(out, [2]string{dest, tool})
+	}
+	return out
+}
+
+// trackWrites records the provenance and checksum files a logical run
+// command of a workflow job writes, and the files it signs outside cosign.
+func (w *workflowTracker) trackWrites(cmd logicalCommand) {
+	if w == nil || cmd.context != contextRunCommand {
+		return
+	}
+	var j *workflowJob
+	for _, job := range w.jobs {
+		if job.name == cmd.section {
+			j = job
+		}
+	}
+	if j == nil {
+		return
+	}
+	if containsAny(cmd.text, "gpg", "minisign") && fileSigningCommand.MatchString(cmd.text) {
+		j.signs = append(j.signs, stepRef{line: cmd.line, step: strings.Fields(fileSigningCommand.FindString(cmd.text))[0]})
+	}
+	if j.shell == nil {
+		j.shell = newShellParser()
+	}
+	for _, c := range j.shell.parse(cmd.text) {
+		for _, wf := range writtenFiles(c) {
+			if _, ok := isSignedReleaseFile(wf[0]); ok {
+				j.signedWrites = append(j.signedWrites, signedFileWrite{line: cmd.line, path: wf[0], command: wf[1]})
+			}
+		}
+	}
+}
+
+// signingSteps returns the job's attestation and signing steps.
+func (j *workflowJob) signingSteps() []stepRef {
+	return append(append([]stepRef(nil), j.attestations...), j.signs...)
+}
+
+// signedBefore returns the job's last signing step before line.
+func signedBefore(j *workflowJob, line int) (stepRef, bool) {
+	var last stepRef
+	for _, s := range j.signingSteps() {
+		if s.line < line && s.line > last.line {
+			last = s
+		}
+	}
+	return last, last.line != 0
+}
+
+// resignedAfter reports whether the job signs or attests after line.
+func resignedAfter(j *workflowJob, line int) bool {
+	for _, s := range j.signingSteps() {
+		if s.line > line {
+			return true
+		}
+	}
+	return false
+}
+
+// reportPostSignWrites flags run commands that write a provenance or
+// checksum file after a signing or attestation step of the same job, or of
+// a job it needs, unless the job signs again afterwards.
+func (w *workflowTracker) reportPostSignWrites(findings *findingSet, filePath string) {
+	for _, j := range w.jobs {
+		for _, write := range j.signedWrites {
+			if resignedAfter(j, write.line) {
+				continue
+			}
+			attester, step := j, stepRef{}
+			ok := false
+			if step, ok = signedBefore(j, write.line); !ok {
+				for _, k := range w.jobs {
+					if k == j || !w.dependsOn(j, k.name) {
+						continue
+					}
+					if step, ok = signedBefore(k, math.MaxInt); ok {
+						attester = k
+						break
+					}
+				}
+			}
+			if !ok {
+				continue
+			}
+			kind, _ := isSignedReleaseFile(write.path)
+			where := fmt.Sprintf("at line %d", step.line)
+			if attester != j {
+				where = fmt.Sprintf("in job %s, which it needs", attester.name)
+			}
+			findings.Finding(
+				postSignWriteRuleID,
+				sdk.SeverityMedium,
+				sdk.ConfidenceMedium,
+				fmt.Sprintf("Job %s modifies %s file %s (%s) after it is signed or attested (%s %s); the published signature will not verify", j.name, kind, write.path, write.command, step.step, where),
+			).
+				At(filePath, write.line, write.line).
+				WithMetadata("type", "signed_file_modified").
+				WithMetadata("job", j.name).
+				WithMetadata("file", write.path).
+				WithMetadata("file_kind", kind).
+				WithMetadata("write_command", write.command).
+				WithMetadata("write_line", strconv.Itoa(write.line)).
+				WithMetadata("attestation_job", attester.name).
+				WithMetadata("attestation_step", step.step).
+				WithMetadata("attestation_line", strconv.Itoa(step.line)).
+				Done()
+		}
+	}
+}
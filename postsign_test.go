@@ -0,0 +1,97 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWrittenFiles(t *testing.T) {
+	tests := []struct {
+		command string
+		want    [][2]string
+	}{
+		{`sha256sum dist/* > checksums.txt`, [][2]string{{"checksums.txt", "redirect"}}},
+		{`sed -i.bak -e 's/v1/v2/' provenance.json`, [][2]string{{"s/v1/v2/", "sed -i"}, {"provenance.json", "sed -i"}}},
+		{`sed 's/v1/v2/' provenance.json`, nil},
+		{`perl -pi -e 's/a/b/' SHA256SUMS`, [][2]string{{"s/a/b/", "perl -i"}, {"SHA256SUMS", "perl -i"}}},
+		{`sudo tee -a checksums.txt`, [][2]string{{"checksums.txt", "tee"}}},
+		{`dd if=/dev/zero of=app.intoto.jsonl`, [][2]string{{"app.intoto.jsonl", "dd"}}},
+		{`mv tmp.json provenance.json`, [][2]string{{"provenance.json", "mv"}}},
+		{`cp dist/provenance.json out/provenance.json`, nil},
+		{`cp -t out/ provenance.json`, nil},
+	}
+	for _, tt := range tests {
+		cmds := newShellParser().parse(tt.command)
+		if got := writtenFiles(cmds[0]); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("writtenFiles(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestScanPostSignWrites(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), strings.Join([]string{
+		"on:",
+		"  push:",
+		"    tags: ['v*']",
+		"jobs:",
+		"  build:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - run: sha256sum dist/* > dist/checksums.txt",
+		"      - uses: actions/attest-build-provenance@v1",
+		"        with:",
+		"          subject-checksums: dist/checksums.txt",
+		"      - run: cosign sign-blob --yes dist/checksums.txt --output-signature dist/checksums.txt.sig",
+		"      - run: gh release upload ${{ github.ref_name }} dist/checksums.txt dist/provenance.json",
+		"      - run: cat dist/checksums.txt && sha256sum -c dist/checksums.txt",
+		"      - run: cp dist/provenance.json out/provenance.json",
+		"      - run: |",
+		"          PROV=dist/provenance.json",
+		"          jq '.predicate.buildType = \"x\"' \"$PROV\" > tmp.json && mv tmp.json \"$PROV\"",
+		"      - run: sed -i 's/draft/final/' dist/provenance.json",
+		"  publish:",
+		"    needs: build",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - run: sha256sum extra/* >> dist/checksums.txt",
+		"  resign:",
+		"    needs: [build]",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - run: sha256sum extra/* >> SHA256SUMS",
+		"      - run: gpg --batch --detach-sign --armor SHA256SUMS",
+		"  docs:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - run: sed -i 's/x/y/' provenance.json",
+	}, "\n")+"\n")
+
+	found := findByRule(invokeScan(t, testClient(t), workspace).GetFindings(), postSignWriteRuleID)
+	got := make(map[int32]map[string]string)
+	for _, f := range found {
+		got[f.GetLocation().GetStartLine()] = f.GetMetadata()
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected findings at lines 18, 19, and 24, got %v", got)
+	}
+	for line, want := range map[int32][4]string{
+		18: {"dist/provenance.json", "mv", "build", "12"},
+		19: {"dist/provenance.json", "sed -i", "build", "12"},
+		24: {"dist/checksums.txt", "redirect", "build", "12"},
+	} {
+		meta := got[line]
+		if meta == nil {
+			t.Errorf("no finding at line %d", line)
+			continue
+		}
+		if g := [4]string{meta["file"], meta["write_command"], meta["attestation_job"], meta["attestation_line"]}; g != want {
+			t.Errorf("line %d: file, write_command, attestation_job, attestation_line = %q, want %q", line, g, want)
+		}
+	}
+	if got[24]["job"] != "publish" || got[24]["attestation_step"] != "cosign" {
+		t.Errorf("downstream finding metadata = %v", got[24])
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Artifact production outcomes recorded on PROV-001.
+const (
+	// productionArtifacts workspaces show evidence of producing artifacts.
+	productionArtifacts = "artifacts"
+	// productionLibrary workspaces show only library signals.
+	productionLibrary = "library"
+	// productionUnknown workspaces show neither.
+	productionUnknown = "unknown"
+	// productionAssumed workspaces were declared artifact-producing with
+	// assume_produces_artifacts.
+	productionAssumed = "assumed"
+)
+
+// Evidence of artifact production, and signals of a library.
+const (
+	evidenceDockerfile     = "dockerfile"
+	evidenceGoReleaser     = "goreleaser"
+	evidencePublishStep    = "publish_step"
+	evidenceBuildCommand   = "build_command"
+	evidenceArtifactTarget = "artifact_target"
+	evidenceMainPackage    = "main_package"
+	evidenceBinaryManifest = "binary_manifest"
+
+	signalLibraryManifest = "library_manifest"
+	signalLibraryTargets  = "library_targets_only"
+)
+
+// productionEvidence counts what a workspace shows about the artifacts it
+// produces.
+type productionEvidence struct {
+	dockerfiles      int
+	goreleaser       int
+	publishSteps     int
+	buildCommands    int
+	artifactTargets  int
+	mainPackages     int
+	binaryManifests  int
+	libraryManifests int
+	// libraryTargets counts Makefile targets that only test, lint, or tidy;
+	// otherTargets counts those that are neither library nor artifact
+	// targets.
+	libraryTargets int
+	otherTargets   int
+}
+
+// classifyProduction decides whether a workspace produces artifacts, and
+// returns the evidence or library signals the decision rests on. Any
+// evidence of artifacts wins; a workspace whose manifests are libraries, or
+// whose Makefile targets all test or lint, is a library.
+func classifyProduction(e productionEvidence) (string, []string) {
+	var evidence []string
+	for _, c := range []struct {
+		n    int
+		name string
+	}{
+		{e.dockerfiles, evidenceDockerfile},
+		{e.goreleaser, evidenceGoReleaser},
+		{e.publishSteps, evidencePublishStep},
+		{e.buildCommands, evidenceBuildCommand},
+		{e.artifactTargets, evidenceArtifactTarget},
+		{e.mainPackages, evidenceMainPackage},
+		{e.binaryManifests, evidenceBinaryManifest},
+	} {
+		if c.n > 0 {
+			evidence = append(evidence, c.name)
+		}
+	}
+	if len(evidence) > 0 {
+		return productionArtifacts, evidence
+	}
+	var signals []string
+	if e.libraryManifests > 0 {
+		signals = append(signals, signalLibraryManifest)
+	}
+	if e.libraryTargets > 0 && e.otherTargets == 0 {
+		signals = append(signals, signalLibraryTargets)
+	}
+	if len(signals) > 0 {
+		return productionLibrary, signals
+	}
+	return productionUnknown, nil
+}
+
+// buildCommands match commands whose output is a shippable artifact rather
+// than a compile check: image builds, go build -o, release cargo builds,
+// and package builds. Keyword is a lowercase literal every match contains.
+var buildCommands = []struct {
+	Keyword string
+	Pattern *regexp.Regexp
+}{
+	{"build", regexp.MustCompile(`\b(?:docker|podman|buildah)\s+(?:image\s+|buildx\s+)?(?:build|bud)\b`)},
+	{"build", regexp.MustCompile(`\bgo\s+build\b.*\s-o[\s=]`)},
+	{"build", regexp.MustCompile(`\bcargo\s+build\b.*--release\b`)},
+	{"build", regexp.MustCompile(`\b(?:python3?\s+-m\s+build|poetry\s+build|hatch\s+build|uv\s+build)\b`)},
+	{"pack", regexp.MustCompile(`\b(?:npm|pnpm|yarn)\s+pack\b`)},
+	{"goreleaser", regexp.MustCompile(`\bgoreleaser\s+(?:release|build)\b`)},
+	{"mvn", regexp.MustCompile(`\bmvnw?\b.*\b(?:package|install)\b`)},
+	{"gradle", regexp.MustCompile(`\bgradlew?\b.*\b(?:assemble|jar|bootJar|shadowJar)\b`)},
+}
+
+// isBuildCommand reports whether a command builds a shippable artifact.
+// ascii reports whether command is pure ASCII, enabling the keyword
+// prescreen.
+func isBuildCommand(command string, ascii bool) bool {
+	for _, c := range buildCommands {
+		if ascii && !containsFoldASCII(command, c.Keyword) {
+			continue
+		}
+		if c.Pattern.MatchString(command) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordBuildCommand counts a build or CI command that builds an artifact.
+// Commands in test jobs and targets ship nothing.
+func (s *scanSummary) recordBuildCommand(command string, ascii bool, lc lineContext, section string) {
+	if (lc != contextRunCommand && lc != contextRecipe) || isTestSection(section) {
+		return
+	}
+	if isBuildCommand(command, ascii) {
+		s.buildCommands++
+	}
+}
+
+// recordMakeTarget notes a Makefile target with a recipe, once per file.
+func (s *scanSummary) recordMakeTarget(rel, target string) {
+	if target == "" {
+		return
+	}
+	if s.makeTargets == nil {
+		s.makeTargets = make(map[string]string)
+	}
+	s.makeTargets[rel+"#"+target] = target
+}
+
+// libraryTargetWords mark Makefile targets that maintain a library rather
+// than build anything from it, besides the test and clean targets
+// makeTargetKind knows.
+var libraryTargetWords = map[string]bool{
+	"lint": true, "fmt": true, "format": true, "vet": true, "tidy": true, "vendor": true,
+	"deps": true, "generate": true, "coverage": true, "cover": true, "bench": true, "help": true,
+}
+
+// isLibraryTarget reports whether a Makefile target only maintains the
+// code, as test, lint, and clean targets do.
+func isLibraryTarget(target, repository string) bool {
+	if makeTargetKind(target, repository) == targetMaintenance {
+		return true
+	}
+	for _, word := range strings.FieldsFunc(strings.ToLower(target), func(r rune) bool {
+		return r == '-' || r == '_' || r == '.' || r == ':' || r == '/'
+	}) {
+		if libraryTargetWords[word] {
+			return true
+		}
+	}
+	return false
+}
+
+// Package manifests, read when classifying artifact production.
+var packageManifests = map[string]bool{
+	"go.mod":         true,
+	"package.json":   true,
+	"Cargo.toml":     true,
+	"pyproject.toml": true,
+	"setup.py":       true,
+	"setup.cfg":      true,
+}
+
+// maxProductionManifests caps the manifests read to classify a workspace.
+const maxProductionManifests = 64
+
+// observeProductionFile records what a walked file's name says about the
+// artifacts the workspace produces: Dockerfiles, goreleaser configs, Go main
+// packages and Rust binaries, and package manifests to read later.
+func (s *scanSummary) observeProductionFile(path, rel, name string) {
+	switch {
+	case imageSourceOf(name) == imageSourceDockerfile:
+		s.production.dockerfiles++
+	case isGoReleaserConfig(name):
+		s.production.goreleaser++
+	case packageManifests[name]:
+		s.manifestPaths = append(s.manifestPaths, path)
+	case isMainPackageFile(rel):
+		s.production.mainPackages++
+	}
+}
+
+// isMainPackageFile reports whether a workspace-relative path is the
+// conventional home of an executable: a Go main.go or a Go file under cmd/,
+// or a Rust src/main.rs or src/bin/ file. Test files do not count.
+func isMainPackageFile(rel string) bool {
+	name := path.Base(rel)
+	switch {
+	case strings.HasSuffix(name, "_test.go"):
+		return false
+	case name == "main.go":
+		return true
+	case strings.HasSuffix(name, ".go"):
+		return strings.HasPrefix(rel, "cmd/") || strings.Contains(rel, "/cmd/")
+	case name == "main.rs":
+		return rel == "src/main.rs" || strings.HasSuffix(rel, "/src/main.rs")
+	case strings.HasSuffix(name, ".rs"):
+		return strings.HasPrefix(rel, "src/bin/") || strings.Contains(rel, "/src/bin/")
+	}
+	return false
+}
+
+// pythonScriptsSection matches the pyproject.toml tables declaring console
+// scripts.
+var pythonScriptsSection = regexp.MustCompile(`(?m)^\s*\[(?:project\.(?:gui-)?scripts|tool\.poetry\.scripts)\]`)
+
+// manifestBinary reports whether a package manifest declares an executable
+// (true) or only a library (false). ok is false when the manifest says
+// neither, as for a private package.json, which is usually an application
+// bundled by other means.
+func manifestBinary(fsys workspaceFS, path string, data []byte) (binary, ok bool) {
+	switch filepath.Base(path) {
+	case "go.mod":
+		// Main packages are found by file name.
+		return false, true
+	case "package.json":
+		var manifest struct {
+			Bin     json.RawMessage `json:"bin"`
+			Private bool            `json:"private"`
+		}
+		if json.Unmarshal(data, &manifest) != nil {
+			return false, false
+		}
+		if bin := strings.TrimSpace(string(manifest.Bin)); bin != "" && bin != "null" && bin != `""` && bin != "{}" {
+			return true, true
+		}
+		return false, !manifest.Private
+	case "Cargo.toml":
+		if strings.Contains(string(data), "[[bin]]") {
+			return true, true
+		}
+		if _, err := fsys.Stat(filepath.Join(filepath.Dir(path), "src", "main.rs")); err == nil {
+			return true, true
+		}
+		return false, true
+	case "pyproject.toml":
+		return pythonScriptsSection.Match(data), true
+	case "setup.py", "setup.cfg":
+		text := string(data)
+		return strings.Contains(text, "console_scripts") || strings.Contains(text, "gui_scripts"), true
+	}
+	return false, false
+}
+
+// artifactProduction classifies the workspace by the artifacts it produces,
+// for PROV-001 and any other check whose severity depends on whether
+// anything ships. Manifests are read here, once the walk has found them,
+// and reading stops at the first that declares an executable.
+func (s *scanSummary) artifactProduction(fsys workspaceFS, root string, maxFileSize int64) (string, []string) {
+	e := s.production
+	e.publishSteps = len(s.publishSteps)
+	e.buildCommands = s.buildCommands
+	repository := workspaceName(root)
+	for _, target := range s.makeTargets {
+		switch {
+		case makeTargetKind(target, repository) == targetArtifact:
+			e.artifactTargets++
+		case isLibraryTarget(target, repository):
+			e.libraryTargets++
+		default:
+			e.otherTargets++
+		}
+	}
+	manifests := append([]string(nil), s.manifestPaths...)
+	sort.Strings(manifests)
+	if len(manifests) > maxProductionManifests {
+		manifests = manifests[:maxProductionManifests]
+	}
+	for _, manifest := range manifests {
+		if e.binaryManifests > 0 {
+			break
+		}
+		info, err := fsys.Stat(manifest)
+		if err != nil || (maxFileSize > 0 && info.Size() > maxFileSize) {
+			continue
+		}
+		data, err := fsys.ReadFile(manifest)
+		if err != nil {
+			continue
+		}
+		switch binary, ok := manifestBinary(fsys, manifest, data); {
+		case binary:
+			e.binaryManifests++
+		case ok:
+			e.libraryManifests++
+		}
+	}
+	return classifyProduction(e)
+}
+
+// mergeProduction folds a worker's Makefile targets and build commands into
+// the scan summary.
+func (s *scanSummary) mergeProduction(local *scanSummary) {
+	s.buildCommands += local.buildCommands
+	for key, target := range local.makeTargets {
+		if s.makeTargets == nil {
+			s.makeTargets = make(map[string]string)
+		}
+		s.makeTargets[key] = target
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClassifyProduction(t *testing.T) {
+	tests := []struct {
+		name       string
+		evidence   productionEvidence
+		production string
+		signals    []string
+	}{
+		{"nothing", productionEvidence{}, productionUnknown, nil},
+		{"dockerfile", productionEvidence{dockerfiles: 1, libraryManifests: 1}, productionArtifacts, []string{evidenceDockerfile}},
+		{"publish and main", productionEvidence{publishSteps: 2, mainPackages: 1}, productionArtifacts, []string{evidencePublishStep, evidenceMainPackage}},
+		{"library manifest", productionEvidence{libraryManifests: 1, otherTargets: 1}, productionLibrary, []string{signalLibraryManifest}},
+		{"test targets", productionEvidence{libraryTargets: 3}, productionLibrary, []string{signalLibraryTargets}},
+		{"mixed targets", productionEvidence{libraryTargets: 3, otherTargets: 1}, productionUnknown, nil},
+	}
+	for _, tt := range tests {
+		production, signals := classifyProduction(tt.evidence)
+		if production != tt.production || !reflect.DeepEqual(signals, tt.signals) {
+			t.Errorf("%s: got %s %v, want %s %v", tt.name, production, signals, tt.production, tt.signals)
+		}
+	}
+}
+
+func TestIsBuildCommand(t *testing.T) {
+	for _, command := range []string{
+		"docker build -t app .",
+		"docker buildx build --platform linux/amd64 .",
+		"go build -o bin/app ./cmd/app",
+		"cargo build --locked --release",
+		"python -m build --wheel",
+		"npm pack",
+		"goreleaser release --clean",
+		"./mvnw -B package",
+		"./gradlew bootJar",
+	} {
+		if !isBuildCommand(command, true) {
+			t.Errorf("isBuildCommand(%q) = false, want true", command)
+		}
+	}
+	for _, command := range []string{"go build ./...", "go test ./...", "cargo build", "golangci-lint run", "npm run build-docs", "goreleaser check"} {
+		if isBuildCommand(command, true) {
+			t.Errorf("isBuildCommand(%q) = true, want false", command)
+		}
+	}
+}
+
+func TestManifestBinary(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app", "src", "main.rs"), "fn main() {}\n")
+	tests := []struct {
+		path       string
+		data       string
+		binary, ok bool
+	}{
+		{"go.mod", "module example.com/lib\n", false, true},
+		{"package.json", `{"name":"lib","main":"index.js"}`, false, true},
+		{"package.json", `{"name":"cli","bin":{"cli":"bin/cli.js"}}`, true, true},
+		{"package.json", `{"name":"web","private":true}`, false, false},
+		{"Cargo.toml", "[package]\nname = \"lib\"\n", false, true},
+		{"Cargo.toml", "[package]\nname = \"app\"\n\n[[bin]]\nname = \"app\"\n", true, true},
+		{filepath.Join(dir, "app", "Cargo.toml"), "[package]\nname = \"app\"\n", true, true},
+		{"pyproject.toml", "[project]\nname = \"lib\"\n", false, true},
+		{"pyproject.toml", "[project]\nname = \"cli\"\n\n[project.scripts]\ncli = \"cli:main\"\n", true, true},
+		{"setup.py", "setup(entry_points={'console_scripts': ['cli=cli:main']})\n", true, true},
+	}
+	for _, tt := range tests {
+		binary, ok := manifestBinary(osFS{}, tt.path, []byte(tt.data))
+		if binary != tt.binary || ok != tt.ok {
+			t.Errorf("manifestBinary(%s, %q) = %v, %v, want %v, %v", filepath.Base(tt.path), tt.data, binary, ok, tt.binary, tt.ok)
+		}
+	}
+
+	for rel, want := range map[string]bool{
+		"main.go":                 true,
+		"cmd/app/server.go":       true,
+		"tools/cmd/gen/gen.go":    true,
+		"cmd/app/server_test.go":  false,
+		"internal/store/store.go": false,
+		"src/main.rs":             true,
+		"src/bin/tool.rs":         true,
+		"src/lib.rs":              false,
+	} {
+		if got := isMainPackageFile(rel); got != want {
+			t.Errorf("isMainPackageFile(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
+
+func TestScanLibraryDowngradesMissingAttestation(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "go.mod"), "module example.com/lib\n\ngo 1.22\n")
+	writeFile(t, filepath.Join(workspace, "lib.go"), "package lib\n")
+	writeFile(t, filepath.Join(workspace, "Makefile"), strings.Join([]string{
+		"test:",
+		"\tgo test ./...",
+		"lint:",
+		"\tgolangci-lint run",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "ci.yml"),
+		"on: push\njobs:\n  test:\n    runs-on: ubuntu-latest\n    steps:\n      - run: go build ./... && make test\n")
+	client := testClient(t)
+
+	found := findByRule(invokeScan(t, client, workspace).GetFindings(), "PROV-001")
+	if len(found) != 1 {
+		t.Fatalf("expected one PROV-001 finding, got %d", len(found))
+	}
+	meta := found[0].GetMetadata()
+	if got := severityNames[found[0].GetSeverity()]; got != "low" {
+		t.Errorf("severity = %s, want low", got)
+	}
+	if meta["artifact_production"] != productionLibrary || meta["artifact_evidence"] != signalLibraryManifest+","+signalLibraryTargets {
+		t.Errorf("artifact_production = %q, artifact_evidence = %q", meta["artifact_production"], meta["artifact_evidence"])
+	}
+
+	resp := invokeScanWithInput(t, client, map[string]any{
+		"workspace_root":            workspace,
+		"assume_produces_artifacts": true,
+	})
+	found = findByRule(resp.GetFindings(), "PROV-001")
+	if len(found) != 1 || severityNames[found[0].GetSeverity()] != "medium" || found[0].GetMetadata()["artifact_production"] != productionAssumed {
+		t.Errorf("expected a medium PROV-001 with artifact_production %q when artifacts are assumed", productionAssumed)
+	}
+
+	// A main package makes the same workspace an application.
+	writeFile(t, filepath.Join(workspace, "cmd", "tool", "main.go"), "package main\n")
+	found = findByRule(invokeScan(t, client, workspace).GetFindings(), "PROV-001")
+	if len(found) != 1 || severityNames[found[0].GetSeverity()] != "medium" || found[0].GetMetadata()["artifact_evidence"] != evidenceMainPackage {
+		t.Errorf("expected a medium PROV-001 with main_package evidence once a main package exists")
+	}
+}
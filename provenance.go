@@ -0,0 +1,606 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// inTotoStatement represents a minimal in-toto attestation statement.
+type inTotoStatement struct {
+	Type          string `json:"_type"`
+	PredicateType string `json:"predicateType"`
+	Subject       []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+	Predicate json.RawMessage `json:"predicate"`
+}
+
+// slsaMaterial is a build input recorded in a SLSA predicate: a v0.2
+// material or a v1 resolved dependency.
+type slsaMaterial struct {
+	URI    string            `json:"uri"`
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// slsaRecipePredicateType is the predicate type of SLSA v0.1 provenance.
+const slsaRecipePredicateType = "https://slsa.dev/provenance/v0.1"
+
+// deprecatedPredicateRuleID flags statements using a superseded SLSA
+// provenance version.
+const deprecatedPredicateRuleID = "PROV-025"
+
+// slsaRecipe is the SLSA v0.1 description of how a build ran, replaced by
+// buildType and invocation in v0.2. DefinedInMaterial indexes the material
+// the recipe was read from, such as the repository holding the workflow.
+type slsaRecipe struct {
+	Type              string          `json:"type"`
+	DefinedInMaterial *int            `json:"definedInMaterial"`
+	EntryPoint        string          `json:"entryPoint"`
+	Arguments         json.RawMessage `json:"arguments"`
+	Environment       json.RawMessage `json:"environment"`
+}
+
+// slsaPredicate represents a minimal SLSA provenance predicate. The top-level
+// fields follow the v0.2 layout, which v0.1 shares apart from Recipe;
+// BuildDefinition and RunDetails carry the v1 equivalents.
+type slsaPredicate struct {
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+	BuildType  string `json:"buildType"`
+	Invocation struct {
+		ConfigSource struct {
+			URI        string            `json:"uri"`
+			Digest     map[string]string `json:"digest"`
+			EntryPoint string            `json:"entryPoint"`
+		} `json:"configSource"`
+		Parameters  json.RawMessage `json:"parameters"`
+		Environment json.RawMessage `json:"environment"`
+	} `json:"invocation"`
+	Recipe    slsaRecipe     `json:"recipe"`
+	Materials []slsaMaterial `json:"materials"`
+	Metadata  struct {
+		BuildInvocationID string `json:"buildInvocationId"`
+		BuildStartedOn    string `json:"buildStartedOn"`
+		BuildFinishedOn   string `json:"buildFinishedOn"`
+	} `json:"metadata"`
+
+	BuildDefinition struct {
+		BuildType            string                     `json:"buildType"`
+		ExternalParameters   map[string]json.RawMessage `json:"externalParameters"`
+		InternalParameters   map[string]json.RawMessage `json:"internalParameters"`
+		ResolvedDependencies []slsaMaterial             `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Metadata struct {
+			InvocationID string `json:"invocationId"`
+			StartedOn    string `json:"startedOn"`
+			FinishedOn   string `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// builderID returns the builder identity regardless of predicate version.
+func (p *slsaPredicate) builderID() string {
+	if p.Builder.ID != "" {
+		return p.Builder.ID
+	}
+	return p.RunDetails.Builder.ID
+}
+
+// builderIDField returns the JSON path of the builder ID within the
+// statement: where it is recorded, or where the predicate's version keeps
+// it when it is missing.
+func (p *slsaPredicate) builderIDField(predicateType string) string {
+	if p.Builder.ID == "" && (p.RunDetails.Builder.ID != "" || predicateType == slsaProvenancePrefix+"v1") {
+		return "predicate.runDetails.builder.id"
+	}
+	return "predicate.builder.id"
+}
+
+// invocationID returns the build invocation ID regardless of predicate
+// version.
+func (p *slsaPredicate) invocationID() string {
+	if p.Metadata.BuildInvocationID != "" {
+		return p.Metadata.BuildInvocationID
+	}
+	return p.RunDetails.Metadata.InvocationID
+}
+
+// buildTypeURI returns the build type regardless of predicate version.
+func (p *slsaPredicate) buildTypeURI() string {
+	if p.BuildType != "" {
+		return p.BuildType
+	}
+	if p.Recipe.Type != "" {
+		return p.Recipe.Type
+	}
+	return p.BuildDefinition.BuildType
+}
+
+// buildTime returns when the build finished, or started if that is all the
+// predicate records, along with the field it was read from. It returns the
+// zero time when neither is set or parses as RFC 3339.
+func (p *slsaPredicate) buildTime() (time.Time, string) {
+	for _, field := range []struct{ name, value string }{
+		{"buildFinishedOn", p.Metadata.BuildFinishedOn},
+		{"finishedOn", p.RunDetails.Metadata.FinishedOn},
+		{"buildStartedOn", p.Metadata.BuildStartedOn},
+		{"startedOn", p.RunDetails.Metadata.StartedOn},
+	} {
+		if t, err := time.Parse(time.RFC3339, field.value); err == nil {
+			return t, field.name
+		}
+	}
+	return time.Time{}, ""
+}
+
+// allMaterials returns v0.2 materials and v1 resolved dependencies together.
+func (p *slsaPredicate) allMaterials() []slsaMaterial {
+	out := make([]slsaMaterial, 0, len(p.Materials)+len(p.BuildDefinition.ResolvedDependencies))
+	out = append(out, p.Materials...)
+	out = append(out, p.BuildDefinition.ResolvedDependencies...)
+	return out
+}
+
+// sourceRepo returns the source repository the build was configured from:
+// invocation.configSource.uri in v0.2, the material the recipe was defined
+// in for v0.1, or the workflow repository (GitHub Actions) or source
+// parameter in v1.
+func (p *slsaPredicate) sourceRepo() string {
+	uri := p.Invocation.ConfigSource.URI
+	if m, ok := p.recipeMaterial(); ok && uri == "" {
+		uri = m.URI
+	}
+	if uri != "" {
+		if i := strings.Index(uri, "@"); i > 0 {
+			return uri[:i]
+		}
+		return uri
+	}
+	var workflow struct {
+		Repository string `json:"repository"`
+	}
+	if raw, ok := p.BuildDefinition.ExternalParameters["workflow"]; ok {
+		if json.Unmarshal(raw, &workflow) == nil && workflow.Repository != "" {
+			return workflow.Repository
+		}
+	}
+	if raw, ok := p.BuildDefinition.ExternalParameters["source"]; ok {
+		var source string
+		if json.Unmarshal(raw, &source) == nil {
+			return source
+		}
+		var desc slsaMaterial
+		if json.Unmarshal(raw, &desc) == nil {
+			return desc.URI
+		}
+	}
+	return ""
+}
+
+// entryPoint returns the build entry point: invocation.configSource.entryPoint
+// in v0.2, recipe.entryPoint in v0.1, or the workflow path (GitHub Actions)
+// in v1.
+func (p *slsaPredicate) entryPoint() string {
+	if ep := p.Invocation.ConfigSource.EntryPoint; ep != "" {
+		return ep
+	}
+	if ep := p.Recipe.EntryPoint; ep != "" {
+		return ep
+	}
+	var workflow struct {
+		Path string `json:"path"`
+	}
+	if raw, ok := p.BuildDefinition.ExternalParameters["workflow"]; ok {
+		if json.Unmarshal(raw, &workflow) == nil {
+			return workflow.Path
+		}
+	}
+	return ""
+}
+
+// recipeMaterial returns the v0.1 material the recipe was defined in, and
+// whether recipe.definedInMaterial names one.
+func (p *slsaPredicate) recipeMaterial() (slsaMaterial, bool) {
+	i := p.Recipe.DefinedInMaterial
+	if i == nil || *i < 0 || *i >= len(p.Materials) {
+		return slsaMaterial{}, false
+	}
+	return p.Materials[*i], true
+}
+
+// Envelope kinds recorded on parsed statements.
+const (
+	envelopeNone     = "none"
+	envelopeDSSE     = "dsse"
+	envelopeSigstore = "sigstore-bundle"
+)
+
+// dsseEnvelope is a DSSE envelope wrapping a base64-encoded statement.
+type dsseEnvelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     string `json:"payload"`
+	Signatures  []struct {
+		KeyID string `json:"keyid"`
+		Sig   string `json:"sig"`
+	} `json:"signatures"`
+}
+
+// provenanceDocument is the union of the document shapes a provenance file
+// line may hold: a bare statement, a DSSE envelope, a Sigstore bundle, or a
+// PEP 740 attestation object.
+type provenanceDocument struct {
+	inTotoStatement
+	dsseEnvelope
+	DSSEEnvelope         *dsseEnvelope `json:"dsseEnvelope"`
+	VerificationMaterial struct {
+		TlogEntries []json.RawMessage `json:"tlogEntries"`
+		Certificate struct {
+			RawBytes string `json:"rawBytes"`
+		} `json:"certificate"`
+		X509CertificateChain struct {
+			Certificates []struct {
+				RawBytes string `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"x509CertificateChain"`
+	} `json:"verificationMaterial"`
+	PEP740Envelope *pep740Envelope `json:"envelope"`
+	PEP740Material pep740Material  `json:"verification_material"`
+}
+
+// parsedStatement is a decoded in-toto statement together with how it was
+// wrapped.
+type parsedStatement struct {
+	Statement inTotoStatement
+	Predicate slsaPredicate
+	// PredicateOK reports whether the predicate decoded as a JSON object.
+	PredicateOK bool
+	Envelope    string
+	Signatures  int
+	// TlogEntries is the number of transparency log entries recorded in a
+	// Sigstore bundle or PEP 740 attestation.
+	TlogEntries int
+	// Certificate is the base64 DER signing certificate of a PEP 740
+	// attestation or Sigstore bundle.
+	Certificate string
+	// Index is the zero-based position of the statement within its document.
+	Index int
+	// Line is the one-based line of the statement in a JSONL document, and
+	// zero for a single-value document.
+	Line int
+	// Offset is the byte offset of the statement within its document.
+	Offset int
+	// Raw is the JSON value the statement was decoded from, which for an
+	// enveloped statement is the envelope.
+	Raw []byte
+	// PayloadPath is the JSON path of the encoded statement within Raw,
+	// or "" when Raw is the statement itself.
+	PayloadPath string
+}
+
+// cancelCheckInterval is how many lines or statements are processed between
+// context cancellation checks in per-file loops.
+const cancelCheckInterval = 256
+
+// cancelCheckBytes is how many bytes of lines are processed between context
+// checks in line loops, so that files of a few very long lines still stop
+// promptly on cancellation or at the file's time budget.
+const cancelCheckBytes = 64 << 10
+
+// cancelCheck paces the context checks of a line loop.
+type cancelCheck struct {
+	lines int
+	bytes int
+}
+
+// due records a line of n bytes and reports whether the context should be
+// checked before processing it.
+func (c *cancelCheck) due(n int) bool {
+	c.lines++
+	c.bytes += n
+	if c.lines%cancelCheckInterval == 0 || c.bytes >= cancelCheckBytes {
+		c.bytes = 0
+		return true
+	}
+	return false
+}
+
+// errNoStatements is returned when a document holds no decodable statement.
+var errNoStatements = errors.New("no in-toto statements found")
+
+// attestationKeys are top-level keys of which every in-toto statement, DSSE
+// envelope, Sigstore bundle, or PEP 740 attestation carries at least one.
+var attestationKeys = []string{"_type", "predicateType", "subject", "payloadType", "dsseEnvelope", "envelope"}
+
+// looksLikeAttestation reports whether data plausibly holds in-toto
+// attestations, judged by the first JSON value. Well-formed JSON without any
+// attestation key is some other document that happens to share a provenance
+// file name; malformed content is assumed to be a broken attestation so that
+// parseProvenance reports it.
+func looksLikeAttestation(data []byte) bool {
+	first := bytes.TrimSpace(data)
+	if !json.Valid(first) {
+		for _, line := range bytes.Split(first, []byte("\n")) {
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				first = line
+				break
+			}
+		}
+		if !json.Valid(first) {
+			return true
+		}
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(first, &obj); err != nil {
+		return false
+	}
+	for _, key := range attestationKeys {
+		if _, ok := obj[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProvenance decodes every statement in a provenance document. The
+// document may be a single JSON value or line-delimited JSON (JSONL), and each
+// value may be a bare statement, a DSSE envelope, or a Sigstore bundle.
+// Lines that fail to decode are skipped; an error is returned only when no
+// statement could be decoded at all. If ctx is done while decoding JSONL, the
+// statements decoded so far are returned together with the context error.
+func parseProvenance(ctx context.Context, data []byte) ([]parsedStatement, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, errNoStatements
+	}
+
+	if json.Valid(trimmed) {
+		ps, err := decodeDocument(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		ps.Offset = bytes.Index(data, trimmed[:1])
+		ps.Raw = trimmed
+		return []parsedStatement{ps}, nil
+	}
+
+	var statements []parsedStatement
+	var firstErr error
+	offset := 0
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if i%cancelCheckInterval == 0 && ctx.Err() != nil {
+			return statements, ctx.Err()
+		}
+		lineOffset := offset
+		offset += len(line) + 1
+
+		content := bytes.TrimSpace(line)
+		if len(content) == 0 {
+			continue
+		}
+		ps, err := decodeDocument(content)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		ps.Index = len(statements)
+		ps.Line = i + 1
+		ps.Offset = lineOffset + bytes.Index(line, content[:1])
+		ps.Raw = content
+		statements = append(statements, ps)
+	}
+	if len(statements) == 0 {
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, errNoStatements
+	}
+	return statements, nil
+}
+
+// decodeDocument decodes a single JSON value into a statement, unwrapping a
+// DSSE envelope or Sigstore bundle when present.
+func decodeDocument(raw []byte) (parsedStatement, error) {
+	var doc provenanceDocument
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return parsedStatement{}, fmt.Errorf("decoding JSON: %w", err)
+	}
+
+	ps := parsedStatement{Envelope: envelopeNone}
+	if doc.PEP740Envelope != nil {
+		payload, err := decodeBase64(doc.PEP740Envelope.Statement)
+		if err != nil {
+			return parsedStatement{}, fmt.Errorf("decoding attestation statement: %w", err)
+		}
+		if err := json.Unmarshal(payload, &ps.Statement); err != nil {
+			return parsedStatement{}, fmt.Errorf("decoding attestation statement: %w", err)
+		}
+		ps.Envelope = envelopePEP740
+		ps.PayloadPath = "envelope.statement"
+		if doc.PEP740Envelope.Signature != "" {
+			ps.Signatures = 1
+		}
+		ps.TlogEntries = len(doc.PEP740Material.TransparencyEntries)
+		ps.Certificate = doc.PEP740Material.Certificate
+		ps.PredicateOK = json.Unmarshal(ps.Statement.Predicate, &ps.Predicate) == nil
+		return ps, nil
+	}
+
+	env := &doc.dsseEnvelope
+	if doc.DSSEEnvelope != nil {
+		env = doc.DSSEEnvelope
+		ps.Envelope = envelopeSigstore
+		ps.PayloadPath = "dsseEnvelope.payload"
+		ps.TlogEntries = len(doc.VerificationMaterial.TlogEntries)
+		// Bundles before v0.3 carry a chain whose first entry is the leaf.
+		ps.Certificate = doc.VerificationMaterial.Certificate.RawBytes
+		if chain := doc.VerificationMaterial.X509CertificateChain.Certificates; ps.Certificate == "" && len(chain) > 0 {
+			ps.Certificate = chain[0].RawBytes
+		}
+	} else if env.PayloadType != "" || env.Payload != "" {
+		ps.Envelope = envelopeDSSE
+		ps.PayloadPath = "payload"
+	}
+
+	if ps.Envelope == envelopeNone {
+		ps.Statement = doc.inTotoStatement
+	} else {
+		payload, err := decodeBase64(env.Payload)
+		if err != nil {
+			return parsedStatement{}, fmt.Errorf("decoding envelope payload: %w", err)
+		}
+		if err := json.Unmarshal(payload, &ps.Statement); err != nil {
+			return parsedStatement{}, fmt.Errorf("decoding envelope statement: %w", err)
+		}
+		ps.Signatures = len(env.Signatures)
+	}
+
+	if len(ps.Statement.Predicate) > 0 {
+		ps.PredicateOK = json.Unmarshal(ps.Statement.Predicate, &ps.Predicate) == nil
+	}
+	return ps, nil
+}
+
+// subjectProblem records why a single subject is incomplete.
+type subjectProblem struct {
+	index   int
+	name    string
+	reasons []string
+}
+
+// completeness is the result of checking a statement's metadata, split into
+// statement-level reasons and per-subject problems.
+type completeness struct {
+	statement []string
+	subjects  []subjectProblem
+}
+
+// ok reports whether no problems were found.
+func (c completeness) ok() bool {
+	return len(c.statement) == 0 && len(c.subjects) == 0
+}
+
+// subjectReasons returns the distinct reasons across all defective subjects,
+// in first-seen order.
+func (c completeness) subjectReasons() []string {
+	seen := make(map[string]bool)
+	var reasons []string
+	for _, sp := range c.subjects {
+		for _, r := range sp.reasons {
+			if !seen[r] {
+				seen[r] = true
+				reasons = append(reasons, r)
+			}
+		}
+	}
+	return reasons
+}
+
+// completenessProblems checks a statement's metadata, in a stable order. A
+// predicate that is present but not an object is not inspected further.
+func completenessProblems(ps *parsedStatement) completeness {
+	var c completeness
+
+	if len(ps.Statement.Subject) == 0 {
+		c.statement = append(c.statement, "missing subject")
+	}
+	for i, subj := range ps.Statement.Subject {
+		var reasons []string
+		if subj.Name == "" {
+			reasons = append(reasons, "subject missing name")
+		}
+		if len(subj.Digest) == 0 {
+			reasons = append(reasons, "subject missing digest")
+		}
+		if len(reasons) > 0 {
+			c.subjects = append(c.subjects, subjectProblem{index: i, name: subj.Name, reasons: reasons})
+		}
+	}
+
+	// PyPI predicates describe a publish event, not a SLSA build, and may
+	// be empty.
+	if isPyPIStatement(ps) {
+		return c
+	}
+	if len(ps.Statement.Predicate) == 0 {
+		c.statement = append(c.statement, "missing predicate")
+	} else if ps.PredicateOK {
+		if ps.Predicate.builderID() == "" {
+			c.statement = append(c.statement, "missing builder ID")
+		}
+		if len(ps.Predicate.allMaterials()) == 0 {
+			c.statement = append(c.statement, "missing materials")
+		}
+		// A v0.1 recipe must point at one of the materials it lists.
+		if _, ok := ps.Predicate.recipeMaterial(); ps.Statement.PredicateType == slsaRecipePredicateType &&
+			ps.Predicate.Recipe.DefinedInMaterial != nil && !ok {
+			c.statement = append(c.statement, "recipe material out of range")
+		}
+	}
+
+	return c
+}
+
+// statementReasonField returns the JSON path a statement-level
+// completeness reason is about.
+func statementReasonField(ps *parsedStatement, reason string) string {
+	switch reason {
+	case "missing subject":
+		return "subject"
+	case "missing predicate":
+		return "predicate"
+	case "missing builder ID":
+		return ps.Predicate.builderIDField(ps.Statement.PredicateType)
+	case "missing materials":
+		if ps.Statement.PredicateType == slsaProvenancePrefix+"v1" {
+			return "predicate.buildDefinition.resolvedDependencies"
+		}
+		return "predicate.materials"
+	case "recipe material out of range":
+		return "predicate.recipe.definedInMaterial"
+	}
+	return rootJSONPath
+}
+
+// decodeBase64 decodes standard or URL-safe base64, padded or not, as DSSE
+// producers vary.
+func decodeBase64(s string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding,
+		base64.URLEncoding,
+		base64.RawStdEncoding,
+		base64.RawURLEncoding,
+	} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, errors.New("payload is not valid base64")
+}
+
+// formatDigest renders a digest set as sorted "alg:value" pairs so digest sets
+// can be compared as strings.
+func formatDigest(digest map[string]string) string {
+	parts := make([]string, 0, len(digest))
+	for alg, value := range digest {
+		parts = append(parts, alg+":"+value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+const testStatement = `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","subject":[{"name":"app","digest":{"sha256":"abc123def4567890abc123def4567890abc123def4567890abc123def4567890"}}],"predicate":{"builder":{"id":"https://builder.example"},"materials":[{"uri":"git+https://example.com/repo","digest":{"sha1":"def"}}]}}`
+
+func TestParseProvenance(t *testing.T) {
+	payload := base64.StdEncoding.EncodeToString([]byte(testStatement))
+	dsse := `{"payloadType":"application/vnd.in-toto+json","payload":"` + payload + `","signatures":[{"keyid":"k","sig":"s"}]}`
+	bundle := `{"mediaType":"application/vnd.dev.sigstore.bundle.v0.3+json","dsseEnvelope":` + dsse + `}`
+
+	tests := []struct {
+		name       string
+		data       string
+		statements int
+		envelope   string
+		signatures int
+		wantErr    bool
+	}{
+		{"bare statement", testStatement, 1, envelopeNone, 0, false},
+		{"jsonl", testStatement + "\n\n" + testStatement + "\n", 2, envelopeNone, 0, false},
+		{"dsse envelope", dsse, 1, envelopeDSSE, 1, false},
+		{"dsse jsonl", dsse + "\n" + dsse, 2, envelopeDSSE, 1, false},
+		{"sigstore bundle", bundle, 1, envelopeSigstore, 1, false},
+		{"jsonl with junk line", "not json\n" + testStatement, 1, envelopeNone, 0, false},
+		{"empty", "  \n", 0, "", 0, true},
+		{"garbage", "not json at all", 0, "", 0, true},
+		{"bad payload", `{"payloadType":"application/vnd.in-toto+json","payload":"%%%"}`, 0, "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProvenance(context.Background(), []byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseProvenance: %v", err)
+			}
+			if len(got) != tt.statements {
+				t.Fatalf("got %d statements, want %d", len(got), tt.statements)
+			}
+			for i, ps := range got {
+				if ps.Index != i {
+					t.Errorf("statement %d has index %d", i, ps.Index)
+				}
+				if ps.Envelope != tt.envelope {
+					t.Errorf("envelope = %q, want %q", ps.Envelope, tt.envelope)
+				}
+				if ps.Signatures != tt.signatures {
+					t.Errorf("signatures = %d, want %d", ps.Signatures, tt.signatures)
+				}
+				if ps.Predicate.builderID() != "https://builder.example" {
+					t.Errorf("builderID = %q", ps.Predicate.builderID())
+				}
+				if len(ps.Statement.Subject) != 1 {
+					t.Errorf("got %d subjects, want 1", len(ps.Statement.Subject))
+				}
+			}
+		})
+	}
+}
+
+func TestLooksLikeAttestation(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{"statement", testStatement, true},
+		{"jsonl statements", testStatement + "\n" + testStatement + "\n", true},
+		{"dsse envelope", `{"payloadType":"application/vnd.in-toto+json","payload":""}`, true},
+		{"sigstore bundle", `{"mediaType":"application/vnd.dev.sigstore.bundle.v0.3+json","dsseEnvelope":{}}`, true},
+		{"statement missing everything but subject", `{"subject":[]}`, true},
+		{"webauthn response", `{"id":"abc","type":"public-key","response":{"attestationObject":"o2Nm"}}`, false},
+		{"json array", `[1, 2, 3]`, false},
+		{"unrelated jsonl", "{\"a\":1}\n{\"b\":2}\n", false},
+		{"malformed", `{"_type": `, true},
+		{"empty", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := looksLikeAttestation([]byte(tt.data)); got != tt.want {
+				t.Errorf("looksLikeAttestation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSLSAPredicateV1Accessors(t *testing.T) {
+	stmt := `{"_type":"https://in-toto.io/Statement/v1","predicateType":"https://slsa.dev/provenance/v1","subject":[],"predicate":{` +
+		`"buildDefinition":{"buildType":"https://actions.github.io/buildtypes/workflow/v1",` +
+		`"externalParameters":{"workflow":{"ref":"refs/tags/v1.0.0","repository":"https://github.com/example/repo","path":".github/workflows/release.yml"}},` +
+		`"resolvedDependencies":[{"uri":"git+https://github.com/example/repo@refs/tags/v1.0.0","digest":{"gitCommit":"abc"}}]},` +
+		`"runDetails":{"builder":{"id":"https://github.com/actions/runner/github-hosted"}}}}`
+
+	got, err := parseProvenance(context.Background(), []byte(stmt))
+	if err != nil {
+		t.Fatalf("parseProvenance: %v", err)
+	}
+	pred := got[0].Predicate
+
+	if pred.builderID() != "https://github.com/actions/runner/github-hosted" {
+		t.Errorf("builderID = %q", pred.builderID())
+	}
+	if pred.buildTypeURI() != "https://actions.github.io/buildtypes/workflow/v1" {
+		t.Errorf("buildTypeURI = %q", pred.buildTypeURI())
+	}
+	if pred.sourceRepo() != "https://github.com/example/repo" {
+		t.Errorf("sourceRepo = %q", pred.sourceRepo())
+	}
+	if pred.entryPoint() != ".github/workflows/release.yml" {
+		t.Errorf("entryPoint = %q", pred.entryPoint())
+	}
+	if len(pred.allMaterials()) != 1 {
+		t.Errorf("got %d materials, want 1", len(pred.allMaterials()))
+	}
+}
+
+func TestSLSAPredicateV01Accessors(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join(testdataDir(t), "slsa-v01", "provenance.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseProvenance(context.Background(), data)
+	if err != nil {
+		t.Fatalf("parseProvenance: %v", err)
+	}
+	pred := got[0].Predicate
+
+	if pred.buildTypeURI() != "https://github.com/Attestations/GitHubActionsWorkflow@v1" {
+		t.Errorf("buildTypeURI = %q", pred.buildTypeURI())
+	}
+	if pred.sourceRepo() != "git+https://github.com/philips-labs/slsa-provenance-action" {
+		t.Errorf("sourceRepo = %q", pred.sourceRepo())
+	}
+	if pred.entryPoint() != "ci" {
+		t.Errorf("entryPoint = %q", pred.entryPoint())
+	}
+	if level, gap := estimateSLSALevel(&got[0]); level != 1 || gap != "signed envelope" {
+		t.Errorf("estimateSLSALevel = %d (%s), want 1 (signed envelope)", level, gap)
+	}
+}
+
+func TestCheckProvenanceV01(t *testing.T) {
+	for _, name := range []string{"provenance.json", "curl.intoto.jsonl"} {
+		data, err := os.ReadFile(filepath.Join(testdataDir(t), "slsa-v01", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		findings := &findingSet{}
+		if err := checkProvenance(context.Background(), findings, name, data, provenancePolicy{}, &scanSummary{}); err != nil {
+			t.Fatal(err)
+		}
+		if len(findings.items) != 1 || findings.items[0].ruleID != deprecatedPredicateRuleID {
+			t.Fatalf("%s: expected only %s, got %d findings", name, deprecatedPredicateRuleID, len(findings.items))
+		}
+		meta := findingMetadata(findings.items[0])
+		if findings.items[0].severity != sdk.SeverityLow || meta["build_type"] != "https://github.com/Attestations/GitHubActionsWorkflow@v1" {
+			t.Errorf("%s: unexpected finding %v", name, meta)
+		}
+	}
+
+	// A recipe pointing past the materials is incomplete.
+	stmt := `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.1","subject":[{"name":"app","digest":{"sha256":"abc123def4567890abc123def4567890abc123def4567890abc123def4567890"}}],` +
+		`"predicate":{"builder":{"id":"https://builder.example"},"recipe":{"type":"https://example.com/recipe","definedInMaterial":3},"materials":[{"uri":"git+https://example.com/repo"}]}}`
+	findings := &findingSet{}
+	if err := checkProvenance(context.Background(), findings, "provenance.json", []byte(stmt), provenancePolicy{}, &scanSummary{}); err != nil {
+		t.Fatal(err)
+	}
+	var reasons []string
+	for _, f := range findings.items {
+		if f.ruleID == "PROV-002" {
+			reasons = append(reasons, findingMetadata(f)["reasons"])
+		}
+	}
+	if strings.Join(reasons, ";") != "recipe material out of range" {
+		t.Errorf("PROV-002 reasons = %v, want recipe material out of range", reasons)
+	}
+}
+
+func TestScanSLSAV01Fixture(t *testing.T) {
+	resp := invokeScan(t, testClient(t), filepath.Join(testdataDir(t), "slsa-v01"))
+	if found := findByRule(resp.GetFindings(), deprecatedPredicateRuleID); len(found) != 2 {
+		t.Errorf("expected one %s per statement, got %d", deprecatedPredicateRuleID, len(found))
+	}
+	if found := findByRule(resp.GetFindings(), "PROV-002"); len(found) != 0 {
+		t.Errorf("expected v0.1 fields to satisfy the completeness checks, got %d PROV-002", len(found))
+	}
+	summary := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if summary["builders"] != "https://github.com/Attestations/GitHubHostedActions=2" {
+		t.Errorf("builders = %q", summary["builders"])
+	}
+}
+
+// statementWithSubjects returns an otherwise complete statement with n
+// subjects, where those for which missingDigest returns true lack a digest.
+func statementWithSubjects(n int, missingDigest func(i int) bool) string {
+	subjects := make([]string, n)
+	for i := range subjects {
+		digest := `{"sha256":"abc123def4567890abc123def4567890abc123def4567890abc123def4567890"}`
+		if missingDigest(i) {
+			digest = `{}`
+		}
+		subjects[i] = fmt.Sprintf(`{"name":"artifact-%d","digest":%s}`, i, digest)
+	}
+	return `{"_type":"https://in-toto.io/Statement/v0.1","subject":[` + strings.Join(subjects, ",") +
+		`],"predicate":{"builder":{"id":"https://builder.example"},"materials":[{"uri":"git+https://example.com/repo"}]}}`
+}
+
+func findingMetadata(f *finding) map[string]string {
+	meta := make(map[string]string, len(f.metadata))
+	for _, kv := range f.metadata {
+		meta[kv[0]] = kv[1]
+	}
+	return meta
+}
+
+func TestCheckProvenancePerSubjectFindings(t *testing.T) {
+	bad := map[int]bool{2: true, 7: true, 11: true}
+	stmt := statementWithSubjects(15, func(i int) bool { return bad[i] })
+
+	findings := &findingSet{}
+	if err := checkProvenance(context.Background(), findings, "provenance.json", []byte(stmt), provenancePolicy{}, &scanSummary{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(findings.items) != len(bad) {
+		t.Fatalf("expected one finding per defective subject (%d), got %d", len(bad), len(findings.items))
+	}
+	for _, f := range findings.items {
+		meta := findingMetadata(f)
+		index, err := strconv.Atoi(meta["subject_index"])
+		if err != nil || !bad[index] {
+			t.Errorf("unexpected subject_index %q", meta["subject_index"])
+		}
+		if meta["subject_name"] != fmt.Sprintf("artifact-%d", index) {
+			t.Errorf("subject_name = %q for index %d", meta["subject_name"], index)
+		}
+		if meta["reasons"] != "subject missing digest" {
+			t.Errorf("reasons = %q, want %q", meta["reasons"], "subject missing digest")
+		}
+	}
+}
+
+func TestCheckProvenanceCollapsesManyDefectiveSubjects(t *testing.T) {
+	stmt := statementWithSubjects(10000, func(int) bool { return true })
+
+	findings := &findingSet{}
+	if err := checkProvenance(context.Background(), findings, "provenance.json", []byte(stmt), provenancePolicy{}, &scanSummary{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(findings.items) != 1 {
+		t.Fatalf("expected defective subjects to collapse into one finding, got %d", len(findings.items))
+	}
+	meta := findingMetadata(findings.items[0])
+	if meta["incomplete_subjects"] != "10000" {
+		t.Errorf("incomplete_subjects = %q, want 10000", meta["incomplete_subjects"])
+	}
+	if meta["reasons"] != "subject missing digest" {
+		t.Errorf("reasons = %q, want deduplicated %q", meta["reasons"], "subject missing digest")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of publish steps.
+const (
+	publishContainer     = "container"
+	publishNPM           = "npm"
+	publishPyPI          = "pypi"
+	publishRubyGems      = "rubygems"
+	publishCargo         = "cargo"
+	publishMaven         = "maven"
+	publishGitHubRelease = "github-release"
+)
+
+// Publication outcomes recorded on PROV-001.
+const (
+	publicationExternal = "external"
+	publicationLocal    = "local"
+	publicationNone     = "none"
+)
+
+// publishStep is a build or CI command that publishes artifacts.
+type publishStep struct {
+	path string
+	line int
+	kind string
+	// target is the registry or service published to.
+	target string
+	// external is set unless the target is a registry on the build host.
+	external bool
+}
+
+// publishCommands match commands that publish artifacts. Keyword is a
+// lowercase literal every match contains; lines without it skip the regular
+// expression. Target is the default target of the kind; a non-empty
+// submatch 1 overrides it.
+var publishCommands = []struct {
+	Keyword string
+	Kind    string
+	Target  string
+	Pattern *regexp.Regexp
+}{
+	{"push", publishContainer, "", regexp.MustCompile(`\b(?:docker|podman|buildah)\s+(?:image\s+)?push\s+(?:--?[\w-]+(?:[=\s]+\S+)?\s+)*["']?([^\s"';|&]+)`)},
+	{"publish", publishContainer, "", regexp.MustCompile(`\bpack\s+build\s+["']?([^\s"';|&-][^\s"';|&]*)[^;|&]*\s--publish\b`)},
+	{"publish", publishNPM, "registry.npmjs.org", regexp.MustCompile(`\b(?:npm|pnpm|yarn(?:\s+npm)?)\s+publish\b(?:.*--registry[=\s]+["']?([^\s"']+))?`)},
+	{"twine", publishPyPI, "upload.pypi.org", regexp.MustCompile(`\btwine\s+upload\b(?:.*--repository-url[=\s]+["']?([^\s"']+))?`)},
+	{"gem", publishRubyGems, "rubygems.org", regexp.MustCompile(`\bgem\s+push\b(?:.*--host[=\s]+["']?([^\s"']+))?`)},
+	{"cargo", publishCargo, "crates.io", regexp.MustCompile(`\bcargo\s+publish\b()`)},
+	{"deploy", publishMaven, "maven-repository", regexp.MustCompile(`\bmvnw?\b.*\bdeploy\b()`)},
+	{"publish", publishMaven, "maven-repository", regexp.MustCompile(`\bgradlew?\b.*\bpublish(?:AllPublicationsTo\w+Repository|ToSonatype|ToMavenCentral)?\b()`)},
+	{"release", publishGitHubRelease, "github-releases", regexp.MustCompile(`\bgh\s+release\s+(?:upload|create)\b()`)},
+}
+
+// publishStepsOf returns the publish steps in a build or CI config line.
+// ascii reports whether line is pure ASCII, enabling the keyword prescreen.
+func publishStepsOf(path string, lineNum int, line string, ascii bool) []publishStep {
+	var steps []publishStep
+	for _, c := range publishCommands {
+		if ascii && !containsFoldASCII(line, c.Keyword) {
+			continue
+		}
+		m := c.Pattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		step := publishStep{path: path, line: lineNum, kind: c.Kind, target: c.Target, external: true}
+		if c.Kind == publishContainer {
+			step.target = imageRegistry(m[1])
+			step.external = !isLocalRegistry(step.target)
+		} else if m[1] != "" {
+			step.target = registryHost(m[1])
+			step.external = !isLocalRegistry(step.target)
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// imageRegistry returns the registry host of an image reference, docker.io
+// when it names none. References built from variables are returned as
+// written, since the registry is only known at build time.
+func imageRegistry(ref string) string {
+	if strings.ContainsAny(ref, "$%{") {
+		return ref
+	}
+	first, _, hasPath := strings.Cut(ref, "/")
+	if hasPath && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return strings.ToLower(first)
+	}
+	return "docker.io"
+}
+
+// registryHost reduces a registry URL to its host, keeping any port.
+func registryHost(uri string) string {
+	host := uri
+	if _, rest, ok := strings.Cut(host, "://"); ok {
+		host = rest
+	}
+	host, _, _ = strings.Cut(host, "/")
+	return strings.ToLower(host)
+}
+
+// isLocalRegistry reports whether a registry host is on the build host or
+// its private network: localhost, a loopback address, or a bare service
+// name without a domain such as "registry:5000".
+func isLocalRegistry(host string) bool {
+	if strings.ContainsAny(host, "$%{") {
+		return false
+	}
+	name := host
+	if strings.HasPrefix(name, "[") {
+		name, _, _ = strings.Cut(strings.TrimPrefix(name, "["), "]")
+	} else {
+		name, _, _ = strings.Cut(name, ":")
+	}
+	return name == "localhost" || strings.HasPrefix(name, "127.") || name == "::1" || !strings.Contains(name, ".")
+}
+
+// recordPublishLine records the publish steps in a build or CI config line.
+// Commented and echoed lines do not publish anything.
+func (s *scanSummary) recordPublishLine(path string, lineNum int, line string, ascii bool, lc lineContext) {
+	if lc == contextComment || lc == contextEcho || lc == contextHeredoc {
+		return
+	}
+	s.publishSteps = append(s.publishSteps, publishStepsOf(path, lineNum, line, ascii)...)
+}
+
+// publication summarizes the recorded publish steps: whether any publishes
+// outside the build host, and the sorted distinct "kind:target" pairs.
+func (s *scanSummary) publication() (string, []string) {
+	if len(s.publishSteps) == 0 {
+		return publicationNone, nil
+	}
+	outcome := publicationLocal
+	seen := make(map[string]bool)
+	for _, step := range s.publishSteps {
+		if step.external {
+			outcome = publicationExternal
+		}
+		seen[step.kind+":"+step.target] = true
+	}
+	targets := make([]string, 0, len(seen))
+	for t := range seen {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+	return outcome, targets
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+func TestPublishStepsOf(t *testing.T) {
+	tests := []struct {
+		line     string
+		kind     string
+		target   string
+		external bool
+	}{
+		{"docker push ghcr.io/example/app:1.0", publishContainer, "ghcr.io", true},
+		{"docker push --all-tags example/app", publishContainer, "docker.io", true},
+		{`podman push "$REGISTRY/app"`, publishContainer, "$REGISTRY/app", true},
+		{"docker push localhost:5000/app", publishContainer, "localhost:5000", false},
+		{"docker push registry:5000/app", publishContainer, "registry:5000", false},
+		{"npm publish --access public", publishNPM, "registry.npmjs.org", true},
+		{"yarn npm publish", publishNPM, "registry.npmjs.org", true},
+		{"npm publish --registry http://127.0.0.1:4873", publishNPM, "127.0.0.1:4873", false},
+		{"twine upload --repository-url https://test.pypi.org/legacy/ dist/*", publishPyPI, "test.pypi.org", true},
+		{"gem push pkg/app.gem", publishRubyGems, "rubygems.org", true},
+		{"cargo publish --locked", publishCargo, "crates.io", true},
+		{"./mvnw -B deploy", publishMaven, "maven-repository", true},
+		{"./gradlew publishToSonatype", publishMaven, "maven-repository", true},
+		{"gh release upload v1.0 dist/*", publishGitHubRelease, "github-releases", true},
+	}
+	for _, tt := range tests {
+		steps := publishStepsOf("ci.yml", 1, tt.line, true)
+		if len(steps) != 1 {
+			t.Errorf("%q: expected one publish step, got %d", tt.line, len(steps))
+			continue
+		}
+		if s := steps[0]; s.kind != tt.kind || s.target != tt.target || s.external != tt.external {
+			t.Errorf("%q: got %s %s external=%v, want %s %s external=%v", tt.line, s.kind, s.target, s.external, tt.kind, tt.target, tt.external)
+		}
+	}
+
+	for _, line := range []string{"docker build -t app .", "git push origin main", "./gradlew publishToMavenLocal", "npm run publish-docs"} {
+		if steps := publishStepsOf("ci.yml", 1, line, true); len(steps) != 0 {
+			t.Errorf("%q: expected no publish steps, got %v", line, steps)
+		}
+	}
+}
+
+func TestScanMissingAttestationSeverityFollowsPublication(t *testing.T) {
+	tests := []struct {
+		name     string
+		workflow string
+		severity string
+		outcome  string
+		targets  string
+	}{
+		{"external", "      - run: docker push ghcr.io/example/app:1.0\n      - run: npm publish\n", "critical", publicationExternal, "container:ghcr.io,npm:registry.npmjs.org"},
+		{"local", "      - run: docker push localhost:5000/app\n", "high", publicationLocal, "container:localhost:5000"},
+		{"commented", "      # - run: docker push ghcr.io/example/app\n      - run: make build\n", "medium", publicationNone, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tgo build .\n")
+			writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"),
+				"on: push\njobs:\n  release:\n    steps:\n"+tt.workflow)
+
+			resp := invokeScan(t, testClient(t), workspace)
+
+			found := findByRule(resp.GetFindings(), "PROV-001")
+			if len(found) != 1 {
+				t.Fatalf("expected one PROV-001 finding, got %d", len(found))
+			}
+			meta := found[0].GetMetadata()
+			if got := severityNames[found[0].GetSeverity()]; got != tt.severity {
+				t.Errorf("severity = %s, want %s", got, tt.severity)
+			}
+			if meta["publication"] != tt.outcome || meta["publish_targets"] != tt.targets {
+				t.Errorf("publication = %q, publish_targets = %q; want %q, %q", meta["publication"], meta["publish_targets"], tt.outcome, tt.targets)
+			}
+		})
+	}
+}
+
+func TestScanMissingAttestationWithCIProvenance(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tgo build .\n")
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), `on: push
+jobs:
+  image:
+    runs-on: ubuntu-latest
+    steps:
+      - run: docker push ghcr.io/example/app:1.0
+  provenance:
+    needs: image
+    uses: slsa-framework/slsa-github-generator/.github/workflows/generator_container_slsa3.yml@v2.0.0
+`)
+
+	found := findByRule(invokeScan(t, testClient(t), workspace).GetFindings(), "PROV-001")
+	if len(found) != 1 {
+		t.Fatalf("expected one PROV-001 finding, got %d", len(found))
+	}
+	meta := found[0].GetMetadata()
+	if found[0].GetSeverity() != sdk.SeverityHigh || found[0].GetConfidence() != sdk.ConfidenceLow {
+		t.Errorf("severity %v, confidence %v; want high severity and low confidence", found[0].GetSeverity(), found[0].GetConfidence())
+	}
+	if meta["publication"] != publicationExternal || meta["attestation_steps"] != "1" {
+		t.Errorf("unexpected metadata %v", meta)
+	}
+}
+
+func TestScanPublishingWithProvenanceIsNotFlagged(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), "release:\n\tdocker push ghcr.io/example/app:1.0\n")
+	writeFile(t, filepath.Join(workspace, "app.intoto.jsonl"), testStatement+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+	if found := findByRule(resp.GetFindings(), "PROV-001"); len(found) != 0 {
+		t.Errorf("expected no PROV-001 with provenance present, got %d", len(found))
+	}
+	summary := findByRule(resp.GetFindings(), summaryRuleID)[0]
+	if summary.GetMetadata()["publish_steps"] != "1" || summary.GetSeverity() != sdk.SeverityInfo {
+		t.Errorf("publish_steps = %q, want 1", summary.GetMetadata()["publish_steps"])
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// pypiAttestationRuleID flags PEP 740 publish attestations whose subject or
+// publisher identity does not match the workspace.
+const pypiAttestationRuleID = "PROV-026"
+
+// pypiPredicatePrefix starts the predicate types of PyPI attestations, such
+// as https://docs.pypi.org/attestations/publish/v1.
+const pypiPredicatePrefix = "https://docs.pypi.org/attestations/"
+
+// envelopePEP740 marks statements read from a PEP 740 attestation object.
+const envelopePEP740 = "pep740"
+
+// pep740Envelope is the envelope of a PEP 740 attestation object: the
+// base64 statement and its signature.
+type pep740Envelope struct {
+	Statement string `json:"statement"`
+	Signature string `json:"signature"`
+}
+
+// pep740Material is the verification material of a PEP 740 attestation
+// object: the base64 DER Fulcio certificate and transparency log entries.
+type pep740Material struct {
+	Certificate         string            `json:"certificate"`
+	TransparencyEntries []json.RawMessage `json:"transparency_entries"`
+}
+
+// isPyPIStatement reports whether a statement carries a PyPI predicate,
+// which describes a publish event rather than a SLSA build.
+func isPyPIStatement(ps *parsedStatement) bool {
+	return strings.HasPrefix(ps.Statement.PredicateType, pypiPredicatePrefix)
+}
+
+// Fulcio certificate extensions naming the repository a workflow identity
+// ran in: the source repository URI, and the legacy GitHub workflow
+// repository ("owner/repo", stored without DER wrapping).
+var (
+	oidSourceRepositoryURI      = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 12}
+	oidGitHubWorkflowRepository = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 5}
+)
+
+// pypiPublisher is the Trusted Publisher identity a PEP 740 attestation was
+// signed with.
+type pypiPublisher struct {
+	// repository is the normalized "host/owner/repo" the workflow ran in.
+	repository string
+	// identity is the certificate's workflow identity URI, if any.
+	identity string
+}
+
+// publisherIdentity reads the publisher identity from the base64 DER Fulcio
+// certificate of a PEP 740 attestation, reporting whether one was found.
+func publisherIdentity(certificate string) (pypiPublisher, bool) {
+	der, err := decodeBase64(certificate)
+	if err != nil {
+		return pypiPublisher{}, false
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return pypiPublisher{}, false
+	}
+
+	var p pypiPublisher
+	if len(cert.URIs) > 0 {
+		p.identity = cert.URIs[0].String()
+	}
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidSourceRepositoryURI):
+			var uri string
+			if _, err := asn1.UnmarshalWithParams(ext.Value, &uri, "utf8"); err == nil {
+				p.repository = normalizeRepository(uri)
+			}
+		case ext.Id.Equal(oidGitHubWorkflowRepository) && p.repository == "":
+			p.repository = normalizeRepository("github.com/" + string(ext.Value))
+		}
+	}
+	if p.repository == "" && len(cert.URIs) > 0 {
+		// https://github.com/owner/repo/.github/workflows/release.yml@ref
+		u := cert.URIs[0]
+		parts := strings.SplitN(strings.Trim(u.Path, "/"), "/", 3)
+		if len(parts) >= 2 {
+			p.repository = normalizeRepository(u.Host + "/" + parts[0] + "/" + parts[1])
+		}
+	}
+	return p, p.repository != ""
+}
+
+// normalizeRepository reduces a repository URL, SSH remote, or
+// "host/owner/repo" path to a lowercase "host/owner/repo".
+func normalizeRepository(repo string) string {
+	repo = strings.TrimSpace(repo)
+	if strings.Contains(repo, "://") {
+		if u, err := url.Parse(repo); err == nil {
+			repo = u.Host + u.Path
+		}
+	} else if user, rest, ok := strings.Cut(repo, "@"); ok && !strings.Contains(user, "/") {
+		// git@github.com:owner/repo.git
+		repo = strings.Replace(rest, ":", "/", 1)
+	}
+	repo = strings.TrimSuffix(strings.Trim(repo, "/"), ".git")
+	return strings.ToLower(repo)
+}
+
+// workspaceOrigin returns the normalized repository of the workspace's git
+// origin remote, or "" if there is none.
+func workspaceOrigin(fsys workspaceFS, root string) string {
+	if remote := workspaceRemote(fsys, root); !remote.fallback {
+		return remote.repository
+	}
+	return ""
+}
+
+// pypiAttestation is a PEP 740 statement found in a provenance file,
+// waiting to be checked against the workspace.
+type pypiAttestation struct {
+	location  string
+	line      int
+	publisher pypiPublisher
+	// subjects maps each subject name to its sha256 digest.
+	subjects map[string]string
+}
+
+// recordPyPIAttestation records a PyPI statement for the workspace checks.
+func (s *scanSummary) recordPyPIAttestation(location string, ps *parsedStatement, publisher pypiPublisher) {
+	a := pypiAttestation{location: location, line: ps.Line, publisher: publisher, subjects: make(map[string]string)}
+	for _, subj := range ps.Statement.Subject {
+		a.subjects[subj.Name] = strings.ToLower(subj.Digest["sha256"])
+	}
+	s.pypiAttestations = append(s.pypiAttestations, a)
+}
+
+// verifyPyPIAttestations checks each recorded PEP 740 attestation against
+// the workspace: every subject must be a distribution file in dist/ with the
+// attested digest, when the workspace has a dist/ directory, and the
+// publisher repository must match the git origin, when one is configured.
+func verifyPyPIAttestations(ctx context.Context, findings *findingSet, summary *scanSummary, maxFileSize int64) error {
+	origin := workspaceOrigin(findings.files(), findings.root)
+	dist := filepath.Join(findings.root, "dist")
+	if info, err := findings.files().Stat(dist); err != nil || !info.IsDir() {
+		dist = ""
+	}
+
+	for _, a := range summary.pypiAttestations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if origin != "" && a.publisher.repository != "" && a.publisher.repository != origin {
+			findings.Finding(
+				pypiAttestationRuleID,
+				sdk.SeverityMedium,
+				sdk.ConfidenceHigh,
+				fmt.Sprintf("PyPI attestation was published from %s, not the workspace repository %s", a.publisher.repository, origin),
+			).
+				At(a.location, a.line, a.line).
+				WithMetadata("type", "publisher_mismatch").
+				WithMetadata("publisher_repository", a.publisher.repository).
+				WithMetadata("publisher_identity", a.publisher.identity).
+				WithMetadata("origin_repository", origin).
+				Done()
+		}
+		if dist == "" {
+			continue
+		}
+		for _, name := range sortedKeys(a.subjects) {
+			artifact := filepath.Join(dist, path.Base(slashName(name)))
+			digest := fileDigest(findings.files(), artifact, maxFileSize)
+			switch {
+			case digest == "":
+				findings.Finding(
+					pypiAttestationRuleID,
+					sdk.SeverityMedium,
+					sdk.ConfidenceHigh,
+					fmt.Sprintf("PyPI attestation subject %s is not a distribution file in dist/", name),
+				).
+					At(a.location, a.line, a.line).
+					WithMetadata("type", "subject_not_in_dist").
+					WithMetadata("subject_name", name).
+					Done()
+			case digest != a.subjects[name]:
+				findings.Finding(
+					pypiAttestationRuleID,
+					sdk.SeverityHigh,
+					sdk.ConfidenceHigh,
+					fmt.Sprintf("PyPI attestation subject %s does not match the sha256 digest of dist/%s", name, path.Base(slashName(name))),
+				).
+					At(a.location, a.line, a.line).
+					WithMetadata("type", "subject_digest_mismatch").
+					WithMetadata("subject_name", name).
+					WithMetadata("attested_sha256", a.subjects[name]).
+					WithMetadata("actual_sha256", digest).
+					Done()
+			default:
+				summary.subjectsVerified++
+			}
+		}
+	}
+	return nil
+}
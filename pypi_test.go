@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fulcioCertificate returns a base64 DER certificate shaped like a Fulcio
+// workflow certificate for identity, with the source repository extension
+// set when repo is not empty.
+func fulcioCertificate(t *testing.T, identity, repo string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if identity != "" {
+		u, err := url.Parse(identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.URIs = []*url.URL{u}
+	}
+	if repo != "" {
+		value, err := asn1.MarshalWithParams(repo, "utf8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: oidSourceRepositoryURI, Value: value}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+// pep740Attestation returns a PEP 740 attestation object for a distribution
+// with the given name and content, signed with certificate.
+func pep740Attestation(t *testing.T, name, content, certificate string) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(content))
+	statement, err := json.Marshal(map[string]any{
+		"_type":         "https://in-toto.io/Statement/v1",
+		"subject":       []any{map[string]any{"name": name, "digest": map[string]string{"sha256": hex.EncodeToString(sum[:])}}},
+		"predicateType": "https://docs.pypi.org/attestations/publish/v1",
+		"predicate":     nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := json.Marshal(map[string]any{
+		"version": 1,
+		"verification_material": map[string]any{
+			"certificate":          certificate,
+			"transparency_entries": []any{map[string]any{"logIndex": "148798240"}},
+		},
+		"envelope": map[string]string{
+			"statement": base64.StdEncoding.EncodeToString(statement),
+			"signature": base64.StdEncoding.EncodeToString([]byte("sig")),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(doc)
+}
+
+func TestPublisherIdentity(t *testing.T) {
+	tests := []struct {
+		identity, repo string
+		want           string
+	}{
+		{"https://github.com/Example/App/.github/workflows/release.yml@refs/tags/v1.0", "https://github.com/Example/App", "github.com/example/app"},
+		{"https://github.com/example/app/.github/workflows/release.yml@refs/tags/v1.0", "", "github.com/example/app"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		got, ok := publisherIdentity(fulcioCertificate(t, tt.identity, tt.repo))
+		if got.repository != tt.want || ok != (tt.want != "") {
+			t.Errorf("identity %q, repo %q: got %q (%v), want %q", tt.identity, tt.repo, got.repository, ok, tt.want)
+		}
+	}
+	if _, ok := publisherIdentity("not base64!"); ok {
+		t.Error("expected no identity from an invalid certificate")
+	}
+}
+
+func TestNormalizeRepository(t *testing.T) {
+	for _, remote := range []string{
+		"https://github.com/Example/app.git",
+		"git@github.com:example/app.git",
+		"ssh://git@github.com/example/app",
+		"github.com/example/app/",
+	} {
+		if got := normalizeRepository(remote); got != "github.com/example/app" {
+			t.Errorf("normalizeRepository(%q) = %q", remote, got)
+		}
+	}
+}
+
+func TestCheckProvenancePEP740(t *testing.T) {
+	cert := fulcioCertificate(t, "https://github.com/example/app/.github/workflows/release.yml@refs/tags/v1.0", "https://github.com/example/app")
+	doc := pep740Attestation(t, "app-1.0.tar.gz", "sdist", cert)
+
+	findings := &findingSet{}
+	summary := &scanSummary{}
+	if err := checkProvenance(context.Background(), findings, "app-1.0.tar.gz.publish.attestation", []byte(doc), provenancePolicy{requiredSLSALevel: 1}, summary); err != nil {
+		t.Fatal(err)
+	}
+	// No SLSA build checks apply to a publish attestation.
+	if len(findings.items) != 0 {
+		t.Errorf("expected no findings for a well-formed attestation, got %s", findings.items[0].message)
+	}
+	if len(summary.pypiAttestations) != 1 || summary.pypiAttestations[0].publisher.repository != "github.com/example/app" {
+		t.Errorf("unexpected recorded attestations %+v", summary.pypiAttestations)
+	}
+
+	statements, err := parseProvenance(context.Background(), []byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps := statements[0]; ps.Envelope != envelopePEP740 || ps.Signatures != 1 || ps.TlogEntries != 1 {
+		t.Errorf("envelope %s, signatures %d, tlog entries %d", ps.Envelope, ps.Signatures, ps.TlogEntries)
+	}
+}
+
+func TestScanPEP740Attestations(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".git", "config"), "[core]\n\tbare = false\n[remote \"origin\"]\n\turl = git@github.com:example/app.git\n")
+	writeFile(t, filepath.Join(workspace, "dist", "app-1.0.tar.gz"), "sdist")
+	writeFile(t, filepath.Join(workspace, "dist", "app-1.0-py3-none-any.whl"), "rebuilt wheel")
+
+	ours := fulcioCertificate(t, "https://github.com/example/app/.github/workflows/release.yml@refs/tags/v1.0", "https://github.com/example/app")
+	fork := fulcioCertificate(t, "https://github.com/someone/app/.github/workflows/release.yml@refs/heads/main", "https://github.com/someone/app")
+	writeFile(t, filepath.Join(workspace, "dist", "app-1.0.tar.gz.publish.attestation"), pep740Attestation(t, "app-1.0.tar.gz", "sdist", ours))
+	writeFile(t, filepath.Join(workspace, "dist", "app-1.0-py3-none-any.whl.publish.attestation"), pep740Attestation(t, "app-1.0-py3-none-any.whl", "wheel", fork))
+	writeFile(t, filepath.Join(workspace, "dist", "app-0.9.tar.gz.publish.attestation"), pep740Attestation(t, "app-0.9.tar.gz", "old", fulcioCertificate(t, "", "")))
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	got := make(map[string]string)
+	for _, f := range findByRule(resp.GetFindings(), pypiAttestationRuleID) {
+		meta := f.GetMetadata()
+		got[filepath.Base(f.GetLocation().GetFilePath())+":"+meta["type"]] = severityNames[f.GetSeverity()]
+	}
+	want := map[string]string{
+		"app-1.0-py3-none-any.whl.publish.attestation:publisher_mismatch":      "medium",
+		"app-1.0-py3-none-any.whl.publish.attestation:subject_digest_mismatch": "high",
+		"app-0.9.tar.gz.publish.attestation:missing_publisher_identity":        "medium",
+		"app-0.9.tar.gz.publish.attestation:subject_not_in_dist":               "medium",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for key, severity := range want {
+		if got[key] != severity {
+			t.Errorf("%s: severity %q, want %q", key, got[key], severity)
+		}
+	}
+	if found := findByRule(resp.GetFindings(), "PROV-002"); len(found) != 0 {
+		t.Errorf("expected no PROV-002 for PyPI attestations, got %d", len(found))
+	}
+	summary := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if summary["provenance_files_scanned"] != "3" || summary["subjects_verified"] != "1" {
+		t.Errorf("provenance_files_scanned = %q, subjects_verified = %q", summary["provenance_files_scanned"], summary["subjects_verified"])
+	}
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// registryOverrideRuleID flags dependency configuration that changes where
+// the build fetches its dependencies from: plain HTTP registries, extra
+// package indexes, Maven mirrors without checksum enforcement, and mirrors
+// that are neither public nor trusted.
+const registryOverrideRuleID = "PROV-058"
+
+// Ecosystems of registry settings, named as in package URLs.
+const (
+	ecosystemPyPI  = "pypi"
+	ecosystemMaven = "maven"
+)
+
+// Types of registry findings.
+const (
+	registryInsecure         = "insecure_registry"
+	registryExtraIndex       = "extra_index"
+	registryUnverifiedMirror = "unverified_mirror"
+	registryOverride         = "registry_override"
+)
+
+// publicRegistries are the hosts of the default public registries, which
+// are not reported as overrides.
+var publicRegistries = map[string]bool{
+	"registry.npmjs.org":     true,
+	"registry.yarnpkg.com":   true,
+	"pypi.org":               true,
+	"pypi.python.org":        true,
+	"files.pythonhosted.org": true,
+	"proxy.golang.org":       true,
+	"repo.maven.apache.org":  true,
+	"repo1.maven.org":        true,
+}
+
+// registrySetting is a configured registry, index, proxy, or mirror.
+type registrySetting struct {
+	ecosystem string
+	// setting names where it was configured, such as registry,
+	// @scope:registry, extra-index-url, GOPROXY, or mirror.
+	setting string
+	// value is the configured URL, or direct for a Go proxy list that
+	// fetches from version control first.
+	value string
+	// extra marks an index consulted alongside the primary one.
+	extra bool
+	// unverified marks a Maven mirror whose checksums are not enforced.
+	unverified bool
+}
+
+// newRegistryFinding returns the finding for a registry setting, or nil
+// when it is a public or trusted registry. Plain HTTP is High; an extra
+// index, which lets a package of the same name on either index win, and an
+// unverified mirror are Medium; any other registry is Low, naming it so it
+// can be added to trusted_registries. Credentials are removed from the URL.
+func newRegistryFinding(findings *findingSet, policy provenancePolicy, filePath string, line int, s registrySetting) *findingBuilder {
+	clean, scheme, host := s.value, "", ""
+	if s.value != "direct" {
+		u, err := url.Parse(s.value)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") || strings.Contains(u.Host, "$") {
+			return nil
+		}
+		u.User = nil
+		clean, scheme, host = u.String(), u.Scheme, strings.ToLower(u.Hostname())
+	}
+
+	typ, sev, msg := "", sdk.SeverityLow, ""
+	conf := sdk.ConfidenceHigh
+	switch {
+	case scheme == "http" && !isLoopbackHost(host):
+		typ, sev = registryInsecure, sdk.SeverityHigh
+		msg = fmt.Sprintf("Dependency registry fetched over plain HTTP: %s %s", s.setting, clean)
+	case s.extra:
+		typ, sev = registryExtraIndex, sdk.SeverityMedium
+		msg = fmt.Sprintf("Extra package index %s: a package published under the same name on either index can replace the intended one (dependency confusion)", clean)
+	case s.unverified:
+		typ, sev, conf = registryUnverifiedMirror, sdk.SeverityMedium, sdk.ConfidenceMedium
+		msg = fmt.Sprintf("Maven mirror %s is used without a fail checksum policy, so corrupted or substituted artifacts only warn", clean)
+	case s.value == "direct":
+		if trustedRegistry(policy, "direct") {
+			return nil
+		}
+		typ = registryOverride
+		msg = "GOPROXY fetches modules directly from version control instead of a module proxy"
+	default:
+		if publicRegistries[host] || isLoopbackHost(host) || trustedRegistry(policy, host) {
+			return nil
+		}
+		typ = registryOverride
+		msg = fmt.Sprintf("Dependency registry overridden with %s: %s", host, clean)
+	}
+	fb := findings.Finding(registryOverrideRuleID, sev, conf, msg).
+		At(filePath, line, line).
+		WithMetadata("type", typ).
+		WithMetadata("ecosystem", s.ecosystem).
+		WithMetadata("setting", s.setting).
+		WithMetadata("url", clean)
+	if host != "" {
+		fb.WithMetadata("registry_host", host)
+	}
+	return fb
+}
+
+// trustedRegistry reports whether host matches a trusted_registries glob.
+func trustedRegistry(policy provenancePolicy, host string) bool {
+	for _, pattern := range policy.trustedRegistries {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isLoopbackHost reports whether host names the local machine, whose
+// registries never cross the network.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// registryConfigNames maps the names of dependency configuration files to
+// their ecosystem. Requirements files are matched by isRequirementsFile.
+var registryConfigNames = map[string]string{
+	".npmrc":       ecosystemNPM,
+	".yarnrc":      ecosystemNPM,
+	".yarnrc.yml":  ecosystemNPM,
+	"pip.conf":     ecosystemPyPI,
+	"pip.ini":      ecosystemPyPI,
+	"settings.xml": ecosystemMaven,
+}
+
+// isRequirementsFile reports whether name is a pip requirements or
+// constraints file.
+func isRequirementsFile(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasSuffix(lower, ".txt") && (strings.Contains(lower, "requirements") || strings.Contains(lower, "constraints"))
+}
+
+// registryAnalyzer checks dependency configuration files for registry
+// overrides.
+type registryAnalyzer struct{}
+
+func (registryAnalyzer) kinds() fileKind { return kindRegistry }
+
+func (registryAnalyzer) name() string { return "registry" }
+
+func (registryAnalyzer) matches(_, name string, _ *provenanceMatcher) fileKind {
+	if registryConfigNames[name] != "" || isRequirementsFile(name) {
+		return kindRegistry
+	}
+	return 0
+}
+
+func (registryAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := r.findings.files().ReadFile(job.path)
+	if err != nil {
+		r.summary.filesUnreadable++
+		return nil
+	}
+	report := func(line int, s registrySetting) {
+		if fb := newRegistryFinding(r.findings, r.policy, job.path, line, s); fb != nil {
+			fb.Done()
+		}
+	}
+	switch name := filepath.Base(job.path); {
+	case name == ".npmrc":
+		scanNPMRC(data, report)
+	case name == ".yarnrc" || name == ".yarnrc.yml":
+		scanYarnRC(data, report)
+	case name == "pip.conf" || name == "pip.ini":
+		scanPipConfig(data, report)
+	case name == "settings.xml":
+		strict := mavenStrictChecksums(r.findings.files(), job.path)
+		return scanMavenSettings(ctx, data, strict, report)
+	default:
+		scanRequirements(data, report)
+	}
+	return nil
+}
+
+// registryReporter receives each registry setting of a file with its line.
+type registryReporter func(line int, s registrySetting)
+
+// scanNPMRC reads the registry and @scope:registry keys of an .npmrc.
+func scanNPMRC(data []byte, report registryReporter) {
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if key == "registry" || strings.HasPrefix(key, "@") && strings.HasSuffix(key, ":registry") {
+			report(i+1, registrySetting{ecosystem: ecosystemNPM, setting: key, value: unquote(strings.TrimSpace(value))})
+		}
+	}
+}
+
+// yarnRegistry matches the registry of a Yarn 1 .yarnrc or the
+// npmRegistryServer of a Yarn 2+ .yarnrc.yml, including under npmScopes.
+var yarnRegistry = regexp.MustCompile(`^\s*("?registry"?|npmRegistryServer:)\s+["']?([^\s"']+)`)
+
+// scanYarnRC reads the registries of a .yarnrc or .yarnrc.yml.
+func scanYarnRC(data []byte, report registryReporter) {
+	for i, line := range strings.Split(string(data), "\n") {
+		if m := yarnRegistry.FindStringSubmatch(line); m != nil {
+			report(i+1, registrySetting{ecosystem: ecosystemNPM, setting: strings.Trim(m[1], `":`), value: m[2]})
+		}
+	}
+}
+
+// scanPipConfig reads the index-url and extra-index-url options of a pip
+// configuration file. An option's value may continue on indented lines,
+// one URL each.
+func scanPipConfig(data []byte, report registryReporter) {
+	option := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';':
+			continue
+		case line[0] == ' ' || line[0] == '\t':
+			if option != "" {
+				reportPipIndex(report, i+1, option, trimmed)
+			}
+			continue
+		}
+		option = ""
+		key, value, ok := strings.Cut(trimmed, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "_", "-")
+		if key != "index-url" && key != "extra-index-url" {
+			continue
+		}
+		option = key
+		for _, v := range strings.Fields(value) {
+			reportPipIndex(report, i+1, option, v)
+		}
+	}
+}
+
+func reportPipIndex(report registryReporter, line int, option, value string) {
+	report(line, registrySetting{ecosystem: ecosystemPyPI, setting: option, value: value, extra: option == "extra-index-url"})
+}
+
+// scanRequirements reads the index options of a pip requirements file.
+func scanRequirements(data []byte, report registryReporter) {
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		for j := 0; j < len(fields); j++ {
+			if strings.HasPrefix(fields[j], "#") {
+				break
+			}
+			if option, value, ok := pipIndexFlag(fields, &j); ok {
+				reportPipIndex(report, i+1, option, value)
+			}
+		}
+	}
+}
+
+// pipIndexFlag reads a pip --index-url, -i, or --extra-index-url flag at
+// words[*i], advancing *i past a separate value. option is the flag's
+// long name without dashes.
+func pipIndexFlag(words []string, i *int) (option, value string, ok bool) {
+	w := words[*i]
+	for _, flag := range []string{"--index-url", "--extra-index-url", "-i"} {
+		name := strings.TrimPrefix(flag, "--")
+		if flag == "-i" {
+			name = "index-url"
+		}
+		switch {
+		case w == flag && *i+1 < len(words):
+			*i++
+			return name, words[*i], true
+		case strings.HasPrefix(w, flag+"="):
+			return name, strings.TrimPrefix(w, flag+"="), true
+		}
+	}
+	return "", "", false
+}
+
+// mavenStrictChecksums reports whether the Maven project a settings.xml
+// belongs to fails on checksum mismatches for every repository, through -C
+// or --strict-checksums in .mvn/maven.config. The project is the parent
+// of a .mvn directory holding the settings, or its own directory.
+func mavenStrictChecksums(fsys workspaceFS, settingsPath string) bool {
+	project := filepath.Dir(settingsPath)
+	if filepath.Base(project) == ".mvn" {
+		project = filepath.Dir(project)
+	}
+	data, err := fsys.ReadFile(filepath.Join(project, ".mvn", "maven.config"))
+	if err != nil {
+		return false
+	}
+	for _, f := range strings.Fields(string(data)) {
+		if f == "-C" || f == "--strict-checksums" {
+			return true
+		}
+	}
+	return false
+}
+
+// scanMavenSettings reads the mirrors of a Maven settings.xml. Mirrors are
+// unverified unless Maven runs with strict checksums or a repository sets
+// a fail checksumPolicy; a settings file whose repositories all fail on
+// checksum mismatches protects every mirror. Documents that are not Maven
+// settings are ignored.
+func scanMavenSettings(ctx context.Context, data []byte, strict bool, report registryReporter) error {
+	type mirror struct {
+		url  string
+		line int
+	}
+	var mirrors []mirror
+	failPolicy, otherPolicy := false, false
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	var stack []string
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 && t.Name.Local != "settings" {
+				return nil
+			}
+			stack = append(stack, t.Name.Local)
+			line, _ := dec.InputPos()
+			parent := ""
+			if len(stack) > 1 {
+				parent = stack[len(stack)-2]
+			}
+			switch {
+			case t.Name.Local == "url" && parent == "mirror":
+				mirrors = append(mirrors, mirror{line: line})
+			case t.Name.Local == "checksumPolicy":
+				var policy string
+				if err := dec.DecodeElement(&policy, &t); err != nil {
+					return nil
+				}
+				stack = stack[:len(stack)-1]
+				if strings.TrimSpace(policy) == "fail" {
+					failPolicy = true
+				} else {
+					otherPolicy = true
+				}
+			}
+		case xml.CharData:
+			if len(stack) >= 2 && stack[len(stack)-1] == "url" && stack[len(stack)-2] == "mirror" && len(mirrors) > 0 {
+				mirrors[len(mirrors)-1].url += string(t)
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	unverified := !strict && (!failPolicy || otherPolicy)
+	for _, m := range mirrors {
+		report(m.line, registrySetting{ecosystem: ecosystemMaven, setting: "mirror", value: strings.TrimSpace(m.url), unverified: unverified})
+	}
+	return nil
+}
+
+// registryEnv matches environment settings of registries in shell
+// assignments and exports, Dockerfile ENV, go env -w, and CI env maps.
+var registryEnv = regexp.MustCompile(`(?:^|[\s;&|("'])(GOPROXY|PIP_INDEX_URL|PIP_EXTRA_INDEX_URL|(?i:npm_config_registry)|YARN_REGISTRY)(?:=|:\s+)["']?([^\s"';&|)]+)`)
+
+// registryEnvEcosystems maps registry environment variables, uppercased,
+// to their ecosystem.
+var registryEnvEcosystems = map[string]string{
+	"GOPROXY":             ecosystemGo,
+	"PIP_INDEX_URL":       ecosystemPyPI,
+	"PIP_EXTRA_INDEX_URL": ecosystemPyPI,
+	"NPM_CONFIG_REGISTRY": ecosystemNPM,
+	"YARN_REGISTRY":       ecosystemNPM,
+}
+
+// pipTools and npmTools are the commands whose registry flags are read.
+var (
+	pipTools = map[string]bool{"pip": true, "pip3": true, "uv": true, "python": true, "python3": true}
+	npmTools = map[string]bool{"npm": true, "pnpm": true, "yarn": true, "npx": true}
+)
+
+// reportRegistryCommand flags registry overrides in a build command:
+// registry environment variables, pip index flags, npm --registry, and npm
+// or yarn config set registry.
+func reportRegistryCommand(findings *findingSet, filePath string, cmd logicalCommand, origin commandOrigin, action *actionTracker, policy provenancePolicy) {
+	report := func(s registrySetting) {
+		if fb := newRegistryFinding(findings, policy, filePath, cmd.line, s); fb != nil {
+			action.annotate(origin.annotate(fb)).Done()
+		}
+	}
+	for _, m := range registryEnv.FindAllStringSubmatch(cmd.text, -1) {
+		name := strings.ToUpper(m[1])
+		if name == "GOPROXY" {
+			for _, s := range goProxySettings(m[2]) {
+				report(s)
+			}
+			continue
+		}
+		report(registrySetting{ecosystem: registryEnvEcosystems[name], setting: m[1], value: m[2], extra: name == "PIP_EXTRA_INDEX_URL"})
+	}
+
+	if !strings.Contains(cmd.text, "index-url") && !strings.Contains(cmd.text, "-i ") && !strings.Contains(cmd.text, "registry") {
+		return
+	}
+	for _, c := range newShellParser().parse(cmd.text) {
+		words := c.words
+		for len(words) > 0 && (words[0] == "sudo" || envAssignment.MatchString(words[0])) {
+			words = words[1:]
+		}
+		if len(words) < 2 {
+			continue
+		}
+		tool := path.Base(words[0])
+		switch {
+		case pipTools[tool]:
+			for i := 1; i < len(words); i++ {
+				if option, value, ok := pipIndexFlag(words, &i); ok {
+					report(registrySetting{ecosystem: ecosystemPyPI, setting: option, value: value, extra: option == "extra-index-url"})
+				}
+			}
+		case npmTools[tool]:
+			for i := 1; i < len(words); i++ {
+				switch w := words[i]; {
+				case w == "--registry" && i+1 < len(words):
+					i++
+					report(registrySetting{ecosystem: ecosystemNPM, setting: "registry", value: words[i]})
+				case strings.HasPrefix(w, "--registry="):
+					report(registrySetting{ecosystem: ecosystemNPM, setting: "registry", value: strings.TrimPrefix(w, "--registry=")})
+				case w == "config" && i+3 < len(words) && words[i+1] == "set" && strings.HasSuffix(words[i+2], "registry"):
+					report(registrySetting{ecosystem: ecosystemNPM, setting: words[i+2], value: words[i+3]})
+					i += 3
+				}
+			}
+		}
+	}
+}
+
+// goProxySettings returns the settings of a GOPROXY list worth checking:
+// every proxy URL, and direct when it comes first. direct as the fallback,
+// as in the default https://proxy.golang.org,direct, is not an override.
+func goProxySettings(value string) []registrySetting {
+	var out []registrySetting
+	for i, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '|' }) {
+		switch {
+		case entry == "off":
+		case entry == "direct":
+			if i == 0 {
+				out = append(out, registrySetting{ecosystem: ecosystemGo, setting: "GOPROXY", value: "direct"})
+			}
+		default:
+			out = append(out, registrySetting{ecosystem: ecosystemGo, setting: "GOPROXY", value: entry})
+		}
+	}
+	return out
+}
+
+// unquote strips one pair of matching quotes.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
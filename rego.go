@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+// policyDenialRuleID flags statements denied by a workspace Rego policy.
+const policyDenialRuleID = "PROV-033"
+
+// policyQuery is the package workspace policies declare their deny rules
+// in.
+const policyQuery = "data.provenance"
+
+// policyTimeout bounds the evaluation of the policies against one statement.
+const policyTimeout = 5 * time.Second
+
+// regoPolicy is the set of Rego modules named by policy_files, compiled
+// together and prepared for evaluation against each statement.
+type regoPolicy struct {
+	query rego.PreparedEvalQuery
+}
+
+// sandboxCapabilities returns the builtins policies may call: every
+// deterministic builtin of this OPA version. Network access, the clock,
+// randomness, and runtime information are unavailable.
+func sandboxCapabilities() *ast.Capabilities {
+	caps := ast.CapabilitiesForThisVersion()
+	builtins := caps.Builtins[:0]
+	for _, b := range caps.Builtins {
+		if !b.Nondeterministic {
+			builtins = append(builtins, b)
+		}
+	}
+	caps.Builtins = builtins
+	caps.AllowNet = []string{}
+	return caps
+}
+
+// loadRegoPolicy reads and compiles the policy files, given relative to the
+// workspace root, which they must stay inside. No files yield a nil policy.
+func loadRegoPolicy(ctx context.Context, fsys workspaceFS, root string, files []string) (*regoPolicy, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	options := []func(*rego.Rego){
+		rego.Query(policyQuery),
+		rego.Capabilities(sandboxCapabilities()),
+		rego.StrictBuiltinErrors(true),
+	}
+	for _, file := range files {
+		p := filepath.FromSlash(file)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(root, p)
+		}
+		if !withinDir(realPath(root), realPath(filepath.Clean(p))) {
+			return nil, fmt.Errorf("policy_files: %q is outside the workspace", file)
+		}
+		data, err := fsys.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("policy_files: reading %q: %w", file, err)
+		}
+		options = append(options, rego.Module(workspacePath(root, p), string(data)))
+	}
+	query, err := rego.New(options...).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("policy_files: %w", err)
+	}
+	return &regoPolicy{query: query}, nil
+}
+
+// policyInput builds the input document a policy sees for one statement:
+// the decoded statement, how it was wrapped, and where it was found.
+func policyInput(file string, ps *parsedStatement) (map[string]any, error) {
+	raw, err := json.Marshal(ps.Statement)
+	if err != nil {
+		return nil, err
+	}
+	var statement any
+	if err := json.Unmarshal(raw, &statement); err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"statement": statement,
+		"envelope": map[string]any{
+			"type":         ps.Envelope,
+			"signatures":   ps.Signatures,
+			"tlog_entries": ps.TlogEntries,
+		},
+		"file":  file,
+		"index": ps.Index,
+	}, nil
+}
+
+// isDenyRule reports whether a rule of the policy package lists denials:
+// deny itself or any rule named deny_*.
+func isDenyRule(name string) bool {
+	return name == "deny" || strings.HasPrefix(name, "deny_")
+}
+
+// denialMessage reads one denial: a message string, or an object with a
+// msg field.
+func denialMessage(denial any) (string, bool) {
+	switch d := denial.(type) {
+	case string:
+		return d, true
+	case map[string]any:
+		msg, ok := d["msg"].(string)
+		return msg, ok
+	}
+	return "", false
+}
+
+// policyDenial is one denial returned by a deny rule.
+type policyDenial struct {
+	rule    string
+	message string
+}
+
+// evaluate runs the policy against one statement, found in file, and returns
+// its denials sorted by rule. Evaluation is bounded by policyTimeout.
+func (p *regoPolicy) evaluate(ctx context.Context, file string, ps *parsedStatement) ([]policyDenial, error) {
+	input, err := policyInput(file, ps)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, policyTimeout)
+	defer cancel()
+	results, err := p.query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return nil, nil
+	}
+	var denials []policyDenial
+	rules, _ := results[0].Expressions[0].Value.(map[string]any)
+	for _, name := range sortedKeys(rules) {
+		if !isDenyRule(name) {
+			continue
+		}
+		set, _ := rules[name].([]any)
+		for _, denial := range set {
+			if msg, ok := denialMessage(denial); ok {
+				denials = append(denials, policyDenial{rule: name, message: msg})
+			}
+		}
+	}
+	return denials, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestSandboxCapabilities(t *testing.T) {
+	for _, b := range sandboxCapabilities().Builtins {
+		switch b.Name {
+		case "http.send", "time.now_ns", "opa.runtime", "rand.intn":
+			t.Errorf("sandbox allows nondeterministic builtin %s", b.Name)
+		}
+	}
+}
+
+func TestDenialMessage(t *testing.T) {
+	tests := []struct {
+		denial any
+		want   string
+		ok     bool
+	}{
+		{"builder is untrusted", "builder is untrusted", true},
+		{map[string]any{"msg": "wrong environment", "field": "environment"}, "wrong environment", true},
+		{map[string]any{"reason": "no msg"}, "", false},
+		{true, "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := denialMessage(tt.denial); got != tt.want || ok != tt.ok {
+			t.Errorf("denialMessage(%v) = (%q, %v), want (%q, %v)", tt.denial, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestScanPolicyFiles(t *testing.T) {
+	client := testClient(t)
+	workspace := filepath.Join(testdataDir(t), "policy")
+
+	pass := invokeScanWithInput(t, client, map[string]any{
+		"workspace_root": workspace,
+		"policy_files":   "policies/builder.rego",
+	})
+	if got := findByRule(pass.GetFindings(), policyDenialRuleID); len(got) != 0 {
+		t.Errorf("expected the builder policy to pass, got %d %s findings", len(got), policyDenialRuleID)
+	}
+
+	fail := invokeScanWithInput(t, client, map[string]any{
+		"workspace_root": workspace,
+		"policy_files":   []any{"policies/builder.rego", "policies/production.rego"},
+	})
+	got := make(map[string]string)
+	for _, f := range findByRule(fail.GetFindings(), policyDenialRuleID) {
+		meta := f.GetMetadata()
+		if meta["type"] != "policy_denial" || f.GetLocation().GetFilePath() != "provenance.json" {
+			t.Errorf("unexpected finding at %s: %v", f.GetLocation().GetFilePath(), meta)
+		}
+		got[meta["policy_rule"]] = meta["policy_message"]
+	}
+	want := map[string]string{
+		"deny_build_type":  "buildType https://github.com/actions/workflow is not the internal builder",
+		"deny_environment": "externalParameters.environment must be production",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got denials %v, want %v", got, want)
+	}
+	for rule, msg := range want {
+		if got[rule] != msg {
+			t.Errorf("%s: message %q, want %q", rule, got[rule], msg)
+		}
+	}
+}
+
+func TestScanPolicyFilesErrors(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "broken.rego"), []byte("package provenance\n\ndeny contains msg if {\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workspace, "network.rego"), []byte("package provenance\n\ndeny contains \"x\" if {\n\thttp.send({\"method\": \"get\", \"url\": \"https://example.com\"})\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{"broken.rego", "network.rego", "missing.rego", "../outside.rego"} {
+		input, err := structpb.NewStruct(map[string]any{
+			"workspace_root": workspace,
+			"policy_files":   file,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = testClient(t).InvokeTool(context.Background(), &pluginv1.InvokeToolRequest{
+			ToolName: "scan",
+			Input:    input,
+		})
+		if err == nil {
+			t.Errorf("%s: expected a tool error", file)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// ephemeralSourceRuleID flags provenance whose source or materials are
+// named only by references that move or disappear.
+const ephemeralSourceRuleID = "PROV-056"
+
+// maxEphemeralReferenceFindings caps the PROV-056 findings for a single
+// statement.
+const maxEphemeralReferenceFindings = 20
+
+// Kinds of git revision a provenance reference may name. Commits and tags
+// are durable; the rest change or disappear.
+const (
+	revisionCommit           = "commit"
+	revisionTag              = "tag"
+	revisionPullRequestMerge = "pull_request_merge"
+	revisionPullRequestHead  = "pull_request_head"
+	revisionMergeRequest     = "merge_request"
+	revisionGerritChange     = "gerrit_change"
+	revisionBranch           = "branch"
+	revisionRef              = "ref"
+	revisionNone             = "unpinned"
+)
+
+// revisionDescriptions describes each ephemeral revision kind in messages.
+var revisionDescriptions = map[string]string{
+	revisionPullRequestMerge: "a pull request merge ref",
+	revisionPullRequestHead:  "a pull request head ref",
+	revisionMergeRequest:     "a merge request ref",
+	revisionGerritChange:     "a Gerrit change ref",
+	revisionBranch:           "a branch head",
+	revisionRef:              "a ref other than a tag",
+}
+
+var (
+	commitRevision  = regexp.MustCompile(`^[0-9a-fA-F]{7,64}$`)
+	versionRevision = regexp.MustCompile(`^v?[0-9]+(\.[0-9]+)+([-+.][0-9A-Za-z.-]+)?$`)
+)
+
+// classifyRevision returns the kind of a git revision: a commit hash, a
+// full ref, or a bare name. Bare names that look like versions are taken
+// for tags and others for branches.
+func classifyRevision(rev string) string {
+	switch {
+	case rev == "":
+		return revisionNone
+	case commitRevision.MatchString(rev):
+		return revisionCommit
+	case strings.HasPrefix(rev, "refs/tags/"):
+		return revisionTag
+	case strings.HasPrefix(rev, "refs/pull/") && strings.HasSuffix(rev, "/merge"):
+		return revisionPullRequestMerge
+	case strings.HasPrefix(rev, "refs/pull/"):
+		return revisionPullRequestHead
+	case strings.HasPrefix(rev, "refs/merge-requests/"):
+		return revisionMergeRequest
+	case strings.HasPrefix(rev, "refs/changes/"):
+		return revisionGerritChange
+	case strings.HasPrefix(rev, "refs/heads/"), rev == "HEAD":
+		return revisionBranch
+	case strings.HasPrefix(rev, "refs/"):
+		return revisionRef
+	case versionRevision.MatchString(rev):
+		return revisionTag
+	default:
+		return revisionBranch
+	}
+}
+
+// splitGitURI splits a git URI such as
+// git+https://github.com/org/repo@refs/heads/main#subdir into the
+// normalized repository and the revision after the "@" of its path. An "@"
+// in the authority, as in a user name, is not a revision.
+func splitGitURI(uri string) (repository, rev string) {
+	s, _, _ := strings.Cut(strings.TrimPrefix(uri, "git+"), "#")
+	pathStart := 0
+	if i := strings.Index(s, "://"); i >= 0 {
+		slash := strings.Index(s[i+3:], "/")
+		if slash < 0 {
+			return normalizeRepository(s), ""
+		}
+		pathStart = i + 3 + slash
+	} else if i := strings.Index(s, ":"); i >= 0 {
+		// git@github.com:owner/repo.git@rev
+		pathStart = i
+	}
+	if i := strings.Index(s[pathStart:], "@"); i >= 0 {
+		rev = s[pathStart+i+1:]
+		s = s[:pathStart+i]
+	}
+	return normalizeRepository(s), rev
+}
+
+// isGitURI reports whether a material URI names a git repository rather
+// than a package or file.
+func isGitURI(uri string) bool {
+	if hasAnyPrefix(uri, []string{"git+", "git://", "ssh://", "git@"}) {
+		return true
+	}
+	repo, _, _ := strings.Cut(uri, "@")
+	return strings.HasSuffix(repo, ".git")
+}
+
+// gitCommitDigest returns the commit a digest set pins, from a sha1 or
+// gitCommit entry. An abbreviated or malformed value still records that a
+// commit was pinned.
+func gitCommitDigest(digest map[string]string) string {
+	for alg, value := range digest {
+		switch strings.ToLower(alg) {
+		case "sha1", "gitcommit":
+			if value != "" {
+				return strings.ToLower(value)
+			}
+		}
+	}
+	return ""
+}
+
+// sourceReference is a git repository reference in a statement's source or
+// materials.
+type sourceReference struct {
+	// reference is the URI or ref as recorded, and field where it was read.
+	reference  string
+	field      string
+	repository string
+	// commit is the commit the reference pins, by its digest or revision,
+	// or "" when it names none.
+	commit string
+	kind   string
+	source bool
+}
+
+// durable reports whether the reference cannot move: it pins a commit or
+// names a tag.
+func (r sourceReference) durable() bool {
+	return r.commit != "" || r.kind == revisionCommit || r.kind == revisionTag
+}
+
+// newSourceReference classifies the git URI or ref read from field.
+func newSourceReference(reference, field, repository, rev string, digest map[string]string, source bool) sourceReference {
+	r := sourceReference{reference: reference, field: field, repository: repository, kind: classifyRevision(rev), source: source}
+	r.commit = gitCommitDigest(digest)
+	if r.commit == "" && r.kind == revisionCommit {
+		r.commit = strings.ToLower(rev)
+	}
+	return r
+}
+
+// sourceReferences returns the git references of a statement: its source,
+// read from the workflow ref and source parameter in v1 or the config
+// source in v0.2, and its materials with a git URI or commit digest.
+func sourceReferences(p *slsaPredicate) []sourceReference {
+	var refs []sourceReference
+	var workflow struct {
+		Ref        string `json:"ref"`
+		Repository string `json:"repository"`
+	}
+	if raw, ok := p.BuildDefinition.ExternalParameters["workflow"]; ok && json.Unmarshal(raw, &workflow) == nil && workflow.Ref != "" {
+		repo := workflow.Repository
+		if repo == "" {
+			repo = p.sourceRepo()
+		}
+		refs = append(refs, newSourceReference(workflow.Ref, "buildDefinition.externalParameters.workflow.ref",
+			normalizeRepository(strings.TrimPrefix(repo, "git+")), workflow.Ref, nil, true))
+	}
+	if raw, ok := p.BuildDefinition.ExternalParameters["source"]; ok {
+		var desc slsaMaterial
+		if json.Unmarshal(raw, &desc.URI) != nil {
+			_ = json.Unmarshal(raw, &desc)
+		}
+		if desc.URI != "" && (isGitURI(desc.URI) || gitCommitDigest(desc.Digest) != "") {
+			repo, rev := splitGitURI(desc.URI)
+			refs = append(refs, newSourceReference(desc.URI, "buildDefinition.externalParameters.source", repo, rev, desc.Digest, true))
+		}
+	}
+	if cs := p.Invocation.ConfigSource; cs.URI != "" && (isGitURI(cs.URI) || gitCommitDigest(cs.Digest) != "") {
+		repo, rev := splitGitURI(cs.URI)
+		refs = append(refs, newSourceReference(cs.URI, "invocation.configSource.uri", repo, rev, cs.Digest, true))
+	}
+	for _, list := range []struct {
+		field     string
+		materials []slsaMaterial
+	}{
+		{"materials", p.Materials},
+		{"buildDefinition.resolvedDependencies", p.BuildDefinition.ResolvedDependencies},
+	} {
+		for i, m := range list.materials {
+			if m.URI == "" || !(isGitURI(m.URI) || gitCommitDigest(m.Digest) != "") {
+				continue
+			}
+			repo, rev := splitGitURI(m.URI)
+			refs = append(refs, newSourceReference(m.URI, fmt.Sprintf("%s[%d].uri", list.field, i), repo, rev, m.Digest, false))
+		}
+	}
+	return refs
+}
+
+// ephemeralReferences returns the references of a statement that name only
+// a moving or vanishing revision: no reference to the same repository, in
+// the source or any material, pins a commit or names a tag. Each distinct
+// reference is returned once.
+func ephemeralReferences(refs []sourceReference) []sourceReference {
+	pinned := make(map[string]bool)
+	for _, r := range refs {
+		if r.durable() {
+			pinned[r.repository] = true
+		}
+	}
+	var out []sourceReference
+	seen := make(map[string]bool)
+	for _, r := range refs {
+		if r.durable() || pinned[r.repository] || seen[r.reference] {
+			continue
+		}
+		seen[r.reference] = true
+		out = append(out, r)
+	}
+	return out
+}
+
+// ephemeralMessage describes an ephemeral reference in a PROV-056 finding.
+func ephemeralMessage(r sourceReference) string {
+	role := "material"
+	if r.source {
+		role = "source"
+	}
+	if r.kind == revisionNone {
+		return fmt.Sprintf("Provenance %s %s names no revision, and nothing in the statement pins its commit", role, r.reference)
+	}
+	return fmt.Sprintf("Provenance %s %s is %s, which can move or disappear, and nothing in the statement pins its commit", role, r.reference, revisionDescriptions[r.kind])
+}
+
+// sourceRevision is a commit a statement pins, waiting to be looked up in
+// the workspace's git object store.
+type sourceRevision struct {
+	location   string
+	line       int
+	index      int
+	field      string
+	repository string
+	commit     string
+}
+
+// recordSourceRevisions records the commits a statement pins.
+func (s *scanSummary) recordSourceRevisions(location string, ps *parsedStatement, refs []sourceReference) {
+	seen := make(map[string]bool)
+	for _, r := range refs {
+		if r.commit == "" || seen[r.commit+" "+r.repository] {
+			continue
+		}
+		seen[r.commit+" "+r.repository] = true
+		s.sourceRevisions = append(s.sourceRevisions, sourceRevision{
+			location:   location,
+			line:       ps.Line,
+			index:      ps.Index,
+			field:      r.field,
+			repository: r.repository,
+			commit:     r.commit,
+		})
+	}
+}
+
+// packIndexMagic starts a version 2 pack index.
+var packIndexMagic = []byte{0xff, 't', 'O', 'c', 0, 0, 0, 2}
+
+// gitObjects looks up SHA-1 objects in a repository's object store: loose
+// objects and version 2 pack indexes.
+type gitObjects struct {
+	fsys workspaceFS
+	dir  string
+	// packs holds the sorted object names of each pack index.
+	packs [][]byte
+	// shallow is set for a shallow clone, which lacks older commits.
+	shallow bool
+}
+
+// openGitObjects opens the object store of the workspace's repository. It
+// returns false when there is none, or when objects may live where it
+// cannot look: alternates, a SHA-256 repository, an older or unreadable
+// pack index, or one over maxSize bytes.
+func openGitObjects(fsys workspaceFS, root string, maxSize int64) (*gitObjects, bool) {
+	config := gitConfigPath(fsys, root)
+	if config == "" {
+		return nil, false
+	}
+	gitDir := filepath.Dir(config)
+	if data, err := fsys.ReadFile(config); err != nil || bytes.Contains(bytes.ToLower(data), []byte("objectformat = sha256")) {
+		return nil, false
+	}
+	o := &gitObjects{fsys: fsys, dir: filepath.Join(gitDir, "objects")}
+	if info, err := fsys.Stat(o.dir); err != nil || !info.IsDir() {
+		return nil, false
+	}
+	if _, err := fsys.Stat(filepath.Join(o.dir, "info", "alternates")); err == nil {
+		return nil, false
+	}
+	_, err := fsys.Stat(filepath.Join(gitDir, "shallow"))
+	o.shallow = err == nil
+
+	entries, _ := fsys.ReadDir(filepath.Join(o.dir, "pack"))
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".idx" {
+			continue
+		}
+		p := filepath.Join(o.dir, "pack", e.Name())
+		info, err := fsys.Stat(p)
+		if err != nil || info.Size() > maxSize {
+			return nil, false
+		}
+		data, err := fsys.ReadFile(p)
+		if err != nil {
+			return nil, false
+		}
+		names, ok := packIndexNames(data)
+		if !ok {
+			return nil, false
+		}
+		o.packs = append(o.packs, names)
+	}
+	return o, true
+}
+
+// packIndexNames returns the sorted 20-byte object names of a version 2
+// pack index.
+func packIndexNames(data []byte) ([]byte, bool) {
+	const fanoutEnd = 8 + 256*4
+	if len(data) < fanoutEnd || !bytes.Equal(data[:8], packIndexMagic) {
+		return nil, false
+	}
+	n := int(binary.BigEndian.Uint32(data[fanoutEnd-4 : fanoutEnd]))
+	if n < 0 || len(data) < fanoutEnd+n*20 {
+		return nil, false
+	}
+	return data[fanoutEnd : fanoutEnd+n*20], true
+}
+
+// has reports whether the store holds the object with the given hex name.
+func (o *gitObjects) has(commit string) bool {
+	if _, err := o.fsys.Stat(filepath.Join(o.dir, commit[:2], commit[2:])); err == nil {
+		return true
+	}
+	name, err := hex.DecodeString(commit)
+	if err != nil || len(name) != 20 {
+		return false
+	}
+	for _, names := range o.packs {
+		n := len(names) / 20
+		i := sort.Search(n, func(i int) bool { return bytes.Compare(names[i*20:i*20+20], name) >= 0 })
+		if i < n && bytes.Equal(names[i*20:i*20+20], name) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySourceRevisions looks up the commits statements pin for the
+// workspace's own repository in its git object store, and notes those it
+// lacks. A missing commit may only be outside a shallow clone or not yet
+// fetched, so the notes carry Low confidence.
+func verifySourceRevisions(findings *findingSet, summary *scanSummary, maxFileSize int64) {
+	remote := workspaceRemote(findings.files(), findings.root)
+	if remote.repository == "" {
+		return
+	}
+	var objects *gitObjects
+	for _, r := range summary.sourceRevisions {
+		if r.repository != remote.repository || len(r.commit) != 40 {
+			continue
+		}
+		if objects == nil {
+			o, ok := openGitObjects(findings.files(), findings.root, maxFileSize)
+			if !ok {
+				return
+			}
+			objects = o
+		}
+		if objects.has(r.commit) {
+			continue
+		}
+		findings.Finding(ephemeralSourceRuleID, sdk.SeverityLow, sdk.ConfidenceLow,
+			fmt.Sprintf("Provenance names commit %s of the workspace repository, which the local git object store does not hold", r.commit)).
+			At(r.location, r.line, r.line).
+			WithMetadata("type", "unresolvable_source_revision").
+			WithMetadata("statement_index", strconv.Itoa(r.index)).
+			WithMetadata("commit", r.commit).
+			WithMetadata("repository", r.repository).
+			WithMetadata("reference_field", r.field).
+			WithMetadata("shallow_clone", strconv.FormatBool(objects.shallow)).
+			Done()
+	}
+}
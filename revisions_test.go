@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+func TestClassifyRevision(t *testing.T) {
+	for rev, want := range map[string]string{
+		"": revisionNone,
+		"0123456789abcdef0123456789abcdef01234567": revisionCommit,
+		"abc1234":                    revisionCommit,
+		"refs/tags/v1.2.0":           revisionTag,
+		"v1.2.0":                     revisionTag,
+		"refs/pull/123/merge":        revisionPullRequestMerge,
+		"refs/pull/123/head":         revisionPullRequestHead,
+		"refs/merge-requests/9/head": revisionMergeRequest,
+		"refs/changes/34/1234/2":     revisionGerritChange,
+		"refs/heads/main":            revisionBranch,
+		"main":                       revisionBranch,
+		"HEAD":                       revisionBranch,
+		"refs/notes/commits":         revisionRef,
+	} {
+		if got := classifyRevision(rev); got != want {
+			t.Errorf("classifyRevision(%q) = %q, want %q", rev, got, want)
+		}
+	}
+}
+
+func TestSplitGitURI(t *testing.T) {
+	tests := []struct {
+		uri, repo, rev string
+	}{
+		{"git+https://github.com/Org/App@refs/heads/main", "github.com/org/app", "refs/heads/main"},
+		{"git+https://github.com/org/app.git", "github.com/org/app", ""},
+		{"git+https://user@example.com/org/app@v1.0.0#egg=app", "example.com/org/app", "v1.0.0"},
+		{"git+ssh://git@example.com/org/app.git@abc1234", "example.com/org/app", "abc1234"},
+		{"git@github.com:org/app.git@refs/tags/v2", "github.com/org/app", "refs/tags/v2"},
+	}
+	for _, tt := range tests {
+		repo, rev := splitGitURI(tt.uri)
+		if repo != tt.repo || rev != tt.rev {
+			t.Errorf("splitGitURI(%q) = %q, %q, want %q, %q", tt.uri, repo, rev, tt.repo, tt.rev)
+		}
+	}
+}
+
+// slsaV1Statement wraps a SLSA v1 predicate in a statement.
+func slsaV1Statement(predicate string) string {
+	return `{"_type":"https://in-toto.io/Statement/v1","predicateType":"https://slsa.dev/provenance/v1","subject":[{"name":"app","digest":{"sha256":"abc"}}],"predicate":` + predicate + `}`
+}
+
+func TestScanEphemeralSourceRevisions(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "pr.intoto.jsonl"), slsaV1Statement(
+		`{"buildDefinition":{"externalParameters":{"workflow":{"ref":"refs/pull/7/merge","repository":"https://github.com/org/app","path":".github/workflows/build.yml"}}}}`)+"\n")
+	writeFile(t, filepath.Join(workspace, "pinned.intoto.jsonl"), slsaV1Statement(
+		`{"buildDefinition":{"externalParameters":{"workflow":{"ref":"refs/heads/main","repository":"https://github.com/org/app","path":".github/workflows/build.yml"}},`+
+			`"resolvedDependencies":[{"uri":"git+https://github.com/org/app@refs/heads/main","digest":{"gitCommit":"0123456789abcdef0123456789abcdef01234567"}}]}}`)+"\n")
+	writeFile(t, filepath.Join(workspace, "materials.intoto.jsonl"),
+		`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","subject":[{"name":"app","digest":{"sha256":"abc"}}],"predicate":{"materials":[`+
+			`{"uri":"git+https://review.example.com/app@refs/changes/34/1234/2"},`+
+			`{"uri":"git+https://github.com/org/lib"},`+
+			`{"uri":"git+https://github.com/org/lib"},`+
+			`{"uri":"git+https://github.com/org/tool@refs/tags/v1.0.0"},`+
+			`{"uri":"pkg:golang/example.com/mod@v1.0.0"}]}}`+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	got := make(map[string]string)
+	for _, f := range findByRule(resp.GetFindings(), ephemeralSourceRuleID) {
+		meta := f.GetMetadata()
+		if f.GetSeverity() != sdk.SeverityMedium || meta["type"] != "ephemeral_source_revision" {
+			t.Errorf("unexpected finding %s %v", f.GetSeverity(), meta)
+		}
+		got[f.GetLocation().GetFilePath()+" "+meta["reference"]] = meta["revision_kind"] + " " + meta["reference_field"]
+	}
+	want := map[string]string{
+		"pr.intoto.jsonl refs/pull/7/merge":                                                "pull_request_merge buildDefinition.externalParameters.workflow.ref",
+		"materials.intoto.jsonl git+https://review.example.com/app@refs/changes/34/1234/2": "gerrit_change materials[0].uri",
+		"materials.intoto.jsonl git+https://github.com/org/lib":                            "unpinned materials[1].uri",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d %s findings, want %d: %v", len(got), ephemeralSourceRuleID, len(want), got)
+	}
+	for key, w := range want {
+		if got[key] != w {
+			t.Errorf("%s: got %q, want %q", key, got[key], w)
+		}
+	}
+}
+
+// writePackIndex writes a version 2 pack index naming the given objects.
+func writePackIndex(t *testing.T, path string, objects ...string) {
+	t.Helper()
+	sort.Strings(objects)
+	var fanout [256]uint32
+	var names bytes.Buffer
+	for _, o := range objects {
+		name, err := hex.DecodeString(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names.Write(name)
+		for i := int(name[0]); i < 256; i++ {
+			fanout[i]++
+		}
+	}
+	var buf bytes.Buffer
+	buf.Write(packIndexMagic)
+	_ = binary.Write(&buf, binary.BigEndian, fanout)
+	buf.Write(names.Bytes())
+	writeFile(t, path, buf.String())
+}
+
+func TestVerifySourceRevisions(t *testing.T) {
+	const (
+		loose   = "1111111111111111111111111111111111111111"
+		packed  = "2222222222222222222222222222222222222222"
+		missing = "3333333333333333333333333333333333333333"
+	)
+	workspace := t.TempDir()
+	git := filepath.Join(workspace, ".git")
+	writeFile(t, filepath.Join(git, "config"), "[remote \"origin\"]\n\turl = git@github.com:org/app.git\n")
+	writeFile(t, filepath.Join(git, "objects", loose[:2], loose[2:]), "")
+	writePackIndex(t, filepath.Join(git, "objects", "pack", "pack-1.idx"), "00"+packed[2:], packed, "ff"+packed[2:])
+	material := func(repo, commit string) string {
+		return `{"uri":"git+https://github.com/` + repo + `@refs/heads/main","digest":{"sha1":"` + commit + `"}}`
+	}
+	writeFile(t, filepath.Join(workspace, "provenance.json"),
+		`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","subject":[{"name":"app","digest":{"sha256":"abc"}}],"predicate":{"materials":[`+
+			strings.Join([]string{material("org/app", loose), material("org/app", packed), material("org/app", missing), material("org/other", missing)}, ",")+`]}}`)
+	client := testClient(t)
+
+	resp := invokeScan(t, client, workspace)
+	found := findByRule(resp.GetFindings(), ephemeralSourceRuleID)
+	if len(found) != 1 {
+		t.Fatalf("expected one unresolvable revision, got %d", len(found))
+	}
+	meta := found[0].GetMetadata()
+	if found[0].GetSeverity() != sdk.SeverityLow || found[0].GetConfidence() != sdk.ConfidenceLow ||
+		meta["type"] != "unresolvable_source_revision" || meta["commit"] != missing ||
+		meta["reference_field"] != "materials[2].uri" || meta["shallow_clone"] != "false" {
+		t.Errorf("unexpected finding %s %s %v", found[0].GetSeverity(), found[0].GetConfidence(), meta)
+	}
+
+	// Objects borrowed from another store cannot be looked up.
+	writeFile(t, filepath.Join(git, "objects", "info", "alternates"), "/elsewhere/objects\n")
+	resp = invokeScan(t, client, workspace)
+	if found := findByRule(resp.GetFindings(), ephemeralSourceRuleID); len(found) != 0 {
+		t.Errorf("expected no findings with alternates, got %d", len(found))
+	}
+}
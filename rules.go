@@ -0,0 +1,726 @@
+package main
+
+import (
+	"context"
+	"path"
+	"strconv"
+	"strings"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// Rule categories. Every finding carries its rule's category in the
+// category metadata field.
+const (
+	categoryAttestation     = "attestation"
+	categoryReproducibility = "reproducibility"
+	categoryCI              = "ci"
+	categorySigning         = "signing"
+	categorySecrets         = "secrets"
+)
+
+// ruleInfo describes a rule the plugin can emit. Severities and confidences
+// list every value the rule is emitted with, the default first.
+type ruleInfo struct {
+	id          string
+	title       string
+	description string
+	severities  []pluginv1.Severity
+	confidences []pluginv1.Confidence
+	category    string
+	// tags are finer-grained facets added to every finding of the rule.
+	tags []string
+	// disableInput names the scan input that turns the rule off, or on for
+	// opt-in rules, empty if it always runs.
+	disableInput string
+}
+
+// ruleCatalog lists every rule the plugin can emit, in ID order.
+var ruleCatalog = []ruleInfo{
+	{
+		id:          summaryRuleID,
+		title:       "Scan summary",
+		description: "Informational summary of what a scan walked and analyzed, emitted once per workspace scan so a clean result can be told apart from a scan that covered nothing.",
+		severities:  []pluginv1.Severity{sdk.SeverityInfo},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+	},
+	{
+		id:          "PROV-001",
+		title:       "Missing attestation",
+		description: "The workspace has build configuration but no SLSA attestation or provenance file. Severity is Critical when build or CI configs publish artifacts to external registries, unless CI generates provenance at build time, Medium when they publish nothing, and Low when nothing in the workspace shows artifact production, as for a library. Confidence is Low when downstream verification or a provenance-generating CI step suggests attestations are published elsewhere.",
+		severities:  []pluginv1.Severity{sdk.SeverityHigh, sdk.SeverityCritical, sdk.SeverityMedium, sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium, sdk.ConfidenceLow},
+		category:    categoryAttestation,
+		tags:        []string{"slsa", "in-toto"},
+	},
+	{
+		id:          "PROV-002",
+		title:       "Incomplete provenance metadata",
+		description: "A statement is missing subjects, a builder ID, materials, or its predicate, or a subject is missing a name or digest.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+		tags:        []string{"slsa", "in-toto"},
+	},
+	{
+		id:          "PROV-003",
+		title:       "Build reproducibility risk",
+		description: "A build or CI config uses a non-deterministic pattern such as piped remote scripts, unpinned installs, latest tags, embedded dates and random values, or git output such as describe --dirty or branch names that differs between builds of one commit. Confidence is High in commands that run and Low in comments, echoed strings, and heredocs.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium, sdk.ConfidenceHigh, sdk.ConfidenceLow},
+		category:    categoryReproducibility,
+		tags:        []string{"build"},
+	},
+	{
+		id:          diffRuleID,
+		title:       "Provenance changed",
+		description: "Reported by the diff tool when two versions of provenance differ in builder, source, entry point, build type, materials, or subjects, and as Info when oversized files in a compared directory were skipped.",
+		severities:  []pluginv1.Severity{sdk.SeverityHigh, sdk.SeverityMedium, sdk.SeverityLow, sdk.SeverityInfo},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+		tags:        []string{"slsa", "diff"},
+	},
+	{
+		id:           "PROV-005",
+		title:        "Dangling provenance symlink",
+		description:  "A symlink named like a provenance file points at nothing, so the attestation it stood for is missing. Only reported when symlinks are followed.",
+		severities:   []pluginv1.Severity{sdk.SeverityLow},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:     categoryAttestation,
+		tags:         []string{"symlink"},
+		disableInput: "follow_symlinks",
+	},
+	{
+		id:           "PROV-006",
+		title:        "Gitignored provenance",
+		description:  "A provenance file is excluded by .gitignore, so it exists locally but will never reach collaborators or CI.",
+		severities:   []pluginv1.Severity{sdk.SeverityMedium},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:     categoryAttestation,
+		tags:         []string{"gitignore"},
+		disableInput: "respect_gitignore",
+	},
+	{
+		id:          "PROV-007",
+		title:       "Oversized provenance",
+		description: "A provenance file exceeds max_file_size and was not validated; it does not count as provenance.",
+		severities:  []pluginv1.Severity{sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+		tags:        []string{"limits"},
+	},
+	{
+		id:          "PROV-008",
+		title:       "Unreadable provenance",
+		description: "A provenance file exists but could not be read; it does not count as provenance.",
+		severities:  []pluginv1.Severity{sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+	},
+	{
+		id:           "PROV-009",
+		title:        "SLSA level below requirement",
+		description:  "The estimated SLSA build level of a statement is below required_slsa_level.",
+		severities:   []pluginv1.Severity{sdk.SeverityHigh},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:     categoryAttestation,
+		tags:         []string{"slsa"},
+		disableInput: "required_slsa_level",
+	},
+	{
+		id:           unattestedImageRuleID,
+		title:        "Unattested container image",
+		description:  "A digest-pinned container image is not covered by any attestation subject in the workspace. Dockerfile base images are Low.",
+		severities:   []pluginv1.Severity{sdk.SeverityMedium, sdk.SeverityLow},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:     categoryAttestation,
+		tags:         []string{"docker"},
+		disableInput: "check_images",
+	},
+	{
+		id:           tagOnlyImageRuleID,
+		title:        "Tag-only container image",
+		description:  "A container image is referenced by tag only, so it cannot be matched to an attestation by digest. Confidence is Medium when an update bot maintains docker digest pins.",
+		severities:   []pluginv1.Severity{sdk.SeverityLow},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceHigh, sdk.ConfidenceMedium},
+		category:     categoryReproducibility,
+		tags:         []string{"docker", "pinning"},
+		disableInput: "check_images",
+	},
+	{
+		id:           missingSBOMRuleID,
+		title:        "Missing SBOM",
+		description:  "The workspace has build configuration but no SBOM document, SBOM attestation, or SBOM-generating build step.",
+		severities:   []pluginv1.Severity{sdk.SeverityLow},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:     categoryAttestation,
+		tags:         []string{"sbom"},
+		disableInput: "check_sbom",
+	},
+	{
+		id:           lowLockfileOverlapRuleID,
+		title:        "Low lockfile overlap",
+		description:  "Fewer than min_lockfile_overlap percent of a statement's dependency materials match a workspace lockfile entry.",
+		severities:   []pluginv1.Severity{sdk.SeverityLow},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:     categoryReproducibility,
+		tags:         []string{"lockfile", "dependencies"},
+		disableInput: "min_lockfile_overlap",
+	},
+	{
+		id:          lockfileDigestMismatchRuleID,
+		title:       "Lockfile digest mismatch",
+		description: "A provenance material claims a digest that contradicts the lockfile entry for the same dependency version.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:    categoryAttestation,
+		tags:        []string{"lockfile", "dependencies"},
+	},
+	{
+		id:          unmatchedPolicyRuleID,
+		title:       "Unmatched admission policy authority",
+		description: "An image admission policy trusts a key or keyless identity that no CI signing step produces.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceLow},
+		category:    categorySigning,
+		tags:        []string{"sigstore", "kubernetes", "policy"},
+	},
+	{
+		id:          subjectDigestMismatchRuleID,
+		title:       "Subject digest mismatch",
+		description: "An attestation subject's sha256 digest does not match the artifact it names: the artifact the attestation file is named for, or one found around a scanned archive.",
+		severities:  []pluginv1.Severity{sdk.SeverityHigh},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+		tags:        []string{"archive", "digest"},
+	},
+	{
+		id:           unattestedArchiveImageRuleID,
+		title:        "Unattested image in archive",
+		description:  "An image in a docker save tarball or OCI image layout carries no attestation manifest. Only checked when archives are scanned.",
+		severities:   []pluginv1.Severity{sdk.SeverityMedium},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:     categoryAttestation,
+		tags:         []string{"archive", "docker", "oci"},
+		disableInput: "scan_archives",
+	},
+	{
+		id:           staleProvenanceRuleID,
+		title:        "Stale provenance",
+		description:  "A provenance file predates an artifact it attests (Medium) or the newest build config (Low) by more than staleness_days. Confidence is Low when dated by modification time.",
+		severities:   []pluginv1.Severity{sdk.SeverityMedium, sdk.SeverityLow},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceMedium, sdk.ConfidenceLow},
+		category:     categoryAttestation,
+		tags:         []string{"slsa", "staleness"},
+		disableInput: "staleness_days",
+	},
+	{
+		id:          conflictingAttestationsRuleID,
+		title:       "Conflicting attestations",
+		description: "Attestations of the same subject digest disagree on builder ID or source repository (High) or material digests (Medium).",
+		severities:  []pluginv1.Severity{sdk.SeverityHigh, sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+		tags:        []string{"slsa", "in-toto"},
+	},
+	{
+		id:           missingCIRuleID,
+		title:        "Missing CI configuration",
+		description:  "The workspace has build configuration but no CI configuration, so artifacts are presumably built and published from developer machines.",
+		severities:   []pluginv1.Severity{sdk.SeverityMedium},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:     categoryCI,
+		tags:         []string{"build"},
+		disableInput: "check_ci",
+	},
+	{
+		id:           confirmedProvenanceRuleID,
+		title:        "Provenance confirmed",
+		description:  "Informational evidence that a provenance file parsed completely and passed every check, with its builders, predicate versions, signature status, and subject count. Only emitted when emit_confirmations is set, and never counted by fail_on_severity.",
+		severities:   []pluginv1.Severity{sdk.SeverityInfo},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:     categoryAttestation,
+		tags:         []string{"slsa", "in-toto", "evidence"},
+		disableInput: "emit_confirmations",
+	},
+	{
+		id:          explainRuleID,
+		title:       "Provenance explanation",
+		description: "Reported by the explain tool for each statement of a provenance file: its envelope, predicate type and version, every completeness check with the JSON pointer it inspected, signature status, and a predicate excerpt. Never counted by fail_on_severity.",
+		severities:  []pluginv1.Severity{sdk.SeverityInfo},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+		tags:        []string{"slsa", "in-toto", "evidence"},
+	},
+	{
+		id:           missingScriptRuleID,
+		title:        "Missing build script",
+		description:  "A build or CI command invokes a script that does not exist in the workspace, so the step will fail when it runs.",
+		severities:   []pluginv1.Severity{sdk.SeverityLow},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:     categoryCI,
+		tags:         []string{"build"},
+		disableInput: "follow_scripts",
+	},
+	{
+		id:          secretRuleID,
+		title:       "Credential file referenced",
+		description: "A provenance material or invocation parameter names a private key or credential file, a Dockerfile copies one into an image, or a CI step writes one to disk and leaves it for later steps, or a PEM private key is committed. Only the path is reported, never contents; secret_allowlist exempts known false positives.",
+		severities:  []pluginv1.Severity{sdk.SeverityHigh},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh, sdk.ConfidenceMedium},
+		category:    categorySecrets,
+		tags:        []string{"secrets", "credentials"},
+	},
+	{
+		id:          deprecatedPredicateRuleID,
+		title:       "Deprecated predicate version",
+		description: "A statement uses the SLSA v0.1 provenance predicate, whose recipe model was replaced by buildType and invocation in v0.2 and by buildDefinition in v1. Its fields are still checked, mapped onto the newer layout.",
+		severities:  []pluginv1.Severity{sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+		tags:        []string{"slsa", "in-toto"},
+	},
+	{
+		id:          pypiAttestationRuleID,
+		title:       "PyPI attestation mismatch",
+		description: "A PEP 740 publish attestation carries no Trusted Publisher identity, was published from a repository other than the workspace's git origin, or names a subject missing from or differing from the distribution files in dist/.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium, sdk.SeverityHigh},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+		tags:        []string{"pypi", "pep740", "sigstore"},
+	},
+	{
+		id:          unpinnedActionRuleID,
+		title:       "Unpinned action reference",
+		description: "A workflow or composite action step uses a GitHub action by tag or branch, or a docker:// image without a sha256 digest. The ref can be moved to different code after review; pin it to a full commit SHA.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryCI,
+		tags:        []string{"github-actions", "pinning"},
+	},
+	{
+		id:          deprecatedRuntimeRuleID,
+		title:       "Deprecated action runtime",
+		description: "An action definition runs on node12 or node16, which GitHub no longer supports for JavaScript actions.",
+		severities:  []pluginv1.Severity{sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryCI,
+		tags:        []string{"github-actions"},
+	},
+	{
+		id:          matrixAttestationRuleID,
+		title:       "Matrix artifacts without attestation",
+		description: "A release workflow's matrix job uploads or publishes an artifact per leg, but no attestation runs in the matrix job or in a dependent job that downloads every leg's artifacts, so the provenance covers at most one of them.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:    categoryCI,
+		tags:        []string{"github-actions", "slsa"},
+	},
+	{
+		id:          cachePoisoningRuleID,
+		title:       "Cache poisoning exposure",
+		description: "A release job restores an actions/cache entry whose key is also saved by a workflow that runs on pull requests, executes programs from a restored path, or can request an OIDC token while saving with save-always or an unscoped key. Attacker-influenced cache content then flows into what the provenance attests.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium, sdk.SeverityHigh},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:    categoryCI,
+		tags:        []string{"github-actions", "cache"},
+	},
+	{
+		id:          disallowedActionRuleID,
+		title:       "Disallowed action",
+		description: "A workflow or composite action uses an action matching the action_denylist, or a job that mints provenance uses an action missing from the action_allowlist.",
+		severities:  []pluginv1.Severity{sdk.SeverityHigh},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryCI,
+		tags:        []string{"github-actions", "policy"},
+	},
+	{
+		id:          attestationThresholdRuleID,
+		title:       "Insufficient independent attestations",
+		description: "A subject digest is attested by fewer distinct builders than min_attestations_per_subject requires. Statements from the same builder count once, and unsigned statements do not count.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+		tags:        []string{"slsa", "policy"},
+	},
+	{
+		id:          policyDenialRuleID,
+		title:       "Policy denial",
+		description: "A Rego policy from policy_files denied a statement, or could not be evaluated against it within the time limit.",
+		severities:  []pluginv1.Severity{sdk.SeverityHigh},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+		tags:        []string{"policy", "rego"},
+	},
+	{
+		id:          sourceRefRuleID,
+		title:       "Disallowed source ref",
+		description: "SLSA provenance was built from a git ref that allowed_source_refs does not permit (Medium), or records no ref to check (Low).",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium, sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+		tags:        []string{"slsa", "policy"},
+	},
+	{
+		id:          weakKeyRuleID,
+		title:       "Weak signing key",
+		description: "A committed public key or certificate, or the signing certificate of a Sigstore bundle or PEP 740 attestation, holds an RSA key under 2048 bits, a DSA key, an ECDSA key on a legacy or non-NIST curve, or a malformed Ed25519 key.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categorySigning,
+		tags:        []string{"signing", "keys"},
+	},
+	{
+		id:          checksumRuleID,
+		title:       "Release without checksums",
+		description: "A release mechanism publishes artifacts without checksums: goreleaser with checksum.disable, a GitHub release upload without a checksums file (Medium), or an npm or PyPI publish without a checksum manifest (Low). Not reported when the workspace generates attestations.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium, sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:    categoryCI,
+		tags:        []string{"checksums", "release"},
+	},
+	{
+		id:          workflowIdentityRuleID,
+		title:       "Workflow identity mismatch",
+		description: "GitHub Actions provenance was built by a workflow in another repository than the workspace's git remote (High), in a fork of it (Medium), or names a workflow file that does not exist in the workspace (Medium).",
+		severities:  []pluginv1.Severity{sdk.SeverityHigh, sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh, sdk.ConfidenceMedium},
+		category:    categoryAttestation,
+		tags:        []string{"slsa", "identity"},
+	},
+	{
+		id:          indexSubjectRuleID,
+		title:       "Subject covers an image index only",
+		description: "A provenance subject is a multi-platform image index, found in an image archive or suggested by a multi-platform CI build, and no attestation covers its per-platform manifests.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceLow},
+		category:    categoryAttestation,
+		tags:        []string{"oci", "multi-arch"},
+	},
+	{
+		id:          unpinnedEnvImageRuleID,
+		title:       "Unpinned build environment image",
+		description: "A dev container, CI job container, or CI service container image is referenced by tag (Medium) or by latest or no tag (High) rather than by digest, so the toolchain that produces artifacts can change without review.",
+		severities:  []pluginv1.Severity{sdk.SeverityHigh, sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryCI,
+		tags:        []string{"pinning", "container"},
+	},
+	{
+		id:          attestationPairRuleID,
+		title:       "Attestation and artifact do not pair",
+		description: "An attestation's file name, such as app.tar.gz.intoto.jsonl, implies an artifact that does not exist or that none of its subjects names, or an artifact lacks the attestation its siblings' naming convention implies.",
+		severities:  []pluginv1.Severity{sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium, sdk.ConfidenceLow},
+		category:    categoryAttestation,
+		tags:        []string{"release", "naming"},
+	},
+	{
+		id:           emptySBOMRuleID,
+		title:        "Empty SBOM",
+		description:  "A JSON CycloneDX document has no components or an SPDX document has no packages, as when the SBOM is generated before anything is built or installed.",
+		severities:   []pluginv1.Severity{sdk.SeverityLow},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:     categoryAttestation,
+		tags:         []string{"sbom"},
+		disableInput: "check_sbom",
+	},
+	{
+		id:           sourceSubjectsRuleID,
+		title:        "Source files as subjects",
+		description:  "Every subject of a statement is a source file present in the workspace, such as main.go or src/app.py, and none looks like a build output, so the attestation is a checksum list that says nothing about a build.",
+		severities:   []pluginv1.Severity{sdk.SeverityMedium},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:     categoryAttestation,
+		tags:         []string{"slsa", "in-toto"},
+		disableInput: "check_source_subjects",
+	},
+	{
+		id:           gitlabProvenanceRuleID,
+		title:        "GitLab release without provenance",
+		description:  "A GitLab CI job publishes artifacts through the release keyword, release-cli, a registry push, or a package registry upload, but nothing in the pipeline generates provenance: no RUNNER_GENERATE_ARTIFACTS_METADATA, CycloneDX report, cosign signing, or SLSA template.",
+		severities:   []pluginv1.Severity{sdk.SeverityMedium},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:     categoryCI,
+		tags:         []string{"gitlab-ci", "slsa"},
+		disableInput: "check_gitlab_provenance",
+	},
+	{
+		id:          untrustedRefRuleID,
+		title:       "Release built from untrusted ref",
+		description: "A job that publishes or attests artifacts checks out a ref taken from workflow_dispatch inputs, a pull request, or a dispatch payload, or the pull request merge ref, rather than the tag or commit that triggered it, so its provenance does not pin what was released.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:    categoryCI,
+		tags:        []string{"github-actions", "slsa"},
+	},
+	{
+		id:          checksumChainRuleID,
+		title:       "Checksum chain gap",
+		description: "An attestation's subject is a checksums file, such as goreleaser's checksums.txt, but an artifact it lists does not match its entry (High), or a release artifact beside it is not listed, so the attestation does not reach it (Low).",
+		severities:  []pluginv1.Severity{sdk.SeverityHigh, sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh, sdk.ConfidenceMedium},
+		category:    categoryAttestation,
+		tags:        []string{"slsa", "checksums"},
+	},
+	{
+		id:          digestConsistencyRuleID,
+		title:       "Inconsistent subject digests",
+		description: "A statement lists the same subject twice with different digests, or a subject digest's length does not fit its algorithm key (Medium), or a digest is not lowercase hex, such as a base64-encoded one (Low).",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium, sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+		tags:        []string{"slsa", "in-toto"},
+	},
+	{
+		id:          lateAttestationRuleID,
+		title:       "Attestation after publication",
+		description: "A GitHub Actions release job publishes artifacts before a later step of the same job attests or signs them (Medium), or before a job that needs it does (Low). Releases created as drafts and container pushes followed by image signing are not flagged.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium, sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:    categoryCI,
+		tags:        []string{"github-actions", "slsa"},
+	},
+	{
+		id:           shaPinningRatioRuleID,
+		title:        "Low SHA pinning ratio",
+		description:  "Fewer than min_sha_pinned percent of the actions and GitLab components the workspace's CI configs reference are pinned to a full commit SHA.",
+		severities:   []pluginv1.Severity{sdk.SeverityMedium},
+		confidences:  []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:     categoryCI,
+		tags:         []string{"github-actions", "gitlab-ci", "pinning"},
+		disableInput: "min_sha_pinned",
+	},
+	{
+		id:          envInjectionRuleID,
+		title:       "Untrusted expression in env",
+		description: "A workflow or composite action step expands, unquoted, an env: variable holding an attacker-controlled event field such as an issue title or pull request branch (Medium), or such a variable is defined for a job whose token can write (Low).",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium, sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:    categoryCI,
+		tags:        []string{"github-actions", "injection"},
+	},
+	{
+		id:          secretBuildArgRuleID,
+		title:       "Secret passed as build argument",
+		description: "An image build passes a secret as a build argument, through --build-arg or build-push-action build-args, recording it in the image history and BuildKit provenance (High), or a Dockerfile declares an ARG whose name suggests a secret (Low). Names such as VERSION or COMMIT_SHA, and qualified ones such as TOKEN_URL or PUBLIC_KEY, are not flagged.",
+		severities:  []pluginv1.Severity{sdk.SeverityHigh, sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh, sdk.ConfidenceMedium},
+		category:    categorySecrets,
+		tags:        []string{"secrets", "docker"},
+	},
+	{
+		id:          onbuildRuleID,
+		title:       "Non-deterministic ONBUILD trigger",
+		description: "A Dockerfile declares an ONBUILD trigger that pipes a remote script to a shell, installs unpinned packages, or otherwise runs a non-deterministic command, which every downstream image built FROM it runs at its own build time.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:    categoryReproducibility,
+		tags:        []string{"docker"},
+	},
+	{
+		id:          verifiedPathMismatchRuleID,
+		title:       "Verification does not cover the file used",
+		description: "A build script verifies the checksum or signature of a download, then extracts, executes, or installs another downloaded file, or the same path downloaded again after the check. Downloads, verified files, and used files are followed through the variables, command chains, and redirects of one CI job, Makefile target, or Dockerfile stage.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:    categoryReproducibility,
+		tags:        []string{"downloads", "checksums"},
+	},
+	{
+		id:          analyzerFailureRuleID,
+		title:       "Analyzer failed on a file",
+		description: "An analyzer returned an error or panicked while reading a file, or the file's analysis was abandoned at file_time_budget_ms. The scan continues with the rest of the workspace, but findings for the file may be missing.",
+		severities:  []pluginv1.Severity{sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh},
+		category:    categoryAttestation,
+		tags:        []string{"diagnostics"},
+	},
+	{
+		id:          postSignWriteRuleID,
+		title:       "Signed file modified after signing",
+		description: "A GitHub Actions job writes a provenance or checksum file, by redirect, in-place sed, perl, or yq edit, tee, or mv or cp onto it, after a step of the same job or of a job it needs signs or attests it, so the published signature or attestation no longer verifies. Jobs that sign again after the write are not flagged.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:    categoryCI,
+		tags:        []string{"github-actions", "signing", "checksums"},
+	},
+	{
+		id:          knownBadGeneratorRuleID,
+		title:       "Known-bad provenance generator",
+		description: "A workflow uses, or provenance records, a generator, release action, or signing tool version listed in the plugin's advisory table as archived or affected by a known issue. uses: references are placed by tag, by a commit the table maps, by a version comment after the commit (Medium confidence), or not at all for other commits (Low confidence); provenance by the builder ID version or, lacking one, the invocation ID shape (Low confidence).",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh, sdk.ConfidenceMedium, sdk.ConfidenceLow},
+		category:    categoryAttestation,
+		tags:        []string{"slsa", "advisory"},
+	},
+	{
+		id:          ephemeralSourceRuleID,
+		title:       "Ephemeral source revision",
+		description: "SLSA provenance names its source or a git material only by a reference that moves or disappears, such as a pull request merge ref, a Gerrit change, a branch head, or a git URL with no revision, and nothing in the statement pins the repository's commit (Medium). A pinned commit of the workspace repository that its git object store lacks is noted at Low severity and confidence.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium, sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh, sdk.ConfidenceLow},
+		category:    categoryAttestation,
+		tags:        []string{"slsa", "source"},
+	},
+	{
+		id:          wrapperIntegrityRuleID,
+		title:       "Build wrapper integrity",
+		description: "A Gradle or Maven wrapper fetches its distribution or jar over plain HTTP (High) or without a sha256 checksum property to verify it against (Medium), or a committed wrapper jar does not match the checksum its properties pin or the official jar of its version (High). A jar whose version is missing from the plugin's checksum table is noted as unverifiable at Low severity and confidence.",
+		severities:  []pluginv1.Severity{sdk.SeverityHigh, sdk.SeverityMedium, sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh, sdk.ConfidenceLow},
+		category:    categoryReproducibility,
+		tags:        []string{"wrapper", "checksums"},
+	},
+	{
+		id:          registryOverrideRuleID,
+		title:       "Dependency registry override",
+		description: "Dependency configuration (.npmrc, .yarnrc, pip.conf, requirements files, Maven settings.xml, or registry variables and flags in build commands) fetches packages over plain HTTP (High), adds an extra package index open to dependency confusion or a Maven mirror whose checksums are not enforced (Medium), or points at a registry that is neither public nor listed in trusted_registries (Low).",
+		severities:  []pluginv1.Severity{sdk.SeverityHigh, sdk.SeverityMedium, sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh, sdk.ConfidenceMedium},
+		category:    categoryReproducibility,
+		tags:        []string{"registry", "dependencies"},
+	},
+	{
+		id:          artifactHandoffRuleID,
+		title:       "Unverified artifact handoff",
+		description: "A GitHub Actions job attests or signs artifacts downloaded with download-artifact from a job it needs, without receiving the digest the building job produced through needs.<job>.outputs, or, receiving it, without checking the download against it before attesting. Jobs that attest the subject-digest passed in the building job's outputs are not flagged.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:    categoryCI,
+		tags:        []string{"github-actions", "attestation", "artifacts"},
+	},
+	{
+		id:          dormantWorkflowRuleID,
+		title:       "Dormant workflow can still mint provenance",
+		description: "A GitHub Actions workflow with a job that attests or signs artifacts runs only when dispatched by hand, or only on push and pull request events filtered to branches or paths the repository does not have. Branches are read from the git refs and packed-refs in the workspace; without them only manual-only workflows and path filters are judged. Such workflows are easily forgotten while still able to produce trusted provenance.",
+		severities:  []pluginv1.Severity{sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:    categoryCI,
+		tags:        []string{"github-actions", "attestation", "triggers"},
+	},
+	{
+		id:          vendoredBinaryRuleID,
+		title:       "Vendored binary without provenance",
+		description: "A committed file recognized as compiled code by its magic bytes (ELF, PE, Mach-O, Java class or jar, static library, or WebAssembly) is named by a build or CI config, or sits in a directory builds conventionally ship, such as lib/ or bin/. Such binaries are opaque inputs with no provenance. Directories with many of them are reported once. Build wrapper jars have their own check, and vendored_binary_allowlist exempts known-acceptable binaries.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh, sdk.ConfidenceMedium},
+		category:    categoryReproducibility,
+		tags:        []string{"build", "dependencies", "binaries"},
+	},
+	{
+		id:          longLivedKeyRuleID,
+		title:       "Release signing with a long-lived key",
+		description: "A GitHub Actions release workflow signs or attests with a self-managed long-lived key: cosign with --key (other than a KMS or Vault reference) or a COSIGN_KEY or COSIGN_PRIVATE_KEY variable set from secrets, gpg signing, or minisign. Keyless signing with the workflow's OIDC identity, with cosign without a key or an attestation action, ties signatures to the workflow run instead of a key that can leak. Workflows that sign both ways, as during a migration, are reported once with both styles. The scan summary records how each workflow signs.",
+		severities:  []pluginv1.Severity{sdk.SeverityLow},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceMedium},
+		category:    categorySigning,
+		tags:        []string{"github-actions", "signing", "sigstore"},
+	},
+	{
+		id:          buildpackRuleID,
+		title:       "Unpinned Cloud Native Buildpacks builder or buildpack",
+		description: "A Cloud Native Buildpacks build, declared in project.toml or run with pack build in a build or CI config, pulls its builder image without a digest or a buildpack by an image without a digest, a registry ID without a version, or a URL without a version, so the build platform itself can change between builds. Buildpacks taken from the builder follow its pin. Builders and buildpacks of well-known publishers (Paketo, Heroku, Google) are reported with Medium confidence, third-party ones with High.",
+		severities:  []pluginv1.Severity{sdk.SeverityMedium},
+		confidences: []pluginv1.Confidence{sdk.ConfidenceHigh, sdk.ConfidenceMedium},
+		category:    categoryReproducibility,
+		tags:        []string{"build", "buildpacks", "pinning"},
+	},
+}
+
+// lookupRule returns the catalog entry for a rule ID.
+func lookupRule(id string) (ruleInfo, bool) {
+	for _, r := range ruleCatalog {
+		if r.id == id {
+			return r, true
+		}
+	}
+	return ruleInfo{}, false
+}
+
+// classify adds the rule's category and tags to a finding's metadata. Tags
+// for the CI platform or container tooling of the finding's file, given as a
+// workspace-relative slash path, are added to the rule's own.
+func (f *finding) classify() {
+	rule, ok := lookupRule(f.ruleID)
+	if !ok {
+		return
+	}
+	tags := append([]string(nil), rule.tags...)
+	name := path.Base(f.path)
+	if isCIConfig(f.path) {
+		tags = append(tags, "ci")
+	}
+	switch {
+	case strings.HasPrefix(f.path, ".github/workflows/"):
+		tags = append(tags, "github-actions")
+	case name == ".gitlab-ci.yml":
+		tags = append(tags, "gitlab-ci")
+	}
+	if imageSourceOf(name) != "" {
+		tags = append(tags, "docker")
+	}
+	seen := make(map[string]bool, len(tags))
+	unique := tags[:0]
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			unique = append(unique, tag)
+		}
+	}
+	f.metadata = append(f.metadata, [2]string{"category", rule.category})
+	if len(unique) > 0 {
+		f.metadata = append(f.metadata, [2]string{"tags", strings.Join(unique, ",")})
+	}
+}
+
+// severityNames and confidenceNames render catalog values for metadata.
+var (
+	severityNames = map[pluginv1.Severity]string{
+		sdk.SeverityInfo:     "info",
+		sdk.SeverityLow:      "low",
+		sdk.SeverityMedium:   "medium",
+		sdk.SeverityHigh:     "high",
+		sdk.SeverityCritical: "critical",
+	}
+	confidenceNames = map[pluginv1.Confidence]string{
+		sdk.ConfidenceLow:    "low",
+		sdk.ConfidenceMedium: "medium",
+		sdk.ConfidenceHigh:   "high",
+	}
+)
+
+// handleRules returns the rule catalog as one informational finding per
+// rule, described in its metadata. It needs no workspace.
+func handleRules(_ context.Context, _ sdk.ToolRequest) (*pluginv1.InvokeToolResponse, error) {
+	resp := sdk.NewResponse()
+	// The defaults were validated at startup, so parsing cannot fail here.
+	defaults, _ := parseScanOptions(envDefaults.apply(nil))
+	for _, r := range ruleCatalog {
+		severities := make([]string, len(r.severities))
+		for i, s := range r.severities {
+			severities[i] = severityNames[s]
+		}
+		confidences := make([]string, len(r.confidences))
+		for i, c := range r.confidences {
+			confidences[i] = confidenceNames[c]
+		}
+		resp.Finding(r.id, sdk.SeverityInfo, sdk.ConfidenceHigh, r.title).
+			WithMetadata("type", "rule").
+			WithMetadata("title", r.title).
+			WithMetadata("description", r.description).
+			WithMetadata("default_severity", severities[0]).
+			WithMetadata("severities", strings.Join(severities, ",")).
+			WithMetadata("default_confidence", confidences[0]).
+			WithMetadata("confidences", strings.Join(confidences, ",")).
+			WithMetadata("category", r.category).
+			WithMetadata("tags", strings.Join(r.tags, ",")).
+			WithMetadata("disableable", strconv.FormatBool(r.disableInput != "")).
+			WithMetadata("disable_input", r.disableInput).
+			WithMetadata("disabled_by_default", strconv.FormatBool(defaults.disabledRules[r.id])).
+			Done()
+	}
+	return resp.Build(), nil
+}
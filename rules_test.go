@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRulesTool(t *testing.T) {
+	resp := invokeTool(t, testClient(t), "rules", map[string]any{})
+
+	found := resp.GetFindings()
+	if len(found) != len(ruleCatalog) {
+		t.Fatalf("expected %d rules, got %d", len(ruleCatalog), len(found))
+	}
+	categories := map[string]bool{categoryAttestation: true, categoryReproducibility: true, categoryCI: true, categorySigning: true, categorySecrets: true}
+	previous := ""
+	for _, f := range found {
+		meta := f.GetMetadata()
+		if f.GetRuleId() <= previous {
+			t.Errorf("rule %s is out of order after %s", f.GetRuleId(), previous)
+		}
+		previous = f.GetRuleId()
+		for _, key := range []string{"title", "description", "default_severity", "default_confidence"} {
+			if meta[key] == "" {
+				t.Errorf("rule %s has no %s", f.GetRuleId(), key)
+			}
+		}
+		if !categories[meta["category"]] {
+			t.Errorf("rule %s has unknown category %q", f.GetRuleId(), meta["category"])
+		}
+		if (meta["disableable"] == "true") != (meta["disable_input"] != "") {
+			t.Errorf("rule %s: disableable = %s but disable_input = %q", f.GetRuleId(), meta["disableable"], meta["disable_input"])
+		}
+	}
+
+	tagOnly, ok := lookupRule(tagOnlyImageRuleID)
+	if !ok || tagOnly.disableInput != "check_images" || severityNames[tagOnly.severities[0]] != "low" {
+		t.Errorf("unexpected catalog entry for %s: %+v", tagOnlyImageRuleID, tagOnly)
+	}
+}
+
+// TestRuleCatalogCoversFixtures scans every fixture workspace; the shared
+// tool helper checks each finding against the catalog, and the findings are
+// compared with the fixture's golden file, testdata/<fixture>.golden.json.
+// A new fixture directory is covered once its golden file is written with
+// -update.
+func TestRuleCatalogCoversFixtures(t *testing.T) {
+	entries, err := os.ReadDir(testdataDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := testClient(t)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		t.Run(e.Name(), func(t *testing.T) {
+			root := filepath.Join(testdataDir(t), e.Name())
+			resp := invokeScanWithInput(t, client, map[string]any{
+				"workspace_root":      root,
+				"required_slsa_level": 3,
+				"scan_archives":       true,
+			})
+			compareGolden(t, filepath.Join(testdataDir(t), e.Name()+".golden.json"), resp.GetFindings(), root)
+		})
+	}
+}
+
+func TestScanFindingTags(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"),
+		"jobs:\n  build:\n    steps:\n      - run: curl -sSL https://example.com/install.sh | sh\n")
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), "FROM golang:1.22\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	tags := make(map[string]string)
+	for _, f := range withoutSummary(resp.GetFindings()) {
+		tags[f.GetRuleId()+" "+f.GetLocation().GetFilePath()] = f.GetMetadata()["tags"]
+	}
+	for key, want := range map[string]string{
+		"PROV-003 .github/workflows/release.yml": "build,ci,github-actions",
+		tagOnlyImageRuleID + " Dockerfile":       "docker,pinning",
+		"PROV-001 .":                             "slsa,in-toto",
+	} {
+		if tags[key] != want {
+			t.Errorf("tags of %s = %q, want %q (all: %v)", key, tags[key], want, tags)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// missingSBOMRuleID flags a workspace that builds artifacts but neither
+// contains an SBOM nor generates one.
+const missingSBOMRuleID = "PROV-012"
+
+// emptySBOMRuleID flags an SBOM document that lists no components, as one
+// generated before anything was built or installed.
+const emptySBOMRuleID = "PROV-041"
+
+// sbomFilePatterns lists filename patterns of SPDX and CycloneDX documents.
+var sbomFilePatterns = []string{
+	"*.spdx",
+	"*.spdx.json",
+	"*.spdx.yaml",
+	"*.cdx.json",
+	"*.cdx.xml",
+	"bom.json",
+	"bom.xml",
+	"*.sbom.json",
+	"sbom.json",
+}
+
+var sbomNameMatcher = newGlobMatcher(sbomFilePatterns)
+
+// isSBOMFile checks whether a filename matches known SBOM naming conventions.
+func isSBOMFile(name string) bool {
+	return sbomNameMatcher.match(strings.ToLower(name))
+}
+
+// sbomPredicateTypes are predicate type prefixes of attestations that carry
+// an SBOM.
+var sbomPredicateTypes = []string{
+	"https://spdx.dev/Document",
+	"https://cyclonedx.org/bom",
+}
+
+// isSBOMStatement reports whether a parsed statement attests an SBOM.
+func isSBOMStatement(ps *parsedStatement) bool {
+	return hasAnyPrefix(ps.Statement.PredicateType, sbomPredicateTypes)
+}
+
+// sbomStepPatterns detects build and CI steps that generate an SBOM. As with
+// nonDeterministicPatterns, Keyword is a lowercase literal every match
+// contains.
+var sbomStepPatterns = []struct {
+	Keyword string
+	Pattern *regexp.Regexp
+}{
+	{"syft", regexp.MustCompile(`(?i)\bsyft\b`)},
+	{"sbom-action", regexp.MustCompile(`(?i)\banchore/sbom-action\b`)},
+	{"cyclonedx", regexp.MustCompile(`(?i)\bcyclonedx`)},
+	{"--sbom", regexp.MustCompile(`(?i)--sbom\b`)},
+	{"sbom", regexp.MustCompile(`^\s*sboms?:`)},
+}
+
+// isSBOMStep reports whether a build or CI config line generates an SBOM.
+// ascii reports whether line is pure ASCII, enabling the keyword prescreen.
+func isSBOMStep(line string, ascii bool) bool {
+	for _, step := range sbomStepPatterns {
+		if ascii && !containsFoldASCII(line, step.Keyword) {
+			continue
+		}
+		if step.Pattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportMissingSBOM flags a workspace with build configuration but no SBOM
+// artifact, SBOM attestation, or SBOM-generating step.
+func reportMissingSBOM(findings *findingSet, root string) {
+	findings.Finding(
+		missingSBOMRuleID,
+		sdk.SeverityLow,
+		sdk.ConfidenceMedium,
+		"No SBOM artifact or SBOM generation step found in workspace with build configuration",
+	).
+		At(root, 0, 0).
+		WithMetadata("type", "missing_sbom").
+		Done()
+}
+
+// sbomAnalyzer checks JSON SPDX and CycloneDX documents for content. Other
+// SBOM files are only counted by the walk.
+type sbomAnalyzer struct{}
+
+func (sbomAnalyzer) kinds() fileKind { return kindSBOM }
+
+func (sbomAnalyzer) name() string { return "sbom" }
+
+func (sbomAnalyzer) matches(_, name string, _ *provenanceMatcher) fileKind {
+	if isSBOMFile(name) && strings.HasSuffix(strings.ToLower(name), ".json") {
+		return kindSBOM
+	}
+	return 0
+}
+
+func (sbomAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := r.findings.files().ReadFile(job.path)
+	if err != nil {
+		return nil
+	}
+	var doc struct {
+		BOMFormat   string            `json:"bomFormat"`
+		SpecVersion string            `json:"specVersion"`
+		SPDXVersion string            `json:"spdxVersion"`
+		Components  []json.RawMessage `json:"components"`
+		Packages    []json.RawMessage `json:"packages"`
+	}
+	if json.Unmarshal(data, &doc) != nil {
+		return nil
+	}
+	var format, version string
+	switch {
+	case strings.EqualFold(doc.BOMFormat, "CycloneDX") && len(doc.Components) == 0:
+		format, version = "cyclonedx", doc.SpecVersion
+	case doc.SPDXVersion != "" && len(doc.Packages) == 0:
+		format, version = "spdx", doc.SPDXVersion
+	default:
+		return nil
+	}
+	r.findings.Finding(
+		emptySBOMRuleID,
+		sdk.SeverityLow,
+		sdk.ConfidenceMedium,
+		"SBOM document lists no components",
+	).
+		At(job.path, 0, 0).
+		WithMetadata("type", "empty_sbom").
+		WithMetadata("format", format).
+		WithMetadata("spec_version", version).
+		Done()
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIsSBOMStep(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"\t- run: syft packages dir:. -o spdx-json > sbom.spdx.json", true},
+		{"      - uses: anchore/sbom-action@v0", true},
+		{"    id 'org.cyclonedx.bom' version '1.8.2'", true},
+		{"<artifactId>cyclonedx-maven-plugin</artifactId>", true},
+		{"\tdocker buildx build --sbom=true -t app .", true},
+		{"sboms:", true},
+		{"  - artifacts: archive", false},
+		{"\tgo build ./...", false},
+		{"# generate sbom later", false},
+	}
+	for _, tt := range tests {
+		if got := isSBOMStep(tt.line, isASCII(tt.line)); got != tt.want {
+			t.Errorf("isSBOMStep(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestScanMissingSBOM(t *testing.T) {
+	const spdxStatement = `{"_type":"https://in-toto.io/Statement/v1","predicateType":"https://spdx.dev/Document/v2.3",` +
+		`"subject":[{"name":"app","digest":{"sha256":"abc123def4567890abc123def4567890abc123def4567890abc123def4567890"}}],"predicate":{}}`
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		disabled bool
+		want     int
+	}{
+		{"build config without SBOM", map[string]string{"Makefile": "build:\n\tgo build ./...\n"}, false, 1},
+		{"no build config", map[string]string{"main.go": "package main\n"}, false, 0},
+		{"SBOM artifact", map[string]string{"Makefile": "build:\n", "dist/app.cdx.json": "{}"}, false, 0},
+		{"SBOM attestation", map[string]string{"Makefile": "build:\n", "release/sbom.intoto.jsonl": spdxStatement + "\n"}, false, 0},
+		{"generating step", map[string]string{".goreleaser.yaml": "builds:\n  - main: .\nsboms:\n  - artifacts: archive\n"}, false, 0},
+		{"disabled", map[string]string{"Makefile": "build:\n"}, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			for name, content := range tt.files {
+				writeFile(t, filepath.Join(workspace, name), content)
+			}
+
+			resp := invokeScanWithInput(t, testClient(t), map[string]any{
+				"workspace_root": workspace,
+				"check_sbom":     !tt.disabled,
+			})
+
+			if got := len(findByRule(resp.GetFindings(), missingSBOMRuleID)); got != tt.want {
+				t.Errorf("expected %d %s findings, got %d", tt.want, missingSBOMRuleID, got)
+			}
+		})
+	}
+}
+
+func TestScanEmptySBOM(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "dist", "app.cdx.json"), `{"bomFormat":"CycloneDX","specVersion":"1.5","components":[]}`)
+	writeFile(t, filepath.Join(workspace, "dist", "app.spdx.json"), `{"spdxVersion":"SPDX-2.3","packages":[{"name":"app"}]}`)
+	writeFile(t, filepath.Join(workspace, "sbom.json"), `{"spdxVersion":"SPDX-2.3","name":"before-build"}`)
+	writeFile(t, filepath.Join(workspace, "bom.json"), `{"name":"not an SBOM"}`)
+	client := testClient(t)
+
+	found := findByRule(invokeScan(t, client, workspace).GetFindings(), emptySBOMRuleID)
+	want := map[string]string{"dist/app.cdx.json": "cyclonedx", "sbom.json": "spdx"}
+	if len(found) != len(want) {
+		t.Fatalf("expected %d %s findings, got %d", len(want), emptySBOMRuleID, len(found))
+	}
+	for _, f := range found {
+		if got := f.GetMetadata()["format"]; got != want[f.GetLocation().GetFilePath()] {
+			t.Errorf("%s: format = %q", f.GetLocation().GetFilePath(), got)
+		}
+	}
+
+	resp := invokeScanWithInput(t, client, map[string]any{"workspace_root": workspace, "check_sbom": false})
+	if found := findByRule(resp.GetFindings(), emptySBOMRuleID); len(found) != 0 {
+		t.Errorf("expected check_sbom=false to disable %s, got %d", emptySBOMRuleID, len(found))
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// missingScriptRuleID flags a build or CI step that invokes a script that
+// does not exist in the workspace.
+const missingScriptRuleID = "PROV-023"
+
+// maxFollowedScripts bounds how many referenced scripts one scan follows.
+const maxFollowedScripts = 200
+
+// scriptRef is a script invoked from a build or CI config or a followed
+// script.
+type scriptRef struct {
+	// from and line locate the invoking command; invokedBy names it as
+	// "path#section" for findings in the script.
+	from      string
+	line      int
+	invokedBy string
+	// script is the path as written and dir the directory it is resolved
+	// against: the working directory of the invoking command.
+	script string
+	dir    string
+	// explicit is set when the reference is certainly a script, because it
+	// is passed to a shell or has a script extension. Only explicit
+	// references that do not resolve are reported.
+	explicit bool
+	// fromScript is set for references made by a followed script.
+	fromScript bool
+	// format overrides the syntax the referenced file is read as, such as
+	// the Dockerfile of a Docker action whatever its name.
+	format configFormat
+	// include is set for files pulled in by a Makefile include directive,
+	// and depth counts the includes leading to them.
+	include bool
+	depth   int
+}
+
+var (
+	// commandSeparator splits a command line into simple commands.
+	commandSeparator = regexp.MustCompile(`&&|\|\||[;|&()]`)
+	// shellInterpreters run the script named by their first operand.
+	shellInterpreters = map[string]bool{"bash": true, "sh": true, "zsh": true, "ksh": true, "dash": true, "source": true, ".": true}
+	// commandWrappers run the command that follows them.
+	commandWrappers = map[string]bool{"sudo": true, "exec": true, "time": true, "env": true, "command": true, "nohup": true}
+	// makeVariable rewrites recursive make invocations as plain make.
+	makeVariable = strings.NewReplacer("$(MAKE)", "make", "${MAKE}", "make")
+	// envAssignment matches a VAR=value prefix of a simple command.
+	envAssignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+)
+
+// scriptReferences returns the scripts a shell command invokes: operands of
+// bash, sh, or source, paths run directly such as ./release.sh, and the
+// Makefile run by make (-C dir, -f file, or the working directory's). A cd
+// earlier on the line moves the directory later references resolve against.
+// Operands built from variables or globs cannot be resolved and are skipped.
+func scriptReferences(command string) []scriptRef {
+	var refs []scriptRef
+	cd := ""
+	command = makeVariable.Replace(command)
+	for _, simple := range commandSeparator.Split(command, -1) {
+		words := strings.Fields(simple)
+		for len(words) > 0 && (commandWrappers[path.Base(words[0])] || envAssignment.MatchString(words[0])) {
+			words = words[1:]
+		}
+		if len(words) == 0 {
+			continue
+		}
+		word := strings.Trim(words[0], `"'`)
+		name := word
+		if strings.HasPrefix(name, "/") {
+			// Absolute commands such as /bin/bash are known by base name.
+			name = path.Base(name)
+		}
+		switch {
+		case name == "cd":
+			if len(words) < 2 || !resolvable(words[1]) {
+				// The working directory is unknown from here on.
+				return refs
+			}
+			cd = path.Join(cd, strings.Trim(words[1], `"'`))
+		case shellInterpreters[name]:
+			for _, w := range words[1:] {
+				if !strings.HasPrefix(w, "-") {
+					// Sourced files such as virtualenv activate scripts are
+					// often created by the build, so only shell operands and
+					// names with a script extension must exist.
+					explicit := name != "source" && name != "." || isShellScriptName(strings.ToLower(w))
+					refs = appendScriptRef(refs, cd, w, explicit)
+					break
+				}
+			}
+		case name == "make" || name == "gmake":
+			makefile, explicit := makefileOf(words[1:])
+			refs = appendScriptRef(refs, cd, makefile, explicit)
+		case strings.Contains(word, "/"):
+			refs = appendScriptRef(refs, cd, word, isShellScriptName(strings.ToLower(word)))
+		}
+	}
+	return refs
+}
+
+// resolvable reports whether a path operand can be resolved statically: it
+// is relative and free of variables, globs, and home directory references.
+func resolvable(operand string) bool {
+	operand = strings.Trim(operand, `"'`)
+	return operand != "" && !strings.HasPrefix(operand, "/") && !filepath.IsAbs(operand) &&
+		!strings.ContainsAny(operand, "$%{}*?`~")
+}
+
+// appendScriptRef adds a reference, relative to the cd directory, unless it
+// cannot be resolved statically.
+func appendScriptRef(refs []scriptRef, cd, script string, explicit bool) []scriptRef {
+	if !resolvable(script) {
+		return refs
+	}
+	script = path.Join(cd, strings.Trim(script, `"'`))
+	return append(refs, scriptRef{script: script, explicit: explicit})
+}
+
+// makefileOf returns the Makefile a make invocation reads, from its -C and
+// -f arguments. Only a file named with -f must exist; without one, make
+// also accepts GNUmakefile and makefile.
+func makefileOf(args []string) (string, bool) {
+	dir, file, named := "", "Makefile", false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case (arg == "-C" || arg == "--directory") && i+1 < len(args):
+			i++
+			dir = args[i]
+		case (arg == "-f" || arg == "--file") && i+1 < len(args):
+			i++
+			file, named = args[i], true
+		case strings.HasPrefix(arg, "--directory="):
+			dir = strings.TrimPrefix(arg, "--directory=")
+		case strings.HasPrefix(arg, "--file="):
+			file, named = strings.TrimPrefix(arg, "--file="), true
+		case strings.HasPrefix(arg, "-C") && len(arg) > 2:
+			dir = arg[2:]
+		}
+	}
+	return path.Join(dir, file), named
+}
+
+// commandOrigin describes where the commands of a config or followed
+// script run.
+type commandOrigin struct {
+	// dir is the working directory the commands run in; empty when their
+	// script references are not followed.
+	dir string
+	// invokedBy names the step that invoked a followed script, empty for
+	// configs found by the walk.
+	invokedBy string
+	// format overrides the syntax picked from the file name when set.
+	format configFormat
+	// include is set when the config is a Makefile pulled in by an include
+	// directive of invokedBy, and depth counts the includes leading to it.
+	include bool
+	depth   int
+}
+
+// annotate records on a finding the step that invoked a followed script or
+// the Makefile that included it.
+func (o commandOrigin) annotate(fb *findingBuilder) *findingBuilder {
+	switch {
+	case o.invokedBy == "":
+	case o.include:
+		fb.WithMetadata("included_by", o.invokedBy)
+	default:
+		fb.WithMetadata("invoked_by", o.invokedBy)
+	}
+	return fb
+}
+
+// configOrigin returns the origin of the commands in a walked config: CI
+// steps run in the workspace root and other configs, such as Makefile
+// recipes, in their own directory. Dockerfile commands run inside the
+// image, so their references are not followed.
+func configOrigin(root, path string, isCI bool) commandOrigin {
+	switch {
+	case configFormatOf(filepath.Base(path)) == formatDockerfile:
+		return commandOrigin{}
+	case isCI:
+		return commandOrigin{dir: root}
+	default:
+		return commandOrigin{dir: filepath.Dir(path)}
+	}
+}
+
+// recordScriptRefs records the scripts invoked by a command line of a
+// config or followed script.
+func (s *scanSummary) recordScriptRefs(root, from string, lineNum int, section, command string, origin commandOrigin) {
+	invokedBy := workspacePath(root, from)
+	if section != "" {
+		invokedBy += "#" + section
+	}
+	for _, ref := range scriptReferences(command) {
+		ref.from, ref.line, ref.invokedBy, ref.dir = from, lineNum, invokedBy, origin.dir
+		ref.fromScript = origin.invokedBy != ""
+		s.scriptRefs = append(s.scriptRefs, ref)
+	}
+}
+
+// followScripts scans the scripts referenced from build and CI configs at
+// full confidence, and the scripts they reference in turn. Each script is
+// scanned once, so reference cycles terminate; configs the walk already
+// scanned are not scanned again. Explicit references to scripts that do not
+// exist are reported.
+func followScripts(ctx context.Context, findings *findingSet, summary *scanSummary, scanned map[string]bool, policy provenancePolicy, maxFileSize int64) error {
+	root := findings.root
+	queue := summary.scriptRefs
+	summary.scriptRefs = nil
+	visited := make(map[string]bool)
+	reported := make(map[string]bool)
+
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ref := queue[0]
+		queue = queue[1:]
+
+		script, ok := resolveScriptRef(findings.files(), root, ref)
+		if !ok {
+			continue
+		}
+		info, err := findings.files().Stat(script)
+		if err != nil || info.IsDir() {
+			key := ref.from + ":" + strconv.Itoa(ref.line) + ":" + ref.script
+			if ref.explicit && !reported[key] {
+				reported[key] = true
+				reportMissingScript(findings, ref, workspacePath(root, script))
+			}
+			continue
+		}
+		if scanned[script] || visited[script] || info.Size() > maxFileSize {
+			continue
+		}
+		if len(visited) >= maxFollowedScripts {
+			summary.scriptsCapped = true
+			break
+		}
+		visited[script] = true
+		summary.scriptsFollowed++
+		summary.bytesRead += info.Size()
+
+		// A script runs in the working directory of its caller, a Makefile
+		// in its own unless it is included.
+		origin := commandOrigin{dir: ref.dir, invokedBy: ref.invokedBy, format: ref.format, include: ref.include, depth: ref.depth}
+		switch {
+		case ref.format == formatDockerfile:
+			// Dockerfile commands run inside the image.
+			origin.dir = ""
+		case ref.include:
+		case configFormatOf(filepath.Base(script)) == formatMakefile:
+			origin.dir = filepath.Dir(script)
+		}
+		if err := scanBuildFileForReproducibility(ctx, findings, script, origin, policy, summary); err != nil {
+			return err
+		}
+		queue = append(queue, summary.scriptRefs...)
+		summary.scriptRefs = nil
+	}
+	return nil
+}
+
+// resolveScriptRef returns the path a reference names, relative to the
+// working directory of the invoking command or, for references made from a
+// script, to the script's own directory. The working directory is preferred
+// and also returned when neither exists. References outside the workspace
+// are not followed.
+func resolveScriptRef(fsys workspaceFS, root string, ref scriptRef) (string, bool) {
+	resolved := filepath.Join(ref.dir, filepath.FromSlash(ref.script))
+	if ref.fromScript {
+		alt := filepath.Join(filepath.Dir(ref.from), filepath.FromSlash(ref.script))
+		if _, err := fsys.Stat(resolved); err != nil && insideRoot(root, alt) {
+			if _, err := fsys.Stat(alt); err == nil {
+				return alt, true
+			}
+		}
+	}
+	return resolved, insideRoot(root, resolved)
+}
+
+// insideRoot reports whether p is root or lies below it.
+func insideRoot(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// reportMissingScript flags a command that invokes a script the workspace
+// does not contain, so the step will fail when CI runs it.
+func reportMissingScript(findings *findingSet, ref scriptRef, script string) {
+	findings.Finding(
+		missingScriptRuleID,
+		sdk.SeverityLow,
+		sdk.ConfidenceMedium,
+		fmt.Sprintf("Build step invokes %s, which does not exist in the workspace", ref.script),
+	).
+		At(ref.from, ref.line, ref.line).
+		WithMetadata("type", "missing_script").
+		WithMetadata("script", script).
+		WithMetadata("invoked_by", ref.invokedBy).
+		Done()
+}
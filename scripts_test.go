@@ -0,0 +1,155 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScriptReferences(t *testing.T) {
+	tests := []struct {
+		command string
+		// want lists script paths, explicit ones marked with a leading "!".
+		want []string
+	}{
+		{"./scripts/release.sh", []string{"!scripts/release.sh"}},
+		{"bash -eu scripts/build", []string{"!scripts/build"}},
+		{"FOO=1 sudo ./tools/gen && echo done", []string{"tools/gen"}},
+		{"cd tools && ./gen.sh", []string{"!tools/gen.sh"}},
+		{"source venv/bin/activate", []string{"venv/bin/activate"}},
+		{". ./env.sh", []string{"!env.sh"}},
+		{"make -C services/api build", []string{"services/api/Makefile"}},
+		{"$(MAKE) -f release.mk dist", []string{"!release.mk"}},
+		{"bash $SCRIPT_DIR/x.sh; /usr/bin/env ./y.sh", []string{"!y.sh"}},
+		{"cd $WORKDIR && ./gen.sh", nil},
+		{"go build ./...", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, ref := range scriptReferences(tt.command) {
+			name := ref.script
+			if ref.explicit {
+				name = "!" + name
+			}
+			got = append(got, name)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q: got %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestLineClassifierSections(t *testing.T) {
+	tests := []struct {
+		file  string
+		lines []string
+		want  []string
+	}{
+		{
+			file:  ".github/workflows/release.yml",
+			lines: []string{"on: push", "jobs:", "  build:", "    steps:", "      - run: make", "  publish:", "    steps:"},
+			want:  []string{"on", "", "build", "build", "build", "publish", "publish"},
+		},
+		{
+			file:  ".gitlab-ci.yml",
+			lines: []string{"stages: [build]", "compile:", "  script:", "    - make"},
+			want:  []string{"stages", "compile", "compile", "compile"},
+		},
+		{
+			file:  "Makefile",
+			lines: []string{"VERSION := 1", ".PHONY: build", "build: deps", "\tgo build ."},
+			want:  []string{"", "", "build", "build"},
+		},
+	}
+	for _, tt := range tests {
+		c := newLineClassifier(filepath.FromSlash(tt.file))
+		for i, line := range tt.lines {
+			c.classify(line)
+			if c.section != tt.want[i] {
+				t.Errorf("%s line %d %q: section %q, want %q", tt.file, i+1, line, c.section, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestScanFollowsScriptReferences(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), strings.Join([]string{
+		"on: push",
+		"jobs:",
+		"  build:",
+		"    steps:",
+		"      - run: ./scripts/release.sh",
+		"      - run: bash scripts/missing.sh",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, "scripts", "release.sh"), strings.Join([]string{
+		"#!/bin/sh",
+		"curl -sSL https://example.com/install | sh",
+		"bash ./helpers/common.sh",
+	}, "\n")+"\n")
+	// common.sh sources release.sh again, closing a reference cycle.
+	writeFile(t, filepath.Join(workspace, "scripts", "helpers", "common.sh"), strings.Join([]string{
+		"source scripts/release.sh",
+		"apt-get install curl",
+	}, "\n")+"\n")
+	writeFile(t, filepath.Join(workspace, "Makefile"), "generate:\n\tcd tools && ./gen.sh\n")
+	writeFile(t, filepath.Join(workspace, "tools", "gen.sh"), "echo hi\ndate +%s > stamp\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	want := map[string]string{
+		"scripts/release.sh":        ".github/workflows/release.yml#build",
+		"scripts/helpers/common.sh": "scripts/release.sh",
+		"tools/gen.sh":              "Makefile#generate",
+	}
+	seen := make(map[string]bool)
+	for _, f := range findByRule(resp.GetFindings(), "PROV-003") {
+		path := f.GetLocation().GetFilePath()
+		invoker, followed := want[path]
+		if !followed {
+			continue
+		}
+		seen[path] = true
+		if got := f.GetMetadata()["invoked_by"]; got != invoker {
+			t.Errorf("%s: invoked_by = %q, want %q", path, got, invoker)
+		}
+		if got := confidenceNames[f.GetConfidence()]; got != "high" {
+			t.Errorf("%s line %d: confidence %s, want high", path, f.GetLocation().GetStartLine(), got)
+		}
+	}
+	for path := range want {
+		if !seen[path] {
+			t.Errorf("expected PROV-003 in followed script %s", path)
+		}
+	}
+
+	missing := findByRule(resp.GetFindings(), missingScriptRuleID)
+	if len(missing) != 1 {
+		t.Fatalf("expected one %s finding, got %d", missingScriptRuleID, len(missing))
+	}
+	meta := missing[0].GetMetadata()
+	if meta["script"] != "scripts/missing.sh" || meta["invoked_by"] != ".github/workflows/release.yml#build" || missing[0].GetLocation().GetStartLine() != 6 {
+		t.Errorf("unexpected missing script finding: line %d, %v", missing[0].GetLocation().GetStartLine(), meta)
+	}
+
+	summary := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if summary["scripts_followed"] != "3" {
+		t.Errorf("scripts_followed = %q, want 3", summary["scripts_followed"])
+	}
+}
+
+func TestScanFollowScriptsDisabled(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), "release:\n\t./release.sh\n\tbash missing.sh\n")
+	writeFile(t, filepath.Join(workspace, "release.sh"), "curl -sSL https://example.com/install | sh\n")
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root": workspace,
+		"follow_scripts": false,
+	})
+	for _, f := range resp.GetFindings() {
+		if f.GetLocation().GetFilePath() == "release.sh" || f.GetRuleId() == missingScriptRuleID {
+			t.Errorf("unexpected %s at %s with follow_scripts disabled", f.GetRuleId(), f.GetLocation().GetFilePath())
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// secretRuleID flags credential files referenced from provenance, copied
+// into images, or written to disk by CI steps.
+const secretRuleID = "PROV-024"
+
+// Kinds of credential files.
+const (
+	credentialPrivateKey     = "private_key"
+	credentialServiceAccount = "service_account_key"
+	credentialRegistryAuth   = "registry_credentials"
+	credentialCloud          = "cloud_credentials"
+)
+
+var (
+	// privateKeyNames are the default file names of SSH private keys.
+	privateKeyNames = map[string]bool{"id_rsa": true, "id_dsa": true, "id_ecdsa": true, "id_ed25519": true}
+	// privateKeyExts mark key and keystore files.
+	privateKeyExts = map[string]bool{".pem": true, ".key": true, ".p12": true, ".pfx": true, ".jks": true, ".keystore": true, ".ppk": true}
+	// registryAuthFiles hold package registry or host login tokens.
+	registryAuthFiles = map[string]bool{".npmrc": true, ".netrc": true, "_netrc": true, ".pypirc": true, ".dockercfg": true, ".git-credentials": true}
+	// serviceAccountName matches JSON key files of cloud service accounts,
+	// such as gcp-sa.json or deploy-service-account.json.
+	serviceAccountName = regexp.MustCompile(`service[-_]?account|(?:^|[-_.])sa(?:[-_.]|$)|credentials|keyfile`)
+)
+
+// credentialKind returns the kind of credential a file name or path looks
+// like, empty if none. Only the name is judged; contents are never read.
+func credentialKind(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(name, `\`, "/"))
+	base := path.Base(name)
+	switch {
+	case privateKeyNames[base] || privateKeyExts[path.Ext(base)]:
+		return credentialPrivateKey
+	case registryAuthFiles[base] || strings.HasSuffix(name, ".docker/config.json"):
+		return credentialRegistryAuth
+	case base == "credentials" && strings.HasSuffix(name, ".aws/credentials"):
+		return credentialCloud
+	case path.Ext(base) == ".json" && serviceAccountName.MatchString(strings.TrimSuffix(base, ".json")):
+		return credentialServiceAccount
+	}
+	return ""
+}
+
+// secretAllowed reports whether a credential-looking path matches an entry
+// of secret_allowlist, by base name or by the whole path.
+func secretAllowed(allow []string, name string) bool {
+	return globAllowed(allow, name)
+}
+
+// uriPath strips the query and fragment from a URI, leaving the path whose
+// base name is judged.
+func uriPath(uri string) string {
+	uri, _, _ = strings.Cut(uri, "#")
+	uri, _, _ = strings.Cut(uri, "?")
+	return uri
+}
+
+// secretReference is a credential-looking value found in a predicate.
+type secretReference struct {
+	// pointer is the JSON pointer of the value within the statement.
+	pointer string
+	value   string
+	kind    string
+}
+
+// maxParameterValue bounds the length of predicate strings judged as paths.
+const maxParameterValue = 1024
+
+// secretReferences returns the material URIs and names and the invocation
+// parameter values of a statement that name credential files, sorted by
+// pointer.
+func secretReferences(ps *parsedStatement, allow []string) []secretReference {
+	var refs []secretReference
+	add := func(pointer, value string) {
+		if len(value) > maxParameterValue || strings.ContainsAny(value, " \t\n") {
+			return
+		}
+		if kind := credentialKind(uriPath(value)); kind != "" && !secretAllowed(allow, uriPath(value)) {
+			refs = append(refs, secretReference{pointer: pointer, value: value, kind: kind})
+		}
+	}
+
+	p := &ps.Predicate
+	for i, m := range p.Materials {
+		add(fmt.Sprintf("/predicate/materials/%d/uri", i), m.URI)
+	}
+	for i, m := range p.BuildDefinition.ResolvedDependencies {
+		add(fmt.Sprintf("/predicate/buildDefinition/resolvedDependencies/%d/uri", i), m.URI)
+		add(fmt.Sprintf("/predicate/buildDefinition/resolvedDependencies/%d/name", i), m.Name)
+	}
+	walkJSONStrings("/predicate/invocation/parameters", p.Invocation.Parameters, add)
+	walkJSONStrings("/predicate/invocation/environment", p.Invocation.Environment, add)
+	walkJSONStrings("/predicate/recipe/arguments", p.Recipe.Arguments, add)
+	walkJSONStrings("/predicate/recipe/environment", p.Recipe.Environment, add)
+	for _, key := range sortedKeys(p.BuildDefinition.ExternalParameters) {
+		walkJSONStrings("/predicate/buildDefinition/externalParameters/"+jsonPointerToken(key), p.BuildDefinition.ExternalParameters[key], add)
+	}
+	for _, key := range sortedKeys(p.BuildDefinition.InternalParameters) {
+		walkJSONStrings("/predicate/buildDefinition/internalParameters/"+jsonPointerToken(key), p.BuildDefinition.InternalParameters[key], add)
+	}
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].pointer < refs[j].pointer })
+	return refs
+}
+
+// walkJSONStrings calls visit with the JSON pointer and value of every
+// string in raw, including object keys' values at any depth.
+func walkJSONStrings(pointer string, raw json.RawMessage, visit func(pointer, value string)) {
+	if len(raw) == 0 {
+		return
+	}
+	var v any
+	if json.Unmarshal(raw, &v) != nil {
+		return
+	}
+	var walk func(pointer string, v any)
+	walk = func(pointer string, v any) {
+		switch v := v.(type) {
+		case string:
+			visit(pointer, v)
+		case []any:
+			for i, e := range v {
+				walk(pointer+"/"+strconv.Itoa(i), e)
+			}
+		case map[string]any:
+			for _, k := range sortedKeys(v) {
+				walk(pointer+"/"+jsonPointerToken(k), v[k])
+			}
+		}
+	}
+	walk(pointer, v)
+}
+
+// jsonPointerToken escapes a key for use in a JSON pointer.
+func jsonPointerToken(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// dockerCopy matches a Dockerfile COPY or ADD instruction and captures its
+// operands.
+var dockerCopy = regexp.MustCompile(`^(?i)(COPY|ADD)\s+(.+)$`)
+
+// copiedSecrets returns the credential-looking sources of a Dockerfile COPY
+// or ADD instruction, along with the instruction name.
+func copiedSecrets(line string, allow []string) (string, []string) {
+	m := dockerCopy.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return "", nil
+	}
+	operands := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(m[2]), `\`))
+	var args []string
+	if strings.HasPrefix(operands, "[") {
+		if json.Unmarshal([]byte(operands), &args) != nil {
+			return "", nil
+		}
+	} else {
+		for _, w := range strings.Fields(operands) {
+			if !strings.HasPrefix(w, "--") {
+				args = append(args, strings.Trim(w, `"'`))
+			}
+		}
+	}
+	if len(args) < 2 {
+		return "", nil
+	}
+	var secrets []string
+	for _, src := range args[:len(args)-1] {
+		if credentialKind(src) != "" && !secretAllowed(allow, src) {
+			secrets = append(secrets, src)
+		}
+	}
+	return strings.ToUpper(m[1]), secrets
+}
+
+var (
+	// credentialWrite matches a shell redirect or tee into a file and
+	// captures the file.
+	credentialWrite = regexp.MustCompile(`(?:[^0-9&]>>?|^>>?|\btee\s+(?:-a\s+)?)\s*["']?([^\s"';|&<>()]+)`)
+	// credentialRemoval matches commands that delete files.
+	credentialRemoval = regexp.MustCompile(`\b(?:rm|shred|unlink)\s+(.+)`)
+)
+
+// credentialFileWrite is a command that writes a credential file to disk.
+type credentialFileWrite struct {
+	line   int
+	target string
+	kind   string
+}
+
+// credentialWrites tracks the credential files a CI config or script writes,
+// forgetting those it deletes again later: only files left on disk for the
+// following steps are long-lived.
+type credentialWrites struct {
+	pending []credentialFileWrite
+}
+
+// record notes the credential files a command writes and drops those it
+// deletes.
+func (w *credentialWrites) record(lineNum int, command string, allow []string) {
+	if m := credentialRemoval.FindStringSubmatch(command); m != nil {
+		for _, operand := range strings.Fields(m[1]) {
+			operand = strings.Trim(operand, `"'`)
+			kept := w.pending[:0]
+			for _, p := range w.pending {
+				if p.target != operand {
+					kept = append(kept, p)
+				}
+			}
+			w.pending = kept
+		}
+	}
+	for _, m := range credentialWrite.FindAllStringSubmatch(command, -1) {
+		target := m[1]
+		if kind := credentialKind(target); kind != "" && !secretAllowed(allow, target) {
+			w.pending = append(w.pending, credentialFileWrite{line: lineNum, target: target, kind: kind})
+		}
+	}
+}
+
+// report flags the credential files still on disk at the end of the file.
+func (w *credentialWrites) report(findings *findingSet, filePath string, origin commandOrigin) {
+	for _, p := range w.pending {
+		fb := findings.Finding(
+			secretRuleID,
+			sdk.SeverityHigh,
+			sdk.ConfidenceMedium,
+			fmt.Sprintf("CI step writes credential file %s to disk, where it persists for later build steps", p.target),
+		).
+			At(filePath, p.line, p.line).
+			WithMetadata("type", "credential_written_to_disk").
+			WithMetadata("secret_path", p.target).
+			WithMetadata("credential_kind", p.kind)
+		origin.annotate(fb).Done()
+	}
+}
+
+// reportCopiedSecrets flags a Dockerfile COPY or ADD of credential files,
+// which bakes them into an image layer.
+func reportCopiedSecrets(findings *findingSet, filePath string, lineNum int, instruction string, secrets []string) {
+	for _, src := range secrets {
+		findings.Finding(
+			secretRuleID,
+			sdk.SeverityHigh,
+			sdk.ConfidenceHigh,
+			fmt.Sprintf("Dockerfile %s copies credential file %s into the image; use a build secret mount instead", instruction, src),
+		).
+			At(filePath, lineNum, lineNum).
+			WithMetadata("type", "secret_copied_into_image").
+			WithMetadata("instruction", instruction).
+			WithMetadata("secret_path", src).
+			WithMetadata("credential_kind", credentialKind(src)).
+			Done()
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCredentialKind(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"/home/ci/.ssh/id_rsa", credentialPrivateKey},
+		{"certs/server.PEM", credentialPrivateKey},
+		{"release.p12", credentialPrivateKey},
+		{"gcp-sa.json", credentialServiceAccount},
+		{"deploy-service-account.json", credentialServiceAccount},
+		{"config/credentials.json", credentialServiceAccount},
+		{"~/.npmrc", credentialRegistryAuth},
+		{`C:\Users\ci\_netrc`, credentialRegistryAuth},
+		{"$HOME/.docker/config.json", credentialRegistryAuth},
+		{"/root/.aws/credentials", credentialCloud},
+		{"id_rsa.pub", ""},
+		{"package.json", ""},
+		{"salsa.json", ""},
+		{"credentials", ""},
+		{"git+https://github.com/example/app@refs/heads/main", ""},
+	}
+	for _, tt := range tests {
+		if got := credentialKind(tt.name); got != tt.want {
+			t.Errorf("credentialKind(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCopiedSecrets(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"COPY gcp-sa.json /app/", "gcp-sa.json"},
+		{"add --chown=app .npmrc id_rsa /root/", ".npmrc,id_rsa"},
+		{`COPY ["keys/server.pem", "/etc/ssl/"]`, "keys/server.pem"},
+		{"COPY --from=build /out/app /app", ""},
+		{"COPY ca.pem /etc/ssl/", ""},
+		{"RUN cp id_rsa /tmp", ""},
+	}
+	for _, tt := range tests {
+		_, got := copiedSecrets(tt.line, []string{"ca.pem"})
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("%q: got %v, want %s", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestScanReportsSecretsInProvenance(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "app.intoto.jsonl"), `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2",`+
+		`"subject":[{"name":"app","digest":{"sha256":"abc123"}}],`+
+		`"predicate":{"builder":{"id":"https://github.com/actions/runner"},"buildType":"https://example.com/build",`+
+		`"invocation":{"parameters":{"signing":{"keyFile":"/home/ci/.ssh/id_rsa"},"allowed":"ci/known.pem"}},`+
+		`"materials":[{"uri":"git+https://github.com/example/app","digest":{"sha1":"abc"}},{"uri":"file:///secrets/gcp-sa.json","digest":{"sha256":"def"}}]}}`+"\n")
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root":   workspace,
+		"secret_allowlist": "*/known.pem",
+	})
+	found := findByRule(resp.GetFindings(), secretRuleID)
+	want := map[string]string{
+		"/predicate/invocation/parameters/signing/keyFile": "/home/ci/.ssh/id_rsa",
+		"/predicate/materials/1/uri":                       "file:///secrets/gcp-sa.json",
+	}
+	if len(found) != len(want) {
+		t.Fatalf("expected %d %s findings, got %d", len(want), secretRuleID, len(found))
+	}
+	for _, f := range found {
+		meta := f.GetMetadata()
+		if want[meta["field"]] != meta["secret_path"] {
+			t.Errorf("unexpected finding for %s: %v", meta["field"], meta)
+		}
+		if severityNames[f.GetSeverity()] != "high" || meta["type"] != "secret_reference" {
+			t.Errorf("%s: severity %s, type %s", meta["field"], severityNames[f.GetSeverity()], meta["type"])
+		}
+	}
+}
+
+func TestScanReportsSecretsInBuildFiles(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), "FROM alpine:3.19\nCOPY gcp-sa.json /app/\n# COPY id_rsa /root/.ssh/\n")
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), strings.Join([]string{
+		"on: push",
+		"jobs:",
+		"  release:",
+		"    steps:",
+		`      - run: echo "//registry.npmjs.org/:_authToken=${{ secrets.NPM_TOKEN }}" > ~/.npmrc`,
+		`      - run: echo "${{ secrets.GCP_KEY }}" | base64 -d > "$RUNNER_TEMP/gcp-sa.json"`,
+		"      - run: make build",
+		`      - run: rm -f "$RUNNER_TEMP/gcp-sa.json"`,
+		"      - run: go test ./... 2> test.log",
+	}, "\n")+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+	found := findByRule(resp.GetFindings(), secretRuleID)
+	if len(found) != 2 {
+		t.Fatalf("expected 2 %s findings, got %d", secretRuleID, len(found))
+	}
+	for _, f := range found {
+		meta := f.GetMetadata()
+		switch f.GetLocation().GetFilePath() {
+		case "Dockerfile":
+			if meta["type"] != "secret_copied_into_image" || meta["secret_path"] != "gcp-sa.json" || f.GetLocation().GetStartLine() != 2 {
+				t.Errorf("unexpected Dockerfile finding: line %d, %v", f.GetLocation().GetStartLine(), meta)
+			}
+		case ".github/workflows/release.yml":
+			if meta["type"] != "credential_written_to_disk" || meta["secret_path"] != "~/.npmrc" || f.GetLocation().GetStartLine() != 5 {
+				t.Errorf("unexpected workflow finding: line %d, %v", f.GetLocation().GetStartLine(), meta)
+			}
+		default:
+			t.Errorf("unexpected finding at %s", f.GetLocation().GetFilePath())
+		}
+	}
+}
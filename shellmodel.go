@@ -0,0 +1,245 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// shellCommand is a simple command of a shell script: its words with quotes
+// removed and known variables expanded, and the files and text it reads and
+// writes besides its arguments.
+type shellCommand struct {
+	words []string
+	// redirects are the files the command's standard output is redirected
+	// to.
+	redirects []string
+	// input is the text of a <<< here-string, if any.
+	input string
+	// pipedFrom is the command whose output this one reads, if any.
+	pipedFrom *shellCommand
+}
+
+// shellAssignmentWord matches a word assigning a variable and captures the
+// name and value.
+var shellAssignmentWord = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+
+// shellParser splits shell text into simple commands, following the
+// variables it assigns.
+type shellParser struct {
+	// vars holds the values assigned so far; later expansions of them are
+	// replaced, others are kept as written.
+	vars map[string]string
+
+	commands []shellCommand
+	cur      shellCommand
+	word     strings.Builder
+	inWord   bool
+	// target is where the next word goes: the arguments, a redirect, or the
+	// here-string.
+	target byte
+	piped  bool
+}
+
+// Targets of the next word.
+const (
+	shellTargetArg      = 0
+	shellTargetRedirect = '>'
+	shellTargetInput    = '<'
+	shellTargetDiscard  = '-'
+)
+
+func newShellParser() *shellParser {
+	return &shellParser{vars: make(map[string]string)}
+}
+
+// parse splits text into simple commands at ;, &, &&, ||, |, and newlines,
+// and records the variables standalone assignments and export set.
+// Command substitutions and ${{ }} expressions are kept whole inside their
+// word.
+func (p *shellParser) parse(text string) []shellCommand {
+	p.commands = nil
+	p.cur = shellCommand{}
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\\' && quote != '\'':
+			if i+1 < len(text) && text[i+1] != '\n' {
+				p.add(text[i+1 : i+2])
+			}
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+			p.inWord = true
+		case c == '$' && quote != '\'':
+			i += p.expand(text[i:]) - 1
+		case c == '`' && quote != '\'':
+			end := strings.IndexByte(text[i+1:], '`')
+			if end < 0 {
+				p.add(text[i:])
+				i = len(text)
+				continue
+			}
+			p.add(text[i : i+end+2])
+			i += end + 1
+		case quote != 0:
+			p.add(string(c))
+		case c == ' ' || c == '\t':
+			p.endWord()
+		case c == '\n' || c == ';' || c == '&' || c == '|':
+			p.endWord()
+			if c == '|' && (i+1 >= len(text) || text[i+1] != '|') {
+				p.endCommand(true)
+				continue
+			}
+			if c == '&' && i+1 < len(text) && text[i+1] == '>' {
+				p.target = shellTargetRedirect
+				i++
+				continue
+			}
+			if i+1 < len(text) && text[i+1] == c {
+				i++
+			}
+			p.endCommand(false)
+		case c == '>':
+			fd := p.word.String()
+			if p.inWord && fd != "1" && fd != "2" {
+				p.endWord()
+			} else {
+				p.word.Reset()
+				p.inWord = false
+			}
+			if i+1 < len(text) && text[i+1] == '>' {
+				i++
+			}
+			if i+1 < len(text) && text[i+1] == '&' {
+				// Duplicating a descriptor, as in 2>&1, writes no file.
+				for i+1 < len(text) && text[i+1] != ' ' && text[i+1] != ';' {
+					i++
+				}
+				continue
+			}
+			p.target = shellTargetRedirect
+			if fd == "2" {
+				p.target = shellTargetDiscard
+			}
+		case c == '<':
+			p.endWord()
+			p.target = shellTargetDiscard
+			if strings.HasPrefix(text[i:], "<<<") {
+				p.target = shellTargetInput
+				i += 2
+			}
+		default:
+			p.add(string(c))
+		}
+	}
+	p.endWord()
+	p.endCommand(false)
+	return p.commands
+}
+
+// expand reads the expansion at the start of s, adds it to the current word,
+// and returns how many bytes it took.
+func (p *shellParser) expand(s string) int {
+	switch {
+	case strings.HasPrefix(s, "${{"):
+		end := strings.Index(s, "}}")
+		if end < 0 {
+			end = len(s) - 2
+		}
+		p.add(s[:end+2])
+		return end + 2
+	case strings.HasPrefix(s, "$("):
+		depth := 0
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					p.add(s[:i+1])
+					return i + 1
+				}
+			}
+		}
+		p.add(s)
+		return len(s)
+	}
+	m := shellVarRef.FindStringSubmatch(s)
+	if m == nil {
+		p.add("$")
+		return 1
+	}
+	name := m[1] + m[2]
+	if value, ok := p.vars[name]; ok && (m[1] == "" || m[0] == "${"+name+"}") {
+		p.add(value)
+	} else {
+		p.add(m[0])
+	}
+	return len(m[0])
+}
+
+// add appends text to the current word.
+func (p *shellParser) add(text string) {
+	p.word.WriteString(text)
+	p.inWord = true
+}
+
+// endWord finishes the current word, if any.
+func (p *shellParser) endWord() {
+	if !p.inWord {
+		return
+	}
+	word := p.word.String()
+	p.word.Reset()
+	p.inWord = false
+	switch p.target {
+	case shellTargetRedirect:
+		p.cur.redirects = append(p.cur.redirects, word)
+	case shellTargetInput:
+		p.cur.input = word
+	case shellTargetArg:
+		p.cur.words = append(p.cur.words, word)
+	}
+	p.target = shellTargetArg
+}
+
+// endCommand finishes the current command, recording its assignments, and
+// starts the next, which reads its output if piped is set.
+func (p *shellParser) endCommand(piped bool) {
+	cmd := p.cur
+	p.cur = shellCommand{}
+	p.target = shellTargetArg
+	if len(cmd.words) > 0 {
+		p.assign(cmd.words)
+		if p.piped && len(p.commands) > 0 {
+			prev := p.commands[len(p.commands)-1]
+			cmd.pipedFrom = &prev
+		}
+		p.commands = append(p.commands, cmd)
+	}
+	p.piped = piped
+}
+
+// assign records the variables set by a command made only of assignments,
+// optionally behind export or local.
+func (p *shellParser) assign(words []string) {
+	if words[0] == "export" || words[0] == "local" || words[0] == "readonly" {
+		words = words[1:]
+	}
+	values := make(map[string]string)
+	for _, w := range words {
+		m := shellAssignmentWord.FindStringSubmatch(w)
+		if m == nil {
+			return
+		}
+		values[m[1]] = m[2]
+	}
+	for name, value := range values {
+		p.vars[name] = value
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// longLivedKeyRuleID flags a release workflow that signs or attests with a
+// self-managed long-lived key instead of keyless signing with the
+// workflow's identity.
+const longLivedKeyRuleID = "PROV-062"
+
+// How a workflow signs: with a key it manages, with a key held in a cloud
+// KMS or Vault, or keyless with its OIDC identity.
+const (
+	signingStyleKey     = "key"
+	signingStyleKMS     = "kms"
+	signingStyleKeyless = "keyless"
+)
+
+// Where a long-lived signing key comes from.
+const (
+	keySourceSecret   = "secret"
+	keySourceEnv      = "env"
+	keySourceFile     = "file"
+	keySourceImported = "imported"
+	keySourceKeyring  = "keyring"
+)
+
+var (
+	// cosignKeyArg captures the key a cosign command is given, keeping an
+	// expression such as ${{ secrets.COSIGN_KEY }} whole.
+	cosignKeyArg = regexp.MustCompile(`--key[=\s]+["']?(\$\{\{[^}]*\}\}|[^\s"']+)`)
+	// kmsKeyRef matches cosign key references to a KMS or Vault.
+	kmsKeyRef = regexp.MustCompile(`^(?:awskms|gcpkms|azurekms|hashivault|k8s)://`)
+	// cosignKeyEnv matches the definition of cosign's private key variable,
+	// capturing its value.
+	cosignKeyEnv = regexp.MustCompile(`^(COSIGN_(?:PRIVATE_)?KEY)\s*:\s*(.+)$`)
+	// cosignExperimental matches the variable that made old cosign
+	// releases sign keyless.
+	cosignExperimental = regexp.MustCompile(`^COSIGN_EXPERIMENTAL\s*:\s*["']?(?:1|true)\b`)
+	// gpgKeyImport matches commands importing a gpg key.
+	gpgKeyImport = regexp.MustCompile(`\bgpg2?\b.*\s--import\b`)
+	// minisignKeyFile captures the secret key file minisign signs with.
+	minisignKeyFile = regexp.MustCompile(`\s-s\s+["']?([^\s"']+)`)
+)
+
+// gpgImportActions import a gpg private key into the runner's keyring.
+var gpgImportActions = map[string]bool{"crazy-max/ghaction-import-gpg": true}
+
+// keySigning is a step of a workflow signing with a long-lived key.
+type keySigning struct {
+	line   int
+	job    string
+	tool   string
+	keyRef string
+	source string
+}
+
+// keySource classifies the key reference a signing command is given.
+func keySource(ref string) string {
+	switch {
+	case strings.Contains(ref, "secrets."):
+		return keySourceSecret
+	case strings.HasPrefix(ref, "env://"), strings.HasPrefix(ref, "$"):
+		return keySourceEnv
+	}
+	return keySourceFile
+}
+
+// trackSigningLine reads a line of the workflow for the signing setup it
+// declares: cosign's key and keyless variables and key import actions.
+func (w *workflowTracker) trackSigningLine(trimmed string, lineNum int, job string) {
+	key := strings.TrimPrefix(trimmed, "- ")
+	if m := cosignKeyEnv.FindStringSubmatch(key); m != nil && strings.Contains(m[2], "secrets.") {
+		w.keyEnvs = append(w.keyEnvs, keySigning{line: lineNum, job: job, tool: "cosign", keyRef: m[1], source: keySourceSecret})
+	}
+	if cosignExperimental.MatchString(key) {
+		w.keyless = append(w.keyless, stepRef{line: lineNum, step: "COSIGN_EXPERIMENTAL"})
+	}
+	if m := usesKey.FindStringSubmatch(trimmed); m != nil {
+		switch name := actionName(m[1]); {
+		case isAttestationAction(m[1]):
+			w.keyless = append(w.keyless, stepRef{line: lineNum, step: name})
+		case gpgImportActions[name]:
+			w.keyImport = true
+		}
+	}
+}
+
+// trackSigning classifies the signing a logical run command of a workflow
+// job does: cosign with or without a key, gpg, and minisign.
+func (w *workflowTracker) trackSigning(cmd logicalCommand) {
+	if w == nil || cmd.context != contextRunCommand || !containsAny(cmd.text, "cosign", "gpg", "minisign") {
+		return
+	}
+	if gpgKeyImport.MatchString(cmd.text) {
+		w.keyImport = true
+	}
+	if signingStepPattern.MatchString(cmd.text) {
+		m := cosignKeyArg.FindStringSubmatch(cmd.text)
+		switch {
+		case m == nil:
+			w.keyless = append(w.keyless, stepRef{line: cmd.line, step: "cosign"})
+		case kmsKeyRef.MatchString(m[1]):
+			w.kmsSigns = append(w.kmsSigns, stepRef{line: cmd.line, step: "cosign"})
+		default:
+			w.keySigns = append(w.keySigns, keySigning{line: cmd.line, job: cmd.section, tool: "cosign", keyRef: m[1], source: keySource(m[1])})
+		}
+	}
+	if s := fileSigningCommand.FindString(cmd.text); s != "" {
+		k := keySigning{line: cmd.line, job: cmd.section, tool: strings.Fields(s)[0], source: keySourceKeyring}
+		if m := minisignKeyFile.FindStringSubmatch(cmd.text); m != nil && k.tool == "minisign" {
+			k.keyRef, k.source = m[1], keySource(m[1])
+		}
+		w.keySigns = append(w.keySigns, k)
+	}
+}
+
+// keySteps returns the steps signing with a long-lived key. A cosign key
+// variable counts as a step of its own only when no command in its job, or
+// in any job for a workflow-level variable, signs with a key, so the
+// variable and the command using it are one step.
+func (w *workflowTracker) keySteps() []keySigning {
+	if len(w.keyEnvs) == 0 {
+		return w.keySigns
+	}
+	signingJobs := make(map[string]bool)
+	for _, k := range w.keySigns {
+		signingJobs[k.job] = true
+	}
+	steps := append([]keySigning(nil), w.keySigns...)
+	for _, k := range w.keyEnvs {
+		if signingJobs[k.job] || (k.job == "" && len(w.keySigns) > 0) {
+			continue
+		}
+		signingJobs[k.job] = true
+		steps = append(steps, k)
+	}
+	return steps
+}
+
+// signingStyles returns how the workflow signs, in a fixed order.
+func (w *workflowTracker) signingStyles() []string {
+	var styles []string
+	if len(w.keySteps()) > 0 {
+		styles = append(styles, signingStyleKey)
+	}
+	if len(w.kmsSigns) > 0 {
+		styles = append(styles, signingStyleKMS)
+	}
+	if len(w.keyless) > 0 {
+		styles = append(styles, signingStyleKeyless)
+	}
+	return styles
+}
+
+// reportSigningKeys flags a release workflow signing with a long-lived key,
+// once, at its first such step. A workflow also signing keyless, as during
+// a migration, is reported with both styles.
+func (w *workflowTracker) reportSigningKeys(findings *findingSet, filePath string) {
+	steps := w.keySteps()
+	if !w.release || len(steps) == 0 {
+		return
+	}
+	first := steps[0]
+	for _, k := range steps[1:] {
+		if k.line < first.line {
+			first = k
+		}
+	}
+	source := first.source
+	if strings.HasPrefix(first.tool, "gpg") && w.keyImport {
+		source = keySourceImported
+	}
+	var tools []string
+	seen := make(map[string]bool)
+	for _, k := range steps {
+		if !seen[k.tool] {
+			seen[k.tool] = true
+			tools = append(tools, k.tool)
+		}
+	}
+	styles := w.signingStyles()
+	message := fmt.Sprintf("Release workflow signs with a long-lived %s key; switch to keyless signing with the workflow's OIDC identity (cosign without --key and id-token: write, or actions/attest-build-provenance)", first.tool)
+	if len(w.keyless) > 0 {
+		message = fmt.Sprintf("Release workflow signs both keyless and with a long-lived %s key; finish moving to keyless signing and retire the key", first.tool)
+	}
+	fb := findings.Finding(longLivedKeyRuleID, sdk.SeverityLow, sdk.ConfidenceMedium, message).
+		At(filePath, first.line, first.line).
+		WithMetadata("type", "long_lived_signing_key").
+		WithMetadata("signing_styles", strings.Join(styles, ",")).
+		WithMetadata("transition", strconv.FormatBool(len(w.keyless) > 0)).
+		WithMetadata("tools", strings.Join(tools, ",")).
+		WithMetadata("key_source", source).
+		WithMetadata("key_signing_steps", strconv.Itoa(len(steps)))
+	if first.job != "" {
+		fb.WithMetadata("job", first.job)
+	}
+	if first.keyRef != "" {
+		fb.WithMetadata("key_ref", first.keyRef)
+	}
+	if len(w.keyless) > 0 {
+		fb.WithMetadata("keyless_step", w.keyless[0].step).
+			WithMetadata("keyless_line", strconv.Itoa(w.keyless[0].line))
+	}
+	fb.Done()
+}
+
+// recordSigningStyles records how a workflow that signs does so, for the
+// summary.
+func (s *scanSummary) recordSigningStyles(rel string, w *workflowTracker) {
+	if styles := w.signingStyles(); len(styles) > 0 {
+		if s.signingStyles == nil {
+			s.signingStyles = make(map[string]string)
+		}
+		s.signingStyles[rel] = strings.Join(styles, "+")
+	}
+}
+
+// formatSigningStyles renders the signing style of each workflow as
+// workflow=style pairs, styles of a workflow joined by +.
+func formatSigningStyles(styles map[string]string) string {
+	workflows := sortedKeys(styles)
+	for i, rel := range workflows {
+		workflows[i] = rel + "=" + styles[rel]
+	}
+	return strings.Join(workflows, ",")
+}
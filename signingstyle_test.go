@@ -0,0 +1,135 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// signingWorkflow is a tag-triggered release workflow running the given
+// steps.
+func signingWorkflow(steps ...string) string {
+	return strings.Join(append([]string{
+		"on:",
+		"  push:",
+		"    tags: ['v*']",
+		"permissions:",
+		"  id-token: write",
+		"jobs:",
+		"  release:",
+		"    runs-on: ubuntu-latest",
+		"    steps:",
+		"      - run: make dist",
+	}, steps...), "\n") + "\n"
+}
+
+func TestScanLongLivedSigningKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  []string
+		meta   map[string]string
+		styles string
+	}{
+		{
+			name:   "cosign key from secret",
+			steps:  []string{"      - run: cosign sign-blob --yes --key env://COSIGN_PRIVATE_KEY dist/app", "        env:", "          COSIGN_PRIVATE_KEY: ${{ secrets.COSIGN_PRIVATE_KEY }}"},
+			meta:   map[string]string{"signing_styles": "key", "transition": "false", "tools": "cosign", "key_ref": "env://COSIGN_PRIVATE_KEY", "key_source": "env", "job": "release", "key_signing_steps": "1"},
+			styles: "key",
+		},
+		{
+			name: "cosign key variable for the job",
+			steps: []string{
+				"        env:",
+				"          COSIGN_KEY: ${{ secrets.COSIGN_KEY }}",
+				"      - run: cosign sign --yes --key env://COSIGN_KEY ghcr.io/acme/app@${DIGEST}",
+				"      - run: cosign attest --yes --key env://COSIGN_KEY --predicate sbom.json ghcr.io/acme/app@${DIGEST}",
+			},
+			meta:   map[string]string{"key_ref": "env://COSIGN_KEY", "key_source": "env", "key_signing_steps": "2"},
+			styles: "key",
+		},
+		{
+			name:   "cosign key variable only",
+			steps:  []string{"      - run: ./scripts/sign.sh", "        env:", "          COSIGN_KEY: ${{ secrets.COSIGN_KEY }}"},
+			meta:   map[string]string{"key_ref": "COSIGN_KEY", "key_source": "secret", "key_signing_steps": "1"},
+			styles: "key",
+		},
+		{
+			name: "continued cosign command",
+			steps: []string{
+				"      - run: |",
+				"          cosign sign \\",
+				"            --key cosign.key ghcr.io/acme/app@${DIGEST}",
+			},
+			meta:   map[string]string{"tools": "cosign", "key_ref": "cosign.key", "key_source": "file"},
+			styles: "key",
+		},
+		{
+			name: "imported gpg key",
+			steps: []string{
+				"      - uses: crazy-max/ghaction-import-gpg@v6",
+				"        with:",
+				"          gpg_private_key: ${{ secrets.GPG_PRIVATE_KEY }}",
+				"      - run: gpg --batch --detach-sign --armor dist/checksums.txt",
+			},
+			meta:   map[string]string{"tools": "gpg", "key_source": "imported"},
+			styles: "key",
+		},
+		{
+			name: "transition",
+			steps: []string{
+				"      - uses: actions/attest-build-provenance@v1",
+				"        with:",
+				"          subject-path: dist/app",
+				"      - run: cosign sign-blob --key ${{ secrets.COSIGN_KEY }} dist/app",
+			},
+			meta:   map[string]string{"signing_styles": "key,keyless", "transition": "true", "key_source": "secret", "keyless_step": "actions/attest-build-provenance"},
+			styles: "key+keyless",
+		},
+		{name: "keyless cosign", steps: []string{"      - run: cosign sign-blob --yes dist/app --bundle app.bundle"}, styles: "keyless"},
+		{name: "kms key", steps: []string{"      - run: cosign sign --key awskms:///alias/release ghcr.io/acme/app@${DIGEST}"}, styles: "kms"},
+		{name: "no signing", steps: []string{"      - run: gh release create v1 dist/*"}},
+	}
+	client := testClient(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"), signingWorkflow(tt.steps...))
+
+			resp := invokeScan(t, client, workspace)
+			found := findByRule(resp.GetFindings(), longLivedKeyRuleID)
+			if tt.meta == nil {
+				if len(found) != 0 {
+					t.Errorf("expected no findings, got %v", found)
+				}
+			} else if len(found) != 1 {
+				t.Fatalf("expected one finding, got %d", len(found))
+			} else {
+				meta := found[0].GetMetadata()
+				for k, v := range tt.meta {
+					if meta[k] != v {
+						t.Errorf("%s = %q, want %q (metadata %v)", k, meta[k], v, meta)
+					}
+				}
+			}
+
+			summary := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+			want := ""
+			if tt.styles != "" {
+				want = ".github/workflows/release.yml=" + tt.styles
+			}
+			if summary["signing_styles"] != want {
+				t.Errorf("summary signing_styles = %q, want %q", summary["signing_styles"], want)
+			}
+		})
+	}
+}
+
+func TestScanSigningKeyOutsideRelease(t *testing.T) {
+	workspace := t.TempDir()
+	workflow := strings.Replace(signingWorkflow("      - run: cosign sign-blob --key cosign.key dist/app"), "    tags: ['v*']", "    branches: [main]", 1)
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "nightly.yml"), workflow)
+
+	if found := findByRule(invokeScan(t, testClient(t), workspace).GetFindings(), longLivedKeyRuleID); len(found) != 0 {
+		t.Errorf("expected no findings outside release workflows, got %d", len(found))
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import "strings"
+
+// maxSLSALevel is the highest SLSA build level the heuristics can assign.
+const maxSLSALevel = 3
+
+// slsaLevelCheck is one row of the SLSA level heuristic table. A statement
+// reaches a level only if it meets every check at that level and below.
+//
+// The estimate is deliberately conservative: it only looks at what the
+// statement itself claims, and never verifies signatures or builder
+// identities, so it is an upper bound on what a verifier would accept.
+type slsaLevelCheck struct {
+	level       int
+	requirement string
+	met         func(ps *parsedStatement) bool
+}
+
+// slsaLevelChecks is the heuristic table, ordered by level.
+//
+//	Level 1: provenance exists, names its builder and build type, and
+//	         identifies every subject by digest.
+//	Level 2: the statement is signed and produced by a known hosted builder.
+//	Level 3: the build type is one run by an isolated, hardened builder,
+//	         every material is pinned by digest, and the signed statement
+//	         was recorded in a transparency log.
+var slsaLevelChecks = []slsaLevelCheck{
+	{1, "subject digests", func(ps *parsedStatement) bool {
+		if len(ps.Statement.Subject) == 0 {
+			return false
+		}
+		for _, subj := range ps.Statement.Subject {
+			if len(subj.Digest) == 0 {
+				return false
+			}
+		}
+		return true
+	}},
+	{1, "builder ID", func(ps *parsedStatement) bool {
+		return ps.PredicateOK && ps.Predicate.builderID() != ""
+	}},
+	{1, "build type", func(ps *parsedStatement) bool {
+		return ps.PredicateOK && ps.Predicate.buildTypeURI() != ""
+	}},
+	{2, "signed envelope", func(ps *parsedStatement) bool {
+		return ps.Signatures > 0
+	}},
+	{2, "hosted builder", func(ps *parsedStatement) bool {
+		return hasAnyPrefix(ps.Predicate.builderID(), hostedBuilderPrefixes)
+	}},
+	{3, "isolated build type", func(ps *parsedStatement) bool {
+		return hasAnyPrefix(ps.Predicate.buildTypeURI(), isolatedBuildTypePrefixes)
+	}},
+	{3, "materials pinned by digest", func(ps *parsedStatement) bool {
+		materials := ps.Predicate.allMaterials()
+		if len(materials) == 0 {
+			return false
+		}
+		for _, m := range materials {
+			if len(m.Digest) == 0 {
+				return false
+			}
+		}
+		return true
+	}},
+	{3, "transparency log entry", func(ps *parsedStatement) bool {
+		return ps.TlogEntries > 0
+	}},
+}
+
+// hostedBuilderPrefixes are builder ID prefixes of hosted build platforms.
+var hostedBuilderPrefixes = []string{
+	"https://github.com/actions/runner",
+	"https://github.com/slsa-framework/slsa-github-generator/",
+	"https://github.com/Attestations/GitHubHostedActions",
+	"https://cloudbuild.googleapis.com/",
+	"https://gitlab.com/",
+	"https://tekton.dev/chains",
+}
+
+// isolatedBuildTypePrefixes are build types produced by builders that run
+// each build in an isolated, ephemeral environment the build cannot
+// influence.
+var isolatedBuildTypePrefixes = []string{
+	"https://github.com/slsa-framework/slsa-github-generator/",
+	"https://slsa-framework.github.io/github-actions-buildtypes/workflow/",
+	"https://cloudbuild.googleapis.com/CloudBuildYaml",
+	"https://cloudbuild.googleapis.com/GoogleHostedWorker",
+}
+
+// estimateSLSALevel returns the estimated SLSA build level of a statement
+// and, below the maximum, the first requirement of the next level it fails.
+func estimateSLSALevel(ps *parsedStatement) (level int, gap string) {
+	for _, check := range slsaLevelChecks {
+		if !check.met(ps) {
+			return check.level - 1, check.requirement
+		}
+	}
+	return maxSLSALevel, ""
+}
+
+// hasAnyPrefix reports whether s starts with one of prefixes.
+func hasAnyPrefix(s string, prefixes []string) bool {
+	if s == "" {
+		return false
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
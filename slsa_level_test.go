@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	generatorBuilder   = "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@refs/tags/v1.9.0"
+	generatorBuildType = "https://github.com/slsa-framework/slsa-github-generator/generic@v1"
+)
+
+// levelStatement builds a statement with the given builder, build type, and
+// raw subjects and materials JSON.
+func levelStatement(builder, buildType, subjects, materials string) string {
+	return `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2",` +
+		`"subject":` + subjects + `,"predicate":{"builder":{"id":"` + builder + `"},"buildType":"` + buildType + `",` +
+		`"materials":` + materials + `}}`
+}
+
+// signed wraps a statement in a DSSE envelope with one signature.
+func signed(stmt string) string {
+	payload := base64.StdEncoding.EncodeToString([]byte(stmt))
+	return `{"payloadType":"application/vnd.in-toto+json","payload":"` + payload + `","signatures":[{"keyid":"k","sig":"s"}]}`
+}
+
+// bundled wraps a statement in a Sigstore bundle with the given number of
+// transparency log entries.
+func bundled(stmt string, tlogEntries int) string {
+	entries := ""
+	for i := 0; i < tlogEntries; i++ {
+		if i > 0 {
+			entries += ","
+		}
+		entries += `{"logIndex":"1"}`
+	}
+	return `{"mediaType":"application/vnd.dev.sigstore.bundle.v0.3+json","verificationMaterial":{"tlogEntries":[` + entries + `]},"dsseEnvelope":` + signed(stmt) + `}`
+}
+
+func TestEstimateSLSALevel(t *testing.T) {
+	const (
+		subjects       = `[{"name":"app","digest":{"sha256":"abc123def4567890abc123def4567890abc123def4567890abc123def4567890"}}]`
+		pinned         = `[{"uri":"git+https://github.com/example/repo","digest":{"sha1":"def"}}]`
+		unpinned       = `[{"uri":"git+https://github.com/example/repo"}]`
+		hostedBuilder  = "https://github.com/actions/runner"
+		genericBuild   = "https://github.com/actions/workflow"
+		unknownBuilder = "https://builder.example"
+	)
+
+	tests := []struct {
+		name     string
+		document string
+		level    int
+		gap      string
+	}{
+		{"no subject digest", levelStatement(hostedBuilder, genericBuild, `[{"name":"app","digest":{}}]`, pinned), 0, "subject digests"},
+		{"no builder", levelStatement("", genericBuild, subjects, pinned), 0, "builder ID"},
+		{"no build type", testStatement, 0, "build type"},
+		{"unsigned", levelStatement(hostedBuilder, genericBuild, subjects, pinned), 1, "signed envelope"},
+		{"signed by unknown builder", signed(levelStatement(unknownBuilder, genericBuild, subjects, pinned)), 1, "hosted builder"},
+		{"signed by hosted builder", signed(levelStatement(hostedBuilder, genericBuild, subjects, pinned)), 2, "isolated build type"},
+		{"isolated but unpinned materials", bundled(levelStatement(generatorBuilder, generatorBuildType, subjects, unpinned), 1), 2, "materials pinned by digest"},
+		{"isolated without transparency log", signed(levelStatement(generatorBuilder, generatorBuildType, subjects, pinned)), 2, "transparency log entry"},
+		{"isolated with transparency log", bundled(levelStatement(generatorBuilder, generatorBuildType, subjects, pinned), 1), 3, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements, err := parseProvenance(context.Background(), []byte(tt.document))
+			if err != nil {
+				t.Fatalf("parseProvenance: %v", err)
+			}
+			level, gap := estimateSLSALevel(&statements[0])
+			if level != tt.level || gap != tt.gap {
+				t.Errorf("estimateSLSALevel() = %d, %q; want %d, %q", level, gap, tt.level, tt.gap)
+			}
+		})
+	}
+}
+
+func TestValidateRequiredSLSALevel(t *testing.T) {
+	client := testClient(t)
+	level2 := signed(levelStatement("https://github.com/actions/runner", "https://github.com/actions/workflow",
+		`[{"name":"app","digest":{"sha256":"abc123def4567890abc123def4567890abc123def4567890abc123def4567890"}}]`, `[{"uri":"git+https://github.com/example/repo","digest":{"sha1":"def"}}]`))
+
+	resp := invokeTool(t, client, "validate", map[string]any{"content": level2, "required_slsa_level": 2})
+	if found := findByRule(resp.GetFindings(), "PROV-009"); len(found) != 0 {
+		t.Errorf("expected no PROV-009 when the required level is met, got %d", len(found))
+	}
+
+	resp = invokeTool(t, client, "validate", map[string]any{"content": level2, "required_slsa_level": 3})
+	found := findByRule(resp.GetFindings(), "PROV-009")
+	if len(found) != 1 {
+		t.Fatalf("expected one PROV-009 when the required level is not met, got %d", len(found))
+	}
+	meta := found[0].GetMetadata()
+	if meta["slsa_level"] != "2" || meta["required_slsa_level"] != "3" || meta["slsa_level_gap"] != "isolated build type" {
+		t.Errorf("unexpected PROV-009 metadata %v", meta)
+	}
+}
+
+func TestScanSummarySLSALevels(t *testing.T) {
+	const pinned = `[{"uri":"git+https://github.com/example/repo","digest":{"sha1":"def"}}]`
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "release", "app.intoto.jsonl"),
+		bundled(levelStatement(generatorBuilder, generatorBuildType, `[{"name":"app","digest":{"sha256":"abc123def4567890abc123def4567890abc123def4567890abc123def4567890"}}]`, pinned), 1)+"\n")
+	writeFile(t, filepath.Join(workspace, "release", "cli.intoto.jsonl"),
+		levelStatement("https://github.com/actions/runner", "https://github.com/actions/workflow", `[{"name":"cli","digest":{"sha256":"abc123def4567890abc123def4567890abc123def4567890abc123def4567890"}}]`, pinned)+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["slsa_level_min"] != "1" {
+		t.Errorf("slsa_level_min = %q, want 1", meta["slsa_level_min"])
+	}
+	if meta["slsa_levels"] != "app=3,cli=1" {
+		t.Errorf("slsa_levels = %q, want app=3,cli=1", meta["slsa_levels"])
+	}
+}
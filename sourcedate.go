@@ -0,0 +1,164 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// sourceDateEpoch is the variable reproducible builds take their timestamps
+// from, as specified by reproducible-builds.org.
+const sourceDateEpoch = "SOURCE_DATE_EPOCH"
+
+// How a line that embeds a date relates to SOURCE_DATE_EPOCH.
+const (
+	// sourceDateDerived lines take the date from SOURCE_DATE_EPOCH, which
+	// is defined in scope. They are not reported.
+	sourceDateDerived = "derived"
+	// sourceDateClock lines set SOURCE_DATE_EPOCH from the current time.
+	sourceDateClock = "set_from_clock"
+	// sourceDateUnused lines ignore the SOURCE_DATE_EPOCH defined in scope.
+	sourceDateUnused = "unused"
+	// sourceDateUndefined lines read SOURCE_DATE_EPOCH, but nothing in scope
+	// defines it.
+	sourceDateUndefined = "undefined"
+	// sourceDateAbsent lines embed a date with no SOURCE_DATE_EPOCH in scope.
+	sourceDateAbsent = "absent"
+)
+
+// sourceDateRemediations point each reported status at SOURCE_DATE_EPOCH.
+var sourceDateRemediations = map[string]string{
+	sourceDateClock:     "Set SOURCE_DATE_EPOCH from the last commit, as in $(git log -1 --format=%ct), not from the current time",
+	sourceDateUnused:    "SOURCE_DATE_EPOCH is defined in scope; derive the date from it, as in date -u -d @$SOURCE_DATE_EPOCH",
+	sourceDateUndefined: "Define SOURCE_DATE_EPOCH in this file or job, as in export SOURCE_DATE_EPOCH=$(git log -1 --format=%ct)",
+	sourceDateAbsent:    "Export SOURCE_DATE_EPOCH=$(git log -1 --format=%ct) and derive embedded dates from it, as in date -u -d @$SOURCE_DATE_EPOCH",
+}
+
+// sourceDateDefinition matches a line that defines SOURCE_DATE_EPOCH: a
+// shell or make assignment or export, including one written to $GITHUB_ENV,
+// a YAML env or variables key, or a Dockerfile ENV or ARG.
+var sourceDateDefinition = regexp.MustCompile(`(?:^|[\s;&|("'])(?:export\s+)?SOURCE_DATE_EPOCH\s*(?:[:?+!]?=|::=|:(?:\s|$))|^(?:export|override|ENV|ARG)\s+(?:.*\s)?SOURCE_DATE_EPOCH\b`)
+
+// sourceDateClockValue matches SOURCE_DATE_EPOCH assigned the output of date,
+// which is the current time unless date is given a fixed one.
+var sourceDateClockValue = regexp.MustCompile("SOURCE_DATE_EPOCH\\s*(?:[:?+!]?=|::=|:)\\s*[\"']?(?:\\$\\(\\s*(?:shell\\s+)?|`\\s*)date\\b[^)`@]*(?:[)`]|$)")
+
+// variableAssignment matches a shell or make assignment, export, or YAML
+// env key, and captures the variable.
+var variableAssignment = regexp.MustCompile(`(?:^|[\s;&|("'])(?:export\s+|ENV\s+|ARG\s+)?([A-Za-z_][A-Za-z0-9_]*)\s*(?:[:?+!]?=|::=|:(?:\s|$))`)
+
+// sourceDateScope tracks the variables a config defines from
+// SOURCE_DATE_EPOCH, SOURCE_DATE_EPOCH itself included: for the whole file,
+// or for one CI job or Makefile target. Definitions only cover the lines
+// after them.
+type sourceDateScope struct {
+	file     map[string]bool
+	sections map[string]map[string]bool
+}
+
+// fileSections are the top-level YAML keys whose variables apply to every
+// job: GitHub's workflow env and GitLab's variables.
+var fileSections = map[string]bool{"": true, "env": true, "variables": true}
+
+// observe records the definitions of SOURCE_DATE_EPOCH, and of variables
+// derived from it, such as BUILD_DATE := $(shell date -d @$(SOURCE_DATE_EPOCH)),
+// on a line. Makefile variables are global whatever target they follow,
+// and each recipe line runs in a shell of its own, so only assignments
+// outside recipes count for the whole file.
+func (s *sourceDateScope) observe(line string, lc lineContext, format configFormat, section string) {
+	if lc == contextComment || !strings.Contains(line, sourceDateEpoch) {
+		return
+	}
+	trimmed := strings.TrimSpace(line)
+	var names []string
+	if sourceDateDefinition.MatchString(trimmed) {
+		names = append(names, sourceDateEpoch)
+	}
+	if !sourceDateClockValue.MatchString(line) {
+		for _, m := range variableAssignment.FindAllStringSubmatch(trimmed, -1) {
+			if m[1] != sourceDateEpoch && m[1] != "export" {
+				names = append(names, m[1])
+			}
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	scope := s.file
+	if !(format == formatMakefile && lc != contextRecipe || fileSections[section]) {
+		if s.sections == nil {
+			s.sections = make(map[string]map[string]bool)
+		}
+		scope = s.sections[section]
+		if scope == nil {
+			scope = make(map[string]bool)
+			s.sections[section] = scope
+		}
+	} else if scope == nil {
+		scope = make(map[string]bool)
+		s.file = scope
+	}
+	for _, name := range names {
+		scope[name] = true
+	}
+}
+
+// defined reports whether SOURCE_DATE_EPOCH is defined for a section.
+func (s *sourceDateScope) defined(section string) bool {
+	return s.file[sourceDateEpoch] || s.sections[section][sourceDateEpoch]
+}
+
+// derives reports whether a line reads SOURCE_DATE_EPOCH or a variable
+// derived from it in scope.
+func (s *sourceDateScope) derives(line, section string) bool {
+	for _, scope := range []map[string]bool{s.file, s.sections[section]} {
+		for name := range scope {
+			if name != sourceDateEpoch && readsVariable(line, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readsVariable reports whether a line reads a shell, make, or GitHub env
+// variable.
+func readsVariable(line, name string) bool {
+	for _, ref := range []string{"$(" + name, "${" + name, "$" + name, "env." + name} {
+		for i := strings.Index(line, ref); i >= 0; {
+			end := i + len(ref)
+			if end == len(line) || !isNameByte(line[end]) {
+				return true
+			}
+			next := strings.Index(line[end:], ref)
+			if next < 0 {
+				break
+			}
+			i = end + next
+		}
+	}
+	return false
+}
+
+// isNameByte reports whether c can continue a variable name.
+func isNameByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// status classifies a line that embeds a date by how it uses
+// SOURCE_DATE_EPOCH.
+func (s *sourceDateScope) status(line, section string) string {
+	switch {
+	case sourceDateClockValue.MatchString(line):
+		return sourceDateClock
+	case s.derives(line, section):
+		return sourceDateDerived
+	case !strings.Contains(line, sourceDateEpoch):
+		if s.defined(section) {
+			return sourceDateUnused
+		}
+		return sourceDateAbsent
+	case s.defined(section):
+		return sourceDateDerived
+	}
+	return sourceDateUndefined
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestSourceDateScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  configFormat
+		lines   []string
+		section string
+		line    string
+		want    string
+	}{
+		{"absent", formatShell, nil, "", "go build -ldflags \"-X main.date=$(date +%s)\"", sourceDateAbsent},
+		{"exported and derived", formatShell, []string{"export SOURCE_DATE_EPOCH=$(git log -1 --format=%ct)"}, "", `date -u -d "@$SOURCE_DATE_EPOCH"`, sourceDateDerived},
+		{"exported but unused", formatShell, []string{"export SOURCE_DATE_EPOCH=1700000000"}, "", "date -u +%F > VERSION", sourceDateUnused},
+		{"read but undefined", formatShell, nil, "", `date -u -d "@$SOURCE_DATE_EPOCH"`, sourceDateUndefined},
+		{"set from the clock", formatShell, nil, "", "export SOURCE_DATE_EPOCH=$(date +%s)", sourceDateClock},
+		{"make variable derived", formatMakefile, []string{"BUILD_DATE := $(shell date -u -d @$(SOURCE_DATE_EPOCH))", "build:"}, "build", "go build -X main.d=$(BUILD_DATE) -X main.DATE=1", sourceDateDerived},
+		{"other job", formatYAML, []string{"jobs:", "  build:", "    env:", "      SOURCE_DATE_EPOCH: 0", "  stamp:"}, "stamp", "date -d @$SOURCE_DATE_EPOCH", sourceDateUndefined},
+		{"workflow env", formatYAML, []string{"env:", "  SOURCE_DATE_EPOCH: 0", "jobs:", "  stamp:"}, "stamp", "date -d @$SOURCE_DATE_EPOCH", sourceDateDerived},
+		{"dockerfile arg", formatDockerfile, []string{"ARG SOURCE_DATE_EPOCH"}, "", "RUN date -d @${SOURCE_DATE_EPOCH} > /built", sourceDateDerived},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var scope sourceDateScope
+			lines := newFormatClassifier(tt.format)
+			for _, line := range tt.lines {
+				lc := lines.classify(line)
+				scope.observe(line, lc, tt.format, lines.section)
+			}
+			scope.observe(tt.line, contextRunCommand, tt.format, tt.section)
+			if got := scope.status(tt.line, tt.section); got != tt.want {
+				t.Errorf("status(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanSourceDateEpoch(t *testing.T) {
+	dir := filepath.Join(testdataDir(t), "source-date-epoch")
+	client := testClient(t)
+
+	dateFindings := func(workspace string) map[string]string {
+		found := make(map[string]string)
+		for _, f := range findByRule(invokeScan(t, client, filepath.Join(dir, workspace)).GetFindings(), "PROV-003") {
+			if status, ok := f.GetMetadata()["source_date_epoch"]; ok {
+				found[fmt.Sprintf("%s:%d", f.GetLocation().GetFilePath(), f.GetLocation().GetStartLine())] = status
+			}
+		}
+		return found
+	}
+
+	if found := dateFindings("mitigated"); len(found) != 0 {
+		t.Errorf("expected no date findings with SOURCE_DATE_EPOCH in scope, got %v", found)
+	}
+
+	want := map[string]string{
+		"Makefile:1":                       sourceDateAbsent,
+		"Dockerfile:6":                     sourceDateUnused,
+		".github/workflows/release.yml:6":  sourceDateClock,
+		".github/workflows/release.yml:11": sourceDateUndefined,
+	}
+	found := dateFindings("unmitigated")
+	for key, status := range want {
+		if found[key] != status {
+			t.Errorf("%s: source_date_epoch = %q, want %q", key, found[key], status)
+		}
+	}
+	if len(found) != len(want) {
+		t.Errorf("expected %d date findings, got %v", len(want), found)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+)
+
+// sourceRefRuleID flags provenance built from a source ref that
+// allowed_source_refs does not permit.
+const sourceRefRuleID = "PROV-034"
+
+// slsaProvenancePrefix starts the predicate type of every SLSA provenance
+// version.
+const slsaProvenancePrefix = "https://slsa.dev/provenance/"
+
+// gitRef returns the ref after the "@" of a git URI such as
+// git+https://github.com/org/repo@refs/tags/v1.0.0. Commit revisions are
+// not refs.
+func gitRef(uri string) string {
+	i := strings.LastIndex(uri, "@")
+	if i < 0 || !strings.HasPrefix(uri[i+1:], "refs/") {
+		return ""
+	}
+	return uri[i+1:]
+}
+
+// sourceRef returns the git ref the build ran from and the field it was
+// read from: the workflow ref (GitHub Actions) or source URI in v1, the
+// github_ref environment entry or config source URI in v0.2, or the
+// recipe's material in v0.1. Only full refs, starting with "refs/", are
+// returned.
+func (p *slsaPredicate) sourceRef() (ref, field string) {
+	var workflow struct {
+		Ref string `json:"ref"`
+	}
+	if raw, ok := p.BuildDefinition.ExternalParameters["workflow"]; ok {
+		if json.Unmarshal(raw, &workflow) == nil && strings.HasPrefix(workflow.Ref, "refs/") {
+			return workflow.Ref, "buildDefinition.externalParameters.workflow.ref"
+		}
+	}
+	if raw, ok := p.BuildDefinition.ExternalParameters["source"]; ok {
+		var source string
+		if json.Unmarshal(raw, &source) != nil {
+			var desc slsaMaterial
+			if json.Unmarshal(raw, &desc) == nil {
+				source = desc.URI
+			}
+		}
+		if ref := gitRef(source); ref != "" {
+			return ref, "buildDefinition.externalParameters.source"
+		}
+	}
+	var env struct {
+		GitHubRef string `json:"github_ref"`
+	}
+	if len(p.Invocation.Environment) > 0 && json.Unmarshal(p.Invocation.Environment, &env) == nil && strings.HasPrefix(env.GitHubRef, "refs/") {
+		return env.GitHubRef, "invocation.environment.github_ref"
+	}
+	if ref := gitRef(p.Invocation.ConfigSource.URI); ref != "" {
+		return ref, "invocation.configSource.uri"
+	}
+	if m, ok := p.recipeMaterial(); ok {
+		if ref := gitRef(m.URI); ref != "" {
+			return ref, "recipe.definedInMaterial"
+		}
+	}
+	return "", ""
+}
+
+// matchSourceRef returns the first allowed_source_refs pattern matching ref,
+// or "" when none does. Patterns are lowercased globs.
+func matchSourceRef(patterns []string, ref string) string {
+	ref = strings.ToLower(ref)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, ref); ok {
+			return pattern
+		}
+	}
+	return ""
+}
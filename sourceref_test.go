@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestSourceRef(t *testing.T) {
+	tests := []struct {
+		name      string
+		predicate string
+		ref       string
+		field     string
+	}{
+		{
+			"v1 workflow",
+			`{"buildDefinition":{"externalParameters":{"workflow":{"ref":"refs/tags/v1.2.0","repository":"https://github.com/example/app","path":".github/workflows/release.yml"}}}}`,
+			"refs/tags/v1.2.0", "buildDefinition.externalParameters.workflow.ref",
+		},
+		{
+			"v1 source",
+			`{"buildDefinition":{"externalParameters":{"source":{"uri":"git+https://github.com/example/app@refs/heads/main"}}}}`,
+			"refs/heads/main", "buildDefinition.externalParameters.source",
+		},
+		{
+			"v0.2 environment",
+			`{"invocation":{"configSource":{"uri":"git+https://github.com/example/app@refs/heads/main"},"environment":{"github_ref":"refs/heads/feature/x"}}}`,
+			"refs/heads/feature/x", "invocation.environment.github_ref",
+		},
+		{
+			"v0.2 config source",
+			`{"invocation":{"configSource":{"uri":"git+https://github.com/example/app@refs/tags/v2"}}}`,
+			"refs/tags/v2", "invocation.configSource.uri",
+		},
+		{
+			"v0.1 recipe material",
+			`{"recipe":{"definedInMaterial":0},"materials":[{"uri":"git+https://github.com/example/app@refs/heads/main"}]}`,
+			"refs/heads/main", "recipe.definedInMaterial",
+		},
+		{
+			"commit only",
+			`{"invocation":{"configSource":{"uri":"git+https://github.com/example/app@8e5e7e5ab8b370d6c329ec480221332ada57f0ab"}}}`,
+			"", "",
+		},
+	}
+	for _, tt := range tests {
+		var p slsaPredicate
+		if err := json.Unmarshal([]byte(tt.predicate), &p); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if ref, field := p.sourceRef(); ref != tt.ref || field != tt.field {
+			t.Errorf("%s: got (%q, %q), want (%q, %q)", tt.name, ref, field, tt.ref, tt.field)
+		}
+	}
+}
+
+func TestMatchSourceRef(t *testing.T) {
+	patterns := []string{"refs/tags/v*", "refs/heads/main"}
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"refs/tags/v1.0.0", "refs/tags/v*"},
+		{"refs/heads/main", "refs/heads/main"},
+		{"refs/heads/feature/login", ""},
+		{"refs/tags/nightly", ""},
+	}
+	for _, tt := range tests {
+		if got := matchSourceRef(patterns, tt.ref); got != tt.want {
+			t.Errorf("matchSourceRef(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestScanAllowedSourceRefs(t *testing.T) {
+	statement := func(predicate string) string {
+		return `{"_type":"https://in-toto.io/Statement/v1","predicateType":"https://slsa.dev/provenance/v1",` +
+			`"subject":[{"name":"app","digest":{"sha256":"1111111111111111111111111111111111111111111111111111111111111111"}}],` +
+			`"predicate":` + predicate + `}`
+	}
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "release", "provenance.json"), statement(
+		`{"buildDefinition":{"buildType":"https://slsa-framework.github.io/github-actions-buildtypes/workflow/v1","externalParameters":{"workflow":{"ref":"refs/tags/v1.0.0"}}}}`))
+	writeFile(t, filepath.Join(workspace, "feature", "provenance.json"), statement(
+		`{"buildDefinition":{"buildType":"https://slsa-framework.github.io/github-actions-buildtypes/workflow/v1","externalParameters":{"workflow":{"ref":"refs/heads/feature/login"}}}}`))
+	writeFile(t, filepath.Join(workspace, "internal", "provenance.json"), statement(
+		`{"buildDefinition":{"buildType":"https://builds.example.com/internal/v1","externalParameters":{"target":"//app"}}}`))
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root":      workspace,
+		"allowed_source_refs": "refs/tags/v*, refs/heads/main",
+	})
+
+	got := make(map[string]map[string]string)
+	for _, f := range findByRule(resp.GetFindings(), sourceRefRuleID) {
+		meta := f.GetMetadata()
+		meta["severity"] = severityNames[f.GetSeverity()]
+		got[f.GetLocation().GetFilePath()] = meta
+	}
+	if len(got) != 2 || got["release/provenance.json"] != nil {
+		t.Fatalf("expected findings for feature and internal provenance, got %v", got)
+	}
+	if meta := got["feature/provenance.json"]; meta["type"] != "source_ref_not_allowed" || meta["severity"] != "medium" ||
+		meta["source_ref"] != "refs/heads/feature/login" || meta["allowed_source_refs"] != "refs/tags/v*,refs/heads/main" {
+		t.Errorf("unexpected feature finding: %v", meta)
+	}
+	if meta := got["internal/provenance.json"]; meta["type"] != "source_ref_unknown" || meta["severity"] != "low" {
+		t.Errorf("unexpected internal finding: %v", meta)
+	}
+}
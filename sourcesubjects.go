@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sourceSubjectsRuleID flags a statement whose subjects are all source
+// files in the workspace: a checksum list that attests nothing about a
+// build, yet counts as provenance.
+const sourceSubjectsRuleID = "PROV-042"
+
+// maxSourceSubjectSamples caps the subject names a finding lists.
+const maxSourceSubjectSamples = 5
+
+// sourceExts are the extensions of source files, lowercased.
+var sourceExts = map[string]bool{
+	".go": true, ".py": true, ".ts": true, ".tsx": true, ".js": true, ".jsx": true, ".mjs": true,
+	".java": true, ".kt": true, ".scala": true, ".rs": true, ".c": true, ".h": true, ".cc": true,
+	".cpp": true, ".hpp": true, ".cs": true, ".rb": true, ".php": true, ".swift": true, ".m": true,
+	".sh": true, ".proto": true,
+}
+
+// outputDirs are directories build outputs are written to.
+var outputDirs = map[string]bool{"dist": true, "build": true, "bin": true, "out": true, "target": true, "release": true}
+
+// looksLikeBuildOutput reports whether a subject name looks like what a
+// build produces: an image reference, an archive or package, a file in an
+// output directory, or an extensionless binary.
+func looksLikeBuildOutput(name string) bool {
+	if strings.Contains(name, "@sha256:") || strings.HasPrefix(name, "pkg:") {
+		return true
+	}
+	if artifactExt(name) != "" {
+		return true
+	}
+	dir, base := path.Split(name)
+	for _, segment := range strings.Split(strings.Trim(dir, "/"), "/") {
+		if outputDirs[strings.ToLower(segment)] {
+			return true
+		}
+	}
+	return path.Ext(base) == "" || strings.EqualFold(path.Ext(base), ".exe")
+}
+
+// looksLikeSource reports whether a subject name looks like a source file:
+// one with a source extension, or any file under src/.
+func looksLikeSource(name string) bool {
+	if looksLikeBuildOutput(name) {
+		return false
+	}
+	return sourceExts[strings.ToLower(path.Ext(name))] || strings.HasPrefix(name, "src/") || strings.Contains(name, "/src/")
+}
+
+// sourceSubjects returns the subject names of a statement when every one
+// looks like a source file and exists in the workspace at root, or nil.
+func sourceSubjects(fsys workspaceFS, root string, ps *parsedStatement) []string {
+	var names []string
+	for _, subj := range ps.Statement.Subject {
+		name := path.Clean(strings.TrimPrefix(slashName(subj.Name), "./"))
+		if subj.Name == "" || !resolvable(name) || name == ".." || strings.HasPrefix(name, "../") || !looksLikeSource(name) {
+			return nil
+		}
+		info, err := fsys.Stat(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLooksLikeSource(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"main.go", true},
+		{"pkg/api/handler.py", true},
+		{"web/src/index.ts", true},
+		{"src/assets/logo.svg", true},
+		{"dist/main.js", false},
+		{"app_linux_amd64.tar.gz", false},
+		{"myapp", false},
+		{"myapp.exe", false},
+		{"ghcr.io/example/app@sha256:abc", false},
+		{"pkg:npm/left-pad@1.3.0", false},
+		{"README.md", false},
+	}
+	for _, tt := range tests {
+		if got := looksLikeSource(tt.name); got != tt.want {
+			t.Errorf("looksLikeSource(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScanSourceSubjects(t *testing.T) {
+	workspace := filepath.Join(testdataDir(t), "source-subjects")
+	client := testClient(t)
+
+	found := findByRule(invokeScan(t, client, workspace).GetFindings(), sourceSubjectsRuleID)
+	if len(found) != 1 {
+		t.Fatalf("expected one %s finding, got %d", sourceSubjectsRuleID, len(found))
+	}
+	if got := found[0].GetMetadata()["sample_subjects"]; got != "src/main.go,scripts/build.py" {
+		t.Errorf("sample_subjects = %q", got)
+	}
+
+	resp := invokeScanWithInput(t, client, map[string]any{
+		"workspace_root":        workspace,
+		"check_source_subjects": false,
+	})
+	if found := findByRule(resp.GetFindings(), sourceSubjectsRuleID); len(found) != 0 {
+		t.Errorf("expected check_source_subjects=false to disable %s, got %d", sourceSubjectsRuleID, len(found))
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// staleProvenanceRuleID flags a provenance file older than the build configs
+// or artifacts it should cover.
+const staleProvenanceRuleID = "PROV-018"
+
+// defaultStalenessDays is the staleness_days used when the input is unset.
+const defaultStalenessDays = 30
+
+// timestampSourceMtime marks a provenance file dated by its modification
+// time because none of its statements records a build time.
+const timestampSourceMtime = "mtime"
+
+// statementTime is the build time and subjects of one statement, kept for
+// the staleness check.
+type statementTime struct {
+	location string
+	// built is the zero time when the statement records no build time.
+	built    time.Time
+	source   string
+	subjects []string
+}
+
+// recordStatementTime keeps a statement's build time and subject names for
+// the staleness check.
+func (s *scanSummary) recordStatementTime(location string, ps *parsedStatement) {
+	built, source := ps.Predicate.buildTime()
+	st := statementTime{location: location, built: built, source: source}
+	for _, subj := range ps.Statement.Subject {
+		if subj.Name != "" {
+			st.subjects = append(st.subjects, subj.Name)
+		}
+	}
+	s.statementTimes = append(s.statementTimes, st)
+}
+
+// recordBuildConfigTime keeps the most recently modified build config.
+func (s *scanSummary) recordBuildConfigTime(fsys workspaceFS, filePath string) {
+	info, err := fsys.Stat(filePath)
+	if err != nil {
+		return
+	}
+	if modified := info.ModTime(); modified.After(s.newestBuildConfigTime) {
+		s.newestBuildConfig, s.newestBuildConfigTime = filePath, modified
+	}
+}
+
+// mergeStaleness folds the statement and build config times recorded in
+// other into s.
+func (s *scanSummary) mergeStaleness(other *scanSummary) {
+	s.statementTimes = append(s.statementTimes, other.statementTimes...)
+	if other.newestBuildConfigTime.After(s.newestBuildConfigTime) {
+		s.newestBuildConfig, s.newestBuildConfigTime = other.newestBuildConfig, other.newestBuildConfigTime
+	}
+}
+
+// staleInput is a build config or artifact modified after a provenance file
+// was produced.
+type staleInput struct {
+	path     string
+	kind     string
+	modified time.Time
+}
+
+// reportStaleProvenance reports provenance files that predate, by more than
+// window, the newest build config or an artifact named by one of their
+// subjects. A file is dated by the newest build time its statements record,
+// or by its modification time when none does.
+//
+// A fresh checkout gives every tracked file the checkout time, so a build
+// config counts only if it is also newer than the provenance file itself.
+// Artifacts are usually built rather than checked out, so they are compared
+// with the build time alone. Artifacts are found by subject name below the
+// workspace root and by base name beside the provenance file. Provenance
+// that is not a workspace file, such as an archive entry, is not checked.
+func reportStaleProvenance(findings *findingSet, summary *scanSummary, window time.Duration) {
+	type provenanceFile struct {
+		built    time.Time
+		source   string
+		subjects []string
+	}
+	files := make(map[string]*provenanceFile)
+	for _, st := range summary.statementTimes {
+		f := files[st.location]
+		if f == nil {
+			f = &provenanceFile{}
+			files[st.location] = f
+		}
+		if st.built.After(f.built) {
+			f.built, f.source = st.built, st.source
+		}
+		f.subjects = append(f.subjects, st.subjects...)
+	}
+
+	for _, location := range sortedKeys(files) {
+		info, err := findings.files().Stat(location)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		f := files[location]
+		attested, source := f.built, f.source
+		if attested.IsZero() {
+			attested, source = info.ModTime(), timestampSourceMtime
+		}
+
+		// An artifact newer than the build is stronger evidence than an
+		// edited build config, so it is reported in preference.
+		var newest *staleInput
+		severity := sdk.SeverityMedium
+		for _, candidate := range subjectArtifacts(findings.files(), findings.root, location, f.subjects) {
+			if candidate.modified.Sub(attested) > window && (newest == nil || candidate.modified.After(newest.modified)) {
+				c := candidate
+				newest = &c
+			}
+		}
+		if newest == nil && summary.newestBuildConfig != "" {
+			since := attested
+			if info.ModTime().After(since) {
+				since = info.ModTime()
+			}
+			if summary.newestBuildConfigTime.Sub(since) > window {
+				newest = &staleInput{summary.newestBuildConfig, "build_config", summary.newestBuildConfigTime}
+				severity = sdk.SeverityLow
+			}
+		}
+		if newest == nil {
+			continue
+		}
+
+		confidence := sdk.ConfidenceMedium
+		if source == timestampSourceMtime {
+			confidence = sdk.ConfidenceLow
+		}
+		days := int(newest.modified.Sub(attested) / (24 * time.Hour))
+		findings.Finding(
+			staleProvenanceRuleID,
+			severity,
+			confidence,
+			fmt.Sprintf("Provenance predates %s by %d days; it may not describe the current build",
+				workspacePath(findings.root, newest.path), days),
+		).
+			At(location, 0, 0).
+			WithMetadata("type", "stale_provenance").
+			WithMetadata("timestamp_source", source).
+			WithMetadata("attested_at", attested.UTC().Format(time.RFC3339)).
+			WithMetadata("newer_input", workspacePath(findings.root, newest.path)).
+			WithMetadata("newer_input_kind", newest.kind).
+			WithMetadata("newer_input_modified", newest.modified.UTC().Format(time.RFC3339)).
+			WithMetadata("staleness_days", strconv.Itoa(days)).
+			WithMetadata("staleness_window_days", strconv.Itoa(int(window/(24*time.Hour)))).
+			Done()
+	}
+}
+
+// subjectArtifacts returns the regular files the subjects of a provenance
+// file name, with their modification times.
+func subjectArtifacts(fsys workspaceFS, root, location string, subjects []string) []staleInput {
+	seen := make(map[string]bool)
+	var artifacts []staleInput
+	for _, name := range subjects {
+		slashed := slashName(name)
+		candidates := []string{filepath.Join(filepath.Dir(location), path.Base(slashed))}
+		if clean := path.Clean(slashed); root != "" && !path.IsAbs(clean) && clean != ".." && !strings.HasPrefix(clean, "../") {
+			candidates = append(candidates, filepath.Join(root, filepath.FromSlash(clean)))
+		}
+		for _, candidate := range candidates {
+			if seen[candidate] || candidate == location {
+				continue
+			}
+			seen[candidate] = true
+			info, err := fsys.Stat(candidate)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			artifacts = append(artifacts, staleInput{candidate, "artifact", info.ModTime()})
+		}
+	}
+	return artifacts
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// timedStatement builds a statement for subject app that finished building
+// at finished, or records no build time when finished is zero.
+func timedStatement(finished time.Time) string {
+	if finished.IsZero() {
+		return testStatement
+	}
+	return strings.Replace(testStatement, `"materials"`,
+		`"metadata":{"buildFinishedOn":"`+finished.UTC().Format(time.RFC3339)+`"},"materials"`, 1)
+}
+
+// touch sets the modification time of a file.
+func touch(t *testing.T, path string, modified time.Time) {
+	t.Helper()
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanStaleProvenance(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-240 * 24 * time.Hour)
+
+	tests := []struct {
+		name string
+		// finished is the statement's build time, zero for none.
+		finished time.Time
+		// provenance, makefile, and artifact are modification times; a zero
+		// artifact time means no artifact exists.
+		provenance, makefile, artifact time.Time
+		input                          map[string]any
+
+		wantSeverity   pluginv1.Severity
+		wantConfidence pluginv1.Confidence
+		wantInput      string
+		wantSource     string
+	}{
+		{
+			name:     "fresh",
+			finished: now, provenance: now, makefile: now, artifact: now,
+		},
+		{
+			name:     "artifact rebuilt after the build",
+			finished: old, provenance: now, makefile: now, artifact: now,
+			wantSeverity: sdk.SeverityMedium, wantConfidence: sdk.ConfidenceMedium,
+			wantInput: "dist/app", wantSource: "buildFinishedOn",
+		},
+		{
+			name:     "build config edited after the build",
+			finished: old, provenance: old, makefile: now,
+			wantSeverity: sdk.SeverityLow, wantConfidence: sdk.ConfidenceMedium,
+			wantInput: "Makefile", wantSource: "buildFinishedOn",
+		},
+		{
+			// A fresh checkout dates every tracked file alike.
+			name:     "checked out together",
+			finished: old, provenance: now, makefile: now,
+		},
+		{
+			name:       "mtime fallback",
+			provenance: old, makefile: now,
+			wantSeverity: sdk.SeverityLow, wantConfidence: sdk.ConfidenceLow,
+			wantInput: "Makefile", wantSource: "mtime",
+		},
+		{
+			name:     "within the window",
+			finished: now.Add(-20 * 24 * time.Hour), provenance: now, makefile: now, artifact: now,
+		},
+		{
+			name:     "narrower window",
+			finished: now.Add(-20 * 24 * time.Hour), provenance: now, makefile: now, artifact: now,
+			input:        map[string]any{"staleness_days": 7},
+			wantSeverity: sdk.SeverityMedium, wantConfidence: sdk.ConfidenceMedium,
+			wantInput: "dist/app", wantSource: "buildFinishedOn",
+		},
+		{
+			name:     "disabled",
+			finished: old, provenance: now, makefile: now, artifact: now,
+			input: map[string]any{"staleness_days": 0},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			provenance := filepath.Join(workspace, "dist", "provenance.json")
+			makefile := filepath.Join(workspace, "Makefile")
+			writeFile(t, provenance, timedStatement(tc.finished))
+			writeFile(t, makefile, "build:\n\tgo build -o dist/app .\n")
+			touch(t, provenance, tc.provenance)
+			touch(t, makefile, tc.makefile)
+			if !tc.artifact.IsZero() {
+				artifact := filepath.Join(workspace, "dist", "app")
+				writeFile(t, artifact, "binary")
+				touch(t, artifact, tc.artifact)
+			}
+
+			input := map[string]any{"workspace_root": workspace}
+			for k, v := range tc.input {
+				input[k] = v
+			}
+			resp := invokeScanWithInput(t, testClient(t), input)
+
+			found := findByRule(resp.GetFindings(), staleProvenanceRuleID)
+			if tc.wantInput == "" {
+				if len(found) != 0 {
+					t.Fatalf("expected no %s findings, got %v", staleProvenanceRuleID, found[0].GetMetadata())
+				}
+				return
+			}
+			if len(found) != 1 {
+				t.Fatalf("expected 1 %s finding, got %d", staleProvenanceRuleID, len(found))
+			}
+			f := found[0]
+			meta := f.GetMetadata()
+			if f.GetSeverity() != tc.wantSeverity || f.GetConfidence() != tc.wantConfidence {
+				t.Errorf("severity/confidence = %v/%v, want %v/%v", f.GetSeverity(), f.GetConfidence(), tc.wantSeverity, tc.wantConfidence)
+			}
+			if meta["newer_input"] != tc.wantInput || meta["timestamp_source"] != tc.wantSource {
+				t.Errorf("newer_input = %q, timestamp_source = %q; want %q, %q",
+					meta["newer_input"], meta["timestamp_source"], tc.wantInput, tc.wantSource)
+			}
+			if f.GetLocation().GetFilePath() != "dist/provenance.json" {
+				t.Errorf("finding at %q, want dist/provenance.json", f.GetLocation().GetFilePath())
+			}
+		})
+	}
+}
+
+func TestScanInvalidStalenessDays(t *testing.T) {
+	input, err := structpb.NewStruct(map[string]any{
+		"workspace_root": t.TempDir(),
+		"staleness_days": -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = testClient(t).InvokeTool(context.Background(), &pluginv1.InvokeToolRequest{
+		ToolName: "scan",
+		Input:    input,
+	})
+	if err == nil {
+		t.Fatal("expected an error for negative staleness_days")
+	}
+}
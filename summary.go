@@ -0,0 +1,498 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// summaryRuleID identifies the informational finding that carries scan
+// summary metadata. It is emitted once per scan of a workspace.
+const summaryRuleID = "PROV-000"
+
+// scanSummary records what a scan walked and analyzed, so that a clean result
+// can be told apart from a scan that covered nothing.
+type scanSummary struct {
+	filesWalked      int
+	provenanceFiles  int
+	buildConfigFiles int
+	ciConfigFiles    int
+	actionFiles      int
+	statementsParsed int
+	parseFailures    int
+	dirsSkipped      int
+	dirsIgnored      int
+	depthPruned      int
+	filesIgnored     int
+	walkErrors       int
+	filesOversized   int
+	binarySkipped    int
+	symlinksFollowed int
+	danglingSymlinks int
+	duplicateFiles   int
+	filesUnreadable  int
+	// analyzerFailures counts the analyzer runs on a file that failed or
+	// panicked.
+	analyzerFailures int
+	// filesOverBudget counts files whose analysis was abandoned at the
+	// per-file time budget.
+	filesOverBudget int
+	// kindsAnalyzed holds the categories of the files handed to the
+	// analyzers, and kindsLimited those of files skipped at max_file_size
+	// or abandoned at the time budget; both feed the coverage section.
+	kindsAnalyzed fileKind
+	kindsLimited  fileKind
+	// coverage is the outcome of each rule family, set once the workspace
+	// checks are done.
+	coverage []familyCoverage
+	// attestationFiles counts provenance files that were read and look like
+	// attestations; nonAttestationFiles counts those that share a provenance
+	// file name but hold some other JSON document.
+	attestationFiles    int
+	nonAttestationFiles int
+	// inaccessibleDirs lists workspace-relative directories that could not
+	// be listed.
+	inaccessibleDirs []string
+	// slsaLevels maps each subject name to the lowest estimated SLSA build
+	// level of the statements naming it; minSLSALevel is the lowest level of
+	// any statement, valid once slsaRecorded is set.
+	slsaLevels   map[string]int
+	minSLSALevel int
+	slsaRecorded bool
+
+	// imageRefs and attestedDigests feed image attestation correlation once
+	// every file has been analyzed.
+	imageRefs        []imageRef
+	attestedDigests  map[string]bool
+	imagesAttested   int
+	templatesSkipped int
+
+	// sbomFiles, sbomAttestations, and sbomSteps count SBOM documents, SBOM
+	// attestation statements, and SBOM-generating build steps.
+	sbomFiles        int
+	sbomAttestations int
+	sbomSteps        int
+
+	// lockEntries maps dependency keys to the lockfile entries pinning them;
+	// statementMaterials holds the dependency materials of each statement.
+	// Both feed the lockfile cross-check.
+	lockEntries        map[string]lockEntry
+	statementMaterials []statementMaterials
+
+	// imagePolicies, signingSteps, verificationKeys, and verifySteps record
+	// signing and downstream verification infrastructure.
+	imagePolicies    []imagePolicy
+	signingSteps     []signingStep
+	verificationKeys int
+	verifySteps      int
+
+	// publishSteps records the commands that publish artifacts.
+	publishSteps []publishStep
+
+	// production counts the walked files that show whether the workspace
+	// produces artifacts; buildCommands counts the commands building them,
+	// makeTargets holds the Makefile targets with recipes by "path#target",
+	// and manifestPaths the package manifests read to classify libraries.
+	production    productionEvidence
+	buildCommands int
+	makeTargets   map[string]string
+	manifestPaths []string
+
+	// checksumGaps records release mechanisms that publish no checksums;
+	// attestationSteps counts the steps generating attestations, which make
+	// checksums redundant.
+	checksumGaps     []checksumGap
+	attestationSteps int
+
+	// scriptRefs holds the scripts invoked by build and CI commands, waiting
+	// to be followed; scriptsFollowed counts those scanned and scriptsCapped
+	// records that maxFollowedScripts was reached.
+	scriptRefs      []scriptRef
+	scriptsFollowed int
+	scriptsCapped   bool
+
+	// workflowCaches holds the actions/cache steps of every workflow, for
+	// the cross-workflow cache check.
+	workflowCaches []workflowCache
+
+	// ciPins counts the actions and components CI configs reference, by
+	// how they are pinned.
+	ciPins ciPinStats
+
+	// pypiAttestations holds the PEP 740 statements checked against dist/
+	// and the git origin.
+	pypiAttestations []pypiAttestation
+
+	// workflowIdentities holds the GitHub workflows statements claim they
+	// were built by, checked against the git remote and workflow files.
+	workflowIdentities []workflowIdentity
+
+	// dormantWorkflows holds the workflows that attest or sign artifacts
+	// yet run only by hand or on filtered events, checked against the
+	// repository's branches and files.
+	dormantWorkflows []dormantWorkflow
+
+	// vendoredBinaries holds the committed files recognized as compiled
+	// code, checked against the build configs that may use them.
+	vendoredBinaries []vendoredBinary
+
+	// signingStyles maps each workflow that signs to how it does so.
+	signingStyles map[string]string
+
+	// sourceRevisions holds the commits statements pin, looked up in the
+	// workspace's git object store.
+	sourceRevisions []sourceRevision
+
+	// archives and subjectRecords feed archive subject verification;
+	// attestationPaths, the attestation files walked, feed the pairing of
+	// attestations with the artifacts they are named for.
+	attestationPaths    []string
+	archives            []archiveRecord
+	subjectRecords      []subjectRecord
+	archivesScanned     int
+	archivesTruncated   int
+	archiveAttestations int
+	archiveImages       int
+	subjectsVerified    int
+	// checksumCovered holds the workspace paths of artifacts verified
+	// against an attested checksums file, and checksumArtifactsVerified
+	// counts them.
+	checksumCovered           map[string]bool
+	checksumArtifactsVerified int
+
+	// imageIndexes maps the digests of multi-platform image indexes found in
+	// archives to their manifests; multiPlatformBuilds records the configs
+	// building images for several platforms.
+	imageIndexes        map[string]imageIndex
+	multiPlatformBuilds []multiPlatformBuild
+
+	// claims holds each statement's build claims for the conflicting
+	// attestation check; conflictingLocations records the provenance files
+	// it reported.
+	claims               []statementClaims
+	conflictingLocations map[string]bool
+
+	// confirmations holds the provenance files whose statements all passed
+	// their checks.
+	confirmations []provenanceConfirmation
+
+	// statementTimes and the newest build config feed the staleness check.
+	statementTimes        []statementTime
+	newestBuildConfig     string
+	newestBuildConfigTime time.Time
+
+	// builders counts parsed statements by normalized builder ID;
+	// trustedBuilders holds the trusted_builders prefixes they are checked
+	// against, nil when the input is unset.
+	builders        map[string]int
+	trustedBuilders []string
+
+	// envDefaults lists the environment defaults the scan used, as
+	// "name=value" pairs.
+	envDefaults []string
+
+	// workspaceArchive is the archive the workspace was read from, if any,
+	// and archiveLinksSkipped the link entries in it that were not
+	// resolved.
+	workspaceArchive    string
+	archiveLinksSkipped int
+
+	// incremental is set when only changed_files were scanned;
+	// changedFiles counts the listed files and changedFilesMissing those
+	// absent from the workspace, as when deleted.
+	incremental         bool
+	changedFiles        int
+	changedFilesMissing int
+
+	// dependencyBots records the update bots configured in the workspace;
+	// pinManagers maps each ecosystem to the bots maintaining its digest
+	// pins.
+	dependencyBots map[string]bool
+	pinManagers    map[string]map[string]bool
+
+	// collectMetrics enables the metric_ metadata. phases accumulates the
+	// time spent per scan phase; bytesRead, linesTruncated, and
+	// findingsCapped count the bytes of analyzed files, build files whose
+	// scan stopped at an overlong line, and findings folded into a collapsed
+	// one.
+	collectMetrics bool
+	phases         map[string]time.Duration
+	bytesRead      int64
+	linesTruncated int
+	findingsCapped int
+
+	// lastPath is the most recently walked file, recording how far an
+	// interrupted walk got.
+	lastPath string
+	// interrupted is the context error that cut the scan short, if any.
+	interrupted error
+	elapsed     time.Duration
+	// gate is the fail_on_severity outcome, nil when gating is disabled.
+	gate *gateResult
+}
+
+// merge folds the summary a worker recorded while analyzing one file into
+// s, which must be guarded by the pool's lock. Analyzers only write the
+// worker's summary, so every field they record is merged here; the fields
+// the walk and the scan handler write directly are left alone.
+func (s *scanSummary) merge(other *scanSummary) {
+	s.statementsParsed += other.statementsParsed
+	s.parseFailures += other.parseFailures
+	s.binarySkipped += other.binarySkipped
+	s.filesUnreadable += other.filesUnreadable
+	s.analyzerFailures += other.analyzerFailures
+	s.filesOverBudget += other.filesOverBudget
+	s.kindsLimited |= other.kindsLimited
+	s.attestationFiles += other.attestationFiles
+	s.nonAttestationFiles += other.nonAttestationFiles
+	s.sbomAttestations += other.sbomAttestations
+	s.sbomSteps += other.sbomSteps
+	s.mergeSLSALevels(other)
+	s.mergeBuilders(other)
+	s.mergeImages(other)
+	s.mergeLockfiles(other)
+	s.mergeVerification(other)
+	s.mergeArchives(other)
+	s.mergeImageIndexes(other)
+	s.mergePinning(other)
+	s.mergeStaleness(other)
+	s.mergeMetrics(other)
+	s.mergeProduction(other)
+	s.publishSteps = append(s.publishSteps, other.publishSteps...)
+	s.checksumGaps = append(s.checksumGaps, other.checksumGaps...)
+	s.attestationSteps += other.attestationSteps
+	s.scriptRefs = append(s.scriptRefs, other.scriptRefs...)
+	s.claims = append(s.claims, other.claims...)
+	s.workflowCaches = append(s.workflowCaches, other.workflowCaches...)
+	s.ciPins.merge(other.ciPins)
+	s.pypiAttestations = append(s.pypiAttestations, other.pypiAttestations...)
+	s.workflowIdentities = append(s.workflowIdentities, other.workflowIdentities...)
+	s.dormantWorkflows = append(s.dormantWorkflows, other.dormantWorkflows...)
+	s.vendoredBinaries = append(s.vendoredBinaries, other.vendoredBinaries...)
+	for rel, style := range other.signingStyles {
+		if s.signingStyles == nil {
+			s.signingStyles = make(map[string]string)
+		}
+		s.signingStyles[rel] = style
+	}
+	s.sourceRevisions = append(s.sourceRevisions, other.sourceRevisions...)
+	s.confirmations = append(s.confirmations, other.confirmations...)
+}
+
+// emit adds the summary as an informational finding anchored at the
+// workspace root.
+func (s *scanSummary) emit(findings *findingSet, workspaceRoot string) {
+	fb := findings.Finding(
+		summaryRuleID,
+		sdk.SeverityInfo,
+		sdk.ConfidenceHigh,
+		fmt.Sprintf("Provenance scan summary: %d files walked, %d provenance files, %d build configs, %d CI configs",
+			s.filesWalked, s.provenanceFiles, s.buildConfigFiles, s.ciConfigFiles),
+	).
+		At(workspaceRoot, 0, 0).
+		WithMetadata("type", "scan_summary").
+		WithMetadata("workspace_root", workspaceRoot).
+		WithMetadata("files_walked", strconv.Itoa(s.filesWalked)).
+		WithMetadata("provenance_files_scanned", strconv.Itoa(s.provenanceFiles)).
+		WithMetadata("build_config_files_scanned", strconv.Itoa(s.buildConfigFiles)).
+		WithMetadata("ci_config_files_scanned", strconv.Itoa(s.ciConfigFiles)).
+		WithMetadata("action_files_scanned", strconv.Itoa(s.actionFiles)).
+		WithMetadata("images_found", strconv.Itoa(len(s.imageRefs))).
+		WithMetadata("images_attested", strconv.Itoa(s.imagesAttested)).
+		WithMetadata("templates_skipped", strconv.Itoa(s.templatesSkipped)).
+		WithMetadata("sbom_files", strconv.Itoa(s.sbomFiles)).
+		WithMetadata("sbom_attestations", strconv.Itoa(s.sbomAttestations)).
+		WithMetadata("sbom_steps", strconv.Itoa(s.sbomSteps)).
+		WithMetadata("image_policies", strconv.Itoa(len(s.imagePolicies))).
+		WithMetadata("verification_keys", strconv.Itoa(s.verificationKeys)).
+		WithMetadata("verify_steps", strconv.Itoa(s.verifySteps)).
+		WithMetadata("signing_steps", strconv.Itoa(len(s.signingSteps))).
+		WithMetadata("publish_steps", strconv.Itoa(len(s.publishSteps))).
+		WithMetadata("scripts_followed", strconv.Itoa(s.scriptsFollowed)).
+		WithMetadata("scripts_capped", strconv.FormatBool(s.scriptsCapped)).
+		WithMetadata("archives_scanned", strconv.Itoa(s.archivesScanned)).
+		WithMetadata("archives_truncated", strconv.Itoa(s.archivesTruncated)).
+		WithMetadata("archive_attestations", strconv.Itoa(s.archiveAttestations)).
+		WithMetadata("archive_images", strconv.Itoa(s.archiveImages)).
+		WithMetadata("subjects_verified", strconv.Itoa(s.subjectsVerified)).
+		WithMetadata("checksum_artifacts_verified", strconv.Itoa(s.checksumArtifactsVerified)).
+		WithMetadata("lockfile_entries", strconv.Itoa(len(s.lockEntries))).
+		WithMetadata("ci_references", strconv.Itoa(s.ciPins.total)).
+		WithMetadata("ci_references_sha_pinned", strconv.Itoa(s.ciPins.sha)).
+		WithMetadata("ci_references_tag_pinned", strconv.Itoa(s.ciPins.tag)).
+		WithMetadata("ci_references_branch_pinned", strconv.Itoa(s.ciPins.branch)).
+		WithMetadata("builders", s.observedBuilders()).
+		WithMetadata("builder_count", strconv.Itoa(len(s.builders))).
+		WithMetadata("dependency_bots", strings.Join(sortedKeys(s.dependencyBots), ",")).
+		WithMetadata("docker_pins_managed_by", s.pinsManagedBy(pinEcosystemDocker)).
+		WithMetadata("action_pins_managed_by", s.pinsManagedBy(pinEcosystemActions)).
+		WithMetadata("non_attestation_files", strconv.Itoa(s.nonAttestationFiles)).
+		WithMetadata("statements_parsed", strconv.Itoa(s.statementsParsed)).
+		WithMetadata("parse_failures", strconv.Itoa(s.parseFailures)).
+		WithMetadata("dirs_skipped", strconv.Itoa(s.dirsSkipped)).
+		WithMetadata("dirs_ignored", strconv.Itoa(s.dirsIgnored)).
+		WithMetadata("depth_pruned", strconv.Itoa(s.depthPruned)).
+		WithMetadata("files_ignored", strconv.Itoa(s.filesIgnored)).
+		WithMetadata("walk_errors", strconv.Itoa(s.walkErrors)).
+		WithMetadata("files_oversized", strconv.Itoa(s.filesOversized)).
+		WithMetadata("binary_files_skipped", strconv.Itoa(s.binarySkipped)).
+		WithMetadata("symlinks_followed", strconv.Itoa(s.symlinksFollowed)).
+		WithMetadata("dangling_symlinks", strconv.Itoa(s.danglingSymlinks)).
+		WithMetadata("duplicate_files_skipped", strconv.Itoa(s.duplicateFiles)).
+		WithMetadata("unreadable_files", strconv.Itoa(s.filesUnreadable)).
+		WithMetadata("analyzer_failures", strconv.Itoa(s.analyzerFailures)).
+		WithMetadata("files_over_time_budget", strconv.Itoa(s.filesOverBudget)).
+		WithMetadata("inaccessible_dirs", strconv.Itoa(len(s.inaccessibleDirs))).
+		WithMetadata("elapsed_ms", strconv.FormatInt(s.elapsed.Milliseconds(), 10))
+
+	if s.coverage != nil {
+		fb.WithMetadata("coverage", formatCoverage(s.coverage))
+	}
+	if len(s.signingStyles) > 0 {
+		fb.WithMetadata("signing_styles", formatSigningStyles(s.signingStyles))
+	}
+	if findings.owners != nil {
+		counts, unowned := findings.ownerCounts()
+		fb.WithMetadata("codeowners", findings.owners.path).
+			WithMetadata("findings_by_owner", formatOwnerCounts(counts)).
+			WithMetadata("unowned_findings", strconv.Itoa(unowned))
+	}
+	fb.WithMetadata("partial", strconv.FormatBool(s.interrupted != nil))
+	if s.interrupted != nil {
+		reason := "canceled"
+		if errors.Is(s.interrupted, context.DeadlineExceeded) {
+			reason = "deadline_exceeded"
+		}
+		fb.WithMetadata("partial_reason", reason)
+		if s.lastPath != "" {
+			fb.WithMetadata("walked_through", slashRel(workspaceRoot, s.lastPath))
+		}
+	}
+
+	if s.slsaRecorded {
+		fb.WithMetadata("slsa_level_min", strconv.Itoa(s.minSLSALevel))
+		artifacts := make([]string, 0, len(s.slsaLevels))
+		for _, name := range sortedKeys(s.slsaLevels) {
+			artifacts = append(artifacts, fmt.Sprintf("%s=%d", name, s.slsaLevels[name]))
+		}
+		fb.WithMetadata("slsa_levels", strings.Join(artifacts, ","))
+	}
+
+	if s.trustedBuilders != nil {
+		untrusted := s.untrustedBuilders(s.trustedBuilders)
+		fb.WithMetadata("untrusted_builders", strings.Join(untrusted, ",")).
+			WithMetadata("untrusted_builder_count", strconv.Itoa(len(untrusted)))
+	}
+
+	if len(s.envDefaults) > 0 {
+		fb.WithMetadata("env_defaults", strings.Join(s.envDefaults, ";"))
+	}
+
+	if s.workspaceArchive != "" {
+		fb.WithMetadata("workspace_archive", s.workspaceArchive).
+			WithMetadata("archive_links_skipped", strconv.Itoa(s.archiveLinksSkipped))
+	}
+
+	if s.incremental {
+		fb.WithMetadata("incremental", "true").
+			WithMetadata("changed_files", strconv.Itoa(s.changedFiles)).
+			WithMetadata("changed_files_missing", strconv.Itoa(s.changedFilesMissing))
+	}
+
+	if len(s.inaccessibleDirs) > 0 {
+		dirs := append([]string(nil), s.inaccessibleDirs...)
+		sort.Strings(dirs)
+		fb.WithMetadata("inaccessible_dir_paths", strings.Join(dirs, ","))
+	}
+
+	if s.collectMetrics {
+		s.emitMetrics(fb, findings)
+	}
+
+	if s.gate != nil {
+		status := "passed"
+		if s.gate.failed() {
+			status = "failed"
+		}
+		fb.WithMetadata("gate_threshold", s.gate.threshold).
+			WithMetadata("gate_status", status).
+			WithMetadata("gate_violations", strconv.Itoa(s.gate.violations)).
+			WithMetadata("gate_suppressed", strconv.Itoa(s.gate.suppressed))
+	}
+
+	fb.Done()
+}
+
+// recordSLSALevel records the estimated SLSA build level of a statement for
+// its subjects and the workspace minimum.
+func (s *scanSummary) recordSLSALevel(ps *parsedStatement, level int) {
+	for _, subj := range ps.Statement.Subject {
+		if subj.Name != "" {
+			s.recordArtifactLevel(subj.Name, level)
+		}
+	}
+	s.recordMinLevel(level)
+}
+
+// mergeSLSALevels folds the levels recorded in other into s.
+func (s *scanSummary) mergeSLSALevels(other *scanSummary) {
+	if !other.slsaRecorded {
+		return
+	}
+	for name, level := range other.slsaLevels {
+		s.recordArtifactLevel(name, level)
+	}
+	s.recordMinLevel(other.minSLSALevel)
+}
+
+// recordArtifactLevel keeps the lowest level seen for an artifact.
+func (s *scanSummary) recordArtifactLevel(name string, level int) {
+	if s.slsaLevels == nil {
+		s.slsaLevels = make(map[string]int)
+	}
+	if current, ok := s.slsaLevels[name]; !ok || level < current {
+		s.slsaLevels[name] = level
+	}
+}
+
+// recordMinLevel keeps the lowest level seen for any statement.
+func (s *scanSummary) recordMinLevel(level int) {
+	if !s.slsaRecorded || level < s.minSLSALevel {
+		s.minSLSALevel = level
+	}
+	s.slsaRecorded = true
+}
+
+// recordSubjectDigests records the sha256 digests of a statement's subjects
+// for image correlation.
+func (s *scanSummary) recordSubjectDigests(ps *parsedStatement) {
+	for _, subj := range ps.Statement.Subject {
+		hex := subj.Digest["sha256"]
+		if hex == "" {
+			continue
+		}
+		if s.attestedDigests == nil {
+			s.attestedDigests = make(map[string]bool)
+		}
+		s.attestedDigests["sha256:"+strings.ToLower(hex)] = true
+	}
+}
+
+// mergeImages folds the image references and subject digests recorded in
+// other into s.
+func (s *scanSummary) mergeImages(other *scanSummary) {
+	s.imageRefs = append(s.imageRefs, other.imageRefs...)
+	s.templatesSkipped += other.templatesSkipped
+	for digest := range other.attestedDigests {
+		if s.attestedDigests == nil {
+			s.attestedDigests = make(map[string]bool)
+		}
+		s.attestedDigests[digest] = true
+	}
+}
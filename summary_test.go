@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+// unmergedSummaryFields are the scanSummary fields that analyzers never
+// write: the walk, the scan handler, and the workspace checks record them
+// on the shared summary directly, outside the pool.
+var unmergedSummaryFields = map[string]bool{
+	// Written by the walk.
+	"filesWalked": true, "provenanceFiles": true, "buildConfigFiles": true, "ciConfigFiles": true,
+	"actionFiles": true, "dirsSkipped": true, "dirsIgnored": true, "depthPruned": true,
+	"filesIgnored": true, "walkErrors": true, "filesOversized": true, "symlinksFollowed": true,
+	"danglingSymlinks": true, "duplicateFiles": true, "kindsAnalyzed": true, "inaccessibleDirs": true,
+	"sbomFiles": true, "manifestPaths": true, "changedFiles": true, "changedFilesMissing": true,
+	"production": true, "lastPath": true,
+	// Written by the workspace checks once the pool is drained.
+	"subjectsVerified": true, "checksumCovered": true, "checksumArtifactsVerified": true,
+	"conflictingLocations": true,
+	// Written by the scan handler and script following.
+	"coverage": true, "imagesAttested": true, "scriptsFollowed": true, "scriptsCapped": true,
+	"trustedBuilders": true, "envDefaults": true, "workspaceArchive": true, "archiveLinksSkipped": true,
+	"incremental": true, "collectMetrics": true, "interrupted": true, "elapsed": true, "gate": true,
+}
+
+// fillValue sets v, and everything it holds, to a non-zero value.
+func fillValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Slice:
+		s := reflect.MakeSlice(v.Type(), 1, 1)
+		fillValue(s.Index(0))
+		v.Set(s)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		key, elem := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fillValue(key)
+		fillValue(elem)
+		m.SetMapIndex(key, elem)
+		v.Set(m)
+	case reflect.Pointer:
+		p := reflect.New(v.Type().Elem())
+		fillValue(p.Elem())
+		v.Set(p)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			fillValue(reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem())
+		}
+	}
+}
+
+func TestScanSummaryMergeCoversWorkerFields(t *testing.T) {
+	var local scanSummary
+	fillValue(reflect.ValueOf(&local).Elem())
+
+	var merged scanSummary
+	merged.merge(&local)
+
+	v := reflect.ValueOf(merged)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		switch set := !v.Field(i).IsZero(); {
+		case unmergedSummaryFields[name] && set:
+			t.Errorf("merge writes %s, which the walk or scan handler owns", name)
+		case !unmergedSummaryFields[name] && !set:
+			t.Errorf("merge drops %s; merge it, or list it in unmergedSummaryFields if analyzers never write it", name)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+package provenance
+
+# Statements must come from the hosted GitHub Actions runner.
+deny contains msg if {
+	input.statement.predicate.builder.id != "https://github.com/actions/runner"
+	msg := sprintf("builder %s is not the hosted runner", [input.statement.predicate.builder.id])
+}
@@ -0,0 +1,11 @@
+package provenance
+
+internal_build_type := "https://builds.example.com/internal/v1"
+
+deny_build_type contains {"msg": sprintf("buildType %s is not the internal builder", [input.statement.predicate.buildType])} if {
+	input.statement.predicate.buildType != internal_build_type
+}
+
+deny_environment contains "externalParameters.environment must be production" if {
+	object.get(input.statement.predicate, ["externalParameters", "environment"], "") != "production"
+}
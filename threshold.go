@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// attestationThresholdRuleID flags subjects attested by fewer independent
+// builders than min_attestations_per_subject requires.
+const attestationThresholdRuleID = "PROV-032"
+
+// defaultMinAttestationsPerSubject is the min_attestations_per_subject used
+// when the input is unset; one attestation is all a scan requires.
+const defaultMinAttestationsPerSubject = 1
+
+// reportAttestationThreshold reports subject digests attested by fewer than
+// required independent attestations. Attestations are independent when their
+// normalized builder IDs differ; statements without a builder ID or without
+// a signature do not count. Digests attested by the same statements, such as
+// the sha256 and sha512 of one subject, are reported together.
+func reportAttestationThreshold(findings *findingSet, summary *scanSummary, required int) {
+	byDigest := summary.claimsByDigest()
+
+	reported := make(map[string]bool)
+	for _, digest := range sortedKeys(byDigest) {
+		indices := byDigest[digest]
+		key := fmt.Sprint(indices)
+		if reported[key] {
+			continue
+		}
+		reported[key] = true
+
+		builders := make(map[string]bool)
+		unsigned := 0
+		for _, i := range indices {
+			c := &summary.claims[i]
+			if !c.signed {
+				unsigned++
+				continue
+			}
+			if c.builder != "" {
+				builders[normalizeBuilderID(c.builder)] = true
+			}
+		}
+		if len(builders) >= required {
+			continue
+		}
+
+		var files []string
+		for _, i := range indices {
+			files = append(files, summary.claims[i].label(findings.root))
+		}
+		first := &summary.claims[indices[0]]
+		subject := first.subjects[digest]
+		if subject == "" {
+			subject = digest
+		}
+		fb := findings.Finding(
+			attestationThresholdRuleID,
+			sdk.SeverityMedium,
+			sdk.ConfidenceHigh,
+			fmt.Sprintf("Subject %s has %d independent attestations, %d required", subject, len(builders), required),
+		).
+			At(first.location, first.line, first.line).
+			WithMetadata("type", "insufficient_attestations").
+			WithMetadata("subject_digest", digest).
+			WithMetadata("independent_attestations", strconv.Itoa(len(builders))).
+			WithMetadata("required_attestations", strconv.Itoa(required)).
+			WithMetadata("builder_ids", strings.Join(sortedKeys(builders), ",")).
+			WithMetadata("unsigned_statements", strconv.Itoa(unsigned)).
+			WithMetadata("attesting_files", strings.Join(files, ","))
+		if name := first.subjects[digest]; name != "" {
+			fb.WithMetadata("subject", name)
+		}
+		fb.Done()
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestScanAttestationThreshold(t *testing.T) {
+	const (
+		digestApp = "1111111111111111111111111111111111111111111111111111111111111111"
+		digestCLI = "2222222222222222222222222222222222222222222222222222222222222222"
+		digestLib = "3333333333333333333333333333333333333333333333333333333333333333"
+	)
+	subject := func(name, digest string) string {
+		return `[{"name":"` + name + `","digest":{"sha256":"` + digest + `"}}]`
+	}
+	materials := `[{"uri":"git+https://github.com/example/app","digest":{"sha1":"aaaa"}}]`
+
+	workspace := t.TempDir()
+	// The app is attested by the hosted builder and a rebuild verifier.
+	writeFile(t, filepath.Join(workspace, "app", "hosted.intoto.json"),
+		signed(levelStatement("https://github.com/actions/runner@v2", "b", subject("app", digestApp), materials)))
+	writeFile(t, filepath.Join(workspace, "app", "rebuild.intoto.json"),
+		signed(levelStatement("https://rebuild.example.com/verifier", "b", subject("app", digestApp), materials)))
+	// The CLI's second statement comes from another release of the same
+	// builder.
+	writeFile(t, filepath.Join(workspace, "cli", "a.intoto.json"),
+		signed(levelStatement("https://github.com/actions/runner@v2", "b", subject("cli", digestCLI), materials)))
+	writeFile(t, filepath.Join(workspace, "cli", "b.intoto.json"),
+		signed(levelStatement("https://github.com/actions/runner@v3", "b", subject("cli", digestCLI), materials)))
+	// The library's rebuild statement is unsigned.
+	writeFile(t, filepath.Join(workspace, "lib", "hosted.intoto.json"),
+		signed(levelStatement("https://github.com/actions/runner", "b", subject("lib", digestLib), materials)))
+	writeFile(t, filepath.Join(workspace, "lib", "provenance.json"),
+		levelStatement("https://rebuild.example.com/verifier", "b", subject("lib", digestLib), materials))
+
+	client := testClient(t)
+	if got := findByRule(invokeScan(t, client, workspace).GetFindings(), attestationThresholdRuleID); len(got) != 0 {
+		t.Errorf("expected no %s findings by default, got %d", attestationThresholdRuleID, len(got))
+	}
+
+	resp := invokeScanWithInput(t, client, map[string]any{
+		"workspace_root":               workspace,
+		"min_attestations_per_subject": 2,
+	})
+
+	got := make(map[string]map[string]string)
+	for _, f := range findByRule(resp.GetFindings(), attestationThresholdRuleID) {
+		got[f.GetMetadata()["subject"]] = f.GetMetadata()
+	}
+	if len(got) != 2 || got["app"] != nil {
+		t.Fatalf("expected findings for cli and lib, got %v", got)
+	}
+	if meta := got["cli"]; meta["independent_attestations"] != "1" || meta["builder_ids"] != "https://github.com/actions/runner" ||
+		meta["attesting_files"] != "cli/a.intoto.json,cli/b.intoto.json" {
+		t.Errorf("unexpected cli finding: %v", meta)
+	}
+	if meta := got["lib"]; meta["unsigned_statements"] != "1" || meta["required_attestations"] != "2" || meta["subject_digest"] != "sha256:"+digestLib {
+		t.Errorf("unexpected lib finding: %v", meta)
+	}
+}
+
+func TestScanAttestationThresholdInvalid(t *testing.T) {
+	input, err := structpb.NewStruct(map[string]any{
+		"workspace_root":               t.TempDir(),
+		"min_attestations_per_subject": 0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = testClient(t).InvokeTool(context.Background(), &pluginv1.InvokeToolRequest{
+		ToolName: "scan",
+		Input:    input,
+	})
+	if err == nil {
+		t.Fatal("expected an error for min_attestations_per_subject below 1")
+	}
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tomlKind is the shape of a parsed TOML value.
+type tomlKind int
+
+const (
+	tomlString tomlKind = iota
+	// tomlScalar holds numbers, booleans, and dates as their raw text.
+	tomlScalar
+	tomlArray
+	tomlTable
+)
+
+// tomlValue is a TOML value together with the line it starts on. Tables
+// defined by a header start on the header's line.
+type tomlValue struct {
+	kind  tomlKind
+	line  int
+	str   string
+	array []*tomlValue
+	table *tomlTableValue
+}
+
+// tomlTableValue is a TOML table keeping its keys in document order.
+type tomlTableValue struct {
+	keys   []string
+	values map[string]*tomlValue
+}
+
+// get returns the value of key, or nil.
+func (t *tomlTableValue) get(key string) *tomlValue {
+	if t == nil {
+		return nil
+	}
+	return t.values[key]
+}
+
+// set stores a value under key, keeping the key's first position.
+func (t *tomlTableValue) set(key string, v *tomlValue) {
+	if _, ok := t.values[key]; !ok {
+		t.keys = append(t.keys, key)
+	}
+	t.values[key] = v
+}
+
+// str returns the string value of key, or "".
+func (t *tomlTableValue) str(key string) string {
+	if v := t.get(key); v != nil && v.kind == tomlString {
+		return v.str
+	}
+	return ""
+}
+
+// subtable returns the table under key, or nil.
+func (t *tomlTableValue) subtable(key string) *tomlTableValue {
+	if v := t.get(key); v != nil && v.kind == tomlTable {
+		return v.table
+	}
+	return nil
+}
+
+func newTOMLTable(line int) *tomlValue {
+	return &tomlValue{kind: tomlTable, line: line, table: &tomlTableValue{values: make(map[string]*tomlValue)}}
+}
+
+// parseTOML parses a TOML document for the values and lines the manifest
+// checks need. It accepts the whole syntax but is lenient where the
+// specification is strict: redefined keys and tables are merged rather than
+// rejected, and scalars are kept as text.
+func parseTOML(data []byte) (*tomlValue, error) {
+	p := &tomlParser{data: data, line: 1}
+	root := newTOMLTable(0)
+	current := root.table
+	for {
+		p.skipSpace(true)
+		if p.pos >= len(p.data) {
+			return root, nil
+		}
+		if p.data[p.pos] == '[' {
+			table, err := p.header(root.table)
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			current = table
+		} else {
+			keys, err := p.key()
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			p.skipSpace(false)
+			if !p.consume('=') {
+				return nil, p.errorf("expected = after key %q", strings.Join(keys, "."))
+			}
+			p.skipSpace(false)
+			v, err := p.value()
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			if err := assignTOML(current, keys, v); err != nil {
+				return nil, p.errorf("%v", err)
+			}
+		}
+		p.skipSpace(false)
+		if p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+			return nil, p.errorf("unexpected %q after value", p.data[p.pos])
+		}
+	}
+}
+
+// tomlParser walks a TOML document, counting lines.
+type tomlParser struct {
+	data []byte
+	pos  int
+	line int
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips blanks and comments, and newlines too when newlines is
+// set.
+func (p *tomlParser) skipSpace(newlines bool) {
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		case c == '#':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) consume(c byte) bool {
+	if p.pos < len(p.data) && p.data[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// header parses a [table] or [[array]] header and returns the table it
+// opens.
+func (p *tomlParser) header(root *tomlTableValue) (*tomlTableValue, error) {
+	line := p.line
+	p.pos++
+	array := p.consume('[')
+	p.skipSpace(false)
+	keys, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace(false)
+	if !p.consume(']') || array && !p.consume(']') {
+		return nil, errors.New("unterminated table header")
+	}
+
+	t := root
+	for i, k := range keys {
+		last := i == len(keys)-1
+		v := t.get(k)
+		switch {
+		case last && array:
+			if v == nil {
+				v = &tomlValue{kind: tomlArray, line: line}
+				t.set(k, v)
+			}
+			if v.kind != tomlArray {
+				return nil, fmt.Errorf("%s is not an array of tables", k)
+			}
+			table := newTOMLTable(line)
+			v.array = append(v.array, table)
+			return table.table, nil
+		case v == nil:
+			v = newTOMLTable(line)
+			t.set(k, v)
+		case last && v.kind == tomlTable:
+			// A table first implied by a dotted header takes this line.
+			v.line = line
+		}
+		switch {
+		case v.kind == tomlTable:
+			t = v.table
+		case v.kind == tomlArray && len(v.array) > 0 && v.array[len(v.array)-1].kind == tomlTable:
+			t = v.array[len(v.array)-1].table
+		default:
+			return nil, fmt.Errorf("%s is not a table", k)
+		}
+	}
+	return t, nil
+}
+
+// key parses a bare, quoted, or dotted key.
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace(false)
+		if p.pos >= len(p.data) {
+			return nil, errors.New("expected a key")
+		}
+		switch c := p.data[p.pos]; {
+		case c == '"' || c == '\'':
+			s, err := p.stringValue()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, s)
+		default:
+			start := p.pos
+			for p.pos < len(p.data) && isTOMLBareKeyByte(p.data[p.pos]) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("unexpected %q in key", c)
+			}
+			keys = append(keys, string(p.data[start:p.pos]))
+		}
+		p.skipSpace(false)
+		if !p.consume('.') {
+			return keys, nil
+		}
+	}
+}
+
+func isTOMLBareKeyByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_'
+}
+
+// value parses a string, array, inline table, or scalar.
+func (p *tomlParser) value() (*tomlValue, error) {
+	if p.pos >= len(p.data) {
+		return nil, errors.New("expected a value")
+	}
+	line := p.line
+	switch c := p.data[p.pos]; c {
+	case '"', '\'':
+		s, err := p.stringValue()
+		if err != nil {
+			return nil, err
+		}
+		return &tomlValue{kind: tomlString, line: line, str: s}, nil
+	case '[':
+		p.pos++
+		v := &tomlValue{kind: tomlArray, line: line}
+		for {
+			p.skipSpace(true)
+			if p.consume(']') {
+				return v, nil
+			}
+			elem, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			v.array = append(v.array, elem)
+			p.skipSpace(true)
+			if !p.consume(',') {
+				p.skipSpace(true)
+				if !p.consume(']') {
+					return nil, errors.New("unterminated array")
+				}
+				return v, nil
+			}
+		}
+	case '{':
+		p.pos++
+		v := newTOMLTable(line)
+		p.skipSpace(false)
+		if p.consume('}') {
+			return v, nil
+		}
+		for {
+			keys, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace(false)
+			if !p.consume('=') {
+				return nil, errors.New("expected = in inline table")
+			}
+			p.skipSpace(false)
+			elem, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if err := assignTOML(v.table, keys, elem); err != nil {
+				return nil, err
+			}
+			p.skipSpace(false)
+			if p.consume('}') {
+				return v, nil
+			}
+			if !p.consume(',') {
+				return nil, errors.New("unterminated inline table")
+			}
+			p.skipSpace(false)
+		}
+	default:
+		start := p.pos
+		for p.pos < len(p.data) && strings.IndexByte(",]}#\r\n", p.data[p.pos]) < 0 {
+			p.pos++
+		}
+		raw := strings.TrimSpace(string(p.data[start:p.pos]))
+		if raw == "" {
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+		return &tomlValue{kind: tomlScalar, line: line, str: raw}, nil
+	}
+}
+
+// stringValue parses a basic, literal, or multi-line string.
+func (p *tomlParser) stringValue() (string, error) {
+	quote := p.data[p.pos]
+	delim := string(quote)
+	multi := bytes.HasPrefix(p.data[p.pos:], []byte(strings.Repeat(delim, 3)))
+	if multi {
+		delim = strings.Repeat(delim, 3)
+		p.pos += 3
+		// A newline right after the opening delimiter is trimmed.
+		if bytes.HasPrefix(p.data[p.pos:], []byte("\r\n")) {
+			p.pos++
+		}
+		if p.consume('\n') {
+			p.line++
+		}
+	} else {
+		p.pos++
+	}
+
+	var b strings.Builder
+	for p.pos < len(p.data) {
+		if bytes.HasPrefix(p.data[p.pos:], []byte(delim)) {
+			p.pos += len(delim)
+			// Up to two quotes may directly precede the closing delimiter.
+			for extra := 0; multi && extra < 2 && p.pos < len(p.data) && p.data[p.pos] == quote; extra++ {
+				b.WriteByte(quote)
+				p.pos++
+			}
+			return b.String(), nil
+		}
+		c := p.data[p.pos]
+		switch {
+		case c == '\n' && !multi:
+			return "", errors.New("newline in string")
+		case c == '\n':
+			p.line++
+			b.WriteByte(c)
+			p.pos++
+		case c == '\\' && quote == '"':
+			n, err := p.escape(&b, multi)
+			if err != nil {
+				return "", err
+			}
+			p.pos += n
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", errors.New("unterminated string")
+}
+
+// escape decodes the escape sequence at the parser's position into b and
+// returns its length.
+func (p *tomlParser) escape(b *strings.Builder, multi bool) (int, error) {
+	rest := p.data[p.pos:]
+	if len(rest) < 2 {
+		return 0, errors.New("unterminated escape")
+	}
+	switch rest[1] {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case 'e':
+		b.WriteByte(0x1b)
+	case '"', '\\':
+		b.WriteByte(rest[1])
+	case 'u', 'U':
+		size := 4
+		if rest[1] == 'U' {
+			size = 8
+		}
+		if len(rest) < 2+size {
+			return 0, errors.New("short unicode escape")
+		}
+		r, err := strconv.ParseUint(string(rest[2:2+size]), 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid unicode escape %q", rest[:2+size])
+		}
+		b.WriteRune(rune(r))
+		return 2 + size, nil
+	default:
+		// A line-ending backslash in a multi-line string trims the
+		// whitespace and newlines that follow.
+		if !multi {
+			return 0, fmt.Errorf("invalid escape %q", rest[:2])
+		}
+		n := 1
+		for n < len(rest) && (rest[n] == ' ' || rest[n] == '\t' || rest[n] == '\r' || rest[n] == '\n') {
+			if rest[n] == '\n' {
+				p.line++
+			}
+			n++
+		}
+		if n == 1 {
+			return 0, fmt.Errorf("invalid escape %q", rest[:2])
+		}
+		return n, nil
+	}
+	return 2, nil
+}
+
+// assignTOML stores v under a dotted key within t, creating the tables the
+// key implies.
+func assignTOML(t *tomlTableValue, keys []string, v *tomlValue) error {
+	for _, k := range keys[:len(keys)-1] {
+		next := t.get(k)
+		if next == nil {
+			next = newTOMLTable(v.line)
+			t.set(k, next)
+		}
+		if next.kind != tomlTable {
+			return fmt.Errorf("%s is not a table", k)
+		}
+		t = next.table
+	}
+	t.set(keys[len(keys)-1], v)
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	doc, err := parseTOML([]byte(strings.Join([]string{
+		`# comment`,
+		`title = "a \"quoted\" \u00e9 string" # trailing`,
+		`literal = 'C:\path'`,
+		`numbers = [`,
+		`  1, 2, # comment`,
+		`  3,`,
+		`]`,
+		`text = """`,
+		`first`,
+		`second"""`,
+		`site."google.com" = true`,
+		``,
+		`[dependencies]`,
+		`serde = "1"`,
+		`tokio = { version = "1", features = ["full"] }`,
+		``,
+		`[dependencies.foo]`,
+		`git = 'https://example.com/foo'`,
+		``,
+		`[[bin]]`,
+		`name = "one"`,
+		`[[bin]]`,
+		`name = "two"`,
+		`[target.'cfg(unix)'.dependencies]`,
+		`nix = "0.27"`,
+	}, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := doc.table
+	if got := root.str("title"); got != `a "quoted" é string` {
+		t.Errorf("title = %q", got)
+	}
+	if got := root.str("literal"); got != `C:\path` {
+		t.Errorf("literal = %q", got)
+	}
+	if v := root.get("numbers"); v == nil || len(v.array) != 3 || v.array[2].str != "3" || v.array[2].line != 6 {
+		t.Errorf("numbers = %+v", v)
+	}
+	if got := root.str("text"); got != "first\nsecond" {
+		t.Errorf("text = %q", got)
+	}
+	if v := root.subtable("site").get("google.com"); v == nil || v.str != "true" || v.line != 11 {
+		t.Errorf("site = %+v", v)
+	}
+	deps := root.subtable("dependencies")
+	if deps == nil || strings.Join(deps.keys, ",") != "serde,tokio,foo" {
+		t.Fatalf("dependencies = %+v", deps)
+	}
+	if v := deps.subtable("tokio").get("features"); v == nil || v.line != 15 || v.array[0].str != "full" {
+		t.Errorf("tokio features = %+v", v)
+	}
+	foo := deps.get("foo")
+	if foo.line != 17 || foo.table.get("git").line != 18 || foo.table.str("git") != "https://example.com/foo" {
+		t.Errorf("foo = %+v", foo.table.get("git"))
+	}
+	if v := root.get("bin"); v == nil || len(v.array) != 2 || v.array[1].line != 22 || v.array[1].table.str("name") != "two" {
+		t.Errorf("bin = %+v", v)
+	}
+	if v := root.subtable("target").subtable("cfg(unix)").subtable("dependencies").get("nix"); v == nil || v.line != 25 {
+		t.Errorf("target dependency = %+v", v)
+	}
+
+	for _, bad := range []string{
+		`key = "unterminated`,
+		`key = `,
+		`[table`,
+		`key = "a" "b"`,
+		`key = { a = 1`,
+		"a = 1\n[a]",
+	} {
+		if _, err := parseTOML([]byte(bad)); err == nil {
+			t.Errorf("parseTOML(%q): expected an error", bad)
+		}
+	}
+}
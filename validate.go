@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// inlineLocation is the synthetic path findings are anchored at when the
+// provenance was passed inline rather than read from a file.
+const inlineLocation = "<inline>"
+
+// maxInlineContentSize bounds the content accepted by the validate tool. It
+// sits below gRPC's default 4 MiB message limit, leaving room for the rest
+// of the request, so oversized content reaches the plugin and is rejected
+// with an error the caller can act on.
+const maxInlineContentSize = 3 << 20
+
+func handleValidate(ctx context.Context, req sdk.ToolRequest) (*pluginv1.InvokeToolResponse, error) {
+	content, _ := req.Input["content"].(string)
+
+	resp := sdk.NewResponse()
+
+	if content == "" {
+		return resp.Build(), nil
+	}
+	if len(content) > maxInlineContentSize {
+		return nil, fmt.Errorf("content is %d bytes, exceeds the %d byte limit", len(content), maxInlineContentSize)
+	}
+
+	policy, err := parseProvenancePolicy(envDefaults.apply(req.Input))
+	if err != nil {
+		return nil, err
+	}
+
+	findings := &findingSet{}
+	if err := checkProvenance(ctx, findings, inlineLocation, []byte(content), policy, &scanSummary{}); err != nil {
+		return nil, err
+	}
+
+	findings.build(resp)
+	return resp.Build(), nil
+}
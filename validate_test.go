@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestValidateCompleteInlineContent(t *testing.T) {
+	client := testClient(t)
+
+	resp := invokeTool(t, client, "validate", map[string]any{"content": testStatement})
+	if len(resp.GetFindings()) != 0 {
+		t.Errorf("expected no findings for a complete statement, got %d", len(resp.GetFindings()))
+	}
+}
+
+func TestValidateIncompleteInlineContent(t *testing.T) {
+	client := testClient(t)
+
+	incomplete := `{"_type":"https://in-toto.io/Statement/v0.1","subject":[{"name":"app","digest":{}}]}`
+	content := testStatement + "\n" + incomplete + "\n"
+
+	resp := invokeTool(t, client, "validate", map[string]any{"content": content})
+
+	found := findByRule(resp.GetFindings(), "PROV-002")
+	if len(found) != 2 {
+		t.Fatalf("expected a statement-level and a subject PROV-002 finding, got %d", len(found))
+	}
+	for _, f := range found {
+		if f.GetLocation().GetFilePath() != inlineLocation {
+			t.Errorf("location = %q, want %q", f.GetLocation().GetFilePath(), inlineLocation)
+		}
+		if f.GetLocation().GetStartLine() != 2 {
+			t.Errorf("start line = %d, want 2", f.GetLocation().GetStartLine())
+		}
+		meta := f.GetMetadata()
+		if want := len(testStatement) + 1; meta["byte_offset"] != strconv.Itoa(want) {
+			t.Errorf("byte_offset = %q, want %d", meta["byte_offset"], want)
+		}
+		if meta["statement_index"] != "1" {
+			t.Errorf("statement_index = %q, want 1", meta["statement_index"])
+		}
+	}
+
+	var statementLevel, subject map[string]string
+	for _, f := range found {
+		if _, ok := f.GetMetadata()["subject_index"]; ok {
+			subject = f.GetMetadata()
+		} else {
+			statementLevel = f.GetMetadata()
+		}
+	}
+	if statementLevel["reasons"] != "missing predicate" {
+		t.Errorf("statement-level reasons = %q, want %q", statementLevel["reasons"], "missing predicate")
+	}
+	if subject["reasons"] != "subject missing digest" || subject["subject_index"] != "0" || subject["subject_name"] != "app" {
+		t.Errorf("unexpected subject finding metadata %v", subject)
+	}
+}
+
+func TestValidateUnparsableInlineContent(t *testing.T) {
+	client := testClient(t)
+
+	resp := invokeTool(t, client, "validate", map[string]any{"content": "definitely not json"})
+
+	found := findByRule(resp.GetFindings(), "PROV-002")
+	if len(found) != 1 {
+		t.Fatalf("expected exactly one PROV-002 finding, got %d", len(found))
+	}
+	if found[0].GetMetadata()["parse_error"] == "" {
+		t.Error("PROV-002 for unparsable content should include parse_error metadata")
+	}
+}
+
+func TestValidateRejectsOversizedContent(t *testing.T) {
+	input, err := structpb.NewStruct(map[string]any{
+		"content": strings.Repeat(" ", maxInlineContentSize+1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = testClient(t).InvokeTool(context.Background(), &pluginv1.InvokeToolRequest{ToolName: "validate", Input: input})
+	want := "content is " + strconv.Itoa(maxInlineContentSize+1) + " bytes, exceeds the " + strconv.Itoa(maxInlineContentSize) + " byte limit"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("expected the size limit error %q, got %v", want, err)
+	}
+}
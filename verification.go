@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// unmatchedPolicyRuleID flags an admission policy whose keys or identities
+// match no signing step in CI.
+const unmatchedPolicyRuleID = "PROV-015"
+
+// Image policy kinds.
+const (
+	policyKindSigstore = "ClusterImagePolicy"
+	policyKindKyverno  = "kyverno"
+)
+
+// CI platforms that sign keylessly with their own OIDC issuer.
+const (
+	platformGitHub = "github"
+	platformGitLab = "gitlab"
+)
+
+// keylessIssuers maps OIDC issuers of keyless signing identities to the CI
+// platform that issues them.
+var keylessIssuers = map[string]string{
+	"https://token.actions.githubusercontent.com": platformGitHub,
+	"https://gitlab.com":                          platformGitLab,
+}
+
+// policyAuthority is one key or keyless identity an image policy trusts.
+type policyAuthority struct {
+	line    int
+	keyless bool
+	// keyRef is the KMS URI of a key authority, empty for inline keys and
+	// secret references.
+	keyRef  string
+	issuer  string
+	subject string
+}
+
+// imagePolicy is a Sigstore policy-controller ClusterImagePolicy or a
+// Kyverno policy with verifyImages rules.
+type imagePolicy struct {
+	kind        string
+	path        string
+	line        int
+	authorities []policyAuthority
+}
+
+// signingStep is a cosign signing or attesting command in a build or CI
+// config.
+type signingStep struct {
+	path string
+	// keyRef is the --key argument, empty for keyless signing.
+	keyRef string
+}
+
+var (
+	signingStepPattern = regexp.MustCompile(`\bcosign\s+(?:sign|sign-blob|attest|attest-blob)\b`)
+	signingKeyPattern  = regexp.MustCompile(`--key[=\s]+["']?([^\s"']+)`)
+	verifyStepPattern  = regexp.MustCompile(`\bcosign\s+verify(?:-attestation|-blob)?\b|\bslsa-verifier\s+verify|\bgh\s+attestation\s+verify\b`)
+
+	policyAPIVersionPattern = regexp.MustCompile(`^apiVersion:\s*["']?(policy\.sigstore\.dev|kyverno\.io)/`)
+	policyKindPattern       = regexp.MustCompile(`^kind:\s*["']?(\w+)`)
+	authorityKeyPattern     = regexp.MustCompile(`^\s*(?:-\s+)?(keyless|keys?):`)
+	authorityFieldPattern   = regexp.MustCompile(`^\s*(?:-\s+)?(kms|issuer|subject|subjectRegExp):\s*["']?([^\s"'#]+)`)
+
+	publicKeyHeader = []byte("-----BEGIN PUBLIC KEY-----")
+)
+
+// isKeyFileName reports whether a file may hold a published verification
+// key or a committed private key. Only cosign.pub is counted as a
+// verification key by name alone; other files must hold a PEM public key.
+func isKeyFileName(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasSuffix(lower, ".pub") || strings.HasSuffix(lower, ".pem") || strings.HasSuffix(lower, ".key")
+}
+
+// isDocumentation reports whether a file is Markdown documentation that may
+// describe verification steps.
+func isDocumentation(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".md")
+}
+
+// scanVerificationFile records verification infrastructure: image policies
+// in YAML manifests, published public keys, and verification commands in
+// documentation. Key files are also checked for weak and private keys.
+// Build and CI configs are covered line by line by recordVerificationLine
+// instead.
+func scanVerificationFile(ctx context.Context, findings *findingSet, filePath string, policy provenancePolicy, summary *scanSummary) error {
+	data, err := findings.files().ReadFile(filePath)
+	if err != nil {
+		summary.filesUnreadable++
+		return nil
+	}
+	name := filepath.Base(filePath)
+	switch {
+	case isKeyFileName(name):
+		scanKeyFile(findings, filePath, data, policy)
+		if strings.EqualFold(name, "cosign.pub") || bytes.Contains(data, publicKeyHeader) {
+			summary.verificationKeys++
+		}
+		return nil
+	case isDocumentation(name):
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, len(data)+1)
+		for scanner.Scan() {
+			if verifyStepPattern.MatchString(scanner.Text()) {
+				summary.verifySteps++
+			}
+		}
+		return scanner.Err()
+	}
+	return scanImagePolicies(ctx, filePath, data, summary)
+}
+
+// scanImagePolicies records the image policies in a YAML file, which may
+// hold several documents.
+func scanImagePolicies(ctx context.Context, filePath string, data []byte, summary *scanSummary) error {
+	if !bytes.Contains(data, []byte("policy.sigstore.dev/")) && !bytes.Contains(data, []byte("kyverno.io/")) {
+		return nil
+	}
+
+	var (
+		isPolicyAPI   bool
+		kind          string
+		verifyImages  bool
+		documentStart = 1
+		authorities   []policyAuthority
+	)
+	// flush records the document just finished if it is an image policy.
+	flush := func() {
+		if isPolicyAPI && (kind == policyKindSigstore || verifyImages) {
+			policyKind := policyKindKyverno
+			if kind == policyKindSigstore {
+				policyKind = policyKindSigstore
+			}
+			summary.imagePolicies = append(summary.imagePolicies, imagePolicy{
+				kind:        policyKind,
+				path:        filePath,
+				line:        documentStart,
+				authorities: authorities,
+			})
+		}
+		isPolicyAPI, kind, verifyImages, authorities = false, "", false, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	lineNum := 0
+	var pace cancelCheck
+	for scanner.Scan() {
+		lineNum++
+		if pace.due(len(scanner.Bytes())) && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "---":
+			flush()
+			documentStart = lineNum + 1
+		case policyAPIVersionPattern.MatchString(line):
+			isPolicyAPI = true
+		case policyKindPattern.MatchString(line):
+			kind = policyKindPattern.FindStringSubmatch(line)[1]
+		case strings.Contains(line, "verifyImages:"):
+			verifyImages = true
+		case authorityKeyPattern.MatchString(line):
+			// Kyverno trusts "keys"; its "key" fields belong to conditions.
+			field := authorityKeyPattern.FindStringSubmatch(line)[1]
+			if field == "key" && kind != policyKindSigstore {
+				continue
+			}
+			authorities = append(authorities, policyAuthority{line: lineNum, keyless: field == "keyless"})
+		default:
+			m := authorityFieldPattern.FindStringSubmatch(line)
+			if m == nil || len(authorities) == 0 {
+				continue
+			}
+			authority := &authorities[len(authorities)-1]
+			switch m[1] {
+			case "kms":
+				authority.keyRef = m[2]
+			case "issuer":
+				authority.issuer = m[2]
+			default:
+				authority.subject = m[2]
+			}
+		}
+	}
+	flush()
+	return scanner.Err()
+}
+
+// recordVerificationLine records cosign signing steps and verification
+// commands in a build or CI config line.
+func (s *scanSummary) recordVerificationLine(filePath, line string, ascii bool) {
+	if ascii && !containsFoldASCII(line, "cosign") && !containsFoldASCII(line, "verify") {
+		return
+	}
+	if signingStepPattern.MatchString(line) {
+		step := signingStep{path: filePath}
+		if m := signingKeyPattern.FindStringSubmatch(line); m != nil {
+			step.keyRef = m[1]
+		}
+		s.signingSteps = append(s.signingSteps, step)
+	}
+	if verifyStepPattern.MatchString(line) {
+		s.verifySteps++
+	}
+}
+
+// mergeVerification folds the verification infrastructure recorded in other
+// into s.
+func (s *scanSummary) mergeVerification(other *scanSummary) {
+	s.imagePolicies = append(s.imagePolicies, other.imagePolicies...)
+	s.signingSteps = append(s.signingSteps, other.signingSteps...)
+	s.verificationKeys += other.verificationKeys
+	s.verifySteps += other.verifySteps
+}
+
+// verificationDetected reports whether the workspace clearly has downstream
+// verification in place: an admission policy, or a published key together
+// with documented verification steps.
+func (s *scanSummary) verificationDetected() bool {
+	return len(s.imagePolicies) > 0 || (s.verificationKeys > 0 && s.verifySteps > 0)
+}
+
+// ciPlatform returns the CI platform a workspace-relative config path
+// belongs to, or "" when it is not a known CI config.
+func ciPlatform(rel string) string {
+	switch {
+	case strings.HasPrefix(rel, ".github/workflows/"):
+		return platformGitHub
+	case rel == ".gitlab-ci.yml":
+		return platformGitLab
+	}
+	return ""
+}
+
+// reportUnmatchedPolicies flags image policy authorities that no CI signing
+// step could satisfy: key authorities without any key-based signing step (or,
+// for KMS keys, without one using the same key), and keyless identities
+// without a keyless signing step on the issuing platform or in the workflow
+// the subject names. The match is heuristic, so findings are Low confidence.
+func reportUnmatchedPolicies(findings *findingSet, summary *scanSummary) {
+	keyRefs := make(map[string]bool)
+	keyBased := false
+	keylessPlatforms := make(map[string]bool)
+	keylessWorkflows := make(map[string]bool)
+	for _, step := range summary.signingSteps {
+		rel := workspacePath(findings.root, step.path)
+		if step.keyRef != "" {
+			keyBased = true
+			keyRefs[step.keyRef] = true
+			continue
+		}
+		keylessPlatforms[ciPlatform(rel)] = true
+		keylessWorkflows[rel] = true
+	}
+
+	for _, policy := range summary.imagePolicies {
+		for _, authority := range policy.authorities {
+			var reason string
+			switch {
+			case !authority.keyless && authority.keyRef != "" && !keyRefs[authority.keyRef]:
+				reason = fmt.Sprintf("key %s is not used by any CI signing step", authority.keyRef)
+			case !authority.keyless && authority.keyRef == "" && !keyBased:
+				reason = "it trusts a public key but no CI step signs with a key"
+			case authority.keyless && len(keylessPlatforms) == 0:
+				reason = "it trusts a keyless identity but no CI step signs keylessly"
+			case authority.keyless && keylessIssuers[authority.issuer] != "" && !keylessPlatforms[keylessIssuers[authority.issuer]]:
+				reason = fmt.Sprintf("no %s CI step signs keylessly for issuer %s", keylessIssuers[authority.issuer], authority.issuer)
+			case authority.keyless && workflowOf(authority.subject) != "" && !keylessWorkflows[workflowOf(authority.subject)]:
+				reason = fmt.Sprintf("workflow %s named by subject %s has no keyless signing step", workflowOf(authority.subject), authority.subject)
+			default:
+				continue
+			}
+			findings.Finding(
+				unmatchedPolicyRuleID,
+				sdk.SeverityMedium,
+				sdk.ConfidenceLow,
+				fmt.Sprintf("Image policy authority may never be satisfied: %s", reason),
+			).
+				At(policy.path, authority.line, authority.line).
+				WithMetadata("type", "unmatched_policy_authority").
+				WithMetadata("policy_kind", policy.kind).
+				WithMetadata("reason", reason).
+				WithMetadata("policy_line", strconv.Itoa(policy.line)).
+				Done()
+		}
+	}
+}
+
+// workflowSubjectPattern extracts the workflow path from a GitHub Actions
+// keyless subject such as
+// https://github.com/org/repo/.github/workflows/release.yml@refs/tags/v1.
+var workflowSubjectPattern = regexp.MustCompile(`(\.github/workflows/[^@/\s]+\.ya?ml)`)
+
+// workflowOf returns the workspace-relative workflow path a keyless subject
+// names, or "" when it names none or is a regular expression.
+func workflowOf(subject string) string {
+	m := workflowSubjectPattern.FindStringSubmatch(subject)
+	if m == nil || strings.ContainsAny(m[1], `*+?()[]\`) {
+		return ""
+	}
+	return m[1]
+}
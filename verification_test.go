@@ -0,0 +1,122 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+func TestScanLowersMissingAttestationConfidenceWithVerification(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"no verification", map[string]string{}, "false"},
+		{"key without verify steps", map[string]string{"cosign.pub": "-----BEGIN PUBLIC KEY-----\n"}, "false"},
+		{"key and documented verify step", map[string]string{
+			"cosign.pub": "-----BEGIN PUBLIC KEY-----\n",
+			"README.md":  "Verify releases with:\n\n    cosign verify --key cosign.pub ghcr.io/example/app\n",
+		}, "true"},
+		{"admission policy", map[string]string{
+			"deploy/policy.yaml": "apiVersion: policy.sigstore.dev/v1beta1\nkind: ClusterImagePolicy\nspec:\n  authorities:\n    - keyless: {}\n",
+		}, "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tgo build ./...\n")
+			for name, content := range tt.files {
+				writeFile(t, filepath.Join(workspace, name), content)
+			}
+
+			resp := invokeScan(t, testClient(t), workspace)
+
+			missing := findByRule(resp.GetFindings(), "PROV-001")
+			if len(missing) != 1 {
+				t.Fatalf("expected one PROV-001 finding, got %d", len(missing))
+			}
+			if got := missing[0].GetMetadata()["verification_detected"]; got != tt.want {
+				t.Errorf("verification_detected = %q, want %q", got, tt.want)
+			}
+			wantConfidence := sdk.ConfidenceMedium
+			if tt.want == "true" {
+				wantConfidence = sdk.ConfidenceLow
+			}
+			if got := missing[0].GetConfidence(); got != wantConfidence {
+				t.Errorf("PROV-001 confidence = %v, want %v", got, wantConfidence)
+			}
+		})
+	}
+}
+
+func TestScanFlagsUnmatchedPolicyAuthorities(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "release.yml"),
+		"jobs:\n  release:\n    steps:\n      - run: cosign sign --yes ghcr.io/example/app@${DIGEST}\n"+
+			"      - run: cosign attest --key awskms:///alias/release --predicate sbom.json ghcr.io/example/app\n")
+	writeFile(t, filepath.Join(workspace, "deploy", "policies.yaml"), strings.Join([]string{
+		"apiVersion: policy.sigstore.dev/v1beta1",
+		"kind: ClusterImagePolicy",
+		"spec:",
+		"  authorities:",
+		"    - keyless:",
+		"        identities:",
+		"          - issuer: https://token.actions.githubusercontent.com",
+		"            subject: https://github.com/example/app/.github/workflows/release.yml@refs/heads/main",
+		"    - keyless:",
+		"        identities:",
+		"          - issuer: https://token.actions.githubusercontent.com",
+		"            subject: https://github.com/example/app/.github/workflows/nightly.yml@refs/heads/main",
+		"    - keyless:",
+		"        identities:",
+		"          - issuer: https://gitlab.com",
+		"            subject: https://gitlab.com/example/app//.gitlab-ci.yml@refs/heads/main",
+		"---",
+		"apiVersion: kyverno.io/v1",
+		"kind: ClusterPolicy",
+		"spec:",
+		"  rules:",
+		"    - preconditions:",
+		"        all:",
+		"          - key: \"{{ request.operation }}\"",
+		"      verifyImages:",
+		"        - attestors:",
+		"            - entries:",
+		"                - keys:",
+		"                    kms: awskms:///alias/release",
+		"                - keys:",
+		"                    kms: awskms:///alias/other",
+	}, "\n")+"\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	found := findByRule(resp.GetFindings(), unmatchedPolicyRuleID)
+	lines := make(map[int32]string)
+	for _, f := range found {
+		lines[f.GetLocation().GetStartLine()] = f.GetMetadata()["policy_kind"]
+		if f.GetConfidence() != sdk.ConfidenceLow {
+			t.Errorf("%s confidence = %v, want low", unmatchedPolicyRuleID, f.GetConfidence())
+		}
+	}
+	want := map[int32]string{
+		9:  policyKindSigstore, // nightly.yml has no signing step
+		13: policyKindSigstore, // no GitLab CI step signs keylessly
+		30: policyKindKyverno,  // awskms:///alias/other is never used
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %s findings on lines %v, got %v", unmatchedPolicyRuleID, want, lines)
+	}
+	for line, kind := range want {
+		if lines[line] != kind {
+			t.Errorf("expected a %s finding for a %s policy on line %d, got %v", unmatchedPolicyRuleID, kind, line, lines)
+		}
+	}
+
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["image_policies"] != "2" || meta["signing_steps"] != "2" {
+		t.Errorf("image_policies = %q, signing_steps = %q; want 2, 2", meta["image_policies"], meta["signing_steps"])
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// workspaceWalker walks a workspace, pruning skipped directories and
+// optionally descending into symlinked directories, and calls visit for every
+// file. Paths passed to visit are always as seen under the workspace root,
+// never the resolved symlink target.
+type workspaceWalker struct {
+	root           string
+	followSymlinks bool
+	summary        *scanSummary
+	findings       *findingSet
+	skipDirs       *dirMatcher
+	maxDepth       int
+	visit          func(path, rel string, d fs.DirEntry) error
+
+	// ignores holds .gitignore and .noxignore rules; nil disables ignore
+	// file handling entirely.
+	ignores *ignoreMatcher
+	// provenance decides which gitignored files and dangling symlinks are
+	// reported as provenance, as for classification.
+	provenance *provenanceMatcher
+
+	// visited holds the real paths of directories already walked when
+	// following symlinks, so cycles and repeated targets are walked once.
+	visited map[string]bool
+
+	// visitedFiles holds the real paths of files already visited when
+	// following symlinks, so a file reachable through several links is
+	// analyzed once.
+	visitedFiles map[string]bool
+}
+
+// walk traverses the workspace.
+func (w *workspaceWalker) walk(ctx context.Context) error {
+	if !w.followSymlinks {
+		return w.walkTree(ctx, w.root, w.root)
+	}
+
+	w.visited = make(map[string]bool)
+	w.visitedFiles = make(map[string]bool)
+	realRoot, err := filepath.EvalSymlinks(w.root)
+	if err != nil {
+		realRoot = w.root
+	}
+	return w.walkTree(ctx, w.root, realRoot)
+}
+
+// walkChanged visits only the given workspace-relative slash paths, each
+// as the full walk would: a file under a skipped, too deep, or ignored
+// directory, or itself ignored, is left out. A path that does not exist,
+// as for a deleted file, or that names a directory is counted and skipped.
+func (w *workspaceWalker) walkChanged(ctx context.Context, rels []string) error {
+	w.summary.changedFiles = len(rels)
+	for _, rel := range rels {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		logical := filepath.Join(w.root, filepath.FromSlash(rel))
+		info, err := w.findings.files().Stat(logical)
+		if err != nil || info.IsDir() {
+			w.summary.changedFilesMissing++
+			continue
+		}
+		ignores, pruned := w.prunedAncestors(logical, rel)
+		if pruned {
+			continue
+		}
+		d := fs.FileInfoToDirEntry(info)
+		if w.ignoredFile(ignores, logical, rel, d) {
+			continue
+		}
+		if err := w.visitFile(logical, rel, logical, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prunedAncestors reports whether the full walk would have pruned one of
+// the directories holding a changed file, and otherwise returns the ignore
+// rules that apply to it, read from the root down. A provenance file below
+// a directory pruned by .gitignore is reported as the walk would.
+func (w *workspaceWalker) prunedAncestors(logical, rel string) (*ignoreMatcher, bool) {
+	var ignores *ignoreMatcher
+	if w.ignores != nil {
+		ignores = &ignoreMatcher{gitignore: w.ignores.gitignore, fsys: w.ignores.fsys}
+		ignores.load(w.root, "")
+	}
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		if w.skipDirs.matches(parts[i-1], dir) || (w.maxDepth >= 0 && i > w.maxDepth) {
+			return nil, true
+		}
+		if ignores == nil {
+			continue
+		}
+		if ignored, rule := ignores.match(dir, true); ignored {
+			if rule.fromGitignore() && w.isProvenance(rel) {
+				w.reportGitignoredProvenance(logical, rule)
+			}
+			return nil, true
+		}
+		ignores.load(filepath.Join(w.root, filepath.FromSlash(dir)), dir)
+	}
+	return ignores, false
+}
+
+// walkTree walks the directory at realRoot, reporting paths relative to
+// logicalRoot.
+func (w *workspaceWalker) walkTree(ctx context.Context, logicalRoot, realRoot string) error {
+	return w.findings.files().WalkDir(realRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// WalkDir reports a directory it cannot list with a second
+			// callback carrying the error; the directory itself was already
+			// visited.
+			if d != nil && d.IsDir() {
+				w.summary.inaccessibleDirs = append(w.summary.inaccessibleDirs, slashRel(w.root, w.logicalPath(logicalRoot, realRoot, path)))
+				return nil
+			}
+			w.summary.walkErrors++
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		logical := w.logicalPath(logicalRoot, realRoot, path)
+
+		if d.IsDir() {
+			rel := slashRel(w.root, logical)
+			if w.skipDirs.matches(d.Name(), rel) {
+				w.summary.dirsSkipped++
+				return filepath.SkipDir
+			}
+			if w.maxDepth >= 0 && rel != "." && strings.Count(rel, "/")+1 > w.maxDepth {
+				w.summary.depthPruned++
+				return filepath.SkipDir
+			}
+			if w.visited != nil {
+				if w.visited[path] {
+					return filepath.SkipDir
+				}
+				w.visited[path] = true
+			}
+			if w.ignores != nil {
+				if rel == "." {
+					rel = ""
+				} else if ignored, rule := w.ignores.match(rel, true); ignored {
+					w.summary.dirsIgnored++
+					if rule.fromGitignore() {
+						w.findIgnoredProvenance(ctx, logical, rel, path, rule)
+					}
+					return filepath.SkipDir
+				}
+				w.ignores.load(path, rel)
+			}
+			return nil
+		}
+
+		rel := slashRel(w.root, logical)
+		if w.followSymlinks && d.Type()&fs.ModeSymlink != 0 {
+			return w.followSymlink(ctx, logical, rel, path, d)
+		}
+
+		if w.ignoredFile(w.ignores, logical, rel, d) {
+			return nil
+		}
+		return w.visitFile(logical, rel, path, d)
+	})
+}
+
+// visitFile calls visit for a file unless its real path was already visited
+// under another name. rel is the logical path relative to the workspace root,
+// with forward slashes.
+func (w *workspaceWalker) visitFile(logical, rel, real string, d fs.DirEntry) error {
+	if w.visitedFiles != nil {
+		real = filepath.Clean(real)
+		if w.visitedFiles[real] {
+			w.summary.duplicateFiles++
+			return nil
+		}
+		w.visitedFiles[real] = true
+	}
+	return w.visit(logical, rel, d)
+}
+
+// logicalPath maps a path under realRoot to the same path under logicalRoot.
+func (w *workspaceWalker) logicalPath(logicalRoot, realRoot, path string) string {
+	if realRoot == logicalRoot {
+		return path
+	}
+	rel, err := filepath.Rel(realRoot, path)
+	if err != nil {
+		return path
+	}
+	return filepath.Join(logicalRoot, rel)
+}
+
+// ignoredFile reports whether a file is excluded by the ignore rules. A
+// provenance file excluded by .gitignore is reported, since it exists locally
+// but will never be committed.
+func (w *workspaceWalker) ignoredFile(ignores *ignoreMatcher, logical, rel string, d fs.DirEntry) bool {
+	if ignores == nil {
+		return false
+	}
+	ignored, rule := ignores.match(rel, false)
+	if !ignored {
+		return false
+	}
+
+	w.summary.filesIgnored++
+	if rule.fromGitignore() && w.isProvenance(rel) {
+		w.reportGitignoredProvenance(logical, rule)
+	}
+	return true
+}
+
+// isProvenance reports whether a file would be classified as provenance.
+func (w *workspaceWalker) isProvenance(rel string) bool {
+	return w.provenance.match(rel)
+}
+
+// findIgnoredProvenance reports the provenance files under a directory
+// pruned by a .gitignore rule. Git cannot re-include files below an excluded
+// directory, so every one of them is excluded by that rule. The directory is
+// only listed, honoring skip_dirs and max_depth; symlinks are not followed.
+func (w *workspaceWalker) findIgnoredProvenance(ctx context.Context, logicalDir, relDir, dir string, rule *ignoreRule) {
+	_ = w.findings.files().WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		sub, relErr := filepath.Rel(dir, path)
+		if relErr != nil {
+			return nil
+		}
+		rel := relDir + "/" + filepath.ToSlash(sub)
+		if d.IsDir() {
+			if w.skipDirs.matches(d.Name(), rel) || (w.maxDepth >= 0 && strings.Count(rel, "/")+1 > w.maxDepth) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && w.isProvenance(rel) {
+			w.reportGitignoredProvenance(filepath.Join(logicalDir, sub), rule)
+		}
+		return nil
+	})
+}
+
+// reportGitignoredProvenance reports a provenance file excluded by a
+// .gitignore rule: it exists locally but will never be committed.
+func (w *workspaceWalker) reportGitignoredProvenance(logical string, rule *ignoreRule) {
+	w.findings.Finding(
+		"PROV-006",
+		sdk.SeverityMedium,
+		sdk.ConfidenceHigh,
+		"Provenance file is gitignored and will not be committed",
+	).
+		At(logical, 0, 0).
+		WithMetadata("type", "gitignored_provenance").
+		WithMetadata("ignore_pattern", rule.pattern).
+		WithMetadata("ignore_source", workspacePath(w.findings.root, rule.source)).
+		Done()
+}
+
+// followSymlink resolves a symlink found during the walk. Directory targets
+// are walked once under the link's path, file targets are visited under the
+// link's path, and dangling links named like provenance files are reported.
+func (w *workspaceWalker) followSymlink(ctx context.Context, logical, rel, path string, d fs.DirEntry) error {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		w.summary.danglingSymlinks++
+		if w.isProvenance(rel) {
+			w.findings.Finding(
+				"PROV-005",
+				sdk.SeverityLow,
+				sdk.ConfidenceHigh,
+				"Dangling symlink matches provenance naming convention; the attestation it points to is missing",
+			).
+				At(logical, 0, 0).
+				WithMetadata("type", "dangling_symlink").
+				WithMetadata("error", err.Error()).
+				Done()
+		}
+		return nil
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		w.summary.walkErrors++
+		return nil
+	}
+	if !info.IsDir() {
+		if w.ignoredFile(w.ignores, logical, rel, d) {
+			return nil
+		}
+		return w.visitFile(logical, rel, target, d)
+	}
+
+	if w.skipDirs.matches(d.Name(), rel) {
+		w.summary.dirsSkipped++
+		return nil
+	}
+	if w.visited[target] {
+		return nil
+	}
+	w.summary.symlinksFollowed++
+	return w.walkTree(ctx, logical, target)
+}
+
+// dirMatcher decides whether a directory is pruned from the walk. Entries
+// without a slash are matched against the directory name, as exact names or
+// globs; entries with a slash are globs over the workspace-relative path.
+type dirMatcher struct {
+	names    map[string]bool
+	patterns []string
+}
+
+// newDirMatcher merges extra entries with the default skipped directories,
+// or uses only the extra entries when replace is set.
+func newDirMatcher(extra []string, replace bool) (*dirMatcher, error) {
+	m := &dirMatcher{names: make(map[string]bool)}
+	if !replace {
+		for name := range skippedDirs {
+			m.names[name] = true
+		}
+	}
+	for _, entry := range extra {
+		entry = strings.Trim(filepath.ToSlash(entry), "/")
+		if _, err := path.Match(entry, ""); err != nil {
+			return nil, fmt.Errorf("invalid skip_dirs pattern %q: %w", entry, err)
+		}
+		if strings.ContainsAny(entry, "/*?[") {
+			m.patterns = append(m.patterns, entry)
+		} else {
+			m.names[entry] = true
+		}
+	}
+	return m, nil
+}
+
+// matches reports whether the directory with the given name and
+// workspace-relative slash path should be skipped. A nil matcher applies the
+// default skipped directories.
+func (m *dirMatcher) matches(name, rel string) bool {
+	if m == nil {
+		return skippedDirs[name]
+	}
+	if m.names[name] {
+		return true
+	}
+	for _, pattern := range m.patterns {
+		subject := name
+		if strings.Contains(pattern, "/") {
+			subject = rel
+		}
+		if matched, _ := path.Match(pattern, subject); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func symlinkOrSkip(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+}
+
+func writeFile(t testing.TB, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanFollowSymlinkedAttestationsDirectory(t *testing.T) {
+	base := t.TempDir()
+	workspace := filepath.Join(base, "repo")
+	shared := filepath.Join(base, "shared", "attestations")
+
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tgo build .\n")
+	writeFile(t, filepath.Join(shared, "release.intoto.jsonl"), `{"_type":"https://in-toto.io/Statement/v0.1","subject":[]}`+"\n")
+	symlinkOrSkip(t, filepath.Join("..", "shared", "attestations"), filepath.Join(workspace, "attestations"))
+
+	client := testClient(t)
+
+	resp := invokeScan(t, client, workspace)
+	if len(findByRule(resp.GetFindings(), "PROV-001")) == 0 {
+		t.Fatal("expected PROV-001 when symlinks are not followed")
+	}
+
+	resp = invokeScanWithInput(t, client, map[string]any{
+		"workspace_root":  workspace,
+		"follow_symlinks": true,
+	})
+	if found := findByRule(resp.GetFindings(), "PROV-001"); len(found) != 0 {
+		t.Errorf("expected no PROV-001 when following symlinks, got %d", len(found))
+	}
+
+	found := findByRule(resp.GetFindings(), "PROV-002")
+	if len(found) != 1 {
+		t.Fatalf("expected one PROV-002 for the linked statement, got %d", len(found))
+	}
+	want := "attestations/release.intoto.jsonl"
+	if got := found[0].GetLocation().GetFilePath(); got != want {
+		t.Errorf("finding path = %q, want path under the workspace %q", got, want)
+	}
+}
+
+func TestScanFollowSymlinksBreaksCycles(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "sub", "provenance.json"), testStatement)
+	symlinkOrSkip(t, "..", filepath.Join(workspace, "sub", "loop"))
+	symlinkOrSkip(t, workspace, filepath.Join(workspace, "self"))
+
+	client := testClient(t)
+	resp := invokeScanWithInput(t, client, map[string]any{
+		"workspace_root":  workspace,
+		"follow_symlinks": true,
+	})
+
+	summary := findByRule(resp.GetFindings(), summaryRuleID)
+	if len(summary) != 1 {
+		t.Fatalf("expected exactly one %s summary finding, got %d", summaryRuleID, len(summary))
+	}
+	if got := summary[0].GetMetadata()["provenance_files_scanned"]; got != "1" {
+		t.Errorf("provenance_files_scanned = %q, want 1 (cycle walked more than once)", got)
+	}
+}
+
+func TestScanReportsDanglingProvenanceSymlink(t *testing.T) {
+	workspace := t.TempDir()
+	symlinkOrSkip(t, filepath.Join(workspace, "missing.json"), filepath.Join(workspace, "provenance.json"))
+	symlinkOrSkip(t, filepath.Join(workspace, "missing"), filepath.Join(workspace, "unrelated"))
+
+	client := testClient(t)
+	resp := invokeScanWithInput(t, client, map[string]any{
+		"workspace_root":  workspace,
+		"follow_symlinks": true,
+	})
+
+	found := findByRule(resp.GetFindings(), "PROV-005")
+	if len(found) != 1 {
+		t.Fatalf("expected exactly one PROV-005 finding, got %d", len(found))
+	}
+	if !strings.HasSuffix(found[0].GetLocation().GetFilePath(), "provenance.json") {
+		t.Errorf("unexpected location %q", found[0].GetLocation().GetFilePath())
+	}
+
+	summary := findByRule(resp.GetFindings(), summaryRuleID)
+	if got := summary[0].GetMetadata()["dangling_symlinks"]; got != "2" {
+		t.Errorf("dangling_symlinks = %q, want 2", got)
+	}
+}
+
+func TestScanPrunesDefaultBuildOutputDirs(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "bazel-out", "k8-fastbuild", "bin", "Dockerfile"), "FROM alpine:latest\n")
+	writeFile(t, filepath.Join(workspace, "target", "Makefile"), "build:\n\tcurl https://example.com/x.sh | sh\n")
+
+	client := testClient(t)
+	resp := invokeScan(t, client, workspace)
+
+	if got := len(withoutSummary(resp.GetFindings())); got != 0 {
+		t.Errorf("expected bazel-out and target trees to be pruned, got %d findings", got)
+	}
+	summary := findByRule(resp.GetFindings(), summaryRuleID)
+	if got := summary[0].GetMetadata()["dirs_skipped"]; got != "2" {
+		t.Errorf("dirs_skipped = %q, want 2", got)
+	}
+}
+
+func TestScanSkipDirsInput(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "third_party", "lib", "Dockerfile"), "FROM alpine:latest\n")
+	writeFile(t, filepath.Join(workspace, "gen-proto", "Dockerfile"), "FROM alpine:latest\n")
+	writeFile(t, filepath.Join(workspace, "services", "legacy", "Dockerfile"), "FROM alpine:latest\n")
+	writeFile(t, filepath.Join(workspace, "vendor", "Dockerfile"), "FROM alpine:latest\n")
+
+	client := testClient(t)
+
+	tests := []struct {
+		name   string
+		input  map[string]any
+		expect int
+	}{
+		{"defaults", map[string]any{}, 3},
+		{"names and globs", map[string]any{"skip_dirs": []any{"third_party", "gen-*", "services/legacy"}}, 0},
+		{"comma separated", map[string]any{"skip_dirs": "third_party,gen-*"}, 1},
+		{"replace defaults", map[string]any{"skip_dirs": []any{"third_party"}, "replace_skip_dirs": true}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input["workspace_root"] = workspace
+			resp := invokeScanWithInput(t, client, tt.input)
+			if got := len(findByRule(resp.GetFindings(), "PROV-003")); got != tt.expect {
+				t.Errorf("got %d PROV-003 findings, want %d", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestScanMaxDepth(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), "FROM alpine:latest\n")
+	writeFile(t, filepath.Join(workspace, "a", "Dockerfile"), "FROM alpine:latest\n")
+	writeFile(t, filepath.Join(workspace, "a", "b", "Dockerfile"), "FROM alpine:latest\n")
+	writeFile(t, filepath.Join(workspace, "a", "b", "c", "Dockerfile"), "FROM alpine:latest\n")
+
+	client := testClient(t)
+
+	tests := []struct {
+		maxDepth any
+		findings int
+		pruned   string
+	}{
+		{0, 1, "1"},
+		{1, 2, "1"},
+		{"2", 3, "1"},
+		{10, 4, "0"},
+	}
+
+	for _, tt := range tests {
+		resp := invokeScanWithInput(t, client, map[string]any{
+			"workspace_root": workspace,
+			"max_depth":      tt.maxDepth,
+		})
+		if got := len(findByRule(resp.GetFindings(), "PROV-003")); got != tt.findings {
+			t.Errorf("max_depth=%v: got %d PROV-003 findings, want %d", tt.maxDepth, got, tt.findings)
+		}
+		summary := findByRule(resp.GetFindings(), summaryRuleID)
+		if got := summary[0].GetMetadata()["depth_pruned"]; got != tt.pruned {
+			t.Errorf("max_depth=%v: depth_pruned = %q, want %q", tt.maxDepth, got, tt.pruned)
+		}
+	}
+}
+
+func TestScanSkipsOversizedFiles(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "attestation.json"), `{"rows":[`+strings.Repeat(`{"id":1},`, 100)+`{"id":2}]}`)
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), "FROM alpine:latest\n"+strings.Repeat("# padding\n", 50))
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tgo build .\n")
+
+	client := testClient(t)
+	resp := invokeScanWithInput(t, client, map[string]any{
+		"workspace_root": workspace,
+		"max_file_size":  200,
+	})
+
+	found := findByRule(resp.GetFindings(), "PROV-007")
+	if len(found) != 1 {
+		t.Fatalf("expected one PROV-007 finding for the oversized provenance file, got %d", len(found))
+	}
+	if found[0].GetMetadata()["max_file_size"] != "200" {
+		t.Errorf("max_file_size = %q, want 200", found[0].GetMetadata()["max_file_size"])
+	}
+	if len(findByRule(resp.GetFindings(), "PROV-002")) != 0 {
+		t.Error("an oversized provenance file must not be validated")
+	}
+	if len(findByRule(resp.GetFindings(), "PROV-001")) == 0 {
+		t.Error("an oversized provenance file must not count as provenance")
+	}
+	if len(findByRule(resp.GetFindings(), "PROV-003")) != 0 {
+		t.Error("an oversized build config must not be scanned")
+	}
+
+	summary := findByRule(resp.GetFindings(), summaryRuleID)
+	if got := summary[0].GetMetadata()["files_oversized"]; got != "2" {
+		t.Errorf("files_oversized = %q, want 2", got)
+	}
+}
+
+func TestScanSkipsBinaryBuildConfigs(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), "FROM alpine:latest\n\x00\x01\x02binary")
+
+	client := testClient(t)
+	resp := invokeScan(t, client, workspace)
+
+	if len(findByRule(resp.GetFindings(), "PROV-003")) != 0 {
+		t.Error("expected a binary build config to be skipped")
+	}
+	summary := findByRule(resp.GetFindings(), summaryRuleID)
+	if got := summary[0].GetMetadata()["binary_files_skipped"]; got != "1" {
+		t.Errorf("binary_files_skipped = %q, want 1", got)
+	}
+}
+
+// removePermissionsOrSkip makes path inaccessible for the rest of the test,
+// skipping when the platform or user ignores file modes.
+func removePermissionsOrSkip(t *testing.T, path string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	if err := os.Chmod(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(path, 0o755) })
+	if f, err := os.Open(path); err == nil {
+		_ = f.Close()
+		t.Skip("running with privileges that bypass file permissions")
+	}
+}
+
+func TestScanReportsUnreadableProvenance(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tgo build .\n")
+	provenance := filepath.Join(workspace, "provenance.json")
+	writeFile(t, provenance, testStatement)
+	removePermissionsOrSkip(t, provenance)
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	found := findByRule(resp.GetFindings(), "PROV-008")
+	if len(found) != 1 {
+		t.Fatalf("expected one PROV-008 for the unreadable file, got %d", len(found))
+	}
+	if found[0].GetMetadata()["error"] == "" {
+		t.Error("expected the read error in PROV-008 metadata")
+	}
+	if len(findByRule(resp.GetFindings(), "PROV-001")) != 1 {
+		t.Error("expected PROV-001 since the only provenance file is unreadable")
+	}
+	summary := findByRule(resp.GetFindings(), summaryRuleID)
+	if got := summary[0].GetMetadata()["unreadable_files"]; got != "1" {
+		t.Errorf("unreadable_files = %q, want 1", got)
+	}
+}
+
+func TestScanRecordsInaccessibleDirectories(t *testing.T) {
+	workspace := t.TempDir()
+	attestations := filepath.Join(workspace, "attestations")
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), "FROM scratch\n")
+	writeFile(t, filepath.Join(attestations, "provenance.json"), testStatement)
+	removePermissionsOrSkip(t, attestations)
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	summary := findByRule(resp.GetFindings(), summaryRuleID)
+	if len(summary) != 1 {
+		t.Fatalf("expected exactly one %s summary finding, got %d", summaryRuleID, len(summary))
+	}
+	meta := summary[0].GetMetadata()
+	if meta["inaccessible_dirs"] != "1" || meta["inaccessible_dir_paths"] != "attestations" {
+		t.Errorf("inaccessible_dirs = %q, paths = %q; want 1, attestations", meta["inaccessible_dirs"], meta["inaccessible_dir_paths"])
+	}
+	if len(findByRule(resp.GetFindings(), "PROV-001")) != 1 {
+		t.Error("expected PROV-001 since no provenance could be read")
+	}
+}
+
+func TestScanMultiCategoryFileAnalyzedOnce(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".github", "workflows", "cloudbuild.yaml"),
+		"steps:\n- run: curl -sSL https://example.com/install.sh | sh\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	if found := findByRule(resp.GetFindings(), "PROV-003"); len(found) != 1 {
+		t.Errorf("expected one PROV-003 for a file matching build and CI patterns, got %d", len(found))
+	}
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["build_config_files_scanned"] != "1" || meta["ci_config_files_scanned"] != "1" {
+		t.Errorf("build_config_files_scanned = %q, ci_config_files_scanned = %q; want 1 and 1",
+			meta["build_config_files_scanned"], meta["ci_config_files_scanned"])
+	}
+}
+
+func TestScanFileReachableThroughSymlinkAnalyzedOnce(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "build", "Makefile"), "build:\n\tcurl -sSL https://example.com/x.sh | sh\n")
+	symlinkOrSkip(t, filepath.Join("build", "Makefile"), filepath.Join(workspace, "Makefile"))
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{
+		"workspace_root":  workspace,
+		"follow_symlinks": true,
+	})
+
+	if found := findByRule(resp.GetFindings(), "PROV-003"); len(found) != 1 {
+		t.Errorf("expected one PROV-003 for a file reachable twice, got %d", len(found))
+	}
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if got := meta["duplicate_files_skipped"]; got != "1" {
+		t.Errorf("duplicate_files_skipped = %q, want 1", got)
+	}
+}
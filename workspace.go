@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// resolveWorkspaceRoot determines the directory a scan walks. The
+// workspace_root input takes precedence over the host-provided workspace;
+// when both are set, a relative input is resolved against the host workspace
+// and the result must stay inside it. The returned path is absolute and
+// cleaned but not symlink-resolved, so findings report paths as the caller
+// named them. An empty result means no workspace was given.
+func resolveWorkspaceRoot(req sdk.ToolRequest) (string, error) {
+	input, _ := req.Input["workspace_root"].(string)
+	base := req.WorkspaceRoot
+
+	root := input
+	switch {
+	case root == "":
+		root = base
+	case base != "" && !filepath.IsAbs(root):
+		root = filepath.Join(base, root)
+	}
+	if root == "" {
+		return "", nil
+	}
+
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("resolving workspace_root %q: %w", root, err)
+	}
+	root = abs
+
+	info, err := os.Stat(root)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "", fmt.Errorf("workspace_root %q does not exist", root)
+	case err != nil:
+		return "", fmt.Errorf("workspace_root %q: %w", root, err)
+	case !info.IsDir():
+		return "", fmt.Errorf("workspace_root %q is not a directory", root)
+	}
+
+	if input != "" && base != "" {
+		absBase, err := filepath.Abs(base)
+		if err != nil {
+			return "", fmt.Errorf("resolving host workspace %q: %w", base, err)
+		}
+		if !withinDir(realPath(absBase), realPath(root)) {
+			return "", fmt.Errorf("workspace_root %q is outside the host workspace %q", root, absBase)
+		}
+	}
+	return root, nil
+}
+
+// resolveWorkspaceArchive determines the archive a scan reads the workspace
+// from instead of a directory, or "" when workspace_archive is not set. It
+// excludes workspace_root and, like it, is resolved against the host
+// workspace when relative and must then stay inside it. The archive must be
+// an existing tar, gzipped tar, or zip file.
+func resolveWorkspaceArchive(req sdk.ToolRequest) (string, error) {
+	input, _ := req.Input["workspace_archive"].(string)
+	if input == "" {
+		return "", nil
+	}
+	if root, _ := req.Input["workspace_root"].(string); root != "" {
+		return "", errors.New("workspace_archive and workspace_root are mutually exclusive")
+	}
+	if !isArchiveName(input) {
+		return "", fmt.Errorf("workspace_archive %q is not a .tar, .tar.gz, .tgz, or .zip file", input)
+	}
+
+	archive := input
+	base := req.WorkspaceRoot
+	if base != "" && !filepath.IsAbs(archive) {
+		archive = filepath.Join(base, archive)
+	}
+	abs, err := filepath.Abs(archive)
+	if err != nil {
+		return "", fmt.Errorf("resolving workspace_archive %q: %w", archive, err)
+	}
+	archive = abs
+
+	info, err := os.Stat(archive)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "", fmt.Errorf("workspace_archive %q does not exist", archive)
+	case err != nil:
+		return "", fmt.Errorf("workspace_archive %q: %w", archive, err)
+	case !info.Mode().IsRegular():
+		return "", fmt.Errorf("workspace_archive %q is not a regular file", archive)
+	}
+
+	if base != "" {
+		absBase, err := filepath.Abs(base)
+		if err != nil {
+			return "", fmt.Errorf("resolving host workspace %q: %w", base, err)
+		}
+		if !withinDir(realPath(absBase), realPath(archive)) {
+			return "", fmt.Errorf("workspace_archive %q is outside the host workspace %q", archive, absBase)
+		}
+	}
+	return archive, nil
+}
+
+// errFileTooLarge is wrapped by readBoundedFile for a file over its limit.
+var errFileTooLarge = errors.New("file too large")
+
+// readBoundedFile reads the file at path, failing with errFileTooLarge
+// instead of loading a file larger than limit bytes, including one that grew
+// after it was stat'ed.
+func readBoundedFile(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > limit {
+		return nil, fmt.Errorf("%s is %d bytes, exceeds the %d byte limit: %w", path, info.Size(), limit, errFileTooLarge)
+	}
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s exceeds the %d byte limit: %w", path, limit, errFileTooLarge)
+	}
+	return data, nil
+}
+
+// realPath resolves symlinks in p, falling back to p when it cannot be
+// resolved.
+func realPath(p string) string {
+	if resolved, err := filepath.EvalSymlinks(p); err == nil {
+		return resolved
+	}
+	return p
+}
+
+// withinDir reports whether p is dir or lies beneath it. Both paths must be
+// absolute and cleaned.
+func withinDir(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// slashName normalizes a path-like name read from file content, such as an
+// attestation subject or archive entry, to forward slashes. Tools on Windows
+// write such names with backslashes, which filepath.ToSlash only converts
+// when running on Windows; converting them on every OS keeps findings the
+// same wherever the scan runs.
+func slashName(name string) string {
+	return strings.ReplaceAll(name, `\`, "/")
+}
+
+// workspacePath returns p relative to root with forward slashes, or "." for
+// the root itself, so locations do not depend on where the workspace was
+// checked out. Paths outside root, or any path when root is empty, are only
+// slash-normalized.
+func workspacePath(root, p string) string {
+	if root == "" {
+		return filepath.ToSlash(p)
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(p)
+	}
+	return path.Clean(filepath.ToSlash(rel))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+func TestResolveWorkspaceRoot(t *testing.T) {
+	host := t.TempDir()
+	writeFile(t, filepath.Join(host, "repo", "Makefile"), "build:\n")
+	outside := t.TempDir()
+
+	tests := []struct {
+		name  string
+		input string
+		host  string
+		want  string
+	}{
+		{"host only", "", host, host},
+		{"input only", filepath.Join(host, "repo"), "", filepath.Join(host, "repo")},
+		{"input takes precedence", filepath.Join(host, "repo"), host, filepath.Join(host, "repo")},
+		{"relative input resolves against host", "repo", host, filepath.Join(host, "repo")},
+		{"dot segments are cleaned", filepath.Join(host, "repo", "..", "repo", "."), "", filepath.Join(host, "repo")},
+		{"neither set", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveWorkspaceRoot(sdk.ToolRequest{
+				Input:         map[string]any{"workspace_root": tt.input},
+				WorkspaceRoot: tt.host,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveWorkspaceRoot() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	errTests := []struct {
+		name    string
+		input   string
+		host    string
+		message string
+	}{
+		{"missing", filepath.Join(host, "missing"), "", "does not exist"},
+		{"file", filepath.Join(host, "repo", "Makefile"), "", "not a directory"},
+		{"escapes host via dot-dot", "..", host, "outside the host workspace"},
+		{"absolute outside host", outside, host, "outside the host workspace"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolveWorkspaceRoot(sdk.ToolRequest{
+				Input:         map[string]any{"workspace_root": tt.input},
+				WorkspaceRoot: tt.host,
+			})
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected error containing %q, got %v", tt.message, err)
+			}
+		})
+	}
+}
+
+func TestResolveWorkspaceRootRejectsSymlinkEscape(t *testing.T) {
+	host := t.TempDir()
+	outside := t.TempDir()
+	symlinkOrSkip(t, outside, filepath.Join(host, "escape"))
+
+	_, err := resolveWorkspaceRoot(sdk.ToolRequest{
+		Input:         map[string]any{"workspace_root": "escape"},
+		WorkspaceRoot: host,
+	})
+	if err == nil {
+		t.Fatal("expected a symlink leading outside the host workspace to be rejected")
+	}
+}
+
+func TestResolveWorkspaceRootRelativeToCWD(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := resolveWorkspaceRoot(sdk.ToolRequest{Input: map[string]any{"workspace_root": "testdata"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(cwd, "testdata"); got != want {
+		t.Errorf("resolveWorkspaceRoot() = %q, want %q", got, want)
+	}
+}
+
+func TestWorkspacePath(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "src", "repo")
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"root itself", root, "."},
+		{"nested file", filepath.Join(root, "attestations", "provenance.json"), "attestations/provenance.json"},
+		{"outside root", filepath.Join(string(filepath.Separator), "src", "other", "provenance.json"), filepath.ToSlash(filepath.Join(string(filepath.Separator), "src", "other", "provenance.json"))},
+		{"inline location", inlineLocation, inlineLocation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := workspacePath(root, tt.path); got != tt.want {
+				t.Errorf("workspacePath(%q, %q) = %q, want %q", root, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanReportsWorkspaceRelativePaths(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "build", "Makefile"), "build:\n\tcurl -sSL https://example.com/x.sh | sh\n")
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	want := map[string]string{
+		"PROV-001":    ".",
+		"PROV-003":    "build/Makefile",
+		summaryRuleID: ".",
+	}
+	for rule, path := range want {
+		found := findByRule(resp.GetFindings(), rule)
+		if len(found) == 0 {
+			t.Fatalf("expected a %s finding", rule)
+		}
+		if got := found[0].GetLocation().GetFilePath(); got != path {
+			t.Errorf("%s location = %q, want %q", rule, got, path)
+		}
+	}
+
+	summary := findByRule(resp.GetFindings(), summaryRuleID)
+	if got := summary[0].GetMetadata()["workspace_root"]; got != workspace {
+		t.Errorf("workspace_root metadata = %q, want %q", got, workspace)
+	}
+}
+
+func TestSlashName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"dist/app.tar.gz", "dist/app.tar.gz"},
+		{`dist\app.tar.gz`, "dist/app.tar.gz"},
+		{`.\bin\app.exe`, "./bin/app.exe"},
+		{`C:\build\out\app`, "C:/build/out/app"},
+	}
+	for _, tt := range tests {
+		if got := slashName(tt.name); got != tt.want {
+			t.Errorf("slashName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScanBackslashSubjectNames(t *testing.T) {
+	const wrong = "0000000000000000000000000000000000000000000000000000000000000000"
+	workspace := t.TempDir()
+	writeZip(t, filepath.Join(workspace, "dist", "app.zip"),
+		archiveEntry{`bin\app.exe`, "MZ"},
+		archiveEntry{"app.intoto.jsonl", subjectStatement(`bin\\app.exe`, wrong) + "\n"},
+	)
+
+	resp := invokeScanWithInput(t, testClient(t), map[string]any{"workspace_root": workspace, "scan_archives": true})
+
+	found := findByRule(resp.GetFindings(), subjectDigestMismatchRuleID)
+	if len(found) != 1 {
+		t.Fatalf("expected one %s finding, got %d", subjectDigestMismatchRuleID, len(found))
+	}
+	if got := found[0].GetMetadata()["artifact"]; got != "dist/app.zip!/bin/app.exe" {
+		t.Errorf("artifact = %q, want dist/app.zip!/bin/app.exe", got)
+	}
+}
+
+// TestScanWindowsCheckoutMatchesLinux scans the same tree with LF and CRLF
+// line endings, as Git checks text files out on Windows, and expects the
+// same findings.
+func TestScanWindowsCheckoutMatchesLinux(t *testing.T) {
+	files := map[string]string{
+		"Makefile":                      "build:\n\tcurl -sSL https://example.com/x.sh | sh\n\t@echo built on $(DATE)\n",
+		"Dockerfile":                    "FROM golang:latest\nRUN apt-get install -y curl\nCOPY <<EOF /notes\nlatest\nEOF\n",
+		".github/workflows/release.yml": "on: push\njobs:\n  build:\n    steps:\n      - run: |\n          docker pull app:latest\n",
+		".gitignore":                    "dist/\n",
+		"dist/app.intoto.jsonl":         testStatement + "\n",
+		"release/app.intoto.jsonl":      testStatement + "\n" + testStatement + "\n",
+	}
+	client := testClient(t)
+
+	scan := func(eol string) map[string]bool {
+		workspace := t.TempDir()
+		for name, content := range files {
+			writeFile(t, filepath.Join(workspace, filepath.FromSlash(name)), strings.ReplaceAll(content, "\n", eol))
+		}
+		resp := invokeScan(t, client, workspace)
+		got := make(map[string]bool)
+		for _, f := range withoutSummary(resp.GetFindings()) {
+			meta := f.GetMetadata()
+			keys := make([]string, 0, len(meta))
+			for k, v := range meta {
+				keys = append(keys, k+"="+v)
+			}
+			sort.Strings(keys)
+			got[fmt.Sprintf("%s %s:%d %s %v %s", f.GetRuleId(), f.GetLocation().GetFilePath(),
+				f.GetLocation().GetStartLine(), f.GetMessage(), f.GetConfidence(), strings.Join(keys, ";"))] = true
+		}
+		return got
+	}
+
+	linux, windows := scan("\n"), scan("\r\n")
+	if len(linux) == 0 {
+		t.Fatal("expected findings from the fixture")
+	}
+	for key := range linux {
+		if !windows[key] {
+			t.Errorf("missing with CRLF line endings: %s", key)
+		}
+	}
+	for key := range windows {
+		if !linux[key] {
+			t.Errorf("only with CRLF line endings: %s", key)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspacePathWindows(t *testing.T) {
+	tests := []struct {
+		name string
+		root string
+		path string
+		want string
+	}{
+		{"drive letter", `C:\src\repo`, `C:\src\repo\attestations\provenance.json`, "attestations/provenance.json"},
+		{"drive letter case", `C:\src\repo`, `c:\src\repo\provenance.json`, "provenance.json"},
+		{"drive root itself", `C:\`, `C:\`, "."},
+		{"other drive", `C:\src\repo`, `D:\provenance.json`, "D:/provenance.json"},
+		{"UNC root", `\\server\share\repo`, `\\server\share\repo\ci\Makefile`, "ci/Makefile"},
+		{"UNC root itself", `\\server\share\repo`, `\\server\share\repo`, "."},
+		{"UNC other share", `\\server\share\repo`, `\\server\other\provenance.json`, "//server/other/provenance.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := workspacePath(tt.root, tt.path); got != tt.want {
+				t.Errorf("workspacePath(%q, %q) = %q, want %q", tt.root, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyWindowsPaths(t *testing.T) {
+	root := `C:\src\repo`
+	tests := []struct {
+		path string
+		want fileKind
+	}{
+		{`C:\src\repo\.github\workflows\release.yml`, kindCIConfig},
+		{`C:\src\repo\attestations\build.json`, kindProvenance},
+		{`C:\src\repo\services\api\Makefile`, kindBuildConfig},
+	}
+	provenance := mustProvenanceMatcher(provenanceFilePatterns, []string{"attestations"})
+	for _, tt := range tests {
+		rel := slashRel(root, tt.path)
+		if got := classifyFile(rel, filepath.Base(tt.path), provenance); !got.has(tt.want) {
+			t.Errorf("classifyFile(%q) = %b, want it to include %b", rel, got, tt.want)
+		}
+	}
+}
+
+func TestSkipDirsWindowsSeparators(t *testing.T) {
+	m, err := newDirMatcher([]string{`services\legacy`}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.matches("legacy", slashRel(`C:\src\repo`, `C:\src\repo\services\legacy`)) {
+		t.Error(`expected skip_dirs entry services\legacy to match`)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// workspaceScan is what the walk and the file analyzers leave for the
+// cross-file checks.
+type workspaceScan struct {
+	root     string
+	opts     scanOptions
+	findings *findingSet
+	summary  *scanSummary
+	// hasBuildConfig is set when any build or CI config was walked, and
+	// hasCIConfig when any CI config was; buildConfigs lists the build
+	// configs.
+	hasBuildConfig bool
+	hasCIConfig    bool
+	buildConfigs   []buildConfigRef
+	// configPaths holds the build and CI configs and action definitions.
+	configPaths map[string]bool
+}
+
+// workspaceCheck is a cross-file rule, run once every file has been
+// analyzed. A check that returns an error interrupts the scan.
+type workspaceCheck func(ctx context.Context, ws *workspaceScan) error
+
+// workspaceChecks lists the cross-file rules in the order they run. Checks
+// that depend on others' results, such as confirmations, come after them.
+var workspaceChecks = []workspaceCheck{
+	checkMissingAttestation,
+	checkMissingCI,
+	checkUnmatchedPolicies,
+	checkMissingSBOM,
+	checkImageAttestations,
+	checkIndexSubjects,
+	checkLockfileMismatches,
+	checkConflictingAttestations,
+	checkChecksumGaps,
+	checkAttestationThreshold,
+	checkStaleProvenance,
+	checkWorkflowCaches,
+	checkSHAPinningRatio,
+	checkPyPIAttestations,
+	checkWorkflowIdentities,
+	checkDormantWorkflows,
+	checkVendoredBinaries,
+	checkSourceRevisions,
+	checkChecksumChains,
+	checkAttestationPairs,
+	checkArchiveSubjects,
+	checkConfirmations,
+}
+
+// runWorkspaceChecks runs the cross-file rules. Each needs every file to
+// have been analyzed, so none runs once the scan was cut short.
+func runWorkspaceChecks(ctx context.Context, ws *workspaceScan) {
+	for _, check := range workspaceChecks {
+		if ws.summary.interrupted != nil {
+			return
+		}
+		if err := check(ctx, ws); err != nil {
+			ws.summary.interrupted = err
+		}
+	}
+}
+
+// checkMissingAttestation flags build configs without readable
+// attestations. Unreadable files were reported on their own. When
+// downstream verification exists, attestations are likely published
+// elsewhere rather than committed, so confidence is lowered. Severity
+// follows what the builds publish: artifacts consumed outside the build
+// host need provenance most, and a workspace that builds no artifacts at
+// all, such as a library, needs it least. External publication is not
+// escalated when CI generates provenance, which is then published with the
+// artifacts rather than committed.
+func checkMissingAttestation(_ context.Context, ws *workspaceScan) error {
+	summary := ws.summary
+	if !ws.hasBuildConfig || summary.attestationFiles != 0 {
+		return nil
+	}
+	confidence := sdk.ConfidenceMedium
+	if summary.verificationDetected() {
+		confidence = sdk.ConfidenceLow
+	}
+	publication, targets := summary.publication()
+	severity := sdk.SeverityHigh
+	message := "No SLSA attestation or provenance files found in workspace with build configuration"
+	switch publication {
+	case publicationExternal:
+		if summary.attestationSteps > 0 {
+			confidence = sdk.ConfidenceLow
+			message = "No SLSA attestation or provenance files found in workspace that publishes artifacts externally; CI generates provenance at build time"
+			break
+		}
+		severity = sdk.SeverityCritical
+		message = "No SLSA attestation or provenance files found in workspace that publishes artifacts externally"
+	case publicationNone:
+		severity = sdk.SeverityMedium
+	}
+	production, evidence := productionAssumed, []string(nil)
+	if !ws.opts.assumeProducesArtifacts {
+		production, evidence = summary.artifactProduction(ws.findings.files(), ws.root, ws.opts.maxFileSize)
+	}
+	if production == productionLibrary || production == productionUnknown {
+		severity = sdk.SeverityLow
+		message = "No SLSA attestation or provenance files found in workspace that shows no artifact production"
+	}
+	ws.findings.Finding("PROV-001", severity, confidence, message).
+		At(ws.root, 0, 0).
+		WithMetadata("type", "missing_attestation").
+		WithMetadata("verification_detected", strconv.FormatBool(summary.verificationDetected())).
+		WithMetadata("publication", publication).
+		WithMetadata("publish_targets", strings.Join(targets, ",")).
+		WithMetadata("publish_steps", strconv.Itoa(len(summary.publishSteps))).
+		WithMetadata("attestation_steps", strconv.Itoa(summary.attestationSteps)).
+		WithMetadata("artifact_production", production).
+		WithMetadata("artifact_evidence", strings.Join(evidence, ",")).
+		Done()
+	return nil
+}
+
+// checkMissingCI is its own rule, so teams that build elsewhere can disable
+// it and keep PROV-001.
+func checkMissingCI(_ context.Context, ws *workspaceScan) error {
+	if ws.opts.checkCI && len(ws.buildConfigs) > 0 && !ws.hasCIConfig {
+		reportMissingCI(ws.findings, ws.buildConfigs)
+	}
+	return nil
+}
+
+func checkUnmatchedPolicies(_ context.Context, ws *workspaceScan) error {
+	if len(ws.summary.imagePolicies) > 0 {
+		reportUnmatchedPolicies(ws.findings, ws.summary)
+	}
+	return nil
+}
+
+// checkMissingSBOM mirrors PROV-001 under its own rule, so either can be
+// disabled without the other.
+func checkMissingSBOM(_ context.Context, ws *workspaceScan) error {
+	s := ws.summary
+	if ws.opts.checkSBOM && ws.hasBuildConfig && s.sbomFiles == 0 && s.sbomAttestations == 0 && s.sbomSteps == 0 {
+		reportMissingSBOM(ws.findings, ws.root)
+	}
+	return nil
+}
+
+// checkImageAttestations correlates images with attestations, which needs
+// every attestation.
+func checkImageAttestations(_ context.Context, ws *workspaceScan) error {
+	if ws.opts.checkImages {
+		reportImageAttestations(ws.findings, ws.summary)
+	}
+	return nil
+}
+
+// checkIndexSubjects matches subjects against the indexes of every archive
+// and the builds of every config.
+func checkIndexSubjects(_ context.Context, ws *workspaceScan) error {
+	s := ws.summary
+	if len(s.subjectRecords) > 0 && (len(s.imageIndexes) > 0 || len(s.multiPlatformBuilds) > 0) {
+		reportIndexSubjects(ws.findings, s)
+	}
+	return nil
+}
+
+// checkLockfileMismatches compares lockfiles and provenance, which may be
+// analyzed in either order, once both are complete.
+func checkLockfileMismatches(_ context.Context, ws *workspaceScan) error {
+	if len(ws.summary.lockEntries) > 0 {
+		reportLockfileMismatches(ws.findings, ws.summary, ws.opts.minLockfileOverlap)
+	}
+	return nil
+}
+
+// checkConflictingAttestations can only find conflicts once every statement
+// has been parsed.
+func checkConflictingAttestations(_ context.Context, ws *workspaceScan) error {
+	if len(ws.summary.claims) > 1 {
+		reportConflictingAttestations(ws.findings, ws.summary)
+	}
+	return nil
+}
+
+// checkChecksumGaps skips checksums once attestations are generated, which
+// may be anywhere in the workspace.
+func checkChecksumGaps(_ context.Context, ws *workspaceScan) error {
+	s := ws.summary
+	if len(s.checksumGaps) > 0 && s.attestationFiles == 0 && s.attestationSteps == 0 {
+		reportChecksumGaps(ws.findings, s.checksumGaps)
+	}
+	return nil
+}
+
+// checkAttestationThreshold counts independent attestations across every
+// statement.
+func checkAttestationThreshold(_ context.Context, ws *workspaceScan) error {
+	if ws.opts.minAttestationsPerSubject > 1 && len(ws.summary.claims) > 0 {
+		reportAttestationThreshold(ws.findings, ws.summary, ws.opts.minAttestationsPerSubject)
+	}
+	return nil
+}
+
+// checkStaleProvenance judges staleness per provenance file, so every
+// statement must have been parsed.
+func checkStaleProvenance(_ context.Context, ws *workspaceScan) error {
+	if ws.opts.stalenessDays > 0 && len(ws.summary.statementTimes) > 0 {
+		reportStaleProvenance(ws.findings, ws.summary, time.Duration(ws.opts.stalenessDays)*24*time.Hour)
+	}
+	return nil
+}
+
+// checkWorkflowCaches matches cache readers and writers, which are shared
+// across workflows, once every workflow has been read.
+func checkWorkflowCaches(_ context.Context, ws *workspaceScan) error {
+	if len(ws.summary.workflowCaches) > 0 {
+		checkCacheSharing(ws.findings, ws.summary.workflowCaches)
+	}
+	return nil
+}
+
+// checkSHAPinningRatio sums up the pins of every CI config.
+func checkSHAPinningRatio(_ context.Context, ws *workspaceScan) error {
+	if ws.opts.minSHAPinned > 0 {
+		reportSHAPinningRatio(ws.findings, ws.summary.ciPins, ws.opts.minSHAPinned)
+	}
+	return nil
+}
+
+func checkPyPIAttestations(ctx context.Context, ws *workspaceScan) error {
+	if len(ws.summary.pypiAttestations) == 0 {
+		return nil
+	}
+	return verifyPyPIAttestations(ctx, ws.findings, ws.summary, ws.opts.maxFileSize)
+}
+
+func checkWorkflowIdentities(_ context.Context, ws *workspaceScan) error {
+	if len(ws.summary.workflowIdentities) > 0 {
+		verifyWorkflowIdentities(ws.findings, ws.summary)
+	}
+	return nil
+}
+
+func checkSourceRevisions(_ context.Context, ws *workspaceScan) error {
+	if len(ws.summary.sourceRevisions) > 0 {
+		verifySourceRevisions(ws.findings, ws.summary, ws.opts.maxFileSize)
+	}
+	return nil
+}
+
+// checkChecksumChains follows subjects naming checksums files ahead of the
+// pairing check, which leaves the artifacts they cover alone.
+func checkChecksumChains(ctx context.Context, ws *workspaceScan) error {
+	if len(ws.summary.subjectRecords) == 0 {
+		return nil
+	}
+	return verifyChecksumChains(ctx, ws.findings, ws.summary, ws.opts.maxFileSize)
+}
+
+// checkAttestationPairs verifies paired subjects against their own
+// artifact, ahead of the archive check searching around archives.
+func checkAttestationPairs(ctx context.Context, ws *workspaceScan) error {
+	if len(ws.summary.attestationPaths) == 0 {
+		return nil
+	}
+	return pairAttestations(ctx, ws.findings, ws.summary, ws.opts.attestationNaming, ws.opts.maxFileSize)
+}
+
+func checkArchiveSubjects(ctx context.Context, ws *workspaceScan) error {
+	if len(ws.summary.archives) == 0 {
+		return nil
+	}
+	return verifyArchiveSubjects(ctx, ws.findings, ws.summary, ws.opts.maxFileSize)
+}
+
+// checkConfirmations comes last so that every other check can veto a
+// confirmation.
+func checkConfirmations(_ context.Context, ws *workspaceScan) error {
+	if ws.opts.emitConfirmations {
+		reportConfirmations(ws.findings, ws.summary)
+	}
+	return nil
+}
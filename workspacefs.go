@@ -0,0 +1,479 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Hard caps on a workspace archive, which is held in memory while it is
+// scanned.
+const (
+	// maxWorkspaceArchiveEntries is the most entries a workspace archive
+	// may hold.
+	maxWorkspaceArchiveEntries = 200000
+	// maxWorkspaceArchiveBytes is the most decompressed bytes a workspace
+	// archive may hold in memory. Entries over max_file_size are not read,
+	// so they do not count against it.
+	maxWorkspaceArchiveBytes = 512 << 20
+	// archiveSniffSize is how much of an entry over max_file_size is kept,
+	// enough to sniff binaries, which are checked whatever their size.
+	archiveSniffSize = 512
+	// maxArchiveLinkDepth is the longest chain of symlink entries resolved.
+	maxArchiveLinkDepth = 40
+)
+
+// workspaceFS is the filesystem a scan reads the workspace from. Names are
+// OS paths under the workspace root, as the walker reports them.
+type workspaceFS interface {
+	Open(name string) (fs.File, error)
+	Stat(name string) (fs.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	WalkDir(root string, fn fs.WalkDirFunc) error
+}
+
+// osFS reads the workspace from disk.
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error)          { return os.Open(name) }
+func (osFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFS) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(root, fn)
+}
+
+// files returns the filesystem the findings' workspace is read from.
+func (s *findingSet) files() workspaceFS {
+	if s == nil || s.fsys == nil {
+		return osFS{}
+	}
+	return s.fsys
+}
+
+// archiveFS serves the entries of a workspace archive from memory under a
+// root named after the archive.
+type archiveFS struct {
+	root    string
+	entries map[string]*workspaceEntry
+	// linksSkipped counts symlink entries that point outside the archive
+	// root, at directories, or at missing entries.
+	linksSkipped int
+	// maxFileSize is the largest entry whose content is read; larger ones
+	// keep only their name, size, mode, and first bytes.
+	maxFileSize int64
+}
+
+// workspaceEntry is a file or directory of a workspace archive. Directories
+// hold the names of their children.
+type workspaceEntry struct {
+	name string
+	data []byte
+	// size is the entry's size in the archive; for a skipped entry, data
+	// holds only its first bytes.
+	size     int64
+	skipped  bool
+	mode     fs.FileMode
+	modTime  time.Time
+	children map[string]bool
+}
+
+// workspaceArchiveRoot returns the root an archive's entries are reported
+// under: the archive path without its extension, so /tmp/app.tar.gz is
+// scanned as the workspace /tmp/app, as if it had been extracted there.
+func workspaceArchiveRoot(archivePath string) string {
+	lower := strings.ToLower(archivePath)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return archivePath[:len(archivePath)-len(ext)]
+		}
+	}
+	return archivePath
+}
+
+// loadWorkspaceArchive reads a tar, gzipped tar, or zip archive into memory.
+// Entries with absolute names or names leaving the root are skipped;
+// symlink and hard link entries resolve to the regular entry they name
+// within the archive. Entries larger than maxFileSize, which the scan
+// skips as oversized, are recorded without their content. An archive over
+// the entry or size cap is an error, since scanning part of a workspace
+// would misreport what it lacks.
+func loadWorkspaceArchive(archivePath string, maxFileSize int64) (*archiveFS, error) {
+	a := &archiveFS{
+		root:        workspaceArchiveRoot(archivePath),
+		entries:     map[string]*workspaceEntry{".": {name: ".", mode: fs.ModeDir | 0o755, children: map[string]bool{}}},
+		maxFileSize: maxFileSize,
+	}
+	links := make(map[string]string)
+	var err error
+	if strings.HasSuffix(strings.ToLower(archivePath), ".zip") {
+		err = a.loadZip(archivePath, links)
+	} else {
+		err = a.loadTar(archivePath, links)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("workspace_archive %q: %w", archivePath, err)
+	}
+	a.resolveLinks(links)
+	return a, nil
+}
+
+// archiveBudget enforces the workspace archive caps while it is read.
+type archiveBudget struct {
+	entries int
+	bytes   int64
+}
+
+// entry counts an entry of any type.
+func (b *archiveBudget) entry() error {
+	b.entries++
+	if b.entries > maxWorkspaceArchiveEntries {
+		return fmt.Errorf("more than %d entries", maxWorkspaceArchiveEntries)
+	}
+	return nil
+}
+
+// read reads an entry's content against the size cap.
+func (b *archiveBudget) read(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxWorkspaceArchiveBytes-b.bytes+1))
+	if err != nil {
+		return nil, err
+	}
+	b.bytes += int64(len(data))
+	if b.bytes > maxWorkspaceArchiveBytes {
+		return nil, fmt.Errorf("more than %d bytes uncompressed", int64(maxWorkspaceArchiveBytes))
+	}
+	return data, nil
+}
+
+func (a *archiveFS) loadTar(archivePath string, links map[string]string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	var src io.Reader = f
+	if !strings.HasSuffix(strings.ToLower(archivePath), ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		src = gz
+	}
+	tr := tar.NewReader(src)
+	var budget archiveBudget
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := budget.entry(); err != nil {
+			return err
+		}
+		name, ok := archiveEntryName(hdr.Name)
+		if !ok {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			if err := a.addRegular(name, tr, hdr.Size, hdr.FileInfo().Mode().Perm(), hdr.ModTime, &budget); err != nil {
+				return err
+			}
+		case tar.TypeDir:
+			a.addDir(name, hdr.ModTime)
+		case tar.TypeSymlink:
+			links[name] = path.Join(path.Dir(name), slashName(hdr.Linkname))
+			if path.IsAbs(slashName(hdr.Linkname)) {
+				links[name] = ".."
+			}
+		case tar.TypeLink:
+			// Hard link names are relative to the archive root.
+			links[name] = path.Clean(strings.TrimPrefix(slashName(hdr.Linkname), "./"))
+		}
+	}
+}
+
+func (a *archiveFS) loadZip(archivePath string, links map[string]string) error {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = zr.Close() }()
+	var budget archiveBudget
+	for _, f := range zr.File {
+		if err := budget.entry(); err != nil {
+			return err
+		}
+		name, ok := archiveEntryName(f.Name)
+		if !ok {
+			continue
+		}
+		mode := f.Mode()
+		if mode.IsDir() {
+			a.addDir(name, f.Modified)
+			continue
+		}
+		if !mode.IsRegular() && mode&fs.ModeSymlink == 0 {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		if mode.IsRegular() {
+			err = a.addRegular(name, rc, int64(f.UncompressedSize64), mode.Perm(), f.Modified, &budget)
+			_ = rc.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := budget.read(rc)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+		target := slashName(string(data))
+		links[name] = path.Join(path.Dir(name), target)
+		if path.IsAbs(target) {
+			links[name] = ".."
+		}
+	}
+	return nil
+}
+
+// addRegular reads a regular entry of the given size. An entry over
+// maxFileSize keeps only its first bytes, and is otherwise not read.
+func (a *archiveFS) addRegular(name string, r io.Reader, size int64, perm fs.FileMode, modTime time.Time, budget *archiveBudget) error {
+	if size <= a.maxFileSize {
+		data, err := budget.read(r)
+		if err != nil {
+			return err
+		}
+		a.add(name, data, perm, modTime)
+		return nil
+	}
+	head, err := budget.read(io.LimitReader(r, archiveSniffSize))
+	if err != nil {
+		return err
+	}
+	e := a.add(name, head, perm, modTime)
+	e.size, e.skipped = size, true
+	return nil
+}
+
+// archiveEntryName cleans an entry name to a slash path relative to the
+// archive root, rejecting absolute names and names that leave it.
+func archiveEntryName(name string) (string, bool) {
+	name = slashName(name)
+	if path.IsAbs(name) {
+		return "", false
+	}
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// add stores a regular entry, creating its parent directories.
+func (a *archiveFS) add(name string, data []byte, perm fs.FileMode, modTime time.Time) *workspaceEntry {
+	a.parent(name)
+	e := &workspaceEntry{name: name, data: data, size: int64(len(data)), mode: perm, modTime: modTime}
+	a.entries[name] = e
+	return e
+}
+
+// addDir stores a directory entry, keeping children already seen.
+func (a *archiveFS) addDir(name string, modTime time.Time) {
+	e := a.parent(name)
+	if e != nil && e.children != nil {
+		e.modTime = modTime
+		return
+	}
+	a.entries[name] = &workspaceEntry{name: name, mode: fs.ModeDir | 0o755, modTime: modTime, children: map[string]bool{}}
+}
+
+// parent links name into its parent directory, creating missing ones, and
+// returns the existing entry for name, if any.
+func (a *archiveFS) parent(name string) *workspaceEntry {
+	dir := path.Dir(name)
+	p, ok := a.entries[dir]
+	if !ok || p.children == nil {
+		a.addDir(dir, time.Time{})
+		p = a.entries[dir]
+	}
+	p.children[path.Base(name)] = true
+	return a.entries[name]
+}
+
+// resolveLinks adds every link whose target is a regular entry within the
+// archive as a copy of that entry, following chains of links. The others
+// are counted and dropped, matching a walk that does not follow symlinks
+// into directories.
+func (a *archiveFS) resolveLinks(links map[string]string) {
+	for _, name := range sortedKeys(links) {
+		target := links[name]
+		for depth := 0; depth < maxArchiveLinkDepth; depth++ {
+			next, ok := links[target]
+			if !ok {
+				break
+			}
+			target = next
+		}
+		e, ok := a.entries[target]
+		if _, exists := a.entries[name]; exists || !ok || e.children != nil || target == ".." || strings.HasPrefix(target, "../") {
+			a.linksSkipped++
+			continue
+		}
+		link := a.add(name, e.data, e.mode, e.modTime)
+		link.size, link.skipped = e.size, e.skipped
+	}
+}
+
+// entry returns the entry at an OS path under the archive root.
+func (a *archiveFS) entry(op, name string) (*workspaceEntry, error) {
+	rel, err := filepath.Rel(a.root, name)
+	if err == nil {
+		rel = filepath.ToSlash(rel)
+		if e, ok := a.entries[rel]; ok {
+			return e, nil
+		}
+	}
+	return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+func (a *archiveFS) Open(name string) (fs.File, error) {
+	e, err := a.entry("open", name)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = bytes.NewReader(e.data)
+	if e.skipped {
+		r = io.MultiReader(r, skippedContent{name})
+	}
+	return &workspaceEntryFile{workspaceEntryInfo: workspaceEntryInfo{e}, Reader: r}, nil
+}
+
+func (a *archiveFS) Stat(name string) (fs.FileInfo, error) {
+	e, err := a.entry("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return workspaceEntryInfo{e}, nil
+}
+
+func (a *archiveFS) ReadFile(name string) ([]byte, error) {
+	e, err := a.entry("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.children != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	if e.skipped {
+		return nil, skippedContent{name}.err()
+	}
+	return bytes.Clone(e.data), nil
+}
+
+func (a *archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := a.entry("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.children == nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	names := sortedKeys(e.children)
+	out := make([]fs.DirEntry, 0, len(names))
+	for _, child := range names {
+		out = append(out, fs.FileInfoToDirEntry(workspaceEntryInfo{a.entries[path.Join(e.name, child)]}))
+	}
+	return out, nil
+}
+
+// WalkDir walks the entries under root in lexical order, like
+// filepath.WalkDir.
+func (a *archiveFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := a.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = a.walkDir(root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (a *archiveFS) walkDir(name string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(name, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	entries, err := a.ReadDir(name)
+	if err != nil {
+		if err = fn(name, d, err); err != nil {
+			if err == filepath.SkipDir && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, child := range entries {
+		if err := a.walkDir(filepath.Join(name, child.Name()), child, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// workspaceEntryInfo describes an archive entry.
+type workspaceEntryInfo struct{ e *workspaceEntry }
+
+func (i workspaceEntryInfo) Name() string       { return path.Base(i.e.name) }
+func (i workspaceEntryInfo) Size() int64        { return i.e.size }
+func (i workspaceEntryInfo) Mode() fs.FileMode  { return i.e.mode }
+func (i workspaceEntryInfo) ModTime() time.Time { return i.e.modTime }
+func (i workspaceEntryInfo) IsDir() bool        { return i.e.children != nil }
+func (i workspaceEntryInfo) Sys() any           { return nil }
+
+// workspaceEntryFile is an open archive entry.
+type workspaceEntryFile struct {
+	workspaceEntryInfo
+	io.Reader
+}
+
+func (f *workspaceEntryFile) Stat() (fs.FileInfo, error) { return f.workspaceEntryInfo, nil }
+func (f *workspaceEntryFile) Close() error               { return nil }
+
+// skippedContent fails reads past the first bytes of an entry over
+// max_file_size, whose content was not loaded.
+type skippedContent struct{ name string }
+
+func (c skippedContent) Read([]byte) (int, error) { return 0, c.err() }
+
+func (c skippedContent) err() error {
+	return &fs.PathError{Op: "read", Path: c.name, Err: errors.New("larger than max_file_size; content not loaded from the archive")}
+}
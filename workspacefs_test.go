@@ -0,0 +1,338 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	pluginv1 "github.com/nox-hq/nox/gen/nox/plugin/v1"
+	"github.com/nox-hq/nox/sdk"
+)
+
+// archiveDir writes the tree at dir into an archive at archivePath, a zip
+// or gzipped tar by its extension, keeping modes, modification times, and
+// symlinks.
+func archiveDir(t *testing.T, dir, archivePath string) {
+	t.Helper()
+	out, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = out.Close() }()
+
+	var add func(rel string, info fs.FileInfo, link string, data []byte) error
+	var finish func() error
+	if strings.HasSuffix(archivePath, ".zip") {
+		zw := zip.NewWriter(out)
+		add = func(rel string, info fs.FileInfo, link string, data []byte) error {
+			hdr, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			hdr.Name, hdr.Method = rel, zip.Deflate
+			if info.IsDir() {
+				hdr.Name += "/"
+			}
+			w, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			if link != "" {
+				data = []byte(link)
+			}
+			_, err = w.Write(data)
+			return err
+		}
+		finish = zw.Close
+	} else {
+		gz := gzip.NewWriter(out)
+		tw := tar.NewWriter(gz)
+		add = func(rel string, info fs.FileInfo, link string, data []byte) error {
+			hdr, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+			hdr.Name, hdr.Format = rel, tar.FormatPAX
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			_, err = tw.Write(data)
+			return err
+		}
+		finish = func() error {
+			if err := tw.Close(); err != nil {
+				return err
+			}
+			return gz.Close()
+		}
+	}
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		var data []byte
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			if data, err = os.ReadFile(p); err != nil {
+				return err
+			}
+		}
+		return add(filepath.ToSlash(rel), info, link, data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := finish(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// archiveScanFindings drops the summary metadata only an archive scan
+// records.
+func archiveScanFindings(findings []*pluginv1.Finding) []*pluginv1.Finding {
+	for _, f := range findings {
+		delete(f.GetMetadata(), "workspace_archive")
+		delete(f.GetMetadata(), "archive_links_skipped")
+	}
+	return findings
+}
+
+// assertSameFindings compares the findings of a directory scan and an
+// archive scan of the same tree, each relative to its own root.
+func assertSameFindings(t *testing.T, dirFindings []*pluginv1.Finding, dirRoot string, archiveFindings []*pluginv1.Finding, archiveRoot string) {
+	t.Helper()
+	want := goldenFindings(dirFindings, dirRoot)
+	got := goldenFindings(archiveScanFindings(archiveFindings), archiveRoot)
+	if reflect.DeepEqual(got, want) {
+		return
+	}
+	gotLines, wantLines := goldenLines(got), goldenLines(want)
+	for line := range wantLines {
+		if !gotLines[line] {
+			t.Errorf("missing from archive scan: %s", line)
+		}
+	}
+	for line := range gotLines {
+		if !wantLines[line] {
+			t.Errorf("only in archive scan: %s", line)
+		}
+	}
+}
+
+func TestScanWorkspaceArchiveMatchesDirectory(t *testing.T) {
+	entries, err := os.ReadDir(testdataDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := testClient(t)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		for _, ext := range []string{".tar.gz", ".zip"} {
+			t.Run(e.Name()+ext, func(t *testing.T) {
+				root := filepath.Join(testdataDir(t), e.Name())
+				archive := filepath.Join(t.TempDir(), e.Name()+ext)
+				archiveDir(t, root, archive)
+
+				input := map[string]any{"required_slsa_level": float64(3), "scan_archives": true}
+				input["workspace_root"] = root
+				dirResp := invokeScanWithInput(t, client, input)
+				delete(input, "workspace_root")
+				input["workspace_archive"] = archive
+				archiveResp := invokeScanWithInput(t, client, input)
+
+				assertSameFindings(t, dirResp.GetFindings(), root, archiveResp.GetFindings(), workspaceArchiveRoot(archive))
+			})
+		}
+	}
+}
+
+func TestScanWorkspaceArchiveSymlinks(t *testing.T) {
+	workspace := filepath.Join(t.TempDir(), "app")
+	writeFile(t, filepath.Join(workspace, "dist", "app.intoto.jsonl"), subjectStatement("app", "abc")+"\n")
+	writeFile(t, filepath.Join(workspace, "Makefile"), "build:\n\tgo build -o app .\n")
+	symlinkOrSkip(t, filepath.Join("dist", "app.intoto.jsonl"), filepath.Join(workspace, "latest.intoto.jsonl"))
+
+	archive := filepath.Join(t.TempDir(), "app.tar.gz")
+	archiveDir(t, workspace, archive)
+	client := testClient(t)
+	dirResp := invokeScanWithInput(t, client, map[string]any{"workspace_root": workspace})
+	archiveResp := invokeScanWithInput(t, client, map[string]any{"workspace_archive": archive})
+	assertSameFindings(t, dirResp.GetFindings(), workspace, archiveResp.GetFindings(), workspaceArchiveRoot(archive))
+
+	// Links leaving the root are skipped rather than read.
+	symlinkOrSkip(t, "/etc/passwd", filepath.Join(workspace, "absolute.intoto.jsonl"))
+	symlinkOrSkip(t, filepath.Join("..", "..", "secret.intoto.jsonl"), filepath.Join(workspace, "dist", "parent.intoto.jsonl"))
+	archiveDir(t, workspace, archive)
+	resp := invokeScanWithInput(t, client, map[string]any{"workspace_archive": archive})
+	for _, f := range resp.GetFindings() {
+		if p := f.GetLocation().GetFilePath(); strings.Contains(p, "absolute") || strings.Contains(p, "parent") {
+			t.Errorf("unexpected finding for a link outside the archive: %s %s", f.GetRuleId(), p)
+		}
+	}
+	meta := findByRule(resp.GetFindings(), summaryRuleID)[0].GetMetadata()
+	if meta["archive_links_skipped"] != "2" || meta["workspace_archive"] != archive || meta["provenance_files_scanned"] != "2" {
+		t.Errorf("expected two skipped links and two provenance files, got %v", meta)
+	}
+}
+
+func TestLoadWorkspaceArchiveSkipsEscapingEntries(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "app.tar.gz")
+	writeTar(t, archive,
+		archiveEntry{"../escape.intoto.jsonl", "{}"},
+		archiveEntry{"/abs.intoto.jsonl", "{}"},
+		archiveEntry{"./src/main.go", "package main\n"},
+	)
+	a, err := loadWorkspaceArchive(archive, defaultMaxFileSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	err = a.WalkDir(a.root, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, workspacePath(a.root, p))
+		}
+		return err
+	})
+	if err != nil || !reflect.DeepEqual(files, []string{"src/main.go"}) {
+		t.Errorf("archive files = %v (%v), want only src/main.go", files, err)
+	}
+	data, err := a.ReadFile(filepath.Join(a.root, "src", "main.go"))
+	if err != nil || string(data) != "package main\n" {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+	if _, err := a.Stat(filepath.Join(a.root, "..", "escape.intoto.jsonl")); err == nil {
+		t.Error("expected an entry outside the root not to exist")
+	}
+}
+
+func TestLoadWorkspaceArchiveSkipsOversizedContent(t *testing.T) {
+	big := strings.Repeat("x", 2*archiveSniffSize)
+	for _, ext := range []string{".tar.gz", ".zip"} {
+		t.Run(ext, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "app"+ext)
+			entries := []archiveEntry{{"big.bin", big}, {"small.txt", "ok"}}
+			if ext == ".zip" {
+				writeZip(t, archive, entries...)
+			} else {
+				writeTar(t, archive, entries...)
+			}
+			a, err := loadWorkspaceArchive(archive, int64(len(big)-1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := filepath.Join(a.root, "big.bin")
+			if info, err := a.Stat(name); err != nil || info.Size() != int64(len(big)) {
+				t.Errorf("Stat of the skipped entry = %v, %v, want size %d", info, err, len(big))
+			}
+			if _, err := a.ReadFile(name); err == nil || !strings.Contains(err.Error(), "max_file_size") {
+				t.Errorf("expected ReadFile of the skipped entry to fail, got %v", err)
+			}
+			f, err := a.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(f)
+			if len(data) != archiveSniffSize || err == nil {
+				t.Errorf("reading the skipped entry returned %d bytes and %v, want its first %d bytes and an error", len(data), err, archiveSniffSize)
+			}
+			if data, err := a.ReadFile(filepath.Join(a.root, "small.txt")); err != nil || string(data) != "ok" {
+				t.Errorf("ReadFile of the small entry = %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestScanWorkspaceArchiveOversizedEntries(t *testing.T) {
+	workspace := filepath.Join(t.TempDir(), "app")
+	writeFile(t, filepath.Join(workspace, "dist", "app.intoto.jsonl"), subjectStatement("app", strings.Repeat("a", 64))+"\n")
+	writeFile(t, filepath.Join(workspace, "bin", "helper"), testELF(2048))
+	writeFile(t, filepath.Join(workspace, "Dockerfile"), "FROM alpine:latest\n")
+	archive := filepath.Join(t.TempDir(), "app.tar.gz")
+	archiveDir(t, workspace, archive)
+
+	client := testClient(t)
+	dirResp := invokeScanWithInput(t, client, map[string]any{"workspace_root": workspace, "max_file_size": 64})
+	archiveResp := invokeScanWithInput(t, client, map[string]any{"workspace_archive": archive, "max_file_size": 64})
+	if len(findByRule(archiveResp.GetFindings(), "PROV-007")) != 1 || len(findByRule(archiveResp.GetFindings(), vendoredBinaryRuleID)) != 1 {
+		t.Fatal("expected the oversized provenance reported and the oversized binary sniffed")
+	}
+	assertSameFindings(t, dirResp.GetFindings(), workspace, archiveResp.GetFindings(), workspaceArchiveRoot(archive))
+}
+
+func TestWorkspaceArchiveCaps(t *testing.T) {
+	b := archiveBudget{entries: maxWorkspaceArchiveEntries - 1}
+	if err := b.entry(); err != nil {
+		t.Fatalf("entry at the cap: %v", err)
+	}
+	if err := b.entry(); err == nil {
+		t.Error("expected an entry over the cap to fail")
+	}
+
+	b = archiveBudget{bytes: maxWorkspaceArchiveBytes - 4}
+	if _, err := b.read(strings.NewReader("1234")); err != nil {
+		t.Fatalf("read up to the cap: %v", err)
+	}
+	if _, err := b.read(strings.NewReader("5")); err == nil {
+		t.Error("expected a read over the cap to fail")
+	}
+}
+
+func TestResolveWorkspaceArchive(t *testing.T) {
+	host := t.TempDir()
+	outside := t.TempDir()
+	archive := filepath.Join(host, "app.tar.gz")
+	writeTar(t, archive, archiveEntry{"Makefile", "build:\n\tgo build .\n"})
+	writeTar(t, filepath.Join(outside, "other.tar.gz"))
+	writeFile(t, filepath.Join(host, "notes.txt"), "")
+
+	got, err := resolveWorkspaceArchive(sdk.ToolRequest{Input: map[string]any{"workspace_archive": "app.tar.gz"}, WorkspaceRoot: host})
+	if err != nil || got != archive {
+		t.Errorf("resolveWorkspaceArchive() = %q, %v, want %q", got, err, archive)
+	}
+
+	errTests := []struct {
+		name    string
+		input   map[string]any
+		host    string
+		message string
+	}{
+		{"with workspace_root", map[string]any{"workspace_archive": archive, "workspace_root": host}, "", "mutually exclusive"},
+		{"missing", map[string]any{"workspace_archive": filepath.Join(host, "missing.zip")}, "", "does not exist"},
+		{"not an archive", map[string]any{"workspace_archive": filepath.Join(host, "notes.txt")}, "", "is not a .tar"},
+		{"directory", map[string]any{"workspace_archive": host + ".zip"}, "", "does not exist"},
+		{"outside host", map[string]any{"workspace_archive": filepath.Join(outside, "other.tar.gz")}, host, "outside the host workspace"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolveWorkspaceArchive(sdk.ToolRequest{Input: tt.input, WorkspaceRoot: tt.host})
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected error containing %q, got %v", tt.message, err)
+			}
+		})
+	}
+
+	writeFile(t, filepath.Join(host, "corrupt.tar.gz"), "not gzip")
+	if _, err := loadWorkspaceArchive(filepath.Join(host, "corrupt.tar.gz"), defaultMaxFileSize); err == nil {
+		t.Error("expected a corrupt archive to fail to load")
+	}
+}
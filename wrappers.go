@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// wrapperIntegrityRuleID flags Gradle and Maven wrappers whose
+// distribution or wrapper jar, both executed by the build, are fetched
+// without a checksum or over plain HTTP, or whose committed jar does not
+// match an official release.
+const wrapperIntegrityRuleID = "PROV-057"
+
+// wrapperChecksumsJSON is the table of official wrapper jar checksums.
+// Entries are data, so a new release needs no code change.
+//
+//go:embed wrappers.json
+var wrapperChecksumsJSON []byte
+
+// wrapperChecksum is one entry of the wrapper jar table: the sha256 of the
+// jar the listed versions of a tool generate.
+type wrapperChecksum struct {
+	Tool     string   `json:"tool"`
+	Versions []string `json:"versions"`
+	SHA256   string   `json:"sha256"`
+}
+
+// wrapperChecksumTable indexes the wrapper jar table by tool.
+type wrapperChecksumTable struct {
+	// byVersion maps a tool's version to the checksum of its jar.
+	byVersion map[string]map[string]string
+	// official holds every checksum of a tool's jars, since one jar is
+	// often generated by several versions.
+	official map[string]map[string]bool
+}
+
+// wrapperChecksums is the parsed wrapper jar table.
+var wrapperChecksums = mustParseWrapperChecksums(wrapperChecksumsJSON)
+
+// parseWrapperChecksums decodes and validates the wrapper jar table.
+func parseWrapperChecksums(data []byte) (*wrapperChecksumTable, error) {
+	var entries []wrapperChecksum
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	table := &wrapperChecksumTable{byVersion: make(map[string]map[string]string), official: make(map[string]map[string]bool)}
+	for i, e := range entries {
+		switch {
+		case lookupBuildWrapper(e.Tool) == nil:
+			return nil, fmt.Errorf("entry %d: unknown tool %q", i, e.Tool)
+		case !bareChecksum.MatchString(e.SHA256):
+			return nil, fmt.Errorf("entry %d: invalid sha256 %q", i, e.SHA256)
+		case len(e.Versions) == 0:
+			return nil, fmt.Errorf("entry %d: no versions", i)
+		}
+		sum := strings.ToLower(e.SHA256)
+		if table.byVersion[e.Tool] == nil {
+			table.byVersion[e.Tool] = make(map[string]string)
+			table.official[e.Tool] = make(map[string]bool)
+		}
+		for _, v := range e.Versions {
+			if prev, ok := table.byVersion[e.Tool][v]; ok && prev != sum {
+				return nil, fmt.Errorf("entry %d: %s %s listed with two checksums", i, e.Tool, v)
+			}
+			table.byVersion[e.Tool][v] = sum
+		}
+		table.official[e.Tool][sum] = true
+	}
+	return table, nil
+}
+
+// mustParseWrapperChecksums parses the embedded table, which tests keep
+// valid.
+func mustParseWrapperChecksums(data []byte) *wrapperChecksumTable {
+	table, err := parseWrapperChecksums(data)
+	if err != nil {
+		panic("wrappers.json: " + err.Error())
+	}
+	return table
+}
+
+// buildWrapper describes a build tool wrapper checked into a project.
+type buildWrapper struct {
+	tool string
+	// properties and jar are the wrapper's files, relative to the project.
+	properties string
+	jar        string
+	// downloads pairs each URL property with the property holding the
+	// sha256 the download is checked against.
+	downloads [][2]string
+	// version extracts the version identifying the wrapper jar from its
+	// properties, or "".
+	version func(props map[string]javaProperty) string
+}
+
+var (
+	// gradleDistribution captures the Gradle version of a distributionUrl.
+	gradleDistribution = regexp.MustCompile(`/gradle-([0-9][0-9A-Za-z.\-]*?)-(?:bin|all)\.zip$`)
+	// mavenWrapperJar captures the version of a Maven wrapperUrl.
+	mavenWrapperJar = regexp.MustCompile(`/maven-wrapper-([0-9][0-9A-Za-z.\-]*)\.jar$`)
+)
+
+// buildWrappers lists the wrappers checked.
+var buildWrappers = []*buildWrapper{
+	{
+		tool:       "gradle",
+		properties: "gradle/wrapper/gradle-wrapper.properties",
+		jar:        "gradle/wrapper/gradle-wrapper.jar",
+		downloads:  [][2]string{{"distributionUrl", "distributionSha256Sum"}},
+		// The jar is generated by the Gradle release the project runs,
+		// as the distributionUrl names it.
+		version: func(props map[string]javaProperty) string {
+			if m := gradleDistribution.FindStringSubmatch(props["distributionUrl"].value); m != nil {
+				return m[1]
+			}
+			return ""
+		},
+	},
+	{
+		tool:       "maven",
+		properties: ".mvn/wrapper/maven-wrapper.properties",
+		jar:        ".mvn/wrapper/maven-wrapper.jar",
+		downloads:  [][2]string{{"distributionUrl", "distributionSha256Sum"}, {"wrapperUrl", "wrapperSha256Sum"}},
+		version: func(props map[string]javaProperty) string {
+			if v := props["wrapperVersion"].value; v != "" {
+				return v
+			}
+			if m := mavenWrapperJar.FindStringSubmatch(props["wrapperUrl"].value); m != nil {
+				return m[1]
+			}
+			return ""
+		},
+	},
+}
+
+// lookupBuildWrapper returns the wrapper of a tool, or nil.
+func lookupBuildWrapper(tool string) *buildWrapper {
+	for _, w := range buildWrappers {
+		if w.tool == tool {
+			return w
+		}
+	}
+	return nil
+}
+
+// hasWrapperFile reports whether the slash path rel is the wrapper file
+// file of a project at the workspace root or in a subdirectory.
+func hasWrapperFile(rel, file string) bool {
+	return rel == file || strings.HasSuffix(rel, "/"+file)
+}
+
+// wrapperAnalyzer checks Gradle and Maven wrapper properties and jars.
+type wrapperAnalyzer struct{}
+
+func (wrapperAnalyzer) kinds() fileKind { return kindWrapper }
+
+func (wrapperAnalyzer) name() string { return "wrapper" }
+
+func (wrapperAnalyzer) matches(rel, _ string, _ *provenanceMatcher) fileKind {
+	for _, w := range buildWrappers {
+		if hasWrapperFile(rel, w.properties) || hasWrapperFile(rel, w.jar) {
+			return kindWrapper
+		}
+	}
+	return 0
+}
+
+func (wrapperAnalyzer) analyze(ctx context.Context, job scanJob, r *fileReporter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rel := workspacePath(r.findings.root, job.path)
+	for _, w := range buildWrappers {
+		switch {
+		case hasWrapperFile(rel, w.properties):
+			data, err := r.findings.files().ReadFile(job.path)
+			if err != nil {
+				r.summary.filesUnreadable++
+				return nil
+			}
+			scanWrapperProperties(r.findings, w, job.path, parseJavaProperties(data))
+			return nil
+		case hasWrapperFile(rel, w.jar):
+			verifyWrapperJar(r.findings, w, job.path, job.size)
+			return nil
+		}
+	}
+	return nil
+}
+
+// wrapperProject returns the project directory of a wrapper file.
+func wrapperProject(filePath, file string) string {
+	return filepath.Clean(strings.TrimSuffix(filePath, filepath.FromSlash(file)))
+}
+
+// scanWrapperProperties flags wrapper downloads fetched over plain HTTP
+// (High) or with no checksum to verify them against (Medium). The Maven
+// wrapper only fetches its jar when none is committed, so a wrapperUrl
+// without a checksum next to a committed jar is left to the jar check.
+func scanWrapperProperties(findings *findingSet, w *buildWrapper, filePath string, props map[string]javaProperty) {
+	project := wrapperProject(filePath, w.properties)
+	for _, d := range w.downloads {
+		urlProp, sumProp := d[0], d[1]
+		url, ok := props[urlProp]
+		if !ok || url.value == "" {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(url.value), "http://") {
+			findings.Finding(
+				wrapperIntegrityRuleID,
+				sdk.SeverityHigh,
+				sdk.ConfidenceHigh,
+				fmt.Sprintf("%s wrapper %s is fetched over plain HTTP", titleCase(w.tool), urlProp),
+			).
+				At(filePath, url.line, url.line).
+				WithMetadata("type", "insecure_wrapper_url").
+				WithMetadata("tool", w.tool).
+				WithMetadata("property", urlProp).
+				WithMetadata("url", url.value).
+				Done()
+		}
+		if props[sumProp].value != "" {
+			continue
+		}
+		if urlProp == "wrapperUrl" {
+			if info, err := findings.files().Stat(filepath.Join(project, filepath.FromSlash(w.jar))); err == nil && info.Mode().IsRegular() {
+				continue
+			}
+		}
+		findings.Finding(
+			wrapperIntegrityRuleID,
+			sdk.SeverityMedium,
+			sdk.ConfidenceHigh,
+			fmt.Sprintf("%s wrapper %s has no %s to verify the download", titleCase(w.tool), urlProp, sumProp),
+		).
+			At(filePath, url.line, url.line).
+			WithMetadata("type", "missing_wrapper_checksum").
+			WithMetadata("tool", w.tool).
+			WithMetadata("property", sumProp).
+			WithMetadata("url", url.value).
+			Done()
+	}
+}
+
+// verifyWrapperJar checks a committed wrapper jar against the checksum its
+// properties pin (the Maven wrapperSha256Sum) or, failing that, the
+// official checksum of the version they name. A jar matching neither is
+// reported at High severity, unless the version is missing from the table,
+// when the jar can only be noted as unverifiable (Low). Any official jar
+// of the tool passes, since projects often keep the jar of an older
+// release when upgrading.
+func verifyWrapperJar(findings *findingSet, w *buildWrapper, filePath string, size int64) {
+	digest := fileDigest(findings.files(), filePath, size)
+	if digest == "" {
+		return
+	}
+	props := make(map[string]javaProperty)
+	if data, err := findings.files().ReadFile(filepath.Join(wrapperProject(filePath, w.jar), filepath.FromSlash(w.properties))); err == nil {
+		props = parseJavaProperties(data)
+	}
+	version := w.version(props)
+
+	expected, source := "", ""
+	for _, d := range w.downloads {
+		if d[0] == "wrapperUrl" && props[d[1]].value != "" {
+			expected, source = strings.ToLower(props[d[1]].value), d[1]
+		}
+	}
+	if expected == "" {
+		expected, source = wrapperChecksums.byVersion[w.tool][version], "official"
+	}
+	if digest == expected || source == "official" && wrapperChecksums.official[w.tool][digest] {
+		return
+	}
+
+	if expected == "" {
+		fb := findings.Finding(
+			wrapperIntegrityRuleID,
+			sdk.SeverityLow,
+			sdk.ConfidenceLow,
+			fmt.Sprintf("Unverifiable %s wrapper jar: no official checksum is known for %s", w.tool, versionOrUnknown(version)),
+		).
+			At(filePath, 0, 0).
+			WithMetadata("type", "unverifiable_wrapper_jar").
+			WithMetadata("tool", w.tool).
+			WithMetadata("sha256", digest)
+		if version != "" {
+			fb.WithMetadata("version", version)
+		}
+		fb.Done()
+		return
+	}
+	msg := fmt.Sprintf("%s wrapper jar does not match the official jar of %s", titleCase(w.tool), versionOrUnknown(version))
+	if source != "official" {
+		msg = fmt.Sprintf("%s wrapper jar does not match its %s", titleCase(w.tool), source)
+	}
+	fb := findings.Finding(wrapperIntegrityRuleID, sdk.SeverityHigh, sdk.ConfidenceHigh, msg).
+		At(filePath, 0, 0).
+		WithMetadata("type", "wrapper_jar_mismatch").
+		WithMetadata("tool", w.tool).
+		WithMetadata("sha256", digest).
+		WithMetadata("expected_sha256", expected).
+		WithMetadata("checksum_source", source)
+	if version != "" {
+		fb.WithMetadata("version", version)
+	}
+	fb.Done()
+}
+
+// versionOrUnknown names a wrapper version for a message.
+func versionOrUnknown(version string) string {
+	if version == "" {
+		return "an unknown version"
+	}
+	return "version " + version
+}
+
+// titleCase upper-cases the first letter of a tool name.
+func titleCase(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// javaProperty is a value of a Java properties file with the line its
+// entry starts on.
+type javaProperty struct {
+	value string
+	line  int
+}
+
+// parseJavaProperties parses a Java properties file: key=value, key:value,
+// or key value entries, # and ! comments, backslash continuations, and
+// escapes. A repeated key keeps its last value.
+func parseJavaProperties(data []byte) map[string]javaProperty {
+	props := make(map[string]javaProperty)
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		start := i + 1
+		logical := strings.TrimLeft(lines[i], " \t\f")
+		if logical == "" || logical[0] == '#' || logical[0] == '!' {
+			continue
+		}
+		for propertiesContinued(logical) && i+1 < len(lines) {
+			i++
+			logical = logical[:len(logical)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+		key, value := splitJavaProperty(logical)
+		props[unescapeJavaProperty(key)] = javaProperty{value: unescapeJavaProperty(value), line: start}
+	}
+	return props
+}
+
+// propertiesContinued reports whether a properties line ends in an unescaped
+// backslash.
+func propertiesContinued(line string) bool {
+	n := 0
+	for n < len(line) && line[len(line)-1-n] == '\\' {
+		n++
+	}
+	return n%2 == 1
+}
+
+// splitJavaProperty splits a logical properties line at the first
+// unescaped separator: =, :, or whitespace, optionally followed by = or :.
+func splitJavaProperty(line string) (key, value string) {
+	i := 0
+	for ; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' {
+			i++
+			continue
+		}
+		if c == '=' || c == ':' || c == ' ' || c == '\t' || c == '\f' {
+			break
+		}
+	}
+	key = line[:min(i, len(line))]
+	rest := strings.TrimLeft(line[min(i, len(line)):], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	return key, rest
+}
+
+// unescapeJavaProperty decodes the escapes of a properties key or value.
+func unescapeJavaProperty(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 <= len(s) {
+				if r, err := strconv.ParseUint(s[i+1:i+5], 16, 16); err == nil {
+					b.WriteRune(rune(r))
+					i += 4
+					continue
+				}
+			}
+			b.WriteByte('u')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nox-hq/nox/sdk"
+)
+
+// useWrapperChecksums swaps in a wrapper jar table for one test.
+func useWrapperChecksums(t *testing.T, table string) {
+	t.Helper()
+	checksums, err := parseWrapperChecksums([]byte(table))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := wrapperChecksums
+	wrapperChecksums = checksums
+	t.Cleanup(func() { wrapperChecksums = saved })
+}
+
+func TestParseWrapperChecksums(t *testing.T) {
+	if _, err := parseWrapperChecksums(wrapperChecksumsJSON); err != nil {
+		t.Fatalf("embedded table: %v", err)
+	}
+	sum := strings.Repeat("a", 64)
+	for name, table := range map[string]string{
+		"unknown tool":  `[{"tool": "ant", "versions": ["1.0"], "sha256": "` + sum + `"}]`,
+		"bad sha256":    `[{"tool": "gradle", "versions": ["1.0"], "sha256": "abc"}]`,
+		"no versions":   `[{"tool": "gradle", "sha256": "` + sum + `"}]`,
+		"two checksums": `[{"tool": "gradle", "versions": ["1.0"], "sha256": "` + sum + `"}, {"tool": "gradle", "versions": ["1.0"], "sha256": "` + strings.Repeat("b", 64) + `"}]`,
+		"not an array":  `{}`,
+	} {
+		if _, err := parseWrapperChecksums([]byte(table)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseJavaProperties(t *testing.T) {
+	props := parseJavaProperties([]byte(strings.Join([]string{
+		`# comment`,
+		`! another`,
+		`distributionUrl=https\://services.gradle.org/distributions/gradle-8.5-bin.zip`,
+		`  spaced : value with spaces  `,
+		`bare value`,
+		`long = first, \`,
+		`       second`,
+		`escaped\ key=é\tx`,
+		`empty=`,
+		`repeat=1`,
+		`repeat=2`,
+	}, "\r\n")))
+	for key, want := range map[string]javaProperty{
+		"distributionUrl": {"https://services.gradle.org/distributions/gradle-8.5-bin.zip", 3},
+		"spaced":          {"value with spaces  ", 4},
+		"bare":            {"value", 5},
+		"long":            {"first, second", 6},
+		"escaped key":     {"é\tx", 8},
+		"empty":           {"", 9},
+		"repeat":          {"2", 11},
+	} {
+		if got, ok := props[key]; !ok || got != want {
+			t.Errorf("%q = %+v, want %+v", key, got, want)
+		}
+	}
+	if len(props) != 7 {
+		t.Errorf("got %d properties: %v", len(props), props)
+	}
+}
+
+func TestScanWrapperProperties(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "gradle", "wrapper", "gradle-wrapper.properties"),
+		"distributionBase=GRADLE_USER_HOME\ndistributionUrl=http\\://services.gradle.org/distributions/gradle-8.5-bin.zip\n")
+	writeFile(t, filepath.Join(workspace, "pinned", "gradle", "wrapper", "gradle-wrapper.properties"),
+		"distributionUrl=https\\://services.gradle.org/distributions/gradle-8.5-bin.zip\ndistributionSha256Sum="+strings.Repeat("a", 64)+"\n")
+	writeFile(t, filepath.Join(workspace, "api", ".mvn", "wrapper", "maven-wrapper.properties"), strings.Join([]string{
+		"distributionUrl=https://repo.maven.apache.org/maven2/org/apache/maven/apache-maven/3.9.6/apache-maven-3.9.6-bin.zip",
+		"wrapperUrl=https://repo.maven.apache.org/maven2/org/apache/maven/wrapper/maven-wrapper/3.2.0/maven-wrapper-3.2.0.jar",
+	}, "\n")+"\n")
+	// With the jar committed, mvnw never downloads it.
+	writeFile(t, filepath.Join(workspace, "web", ".mvn", "wrapper", "maven-wrapper.properties"),
+		"wrapperUrl=https://repo.maven.apache.org/maven2/org/apache/maven/wrapper/maven-wrapper/3.2.0/maven-wrapper-3.2.0.jar\n")
+	writeFile(t, filepath.Join(workspace, "web", ".mvn", "wrapper", "maven-wrapper.jar"), "jar")
+	useWrapperChecksums(t, `[{"tool": "maven", "versions": ["3.2.0"], "sha256": "`+sha256Hex([]byte("jar"))+`"}]`)
+
+	resp := invokeScan(t, testClient(t), workspace)
+
+	got := make(map[string]string)
+	for _, f := range findByRule(resp.GetFindings(), wrapperIntegrityRuleID) {
+		meta := f.GetMetadata()
+		key := f.GetLocation().GetFilePath() + ":" + meta["property"]
+		got[key] = f.GetSeverity().String() + " " + meta["type"] + " " + meta["tool"]
+	}
+	want := map[string]string{
+		"gradle/wrapper/gradle-wrapper.properties:distributionUrl":        sdk.SeverityHigh.String() + " insecure_wrapper_url gradle",
+		"gradle/wrapper/gradle-wrapper.properties:distributionSha256Sum":  sdk.SeverityMedium.String() + " missing_wrapper_checksum gradle",
+		"api/.mvn/wrapper/maven-wrapper.properties:distributionSha256Sum": sdk.SeverityMedium.String() + " missing_wrapper_checksum maven",
+		"api/.mvn/wrapper/maven-wrapper.properties:wrapperSha256Sum":      sdk.SeverityMedium.String() + " missing_wrapper_checksum maven",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d %s findings, want %d: %v", len(got), wrapperIntegrityRuleID, len(want), got)
+	}
+	for key, w := range want {
+		if got[key] != w {
+			t.Errorf("%s: got %q, want %q", key, got[key], w)
+		}
+	}
+}
+
+func TestVerifyWrapperJar(t *testing.T) {
+	official := sha256Hex([]byte("official"))
+	older := sha256Hex([]byte("older"))
+	useWrapperChecksums(t, `[
+		{"tool": "gradle", "versions": ["8.5", "8.5.1"], "sha256": "`+official+`"},
+		{"tool": "gradle", "versions": ["7.6"], "sha256": "`+older+`"}
+	]`)
+	gradle := func(version string) string {
+		return "distributionUrl=https\\://services.gradle.org/distributions/gradle-" + version + "-all.zip\ndistributionSha256Sum=" + strings.Repeat("a", 64) + "\n"
+	}
+	tests := []struct {
+		name, properties, jar string
+		severity              string
+		meta                  map[string]string
+	}{
+		{name: "official", properties: gradle("8.5.1"), jar: "official"},
+		{name: "official jar of another version", properties: gradle("8.5"), jar: "older"},
+		{
+			name: "mismatch", properties: gradle("8.5"), jar: "tampered",
+			severity: sdk.SeverityHigh.String(),
+			meta:     map[string]string{"type": "wrapper_jar_mismatch", "version": "8.5", "expected_sha256": official, "checksum_source": "official"},
+		},
+		{
+			name: "unknown version", properties: gradle("9.0-rc-1"), jar: "newer",
+			severity: sdk.SeverityLow.String(),
+			meta:     map[string]string{"type": "unverifiable_wrapper_jar", "version": "9.0-rc-1", "sha256": sha256Hex([]byte("newer"))},
+		},
+		{name: "no properties, official jar", jar: "older"},
+		{
+			name: "no properties", jar: "tampered",
+			severity: sdk.SeverityLow.String(),
+			meta:     map[string]string{"type": "unverifiable_wrapper_jar", "version": ""},
+		},
+	}
+	client := testClient(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			dir := filepath.Join(workspace, "gradle", "wrapper")
+			writeFile(t, filepath.Join(dir, "gradle-wrapper.jar"), tt.jar)
+			if tt.properties != "" {
+				writeFile(t, filepath.Join(dir, "gradle-wrapper.properties"), tt.properties)
+			}
+
+			found := findByRule(invokeScan(t, client, workspace).GetFindings(), wrapperIntegrityRuleID)
+			if tt.severity == "" {
+				if len(found) != 0 {
+					t.Errorf("expected no findings, got %v", found)
+				}
+				return
+			}
+			if len(found) != 1 {
+				t.Fatalf("expected one finding, got %d", len(found))
+			}
+			f := found[0]
+			if f.GetSeverity().String() != tt.severity || f.GetLocation().GetFilePath() != "gradle/wrapper/gradle-wrapper.jar" {
+				t.Errorf("unexpected finding %s at %s", f.GetSeverity(), f.GetLocation().GetFilePath())
+			}
+			for k, v := range tt.meta {
+				if f.GetMetadata()[k] != v {
+					t.Errorf("%s = %q, want %q", k, f.GetMetadata()[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyMavenWrapperJar(t *testing.T) {
+	useWrapperChecksums(t, `[]`)
+	workspace := t.TempDir()
+	dir := filepath.Join(workspace, ".mvn", "wrapper")
+	writeFile(t, filepath.Join(dir, "maven-wrapper.jar"), "tampered")
+	writeFile(t, filepath.Join(dir, "maven-wrapper.properties"), strings.Join([]string{
+		"wrapperVersion=3.2.0",
+		"distributionUrl=https://repo.maven.apache.org/maven2/org/apache/maven/apache-maven/3.9.6/apache-maven-3.9.6-bin.zip",
+		"distributionSha256Sum=" + strings.Repeat("a", 64),
+		"wrapperUrl=https://repo.maven.apache.org/maven2/org/apache/maven/wrapper/maven-wrapper/3.2.0/maven-wrapper-3.2.0.jar",
+		"wrapperSha256Sum=" + strings.ToUpper(sha256Hex([]byte("official"))),
+	}, "\n")+"\n")
+	client := testClient(t)
+
+	found := findByRule(invokeScan(t, client, workspace).GetFindings(), wrapperIntegrityRuleID)
+	if len(found) != 1 {
+		t.Fatalf("expected one finding, got %d", len(found))
+	}
+	meta := found[0].GetMetadata()
+	if found[0].GetSeverity() != sdk.SeverityHigh || meta["type"] != "wrapper_jar_mismatch" ||
+		meta["checksum_source"] != "wrapperSha256Sum" || meta["version"] != "3.2.0" {
+		t.Errorf("unexpected finding %s %v", found[0].GetSeverity(), meta)
+	}
+
+	// The pinned checksum is compared case-insensitively.
+	writeFile(t, filepath.Join(dir, "maven-wrapper.jar"), "official")
+	if found := findByRule(invokeScan(t, client, workspace).GetFindings(), wrapperIntegrityRuleID); len(found) != 0 {
+		t.Errorf("expected no findings for the pinned jar, got %d", len(found))
+	}
+}